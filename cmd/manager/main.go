@@ -18,15 +18,24 @@ package main
 
 import (
 	goflag "flag"
+	"fmt"
+	"net/http"
 	"os"
+	"strings"
 	"time"
 
 	"github.com/go-logr/glogr"
 	"github.com/pusher/wave/pkg/apis"
+	wavev1alpha1 "github.com/pusher/wave/pkg/apis/wave/v1alpha1"
 	"github.com/pusher/wave/pkg/controller"
+	"github.com/pusher/wave/pkg/core"
+	"github.com/pusher/wave/pkg/leaderelection"
+	"github.com/pusher/wave/pkg/metrics"
 	"github.com/pusher/wave/pkg/webhook"
 	flag "github.com/spf13/pflag"
+	"k8s.io/apimachinery/pkg/types"
 	_ "k8s.io/client-go/plugin/pkg/client/auth"
+	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/client/config"
 	"sigs.k8s.io/controller-runtime/pkg/manager"
 	logf "sigs.k8s.io/controller-runtime/pkg/runtime/log"
@@ -34,10 +43,84 @@ import (
 )
 
 var (
-	leaderElection          = flag.Bool("leader-election", false, "Should the controller use leader election")
-	leaderElectionID        = flag.String("leader-election-id", "", "Name of the configmap used by the leader election system")
-	leaderElectionNamespace = flag.String("leader-election-namespace", "", "Namespace for the configmap used by the leader election system")
-	syncPeriod              = flag.Duration("sync-period", 5*time.Minute, "Reconcile sync period")
+	leaderElection            = flag.Bool("leader-election", false, "Should the controller use leader election")
+	leaderElectionID          = flag.String("leader-election-id", "", "Name of the configmap used by the leader election system")
+	leaderElectionNamespace   = flag.String("leader-election-namespace", "", "Namespace for the configmap used by the leader election system")
+	leaseDuration             = flag.Duration("leader-election-lease-duration", leaderelection.DefaultLeaseDuration, "Duration standby replicas wait before taking over a leader election lease that hasn't been renewed")
+	renewDeadline             = flag.Duration("leader-election-renew-deadline", leaderelection.DefaultRenewDeadline, "Duration the leader retries renewing its lease for before giving up leadership")
+	retryPeriod               = flag.Duration("leader-election-retry-period", leaderelection.DefaultRetryPeriod, "Interval between attempts to acquire or renew the leader election lease")
+	namespace                 = flag.String("namespace", "", "Restrict the cache to workloads and children in this namespace, children referenced in other namespaces are read directly from the API server")
+	syncPeriod                = flag.Duration("sync-period", 5*time.Minute, "Reconcile sync period")
+	recordHashOnMetadata      = flag.Bool("record-hash-on-metadata-if-immutable", true, "Record the configuration hash on the metadata of workloads with an immutable PodTemplate (eg. Jobs)")
+	circuitBreakerThreshold   = flag.Int("circuit-breaker-threshold", 10, "Number of consecutive reconcile failures after which a workload is backed off, 0 disables the circuit breaker")
+	circuitBreakerBackoff     = flag.Duration("circuit-breaker-backoff", 10*time.Minute, "Interval at which backed off workloads are retried")
+	instanceID                = flag.String("instance-id", "", "ID of this Wave instance, workloads claimed by other instances are ignored")
+	hashSalt                  = flag.String("hash-salt", "", "Salt combined with the configuration hash of each workload")
+	generateNameStrategy      = flag.String("generate-name-strategy", string(core.GenerateNameTrack), "How workloads with a generated name are handled (track|ignore)")
+	managePods                = flag.Bool("manage-pods", false, "Manage bare Pods with the required annotation")
+	maxOwnerReferences        = flag.Int("max-owner-references", 0, "Soft cap on the number of OwnerReferences Wave adds to a single child, 0 disables the cap")
+	disableConfigHash         = flag.Bool("disable-config-hash", false, "Only manage OwnerReferences and finalizers, without calculating configuration hashes or triggering rollouts")
+	extraConfigMapPaths       = flag.StringArray("extra-configmap-jsonpath", []string{}, "JSONPath expression evaluated against each workload yielding the names of additional ConfigMaps it references, may be repeated")
+	extraSecretPaths          = flag.StringArray("extra-secret-jsonpath", []string{}, "JSONPath expression evaluated against each workload yielding the names of additional Secrets it references, may be repeated")
+	childRolloutEvents        = flag.Bool("child-rollout-events", false, "Send an event on each ConfigMap and Secret whose change triggered a rollout, naming the workload rolled out")
+	requiredAnnotationValues  = flag.StringSlice("required-annotation-values", []string{"true"}, "Values of the update-on-config-change annotation that enable Wave for a workload")
+	filterWorkloadUpdates     = flag.Bool("filter-workload-updates", false, "Only reconcile workloads when updates change the fields referencing their children, eg. not when only the image or replicas change")
+	metricsAddr               = flag.String("metrics-addr", "", "Address to serve Prometheus metrics on at /metrics and a summary of configuration hashes at /config-hashes (eg. :8080), neither is served if empty")
+	enabledByDefault          = flag.Bool("enabled-by-default", false, "Manage workloads without the update-on-config-change annotation, unless their namespace's annotation disables Wave")
+	childVersionLabel         = flag.String("child-version-label", "", "Key of a label on ConfigMaps and Secrets whose value is included in the configuration hash, in addition to their data")
+	updateOrder               = flag.String("update-order", string(core.UpdateOrderOwnerReferencesFirst), "Whether the OwnerReferences on children or the configuration hash on workloads are updated first (owner-references-first|hash-first)")
+	adoptWithoutRollout       = flag.Bool("adopt-without-rollout", false, "Record the configuration hash of newly managed workloads on their metadata, so that they are only rolled once their configuration changes")
+	extraChildKinds           = flag.StringArray("extra-child-kind", []string{}, "Additional kind of child, as Kind.version.group, that workloads may list in their extra children annotation, may be repeated")
+	waveStatus                = flag.Bool("wave-status", false, "Write the outcome of reconciling each workload to a WaveStatus in its namespace, requires the WaveStatus CRD to be installed")
+	pauseConfigMap            = flag.String("pause-configmap", "", "ConfigMap, as namespace/name, whose wave.pusher.com/pause-rollouts annotation pauses rollouts while set to \"true\"")
+	reconcileTimeout          = flag.Duration("reconcile-timeout", 0, "Maximum duration of a reconcile, after which it is abandoned and the workload requeued, 0 disables the timeout")
+	propagatedLabels          = flag.StringArray("propagate-label", []string{}, "Key of a label copied from each workload onto the companion objects Wave creates for it, may be repeated")
+	hashResourceVersions      = flag.Bool("hash-resource-versions", false, "Include the resourceVersion of each child in the configuration hash, so that any change to a child, including its metadata, triggers a rollout")
+	configMapPolicy           = flag.String("configmap-policy", "", "How ConfigMaps are managed, as a comma separated list of ignore, no-owner-references and no-hash, empty for full management")
+	secretPolicy              = flag.String("secret-policy", "", "How Secrets are managed, as a comma separated list of ignore, no-owner-references and no-hash, empty for full management")
+	checkChildFinalizers      = flag.Bool("check-child-finalizers", false, "Send a Warning event on workloads referencing a ConfigMap or Secret that carries the Wave finalizer")
+	zeroChildrenPolicy        = flag.String("zero-children-policy", string(core.ZeroChildrenManage), "How workloads that reference no ConfigMaps or Secrets are handled (manage|skip)")
+	tlsRotationEvents         = flag.Bool("tls-rotation-events", false, "Send a TLSRotated event, rather than a ConfigChanged event, when a change to a kubernetes.io/tls Secret triggers a rollout")
+	childNamePrefix           = flag.String("child-name-prefix", "", "Only manage ConfigMaps and Secrets whose names start with this prefix, all are managed if empty")
+	hashAlgorithm             = flag.String("hash-algorithm", string(core.HashSHA256), "Algorithm used to calculate configuration hashes, changing it rolls every workload (sha256|fnv)")
+	prioritizeSecrets         = flag.Bool("prioritize-secrets", false, "Service reconciles triggered by Secret changes ahead of those triggered by ConfigMap changes")
+	dryRun                    = flag.Bool("dry-run", false, "Report the configuration hash changes Wave would make to workloads without making them")
+	mirroredAnnotations       = flag.StringArray("mirror-annotation", []string{}, "Key of an annotation copied from each workload onto its PodTemplate along with the config hash, may be repeated")
+	imagePullSecretsPolicy    = flag.String("image-pull-secrets-policy", string(core.ImagePullSecretsIgnore), "Which image pull Secrets of workloads are hashed and owned (ignore|pod|service-account)")
+	hashHistoryLimit          = flag.Int("hash-history-limit", 0, "Number of configuration hashes recorded in the history annotation of each workload, no history is recorded if 0")
+	validatingWebhookAddr     = flag.String("validating-webhook-addr", "", "Address to serve the webhook rejecting workloads with inconsistent Wave annotations on over TLS (eg. :9443), not served if empty")
+	mutatingWebhookAddr       = flag.String("mutating-webhook-addr", "", "Address to serve the webhook adding the required annotation to Deployments in labelled namespaces on over TLS (eg. :9444), not served if empty")
+	webhookNamespaceLabel     = flag.String("webhook-namespace-label", webhook.DefaultNamespaceLabel, "Label on namespaces whose Deployments the mutating webhook adds the required annotation to when set to true")
+	webhookCertDir            = flag.String("webhook-cert-dir", "/etc/wave/webhook-certs", "Directory containing the tls.crt and tls.key the webhooks are served with")
+	emptySecretPolicy         = flag.String("empty-secret-policy", string(core.EmptySecretHash), "How Secrets read without any data are hashed, keep-last hashes the data they were last read with (hash|keep-last)")
+	aggregateEvents           = flag.Bool("aggregate-events", false, "Report the configuration hash update and OwnerReference changes of each reconcile in a single Reconciled event on the workload")
+	requiredAnnotation        = flag.String("required-annotation", core.RequiredAnnotation, "Key of the annotation on workloads and namespaces that enables Wave")
+	configHashAnnotation      = flag.String("config-hash-annotation", core.ConfigHashAnnotation, "Key of the annotation the configuration hash is recorded in")
+	finalizer                 = flag.String("finalizer", core.FinalizerString, "Finalizer added to the workloads Wave manages")
+	kindRequiredAnnotations   = flag.StringArray("kind-required-annotation", []string{}, "Key of the annotation that enables Wave for one kind of workload, as Kind=key, overriding required-annotation, may be repeated")
+	kindConfigHashAnnotations = flag.StringArray("kind-config-hash-annotation", []string{}, "Key of the annotation the configuration hash of one kind of workload is recorded in, as Kind=key, overriding config-hash-annotation, may be repeated")
+	kindFinalizers            = flag.StringArray("kind-finalizer", []string{}, "Finalizer added to one kind of workload, as Kind=finalizer, overriding finalizer, may be repeated")
+	merkleHash                = flag.Bool("merkle-hash", false, "Calculate configuration hashes as the root of a Merkle tree with a leaf for each child, so only changed children are hashed again, changing it rolls every workload")
+	childReads                = flag.String("child-reads", string(core.ChildReadsCache), "Where the children of workloads are read from when hashing them, live reads request each child from the API server (cache|live)")
+	ownerReferenceDenied      = flag.String("owner-reference-denied-policy", string(core.OwnerReferenceDeniedFail), "How a forbidden update adding an OwnerReference to a child is handled, degrade hashes the child without the OwnerReference (fail|degrade)")
+	childRetryBackoff         = flag.Duration("child-retry-backoff", time.Second, "Initial interval after which workloads whose children transiently fail to fetch are retried, doubling on each failure, 0 returns the error to the controller instead")
+	childRetryMaxBackoff      = flag.Duration("child-retry-max-backoff", 5*time.Minute, "Longest interval between retries of workloads whose children fail to fetch")
+	allowedNamespaces         = flag.StringArray("allowed-namespace", []string{}, "Namespace whose workloads are reconciled, workloads in all namespaces are reconciled if none is given, may be repeated")
+	deniedNamespaces          = flag.StringArray("denied-namespace", []string{}, "Namespace whose workloads are never reconciled, even if it is an allowed-namespace, may be repeated")
+	trackChildren             = flag.Bool("tracked-children-annotation", false, "Record the children hashed for each workload in an annotation on its metadata")
+	resyncPeriod              = flag.Duration("resync-period", 0, "Interval after which each managed workload is reconciled again, independently of sync-period, 0 disables the resync")
+	disableFinalizer          = flag.Bool("disable-finalizer", false, "Never add the finalizer to workloads, removing it from those Wave added it to previously, children owned by deleted workloads are then garbage collected")
+	logHashDiffs              = flag.Bool("log-hash-diffs", false, "Log which children and keys changed whenever the configuration hash of a workload changes, and name them in the ConfigChanged event")
+	ownerReferenceMode        = flag.String("owner-reference-mode", string(core.OwnerReferenceBlocking), "Flags of the OwnerReferences added to children, controller sets Controller, non-blocking doesn't set BlockOwnerDeletion (blocking|non-blocking|controller)")
+	maxConcurrentReconciles   = flag.Int("max-concurrent-reconciles", 1, "Number of workloads of each kind reconciled concurrently")
+	manageRollouts            = flag.Bool("manage-argo-rollouts", false, "Manage Argo Rollouts with the required annotation, if the Rollout CRD is installed")
+	ownerRefUpdateAttempts    = flag.Int("owner-reference-update-attempts", 5, "Number of attempts to add an OwnerReference to a child when the update conflicts, before the workload is requeued")
+	ownerRefWarningThreshold  = flag.Int("owner-reference-warning-threshold", 0, "Number of OwnerReferences on a child above which a warning event is recorded on it, 0 disables the warning")
+	manageReplicaSets         = flag.Bool("manage-replicasets", false, "Manage ReplicaSets created directly, rather than by a Deployment, with the required annotation")
+	namespaceDefaults         = flag.Bool("namespace-defaults", false, "Let the required annotation on a namespace choose whether workloads without it are managed, watching namespaces cluster wide")
+	freezeAnnotation          = flag.String("freeze-annotation", core.FreezeAnnotation, "Key of the annotation that freezes the configuration hash recorded on a workload while set to \"true\"")
+	kindFreezeAnnotations     = flag.StringArray("kind-freeze-annotation", []string{}, "Key of the annotation that freezes one kind of workload, as Kind=key, overriding freeze-annotation, may be repeated")
+	daemonSetOnDeletePolicy   = flag.String("daemonset-on-delete-policy", string(core.OnDeleteEvent), "Action taken when the configuration of a DaemonSet using the OnDelete update strategy changes (event|delete-pods)")
 )
 
 func main() {
@@ -59,11 +142,11 @@ func main() {
 
 	// Create a new Cmd to provide shared dependencies and start components
 	log.Info("setting up manager")
+	// Leader election is run around the manager, rather than by it, so that
+	// the lease timings can be configured
 	mgr, err := manager.New(cfg, manager.Options{
-		LeaderElection:          *leaderElection,
-		LeaderElectionID:        *leaderElectionID,
-		LeaderElectionNamespace: *leaderElectionNamespace,
-		SyncPeriod:              syncPeriod,
+		SyncPeriod: syncPeriod,
+		Namespace:  *namespace,
 	})
 	if err != nil {
 		log.Error(err, "unable to set up overall controller manager")
@@ -79,22 +162,254 @@ func main() {
 		os.Exit(1)
 	}
 
+	// Children referenced outside of a namespaced cache are read directly
+	// from the API server
+	var uncachedReader client.Reader
+	if *namespace != "" {
+		uncachedReader, err = client.New(cfg, client.Options{Scheme: mgr.GetScheme()})
+		if err != nil {
+			log.Error(err, "unable to set up uncached client")
+			os.Exit(1)
+		}
+	}
+
+	// Every child is read directly from the API server when reading children
+	// live or force syncing a workload
+	liveReader, err := client.New(cfg, client.Options{Scheme: mgr.GetScheme()})
+	if err != nil {
+		log.Error(err, "unable to set up live client")
+		os.Exit(1)
+	}
+
+	opts := core.Options{
+		DaemonSetOnDeletePolicy:         core.OnDeletePolicy(*daemonSetOnDeletePolicy),
+		RecordHashOnMetadataIfImmutable: *recordHashOnMetadata,
+		CircuitBreakerThreshold:         *circuitBreakerThreshold,
+		CircuitBreakerBackoff:           *circuitBreakerBackoff,
+		InstanceID:                      *instanceID,
+		HashSalt:                        *hashSalt,
+		GenerateNameStrategy:            core.GenerateNameStrategy(*generateNameStrategy),
+		ManagePods:                      *managePods,
+		MaxOwnerReferences:              *maxOwnerReferences,
+		DisableConfigHash:               *disableConfigHash,
+		ExtraConfigMapPaths:             *extraConfigMapPaths,
+		ExtraSecretPaths:                *extraSecretPaths,
+		ChildRolloutEvents:              *childRolloutEvents,
+		RequiredAnnotationValues:        *requiredAnnotationValues,
+		UncachedReader:                  uncachedReader,
+		FilterWorkloadUpdates:           *filterWorkloadUpdates,
+		EnabledByDefault:                *enabledByDefault,
+		ChildVersionLabel:               *childVersionLabel,
+		UpdateOrder:                     core.UpdateOrder(*updateOrder),
+		AdoptWithoutRollout:             *adoptWithoutRollout,
+		WaveStatus:                      *waveStatus,
+		ReconcileTimeout:                *reconcileTimeout,
+		PropagatedLabels:                *propagatedLabels,
+		HashResourceVersions:            *hashResourceVersions,
+		CheckChildFinalizers:            *checkChildFinalizers,
+		ZeroChildrenPolicy:              core.ZeroChildrenPolicy(*zeroChildrenPolicy),
+		TLSRotationEvents:               *tlsRotationEvents,
+		ChildNamePrefix:                 *childNamePrefix,
+		HashAlgorithm:                   core.HashAlgorithm(*hashAlgorithm),
+		PrioritizeSecrets:               *prioritizeSecrets,
+		DryRun:                          *dryRun,
+		MirroredAnnotations:             *mirroredAnnotations,
+		ImagePullSecretsPolicy:          core.ImagePullSecretsPolicy(*imagePullSecretsPolicy),
+		HashHistoryLimit:                *hashHistoryLimit,
+		EmptySecretPolicy:               core.EmptySecretPolicy(*emptySecretPolicy),
+		AggregateEvents:                 *aggregateEvents,
+		RequiredAnnotation:              *requiredAnnotation,
+		ConfigHashAnnotation:            *configHashAnnotation,
+		Finalizer:                       *finalizer,
+		MerkleHash:                      *merkleHash,
+		ChildReads:                      core.ChildReads(*childReads),
+		OwnerReferenceDeniedPolicy:      core.OwnerReferenceDeniedPolicy(*ownerReferenceDenied),
+		ChildRetryBackoff:               *childRetryBackoff,
+		ChildRetryMaxBackoff:            *childRetryMaxBackoff,
+		AllowedNamespaces:               *allowedNamespaces,
+		DeniedNamespaces:                *deniedNamespaces,
+		TrackChildren:                   *trackChildren,
+		ResyncPeriod:                    *resyncPeriod,
+		DisableFinalizer:                *disableFinalizer,
+		LogHashDiffs:                    *logHashDiffs,
+		OwnerReferenceMode:              core.OwnerReferenceMode(*ownerReferenceMode),
+		MaxConcurrentReconciles:         *maxConcurrentReconciles,
+		ManageRollouts:                  *manageRollouts,
+		OwnerReferenceUpdateAttempts:    *ownerRefUpdateAttempts,
+		OwnerReferenceWarningThreshold:  *ownerRefWarningThreshold,
+		ManageReplicaSets:               *manageReplicaSets,
+		NamespaceDefaults:               *namespaceDefaults,
+		LiveReader:                      liveReader,
+		FreezeAnnotation:                *freezeAnnotation,
+	}
+	switch opts.DaemonSetOnDeletePolicy {
+	case core.OnDeleteEvent, core.OnDeleteDeletePods:
+	default:
+		log.Error(fmt.Errorf("unknown policy %q", opts.DaemonSetOnDeletePolicy), "invalid daemonset-on-delete-policy")
+		os.Exit(1)
+	}
+	switch opts.GenerateNameStrategy {
+	case core.GenerateNameTrack, core.GenerateNameIgnore:
+	default:
+		log.Error(fmt.Errorf("unknown strategy %q", opts.GenerateNameStrategy), "invalid generate-name-strategy")
+		os.Exit(1)
+	}
+	switch opts.UpdateOrder {
+	case core.UpdateOrderOwnerReferencesFirst, core.UpdateOrderHashFirst:
+	default:
+		log.Error(fmt.Errorf("unknown order %q", opts.UpdateOrder), "invalid update-order")
+		os.Exit(1)
+	}
+	switch opts.HashAlgorithm {
+	case core.HashSHA256, core.HashFNV:
+	default:
+		log.Error(fmt.Errorf("unknown algorithm %q", opts.HashAlgorithm), "invalid hash-algorithm")
+		os.Exit(1)
+	}
+	switch opts.ZeroChildrenPolicy {
+	case core.ZeroChildrenManage, core.ZeroChildrenSkip:
+	default:
+		log.Error(fmt.Errorf("unknown policy %q", opts.ZeroChildrenPolicy), "invalid zero-children-policy")
+		os.Exit(1)
+	}
+	switch opts.ImagePullSecretsPolicy {
+	case core.ImagePullSecretsIgnore, core.ImagePullSecretsPod, core.ImagePullSecretsServiceAccount:
+	default:
+		log.Error(fmt.Errorf("unknown policy %q", opts.ImagePullSecretsPolicy), "invalid image-pull-secrets-policy")
+		os.Exit(1)
+	}
+	switch opts.EmptySecretPolicy {
+	case core.EmptySecretHash, core.EmptySecretKeepLast:
+	default:
+		log.Error(fmt.Errorf("unknown policy %q", opts.EmptySecretPolicy), "invalid empty-secret-policy")
+		os.Exit(1)
+	}
+	switch opts.OwnerReferenceMode {
+	case core.OwnerReferenceBlocking, core.OwnerReferenceNonBlocking, core.OwnerReferenceController:
+	default:
+		log.Error(fmt.Errorf("unknown mode %q", opts.OwnerReferenceMode), "invalid owner-reference-mode")
+		os.Exit(1)
+	}
+	switch opts.ChildReads {
+	case core.ChildReadsCache, core.ChildReadsLive:
+	default:
+		log.Error(fmt.Errorf("unknown source %q", opts.ChildReads), "invalid child-reads")
+		os.Exit(1)
+	}
+	switch opts.OwnerReferenceDeniedPolicy {
+	case core.OwnerReferenceDeniedFail, core.OwnerReferenceDeniedDegrade:
+	default:
+		log.Error(fmt.Errorf("unknown policy %q", opts.OwnerReferenceDeniedPolicy), "invalid owner-reference-denied-policy")
+		os.Exit(1)
+	}
+	for _, path := range append(append([]string{}, opts.ExtraConfigMapPaths...), opts.ExtraSecretPaths...) {
+		if err := core.ValidateJSONPath(path); err != nil {
+			log.Error(err, "invalid extra child JSONPath", "path", path)
+			os.Exit(1)
+		}
+	}
+	for _, arg := range *extraChildKinds {
+		gvk, err := core.ParseChildKind(arg)
+		if err != nil {
+			log.Error(err, "invalid extra-child-kind")
+			os.Exit(1)
+		}
+		opts.ExtraChildKinds = append(opts.ExtraChildKinds, gvk)
+	}
+	opts.KindAnnotationKeys = make(map[string]core.AnnotationKeys)
+	parseKindKeys := func(flagName string, args []string, set func(*core.AnnotationKeys, string)) {
+		for _, arg := range args {
+			kind, key, err := core.ParseKindKey(arg)
+			if err != nil {
+				log.Error(err, "invalid "+flagName)
+				os.Exit(1)
+			}
+			keys := opts.KindAnnotationKeys[kind]
+			set(&keys, key)
+			opts.KindAnnotationKeys[kind] = keys
+		}
+	}
+	parseKindKeys("kind-required-annotation", *kindRequiredAnnotations, func(keys *core.AnnotationKeys, key string) { keys.RequiredAnnotation = key })
+	parseKindKeys("kind-config-hash-annotation", *kindConfigHashAnnotations, func(keys *core.AnnotationKeys, key string) { keys.ConfigHashAnnotation = key })
+	parseKindKeys("kind-finalizer", *kindFinalizers, func(keys *core.AnnotationKeys, key string) { keys.Finalizer = key })
+	parseKindKeys("kind-freeze-annotation", *kindFreezeAnnotations, func(keys *core.AnnotationKeys, key string) { keys.FreezeAnnotation = key })
+	configMapChildPolicy, err := core.ParseChildPolicy(*configMapPolicy)
+	if err != nil {
+		log.Error(err, "invalid configmap-policy")
+		os.Exit(1)
+	}
+	opts.ConfigMapPolicy = configMapChildPolicy
+	secretChildPolicy, err := core.ParseChildPolicy(*secretPolicy)
+	if err != nil {
+		log.Error(err, "invalid secret-policy")
+		os.Exit(1)
+	}
+	opts.SecretPolicy = secretChildPolicy
+	if *pauseConfigMap != "" {
+		parts := strings.SplitN(*pauseConfigMap, "/", 2)
+		if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+			log.Error(fmt.Errorf("invalid ConfigMap %q, expected namespace/name", *pauseConfigMap), "invalid pause-configmap")
+			os.Exit(1)
+		}
+		opts.PauseConfigMap = types.NamespacedName{Namespace: parts[0], Name: parts[1]}
+	}
+	if opts.WaveStatus {
+		gvk := wavev1alpha1.SchemeGroupVersion.WithKind("WaveStatus")
+		if _, err := mgr.GetRESTMapper().RESTMapping(gvk.GroupKind(), gvk.Version); err != nil {
+			log.Error(err, "WaveStatus CRD not installed, WaveStatuses will not be written")
+			opts.WaveStatus = false
+		}
+	}
+
 	// Setup all Controllers
 	log.Info("Setting up controller")
-	if err := controller.AddToManager(mgr); err != nil {
+	if err := controller.AddToManager(mgr, opts); err != nil {
 		log.Error(err, "unable to register controllers to the manager")
 		os.Exit(1)
 	}
 
 	log.Info("setting up webhooks")
-	if err := webhook.AddToManager(mgr); err != nil {
+	webhookOpts := webhook.Options{
+		ValidatingAddress: *validatingWebhookAddr,
+		MutatingAddress:   *mutatingWebhookAddr,
+		NamespaceLabel:    *webhookNamespaceLabel,
+		CertDir:           *webhookCertDir,
+		Core:              opts,
+	}
+	if err := webhook.AddToManager(mgr, webhookOpts); err != nil {
 		log.Error(err, "unable to register webhooks to the manager")
 		os.Exit(1)
 	}
 
+	if *metricsAddr != "" {
+		log.Info("serving metrics", "address", *metricsAddr)
+		go func() {
+			mux := http.NewServeMux()
+			mux.Handle("/metrics", metrics.Handler())
+			mux.Handle("/config-hashes", core.NewConfigHashSummaryHandler(mgr.GetClient(), opts))
+			if err := http.ListenAndServe(*metricsAddr, mux); err != nil {
+				log.Error(err, "unable to serve metrics")
+				os.Exit(1)
+			}
+		}()
+	}
+
 	// Start the Cmd
 	log.Info("Starting the Cmd.")
-	if err := mgr.Start(signals.SetupSignalHandler()); err != nil {
+	start := mgr.Start
+	if *leaderElection {
+		leaseOpts := leaderelection.Options{
+			Name:          *leaderElectionID,
+			Namespace:     *leaderElectionNamespace,
+			LeaseDuration: *leaseDuration,
+			RenewDeadline: *renewDeadline,
+			RetryPeriod:   *retryPeriod,
+		}
+		start = func(stop <-chan struct{}) error {
+			return leaderelection.Start(cfg, mgr, leaseOpts, stop)
+		}
+	}
+	if err := start(signals.SetupSignalHandler()); err != nil {
 		log.Error(err, "unable to run the manager")
 		os.Exit(1)
 	}
@@ -0,0 +1,102 @@
+/*
+Copyright 2018 Pusher Ltd.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	"encoding/json"
+	"reflect"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+// RolloutSpec is the spec of an Argo Rollout.
+// Only the PodTemplate is decoded, every other field is kept as it was read so
+// that updating a Rollout never drops the fields Wave doesn't know about, eg.
+// its strategy
+type RolloutSpec struct {
+	// Template is the PodTemplate of the Rollout
+	Template corev1.PodTemplateSpec `json:"template,omitempty"`
+
+	// Fields are the other fields of the spec, by name
+	Fields map[string]json.RawMessage `json:"-"`
+}
+
+// UnmarshalJSON decodes the PodTemplate of the spec, keeping its other fields
+func (s *RolloutSpec) UnmarshalJSON(data []byte) error {
+	fields := make(map[string]json.RawMessage)
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return err
+	}
+
+	s.Template = corev1.PodTemplateSpec{}
+	if template, ok := fields["template"]; ok {
+		if err := json.Unmarshal(template, &s.Template); err != nil {
+			return err
+		}
+		delete(fields, "template")
+	}
+	s.Fields = fields
+	return nil
+}
+
+// MarshalJSON encodes the PodTemplate of the spec along with its other
+// fields.
+// Rollouts without a PodTemplate, eg. referencing a workload instead, are
+// encoded without one
+func (s RolloutSpec) MarshalJSON() ([]byte, error) {
+	fields := make(map[string]json.RawMessage, len(s.Fields)+1)
+	for name, value := range s.Fields {
+		fields[name] = value
+	}
+	if !reflect.DeepEqual(s.Template, corev1.PodTemplateSpec{}) {
+		template, err := json.Marshal(s.Template)
+		if err != nil {
+			return nil, err
+		}
+		fields["template"] = template
+	}
+	return json.Marshal(fields)
+}
+
+// +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
+
+// Rollout is an Argo Rollout, which rolls out a new revision whenever its
+// PodTemplate changes
+type Rollout struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec RolloutSpec `json:"spec"`
+
+	// Status is kept as it was read, Wave never modifies it
+	Status *runtime.RawExtension `json:"status,omitempty"`
+}
+
+// +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
+
+// RolloutList contains a list of Rollout
+type RolloutList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []Rollout `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&Rollout{}, &RolloutList{})
+}
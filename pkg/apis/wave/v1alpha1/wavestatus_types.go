@@ -0,0 +1,75 @@
+/*
+Copyright 2018 Pusher Ltd.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// WaveStatusSpec identifies the workload that a WaveStatus reports on
+type WaveStatusSpec struct {
+	// Kind is the kind of the workload (eg. Deployment)
+	Kind string `json:"kind"`
+
+	// Name is the name of the workload, which is always in the same namespace
+	// as the WaveStatus
+	Name string `json:"name"`
+}
+
+// WaveStatusStatus defines the outcome of the last reconcile of the workload
+type WaveStatusStatus struct {
+	// ConfigHash is the configuration hash last calculated for the workload
+	ConfigHash string `json:"configHash,omitempty"`
+
+	// Children lists the children included in the ConfigHash as
+	// "Kind namespace/name"
+	Children []string `json:"children,omitempty"`
+
+	// LastUpdateTime is the time at which the ConfigHash last changed
+	LastUpdateTime *metav1.Time `json:"lastUpdateTime,omitempty"`
+
+	// Error is the error encountered by the last reconcile of the workload, if
+	// any.
+	// The ConfigHash and Children are left unchanged when reconciling fails.
+	Error string `json:"error,omitempty"`
+}
+
+// +genclient
+// +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
+
+// WaveStatus is the Schema for the wavestatuses API
+// +k8s:openapi-gen=true
+type WaveStatus struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   WaveStatusSpec   `json:"spec,omitempty"`
+	Status WaveStatusStatus `json:"status,omitempty"`
+}
+
+// +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
+
+// WaveStatusList contains a list of WaveStatus
+type WaveStatusList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []WaveStatus `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&WaveStatus{}, &WaveStatusList{})
+}
@@ -0,0 +1,68 @@
+/*
+Copyright 2018 Pusher Ltd.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package children
+
+import (
+	"sync"
+
+	"github.com/pusher/wave/pkg/core"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/manager"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+var (
+	// indexes holds the shared ChildIndex for each Manager
+	indexes     = make(map[manager.Manager]*core.ChildIndex)
+	indexesLock sync.Mutex
+)
+
+// Index returns the ChildIndex for the given Manager.
+// Every call with the same Manager returns the same ChildIndex, so that the
+// Handlers of all workload controllers record their children in one index
+func Index(mgr manager.Manager) *core.ChildIndex {
+	indexesLock.Lock()
+	defer indexesLock.Unlock()
+
+	if index, ok := indexes[mgr]; ok {
+		return index
+	}
+	index := core.NewChildIndex()
+	indexes[mgr] = index
+	return index
+}
+
+// EnqueueRequestsForWorkloads returns an EventHandler that enqueues a Request
+// for each workload of the same kind as workloadType that the Manager's
+// ChildIndex records as referencing the child in the event
+func EnqueueRequestsForWorkloads(mgr manager.Manager, workloadType core.Object) handler.EventHandler {
+	index := Index(mgr)
+	return &handler.EnqueueRequestsFromMapFunc{
+		ToRequests: handler.ToRequestsFunc(func(obj handler.MapObject) []reconcile.Request {
+			child, ok := obj.Object.(core.Object)
+			if !ok {
+				return []reconcile.Request{}
+			}
+
+			requests := []reconcile.Request{}
+			for _, name := range index.WorkloadsFor(child, workloadType) {
+				requests = append(requests, reconcile.Request{NamespacedName: name})
+			}
+			return requests
+		}),
+	}
+}
@@ -0,0 +1,120 @@
+/*
+Copyright 2018 Pusher Ltd.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package children
+
+import (
+	"sync"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/pusher/wave/pkg/core"
+	"github.com/pusher/wave/test/utils"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/util/workqueue"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/manager"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+var _ = Describe("Children Index Suite", func() {
+	var c client.Client
+	var m utils.Matcher
+	var mgr manager.Manager
+
+	var deployment *appsv1.Deployment
+	var cm *corev1.ConfigMap
+	var queue workqueue.RateLimitingInterface
+	var mgrStopped *sync.WaitGroup
+	var stopMgr chan struct{}
+
+	const timeout = time.Second * 5
+
+	BeforeEach(func() {
+		var err error
+		mgr, err = manager.New(cfg, manager.Options{})
+		Expect(err).NotTo(HaveOccurred())
+		c = mgr.GetClient()
+		m = utils.Matcher{Client: c}
+		queue = workqueue.NewRateLimitingQueue(workqueue.DefaultControllerRateLimiter())
+
+		stopMgr, mgrStopped = StartTestManager(mgr)
+
+		cm = utils.ExampleConfigMap1.DeepCopy()
+		for _, obj := range []core.Object{
+			cm,
+			utils.ExampleConfigMap2.DeepCopy(),
+			utils.ExampleSecret1.DeepCopy(),
+			utils.ExampleSecret2.DeepCopy(),
+		} {
+			m.Create(obj).Should(Succeed())
+			m.Get(obj, timeout).Should(Succeed())
+		}
+
+		deployment = utils.ExampleDeployment.DeepCopy()
+		deployment.SetAnnotations(map[string]string{core.RequiredAnnotation: "true"})
+		m.Create(deployment).Should(Succeed())
+		m.Get(deployment, timeout).Should(Succeed())
+
+		// Reconcile the Deployment with a Handler recording into the Manager's
+		// ChildIndex
+		h := core.NewHandler(c, mgr.GetRecorder("wave"), core.Options{ChildIndex: Index(mgr)})
+		_, err = h.HandleDeployment(deployment)
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	AfterEach(func() {
+		queue.ShutDown()
+
+		// Make sure to delete the finalizer so the Deployment can be deleted
+		m.Get(deployment, timeout).Should(Succeed())
+		deployment.SetFinalizers([]string{})
+		m.Update(deployment).Should(Succeed())
+
+		close(stopMgr)
+		mgrStopped.Wait()
+
+		utils.DeleteAll(cfg, timeout,
+			&appsv1.DeploymentList{},
+			&corev1.ConfigMapList{},
+			&corev1.SecretList{},
+			&corev1.EventList{},
+		)
+	})
+
+	It("Returns the same Index for the same Manager", func() {
+		Expect(Index(mgr)).To(BeIdenticalTo(Index(mgr)))
+	})
+
+	It("Enqueues a request for each workload referencing the child", func() {
+		EnqueueRequestsForWorkloads(mgr, &appsv1.Deployment{}).Generic(event.GenericEvent{Meta: cm, Object: cm}, queue)
+		Expect(queue.Len()).To(Equal(1))
+
+		req, _ := queue.Get()
+		Expect(req).To(Equal(reconcile.Request{
+			NamespacedName: types.NamespacedName{Namespace: deployment.GetNamespace(), Name: deployment.GetName()},
+		}))
+	})
+
+	It("Doesn't enqueue requests for workloads of other kinds", func() {
+		EnqueueRequestsForWorkloads(mgr, &appsv1.DaemonSet{}).Generic(event.GenericEvent{Meta: cm, Object: cm}, queue)
+		Expect(queue.Len()).To(Equal(0))
+	})
+})
@@ -0,0 +1,68 @@
+/*
+Copyright 2018 Pusher Ltd.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package children
+
+import (
+	"context"
+
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/manager"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+	logf "sigs.k8s.io/controller-runtime/pkg/runtime/log"
+)
+
+// EnqueueRequestsForNamespace returns an EventHandler that enqueues a Request
+// for each workload of the kind listed by workloadList within the Namespace in
+// the event, so that a change to the RequiredAnnotation on a Namespace is
+// applied to its workloads
+func EnqueueRequestsForNamespace(mgr manager.Manager, workloadList runtime.Object) handler.EventHandler {
+	c := mgr.GetClient()
+	return &handler.EnqueueRequestsFromMapFunc{
+		ToRequests: handler.ToRequestsFunc(func(obj handler.MapObject) []reconcile.Request {
+			log := logf.Log.WithName("wave")
+
+			list := workloadList.DeepCopyObject()
+			err := c.List(context.TODO(), &client.ListOptions{Namespace: obj.Meta.GetName()}, list)
+			if err != nil {
+				log.Error(err, "error listing workloads", "namespace", obj.Meta.GetName())
+				return []reconcile.Request{}
+			}
+			items, err := meta.ExtractList(list)
+			if err != nil {
+				log.Error(err, "error extracting workloads", "namespace", obj.Meta.GetName())
+				return []reconcile.Request{}
+			}
+
+			requests := []reconcile.Request{}
+			for _, item := range items {
+				workload, err := meta.Accessor(item)
+				if err != nil {
+					continue
+				}
+				requests = append(requests, reconcile.Request{NamespacedName: types.NamespacedName{
+					Namespace: workload.GetNamespace(),
+					Name:      workload.GetName(),
+				}})
+			}
+			return requests
+		}),
+	}
+}
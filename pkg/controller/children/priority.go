@@ -0,0 +1,159 @@
+/*
+Copyright 2018 Pusher Ltd.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package children
+
+import (
+	"sync"
+	"time"
+
+	"github.com/pusher/wave/pkg/core"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/util/workqueue"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+)
+
+// lowPriorityInterval is how often deferred requests are checked for release
+// into the workqueue
+const lowPriorityInterval = 10 * time.Millisecond
+
+// PrioritizeSecrets wraps the EventHandler so that requests enqueued for
+// ConfigMap events are only added to the workqueue once it is empty, so that
+// requests enqueued for Secret events are always serviced first.
+// The EventHandler is returned unchanged unless PrioritizeSecrets is enabled.
+// It must wrap any other EventHandlers that wrap the workqueue
+func PrioritizeSecrets(opts core.Options, h handler.EventHandler) handler.EventHandler {
+	if !opts.PrioritizeSecrets {
+		return h
+	}
+	return &secretPriorityHandler{
+		EventHandler: h,
+		queues:       make(map[workqueue.RateLimitingInterface]*lowPriorityQueue),
+	}
+}
+
+// secretPriorityHandler passes ConfigMap events to the wrapped EventHandler
+// with a lowPriorityQueue in place of the workqueue
+type secretPriorityHandler struct {
+	handler.EventHandler
+	lock   sync.Mutex
+	queues map[workqueue.RateLimitingInterface]*lowPriorityQueue
+}
+
+// Create implements handler.EventHandler
+func (p *secretPriorityHandler) Create(evt event.CreateEvent, q workqueue.RateLimitingInterface) {
+	p.EventHandler.Create(evt, p.queueFor(evt.Object, q))
+}
+
+// Update implements handler.EventHandler
+func (p *secretPriorityHandler) Update(evt event.UpdateEvent, q workqueue.RateLimitingInterface) {
+	p.EventHandler.Update(evt, p.queueFor(evt.ObjectNew, q))
+}
+
+// Delete implements handler.EventHandler
+func (p *secretPriorityHandler) Delete(evt event.DeleteEvent, q workqueue.RateLimitingInterface) {
+	p.EventHandler.Delete(evt, p.queueFor(evt.Object, q))
+}
+
+// Generic implements handler.EventHandler
+func (p *secretPriorityHandler) Generic(evt event.GenericEvent, q workqueue.RateLimitingInterface) {
+	p.EventHandler.Generic(evt, p.queueFor(evt.Object, q))
+}
+
+// queueFor returns the lowPriorityQueue wrapping the workqueue for ConfigMap
+// events, or the workqueue itself for all other events
+func (p *secretPriorityHandler) queueFor(obj runtime.Object, q workqueue.RateLimitingInterface) workqueue.RateLimitingInterface {
+	if _, ok := obj.(*corev1.ConfigMap); !ok {
+		return q
+	}
+
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	lq, ok := p.queues[q]
+	if !ok {
+		lq = &lowPriorityQueue{RateLimitingInterface: q, queued: make(map[interface{}]struct{})}
+		p.queues[q] = lq
+	}
+	return lq
+}
+
+// lowPriorityQueue defers adding items to the wrapped workqueue until it is
+// empty, releasing them one at a time in the order they were added.
+// Items added directly to the workqueue are therefore always processed first
+type lowPriorityQueue struct {
+	workqueue.RateLimitingInterface
+	lock    sync.Mutex
+	pending []interface{}
+	queued  map[interface{}]struct{}
+	running bool
+}
+
+// Add implements workqueue.Interface
+func (l *lowPriorityQueue) Add(item interface{}) {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	// Items already waiting to be released are deduplicated, as they would be
+	// by the workqueue
+	if _, ok := l.queued[item]; ok {
+		return
+	}
+	l.queued[item] = struct{}{}
+	l.pending = append(l.pending, item)
+
+	if !l.running {
+		l.running = true
+		go l.release()
+	}
+}
+
+// release adds the pending items to the wrapped workqueue whenever it is
+// empty, returning once no items are pending or the workqueue is shut down
+func (l *lowPriorityQueue) release() {
+	ticker := time.NewTicker(lowPriorityInterval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		if l.ShuttingDown() {
+			l.lock.Lock()
+			l.pending = nil
+			l.queued = make(map[interface{}]struct{})
+			l.running = false
+			l.lock.Unlock()
+			return
+		}
+		if l.RateLimitingInterface.Len() > 0 {
+			continue
+		}
+
+		l.lock.Lock()
+		item := l.pending[0]
+		l.pending = l.pending[1:]
+		delete(l.queued, item)
+		done := len(l.pending) == 0
+		if done {
+			l.running = false
+		}
+		l.lock.Unlock()
+
+		l.RateLimitingInterface.Add(item)
+		if done {
+			return
+		}
+	}
+}
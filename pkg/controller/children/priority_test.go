@@ -0,0 +1,129 @@
+/*
+Copyright 2018 Pusher Ltd.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package children
+
+import (
+	"fmt"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/pusher/wave/pkg/core"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/util/workqueue"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+var _ = Describe("Children priority Suite", func() {
+	var queue workqueue.RateLimitingInterface
+
+	const timeout = time.Second * 5
+	const floodSize = 50
+
+	// generic sends a generic event for the child to the EventHandler, which
+	// enqueues a request named after the child
+	var generic = func(h handler.EventHandler, child core.Object) {
+		h.Generic(event.GenericEvent{Meta: child, Object: child}, queue)
+	}
+
+	// next returns the next request serviced from the queue
+	var next = func() reconcile.Request {
+		item, shutdown := queue.Get()
+		Expect(shutdown).To(BeFalse())
+		queue.Done(item)
+		return item.(reconcile.Request)
+	}
+
+	var requestFor = func(name string) reconcile.Request {
+		return reconcile.Request{NamespacedName: types.NamespacedName{Namespace: "default", Name: name}}
+	}
+
+	// flood sends an event for each of floodSize ConfigMaps followed by an
+	// event for a single Secret
+	var flood = func(h handler.EventHandler) {
+		for i := 0; i < floodSize; i++ {
+			generic(h, &corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: fmt.Sprintf("configmap-%d", i)}})
+		}
+		generic(h, &corev1.Secret{ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "secret"}})
+	}
+
+	BeforeEach(func() {
+		queue = workqueue.NewRateLimitingQueue(workqueue.DefaultControllerRateLimiter())
+	})
+
+	AfterEach(func() {
+		queue.ShutDown()
+	})
+
+	It("Services requests in order by default", func() {
+		h := PrioritizeSecrets(core.Options{}, &handler.EnqueueRequestForObject{})
+		flood(h)
+
+		Expect(queue.Len()).To(Equal(floodSize + 1))
+		for i := 0; i < floodSize; i++ {
+			Expect(next()).To(Equal(requestFor(fmt.Sprintf("configmap-%d", i))))
+		}
+		Expect(next()).To(Equal(requestFor("secret")))
+	})
+
+	Context("With PrioritizeSecrets", func() {
+		var h handler.EventHandler
+
+		BeforeEach(func() {
+			h = PrioritizeSecrets(core.Options{PrioritizeSecrets: true}, &handler.EnqueueRequestForObject{})
+		})
+
+		It("Services the Secret request ahead of the flood of ConfigMap requests", func() {
+			flood(h)
+
+			// At most the first ConfigMap request may have been released into
+			// the empty queue before the Secret request was added
+			serviced := []reconcile.Request{next(), next()}
+			Expect(serviced).To(ContainElement(requestFor("secret")))
+		})
+
+		It("Eventually services every ConfigMap request", func() {
+			flood(h)
+
+			serviced := make(map[reconcile.Request]struct{})
+			for i := 0; i < floodSize+1; i++ {
+				serviced[next()] = struct{}{}
+			}
+			Expect(serviced).To(HaveKey(requestFor("secret")))
+			for i := 0; i < floodSize; i++ {
+				Expect(serviced).To(HaveKey(requestFor(fmt.Sprintf("configmap-%d", i))))
+			}
+			Eventually(queue.Len, timeout).Should(BeZero())
+		})
+
+		It("Deduplicates ConfigMap requests waiting to be released", func() {
+			// Keep the queue busy so that the ConfigMap requests are deferred
+			generic(h, &corev1.Secret{ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "secret"}})
+			for i := 0; i < 3; i++ {
+				generic(h, &corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "configmap"}})
+			}
+
+			Expect(next()).To(Equal(requestFor("secret")))
+			Expect(next()).To(Equal(requestFor("configmap")))
+			Consistently(queue.Len, 10*lowPriorityInterval).Should(BeZero())
+		})
+	})
+})
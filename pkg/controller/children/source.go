@@ -0,0 +1,231 @@
+/*
+Copyright 2018 Pusher Ltd.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package children
+
+import (
+	"fmt"
+	"reflect"
+	"sync"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	toolscache "k8s.io/client-go/tools/cache"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/manager"
+	"sigs.k8s.io/controller-runtime/pkg/runtime/inject"
+	"sigs.k8s.io/controller-runtime/pkg/source"
+)
+
+var (
+	// sources holds the shared Source for each Manager
+	sources     = make(map[manager.Manager]*sharedSource)
+	sourcesLock sync.Mutex
+)
+
+// Source returns the Source of ConfigMap, Secret and extraKinds events for the
+// given Manager.
+// Every call with the same Manager returns the same Source, so the children
+// are watched once no matter how many controllers watch the Source, and each
+// event is distributed to all of the controllers watching it.
+// Extra kinds not watched by an earlier call are added to the Source
+func Source(mgr manager.Manager, extraKinds ...schema.GroupVersionKind) (source.Source, error) {
+	sourcesLock.Lock()
+	defer sourcesLock.Unlock()
+
+	src, ok := sources[mgr]
+	if !ok {
+		events := make(chan event.GenericEvent)
+		src = &sharedSource{
+			Channel: &source.Channel{Source: events},
+			events:  events,
+			kinds:   make(map[schema.GroupVersionKind]struct{}),
+		}
+
+		// Register a single handler with the Manager's informers for each
+		// kind of child
+		for _, obj := range []runtime.Object{&corev1.ConfigMap{}, &corev1.Secret{}} {
+			informer, err := mgr.GetCache().GetInformer(obj)
+			if err != nil {
+				return nil, fmt.Errorf("error getting informer for %T: %v", obj, err)
+			}
+			informer.AddEventHandler(src)
+		}
+		sources[mgr] = src
+	}
+
+	// Other kinds are watched through unstructured informers, so that they
+	// don't need to be registered with the Manager's Scheme
+	for _, gvk := range extraKinds {
+		if _, ok := src.kinds[gvk]; ok {
+			continue
+		}
+		obj := &unstructured.Unstructured{}
+		obj.SetGroupVersionKind(gvk)
+		informer, err := mgr.GetCache().GetInformer(obj)
+		if err != nil {
+			return nil, fmt.Errorf("error getting informer for %s: %v", gvk.String(), err)
+		}
+		informer.AddEventHandler(src)
+		src.kinds[gvk] = struct{}{}
+	}
+
+	return src, nil
+}
+
+// sharedSource converts informer events for children into GenericEvents and
+// distributes them to every controller watching it
+type sharedSource struct {
+	*source.Channel
+	events chan event.GenericEvent
+	stop   <-chan struct{}
+
+	// kinds records the extra kinds of children being watched
+	kinds map[schema.GroupVersionKind]struct{}
+}
+
+var _ source.Source = &sharedSource{}
+var _ inject.Stoppable = &sharedSource{}
+var _ toolscache.ResourceEventHandler = &sharedSource{}
+
+// InjectStopChannel is called by the controller when the Source is watched.
+// The stop channel is used to stop sending events once the Manager is stopped
+func (s *sharedSource) InjectStopChannel(stop <-chan struct{}) error {
+	if s.stop == nil {
+		s.stop = stop
+	}
+	return s.Channel.InjectStopChannel(stop)
+}
+
+// OnAdd implements toolscache.ResourceEventHandler
+func (s *sharedSource) OnAdd(obj interface{}) {
+	s.send(obj)
+}
+
+// OnUpdate implements toolscache.ResourceEventHandler
+func (s *sharedSource) OnUpdate(oldObj, newObj interface{}) {
+	// Wave adds OwnerReferences to children while reconciling, ignore these
+	// updates so that they don't requeue the workloads needlessly
+	if isOwnerReferenceAddition(oldObj, newObj) {
+		return
+	}
+
+	s.send(newObj)
+
+	// Send the old object as well when its owners have changed so that owners
+	// which have been removed are also reconciled
+	if !ownerReferencesEqual(oldObj, newObj) {
+		s.send(oldObj)
+	}
+}
+
+// OnDelete implements toolscache.ResourceEventHandler
+func (s *sharedSource) OnDelete(obj interface{}) {
+	// The object may be a tombstone if the watch missed the deletion
+	if tombstone, ok := obj.(toolscache.DeletedFinalStateUnknown); ok {
+		obj = tombstone.Obj
+	}
+	s.send(obj)
+}
+
+// send converts the object to a GenericEvent and passes it on to the
+// underlying Channel
+func (s *sharedSource) send(obj interface{}) {
+	o, ok := obj.(runtime.Object)
+	if !ok {
+		return
+	}
+	m, err := meta.Accessor(o)
+	if err != nil {
+		return
+	}
+
+	select {
+	case s.events <- event.GenericEvent{Meta: m, Object: o}:
+	case <-s.stop:
+	}
+}
+
+// isOwnerReferenceAddition returns true if the only change between the old and
+// new object is the addition of OwnerReferences
+func isOwnerReferenceAddition(oldObj, newObj interface{}) bool {
+	oldCopy, oldMeta, ok := copyWithMeta(oldObj)
+	if !ok {
+		return false
+	}
+	newCopy, newMeta, ok := copyWithMeta(newObj)
+	if !ok {
+		return false
+	}
+
+	// Every existing OwnerReference must still be present
+	for _, oldRef := range oldMeta.GetOwnerReferences() {
+		found := false
+		for _, newRef := range newMeta.GetOwnerReferences() {
+			if reflect.DeepEqual(oldRef, newRef) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	if len(newMeta.GetOwnerReferences()) == len(oldMeta.GetOwnerReferences()) {
+		return false
+	}
+
+	// Ignoring the OwnerReferences and ResourceVersion, the objects must be
+	// identical
+	for _, m := range []metav1.Object{oldMeta, newMeta} {
+		m.SetOwnerReferences(nil)
+		m.SetResourceVersion("")
+	}
+	return reflect.DeepEqual(oldCopy, newCopy)
+}
+
+// ownerReferencesEqual returns true if the old and new object have the same
+// OwnerReferences
+func ownerReferencesEqual(oldObj, newObj interface{}) bool {
+	oldMeta, err := meta.Accessor(oldObj)
+	if err != nil {
+		return true
+	}
+	newMeta, err := meta.Accessor(newObj)
+	if err != nil {
+		return true
+	}
+	return reflect.DeepEqual(oldMeta.GetOwnerReferences(), newMeta.GetOwnerReferences())
+}
+
+// copyWithMeta returns a deep copy of the object along with an accessor for the
+// copy's metadata
+func copyWithMeta(obj interface{}) (runtime.Object, metav1.Object, bool) {
+	o, ok := obj.(runtime.Object)
+	if !ok {
+		return nil, nil, false
+	}
+	copy := o.DeepCopyObject()
+	m, err := meta.Accessor(copy)
+	if err != nil {
+		return nil, nil, false
+	}
+	return copy, m, true
+}
@@ -0,0 +1,210 @@
+/*
+Copyright 2018 Pusher Ltd.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package children
+
+import (
+	"sync"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/pusher/wave/test/utils"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/manager"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+var _ = Describe("Children Source Suite", func() {
+	var c client.Client
+	var m utils.Matcher
+
+	var deployment *appsv1.Deployment
+	var daemonset *appsv1.DaemonSet
+	var cm *corev1.ConfigMap
+	var deploymentRequests chan reconcile.Request
+	var daemonsetRequests chan reconcile.Request
+	var mgrStopped *sync.WaitGroup
+	var stopMgr chan struct{}
+
+	const timeout = time.Second * 5
+	const consistentlyTimeout = time.Second
+
+	// recordRequests returns a Reconciler which sends each request it receives
+	// to the channel without blocking
+	var recordRequests = func(requests chan reconcile.Request) reconcile.Reconciler {
+		return reconcile.Func(func(req reconcile.Request) (reconcile.Result, error) {
+			select {
+			case requests <- req:
+			default:
+			}
+			return reconcile.Result{}, nil
+		})
+	}
+
+	// drain discards requests until none have been received for a while
+	var drain = func(requests chan reconcile.Request) {
+		for {
+			select {
+			case <-requests:
+			case <-time.After(consistentlyTimeout / 2):
+				return
+			}
+		}
+	}
+
+	var requestFor = func(obj metav1.Object) reconcile.Request {
+		return reconcile.Request{
+			NamespacedName: types.NamespacedName{
+				Name:      obj.GetName(),
+				Namespace: obj.GetNamespace(),
+			},
+		}
+	}
+
+	BeforeEach(func() {
+		mgr, err := manager.New(cfg, manager.Options{})
+		Expect(err).NotTo(HaveOccurred())
+		c = mgr.GetClient()
+		m = utils.Matcher{Client: c}
+
+		deploymentRequests = make(chan reconcile.Request, 100)
+		daemonsetRequests = make(chan reconcile.Request, 100)
+
+		// Set up one controller per workload kind, both watching the same Source
+		for name, owner := range map[string]struct {
+			ownerType  utils.Object
+			reconciler reconcile.Reconciler
+		}{
+			"test-deployment-controller": {&appsv1.Deployment{}, recordRequests(deploymentRequests)},
+			"test-daemonset-controller":  {&appsv1.DaemonSet{}, recordRequests(daemonsetRequests)},
+		} {
+			ctrl, err := controller.New(name, mgr, controller.Options{Reconciler: owner.reconciler})
+			Expect(err).NotTo(HaveOccurred())
+
+			src, err := Source(mgr)
+			Expect(err).NotTo(HaveOccurred())
+			err = ctrl.Watch(src, &handler.EnqueueRequestForOwner{
+				IsController: false,
+				OwnerType:    owner.ownerType,
+			})
+			Expect(err).NotTo(HaveOccurred())
+		}
+
+		stopMgr, mgrStopped = StartTestManager(mgr)
+
+		deployment = utils.ExampleDeployment.DeepCopy()
+		daemonset = utils.ExampleDaemonSet.DeepCopy()
+		m.Create(deployment).Should(Succeed())
+		m.Create(daemonset).Should(Succeed())
+		m.Get(deployment, timeout).Should(Succeed())
+		m.Get(daemonset, timeout).Should(Succeed())
+
+		// Create a ConfigMap owned by both workloads
+		cm = utils.ExampleConfigMap1.DeepCopy()
+		cm.SetOwnerReferences([]metav1.OwnerReference{
+			utils.GetOwnerRef(deployment),
+			utils.GetOwnerRef(daemonset),
+		})
+		m.Create(cm).Should(Succeed())
+		m.Get(cm, timeout).Should(Succeed())
+	})
+
+	AfterEach(func() {
+		close(stopMgr)
+		mgrStopped.Wait()
+
+		utils.DeleteAll(cfg, timeout,
+			&appsv1.DeploymentList{},
+			&appsv1.DaemonSetList{},
+			&corev1.ConfigMapList{},
+		)
+	})
+
+	It("Returns the same Source for the same Manager", func() {
+		mgr, err := manager.New(cfg, manager.Options{})
+		Expect(err).NotTo(HaveOccurred())
+
+		src1, err := Source(mgr)
+		Expect(err).NotTo(HaveOccurred())
+		src2, err := Source(mgr)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(src1).To(BeIdenticalTo(src2))
+	})
+
+	Context("When only an OwnerReference is added to a ConfigMap", func() {
+		BeforeEach(func() {
+			cm = utils.ExampleConfigMap2.DeepCopy()
+			cm.SetOwnerReferences([]metav1.OwnerReference{utils.GetOwnerRef(deployment)})
+			m.Create(cm).Should(Succeed())
+			m.Get(cm, timeout).Should(Succeed())
+
+			// Drain any requests from the creation of the ConfigMaps
+			Eventually(deploymentRequests, timeout).Should(Receive(Equal(requestFor(deployment))))
+			drain(deploymentRequests)
+			drain(daemonsetRequests)
+
+			// Add an OwnerReference as Wave would when reconciling the DaemonSet
+			cm.SetOwnerReferences(append(cm.GetOwnerReferences(), utils.GetOwnerRef(daemonset)))
+			m.Update(cm).Should(Succeed())
+		})
+
+		It("Doesn't enqueue a reconcile for the existing owner", func() {
+			Consistently(deploymentRequests, consistentlyTimeout).ShouldNot(Receive(Equal(requestFor(deployment))))
+		})
+
+		It("Doesn't enqueue a reconcile for the new owner", func() {
+			Consistently(daemonsetRequests, consistentlyTimeout).ShouldNot(Receive(Equal(requestFor(daemonset))))
+		})
+
+		Context("And the OwnerReference is removed again", func() {
+			BeforeEach(func() {
+				m.Get(cm, timeout).Should(Succeed())
+				cm.SetOwnerReferences([]metav1.OwnerReference{utils.GetOwnerRef(deployment)})
+				m.Update(cm).Should(Succeed())
+			})
+
+			It("Enqueues a reconcile for the removed owner", func() {
+				Eventually(daemonsetRequests, timeout).Should(Receive(Equal(requestFor(daemonset))))
+			})
+		})
+	})
+
+	Context("When a ConfigMap owned by multiple kinds of workload is updated", func() {
+		BeforeEach(func() {
+			// Drain any requests from the creation of the ConfigMap
+			Eventually(deploymentRequests, timeout).Should(Receive(Equal(requestFor(deployment))))
+			Eventually(daemonsetRequests, timeout).Should(Receive(Equal(requestFor(daemonset))))
+
+			cm.Data["key1"] = "modified"
+			m.Update(cm).Should(Succeed())
+		})
+
+		It("Enqueues a reconcile for the Deployment", func() {
+			Eventually(deploymentRequests, timeout).Should(Receive(Equal(requestFor(deployment))))
+		})
+
+		It("Enqueues a reconcile for the DaemonSet", func() {
+			Eventually(daemonsetRequests, timeout).Should(Receive(Equal(requestFor(daemonset))))
+		})
+	})
+})
@@ -0,0 +1,139 @@
+/*
+Copyright 2018 Pusher Ltd.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package daemonset
+
+import (
+	"context"
+
+	"github.com/pusher/wave/pkg/controller/children"
+	"github.com/pusher/wave/pkg/core"
+	"github.com/pusher/wave/pkg/metrics"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/controller"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/manager"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+	"sigs.k8s.io/controller-runtime/pkg/source"
+)
+
+// Add creates a new DaemonSet Controller and adds it to the Manager with default RBAC. The Manager will set fields on the Controller
+// and Start it when the Manager is Started.
+func Add(mgr manager.Manager, opts core.Options) error {
+	// Use the annotation keys configured for DaemonSets
+	opts = opts.ForKind("DaemonSet")
+	return add(mgr, newReconciler(mgr, opts), opts)
+}
+
+// newReconciler returns a new reconcile.Reconciler
+func newReconciler(mgr manager.Manager, opts core.Options) reconcile.Reconciler {
+	// Record children in the ChildIndex shared by all workload controllers
+	opts.ChildIndex = children.Index(mgr)
+	return &ReconcileDaemonSet{
+		scheme:  mgr.GetScheme(),
+		handler: core.NewHandler(mgr.GetClient(), mgr.GetRecorder("wave"), opts),
+	}
+}
+
+// add adds a new Controller to mgr with r as the reconcile.Reconciler
+func add(mgr manager.Manager, r reconcile.Reconciler, opts core.Options) error {
+	// Create a new controller
+	c, err := controller.New("daemonset-controller", mgr, controller.Options{Reconciler: r, MaxConcurrentReconciles: opts.MaxConcurrentReconciles})
+	if err != nil {
+		return err
+	}
+
+	// Watch for changes to DaemonSet
+	err = c.Watch(&source.Kind{Type: &appsv1.DaemonSet{}}, metrics.EnqueueWithReason("DaemonSet", metrics.ReasonWorkloadChange, &handler.EnqueueRequestForObject{}), core.WorkloadUpdatePredicate(opts))
+	if err != nil {
+		return err
+	}
+
+	// Watch the children referenced by a DaemonSet using the watch on
+	// children shared by all workload controllers, mapping each child to the
+	// DaemonSets the ChildIndex records as referencing it
+	childSource, err := children.Source(mgr, opts.ExtraChildKinds...)
+	if err != nil {
+		return err
+	}
+	err = c.Watch(childSource, children.PrioritizeSecrets(opts, metrics.EnqueueWithReason("DaemonSet", metrics.ReasonChildChange, children.EnqueueRequestsForWorkloads(mgr, &appsv1.DaemonSet{}))))
+	if err != nil {
+		return err
+	}
+
+	// Watch the ServiceAccounts of DaemonSets, whose image pull Secrets are
+	// children with the service-account ImagePullSecretsPolicy, mapping each
+	// ServiceAccount to the DaemonSets the ChildIndex records as running as it
+	if opts.ImagePullSecretsPolicy == core.ImagePullSecretsServiceAccount {
+		err = c.Watch(&source.Kind{Type: &corev1.ServiceAccount{}}, metrics.EnqueueWithReason("DaemonSet", metrics.ReasonChildChange, children.EnqueueRequestsForWorkloads(mgr, &appsv1.DaemonSet{})), core.ServiceAccountUpdatePredicate())
+		if err != nil {
+			return err
+		}
+	}
+
+	// Watch Namespaces, whose RequiredAnnotation chooses whether Wave manages
+	// the DaemonSets within them that don't have it, if namespace defaults are
+	// enabled
+	if opts.NamespaceDefaults {
+		err = c.Watch(&source.Kind{Type: &corev1.Namespace{}}, metrics.EnqueueWithReason("DaemonSet", metrics.ReasonNamespaceChange, children.EnqueueRequestsForNamespace(mgr, &appsv1.DaemonSetList{})), core.NamespaceUpdatePredicate(opts))
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+var _ reconcile.Reconciler = &ReconcileDaemonSet{}
+
+// ReconcileDaemonSet reconciles a DaemonSet object
+type ReconcileDaemonSet struct {
+	scheme  *runtime.Scheme
+	handler *core.Handler
+}
+
+// Reconcile reads that state of the cluster for a DaemonSet object and
+// updates its PodSpec based on mounted configuration
+// +kubebuilder:rbac:groups=apps,resources=daemonsets,verbs=get;list;watch;update;patch
+// +kubebuilder:rbac:groups=,resources=configmaps,verbs=get;list;watch;update;patch
+// +kubebuilder:rbac:groups=,resources=secrets,verbs=get;list;watch;update;patch
+// +kubebuilder:rbac:groups=,resources=pods,verbs=get;list;watch;delete
+// +kubebuilder:rbac:groups=,resources=events,verbs=create;update;patch
+// +kubebuilder:rbac:groups=,resources=namespaces,verbs=get;list;watch
+// +kubebuilder:rbac:groups=,resources=serviceaccounts,verbs=get;list;watch
+// +kubebuilder:rbac:groups=wave.pusher.com,resources=wavestatuses,verbs=get;list;watch;create;update;patch
+func (r *ReconcileDaemonSet) Reconcile(request reconcile.Request) (reconcile.Result, error) {
+	// Record what triggered the reconcile
+	metrics.RecordReconcile("DaemonSet", request)
+
+	// Fetch the DaemonSet instance
+	instance := &appsv1.DaemonSet{}
+	err := r.handler.Get(context.TODO(), request.NamespacedName, instance)
+	if err != nil {
+		if errors.IsNotFound(err) {
+			// Object not found, return.  Created objects are automatically garbage collected.
+			r.handler.HandleNotFound("DaemonSet", request.NamespacedName)
+			return reconcile.Result{}, nil
+		}
+		// Error reading the object - requeue the request.
+		return reconcile.Result{}, err
+	}
+
+	return r.handler.HandleDaemonSet(instance)
+}
@@ -0,0 +1,189 @@
+/*
+Copyright 2018 Pusher Ltd.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package deployment
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/pusher/wave/pkg/core"
+	"github.com/pusher/wave/test/utils"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/manager"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+var _ = Describe("Deployment controller concurrency Suite", func() {
+	var c client.Client
+	var m utils.Matcher
+	var mgr manager.Manager
+
+	var opts core.Options
+	var deployments []*appsv1.Deployment
+	var mgrStopped *sync.WaitGroup
+	var stopMgr chan struct{}
+
+	// The reconciles that are running and the most that ran at once
+	var lock sync.Mutex
+	var running, maxRunning int
+
+	const timeout = time.Second * 10
+	const concurrency = 4
+
+	// trackConcurrency returns a reconcile.Reconciler that delegates to inner,
+	// recording how many reconciles run at once. Each reconcile is slowed
+	// down so that reconciles of different Deployments overlap
+	var trackConcurrency = func(inner reconcile.Reconciler) reconcile.Reconciler {
+		return reconcile.Func(func(req reconcile.Request) (reconcile.Result, error) {
+			lock.Lock()
+			running++
+			if running > maxRunning {
+				maxRunning = running
+			}
+			lock.Unlock()
+
+			defer func() {
+				lock.Lock()
+				running--
+				lock.Unlock()
+			}()
+
+			time.Sleep(200 * time.Millisecond)
+			return inner.Reconcile(req)
+		})
+	}
+
+	var getMaxRunning = func() int {
+		lock.Lock()
+		defer lock.Unlock()
+		return maxRunning
+	}
+
+	var configHash = func(obj *appsv1.Deployment) string {
+		return obj.Spec.Template.GetAnnotations()[core.ConfigHashAnnotation]
+	}
+
+	BeforeEach(func() {
+		var err error
+		mgr, err = manager.New(cfg, manager.Options{})
+		Expect(err).NotTo(HaveOccurred())
+		c = mgr.GetClient()
+		m = utils.Matcher{Client: c}
+
+		running, maxRunning = 0, 0
+		opts = core.Options{MaxConcurrentReconciles: concurrency}
+		Expect(add(mgr, trackConcurrency(newReconciler(mgr, opts)), opts)).NotTo(HaveOccurred())
+
+		stopMgr, mgrStopped = StartTestManager(mgr)
+
+		for _, obj := range []core.Object{
+			utils.ExampleConfigMap1.DeepCopy(),
+			utils.ExampleConfigMap2.DeepCopy(),
+			utils.ExampleSecret1.DeepCopy(),
+			utils.ExampleSecret2.DeepCopy(),
+		} {
+			m.Create(obj).Should(Succeed())
+			m.Get(obj, timeout).Should(Succeed())
+		}
+
+		// Each Deployment also references a ConfigMap of its own, so that
+		// their hashes differ
+		deployments = []*appsv1.Deployment{}
+		for i := 0; i < 2*concurrency; i++ {
+			cm := utils.ExampleConfigMap1.DeepCopy()
+			cm.SetName(fmt.Sprintf("config-%d", i))
+			cm.Data = map[string]string{"index": fmt.Sprintf("%d", i)}
+			m.Create(cm).Should(Succeed())
+			m.Get(cm, timeout).Should(Succeed())
+
+			deployment := utils.ExampleDeployment.DeepCopy()
+			deployment.SetName(fmt.Sprintf("example-%d", i))
+			deployment.SetAnnotations(map[string]string{
+				core.RequiredAnnotation:        "true",
+				core.ExtraConfigMapsAnnotation: cm.GetName(),
+			})
+			deployments = append(deployments, deployment)
+		}
+		for _, deployment := range deployments {
+			m.Create(deployment).Should(Succeed())
+		}
+		for _, deployment := range deployments {
+			m.Eventually(deployment, timeout).Should(utils.WithPodTemplateAnnotations(HaveKey(core.ConfigHashAnnotation)))
+		}
+	})
+
+	AfterEach(func() {
+		// Make sure to delete any finalizers (if the deployments exist)
+		for _, deployment := range deployments {
+			Eventually(func() error {
+				key := types.NamespacedName{Namespace: deployment.GetNamespace(), Name: deployment.GetName()}
+				err := c.Get(context.TODO(), key, deployment)
+				if err != nil && errors.IsNotFound(err) {
+					return nil
+				}
+				if err != nil {
+					return err
+				}
+				deployment.SetFinalizers([]string{})
+				return c.Update(context.TODO(), deployment)
+			}, timeout).Should(Succeed())
+		}
+
+		close(stopMgr)
+		mgrStopped.Wait()
+
+		utils.DeleteAll(cfg, timeout,
+			&appsv1.DeploymentList{},
+			&corev1.ConfigMapList{},
+			&corev1.SecretList{},
+			&corev1.EventList{},
+		)
+	})
+
+	It("Reconciles several Deployments at once", func() {
+		Expect(getMaxRunning()).To(BeNumerically(">", 1))
+		Expect(getMaxRunning()).To(BeNumerically("<=", concurrency))
+	})
+
+	It("Records a different hash on each Deployment", func() {
+		hashes := make(map[string]struct{})
+		for _, deployment := range deployments {
+			hashes[configHash(deployment)] = struct{}{}
+		}
+		Expect(hashes).To(HaveLen(len(deployments)))
+	})
+
+	It("Records the same hashes as reconciling each Deployment alone", func() {
+		h := core.NewHandler(c, mgr.GetRecorder("wave"), core.Options{})
+		for _, deployment := range deployments {
+			hash := configHash(deployment)
+
+			_, err := h.HandleDeployment(deployment)
+			Expect(err).NotTo(HaveOccurred())
+			m.Get(deployment, timeout).Should(Succeed())
+			Expect(configHash(deployment)).To(Equal(hash))
+		}
+	})
+})
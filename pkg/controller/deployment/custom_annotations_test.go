@@ -0,0 +1,184 @@
+/*
+Copyright 2018 Pusher Ltd.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package deployment
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/pusher/wave/pkg/core"
+	"github.com/pusher/wave/test/utils"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/manager"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+var _ = Describe("Deployment controller custom annotations Suite", func() {
+	var c client.Client
+	var m utils.Matcher
+
+	var deployment *appsv1.Deployment
+	var cm1 *corev1.ConfigMap
+	var requests <-chan reconcile.Request
+	var mgrStopped *sync.WaitGroup
+	var stopMgr chan struct{}
+
+	const timeout = time.Second * 5
+	const consistentlyTimeout = time.Second
+
+	const requiredAnnotation = "example.com/update-on-config-change"
+	const configHashAnnotation = "example.com/config-hash"
+	const finalizer = "example.com/finalizer"
+
+	var waitForDeploymentReconciled = func(obj core.Object) {
+		request := reconcile.Request{
+			NamespacedName: types.NamespacedName{
+				Name:      obj.GetName(),
+				Namespace: obj.GetNamespace(),
+			},
+		}
+		Eventually(requests, timeout).Should(Receive(Equal(request)))
+	}
+
+	BeforeEach(func() {
+		mgr, err := manager.New(cfg, manager.Options{})
+		Expect(err).NotTo(HaveOccurred())
+		c = mgr.GetClient()
+		m = utils.Matcher{Client: c}
+
+		opts := core.Options{
+			RequiredAnnotation:   requiredAnnotation,
+			ConfigHashAnnotation: configHashAnnotation,
+			Finalizer:            finalizer,
+		}
+		var recFn reconcile.Reconciler
+		recFn, requests = SetupTestReconcile(newReconciler(mgr, opts))
+		Expect(add(mgr, recFn, opts)).NotTo(HaveOccurred())
+
+		stopMgr, mgrStopped = StartTestManager(mgr)
+
+		cm1 = utils.ExampleConfigMap1.DeepCopy()
+		for _, obj := range []core.Object{
+			cm1,
+			utils.ExampleConfigMap2.DeepCopy(),
+			utils.ExampleSecret1.DeepCopy(),
+			utils.ExampleSecret2.DeepCopy(),
+		} {
+			m.Create(obj).Should(Succeed())
+			m.Get(obj, timeout).Should(Succeed())
+		}
+
+		deployment = utils.ExampleDeployment.DeepCopy()
+	})
+
+	AfterEach(func() {
+		// Make sure to delete any finalizers (if the deployment exists)
+		Eventually(func() error {
+			key := types.NamespacedName{Namespace: deployment.GetNamespace(), Name: deployment.GetName()}
+			err := c.Get(context.TODO(), key, deployment)
+			if err != nil && errors.IsNotFound(err) {
+				return nil
+			}
+			if err != nil {
+				return err
+			}
+			deployment.SetFinalizers([]string{})
+			return c.Update(context.TODO(), deployment)
+		}, timeout).Should(Succeed())
+
+		close(stopMgr)
+		mgrStopped.Wait()
+
+		utils.DeleteAll(cfg, timeout,
+			&appsv1.DeploymentList{},
+			&corev1.ConfigMapList{},
+			&corev1.SecretList{},
+			&corev1.EventList{},
+		)
+	})
+
+	Context("When a Deployment has the custom required annotation", func() {
+		BeforeEach(func() {
+			deployment.SetAnnotations(map[string]string{requiredAnnotation: "true"})
+			m.Create(deployment).Should(Succeed())
+			waitForDeploymentReconciled(deployment)
+
+			m.Eventually(deployment, timeout).Should(utils.WithPodTemplateAnnotations(HaveKey(configHashAnnotation)))
+		})
+
+		It("Records the hash in the custom annotation only", func() {
+			Expect(deployment.Spec.Template.GetAnnotations()).NotTo(HaveKey(core.ConfigHashAnnotation))
+		})
+
+		It("Adds the custom finalizer only", func() {
+			m.Eventually(deployment, timeout).Should(utils.WithFinalizers(And(
+				ContainElement(finalizer),
+				Not(ContainElement(core.FinalizerString)),
+			)))
+		})
+
+		It("Adds OwnerReferences to the children", func() {
+			m.Eventually(cm1, timeout).Should(utils.WithOwnerReferences(ContainElement(utils.GetOwnerRef(deployment))))
+		})
+
+		It("Updates the hash when a child changes", func() {
+			original := deployment.Spec.Template.GetAnnotations()[configHashAnnotation]
+
+			m.Get(cm1, timeout).Should(Succeed())
+			cm1.Data["key1"] = "modified"
+			m.Update(cm1).Should(Succeed())
+			waitForDeploymentReconciled(deployment)
+
+			m.Eventually(deployment, timeout).Should(utils.WithPodTemplateAnnotations(Not(HaveKeyWithValue(configHashAnnotation, original))))
+		})
+
+		Context("And the Deployment is deleted", func() {
+			BeforeEach(func() {
+				m.Delete(deployment).Should(Succeed())
+				m.Eventually(deployment, timeout).ShouldNot(utils.WithDeletionTimestamp(BeNil()))
+				waitForDeploymentReconciled(deployment)
+			})
+
+			It("Removes the custom finalizer", func() {
+				// Removing the finalizer causes the deployment to be deleted
+				m.Get(deployment, timeout).ShouldNot(Succeed())
+			})
+		})
+	})
+
+	Context("When a Deployment only has the default required annotation", func() {
+		BeforeEach(func() {
+			deployment.SetAnnotations(map[string]string{core.RequiredAnnotation: "true"})
+			m.Create(deployment).Should(Succeed())
+			waitForDeploymentReconciled(deployment)
+		})
+
+		It("Doesn't manage the Deployment", func() {
+			m.Consistently(deployment, consistentlyTimeout).Should(utils.WithPodTemplateAnnotations(And(
+				Not(HaveKey(configHashAnnotation)),
+				Not(HaveKey(core.ConfigHashAnnotation)),
+			)))
+		})
+	})
+})
@@ -19,7 +19,9 @@ package deployment
 import (
 	"context"
 
+	"github.com/pusher/wave/pkg/controller/children"
 	"github.com/pusher/wave/pkg/core"
+	"github.com/pusher/wave/pkg/metrics"
 	appsv1 "k8s.io/api/apps/v1"
 	corev1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/api/errors"
@@ -33,50 +35,68 @@ import (
 
 // Add creates a new Deployment Controller and adds it to the Manager with default RBAC. The Manager will set fields on the Controller
 // and Start it when the Manager is Started.
-func Add(mgr manager.Manager) error {
-	return add(mgr, newReconciler(mgr))
+func Add(mgr manager.Manager, opts core.Options) error {
+	// Use the annotation keys configured for Deployments
+	opts = opts.ForKind("Deployment")
+	return add(mgr, newReconciler(mgr, opts), opts)
 }
 
 // newReconciler returns a new reconcile.Reconciler
-func newReconciler(mgr manager.Manager) reconcile.Reconciler {
+func newReconciler(mgr manager.Manager, opts core.Options) reconcile.Reconciler {
+	// Record children in the ChildIndex shared by all workload controllers
+	opts.ChildIndex = children.Index(mgr)
 	return &ReconcileDeployment{
 		scheme:  mgr.GetScheme(),
-		handler: core.NewHandler(mgr.GetClient(), mgr.GetRecorder("wave")),
+		handler: core.NewHandler(mgr.GetClient(), mgr.GetRecorder("wave"), opts),
 	}
 }
 
 // add adds a new Controller to mgr with r as the reconcile.Reconciler
-func add(mgr manager.Manager, r reconcile.Reconciler) error {
+func add(mgr manager.Manager, r reconcile.Reconciler, opts core.Options) error {
 	// Create a new controller
-	c, err := controller.New("deployment-controller", mgr, controller.Options{Reconciler: r})
+	c, err := controller.New("deployment-controller", mgr, controller.Options{Reconciler: r, MaxConcurrentReconciles: opts.MaxConcurrentReconciles})
 	if err != nil {
 		return err
 	}
 
 	// Watch for changes to Deployment
-	err = c.Watch(&source.Kind{Type: &appsv1.Deployment{}}, &handler.EnqueueRequestForObject{})
+	err = c.Watch(&source.Kind{Type: &appsv1.Deployment{}}, metrics.EnqueueWithReason("Deployment", metrics.ReasonWorkloadChange, &handler.EnqueueRequestForObject{}), core.WorkloadUpdatePredicate(opts))
 	if err != nil {
 		return err
 	}
 
-	// Watch ConfigMaps owned by a Deployment
-	err = c.Watch(&source.Kind{Type: &corev1.ConfigMap{}}, &handler.EnqueueRequestForOwner{
-		IsController: false,
-		OwnerType:    &appsv1.Deployment{},
-	})
+	// Watch the children referenced by a Deployment using the watch on
+	// children shared by all workload controllers, mapping each child to the
+	// Deployments the ChildIndex records as referencing it
+	childSource, err := children.Source(mgr, opts.ExtraChildKinds...)
 	if err != nil {
 		return err
 	}
-
-	// Watch Secrets owned by a Deployment
-	err = c.Watch(&source.Kind{Type: &corev1.Secret{}}, &handler.EnqueueRequestForOwner{
-		IsController: false,
-		OwnerType:    &appsv1.Deployment{},
-	})
+	err = c.Watch(childSource, children.PrioritizeSecrets(opts, metrics.EnqueueWithReason("Deployment", metrics.ReasonChildChange, children.EnqueueRequestsForWorkloads(mgr, &appsv1.Deployment{}))))
 	if err != nil {
 		return err
 	}
 
+	// Watch the ServiceAccounts of Deployments, whose image pull Secrets are
+	// children with the service-account ImagePullSecretsPolicy, mapping each
+	// ServiceAccount to the Deployments the ChildIndex records as running as it
+	if opts.ImagePullSecretsPolicy == core.ImagePullSecretsServiceAccount {
+		err = c.Watch(&source.Kind{Type: &corev1.ServiceAccount{}}, metrics.EnqueueWithReason("Deployment", metrics.ReasonChildChange, children.EnqueueRequestsForWorkloads(mgr, &appsv1.Deployment{})), core.ServiceAccountUpdatePredicate())
+		if err != nil {
+			return err
+		}
+	}
+
+	// Watch Namespaces, whose RequiredAnnotation chooses whether Wave manages
+	// the Deployments within them that don't have it, if namespace defaults are
+	// enabled
+	if opts.NamespaceDefaults {
+		err = c.Watch(&source.Kind{Type: &corev1.Namespace{}}, metrics.EnqueueWithReason("Deployment", metrics.ReasonNamespaceChange, children.EnqueueRequestsForNamespace(mgr, &appsv1.DeploymentList{})), core.NamespaceUpdatePredicate(opts))
+		if err != nil {
+			return err
+		}
+	}
+
 	return nil
 }
 
@@ -94,13 +114,20 @@ type ReconcileDeployment struct {
 // +kubebuilder:rbac:groups=,resources=configmaps,verbs=get;list;watch;update;patch
 // +kubebuilder:rbac:groups=,resources=secrets,verbs=get;list;watch;update;patch
 // +kubebuilder:rbac:groups=,resources=events,verbs=create;update;patch
+// +kubebuilder:rbac:groups=,resources=namespaces,verbs=get;list;watch
+// +kubebuilder:rbac:groups=,resources=serviceaccounts,verbs=get;list;watch
+// +kubebuilder:rbac:groups=wave.pusher.com,resources=wavestatuses,verbs=get;list;watch;create;update;patch
 func (r *ReconcileDeployment) Reconcile(request reconcile.Request) (reconcile.Result, error) {
+	// Record what triggered the reconcile
+	metrics.RecordReconcile("Deployment", request)
+
 	// Fetch the Deployment instance
 	instance := &appsv1.Deployment{}
 	err := r.handler.Get(context.TODO(), request.NamespacedName, instance)
 	if err != nil {
 		if errors.IsNotFound(err) {
 			// Object not found, return.  Created objects are automatically garbage collected.
+			r.handler.HandleNotFound("Deployment", request.NamespacedName)
 			return reconcile.Result{}, nil
 		}
 		// Error reading the object - requeue the request.
@@ -45,7 +45,10 @@ var t *envtest.Environment
 
 var _ = BeforeSuite(func() {
 	t = &envtest.Environment{
-		CRDDirectoryPaths: []string{filepath.Join("..", "..", "..", "config", "crds")},
+		CRDDirectoryPaths: []string{
+			filepath.Join("..", "..", "..", "config", "crds"),
+			filepath.Join("..", "..", "..", "test", "crds"),
+		},
 	}
 	apis.AddToScheme(scheme.Scheme)
 
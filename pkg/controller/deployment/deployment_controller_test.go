@@ -25,6 +25,7 @@ import (
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/gomega"
 	"github.com/pusher/wave/pkg/core"
+	"github.com/pusher/wave/pkg/metrics"
 	"github.com/pusher/wave/test/utils"
 	appsv1 "k8s.io/api/apps/v1"
 	corev1 "k8s.io/api/core/v1"
@@ -72,8 +73,8 @@ var _ = Describe("Deployment controller Suite", func() {
 		m = utils.Matcher{Client: c}
 
 		var recFn reconcile.Reconciler
-		recFn, requests = SetupTestReconcile(newReconciler(mgr))
-		Expect(add(mgr, recFn)).NotTo(HaveOccurred())
+		recFn, requests = SetupTestReconcile(newReconciler(mgr, core.Options{}))
+		Expect(add(mgr, recFn, core.Options{})).NotTo(HaveOccurred())
 
 		stopMgr, mgrStopped = StartTestManager(mgr)
 
@@ -181,7 +182,7 @@ var _ = Describe("Deployment controller Suite", func() {
 					return event.Message
 				}
 
-				hashMessage := "Configuration hash updated to 198df8455a4fd702fc0c7fdfa4bdb213363b96240bfd48b7b098d936499315a1"
+				hashMessage := "Configuration hash updated to fa2bd7afa9869023533623e10bad323fb53b713ff48521233a69aede24619525"
 				m.Eventually(events, timeout).Should(utils.WithItems(ContainElement(WithTransform(eventMessage, Equal(hashMessage)))))
 			})
 
@@ -225,7 +226,11 @@ var _ = Describe("Deployment controller Suite", func() {
 				})
 
 				Context("A ConfigMap volume is updated", func() {
+					var childChanges float64
+
 					BeforeEach(func() {
+						childChanges = metrics.ReconcilesTotal.Value("Deployment", string(metrics.ReasonChildChange))
+
 						m.Get(cm1, timeout).Should(Succeed())
 						cm1.Data["key1"] = "modified"
 						m.Update(cm1).Should(Succeed())
@@ -239,6 +244,10 @@ var _ = Describe("Deployment controller Suite", func() {
 					It("Updates the config hash in the Pod Template", func() {
 						m.Eventually(deployment, timeout).ShouldNot(utils.WithAnnotations(HaveKeyWithValue(core.ConfigHashAnnotation, originalHash)))
 					})
+
+					It("Counts the reconcile as triggered by a child change", func() {
+						Expect(metrics.ReconcilesTotal.Value("Deployment", string(metrics.ReasonChildChange))).To(BeNumerically(">", childChanges))
+					})
 				})
 
 				Context("A ConfigMap EnvSource is updated", func() {
@@ -299,6 +308,38 @@ var _ = Describe("Deployment controller Suite", func() {
 				})
 			})
 
+			Context("And the poke annotation is bumped", func() {
+				var originalHash string
+				var generation int64
+
+				BeforeEach(func() {
+					m.Eventually(deployment, timeout).Should(utils.WithPodTemplateAnnotations(HaveKey(core.ConfigHashAnnotation)))
+					originalHash = deployment.Spec.Template.GetAnnotations()[core.ConfigHashAnnotation]
+					generation = deployment.GetGeneration()
+
+					annotations := deployment.GetAnnotations()
+					annotations[core.PokeAnnotation] = "1"
+					deployment.SetAnnotations(annotations)
+					m.Update(deployment).Should(Succeed())
+				})
+
+				It("Reconciles the Deployment", func() {
+					waitForDeploymentReconciled(deployment)
+				})
+
+				It("Doesn't change the config hash in the Pod Template", func() {
+					waitForDeploymentReconciled(deployment)
+					m.Consistently(deployment, consistentlyTimeout).Should(utils.WithPodTemplateAnnotations(HaveKeyWithValue(core.ConfigHashAnnotation, originalHash)))
+				})
+
+				It("Doesn't roll the Deployment", func() {
+					waitForDeploymentReconciled(deployment)
+					m.Consistently(deployment, consistentlyTimeout).Should(WithTransform(func(obj *appsv1.Deployment) int64 {
+						return obj.GetGeneration()
+					}, Equal(generation)))
+				})
+			})
+
 			Context("And the annotation is removed", func() {
 				BeforeEach(func() {
 					m.Get(deployment, timeout).Should(Succeed())
@@ -0,0 +1,173 @@
+/*
+Copyright 2018 Pusher Ltd.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package deployment
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/pusher/wave/pkg/core"
+	"github.com/pusher/wave/test/utils"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/manager"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+var _ = Describe("Deployment controller extra children Suite", func() {
+	var c client.Client
+	var m utils.Matcher
+
+	var deployment *appsv1.Deployment
+	var widget *unstructured.Unstructured
+	var requests <-chan reconcile.Request
+	var mgrStopped *sync.WaitGroup
+	var stopMgr chan struct{}
+
+	const timeout = time.Second * 5
+	const consistentlyTimeout = time.Second
+
+	// widgetKind is the kind of the custom resource installed from test/crds
+	var widgetKind = schema.GroupVersionKind{Group: "test.wave.pusher.com", Version: "v1alpha1", Kind: "Widget"}
+
+	var waitForDeploymentReconciled = func(obj core.Object) {
+		request := reconcile.Request{
+			NamespacedName: types.NamespacedName{
+				Name:      obj.GetName(),
+				Namespace: obj.GetNamespace(),
+			},
+		}
+		Eventually(requests, timeout).Should(Receive(Equal(request)))
+	}
+
+	BeforeEach(func() {
+		mgr, err := manager.New(cfg, manager.Options{})
+		Expect(err).NotTo(HaveOccurred())
+		c = mgr.GetClient()
+		m = utils.Matcher{Client: c}
+
+		opts := core.Options{ExtraChildKinds: []schema.GroupVersionKind{widgetKind}}
+		var recFn reconcile.Reconciler
+		recFn, requests = SetupTestReconcile(newReconciler(mgr, opts))
+		Expect(add(mgr, recFn, opts)).NotTo(HaveOccurred())
+
+		stopMgr, mgrStopped = StartTestManager(mgr)
+
+		for _, obj := range []core.Object{
+			utils.ExampleConfigMap1.DeepCopy(),
+			utils.ExampleConfigMap2.DeepCopy(),
+			utils.ExampleSecret1.DeepCopy(),
+			utils.ExampleSecret2.DeepCopy(),
+		} {
+			m.Create(obj).Should(Succeed())
+			m.Get(obj, timeout).Should(Succeed())
+		}
+
+		widget = &unstructured.Unstructured{}
+		widget.SetGroupVersionKind(widgetKind)
+		widget.SetNamespace("default")
+		widget.SetName("example-widget")
+		widget.Object["spec"] = map[string]interface{}{"size": "small"}
+		m.Create(widget).Should(Succeed())
+		m.Get(widget, timeout).Should(Succeed())
+
+		// Create a Deployment listing the Widget and wait for it to be
+		// reconciled
+		deployment = utils.ExampleDeployment.DeepCopy()
+		deployment.SetAnnotations(map[string]string{
+			core.RequiredAnnotation:      "true",
+			core.ExtraChildrenAnnotation: "Widget:example-widget",
+		})
+		m.Create(deployment).Should(Succeed())
+		waitForDeploymentReconciled(deployment)
+
+		m.Eventually(deployment, timeout).Should(utils.WithPodTemplateAnnotations(HaveKey(core.ConfigHashAnnotation)))
+	})
+
+	AfterEach(func() {
+		// Make sure to delete any finalizers (if the deployment exists)
+		Eventually(func() error {
+			key := types.NamespacedName{Namespace: deployment.GetNamespace(), Name: deployment.GetName()}
+			err := c.Get(context.TODO(), key, deployment)
+			if err != nil && errors.IsNotFound(err) {
+				return nil
+			}
+			if err != nil {
+				return err
+			}
+			deployment.SetFinalizers([]string{})
+			return c.Update(context.TODO(), deployment)
+		}, timeout).Should(Succeed())
+
+		close(stopMgr)
+		mgrStopped.Wait()
+
+		widgets := &unstructured.UnstructuredList{}
+		widgets.SetGroupVersionKind(widgetKind.GroupVersion().WithKind("WidgetList"))
+		utils.DeleteAll(cfg, timeout,
+			&appsv1.DeploymentList{},
+			&corev1.ConfigMapList{},
+			&corev1.SecretList{},
+			&corev1.EventList{},
+			widgets,
+		)
+	})
+
+	It("Includes the Widget in the config hash", func() {
+		withoutWidget := deployment.DeepCopy()
+		withoutWidget.SetAnnotations(map[string]string{core.RequiredAnnotation: "true"})
+		m.Update(withoutWidget).Should(Succeed())
+		waitForDeploymentReconciled(deployment)
+
+		hash := deployment.Spec.Template.GetAnnotations()[core.ConfigHashAnnotation]
+		m.Eventually(deployment, timeout).Should(utils.WithPodTemplateAnnotations(Not(HaveKeyWithValue(core.ConfigHashAnnotation, hash))))
+	})
+
+	It("Doesn't add an OwnerReference to the Widget", func() {
+		m.Consistently(widget, consistentlyTimeout).Should(utils.WithOwnerReferences(BeEmpty()))
+	})
+
+	Context("And the Widget is updated", func() {
+		var originalHash string
+		BeforeEach(func() {
+			originalHash = deployment.Spec.Template.GetAnnotations()[core.ConfigHashAnnotation]
+
+			widget.Object["spec"] = map[string]interface{}{"size": "large"}
+			m.Update(widget).Should(Succeed())
+			waitForDeploymentReconciled(deployment)
+		})
+
+		It("Updates the config hash in the Pod Template", func() {
+			m.Eventually(deployment, timeout).Should(utils.WithPodTemplateAnnotations(Not(HaveKeyWithValue(core.ConfigHashAnnotation, originalHash))))
+		})
+
+		It("Rolls the Deployment", func() {
+			generation := deployment.GetGeneration()
+			m.Eventually(deployment, timeout).Should(WithTransform(func(obj *appsv1.Deployment) int64 {
+				return obj.GetGeneration()
+			}, BeNumerically(">", generation)))
+		})
+	})
+})
@@ -0,0 +1,150 @@
+/*
+Copyright 2018 Pusher Ltd.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package deployment
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/pusher/wave/pkg/core"
+	"github.com/pusher/wave/test/utils"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/manager"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+var _ = Describe("Deployment controller resync Suite", func() {
+	var c client.Client
+	var m utils.Matcher
+
+	var deployment *appsv1.Deployment
+	var request reconcile.Request
+	var requests <-chan reconcile.Request
+	var mgrStopped *sync.WaitGroup
+	var stopMgr chan struct{}
+
+	const timeout = time.Second * 5
+	const consistentlyTimeout = time.Second
+	const resyncPeriod = 500 * time.Millisecond
+
+	// waitForIdle receives reconcile requests until none is received for the
+	// idle period, so that the reconciles triggered by Wave's own updates to
+	// the Deployment have completed
+	var waitForIdle = func(idle time.Duration) {
+		for {
+			select {
+			case <-requests:
+			case <-time.After(idle):
+				return
+			}
+		}
+	}
+
+	// start runs the controller with the options and creates a managed
+	// Deployment, waiting for its hash to be recorded
+	var start = func(opts core.Options) {
+		mgr, err := manager.New(cfg, manager.Options{})
+		Expect(err).NotTo(HaveOccurred())
+		c = mgr.GetClient()
+		m = utils.Matcher{Client: c}
+
+		var recFn reconcile.Reconciler
+		recFn, requests = SetupTestReconcile(newReconciler(mgr, opts))
+		Expect(add(mgr, recFn, opts)).NotTo(HaveOccurred())
+
+		stopMgr, mgrStopped = StartTestManager(mgr)
+
+		for _, obj := range []core.Object{
+			utils.ExampleConfigMap1.DeepCopy(),
+			utils.ExampleConfigMap2.DeepCopy(),
+			utils.ExampleSecret1.DeepCopy(),
+			utils.ExampleSecret2.DeepCopy(),
+		} {
+			m.Create(obj).Should(Succeed())
+			m.Get(obj, timeout).Should(Succeed())
+		}
+
+		deployment = utils.ExampleDeployment.DeepCopy()
+		deployment.SetAnnotations(map[string]string{core.RequiredAnnotation: "true"})
+		m.Create(deployment).Should(Succeed())
+		request = reconcile.Request{NamespacedName: types.NamespacedName{Namespace: deployment.GetNamespace(), Name: deployment.GetName()}}
+		Eventually(requests, timeout).Should(Receive(Equal(request)))
+
+		m.Eventually(deployment, timeout).Should(utils.WithPodTemplateAnnotations(HaveKey(core.ConfigHashAnnotation)))
+		waitForIdle(resyncPeriod / 5)
+		m.Get(deployment, timeout).Should(Succeed())
+	}
+
+	AfterEach(func() {
+		// Make sure to delete any finalizers (if the deployment exists)
+		Eventually(func() error {
+			key := types.NamespacedName{Namespace: deployment.GetNamespace(), Name: deployment.GetName()}
+			err := c.Get(context.TODO(), key, deployment)
+			if err != nil && errors.IsNotFound(err) {
+				return nil
+			}
+			if err != nil {
+				return err
+			}
+			deployment.SetFinalizers([]string{})
+			return c.Update(context.TODO(), deployment)
+		}, timeout).Should(Succeed())
+
+		close(stopMgr)
+		mgrStopped.Wait()
+
+		utils.DeleteAll(cfg, timeout,
+			&appsv1.DeploymentList{},
+			&corev1.ConfigMapList{},
+			&corev1.SecretList{},
+			&corev1.EventList{},
+		)
+	})
+
+	Context("With a ResyncPeriod", func() {
+		BeforeEach(func() {
+			start(core.Options{ResyncPeriod: resyncPeriod})
+		})
+
+		It("Reconciles the unchanged Deployment within the ResyncPeriod", func() {
+			resourceVersion := deployment.GetResourceVersion()
+			for i := 0; i < 3; i++ {
+				Eventually(requests, 2*resyncPeriod).Should(Receive(Equal(request)))
+			}
+
+			m.Get(deployment, timeout).Should(Succeed())
+			Expect(deployment.GetResourceVersion()).To(Equal(resourceVersion))
+		})
+	})
+
+	Context("Without a ResyncPeriod", func() {
+		BeforeEach(func() {
+			start(core.Options{})
+		})
+
+		It("Doesn't reconcile the unchanged Deployment", func() {
+			Consistently(requests, consistentlyTimeout).ShouldNot(Receive())
+		})
+	})
+})
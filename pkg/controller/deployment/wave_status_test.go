@@ -0,0 +1,222 @@
+/*
+Copyright 2018 Pusher Ltd.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package deployment
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	wavev1alpha1 "github.com/pusher/wave/pkg/apis/wave/v1alpha1"
+	"github.com/pusher/wave/pkg/core"
+	"github.com/pusher/wave/test/utils"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/manager"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+var _ = Describe("Deployment controller WaveStatus Suite", func() {
+	var c client.Client
+	var m utils.Matcher
+
+	var deployment *appsv1.Deployment
+	var cm1 *corev1.ConfigMap
+	var status *wavev1alpha1.WaveStatus
+	var requests <-chan reconcile.Request
+	var mgrStopped *sync.WaitGroup
+	var stopMgr chan struct{}
+
+	const timeout = time.Second * 5
+
+	var waitForDeploymentReconciled = func(obj core.Object) {
+		request := reconcile.Request{
+			NamespacedName: types.NamespacedName{
+				Name:      obj.GetName(),
+				Namespace: obj.GetNamespace(),
+			},
+		}
+		Eventually(requests, timeout).Should(Receive(Equal(request)))
+	}
+
+	var statusHash = func(obj *wavev1alpha1.WaveStatus) string {
+		return obj.Status.ConfigHash
+	}
+
+	BeforeEach(func() {
+		mgr, err := manager.New(cfg, manager.Options{})
+		Expect(err).NotTo(HaveOccurred())
+		c = mgr.GetClient()
+		m = utils.Matcher{Client: c}
+
+		opts := core.Options{WaveStatus: true, PropagatedLabels: []string{"team", "missing"}}
+		var recFn reconcile.Reconciler
+		recFn, requests = SetupTestReconcile(newReconciler(mgr, opts))
+		Expect(add(mgr, recFn, opts)).NotTo(HaveOccurred())
+
+		stopMgr, mgrStopped = StartTestManager(mgr)
+
+		cm1 = utils.ExampleConfigMap1.DeepCopy()
+		for _, obj := range []core.Object{
+			cm1,
+			utils.ExampleConfigMap2.DeepCopy(),
+			utils.ExampleSecret1.DeepCopy(),
+			utils.ExampleSecret2.DeepCopy(),
+		} {
+			m.Create(obj).Should(Succeed())
+			m.Get(obj, timeout).Should(Succeed())
+		}
+
+		deployment = utils.ExampleDeployment.DeepCopy()
+		deployment.SetAnnotations(map[string]string{core.RequiredAnnotation: "true"})
+		deployment.SetLabels(map[string]string{"app": "example", "team": "payments"})
+		m.Create(deployment).Should(Succeed())
+		waitForDeploymentReconciled(deployment)
+
+		m.Eventually(deployment, timeout).Should(utils.WithPodTemplateAnnotations(HaveKey(core.ConfigHashAnnotation)))
+
+		status = &wavev1alpha1.WaveStatus{}
+		status.SetNamespace(deployment.GetNamespace())
+		status.SetName("deployment-" + deployment.GetName())
+	})
+
+	AfterEach(func() {
+		// Make sure to delete any finalizers (if the deployment exists)
+		Eventually(func() error {
+			key := types.NamespacedName{Namespace: deployment.GetNamespace(), Name: deployment.GetName()}
+			err := c.Get(context.TODO(), key, deployment)
+			if err != nil && errors.IsNotFound(err) {
+				return nil
+			}
+			if err != nil {
+				return err
+			}
+			deployment.SetFinalizers([]string{})
+			return c.Update(context.TODO(), deployment)
+		}, timeout).Should(Succeed())
+
+		close(stopMgr)
+		mgrStopped.Wait()
+
+		utils.DeleteAll(cfg, timeout,
+			&appsv1.DeploymentList{},
+			&corev1.ConfigMapList{},
+			&corev1.SecretList{},
+			&corev1.EventList{},
+			&wavev1alpha1.WaveStatusList{},
+		)
+	})
+
+	It("Creates a WaveStatus owned by the Deployment", func() {
+		m.Get(status, timeout).Should(Succeed())
+		Expect(status.Spec).To(Equal(wavev1alpha1.WaveStatusSpec{Kind: "Deployment", Name: deployment.GetName()}))
+		Expect(status.GetOwnerReferences()).To(ContainElement(utils.GetOwnerRef(deployment)))
+	})
+
+	It("Copies the configured labels onto the WaveStatus", func() {
+		m.Get(status, timeout).Should(Succeed())
+		Expect(status.GetLabels()).To(Equal(map[string]string{"team": "payments"}))
+	})
+
+	It("Mirrors the Deployment's config hash and children", func() {
+		hash := deployment.Spec.Template.GetAnnotations()[core.ConfigHashAnnotation]
+		m.Eventually(status, timeout).Should(WithTransform(statusHash, Equal(hash)))
+		Expect(status.Status.Children).To(Equal([]string{
+			"ConfigMap default/example1",
+			"ConfigMap default/example2",
+			"Secret default/example1",
+			"Secret default/example2",
+		}))
+		Expect(status.Status.LastUpdateTime).NotTo(BeNil())
+		Expect(status.Status.Error).To(BeEmpty())
+	})
+
+	Context("When a child is updated", func() {
+		var originalHash string
+		BeforeEach(func() {
+			originalHash = deployment.Spec.Template.GetAnnotations()[core.ConfigHashAnnotation]
+			m.Eventually(status, timeout).Should(WithTransform(statusHash, Equal(originalHash)))
+
+			m.Get(cm1, timeout).Should(Succeed())
+			cm1.Data["key1"] = "modified"
+			m.Update(cm1).Should(Succeed())
+			waitForDeploymentReconciled(deployment)
+		})
+
+		It("Updates the config hash in the WaveStatus", func() {
+			m.Eventually(deployment, timeout).Should(utils.WithPodTemplateAnnotations(Not(HaveKeyWithValue(core.ConfigHashAnnotation, originalHash))))
+			hash := deployment.Spec.Template.GetAnnotations()[core.ConfigHashAnnotation]
+			m.Eventually(status, timeout).Should(WithTransform(statusHash, Equal(hash)))
+		})
+	})
+
+	Context("When a child of a frozen Deployment is updated", func() {
+		var originalHash string
+		BeforeEach(func() {
+			originalHash = deployment.Spec.Template.GetAnnotations()[core.ConfigHashAnnotation]
+			m.Eventually(status, timeout).Should(WithTransform(statusHash, Equal(originalHash)))
+
+			m.Get(deployment, timeout).Should(Succeed())
+			annotations := deployment.GetAnnotations()
+			annotations[core.FreezeAnnotation] = "true"
+			deployment.SetAnnotations(annotations)
+			m.Update(deployment).Should(Succeed())
+			waitForDeploymentReconciled(deployment)
+
+			m.Get(cm1, timeout).Should(Succeed())
+			cm1.Data["key1"] = "modified"
+			m.Update(cm1).Should(Succeed())
+			waitForDeploymentReconciled(deployment)
+		})
+
+		It("Keeps the applied config hash in the WaveStatus", func() {
+			m.Consistently(status, time.Second).Should(WithTransform(statusHash, Equal(originalHash)))
+		})
+	})
+
+	Context("When a child is missing", func() {
+		var originalHash string
+		BeforeEach(func() {
+			originalHash = deployment.Spec.Template.GetAnnotations()[core.ConfigHashAnnotation]
+			m.Eventually(status, timeout).Should(WithTransform(statusHash, Equal(originalHash)))
+
+			annotations := deployment.GetAnnotations()
+			annotations[core.ExtraConfigMapsAnnotation] = "missing"
+			deployment.SetAnnotations(annotations)
+			m.Update(deployment).Should(Succeed())
+			waitForDeploymentReconciled(deployment)
+		})
+
+		It("Records the error in the WaveStatus", func() {
+			m.Eventually(status, timeout).Should(WithTransform(func(obj *wavev1alpha1.WaveStatus) string {
+				return obj.Status.Error
+			}, ContainSubstring("missing")))
+		})
+
+		It("Keeps the last config hash in the WaveStatus", func() {
+			m.Eventually(status, timeout).Should(WithTransform(func(obj *wavev1alpha1.WaveStatus) string {
+				return obj.Status.Error
+			}, Not(BeEmpty())))
+			Expect(status.Status.ConfigHash).To(Equal(originalHash))
+		})
+	})
+})
@@ -0,0 +1,227 @@
+/*
+Copyright 2018 Pusher Ltd.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package job
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/pusher/wave/pkg/core"
+	"github.com/pusher/wave/test/utils"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/manager"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+var _ = Describe("Job controller Suite", func() {
+	var c client.Client
+	var m utils.Matcher
+
+	var job *batchv1.Job
+	var requests <-chan reconcile.Request
+	var reconcileErrs chan error
+	var mgrStopped *sync.WaitGroup
+	var stopMgr chan struct{}
+
+	const timeout = time.Second * 5
+	const consistentlyTimeout = time.Second
+
+	var ownerRef metav1.OwnerReference
+	var cm1 *corev1.ConfigMap
+	var cm2 *corev1.ConfigMap
+	var s1 *corev1.Secret
+	var s2 *corev1.Secret
+
+	var waitForJobReconciled = func(obj core.Object) {
+		request := reconcile.Request{
+			NamespacedName: types.NamespacedName{
+				Name:      obj.GetName(),
+				Namespace: obj.GetNamespace(),
+			},
+		}
+		// wait for reconcile for creating the Job
+		Eventually(requests, timeout).Should(Receive(Equal(request)))
+	}
+
+	BeforeEach(func() {
+		mgr, err := manager.New(cfg, manager.Options{})
+		Expect(err).NotTo(HaveOccurred())
+		c = mgr.GetClient()
+		m = utils.Matcher{Client: c}
+
+		// Record any errors returned by the reconciler
+		reconcileErrs = make(chan error, 100)
+		inner := newReconciler(mgr, core.Options{RecordHashOnMetadataIfImmutable: true})
+		recordErrs := reconcile.Func(func(req reconcile.Request) (reconcile.Result, error) {
+			result, err := inner.Reconcile(req)
+			if err != nil {
+				select {
+				case reconcileErrs <- err:
+				default:
+				}
+			}
+			return result, err
+		})
+
+		var recFn reconcile.Reconciler
+		recFn, requests = SetupTestReconcile(recordErrs)
+		Expect(add(mgr, recFn, core.Options{})).NotTo(HaveOccurred())
+
+		stopMgr, mgrStopped = StartTestManager(mgr)
+
+		// Create some configmaps and secrets
+		cm1 = utils.ExampleConfigMap1.DeepCopy()
+		cm2 = utils.ExampleConfigMap2.DeepCopy()
+		s1 = utils.ExampleSecret1.DeepCopy()
+		s2 = utils.ExampleSecret2.DeepCopy()
+
+		m.Create(cm1).Should(Succeed())
+		m.Create(cm2).Should(Succeed())
+		m.Create(s1).Should(Succeed())
+		m.Create(s2).Should(Succeed())
+		m.Get(cm1, timeout).Should(Succeed())
+		m.Get(cm2, timeout).Should(Succeed())
+		m.Get(s1, timeout).Should(Succeed())
+		m.Get(s2, timeout).Should(Succeed())
+
+		job = utils.ExampleJob.DeepCopy()
+		job.SetAnnotations(map[string]string{core.RequiredAnnotation: "true"})
+
+		// Create a job and wait for it to be reconciled
+		m.Create(job).Should(Succeed())
+		waitForJobReconciled(job)
+
+		// Get the updated Job
+		m.Get(job, timeout).Should(Succeed())
+		ownerRef = utils.GetOwnerRef(job)
+	})
+
+	AfterEach(func() {
+		// Make sure to delete any finalizers (if the job exists)
+		Eventually(func() error {
+			key := types.NamespacedName{Namespace: job.GetNamespace(), Name: job.GetName()}
+			err := c.Get(context.TODO(), key, job)
+			if err != nil && errors.IsNotFound(err) {
+				return nil
+			}
+			if err != nil {
+				return err
+			}
+			job.SetFinalizers([]string{})
+			return c.Update(context.TODO(), job)
+		}, timeout).Should(Succeed())
+
+		Eventually(func() error {
+			key := types.NamespacedName{Namespace: job.GetNamespace(), Name: job.GetName()}
+			err := c.Get(context.TODO(), key, job)
+			if err != nil && errors.IsNotFound(err) {
+				return nil
+			}
+			if err != nil {
+				return err
+			}
+			if len(job.GetFinalizers()) > 0 {
+				return fmt.Errorf("Finalizers not upated")
+			}
+			return nil
+		}, timeout).Should(Succeed())
+
+		close(stopMgr)
+		mgrStopped.Wait()
+
+		utils.DeleteAll(cfg, timeout,
+			&batchv1.JobList{},
+			&corev1.ConfigMapList{},
+			&corev1.SecretList{},
+			&corev1.EventList{},
+		)
+	})
+
+	Context("When a Job with the required annotation is reconciled", func() {
+		It("Adds OwnerReferences to all children", func() {
+			for _, obj := range []core.Object{cm1, cm2, s1, s2} {
+				m.Eventually(obj, timeout).Should(utils.WithOwnerReferences(ContainElement(ownerRef)))
+			}
+		})
+
+		It("Adds a finalizer to the Job", func() {
+			m.Eventually(job, timeout).Should(utils.WithFinalizers(ContainElement(core.FinalizerString)))
+		})
+
+		It("Records the config hash on the Job's metadata", func() {
+			m.Eventually(job, timeout).Should(utils.WithAnnotations(HaveKey(core.ConfigHashAnnotation)))
+		})
+
+		It("Doesn't add a config hash to the Pod Template", func() {
+			m.Consistently(job, consistentlyTimeout).ShouldNot(utils.WithPodTemplateAnnotations(HaveKey(core.ConfigHashAnnotation)))
+		})
+
+		It("Sends a warning event explaining the Pod Template is immutable", func() {
+			events := &corev1.EventList{}
+			eventReason := func(event *corev1.Event) string {
+				return event.Reason
+			}
+			eventType := func(event *corev1.Event) string {
+				return event.Type
+			}
+
+			m.Eventually(events, timeout).Should(utils.WithItems(ContainElement(SatisfyAll(
+				WithTransform(eventReason, Equal("ImmutablePodTemplate")),
+				WithTransform(eventType, Equal(corev1.EventTypeWarning)),
+			))))
+		})
+
+		It("Doesn't return any reconcile errors", func() {
+			m.Eventually(job, timeout).Should(utils.WithAnnotations(HaveKey(core.ConfigHashAnnotation)))
+			Consistently(reconcileErrs, consistentlyTimeout).ShouldNot(Receive())
+		})
+
+		Context("And a child is updated", func() {
+			var originalHash string
+
+			BeforeEach(func() {
+				m.Eventually(job, timeout).Should(utils.WithAnnotations(HaveKey(core.ConfigHashAnnotation)))
+				originalHash = job.GetAnnotations()[core.ConfigHashAnnotation]
+
+				m.Get(cm1, timeout).Should(Succeed())
+				cm1.Data["key1"] = "modified"
+				m.Update(cm1).Should(Succeed())
+				waitForJobReconciled(job)
+
+				// Get the updated Job
+				m.Get(job, timeout).Should(Succeed())
+			})
+
+			It("Updates the config hash on the Job's metadata", func() {
+				m.Eventually(job, timeout).ShouldNot(utils.WithAnnotations(HaveKeyWithValue(core.ConfigHashAnnotation, originalHash)))
+			})
+
+			It("Doesn't return any reconcile errors", func() {
+				Consistently(reconcileErrs, consistentlyTimeout).ShouldNot(Receive())
+			})
+		})
+	})
+})
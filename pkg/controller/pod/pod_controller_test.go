@@ -0,0 +1,178 @@
+/*
+Copyright 2018 Pusher Ltd.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package pod
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/pusher/wave/pkg/core"
+	"github.com/pusher/wave/test/utils"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/manager"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+var _ = Describe("Pod controller Suite", func() {
+	var c client.Client
+	var m utils.Matcher
+
+	var pod *corev1.Pod
+	var requests <-chan reconcile.Request
+	var mgrStopped *sync.WaitGroup
+	var stopMgr chan struct{}
+
+	const timeout = time.Second * 5
+
+	var ownerRef metav1.OwnerReference
+	var cm1 *corev1.ConfigMap
+	var cm2 *corev1.ConfigMap
+	var s1 *corev1.Secret
+	var s2 *corev1.Secret
+
+	var waitForPodReconciled = func(obj core.Object) {
+		request := reconcile.Request{
+			NamespacedName: types.NamespacedName{
+				Name:      obj.GetName(),
+				Namespace: obj.GetNamespace(),
+			},
+		}
+		// wait for reconcile for creating the Pod
+		Eventually(requests, timeout).Should(Receive(Equal(request)))
+	}
+
+	BeforeEach(func() {
+		mgr, err := manager.New(cfg, manager.Options{})
+		Expect(err).NotTo(HaveOccurred())
+		c = mgr.GetClient()
+		m = utils.Matcher{Client: c}
+
+		var recFn reconcile.Reconciler
+		recFn, requests = SetupTestReconcile(newReconciler(mgr, core.Options{ManagePods: true}))
+		Expect(add(mgr, recFn, core.Options{})).NotTo(HaveOccurred())
+
+		stopMgr, mgrStopped = StartTestManager(mgr)
+
+		// Create some configmaps and secrets
+		cm1 = utils.ExampleConfigMap1.DeepCopy()
+		cm2 = utils.ExampleConfigMap2.DeepCopy()
+		s1 = utils.ExampleSecret1.DeepCopy()
+		s2 = utils.ExampleSecret2.DeepCopy()
+
+		m.Create(cm1).Should(Succeed())
+		m.Create(cm2).Should(Succeed())
+		m.Create(s1).Should(Succeed())
+		m.Create(s2).Should(Succeed())
+		m.Get(cm1, timeout).Should(Succeed())
+		m.Get(cm2, timeout).Should(Succeed())
+		m.Get(s1, timeout).Should(Succeed())
+		m.Get(s2, timeout).Should(Succeed())
+
+		// Create a pod with a generated name and wait for it to be reconciled
+		pod = utils.ExamplePod.DeepCopy()
+		pod.SetAnnotations(map[string]string{core.RequiredAnnotation: "true"})
+		m.Create(pod).Should(Succeed())
+		Expect(pod.GetName()).NotTo(BeEmpty())
+		waitForPodReconciled(pod)
+
+		ownerRef = utils.GetOwnerRef(pod)
+	})
+
+	AfterEach(func() {
+		// Make sure to delete any finalizers (if the pod exists)
+		Eventually(func() error {
+			key := types.NamespacedName{Namespace: pod.GetNamespace(), Name: pod.GetName()}
+			err := c.Get(context.TODO(), key, pod)
+			if err != nil && errors.IsNotFound(err) {
+				return nil
+			}
+			if err != nil {
+				return err
+			}
+			pod.SetFinalizers([]string{})
+			return c.Update(context.TODO(), pod)
+		}, timeout).Should(Succeed())
+
+		Eventually(func() error {
+			key := types.NamespacedName{Namespace: pod.GetNamespace(), Name: pod.GetName()}
+			err := c.Get(context.TODO(), key, pod)
+			if err != nil && errors.IsNotFound(err) {
+				return nil
+			}
+			if err != nil {
+				return err
+			}
+			if len(pod.GetFinalizers()) > 0 {
+				return fmt.Errorf("Finalizers not upated")
+			}
+			return nil
+		}, timeout).Should(Succeed())
+
+		close(stopMgr)
+		mgrStopped.Wait()
+
+		utils.DeleteAll(cfg, timeout,
+			&corev1.PodList{},
+			&corev1.ConfigMapList{},
+			&corev1.SecretList{},
+			&corev1.EventList{},
+		)
+	})
+
+	Context("When a Pod with a generated name is reconciled", func() {
+		It("Adds OwnerReferences with the Pod's UID to all children", func() {
+			Expect(ownerRef.UID).NotTo(BeEmpty())
+			for _, obj := range []core.Object{cm1, cm2, s1, s2} {
+				m.Eventually(obj, timeout).Should(utils.WithOwnerReferences(ContainElement(ownerRef)))
+			}
+		})
+
+		It("Adds a finalizer to the Pod", func() {
+			m.Eventually(pod, timeout).Should(utils.WithFinalizers(ContainElement(core.FinalizerString)))
+		})
+
+		It("Records the config hash on the Pod's metadata", func() {
+			m.Eventually(pod, timeout).Should(utils.WithAnnotations(HaveKey(core.ConfigHashAnnotation)))
+		})
+
+		Context("And a child is updated", func() {
+			var originalHash string
+
+			BeforeEach(func() {
+				m.Eventually(pod, timeout).Should(utils.WithAnnotations(HaveKey(core.ConfigHashAnnotation)))
+				originalHash = pod.GetAnnotations()[core.ConfigHashAnnotation]
+
+				m.Get(cm1, timeout).Should(Succeed())
+				cm1.Data["key1"] = "modified"
+				m.Update(cm1).Should(Succeed())
+				waitForPodReconciled(pod)
+			})
+
+			It("Updates the config hash on the Pod's metadata", func() {
+				m.Eventually(pod, timeout).ShouldNot(utils.WithAnnotations(HaveKeyWithValue(core.ConfigHashAnnotation, originalHash)))
+			})
+		})
+	})
+})
@@ -0,0 +1,411 @@
+/*
+Copyright 2018 Pusher Ltd.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package replicaset
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/pusher/wave/pkg/core"
+	"github.com/pusher/wave/test/utils"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/manager"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+var _ = Describe("ReplicaSet controller Suite", func() {
+	var c client.Client
+	var m utils.Matcher
+
+	var replicaset *appsv1.ReplicaSet
+	var requests <-chan reconcile.Request
+	var mgrStopped *sync.WaitGroup
+	var stopMgr chan struct{}
+
+	const timeout = time.Second * 5
+	const consistentlyTimeout = time.Second
+
+	var ownerRef metav1.OwnerReference
+	var cm1 *corev1.ConfigMap
+	var cm2 *corev1.ConfigMap
+	var s1 *corev1.Secret
+	var s2 *corev1.Secret
+
+	var waitForReplicaSetReconciled = func(obj core.Object) {
+		request := reconcile.Request{
+			NamespacedName: types.NamespacedName{
+				Name:      obj.GetName(),
+				Namespace: obj.GetNamespace(),
+			},
+		}
+		// wait for reconcile for creating the ReplicaSet
+		Eventually(requests, timeout).Should(Receive(Equal(request)))
+	}
+
+	BeforeEach(func() {
+		mgr, err := manager.New(cfg, manager.Options{})
+		Expect(err).NotTo(HaveOccurred())
+		c = mgr.GetClient()
+		m = utils.Matcher{Client: c}
+
+		var recFn reconcile.Reconciler
+		recFn, requests = SetupTestReconcile(newReconciler(mgr, core.Options{}))
+		Expect(add(mgr, recFn, core.Options{})).NotTo(HaveOccurred())
+
+		stopMgr, mgrStopped = StartTestManager(mgr)
+
+		// Create some configmaps and secrets
+		cm1 = utils.ExampleConfigMap1.DeepCopy()
+		cm2 = utils.ExampleConfigMap2.DeepCopy()
+		s1 = utils.ExampleSecret1.DeepCopy()
+		s2 = utils.ExampleSecret2.DeepCopy()
+
+		m.Create(cm1).Should(Succeed())
+		m.Create(cm2).Should(Succeed())
+		m.Create(s1).Should(Succeed())
+		m.Create(s2).Should(Succeed())
+		m.Get(cm1, timeout).Should(Succeed())
+		m.Get(cm2, timeout).Should(Succeed())
+		m.Get(s1, timeout).Should(Succeed())
+		m.Get(s2, timeout).Should(Succeed())
+
+		replicaset = utils.ExampleReplicaSet.DeepCopy()
+
+		// Create a replicaset and wait for it to be reconciled
+		m.Create(replicaset).Should(Succeed())
+		waitForReplicaSetReconciled(replicaset)
+
+		ownerRef = utils.GetOwnerRef(replicaset)
+	})
+
+	AfterEach(func() {
+		// Make sure to delete any finalizers (if the replicaset exists)
+		Eventually(func() error {
+			key := types.NamespacedName{Namespace: replicaset.GetNamespace(), Name: replicaset.GetName()}
+			err := c.Get(context.TODO(), key, replicaset)
+			if err != nil && errors.IsNotFound(err) {
+				return nil
+			}
+			if err != nil {
+				return err
+			}
+			replicaset.SetFinalizers([]string{})
+			return c.Update(context.TODO(), replicaset)
+		}, timeout).Should(Succeed())
+
+		Eventually(func() error {
+			key := types.NamespacedName{Namespace: replicaset.GetNamespace(), Name: replicaset.GetName()}
+			err := c.Get(context.TODO(), key, replicaset)
+			if err != nil && errors.IsNotFound(err) {
+				return nil
+			}
+			if err != nil {
+				return err
+			}
+			if len(replicaset.GetFinalizers()) > 0 {
+				return fmt.Errorf("Finalizers not upated")
+			}
+			return nil
+		}, timeout).Should(Succeed())
+
+		close(stopMgr)
+		mgrStopped.Wait()
+
+		utils.DeleteAll(cfg, timeout,
+			&appsv1.ReplicaSetList{},
+			&appsv1.DeploymentList{},
+			&corev1.ConfigMapList{},
+			&corev1.SecretList{},
+			&corev1.EventList{},
+		)
+	})
+
+	Context("When a ReplicaSet is reconciled", func() {
+		Context("And it has the required annotation", func() {
+			BeforeEach(func() {
+				annotations := replicaset.GetAnnotations()
+				if annotations == nil {
+					annotations = make(map[string]string)
+				}
+				annotations[core.RequiredAnnotation] = "true"
+				replicaset.SetAnnotations(annotations)
+
+				m.Update(replicaset).Should(Succeed())
+				waitForReplicaSetReconciled(replicaset)
+
+				// Get the updated ReplicaSet
+				m.Get(replicaset, timeout).Should(Succeed())
+			})
+
+			It("Adds OwnerReferences to all children", func() {
+				for _, obj := range []core.Object{cm1, cm2, s1, s2} {
+					m.Eventually(obj, timeout).Should(utils.WithOwnerReferences(ContainElement(ownerRef)))
+				}
+			})
+
+			It("Adds a finalizer to the ReplicaSet", func() {
+				m.Eventually(replicaset, timeout).Should(utils.WithFinalizers(ContainElement(core.FinalizerString)))
+			})
+
+			It("Adds a config hash to the Pod Template", func() {
+				m.Eventually(replicaset, timeout).Should(utils.WithPodTemplateAnnotations(HaveKey(core.ConfigHashAnnotation)))
+			})
+
+			It("Sends an event when updating the hash", func() {
+				m.Eventually(replicaset, timeout).Should(utils.WithPodTemplateAnnotations(HaveKey(core.ConfigHashAnnotation)))
+
+				events := &corev1.EventList{}
+				eventMessage := func(event *corev1.Event) string {
+					return event.Message
+				}
+
+				hashMessage := "Configuration hash updated to fa2bd7afa9869023533623e10bad323fb53b713ff48521233a69aede24619525"
+				m.Eventually(events, timeout).Should(utils.WithItems(ContainElement(WithTransform(eventMessage, Equal(hashMessage)))))
+			})
+
+			Context("And a child is removed", func() {
+				var originalHash string
+				BeforeEach(func() {
+					m.Eventually(replicaset, timeout).Should(utils.WithPodTemplateAnnotations(HaveKey(core.ConfigHashAnnotation)))
+					originalHash = replicaset.Spec.Template.GetAnnotations()[core.ConfigHashAnnotation]
+
+					// Remove "container2" which references Secret example2 and ConfigMap
+					// example2
+					containers := replicaset.Spec.Template.Spec.Containers
+					Expect(containers[0].Name).To(Equal("container1"))
+					replicaset.Spec.Template.Spec.Containers = []corev1.Container{containers[0]}
+					m.Update(replicaset).Should(Succeed())
+					waitForReplicaSetReconciled(replicaset)
+
+					// Get the updated ReplicaSet
+					m.Get(replicaset, timeout).Should(Succeed())
+				})
+
+				It("Removes the OwnerReference from the orphaned ConfigMap", func() {
+					m.Eventually(cm2, timeout).ShouldNot(utils.WithOwnerReferences(ContainElement(ownerRef)))
+				})
+
+				It("Removes the OwnerReference from the orphaned Secret", func() {
+					m.Eventually(s2, timeout).ShouldNot(utils.WithOwnerReferences(ContainElement(ownerRef)))
+				})
+
+				It("Updates the config hash in the Pod Template", func() {
+					m.Eventually(replicaset, timeout).ShouldNot(utils.WithAnnotations(HaveKeyWithValue(core.ConfigHashAnnotation, originalHash)))
+				})
+			})
+
+			Context("And a child is updated", func() {
+				var originalHash string
+
+				BeforeEach(func() {
+					m.Eventually(replicaset, timeout).Should(utils.WithPodTemplateAnnotations(HaveKey(core.ConfigHashAnnotation)))
+					originalHash = replicaset.Spec.Template.GetAnnotations()[core.ConfigHashAnnotation]
+				})
+
+				Context("A ConfigMap volume is updated", func() {
+					BeforeEach(func() {
+						m.Get(cm1, timeout).Should(Succeed())
+						cm1.Data["key1"] = "modified"
+						m.Update(cm1).Should(Succeed())
+
+						waitForReplicaSetReconciled(replicaset)
+
+						// Get the updated ReplicaSet
+						m.Get(replicaset, timeout).Should(Succeed())
+					})
+
+					It("Updates the config hash in the Pod Template", func() {
+						m.Eventually(replicaset, timeout).ShouldNot(utils.WithAnnotations(HaveKeyWithValue(core.ConfigHashAnnotation, originalHash)))
+					})
+				})
+
+				Context("A ConfigMap EnvSource is updated", func() {
+					BeforeEach(func() {
+						m.Get(cm2, timeout).Should(Succeed())
+						cm2.Data["key1"] = "modified"
+						m.Update(cm2).Should(Succeed())
+
+						waitForReplicaSetReconciled(replicaset)
+
+						// Get the updated ReplicaSet
+						m.Get(replicaset, timeout).Should(Succeed())
+					})
+
+					It("Updates the config hash in the Pod Template", func() {
+						m.Eventually(replicaset, timeout).ShouldNot(utils.WithAnnotations(HaveKeyWithValue(core.ConfigHashAnnotation, originalHash)))
+					})
+				})
+
+				Context("A Secret volume is updated", func() {
+					BeforeEach(func() {
+						m.Get(s1, timeout).Should(Succeed())
+						if s1.StringData == nil {
+							s1.StringData = make(map[string]string)
+						}
+						s1.StringData["key1"] = "modified"
+						m.Update(s1).Should(Succeed())
+
+						waitForReplicaSetReconciled(replicaset)
+
+						// Get the updated ReplicaSet
+						m.Get(replicaset, timeout).Should(Succeed())
+					})
+
+					It("Updates the config hash in the Pod Template", func() {
+						m.Eventually(replicaset, timeout).ShouldNot(utils.WithAnnotations(HaveKeyWithValue(core.ConfigHashAnnotation, originalHash)))
+					})
+				})
+
+				Context("A Secret EnvSource is updated", func() {
+					BeforeEach(func() {
+						m.Get(s2, timeout).Should(Succeed())
+						if s2.StringData == nil {
+							s2.StringData = make(map[string]string)
+						}
+						s2.StringData["key1"] = "modified"
+						m.Update(s2).Should(Succeed())
+
+						waitForReplicaSetReconciled(replicaset)
+
+						// Get the updated ReplicaSet
+						m.Get(replicaset, timeout).Should(Succeed())
+					})
+
+					It("Updates the config hash in the Pod Template", func() {
+						m.Eventually(replicaset, timeout).ShouldNot(utils.WithAnnotations(HaveKeyWithValue(core.ConfigHashAnnotation, originalHash)))
+					})
+				})
+			})
+
+			Context("And the annotation is removed", func() {
+				BeforeEach(func() {
+					m.Get(replicaset, timeout).Should(Succeed())
+					replicaset.SetAnnotations(make(map[string]string))
+					m.Update(replicaset).Should(Succeed())
+					waitForReplicaSetReconciled(replicaset)
+
+					m.Eventually(replicaset, timeout).ShouldNot(utils.WithAnnotations(HaveKey(core.RequiredAnnotation)))
+				})
+
+				It("Removes the OwnerReference from the all children", func() {
+					for _, obj := range []core.Object{cm1, cm2, s1, s2} {
+						m.Eventually(obj, timeout).ShouldNot(utils.WithOwnerReferences(ContainElement(ownerRef)))
+					}
+				})
+
+				It("Removes the ReplicaSet's finalizer", func() {
+					m.Eventually(replicaset, timeout).ShouldNot(utils.WithFinalizers(ContainElement(core.FinalizerString)))
+				})
+			})
+
+			Context("And is deleted", func() {
+				BeforeEach(func() {
+					// Make sure the cache has synced before we run the test
+					m.Eventually(replicaset, timeout).Should(utils.WithPodTemplateAnnotations(HaveKey(core.ConfigHashAnnotation)))
+					m.Delete(replicaset).Should(Succeed())
+					m.Eventually(replicaset, timeout).ShouldNot(utils.WithDeletionTimestamp(BeNil()))
+					waitForReplicaSetReconciled(replicaset)
+
+					// Get the updated ReplicaSet
+					m.Get(replicaset, timeout).Should(Succeed())
+				})
+				It("Removes the OwnerReference from the all children", func() {
+					for _, obj := range []core.Object{cm1, cm2, s1, s2} {
+						m.Eventually(obj, timeout).ShouldNot(utils.WithOwnerReferences(ContainElement(ownerRef)))
+					}
+				})
+
+				It("Removes the ReplicaSet's finalizer", func() {
+					// Removing the finalizer causes the replicaset to be deleted
+					m.Get(replicaset, timeout).ShouldNot(Succeed())
+				})
+			})
+		})
+
+		Context("And it does not have the required annotation", func() {
+			BeforeEach(func() {
+				// Get the updated ReplicaSet
+				m.Get(replicaset, timeout).Should(Succeed())
+			})
+
+			It("Doesn't add any OwnerReferences to any children", func() {
+				for _, obj := range []core.Object{cm1, cm2, s1, s2} {
+					m.Consistently(obj, consistentlyTimeout).ShouldNot(utils.WithOwnerReferences(ContainElement(ownerRef)))
+				}
+			})
+
+			It("Doesn't add a finalizer to the ReplicaSet", func() {
+				m.Consistently(replicaset, consistentlyTimeout).ShouldNot(utils.WithFinalizers(ContainElement(core.FinalizerString)))
+			})
+
+			It("Doesn't add a config hash to the Pod Template", func() {
+				m.Consistently(replicaset, consistentlyTimeout).ShouldNot(utils.WithAnnotations(ContainElement(core.ConfigHashAnnotation)))
+			})
+		})
+	})
+
+	Context("When a ReplicaSet owned by a Deployment is reconciled", func() {
+		var deployment *appsv1.Deployment
+
+		BeforeEach(func() {
+			deployment = utils.ExampleDeployment.DeepCopy()
+			deployment.SetAnnotations(map[string]string{core.RequiredAnnotation: "true"})
+			m.Create(deployment).Should(Succeed())
+			m.Get(deployment, timeout).Should(Succeed())
+
+			// ReplicaSets inherit the annotations of their Deployment
+			isController := true
+			m.Get(replicaset, timeout).Should(Succeed())
+			replicaset.SetAnnotations(map[string]string{core.RequiredAnnotation: "true"})
+			replicaset.SetOwnerReferences([]metav1.OwnerReference{{
+				APIVersion: "apps/v1",
+				Kind:       "Deployment",
+				Name:       deployment.GetName(),
+				UID:        deployment.GetUID(),
+				Controller: &isController,
+			}})
+			m.Update(replicaset).Should(Succeed())
+			waitForReplicaSetReconciled(replicaset)
+
+			// Get the updated ReplicaSet
+			m.Get(replicaset, timeout).Should(Succeed())
+		})
+
+		It("Doesn't add any OwnerReferences to any children", func() {
+			for _, obj := range []core.Object{cm1, cm2, s1, s2} {
+				m.Consistently(obj, consistentlyTimeout).ShouldNot(utils.WithOwnerReferences(ContainElement(ownerRef)))
+			}
+		})
+
+		It("Doesn't add a finalizer to the ReplicaSet", func() {
+			m.Consistently(replicaset, consistentlyTimeout).ShouldNot(utils.WithFinalizers(ContainElement(core.FinalizerString)))
+		})
+
+		It("Doesn't add a config hash to the Pod Template", func() {
+			m.Consistently(replicaset, consistentlyTimeout).ShouldNot(utils.WithPodTemplateAnnotations(HaveKey(core.ConfigHashAnnotation)))
+		})
+	})
+})
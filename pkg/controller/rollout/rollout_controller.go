@@ -0,0 +1,169 @@
+/*
+Copyright 2018 Pusher Ltd.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package rollout
+
+import (
+	"context"
+
+	argov1alpha1 "github.com/pusher/wave/pkg/apis/argoproj/v1alpha1"
+	"github.com/pusher/wave/pkg/controller/children"
+	"github.com/pusher/wave/pkg/core"
+	"github.com/pusher/wave/pkg/metrics"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/controller"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/manager"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+	logf "sigs.k8s.io/controller-runtime/pkg/runtime/log"
+	"sigs.k8s.io/controller-runtime/pkg/source"
+)
+
+// Add creates a new Rollout Controller and adds it to the Manager with default RBAC. The Manager will set fields on the Controller
+// and Start it when the Manager is Started.
+// The controller is only added if ManageRollouts is enabled and the Rollout
+// CRD is installed.
+func Add(mgr manager.Manager, opts core.Options) error {
+	if !opts.ManageRollouts {
+		return nil
+	}
+
+	served, err := rolloutsServed(mgr.GetRESTMapper())
+	if err != nil {
+		return err
+	}
+	if !served {
+		logf.Log.WithName("wave").Info("Rollout CRD is not installed, not managing Argo Rollouts")
+		return nil
+	}
+
+	// Use the annotation keys configured for Rollouts
+	opts = opts.ForKind("Rollout")
+	return add(mgr, newReconciler(mgr, opts), opts)
+}
+
+// rolloutsServed checks whether the API server serves Rollouts, as it only
+// does once the Rollout CRD is installed
+func rolloutsServed(mapper meta.RESTMapper) (bool, error) {
+	gvk := argov1alpha1.SchemeGroupVersion.WithKind("Rollout")
+	_, err := mapper.RESTMapping(gvk.GroupKind(), gvk.Version)
+	if meta.IsNoMatchError(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// newReconciler returns a new reconcile.Reconciler
+func newReconciler(mgr manager.Manager, opts core.Options) reconcile.Reconciler {
+	// Record children in the ChildIndex shared by all workload controllers
+	opts.ChildIndex = children.Index(mgr)
+	return &ReconcileRollout{
+		scheme:  mgr.GetScheme(),
+		handler: core.NewHandler(mgr.GetClient(), mgr.GetRecorder("wave"), opts),
+	}
+}
+
+// add adds a new Controller to mgr with r as the reconcile.Reconciler
+func add(mgr manager.Manager, r reconcile.Reconciler, opts core.Options) error {
+	// Create a new controller
+	c, err := controller.New("rollout-controller", mgr, controller.Options{Reconciler: r, MaxConcurrentReconciles: opts.MaxConcurrentReconciles})
+	if err != nil {
+		return err
+	}
+
+	// Watch for changes to Rollout
+	err = c.Watch(&source.Kind{Type: &argov1alpha1.Rollout{}}, metrics.EnqueueWithReason("Rollout", metrics.ReasonWorkloadChange, &handler.EnqueueRequestForObject{}), core.WorkloadUpdatePredicate(opts))
+	if err != nil {
+		return err
+	}
+
+	// Watch the children referenced by a Rollout using the watch on
+	// children shared by all workload controllers, mapping each child to the
+	// Rollouts the ChildIndex records as referencing it
+	childSource, err := children.Source(mgr, opts.ExtraChildKinds...)
+	if err != nil {
+		return err
+	}
+	err = c.Watch(childSource, children.PrioritizeSecrets(opts, metrics.EnqueueWithReason("Rollout", metrics.ReasonChildChange, children.EnqueueRequestsForWorkloads(mgr, &argov1alpha1.Rollout{}))))
+	if err != nil {
+		return err
+	}
+
+	// Watch the ServiceAccounts of Rollouts, whose image pull Secrets are
+	// children with the service-account ImagePullSecretsPolicy, mapping each
+	// ServiceAccount to the Rollouts the ChildIndex records as running as it
+	if opts.ImagePullSecretsPolicy == core.ImagePullSecretsServiceAccount {
+		err = c.Watch(&source.Kind{Type: &corev1.ServiceAccount{}}, metrics.EnqueueWithReason("Rollout", metrics.ReasonChildChange, children.EnqueueRequestsForWorkloads(mgr, &argov1alpha1.Rollout{})), core.ServiceAccountUpdatePredicate())
+		if err != nil {
+			return err
+		}
+	}
+
+	// Watch Namespaces, whose RequiredAnnotation chooses whether Wave manages
+	// the Rollouts within them that don't have it, if namespace defaults are
+	// enabled
+	if opts.NamespaceDefaults {
+		err = c.Watch(&source.Kind{Type: &corev1.Namespace{}}, metrics.EnqueueWithReason("Rollout", metrics.ReasonNamespaceChange, children.EnqueueRequestsForNamespace(mgr, &argov1alpha1.RolloutList{})), core.NamespaceUpdatePredicate(opts))
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+var _ reconcile.Reconciler = &ReconcileRollout{}
+
+// ReconcileRollout reconciles an Argo Rollout object
+type ReconcileRollout struct {
+	scheme  *runtime.Scheme
+	handler *core.Handler
+}
+
+// Reconcile reads that state of the cluster for a Rollout object and
+// updates its PodTemplate based on the state of its mounted configuration
+// +kubebuilder:rbac:groups=argoproj.io,resources=rollouts,verbs=get;list;watch;update;patch
+// +kubebuilder:rbac:groups=,resources=configmaps,verbs=get;list;watch;update;patch
+// +kubebuilder:rbac:groups=,resources=secrets,verbs=get;list;watch;update;patch
+// +kubebuilder:rbac:groups=,resources=events,verbs=create;update;patch
+// +kubebuilder:rbac:groups=,resources=namespaces,verbs=get;list;watch
+// +kubebuilder:rbac:groups=,resources=serviceaccounts,verbs=get;list;watch
+// +kubebuilder:rbac:groups=wave.pusher.com,resources=wavestatuses,verbs=get;list;watch;create;update;patch
+func (r *ReconcileRollout) Reconcile(request reconcile.Request) (reconcile.Result, error) {
+	// Record what triggered the reconcile
+	metrics.RecordReconcile("Rollout", request)
+
+	// Fetch the Rollout instance
+	instance := &argov1alpha1.Rollout{}
+	err := r.handler.Get(context.TODO(), request.NamespacedName, instance)
+	if err != nil {
+		if errors.IsNotFound(err) {
+			// Object not found, return.  Created objects are automatically garbage collected.
+			r.handler.HandleNotFound("Rollout", request.NamespacedName)
+			return reconcile.Result{}, nil
+		}
+		// Error reading the object - requeue the request.
+		return reconcile.Result{}, err
+	}
+
+	return r.handler.HandleRollout(instance)
+}
@@ -0,0 +1,200 @@
+/*
+Copyright 2018 Pusher Ltd.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package rollout
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	argov1alpha1 "github.com/pusher/wave/pkg/apis/argoproj/v1alpha1"
+	"github.com/pusher/wave/pkg/core"
+	"github.com/pusher/wave/test/utils"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/manager"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+var _ = Describe("Rollout controller Suite", func() {
+	var c client.Client
+	var m utils.Matcher
+
+	var rollout *argov1alpha1.Rollout
+	var requests <-chan reconcile.Request
+	var mgrStopped *sync.WaitGroup
+	var stopMgr chan struct{}
+
+	const timeout = time.Second * 5
+
+	var ownerRef metav1.OwnerReference
+	var cm1 *corev1.ConfigMap
+	var cm2 *corev1.ConfigMap
+	var s1 *corev1.Secret
+	var s2 *corev1.Secret
+
+	var waitForRolloutReconciled = func(obj core.Object) {
+		request := reconcile.Request{
+			NamespacedName: types.NamespacedName{
+				Name:      obj.GetName(),
+				Namespace: obj.GetNamespace(),
+			},
+		}
+		// wait for reconcile for creating the Rollout
+		Eventually(requests, timeout).Should(Receive(Equal(request)))
+	}
+
+	BeforeEach(func() {
+		mgr, err := manager.New(cfg, manager.Options{})
+		Expect(err).NotTo(HaveOccurred())
+		c = mgr.GetClient()
+		m = utils.Matcher{Client: c}
+
+		var recFn reconcile.Reconciler
+		recFn, requests = SetupTestReconcile(newReconciler(mgr, core.Options{ManageRollouts: true}))
+		Expect(add(mgr, recFn, core.Options{})).NotTo(HaveOccurred())
+
+		stopMgr, mgrStopped = StartTestManager(mgr)
+
+		// Create some configmaps and secrets
+		cm1 = utils.ExampleConfigMap1.DeepCopy()
+		cm2 = utils.ExampleConfigMap2.DeepCopy()
+		s1 = utils.ExampleSecret1.DeepCopy()
+		s2 = utils.ExampleSecret2.DeepCopy()
+
+		m.Create(cm1).Should(Succeed())
+		m.Create(cm2).Should(Succeed())
+		m.Create(s1).Should(Succeed())
+		m.Create(s2).Should(Succeed())
+		m.Get(cm1, timeout).Should(Succeed())
+		m.Get(cm2, timeout).Should(Succeed())
+		m.Get(s1, timeout).Should(Succeed())
+		m.Get(s2, timeout).Should(Succeed())
+
+		// Create a rollout and wait for it to be reconciled
+		rollout = utils.ExampleRollout.DeepCopy()
+		rollout.SetAnnotations(map[string]string{core.RequiredAnnotation: "true"})
+		m.Create(rollout).Should(Succeed())
+		waitForRolloutReconciled(rollout)
+
+		ownerRef = utils.GetOwnerRef(rollout)
+	})
+
+	AfterEach(func() {
+		// Make sure to delete any finalizers (if the rollout exists)
+		Eventually(func() error {
+			key := types.NamespacedName{Namespace: rollout.GetNamespace(), Name: rollout.GetName()}
+			err := c.Get(context.TODO(), key, rollout)
+			if err != nil && errors.IsNotFound(err) {
+				return nil
+			}
+			if err != nil {
+				return err
+			}
+			rollout.SetFinalizers([]string{})
+			return c.Update(context.TODO(), rollout)
+		}, timeout).Should(Succeed())
+
+		Eventually(func() error {
+			key := types.NamespacedName{Namespace: rollout.GetNamespace(), Name: rollout.GetName()}
+			err := c.Get(context.TODO(), key, rollout)
+			if err != nil && errors.IsNotFound(err) {
+				return nil
+			}
+			if err != nil {
+				return err
+			}
+			if len(rollout.GetFinalizers()) > 0 {
+				return fmt.Errorf("Finalizers not upated")
+			}
+			return nil
+		}, timeout).Should(Succeed())
+
+		close(stopMgr)
+		mgrStopped.Wait()
+
+		utils.DeleteAll(cfg, timeout,
+			&argov1alpha1.RolloutList{},
+			&corev1.ConfigMapList{},
+			&corev1.SecretList{},
+			&corev1.EventList{},
+		)
+	})
+
+	Context("When a Rollout is reconciled", func() {
+		It("Adds OwnerReferences to all children", func() {
+			for _, obj := range []core.Object{cm1, cm2, s1, s2} {
+				m.Eventually(obj, timeout).Should(utils.WithOwnerReferences(ContainElement(ownerRef)))
+			}
+		})
+
+		It("Adds a finalizer to the Rollout", func() {
+			m.Eventually(rollout, timeout).Should(utils.WithFinalizers(ContainElement(core.FinalizerString)))
+		})
+
+		It("Adds a config hash to the Rollout's PodTemplate", func() {
+			m.Eventually(rollout, timeout).Should(utils.WithPodTemplateAnnotations(HaveKey(core.ConfigHashAnnotation)))
+		})
+
+		It("Preserves the fields of the Rollout Wave doesn't manage", func() {
+			m.Eventually(rollout, timeout).Should(utils.WithPodTemplateAnnotations(HaveKey(core.ConfigHashAnnotation)))
+			Expect(rollout.Spec.Fields).To(HaveKey("strategy"))
+
+			var strategy map[string]interface{}
+			Expect(json.Unmarshal(rollout.Spec.Fields["strategy"], &strategy)).To(Succeed())
+			Expect(strategy).To(HaveKey("canary"))
+		})
+
+		Context("And a child is updated", func() {
+			var originalHash string
+
+			BeforeEach(func() {
+				m.Eventually(rollout, timeout).Should(utils.WithPodTemplateAnnotations(HaveKey(core.ConfigHashAnnotation)))
+				originalHash = rollout.Spec.Template.GetAnnotations()[core.ConfigHashAnnotation]
+
+				m.Get(cm1, timeout).Should(Succeed())
+				cm1.Data["key1"] = "modified"
+				m.Update(cm1).Should(Succeed())
+				waitForRolloutReconciled(rollout)
+			})
+
+			It("Updates the config hash in the PodTemplate", func() {
+				m.Eventually(rollout, timeout).ShouldNot(utils.WithPodTemplateAnnotations(HaveKeyWithValue(core.ConfigHashAnnotation, originalHash)))
+			})
+		})
+	})
+
+	Context("rolloutsServed", func() {
+		It("returns true when the Rollout kind is mapped", func() {
+			mapper := meta.NewDefaultRESTMapper(nil)
+			mapper.Add(argov1alpha1.SchemeGroupVersion.WithKind("Rollout"), meta.RESTScopeNamespace)
+			Expect(rolloutsServed(mapper)).To(BeTrue())
+		})
+
+		It("returns false when the Rollout CRD isn't installed", func() {
+			Expect(rolloutsServed(meta.NewDefaultRESTMapper(nil))).To(BeFalse())
+		})
+	})
+})
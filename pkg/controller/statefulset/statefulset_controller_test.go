@@ -0,0 +1,408 @@
+/*
+Copyright 2018 Pusher Ltd.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package statefulset
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/pusher/wave/pkg/core"
+	"github.com/pusher/wave/test/utils"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/manager"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+var _ = Describe("StatefulSet controller Suite", func() {
+	var c client.Client
+	var m utils.Matcher
+
+	var statefulset *appsv1.StatefulSet
+	var requests <-chan reconcile.Request
+	var mgrStopped *sync.WaitGroup
+	var stopMgr chan struct{}
+
+	const timeout = time.Second * 5
+	const consistentlyTimeout = time.Second
+
+	var ownerRef metav1.OwnerReference
+	var cm1 *corev1.ConfigMap
+	var cm2 *corev1.ConfigMap
+	var s1 *corev1.Secret
+	var s2 *corev1.Secret
+
+	var waitForStatefulSetReconciled = func(obj core.Object) {
+		request := reconcile.Request{
+			NamespacedName: types.NamespacedName{
+				Name:      obj.GetName(),
+				Namespace: obj.GetNamespace(),
+			},
+		}
+		// wait for reconcile for creating the StatefulSet
+		Eventually(requests, timeout).Should(Receive(Equal(request)))
+	}
+
+	BeforeEach(func() {
+		mgr, err := manager.New(cfg, manager.Options{})
+		Expect(err).NotTo(HaveOccurred())
+		c = mgr.GetClient()
+		m = utils.Matcher{Client: c}
+
+		var recFn reconcile.Reconciler
+		recFn, requests = SetupTestReconcile(newReconciler(mgr, core.Options{}))
+		Expect(add(mgr, recFn, core.Options{})).NotTo(HaveOccurred())
+
+		stopMgr, mgrStopped = StartTestManager(mgr)
+
+		// Create some configmaps and secrets
+		cm1 = utils.ExampleConfigMap1.DeepCopy()
+		cm2 = utils.ExampleConfigMap2.DeepCopy()
+		s1 = utils.ExampleSecret1.DeepCopy()
+		s2 = utils.ExampleSecret2.DeepCopy()
+
+		m.Create(cm1).Should(Succeed())
+		m.Create(cm2).Should(Succeed())
+		m.Create(s1).Should(Succeed())
+		m.Create(s2).Should(Succeed())
+		m.Get(cm1, timeout).Should(Succeed())
+		m.Get(cm2, timeout).Should(Succeed())
+		m.Get(s1, timeout).Should(Succeed())
+		m.Get(s2, timeout).Should(Succeed())
+
+		statefulset = utils.ExampleStatefulSet.DeepCopy()
+
+		// Create a statefulset and wait for it to be reconciled
+		m.Create(statefulset).Should(Succeed())
+		waitForStatefulSetReconciled(statefulset)
+
+		ownerRef = utils.GetOwnerRef(statefulset)
+	})
+
+	AfterEach(func() {
+		// Make sure to delete any finalizers (if the statefulset exists)
+		Eventually(func() error {
+			key := types.NamespacedName{Namespace: statefulset.GetNamespace(), Name: statefulset.GetName()}
+			err := c.Get(context.TODO(), key, statefulset)
+			if err != nil && errors.IsNotFound(err) {
+				return nil
+			}
+			if err != nil {
+				return err
+			}
+			statefulset.SetFinalizers([]string{})
+			return c.Update(context.TODO(), statefulset)
+		}, timeout).Should(Succeed())
+
+		Eventually(func() error {
+			key := types.NamespacedName{Namespace: statefulset.GetNamespace(), Name: statefulset.GetName()}
+			err := c.Get(context.TODO(), key, statefulset)
+			if err != nil && errors.IsNotFound(err) {
+				return nil
+			}
+			if err != nil {
+				return err
+			}
+			if len(statefulset.GetFinalizers()) > 0 {
+				return fmt.Errorf("Finalizers not upated")
+			}
+			return nil
+		}, timeout).Should(Succeed())
+
+		close(stopMgr)
+		mgrStopped.Wait()
+
+		utils.DeleteAll(cfg, timeout,
+			&appsv1.StatefulSetList{},
+			&corev1.ConfigMapList{},
+			&corev1.SecretList{},
+			&corev1.EventList{},
+		)
+	})
+
+	Context("When a StatefulSet is reconciled", func() {
+		Context("And it has the required annotation", func() {
+			BeforeEach(func() {
+				annotations := statefulset.GetAnnotations()
+				if annotations == nil {
+					annotations = make(map[string]string)
+				}
+				annotations[core.RequiredAnnotation] = "true"
+				statefulset.SetAnnotations(annotations)
+
+				m.Update(statefulset).Should(Succeed())
+				waitForStatefulSetReconciled(statefulset)
+
+				// Get the updated StatefulSet
+				m.Get(statefulset, timeout).Should(Succeed())
+			})
+
+			It("Adds OwnerReferences to all children", func() {
+				for _, obj := range []core.Object{cm1, cm2, s1, s2} {
+					m.Eventually(obj, timeout).Should(utils.WithOwnerReferences(ContainElement(ownerRef)))
+				}
+			})
+
+			It("Adds a finalizer to the StatefulSet", func() {
+				m.Eventually(statefulset, timeout).Should(utils.WithFinalizers(ContainElement(core.FinalizerString)))
+			})
+
+			It("Adds a config hash to the Pod Template", func() {
+				m.Eventually(statefulset, timeout).Should(utils.WithPodTemplateAnnotations(HaveKey(core.ConfigHashAnnotation)))
+			})
+
+			It("Sends an event when updating the hash", func() {
+				m.Eventually(statefulset, timeout).Should(utils.WithPodTemplateAnnotations(HaveKey(core.ConfigHashAnnotation)))
+
+				events := &corev1.EventList{}
+				eventMessage := func(event *corev1.Event) string {
+					return event.Message
+				}
+
+				hashMessage := "Configuration hash updated to fa2bd7afa9869023533623e10bad323fb53b713ff48521233a69aede24619525"
+				m.Eventually(events, timeout).Should(utils.WithItems(ContainElement(WithTransform(eventMessage, Equal(hashMessage)))))
+			})
+
+			Context("And a child is removed", func() {
+				var originalHash string
+				BeforeEach(func() {
+					m.Eventually(statefulset, timeout).Should(utils.WithPodTemplateAnnotations(HaveKey(core.ConfigHashAnnotation)))
+					originalHash = statefulset.Spec.Template.GetAnnotations()[core.ConfigHashAnnotation]
+
+					// Remove "container2" which references Secret example2 and ConfigMap
+					// example2
+					containers := statefulset.Spec.Template.Spec.Containers
+					Expect(containers[0].Name).To(Equal("container1"))
+					statefulset.Spec.Template.Spec.Containers = []corev1.Container{containers[0]}
+					m.Update(statefulset).Should(Succeed())
+					waitForStatefulSetReconciled(statefulset)
+
+					// Get the updated StatefulSet
+					m.Get(statefulset, timeout).Should(Succeed())
+				})
+
+				It("Removes the OwnerReference from the orphaned ConfigMap", func() {
+					m.Eventually(cm2, timeout).ShouldNot(utils.WithOwnerReferences(ContainElement(ownerRef)))
+				})
+
+				It("Removes the OwnerReference from the orphaned Secret", func() {
+					m.Eventually(s2, timeout).ShouldNot(utils.WithOwnerReferences(ContainElement(ownerRef)))
+				})
+
+				It("Updates the config hash in the Pod Template", func() {
+					m.Eventually(statefulset, timeout).ShouldNot(utils.WithAnnotations(HaveKeyWithValue(core.ConfigHashAnnotation, originalHash)))
+				})
+			})
+
+			Context("And a child is updated", func() {
+				var originalHash string
+
+				BeforeEach(func() {
+					m.Eventually(statefulset, timeout).Should(utils.WithPodTemplateAnnotations(HaveKey(core.ConfigHashAnnotation)))
+					originalHash = statefulset.Spec.Template.GetAnnotations()[core.ConfigHashAnnotation]
+				})
+
+				Context("A ConfigMap volume is updated", func() {
+					BeforeEach(func() {
+						m.Get(cm1, timeout).Should(Succeed())
+						cm1.Data["key1"] = "modified"
+						m.Update(cm1).Should(Succeed())
+
+						waitForStatefulSetReconciled(statefulset)
+
+						// Get the updated StatefulSet
+						m.Get(statefulset, timeout).Should(Succeed())
+					})
+
+					It("Updates the config hash in the Pod Template", func() {
+						m.Eventually(statefulset, timeout).ShouldNot(utils.WithAnnotations(HaveKeyWithValue(core.ConfigHashAnnotation, originalHash)))
+					})
+				})
+
+				Context("A ConfigMap EnvSource is updated", func() {
+					BeforeEach(func() {
+						m.Get(cm2, timeout).Should(Succeed())
+						cm2.Data["key1"] = "modified"
+						m.Update(cm2).Should(Succeed())
+
+						waitForStatefulSetReconciled(statefulset)
+
+						// Get the updated StatefulSet
+						m.Get(statefulset, timeout).Should(Succeed())
+					})
+
+					It("Updates the config hash in the Pod Template", func() {
+						m.Eventually(statefulset, timeout).ShouldNot(utils.WithAnnotations(HaveKeyWithValue(core.ConfigHashAnnotation, originalHash)))
+					})
+				})
+
+				Context("A Secret volume is updated", func() {
+					BeforeEach(func() {
+						m.Get(s1, timeout).Should(Succeed())
+						if s1.StringData == nil {
+							s1.StringData = make(map[string]string)
+						}
+						s1.StringData["key1"] = "modified"
+						m.Update(s1).Should(Succeed())
+
+						waitForStatefulSetReconciled(statefulset)
+
+						// Get the updated StatefulSet
+						m.Get(statefulset, timeout).Should(Succeed())
+					})
+
+					It("Updates the config hash in the Pod Template", func() {
+						m.Eventually(statefulset, timeout).ShouldNot(utils.WithAnnotations(HaveKeyWithValue(core.ConfigHashAnnotation, originalHash)))
+					})
+				})
+
+				Context("A Secret EnvSource is updated", func() {
+					BeforeEach(func() {
+						m.Get(s2, timeout).Should(Succeed())
+						if s2.StringData == nil {
+							s2.StringData = make(map[string]string)
+						}
+						s2.StringData["key1"] = "modified"
+						m.Update(s2).Should(Succeed())
+
+						waitForStatefulSetReconciled(statefulset)
+
+						// Get the updated StatefulSet
+						m.Get(statefulset, timeout).Should(Succeed())
+					})
+
+					It("Updates the config hash in the Pod Template", func() {
+						m.Eventually(statefulset, timeout).ShouldNot(utils.WithAnnotations(HaveKeyWithValue(core.ConfigHashAnnotation, originalHash)))
+					})
+				})
+			})
+
+			Context("And the annotation is removed", func() {
+				BeforeEach(func() {
+					m.Get(statefulset, timeout).Should(Succeed())
+					statefulset.SetAnnotations(make(map[string]string))
+					m.Update(statefulset).Should(Succeed())
+					waitForStatefulSetReconciled(statefulset)
+
+					m.Eventually(statefulset, timeout).ShouldNot(utils.WithAnnotations(HaveKey(core.RequiredAnnotation)))
+				})
+
+				It("Removes the OwnerReference from the all children", func() {
+					for _, obj := range []core.Object{cm1, cm2, s1, s2} {
+						m.Eventually(obj, timeout).ShouldNot(utils.WithOwnerReferences(ContainElement(ownerRef)))
+					}
+				})
+
+				It("Removes the StatefulSet's finalizer", func() {
+					m.Eventually(statefulset, timeout).ShouldNot(utils.WithFinalizers(ContainElement(core.FinalizerString)))
+				})
+			})
+
+			Context("And is deleted", func() {
+				BeforeEach(func() {
+					// Make sure the cache has synced before we run the test
+					m.Eventually(statefulset, timeout).Should(utils.WithPodTemplateAnnotations(HaveKey(core.ConfigHashAnnotation)))
+					m.Delete(statefulset).Should(Succeed())
+					m.Eventually(statefulset, timeout).ShouldNot(utils.WithDeletionTimestamp(BeNil()))
+					waitForStatefulSetReconciled(statefulset)
+
+					// Get the updated StatefulSet
+					m.Get(statefulset, timeout).Should(Succeed())
+				})
+				It("Removes the OwnerReference from the all children", func() {
+					for _, obj := range []core.Object{cm1, cm2, s1, s2} {
+						m.Eventually(obj, timeout).ShouldNot(utils.WithOwnerReferences(ContainElement(ownerRef)))
+					}
+				})
+
+				It("Removes the StatefulSet's finalizer", func() {
+					// Removing the finalizer causes the statefulset to be deleted
+					m.Get(statefulset, timeout).ShouldNot(Succeed())
+				})
+			})
+
+			Context("And its partitioned rollout is asked to complete", func() {
+				BeforeEach(func() {
+					m.Eventually(statefulset, timeout).Should(utils.WithPodTemplateAnnotations(HaveKey(core.ConfigHashAnnotation)))
+
+					m.Get(statefulset, timeout).Should(Succeed())
+					partition := int32(2)
+					statefulset.Spec.UpdateStrategy = appsv1.StatefulSetUpdateStrategy{
+						Type: appsv1.RollingUpdateStatefulSetStrategyType,
+						RollingUpdate: &appsv1.RollingUpdateStatefulSetStrategy{
+							Partition: &partition,
+						},
+					}
+					m.Update(statefulset).Should(Succeed())
+					waitForStatefulSetReconciled(statefulset)
+
+					m.Get(statefulset, timeout).Should(Succeed())
+					annotations := statefulset.GetAnnotations()
+					annotations[core.CompletePartitionAnnotation] = "true"
+					statefulset.SetAnnotations(annotations)
+					m.Update(statefulset).Should(Succeed())
+					waitForStatefulSetReconciled(statefulset)
+				})
+
+				It("Sets the partition to 0", func() {
+					partition := func(obj core.Object) int32 {
+						ss := obj.(*appsv1.StatefulSet)
+						if ss.Spec.UpdateStrategy.RollingUpdate == nil || ss.Spec.UpdateStrategy.RollingUpdate.Partition == nil {
+							return -1
+						}
+						return *ss.Spec.UpdateStrategy.RollingUpdate.Partition
+					}
+					m.Eventually(statefulset, timeout).Should(WithTransform(partition, Equal(int32(0))))
+				})
+
+				It("Removes the completion annotation", func() {
+					m.Eventually(statefulset, timeout).ShouldNot(utils.WithAnnotations(HaveKey(core.CompletePartitionAnnotation)))
+				})
+			})
+		})
+
+		Context("And it does not have the required annotation", func() {
+			BeforeEach(func() {
+				// Get the updated StatefulSet
+				m.Get(statefulset, timeout).Should(Succeed())
+			})
+
+			It("Doesn't add any OwnerReferences to any children", func() {
+				for _, obj := range []core.Object{cm1, cm2, s1, s2} {
+					m.Consistently(obj, consistentlyTimeout).ShouldNot(utils.WithOwnerReferences(ContainElement(ownerRef)))
+				}
+			})
+
+			It("Doesn't add a finalizer to the StatefulSet", func() {
+				m.Consistently(statefulset, consistentlyTimeout).ShouldNot(utils.WithFinalizers(ContainElement(core.FinalizerString)))
+			})
+
+			It("Doesn't add a config hash to the Pod Template", func() {
+				m.Consistently(statefulset, consistentlyTimeout).ShouldNot(utils.WithAnnotations(ContainElement(core.ConfigHashAnnotation)))
+			})
+		})
+	})
+
+})
@@ -0,0 +1,57 @@
+/*
+Copyright 2018 Pusher Ltd.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package core
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// adoptsWithoutRollout returns true if the configuration hash should be
+// recorded in the workload's AdoptedConfigHashAnnotation rather than in its
+// PodTemplate.
+// This is the case when AdoptWithoutRollout is enabled and Wave has never
+// recorded a hash in the PodTemplate, until the hash differs from the one
+// recorded when the workload was adopted
+func (h *Handler) adoptsWithoutRollout(obj Object, hash string) bool {
+	if !h.options.AdoptWithoutRollout || getConfigHash(obj, h.options.ConfigHashAnnotation) != "" {
+		return false
+	}
+	adopted, ok := obj.GetAnnotations()[AdoptedConfigHashAnnotation]
+	return !ok || adopted == hash
+}
+
+// setAdoptedConfigHash records the configuration hash the workload was adopted
+// with on its metadata, which doesn't change its generation
+func setAdoptedConfigHash(obj metav1.Object, hash string) {
+	annotations := obj.GetAnnotations()
+	if annotations == nil {
+		annotations = make(map[string]string)
+	}
+	annotations[AdoptedConfigHashAnnotation] = hash
+	obj.SetAnnotations(annotations)
+}
+
+// removeAdoptedConfigHash removes the AdoptedConfigHashAnnotation once the
+// hash is recorded in the workload's PodTemplate
+func removeAdoptedConfigHash(obj metav1.Object) {
+	annotations := obj.GetAnnotations()
+	if _, ok := annotations[AdoptedConfigHashAnnotation]; !ok {
+		return
+	}
+	delete(annotations, AdoptedConfigHashAnnotation)
+	obj.SetAnnotations(annotations)
+}
@@ -0,0 +1,116 @@
+/*
+Copyright 2018 Pusher Ltd.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package core
+
+import (
+	"fmt"
+	"sync"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// childHashTracker records the hash of each child as last seen by each
+// workload, so that the children whose changes caused a rollout can be
+// identified
+type childHashTracker struct {
+	lock   sync.Mutex
+	hashes map[types.UID]childHashSet
+}
+
+// childHash is the hash of a child along with the hashes of each of its data
+// keys, so that the keys that changed can be identified
+type childHash struct {
+	hash string
+	keys map[string]string
+}
+
+// newChildHashTracker constructs a childHashTracker with no recorded hashes
+func newChildHashTracker() *childHashTracker {
+	return &childHashTracker{hashes: make(map[types.UID]childHashSet)}
+}
+
+// childHashSet is the childHash of each of a workload's children, keyed by
+// childHashKey
+type childHashSet map[string]childHash
+
+// diff calculates the hashes of the workload's current children and returns
+// the children whose hash differs from the one previously recorded, along
+// with a description of every change for the hash diff log and the hashes to
+// record once the change has been applied.
+// Children that weren't previously recorded are also returned.
+// No children or changes are returned while no hashes are recorded for the
+// workload.
+// The versionLabel and resourceVersions are hashed as in
+// calculateConfigHashWithCache
+func (c *childHashTracker) diff(owner Object, children []Object, versionLabel string, resourceVersions *resourceVersionTracker) ([]Object, []string, childHashSet, error) {
+	hashes := make(childHashSet)
+	for _, child := range children {
+		hash, err := calculateConfigHashWithCache([]Object{child}, nil, versionLabel, resourceVersions)
+		if err != nil {
+			return nil, nil, nil, fmt.Errorf("error calculating hash of %s %s: %v", kindOf(child), child.GetName(), err)
+		}
+		hashes[childHashKey(child)] = childHash{hash: hash, keys: hashDataKeys(child)}
+	}
+
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	previous, ok := c.hashes[owner.GetUID()]
+	if !ok {
+		return []Object{}, []string{}, hashes, nil
+	}
+
+	changed := []Object{}
+	for _, child := range children {
+		if previous[childHashKey(child)].hash != hashes[childHashKey(child)].hash {
+			changed = append(changed, child)
+		}
+	}
+	return changed, describeChildChanges(previous, hashes), hashes, nil
+}
+
+// record records the hashes returned by diff as those last seen by the
+// workload
+func (c *childHashTracker) record(owner Object, hashes childHashSet) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.hashes[owner.GetUID()] = hashes
+}
+
+// forget removes the hashes recorded for the workload
+func (c *childHashTracker) forget(uid types.UID) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	delete(c.hashes, uid)
+}
+
+// childHashKey identifies a child by its kind, namespace and name
+func childHashKey(child Object) string {
+	return fmt.Sprintf("%s/%s/%s", kindOf(child), child.GetNamespace(), child.GetName())
+}
+
+// sendChildRolloutEvents sends an event on each of the children that changed
+// since the workload was last reconciled, naming the workload they caused to
+// roll out.
+// Missing optional children have no object to send the event on, so are
+// skipped
+func (h *Handler) sendChildRolloutEvents(owner Object, changed []Object) {
+	for _, child := range withoutAbsentChildren(changed) {
+		h.recorder.Eventf(child, corev1.EventTypeNormal, "RolloutTriggered", "Configuration change triggered a rollout of %s %s/%s", kindOf(owner), owner.GetNamespace(), owner.GetName())
+	}
+}
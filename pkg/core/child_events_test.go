@@ -0,0 +1,151 @@
+/*
+Copyright 2018 Pusher Ltd.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package core
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/pusher/wave/test/utils"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/manager"
+)
+
+var _ = Describe("Wave child events Suite", func() {
+	var c client.Client
+	var h *Handler
+	var m utils.Matcher
+	var deployment1 *appsv1.Deployment
+	var deployment2 *appsv1.Deployment
+	var cm1 *corev1.ConfigMap
+	var cm2 *corev1.ConfigMap
+	var mgrStopped *sync.WaitGroup
+	var stopMgr chan struct{}
+
+	const timeout = time.Second * 5
+	const consistentlyTimeout = time.Second
+
+	// eventsFor returns a function listing the messages of the
+	// RolloutTriggered events involving the object
+	var eventsFor = func(obj Object) func() []string {
+		return func() []string {
+			events := &corev1.EventList{}
+			Expect(c.List(context.TODO(), &client.ListOptions{}, events)).To(Succeed())
+
+			messages := []string{}
+			for _, event := range events.Items {
+				involved := event.InvolvedObject
+				if involved.Kind == kindOf(obj) && involved.Name == obj.GetName() && event.Reason == "RolloutTriggered" {
+					messages = append(messages, event.Message)
+				}
+			}
+			return messages
+		}
+	}
+
+	var reconcileAll = func() {
+		for _, deployment := range []*appsv1.Deployment{deployment1, deployment2} {
+			m.Get(deployment, timeout).Should(Succeed())
+			_, err := h.HandleDeployment(deployment)
+			Expect(err).NotTo(HaveOccurred())
+		}
+	}
+
+	BeforeEach(func() {
+		mgr, err := manager.New(cfg, manager.Options{})
+		Expect(err).NotTo(HaveOccurred())
+		c = mgr.GetClient()
+		h = NewHandler(c, mgr.GetRecorder("wave"), Options{ChildRolloutEvents: true})
+		m = utils.Matcher{Client: c}
+
+		stopMgr, mgrStopped = StartTestManager(mgr)
+
+		cm1 = utils.ExampleConfigMap1.DeepCopy()
+		cm2 = utils.ExampleConfigMap2.DeepCopy()
+		for _, obj := range []Object{
+			cm1,
+			cm2,
+			utils.ExampleSecret1.DeepCopy(),
+			utils.ExampleSecret2.DeepCopy(),
+		} {
+			m.Create(obj).Should(Succeed())
+			m.Get(obj, timeout).Should(Succeed())
+		}
+
+		// Create two Deployments referencing the same children
+		deployment1 = utils.ExampleDeployment.DeepCopy()
+		deployment2 = utils.ExampleDeployment.DeepCopy()
+		deployment2.SetName("example2")
+		for _, deployment := range []*appsv1.Deployment{deployment1, deployment2} {
+			deployment.SetAnnotations(map[string]string{RequiredAnnotation: "true"})
+			m.Create(deployment).Should(Succeed())
+		}
+		reconcileAll()
+	})
+
+	AfterEach(func() {
+		// Make sure to delete the finalizers so the Deployments can be deleted
+		for _, deployment := range []*appsv1.Deployment{deployment1, deployment2} {
+			m.Get(deployment, timeout).Should(Succeed())
+			deployment.SetFinalizers([]string{})
+			m.Update(deployment).Should(Succeed())
+		}
+
+		close(stopMgr)
+		mgrStopped.Wait()
+
+		utils.DeleteAll(cfg, timeout,
+			&appsv1.DeploymentList{},
+			&corev1.ConfigMapList{},
+			&corev1.SecretList{},
+			&corev1.EventList{},
+		)
+	})
+
+	It("Doesn't send events on children when the hash is first recorded", func() {
+		Consistently(eventsFor(cm1), consistentlyTimeout).Should(BeEmpty())
+	})
+
+	Context("When a ConfigMap is updated", func() {
+		BeforeEach(func() {
+			m.Get(cm1, timeout).Should(Succeed())
+			cm1.Data["key1"] = "modified"
+			m.Update(cm1).Should(Succeed())
+			m.Eventually(cm1, timeout).Should(WithTransform(func(obj *corev1.ConfigMap) string {
+				return obj.Data["key1"]
+			}, Equal("modified")))
+
+			reconcileAll()
+		})
+
+		It("Sends an event on the ConfigMap naming each workload rolled out", func() {
+			Eventually(eventsFor(cm1), timeout).Should(ConsistOf(
+				"Configuration change triggered a rollout of Deployment default/example",
+				"Configuration change triggered a rollout of Deployment default/example2",
+			))
+		})
+
+		It("Doesn't send events on unchanged children", func() {
+			Consistently(eventsFor(cm2), consistentlyTimeout).Should(BeEmpty())
+		})
+	})
+})
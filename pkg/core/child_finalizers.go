@@ -0,0 +1,37 @@
+/*
+Copyright 2018 Pusher Ltd.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package core
+
+import (
+	corev1 "k8s.io/api/core/v1"
+)
+
+// warnFinalizedChildren sends a Warning event on the workload for each of its
+// children that carries the Wave finalizer.
+// Only workloads should carry the finalizer, so a child carrying it suggests
+// it was mistakenly treated as a workload, eg. by a misconfigured controller.
+// The children are still hashed as normal
+func (h *Handler) warnFinalizedChildren(obj Object, children []Object) {
+	if !h.options.CheckChildFinalizers {
+		return
+	}
+	for _, child := range children {
+		if hasFinalizer(child, h.options.Finalizer) {
+			h.recorder.Eventf(obj, corev1.EventTypeWarning, "ChildHasFinalizer", "%s %s/%s carries the %s finalizer, it may be misconfigured as a workload", kindOf(child), child.GetNamespace(), child.GetName(), h.options.Finalizer)
+		}
+	}
+}
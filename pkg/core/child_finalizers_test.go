@@ -0,0 +1,58 @@
+/*
+Copyright 2018 Pusher Ltd.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package core
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/pusher/wave/test/utils"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/client-go/tools/record"
+)
+
+var _ = Describe("Wave child finalizers Suite", func() {
+	var recorder *record.FakeRecorder
+	var deployment *appsv1.Deployment
+	var cm1, cm2 *corev1.ConfigMap
+
+	BeforeEach(func() {
+		recorder = record.NewFakeRecorder(10)
+		deployment = utils.ExampleDeployment.DeepCopy()
+		cm1 = utils.ExampleConfigMap1.DeepCopy()
+		cm2 = utils.ExampleConfigMap2.DeepCopy()
+
+		// Seed one of the children with the Wave finalizer
+		cm1.SetFinalizers([]string{"other", FinalizerString})
+	})
+
+	It("sends a Warning event for each child with the finalizer", func() {
+		h := NewHandler(nil, recorder, Options{CheckChildFinalizers: true})
+		h.warnFinalizedChildren(deployment, []Object{cm1, cm2})
+
+		var event string
+		Expect(recorder.Events).To(Receive(&event))
+		Expect(event).To(Equal("Warning ChildHasFinalizer ConfigMap default/example1 carries the wave.pusher.com/finalizer finalizer, it may be misconfigured as a workload"))
+		Expect(recorder.Events).NotTo(Receive())
+	})
+
+	It("doesn't send an event when the check is disabled", func() {
+		h := NewHandler(nil, recorder, Options{})
+		h.warnFinalizedChildren(deployment, []Object{cm1, cm2})
+		Expect(recorder.Events).NotTo(Receive())
+	})
+})
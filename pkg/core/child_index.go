@@ -0,0 +1,167 @@
+/*
+Copyright 2018 Pusher Ltd.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package core
+
+import (
+	"sort"
+	"sync"
+
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// ChildIndex maps each child to the workloads referencing it so that changes
+// to a child can be mapped to workloads without relying on OwnerReferences.
+// The index is updated by the Handler each time a workload is reconciled and
+// when a workload is deleted
+type ChildIndex struct {
+	lock      sync.RWMutex
+	workloads map[childKey]map[workloadKey]struct{}
+	children  map[workloadKey][]childKey
+}
+
+// childKey identifies a child by its kind, namespace and name
+type childKey struct {
+	kind string
+	types.NamespacedName
+}
+
+// workloadKey identifies a workload by its kind, namespace and name
+type workloadKey struct {
+	kind string
+	types.NamespacedName
+}
+
+// NewChildIndex constructs an empty ChildIndex
+func NewChildIndex() *ChildIndex {
+	return &ChildIndex{
+		workloads: make(map[childKey]map[workloadKey]struct{}),
+		children:  make(map[workloadKey][]childKey),
+	}
+}
+
+// WorkloadsFor returns the namespaced names of all workloads of the same kind
+// as workloadType that reference the given child
+func (i *ChildIndex) WorkloadsFor(child Object, workloadType Object) []types.NamespacedName {
+	if i == nil {
+		return []types.NamespacedName{}
+	}
+	i.lock.RLock()
+	defer i.lock.RUnlock()
+
+	key := childKey{kind: kindOf(child), NamespacedName: types.NamespacedName{Namespace: child.GetNamespace(), Name: child.GetName()}}
+	kind := kindOf(workloadType)
+
+	names := []types.NamespacedName{}
+	for workload := range i.workloads[key] {
+		if workload.kind == kind {
+			names = append(names, workload.NamespacedName)
+		}
+	}
+
+	// Sort the names so that the result is deterministic
+	sort.Slice(names, func(a, b int) bool {
+		return names[a].String() < names[b].String()
+	})
+	return names
+}
+
+// update replaces the children indexed for the workload with the given sets
+// of ConfigMaps and Secrets
+func (i *ChildIndex) update(workload Object, configMaps, secrets map[types.NamespacedName]struct{}) {
+	i.updateWithExtra(workload, configMaps, secrets, nil)
+}
+
+// updateWithExtra replaces the children indexed for the workload with the
+// given sets of ConfigMaps, Secrets and children of other kinds
+func (i *ChildIndex) updateWithExtra(workload Object, configMaps, secrets map[types.NamespacedName]struct{}, extra map[schema.GroupVersionKind]map[types.NamespacedName]struct{}) {
+	if i == nil {
+		return
+	}
+	i.lock.Lock()
+	defer i.lock.Unlock()
+
+	wKey := keyForWorkload(workload)
+	i.removeLocked(wKey)
+
+	children := []childKey{}
+	for name := range configMaps {
+		children = append(children, childKey{kind: "ConfigMap", NamespacedName: name})
+	}
+	for name := range secrets {
+		children = append(children, childKey{kind: "Secret", NamespacedName: name})
+	}
+	for gvk, names := range extra {
+		for name := range names {
+			children = append(children, childKey{kind: gvk.Kind, NamespacedName: name})
+		}
+	}
+
+	for _, cKey := range children {
+		if _, ok := i.workloads[cKey]; !ok {
+			i.workloads[cKey] = make(map[workloadKey]struct{})
+		}
+		i.workloads[cKey][wKey] = struct{}{}
+	}
+	i.children[wKey] = children
+}
+
+// contains checks whether the workload has children recorded in the index
+func (i *ChildIndex) contains(workload Object) bool {
+	if i == nil {
+		return false
+	}
+	i.lock.RLock()
+	defer i.lock.RUnlock()
+
+	_, ok := i.children[keyForWorkload(workload)]
+	return ok
+}
+
+// remove removes the workload and all of its children from the index
+func (i *ChildIndex) remove(workload Object) {
+	i.removeKey(keyForWorkload(workload))
+}
+
+// removeKey removes the workload with the given key and all of its children
+// from the index
+func (i *ChildIndex) removeKey(wKey workloadKey) {
+	if i == nil {
+		return
+	}
+	i.lock.Lock()
+	defer i.lock.Unlock()
+
+	i.removeLocked(wKey)
+}
+
+// removeLocked removes the workload from the index.
+// The caller must hold the write lock
+func (i *ChildIndex) removeLocked(wKey workloadKey) {
+	for _, cKey := range i.children[wKey] {
+		delete(i.workloads[cKey], wKey)
+		if len(i.workloads[cKey]) == 0 {
+			delete(i.workloads, cKey)
+		}
+	}
+	delete(i.children, wKey)
+}
+
+// keyForWorkload constructs the workloadKey for the given workload
+func keyForWorkload(workload Object) workloadKey {
+	return workloadKey{kind: kindOf(workload), NamespacedName: types.NamespacedName{Namespace: workload.GetNamespace(), Name: workload.GetName()}}
+}
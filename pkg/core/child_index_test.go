@@ -0,0 +1,210 @@
+/*
+Copyright 2018 Pusher Ltd.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package core
+
+import (
+	"sync"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/pusher/wave/test/utils"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/manager"
+)
+
+var _ = Describe("Wave child index Suite", func() {
+	var index *ChildIndex
+	var deployment1 *appsv1.Deployment
+	var deployment2 *appsv1.Deployment
+	var daemonset *appsv1.DaemonSet
+	var cm1 *corev1.ConfigMap
+	var cm2 *corev1.ConfigMap
+
+	var nameOf = func(obj Object) types.NamespacedName {
+		return types.NamespacedName{Namespace: obj.GetNamespace(), Name: obj.GetName()}
+	}
+
+	var keysOf = func(objs ...Object) map[types.NamespacedName]struct{} {
+		keys := make(map[types.NamespacedName]struct{})
+		for _, obj := range objs {
+			keys[nameOf(obj)] = struct{}{}
+		}
+		return keys
+	}
+
+	BeforeEach(func() {
+		index = NewChildIndex()
+
+		deployment1 = utils.ExampleDeployment.DeepCopy()
+		deployment2 = utils.ExampleDeployment.DeepCopy()
+		deployment2.SetName("example2")
+		daemonset = utils.ExampleDaemonSet.DeepCopy()
+		cm1 = utils.ExampleConfigMap1.DeepCopy()
+		cm2 = utils.ExampleConfigMap2.DeepCopy()
+	})
+
+	Context("update", func() {
+		BeforeEach(func() {
+			index.update(deployment1, keysOf(cm1, cm2), keysOf())
+			index.update(deployment2, keysOf(cm1), keysOf())
+			index.update(daemonset, keysOf(cm1), keysOf())
+		})
+
+		It("maps a ConfigMap to all workloads of the kind referencing it", func() {
+			Expect(index.WorkloadsFor(cm1, &appsv1.Deployment{})).To(ConsistOf(nameOf(deployment1), nameOf(deployment2)))
+			Expect(index.WorkloadsFor(cm2, &appsv1.Deployment{})).To(ConsistOf(nameOf(deployment1)))
+		})
+
+		It("doesn't map a ConfigMap to workloads of other kinds", func() {
+			Expect(index.WorkloadsFor(cm1, &appsv1.DaemonSet{})).To(ConsistOf(nameOf(daemonset)))
+			Expect(index.WorkloadsFor(cm2, &appsv1.DaemonSet{})).To(BeEmpty())
+		})
+
+		It("doesn't map a Secret with the same name as a ConfigMap", func() {
+			s := &corev1.Secret{}
+			s.SetNamespace(cm1.GetNamespace())
+			s.SetName(cm1.GetName())
+			Expect(index.WorkloadsFor(s, &appsv1.Deployment{})).To(BeEmpty())
+		})
+
+		It("removes the mapping when a workload stops referencing a ConfigMap", func() {
+			index.update(deployment1, keysOf(cm2), keysOf())
+			Expect(index.WorkloadsFor(cm1, &appsv1.Deployment{})).To(ConsistOf(nameOf(deployment2)))
+			Expect(index.WorkloadsFor(cm2, &appsv1.Deployment{})).To(ConsistOf(nameOf(deployment1)))
+		})
+	})
+
+	Context("remove", func() {
+		BeforeEach(func() {
+			index.update(deployment1, keysOf(cm1, cm2), keysOf())
+			index.update(deployment2, keysOf(cm1), keysOf())
+			index.remove(deployment1)
+		})
+
+		It("removes the workload from all of its children", func() {
+			Expect(index.WorkloadsFor(cm1, &appsv1.Deployment{})).To(ConsistOf(nameOf(deployment2)))
+			Expect(index.WorkloadsFor(cm2, &appsv1.Deployment{})).To(BeEmpty())
+		})
+	})
+
+	Context("contains", func() {
+		It("reports whether the workload is indexed", func() {
+			Expect(index.contains(deployment1)).To(BeFalse())
+			index.update(deployment1, keysOf(cm1), keysOf())
+			Expect(index.contains(deployment1)).To(BeTrue())
+			Expect(index.contains(deployment2)).To(BeFalse())
+			index.remove(deployment1)
+			Expect(index.contains(deployment1)).To(BeFalse())
+		})
+	})
+
+	Context("A nil index", func() {
+		It("ignores updates and returns no workloads", func() {
+			var nilIndex *ChildIndex
+			nilIndex.update(deployment1, keysOf(cm1), keysOf())
+			nilIndex.remove(deployment1)
+			Expect(nilIndex.WorkloadsFor(cm1, &appsv1.Deployment{})).To(BeEmpty())
+			Expect(nilIndex.contains(deployment1)).To(BeFalse())
+		})
+	})
+
+	Context("When used by the Handler", func() {
+		var c client.Client
+		var h *Handler
+		var m utils.Matcher
+		var mgrStopped *sync.WaitGroup
+		var stopMgr chan struct{}
+
+		const timeout = time.Second * 5
+
+		BeforeEach(func() {
+			mgr, err := manager.New(cfg, manager.Options{})
+			Expect(err).NotTo(HaveOccurred())
+			c = mgr.GetClient()
+			h = NewHandler(c, mgr.GetRecorder("wave"), Options{ChildIndex: index})
+			m = utils.Matcher{Client: c}
+
+			stopMgr, mgrStopped = StartTestManager(mgr)
+
+			for _, obj := range []Object{
+				cm1,
+				cm2,
+				utils.ExampleSecret1.DeepCopy(),
+				utils.ExampleSecret2.DeepCopy(),
+			} {
+				m.Create(obj).Should(Succeed())
+				m.Get(obj, timeout).Should(Succeed())
+			}
+
+			deployment1.SetAnnotations(map[string]string{RequiredAnnotation: "true"})
+			m.Create(deployment1).Should(Succeed())
+			m.Get(deployment1, timeout).Should(Succeed())
+
+			_, err = h.HandleDeployment(deployment1)
+			Expect(err).NotTo(HaveOccurred())
+			m.Get(deployment1, timeout).Should(Succeed())
+		})
+
+		AfterEach(func() {
+			// Make sure to delete the finalizer so the Deployment can be deleted
+			m.Get(deployment1, timeout).Should(Succeed())
+			deployment1.SetFinalizers([]string{})
+			m.Update(deployment1).Should(Succeed())
+
+			close(stopMgr)
+			mgrStopped.Wait()
+
+			utils.DeleteAll(cfg, timeout,
+				&appsv1.DeploymentList{},
+				&corev1.ConfigMapList{},
+				&corev1.SecretList{},
+				&corev1.EventList{},
+			)
+		})
+
+		It("records the children referenced by the workload", func() {
+			Expect(index.WorkloadsFor(cm1, &appsv1.Deployment{})).To(ConsistOf(nameOf(deployment1)))
+			Expect(index.WorkloadsFor(cm2, &appsv1.Deployment{})).To(ConsistOf(nameOf(deployment1)))
+		})
+
+		It("updates the index when the workload stops referencing a child", func() {
+			containers := deployment1.Spec.Template.Spec.Containers
+			containers[0].EnvFrom = []corev1.EnvFromSource{}
+			containers[1].EnvFrom = []corev1.EnvFromSource{}
+			m.Update(deployment1).Should(Succeed())
+			m.Get(deployment1, timeout).Should(Succeed())
+
+			_, err := h.HandleDeployment(deployment1)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(index.WorkloadsFor(cm2, &appsv1.Deployment{})).To(BeEmpty())
+		})
+
+		It("removes the workload when the required annotation is removed", func() {
+			deployment1.SetAnnotations(map[string]string{})
+			m.Update(deployment1).Should(Succeed())
+			m.Get(deployment1, timeout).Should(Succeed())
+
+			_, err := h.HandleDeployment(deployment1)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(index.WorkloadsFor(cm1, &appsv1.Deployment{})).To(BeEmpty())
+		})
+	})
+})
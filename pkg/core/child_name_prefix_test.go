@@ -0,0 +1,119 @@
+/*
+Copyright 2018 Pusher Ltd.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package core
+
+import (
+	"sync"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/pusher/wave/test/utils"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/manager"
+)
+
+var _ = Describe("Wave child name prefix Suite", func() {
+	var c client.Client
+	var h *Handler
+	var m utils.Matcher
+	var deployment *appsv1.Deployment
+	var matching, other *corev1.ConfigMap
+	var mgrStopped *sync.WaitGroup
+	var stopMgr chan struct{}
+
+	const timeout = time.Second * 5
+
+	BeforeEach(func() {
+		mgr, err := manager.New(cfg, manager.Options{})
+		Expect(err).NotTo(HaveOccurred())
+		c = mgr.GetClient()
+		m = utils.Matcher{Client: c}
+		h = NewHandler(c, mgr.GetRecorder("wave"), Options{ChildNamePrefix: "app-"})
+
+		stopMgr, mgrStopped = StartTestManager(mgr)
+
+		matching = &corev1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "app-config"},
+			Data:       map[string]string{"key": "app"},
+		}
+		other = &corev1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "infra-config"},
+			Data:       map[string]string{"key": "infra"},
+		}
+		for _, obj := range []Object{matching, other} {
+			m.Create(obj).Should(Succeed())
+			m.Get(obj, timeout).Should(Succeed())
+		}
+
+		// Reference only the two ConfigMaps
+		deployment = utils.ExampleDeployment.DeepCopy()
+		deployment.SetAnnotations(map[string]string{
+			RequiredAnnotation:        "true",
+			ExtraConfigMapsAnnotation: "app-config,infra-config",
+		})
+		deployment.Spec.Template.Spec.Volumes = nil
+		for i := range deployment.Spec.Template.Spec.Containers {
+			deployment.Spec.Template.Spec.Containers[i].EnvFrom = nil
+		}
+		m.Create(deployment).Should(Succeed())
+		m.Get(deployment, timeout).Should(Succeed())
+
+		_, err = h.HandleDeployment(deployment)
+		Expect(err).NotTo(HaveOccurred())
+		m.Get(deployment, timeout).Should(Succeed())
+	})
+
+	AfterEach(func() {
+		// Make sure to delete the finalizer so the Deployment can be deleted
+		m.Get(deployment, timeout).Should(Succeed())
+		deployment.SetFinalizers([]string{})
+		m.Update(deployment).Should(Succeed())
+
+		close(stopMgr)
+		mgrStopped.Wait()
+
+		utils.DeleteAll(cfg, timeout,
+			&appsv1.DeploymentList{},
+			&corev1.ConfigMapList{},
+			&corev1.EventList{},
+		)
+	})
+
+	It("Only discovers the matching ConfigMap", func() {
+		configMaps, _, err := h.getChildKeys(deployment)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(configMaps).To(HaveLen(1))
+		Expect(configMaps).To(HaveKey(types.NamespacedName{Namespace: matching.GetNamespace(), Name: matching.GetName()}))
+	})
+
+	It("Only hashes the matching ConfigMap", func() {
+		expected, err := calculateConfigHash([]Object{matching})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(deployment.Spec.Template.GetAnnotations()).To(HaveKeyWithValue(ConfigHashAnnotation, expected))
+	})
+
+	It("Only adds an OwnerReference to the matching ConfigMap", func() {
+		m.Eventually(matching, timeout).Should(utils.WithOwnerReferences(ContainElement(utils.GetOwnerRef(deployment))))
+		m.Get(other, timeout).Should(Succeed())
+		Expect(other.GetOwnerReferences()).To(BeEmpty())
+	})
+})
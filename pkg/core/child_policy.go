@@ -0,0 +1,112 @@
+/*
+Copyright 2018 Pusher Ltd.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package core
+
+import (
+	"fmt"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// ChildPolicy determines how Wave manages the children of a single kind
+type ChildPolicy struct {
+	// Ignore stops Wave from indexing, hashing or adding OwnerReferences to
+	// children of this kind, as if workloads didn't reference them
+	Ignore bool
+
+	// DisableOwnerReferences stops Wave from adding OwnerReferences to
+	// children of this kind. They are still hashed and their changes still
+	// trigger a reconcile through the ChildIndex.
+	// OwnerReferences added previously are removed
+	DisableOwnerReferences bool
+
+	// ExcludeFromHash stops Wave from including children of this kind in the
+	// configuration hash. They still receive OwnerReferences
+	ExcludeFromHash bool
+}
+
+// ParseChildPolicy parses a ChildPolicy given as a comma separated list of
+// "ignore", "no-owner-references" and "no-hash".
+// An empty string is parsed as the default ChildPolicy, with full management
+func ParseChildPolicy(arg string) (ChildPolicy, error) {
+	policy := ChildPolicy{}
+	for _, value := range strings.Split(arg, ",") {
+		switch strings.TrimSpace(value) {
+		case "":
+		case "ignore":
+			policy.Ignore = true
+		case "no-owner-references":
+			policy.DisableOwnerReferences = true
+		case "no-hash":
+			policy.ExcludeFromHash = true
+		default:
+			return ChildPolicy{}, fmt.Errorf("invalid child policy %q, expected ignore, no-owner-references or no-hash", value)
+		}
+	}
+	return policy, nil
+}
+
+// childPolicy returns the ChildPolicy configured for the kind of the child.
+// Children of other kinds always have the default ChildPolicy
+func (h *Handler) childPolicy(child Object) ChildPolicy {
+	switch child.(type) {
+	case *corev1.ConfigMap:
+		return h.options.ConfigMapPolicy
+	case *corev1.Secret:
+		return h.options.SecretPolicy
+	default:
+		return ChildPolicy{}
+	}
+}
+
+// withoutIgnoredChildKeys removes the keys of all ConfigMaps and Secrets whose
+// ChildPolicy ignores them
+func (h *Handler) withoutIgnoredChildKeys(configMaps, secrets map[types.NamespacedName]struct{}) (map[types.NamespacedName]struct{}, map[types.NamespacedName]struct{}) {
+	if h.options.ConfigMapPolicy.Ignore {
+		configMaps = make(map[types.NamespacedName]struct{})
+	}
+	if h.options.SecretPolicy.Ignore {
+		secrets = make(map[types.NamespacedName]struct{})
+	}
+	return configMaps, secrets
+}
+
+// hashedChildren returns the children whose ChildPolicy includes them in the
+// configuration hash
+func (h *Handler) hashedChildren(children []Object) []Object {
+	hashed := []Object{}
+	for _, child := range children {
+		if !h.childPolicy(child).ExcludeFromHash {
+			hashed = append(hashed, child)
+		}
+	}
+	return hashed
+}
+
+// ownedChildren returns the children whose ChildPolicy allows them to receive
+// OwnerReferences
+func (h *Handler) ownedChildren(children []Object) []Object {
+	owned := []Object{}
+	for _, child := range children {
+		if !h.childPolicy(child).DisableOwnerReferences {
+			owned = append(owned, child)
+		}
+	}
+	return owned
+}
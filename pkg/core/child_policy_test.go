@@ -0,0 +1,129 @@
+/*
+Copyright 2018 Pusher Ltd.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package core
+
+import (
+	"sync"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/pusher/wave/test/utils"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/manager"
+)
+
+var _ = Describe("Wave child policy Suite", func() {
+	Context("ParseChildPolicy", func() {
+		It("parses an empty policy as full management", func() {
+			Expect(ParseChildPolicy("")).To(Equal(ChildPolicy{}))
+		})
+
+		It("parses a list of policies", func() {
+			Expect(ParseChildPolicy("no-owner-references, no-hash")).To(Equal(ChildPolicy{
+				DisableOwnerReferences: true,
+				ExcludeFromHash:        true,
+			}))
+			Expect(ParseChildPolicy("ignore")).To(Equal(ChildPolicy{Ignore: true}))
+		})
+
+		It("rejects an unknown policy", func() {
+			_, err := ParseChildPolicy("no-hash,forget")
+			Expect(err).To(HaveOccurred())
+		})
+	})
+
+	Context("With separate ConfigMap and Secret policies", func() {
+		var c client.Client
+		var h *Handler
+		var m utils.Matcher
+		var deployment *appsv1.Deployment
+		var cm1, cm2 *corev1.ConfigMap
+		var s1, s2 *corev1.Secret
+		var mgrStopped *sync.WaitGroup
+		var stopMgr chan struct{}
+
+		const timeout = time.Second * 5
+
+		BeforeEach(func() {
+			mgr, err := manager.New(cfg, manager.Options{})
+			Expect(err).NotTo(HaveOccurred())
+			c = mgr.GetClient()
+			m = utils.Matcher{Client: c}
+
+			// Secrets are hashed but never owned
+			h = NewHandler(c, mgr.GetRecorder("wave"), Options{
+				SecretPolicy: ChildPolicy{DisableOwnerReferences: true},
+			})
+
+			stopMgr, mgrStopped = StartTestManager(mgr)
+
+			cm1 = utils.ExampleConfigMap1.DeepCopy()
+			cm2 = utils.ExampleConfigMap2.DeepCopy()
+			s1 = utils.ExampleSecret1.DeepCopy()
+			s2 = utils.ExampleSecret2.DeepCopy()
+			for _, obj := range []Object{cm1, cm2, s1, s2} {
+				m.Create(obj).Should(Succeed())
+				m.Get(obj, timeout).Should(Succeed())
+			}
+
+			deployment = utils.ExampleDeployment.DeepCopy()
+			deployment.SetAnnotations(map[string]string{RequiredAnnotation: "true"})
+			m.Create(deployment).Should(Succeed())
+			m.Get(deployment, timeout).Should(Succeed())
+
+			_, err = h.HandleDeployment(deployment)
+			Expect(err).NotTo(HaveOccurred())
+		})
+
+		AfterEach(func() {
+			// Make sure to delete the finalizer so the Deployment can be deleted
+			m.Get(deployment, timeout).Should(Succeed())
+			deployment.SetFinalizers([]string{})
+			m.Update(deployment).Should(Succeed())
+
+			close(stopMgr)
+			mgrStopped.Wait()
+
+			utils.DeleteAll(cfg, timeout,
+				&appsv1.DeploymentList{},
+				&corev1.ConfigMapList{},
+				&corev1.SecretList{},
+				&corev1.EventList{},
+			)
+		})
+
+		It("Adds OwnerReferences to the ConfigMaps", func() {
+			for _, obj := range []Object{cm1, cm2} {
+				m.Eventually(obj, timeout).Should(utils.WithOwnerReferences(ContainElement(utils.GetOwnerRef(deployment))))
+			}
+		})
+
+		It("Doesn't add OwnerReferences to the Secrets", func() {
+			for _, obj := range []Object{s1, s2} {
+				m.Get(obj, timeout).Should(Succeed())
+				Expect(obj.GetOwnerReferences()).To(BeEmpty())
+			}
+		})
+
+		It("Hashes both the ConfigMaps and the Secrets", func() {
+			m.Eventually(deployment, timeout).Should(utils.WithPodTemplateAnnotations(HaveKeyWithValue(ConfigHashAnnotation, exampleHash)))
+		})
+	})
+})
@@ -0,0 +1,99 @@
+/*
+Copyright 2018 Pusher Ltd.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package core
+
+import (
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/util/workqueue"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+	logf "sigs.k8s.io/controller-runtime/pkg/runtime/log"
+)
+
+// childRetryJitter is the maximum fraction of the backoff added to each
+// requeue, so that workloads sharing a child aren't all retried at once.
+// It is less than 1 so that the interval still grows on every retry
+const childRetryJitter = 0.5
+
+// childFetchError is returned when any of a workload's children can't be
+// fetched. It is transient unless a child failed with an error that retrying
+// won't resolve, eg. Wave being forbidden from reading it
+type childFetchError struct {
+	message   string
+	transient bool
+}
+
+// Error implements the error interface
+func (e *childFetchError) Error() string {
+	return e.message
+}
+
+// wrap prefixes the message of the error, keeping whether it is transient
+func (e *childFetchError) wrap(prefix string) *childFetchError {
+	return &childFetchError{message: prefix + ": " + e.message, transient: e.transient}
+}
+
+// isPermanentChildError checks whether retrying the fetch of a child that
+// failed with the error won't resolve it
+func isPermanentChildError(err error) bool {
+	return errors.IsForbidden(err) || errors.IsUnauthorized(err) || errors.IsBadRequest(err) || errors.IsInvalid(err) || errors.IsMethodNotSupported(err)
+}
+
+// newChildRetryLimiter constructs the rate limiter tracking the backoff of
+// each workload whose children fail to fetch.
+// Returns nil if ChildRetryBackoff is disabled
+func newChildRetryLimiter(opts Options) workqueue.RateLimiter {
+	if opts.ChildRetryBackoff <= 0 {
+		return nil
+	}
+	return workqueue.NewItemExponentialFailureRateLimiter(opts.ChildRetryBackoff, opts.ChildRetryMaxBackoff)
+}
+
+// applyChildRetryBackoff replaces the error of a reconcile that failed to
+// fetch the workload's children with a requeue.
+// Transient failures are requeued after a backoff, with jitter, that grows
+// exponentially with each consecutive failure up to the ChildRetryMaxBackoff.
+// Permanent failures are not retried, the workload is reconciled again once it
+// or one of its children changes.
+// The backoff is reset as soon as a reconcile doesn't fail to fetch children
+func (h *Handler) applyChildRetryBackoff(obj Object, result reconcile.Result, err error) (reconcile.Result, error) {
+	if h.childRetries == nil {
+		return result, err
+	}
+	log := logf.Log.WithName("wave")
+
+	fetchErr, ok := err.(*childFetchError)
+	if !ok {
+		h.childRetries.Forget(obj.GetUID())
+		return result, err
+	}
+
+	if !fetchErr.transient {
+		h.childRetries.Forget(obj.GetUID())
+		log.Error(err, "Unable to fetch children, not retrying", "namespace", obj.GetNamespace(), "name", obj.GetName())
+		h.recorder.Eventf(obj, corev1.EventTypeWarning, "ChildFetchFailed", "Unable to fetch the children of %s %s, not retrying until it or its children change: %v", kindOf(obj), obj.GetName(), err)
+		return reconcile.Result{}, nil
+	}
+
+	backoff := wait.Jitter(h.childRetries.When(obj.GetUID()), childRetryJitter)
+	if backoff > h.options.ChildRetryMaxBackoff {
+		backoff = h.options.ChildRetryMaxBackoff
+	}
+	log.V(0).Info("Unable to fetch children, retrying", "namespace", obj.GetNamespace(), "name", obj.GetName(), "backoff", backoff.String(), "error", err.Error())
+	return reconcile.Result{RequeueAfter: backoff}, nil
+}
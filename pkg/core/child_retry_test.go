@@ -0,0 +1,84 @@
+/*
+Copyright 2018 Pusher Ltd.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package core
+
+import (
+	"fmt"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/pusher/wave/test/utils"
+	appsv1 "k8s.io/api/apps/v1"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+var _ = Describe("Wave child retry circuit breaker Suite", func() {
+	const backoff = 100 * time.Millisecond
+
+	var h *Handler
+	var deployment *appsv1.Deployment
+
+	// reconcileWith applies the circuit breaker and the child retry backoff to a
+	// reconcile that failed with the error, as handle does
+	var reconcileWith = func(err error) (reconcile.Result, error) {
+		result, err := h.applyCircuitBreaker(deployment, reconcile.Result{}, err)
+		return h.applyChildRetryBackoff(deployment, result, err)
+	}
+
+	BeforeEach(func() {
+		h = NewHandler(nil, record.NewFakeRecorder(100), Options{
+			ChildRetryBackoff:       backoff,
+			ChildRetryMaxBackoff:    time.Hour,
+			CircuitBreakerThreshold: 2,
+			CircuitBreakerBackoff:   10 * time.Hour,
+		})
+		deployment = utils.ExampleDeployment.DeepCopy()
+		deployment.SetUID("deployment-uid")
+	})
+
+	It("Doesn't count children failing to fetch as failures", func() {
+		var previous time.Duration
+		for i := 0; i < 5; i++ {
+			result, err := reconcileWith(&childFetchError{message: "unavailable", transient: true})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(result.RequeueAfter).To(BeNumerically(">", previous))
+			Expect(result.RequeueAfter).To(BeNumerically("<", time.Hour))
+			previous = result.RequeueAfter
+		}
+		Expect(h.breaker.failures).To(BeEmpty())
+	})
+
+	It("Still opens the circuit for other failures", func() {
+		_, err := reconcileWith(fmt.Errorf("update denied"))
+		Expect(err).To(HaveOccurred())
+		result, err := reconcileWith(fmt.Errorf("update denied"))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(result).To(Equal(reconcile.Result{RequeueAfter: 10 * time.Hour}))
+	})
+
+	It("Doesn't close an open circuit when children fail to fetch", func() {
+		for i := 0; i < 2; i++ {
+			reconcileWith(fmt.Errorf("update denied"))
+		}
+		reconcileWith(&childFetchError{message: "unavailable", transient: true})
+		result, err := reconcileWith(fmt.Errorf("update denied"))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(result).To(Equal(reconcile.Result{RequeueAfter: 10 * time.Hour}))
+	})
+})
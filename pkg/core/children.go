@@ -21,8 +21,8 @@ import (
 	"fmt"
 	"strings"
 
-	appsv1 "k8s.io/api/apps/v1"
 	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/types"
 	"sigs.k8s.io/controller-runtime/pkg/client"
@@ -33,70 +33,123 @@ import (
 type getResult struct {
 	err error
 	obj Object
+
+	// skipped explains why the child was skipped by skipCrossNamespace
+	skipped string
 }
 
 // getCurrentChildren returns a list of all Secrets and ConfigMaps that are
-// referenced in the Deployment's spec
-func (h *Handler) getCurrentChildren(obj *appsv1.Deployment) ([]Object, error) {
-	configMaps, secrets := getChildNamesByType(obj)
+// referenced in the workload's PodTemplate, its extra children annotations or
+// the configured JSONPath expressions
+func (h *Handler) getCurrentChildren(obj Object) ([]Object, error) {
+	configMaps, secrets, err := h.getChildKeys(obj)
+	if err != nil {
+		return []Object{}, err
+	}
+	optionalConfigMaps, optionalSecrets, err := h.getOptionalChildKeys(obj)
+	if err != nil {
+		return []Object{}, err
+	}
 
-	// get all of ConfigMaps and Secrets
+	// get all of ConfigMaps and Secrets.
+	// Missing children that are only referenced as optional are skipped, as
+	// are children in other namespaces that can't be read
 	resultsChan := make(chan getResult)
-	for name := range configMaps {
-		go func(name string) {
-			resultsChan <- h.getConfigMap(obj.GetNamespace(), name)
-		}(name)
+	for key := range configMaps {
+		go func(key types.NamespacedName) {
+			result := skipOptional(h.getConfigMap(key.Namespace, key.Name), key, optionalConfigMaps)
+			resultsChan <- h.skipCrossNamespace(obj, "ConfigMap", key, result)
+		}(key)
 	}
-	for name := range secrets {
-		go func(name string) {
-			resultsChan <- h.getSecret(obj.GetNamespace(), name)
-		}(name)
+	for key := range secrets {
+		go func(key types.NamespacedName) {
+			result := skipOptional(h.getSecret(key.Namespace, key.Name), key, optionalSecrets)
+			resultsChan <- h.skipCrossNamespace(obj, "Secret", key, result)
+		}(key)
 	}
 
-	// Range over and collect results from the gets
+	// Range over and collect results from the gets.
+	// Every result is collected, regardless of the order the children are
+	// referenced in, so that a missing child never hides the others
 	var errs []string
 	var children []Object
+	var skipped []string
+	transient := true
 	for i := 0; i < len(configMaps)+len(secrets); i++ {
 		result := <-resultsChan
+		if result.skipped != "" {
+			skipped = append(skipped, result.skipped)
+		}
 		if result.err != nil {
 			errs = append(errs, result.err.Error())
+			transient = transient && !isPermanentChildError(result.err)
+		}
+		if result.err != nil && errors.IsNotFound(result.err) {
+			h.recorder.Eventf(obj, corev1.EventTypeWarning, "ChildNotFound", "Unable to find a child of %s %s: %v", kindOf(obj), obj.GetName(), result.err)
 		}
 		if result.obj != nil {
 			children = append(children, result.obj)
 		}
 	}
+	h.warnCrossNamespaceSkips(obj, skipped)
 
 	// If there were any errors, don't return any children
 	if len(errs) > 0 {
-		return []Object{}, fmt.Errorf("error(s) encountered when geting children: %s", strings.Join(errs, ", "))
+		return []Object{}, &childFetchError{
+			message:   fmt.Sprintf("error(s) encountered when geting children: %s", strings.Join(errs, ", ")),
+			transient: transient,
+		}
 	}
 
 	// No errors, return the list of children
 	return children, nil
 }
 
-// getChildNamesByType parses the Deployment object and returns two sets,
+// skipOptional replaces the result of getting a missing child with an empty
+// result if the child is optional
+func skipOptional(result getResult, key types.NamespacedName, optional map[types.NamespacedName]struct{}) getResult {
+	if result.err == nil || !errors.IsNotFound(result.err) {
+		return result
+	}
+	if _, ok := optional[key]; ok {
+		return getResult{}
+	}
+	return result
+}
+
+// getChildNamesByType parses the workload's PodTemplate and returns two sets,
 // the first containing the names of all referenced ConfigMaps,
-// the second containing the names of all referenced Secrets
-func getChildNamesByType(obj *appsv1.Deployment) (map[string]struct{}, map[string]struct{}) {
+// the second containing the names of all referenced Secrets.
+// Children are recorded by name alone, so a child is hashed whole even if a
+// reference only uses some of its keys, eg. the items of a volume. A child
+// referenced both whole, eg. by an envFrom, and partially is therefore always
+// hashed with every key the envFrom exposes
+func getChildNamesByType(obj Object) (map[string]struct{}, map[string]struct{}) {
 	// Create sets for storing the names fo the ConfigMaps/Secrets
 	configMaps := make(map[string]struct{})
 	secrets := make(map[string]struct{})
 
+	podSpec := getPodSpec(obj)
+
 	// Range through all Volumes and check the VolumeSources for ConfigMaps
-	// and Secrets
-	for _, vol := range obj.Spec.Template.Spec.Volumes {
+	// and Secrets. Volumes of other sources, eg. downwardAPI or emptyDir
+	// volumes, don't reference children and are skipped
+	for _, vol := range podSpec.Volumes {
 		if cm := vol.VolumeSource.ConfigMap; cm != nil {
 			configMaps[cm.Name] = struct{}{}
 		}
 		if s := vol.VolumeSource.Secret; s != nil {
 			secrets[s.SecretName] = struct{}{}
 		}
+		if projected := vol.VolumeSource.Projected; projected != nil {
+			getProjectedChildNames(projected, configMaps, secrets)
+		}
 	}
 
-	// Range through all Containers and their respective EnvFrom,
-	// then check the EnvFromSources for ConfigMaps and Secrets
-	for _, container := range obj.Spec.Template.Spec.Containers {
+	// Range through all Containers, including InitContainers, and their
+	// respective EnvFrom and Env, then check the EnvFromSources and the
+	// EnvVarSources of environment variables for ConfigMaps and Secrets
+	for _, container := range getAllContainers(podSpec) {
 		for _, env := range container.EnvFrom {
 			if cm := env.ConfigMapRef; cm != nil {
 				configMaps[cm.Name] = struct{}{}
@@ -105,11 +158,167 @@ func getChildNamesByType(obj *appsv1.Deployment) (map[string]struct{}, map[strin
 				secrets[s.Name] = struct{}{}
 			}
 		}
+		// Only the child is recorded, not the referenced key. The child is
+		// hashed in full, so a key missing from it never failed the reconcile
+		// and the hash changes once the key is added, as env_key_ref_test.go
+		// asserts
+		for _, env := range container.Env {
+			if env.ValueFrom == nil {
+				continue
+			}
+			if cm := env.ValueFrom.ConfigMapKeyRef; cm != nil {
+				configMaps[cm.Name] = struct{}{}
+			}
+			if s := env.ValueFrom.SecretKeyRef; s != nil {
+				secrets[s.Name] = struct{}{}
+			}
+		}
+	}
+
+	return configMaps, secrets
+}
+
+// getProjectedChildNames adds the names of the ConfigMaps and Secrets
+// projected into the volume to the given sets.
+// Other sources, such as the DownwardAPI, ServiceAccountTokens or sources
+// added in newer Kubernetes versions that decode with no known fields set, are
+// skipped
+func getProjectedChildNames(projected *corev1.ProjectedVolumeSource, configMaps, secrets map[string]struct{}) {
+	for _, source := range projected.Sources {
+		if cm := source.ConfigMap; cm != nil {
+			configMaps[cm.Name] = struct{}{}
+		}
+		if s := source.Secret; s != nil {
+			secrets[s.Name] = struct{}{}
+		}
+	}
+}
+
+// getChildKeysByType merges the children referenced in the workload's
+// PodTemplate with those listed in its extra children annotations and returns
+// two sets, the first containing the keys of all referenced ConfigMaps,
+// the second containing the keys of all referenced Secrets
+func getChildKeysByType(obj Object) (map[types.NamespacedName]struct{}, map[types.NamespacedName]struct{}) {
+	configMaps := make(map[types.NamespacedName]struct{})
+	secrets := make(map[types.NamespacedName]struct{})
+
+	// Children referenced in the PodTemplate are always in the workload's
+	// namespace
+	configMapNames, secretNames := getChildNamesByType(obj)
+	for name := range configMapNames {
+		configMaps[types.NamespacedName{Namespace: obj.GetNamespace(), Name: name}] = struct{}{}
+	}
+	for name := range secretNames {
+		secrets[types.NamespacedName{Namespace: obj.GetNamespace(), Name: name}] = struct{}{}
+	}
+
+	// Using sets keyed by namespace and name dedupes children referenced by
+	// both the PodTemplate and the annotations
+	annotations := obj.GetAnnotations()
+	for _, key := range parseChildKeys(obj.GetNamespace(), annotations[ExtraConfigMapsAnnotation]) {
+		configMaps[key] = struct{}{}
+	}
+	for _, key := range parseChildKeys(obj.GetNamespace(), annotations[ExtraSecretsAnnotation]) {
+		secrets[key] = struct{}{}
 	}
 
 	return configMaps, secrets
 }
 
+// getChildKeys returns the keys of all children returned by
+// getChildKeysByType merged with those yielded by the configured JSONPath
+// expressions.
+// Children of kinds whose ChildPolicy ignores them, or whose names don't match
+// the ChildNamePrefix, are not returned
+func (h *Handler) getChildKeys(obj Object) (map[types.NamespacedName]struct{}, map[types.NamespacedName]struct{}, error) {
+	configMaps, secrets := getChildKeysByType(obj)
+
+	configMapKeys, err := getChildKeysByJSONPath(obj, h.options.ExtraConfigMapPaths)
+	if err != nil {
+		return nil, nil, fmt.Errorf("error evaluating ConfigMap JSONPaths: %v", err)
+	}
+	for _, key := range configMapKeys {
+		configMaps[key] = struct{}{}
+	}
+
+	secretKeys, err := getChildKeysByJSONPath(obj, h.options.ExtraSecretPaths)
+	if err != nil {
+		return nil, nil, fmt.Errorf("error evaluating Secret JSONPaths: %v", err)
+	}
+	for _, key := range secretKeys {
+		secrets[key] = struct{}{}
+	}
+
+	pullSecretKeys, err := h.getImagePullSecretKeys(obj)
+	if err != nil {
+		return nil, nil, fmt.Errorf("error fetching image pull Secrets: %v", err)
+	}
+	for key := range pullSecretKeys {
+		secrets[key] = struct{}{}
+	}
+
+	configMaps, secrets = h.withoutIgnoredChildKeys(configMaps, secrets)
+	configMaps, secrets = withoutAnnotatedChildKeys(obj, configMaps), withoutAnnotatedChildKeys(obj, secrets)
+	return h.withChildNamePrefix(configMaps), h.withChildNamePrefix(secrets), nil
+}
+
+// withoutAnnotatedChildKeys returns the keys that aren't listed in the
+// workload's IgnoreAnnotation.
+// All keys are returned if the workload doesn't have the annotation
+func withoutAnnotatedChildKeys(obj Object, keys map[types.NamespacedName]struct{}) map[types.NamespacedName]struct{} {
+	value, ok := obj.GetAnnotations()[IgnoreAnnotation]
+	if !ok {
+		return keys
+	}
+	ignored := make(map[types.NamespacedName]struct{})
+	for _, key := range parseChildKeys(obj.GetNamespace(), value) {
+		ignored[key] = struct{}{}
+	}
+	remaining := make(map[types.NamespacedName]struct{})
+	for key := range keys {
+		if _, ok := ignored[key]; !ok {
+			remaining[key] = struct{}{}
+		}
+	}
+	return remaining
+}
+
+// withChildNamePrefix returns the keys whose names start with the
+// ChildNamePrefix.
+// All keys are returned if no ChildNamePrefix is configured
+func (h *Handler) withChildNamePrefix(keys map[types.NamespacedName]struct{}) map[types.NamespacedName]struct{} {
+	if h.options.ChildNamePrefix == "" {
+		return keys
+	}
+	matching := make(map[types.NamespacedName]struct{})
+	for key := range keys {
+		if strings.HasPrefix(key.Name, h.options.ChildNamePrefix) {
+			matching[key] = struct{}{}
+		}
+	}
+	return matching
+}
+
+// parseChildKeys parses a comma separated list of child names, each
+// optionally prefixed by a namespace.
+// Names without a namespace are assumed to be in the given namespace
+func parseChildKeys(namespace, value string) []types.NamespacedName {
+	keys := []types.NamespacedName{}
+	for _, ref := range strings.Split(value, ",") {
+		ref = strings.TrimSpace(ref)
+		if ref == "" {
+			continue
+		}
+
+		key := types.NamespacedName{Namespace: namespace, Name: ref}
+		if parts := strings.SplitN(ref, "/", 2); len(parts) == 2 {
+			key = types.NamespacedName{Namespace: parts[0], Name: parts[1]}
+		}
+		keys = append(keys, key)
+	}
+	return keys
+}
+
 // getConfigMap gets a ConfigMap with the given name and namespace from the
 // API server.
 func (h *Handler) getConfigMap(namespace, name string) getResult {
@@ -123,10 +332,25 @@ func (h *Handler) getSecret(namespace, name string) getResult {
 }
 
 // getObject gets the Object with the given name and namespace from the API
-// server
+// server.
+// With ChildReadsLive the Object is read from the LiveReader, otherwise
+// it is read from the cache. If the Object isn't found and an UncachedReader
+// is configured, the Object may be outside of the cache so it is read again
+// from the UncachedReader
 func (h *Handler) getObject(namespace, name string, obj Object) getResult {
 	key := types.NamespacedName{Namespace: namespace, Name: name}
+	if h.options.ChildReads == ChildReadsLive && h.options.LiveReader != nil {
+		err := h.options.LiveReader.Get(context.TODO(), key, obj)
+		if err != nil {
+			return getResult{err: err}
+		}
+		return getResult{obj: obj}
+	}
+
 	err := h.Get(context.TODO(), key, obj)
+	if err != nil && errors.IsNotFound(err) && h.options.UncachedReader != nil {
+		err = h.options.UncachedReader.Get(context.TODO(), key, obj)
+	}
 	if err != nil {
 		return getResult{err: err}
 	}
@@ -134,18 +358,18 @@ func (h *Handler) getObject(namespace, name string, obj Object) getResult {
 }
 
 // getExistingChildren returns a list of all Secrets and ConfigMaps that are
-// owned by the Deployment instance
-func (h *Handler) getExistingChildren(obj *appsv1.Deployment) ([]Object, error) {
+// owned by the workload instance
+func (h *Handler) getExistingChildren(obj Object) ([]Object, error) {
 	opts := client.InNamespace(obj.GetNamespace())
 
-	// List all ConfigMaps in the Deployment's namespace
+	// List all ConfigMaps in the workload's namespace
 	configMaps := &corev1.ConfigMapList{}
 	err := h.List(context.TODO(), opts, configMaps)
 	if err != nil {
 		return []Object{}, fmt.Errorf("error listing ConfigMaps: %v", err)
 	}
 
-	// List all Secrets in the Deployment's namespcae
+	// List all Secrets in the workload's namespcae
 	secrets := &corev1.SecretList{}
 	err = h.List(context.TODO(), opts, secrets)
 	if err != nil {
@@ -153,7 +377,7 @@ func (h *Handler) getExistingChildren(obj *appsv1.Deployment) ([]Object, error)
 	}
 
 	// Iterate over the ConfigMaps/Secrets and add the ones owned by the
-	// Deployment to the output list children
+	// workload to the output list children
 	children := []Object{}
 	for _, cm := range configMaps.Items {
 		if isOwnedBy(&cm, obj) {
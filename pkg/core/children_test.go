@@ -26,6 +26,7 @@ import (
 	appsv1 "k8s.io/api/apps/v1"
 	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/manager"
 )
@@ -50,7 +51,7 @@ var _ = Describe("Wave children Suite", func() {
 		mgr, err := manager.New(cfg, manager.Options{})
 		Expect(err).NotTo(HaveOccurred())
 		c = mgr.GetClient()
-		h = NewHandler(c, mgr.GetRecorder("wave"))
+		h = NewHandler(c, mgr.GetRecorder("wave"), Options{})
 		m = utils.Matcher{Client: c}
 
 		// Create some configmaps and secrets
@@ -155,6 +156,241 @@ var _ = Describe("Wave children Suite", func() {
 		})
 	})
 
+	Context("getChildNamesByType with a projected volume", func() {
+		var configMaps map[string]struct{}
+		var secrets map[string]struct{}
+
+		BeforeEach(func() {
+			cm3 := utils.ExampleConfigMap1.DeepCopy()
+			cm3.SetName("example3")
+			m.Create(cm3).Should(Succeed())
+			m.Get(cm3, timeout).Should(Succeed())
+
+			expiration := int64(3600)
+			deployment.Spec.Template.Spec.Volumes = append(deployment.Spec.Template.Spec.Volumes, corev1.Volume{
+				Name: "projected",
+				VolumeSource: corev1.VolumeSource{
+					Projected: &corev1.ProjectedVolumeSource{
+						Sources: []corev1.VolumeProjection{
+							// A source added in a newer Kubernetes version, such as a
+							// clusterTrustBundle, decodes with no known fields set
+							{},
+							{
+								ConfigMap: &corev1.ConfigMapProjection{
+									LocalObjectReference: corev1.LocalObjectReference{Name: cm3.GetName()},
+								},
+							},
+							{
+								ServiceAccountToken: &corev1.ServiceAccountTokenProjection{
+									Path:              "token",
+									ExpirationSeconds: &expiration,
+								},
+							},
+							{
+								DownwardAPI: &corev1.DownwardAPIProjection{},
+							},
+							{
+								Secret: &corev1.SecretProjection{
+									LocalObjectReference: corev1.LocalObjectReference{Name: s1.GetName()},
+								},
+							},
+						},
+					},
+				},
+			})
+
+			configMaps, secrets = getChildNamesByType(deployment)
+		})
+
+		It("returns ConfigMaps projected into the volume", func() {
+			Expect(configMaps).To(HaveKey("example3"))
+		})
+
+		It("returns Secrets projected into the volume", func() {
+			Expect(secrets).To(HaveKey(s1.GetName()))
+		})
+
+		It("skips other and unknown sources", func() {
+			Expect(configMaps).To(HaveLen(3))
+			Expect(secrets).To(HaveLen(2))
+		})
+
+		It("fetches the projected children", func() {
+			children, err := h.getCurrentChildren(deployment)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(children).To(HaveLen(5))
+		})
+	})
+
+	Context("getChildNamesByType with volumes that don't reference children", func() {
+		var configMaps map[string]struct{}
+		var secrets map[string]struct{}
+
+		BeforeEach(func() {
+			cm3 := utils.ExampleConfigMap1.DeepCopy()
+			cm3.SetName("example3")
+			m.Create(cm3).Should(Succeed())
+			m.Get(cm3, timeout).Should(Succeed())
+
+			deployment.Spec.Template.Spec.Volumes = append(deployment.Spec.Template.Spec.Volumes,
+				corev1.Volume{
+					Name: "podinfo",
+					VolumeSource: corev1.VolumeSource{
+						DownwardAPI: &corev1.DownwardAPIVolumeSource{
+							Items: []corev1.DownwardAPIVolumeFile{
+								{
+									Path:     "annotations",
+									FieldRef: &corev1.ObjectFieldSelector{FieldPath: "metadata.annotations"},
+								},
+							},
+						},
+					},
+				},
+				corev1.Volume{
+					Name: "config",
+					VolumeSource: corev1.VolumeSource{
+						ConfigMap: &corev1.ConfigMapVolumeSource{
+							LocalObjectReference: corev1.LocalObjectReference{Name: cm3.GetName()},
+						},
+					},
+				},
+				corev1.Volume{
+					Name:         "scratch",
+					VolumeSource: corev1.VolumeSource{EmptyDir: &corev1.EmptyDirVolumeSource{}},
+				},
+				// A volume of a source added in a newer Kubernetes version
+				// decodes with no known fields set
+				corev1.Volume{Name: "unknown"},
+			)
+
+			configMaps, secrets = getChildNamesByType(deployment)
+		})
+
+		It("returns the ConfigMap referenced by the ConfigMap volume", func() {
+			Expect(configMaps).To(HaveKey("example3"))
+		})
+
+		It("skips the other volumes", func() {
+			Expect(configMaps).To(HaveLen(3))
+			Expect(secrets).To(HaveLen(2))
+		})
+
+		It("fetches the referenced children without an error", func() {
+			children, err := h.getCurrentChildren(deployment)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(children).To(HaveLen(5))
+		})
+
+		It("hashes no children for the downwardAPI volume", func() {
+			deployment.SetAnnotations(map[string]string{HashVolumesAnnotation: "podinfo,config"})
+			children, err := h.getCurrentChildren(deployment)
+			Expect(err).NotTo(HaveOccurred())
+
+			hashed, err := getHashVolumeChildren(deployment, children)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(hashed).To(HaveLen(1))
+			Expect(hashed[0].GetName()).To(Equal("example3"))
+		})
+	})
+
+	Context("getChildNamesByType with an init container", func() {
+		var configMaps map[string]struct{}
+		var secrets map[string]struct{}
+
+		BeforeEach(func() {
+			deployment.Spec.Template.Spec.InitContainers = []corev1.Container{
+				{
+					Name:  "migrate",
+					Image: "migrate",
+					EnvFrom: []corev1.EnvFromSource{
+						{
+							SecretRef: &corev1.SecretEnvSource{
+								LocalObjectReference: corev1.LocalObjectReference{Name: "example3"},
+							},
+						},
+					},
+				},
+			}
+
+			configMaps, secrets = getChildNamesByType(deployment)
+		})
+
+		It("returns Secrets referenced in the init container's EnvFrom", func() {
+			Expect(secrets).To(HaveKey("example3"))
+		})
+
+		It("returns children referenced by the regular containers", func() {
+			Expect(configMaps).To(HaveLen(2))
+			Expect(secrets).To(HaveLen(3))
+		})
+	})
+
+	Context("getCurrentChildren with extra children annotations", func() {
+		var s3 *corev1.Secret
+
+		BeforeEach(func() {
+			s3 = utils.ExampleSecret1.DeepCopy()
+			s3.SetName("example3")
+			m.Create(s3).Should(Succeed())
+			m.Get(s3, timeout).Should(Succeed())
+
+			// example1 is also referenced in the PodTemplate
+			deployment.SetAnnotations(map[string]string{
+				ExtraConfigMapsAnnotation: cm1.GetName(),
+				ExtraSecretsAnnotation:    s3.GetName(),
+			})
+
+			var err error
+			children, err = h.getCurrentChildren(deployment)
+			Expect(err).NotTo(HaveOccurred())
+		})
+
+		It("returns children referenced in the annotations", func() {
+			Expect(children).To(ContainElement(s3))
+		})
+
+		It("returns children referenced in the PodTemplate", func() {
+			for _, obj := range []Object{cm1, cm2, s1, s2} {
+				Expect(children).To(ContainElement(obj))
+			}
+		})
+
+		It("does not return duplicate children", func() {
+			Expect(children).To(HaveLen(5))
+		})
+	})
+
+	Context("getChildKeysByType", func() {
+		var configMaps map[types.NamespacedName]struct{}
+		var secrets map[types.NamespacedName]struct{}
+
+		BeforeEach(func() {
+			deployment.SetAnnotations(map[string]string{
+				ExtraConfigMapsAnnotation: "example1, other/example1",
+				ExtraSecretsAnnotation:    "example3",
+			})
+			configMaps, secrets = getChildKeysByType(deployment)
+		})
+
+		It("returns children referenced in the PodTemplate in the workload's namespace", func() {
+			Expect(configMaps).To(HaveKey(types.NamespacedName{Namespace: deployment.GetNamespace(), Name: cm2.GetName()}))
+			Expect(secrets).To(HaveKey(types.NamespacedName{Namespace: deployment.GetNamespace(), Name: s2.GetName()}))
+		})
+
+		It("returns children referenced in the annotations without a namespace in the workload's namespace", func() {
+			Expect(secrets).To(HaveKey(types.NamespacedName{Namespace: deployment.GetNamespace(), Name: "example3"}))
+		})
+
+		It("returns children referenced in the annotations with a namespace in that namespace", func() {
+			Expect(configMaps).To(HaveKey(types.NamespacedName{Namespace: "other", Name: "example1"}))
+		})
+
+		It("dedupes children referenced in both the PodTemplate and the annotations", func() {
+			Expect(configMaps).To(HaveLen(3))
+			Expect(secrets).To(HaveLen(3))
+		})
+	})
+
 	Context("getExistingChildren", func() {
 		BeforeEach(func() {
 			m.Get(deployment, timeout).Should(Succeed())
@@ -0,0 +1,104 @@
+/*
+Copyright 2018 Pusher Ltd.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package core
+
+import (
+	"sync"
+
+	corev1 "k8s.io/api/core/v1"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+	logf "sigs.k8s.io/controller-runtime/pkg/runtime/log"
+)
+
+// circuitBreaker counts the consecutive reconcile failures of each workload
+// so that persistently failing workloads can be backed off.
+// Workloads are identified by kind and name, rather than UID, so that their
+// failures can be forgotten once they are no longer found
+type circuitBreaker struct {
+	lock     sync.Mutex
+	failures map[workloadKey]int
+}
+
+// newCircuitBreaker constructs a circuitBreaker with no recorded failures
+func newCircuitBreaker() *circuitBreaker {
+	return &circuitBreaker{failures: make(map[workloadKey]int)}
+}
+
+// recordFailure increments the consecutive failures of the workload and
+// returns the new count
+func (c *circuitBreaker) recordFailure(key workloadKey) int {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.failures[key]++
+	return c.failures[key]
+}
+
+// recordSuccess resets the consecutive failures of the workload and returns
+// the count before it was reset
+func (c *circuitBreaker) recordSuccess(key workloadKey) int {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	failures := c.failures[key]
+	delete(c.failures, key)
+	return failures
+}
+
+// forget removes the failures recorded for the workload, once it has been
+// cleaned up or no longer exists
+func (c *circuitBreaker) forget(key workloadKey) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	delete(c.failures, key)
+}
+
+// applyCircuitBreaker tracks the result of reconciling the workload.
+// Once the workload has failed CircuitBreakerThreshold consecutive times, the
+// error is replaced by a requeue after the CircuitBreakerBackoff so that the
+// workload no longer consumes reconcile capacity with rapid retries.
+// The circuit is closed again as soon as a reconcile succeeds
+func (h *Handler) applyCircuitBreaker(obj Object, result reconcile.Result, err error) (reconcile.Result, error) {
+	if h.options.CircuitBreakerThreshold <= 0 {
+		return result, err
+	}
+	log := logf.Log.WithName("wave")
+
+	// Children failing to fetch are backed off by applyChildRetryBackoff, so
+	// they neither count as failures nor close the circuit
+	if _, ok := err.(*childFetchError); ok && h.childRetries != nil {
+		return result, err
+	}
+
+	if err == nil {
+		if h.breaker.recordSuccess(keyForWorkload(obj)) >= h.options.CircuitBreakerThreshold {
+			log.V(0).Info("Reconcile succeeded, closing circuit breaker", "namespace", obj.GetNamespace(), "name", obj.GetName())
+			h.recorder.Eventf(obj, corev1.EventTypeNormal, "CircuitClosed", "Reconciling %s succeeded, resuming normal reconciliation", kindOf(obj))
+		}
+		return result, nil
+	}
+
+	failures := h.breaker.recordFailure(keyForWorkload(obj))
+	if failures < h.options.CircuitBreakerThreshold {
+		return result, err
+	}
+
+	// Only notify the user when the circuit is first opened
+	if failures == h.options.CircuitBreakerThreshold {
+		log.Error(err, "Reconcile failed repeatedly, opening circuit breaker", "namespace", obj.GetNamespace(), "name", obj.GetName(), "failures", failures)
+		h.recorder.Eventf(obj, corev1.EventTypeWarning, "CircuitOpen", "Reconciling %s failed %d consecutive times, retrying every %s: %v", kindOf(obj), failures, h.options.CircuitBreakerBackoff, err)
+	}
+	return reconcile.Result{RequeueAfter: h.options.CircuitBreakerBackoff}, nil
+}
@@ -0,0 +1,198 @@
+/*
+Copyright 2018 Pusher Ltd.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package core
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/pusher/wave/test/utils"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/manager"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+// rejectingClient rejects all updates to Deployments while reject is true,
+// simulating an admission webhook that always denies the update
+type rejectingClient struct {
+	client.Client
+	reject bool
+}
+
+func (r *rejectingClient) Update(ctx context.Context, obj runtime.Object) error {
+	if _, ok := obj.(*appsv1.Deployment); ok && r.reject {
+		return fmt.Errorf("update denied by admission webhook")
+	}
+	return r.Client.Update(ctx, obj)
+}
+
+var _ = Describe("Wave circuit breaker Suite", func() {
+	var c *rejectingClient
+	var h *Handler
+	var m utils.Matcher
+	var deployment *appsv1.Deployment
+	var mgrStopped *sync.WaitGroup
+	var stopMgr chan struct{}
+
+	const timeout = time.Second * 5
+	const threshold = 3
+	const backoff = time.Hour
+
+	BeforeEach(func() {
+		mgr, err := manager.New(cfg, manager.Options{})
+		Expect(err).NotTo(HaveOccurred())
+		c = &rejectingClient{Client: mgr.GetClient(), reject: true}
+		h = NewHandler(c, mgr.GetRecorder("wave"), Options{
+			CircuitBreakerThreshold: threshold,
+			CircuitBreakerBackoff:   backoff,
+		})
+		m = utils.Matcher{Client: mgr.GetClient()}
+
+		stopMgr, mgrStopped = StartTestManager(mgr)
+
+		for _, obj := range []Object{
+			utils.ExampleConfigMap1.DeepCopy(),
+			utils.ExampleConfigMap2.DeepCopy(),
+			utils.ExampleSecret1.DeepCopy(),
+			utils.ExampleSecret2.DeepCopy(),
+		} {
+			m.Create(obj).Should(Succeed())
+			m.Get(obj, timeout).Should(Succeed())
+		}
+
+		deployment = utils.ExampleDeployment.DeepCopy()
+		deployment.SetAnnotations(map[string]string{RequiredAnnotation: "true"})
+		m.Create(deployment).Should(Succeed())
+		m.Get(deployment, timeout).Should(Succeed())
+	})
+
+	AfterEach(func() {
+		// Make sure to delete the finalizer so the Deployment can be deleted
+		m.Get(deployment, timeout).Should(Succeed())
+		deployment.SetFinalizers([]string{})
+		m.Update(deployment).Should(Succeed())
+
+		close(stopMgr)
+		mgrStopped.Wait()
+
+		utils.DeleteAll(cfg, timeout,
+			&appsv1.DeploymentList{},
+			&corev1.ConfigMapList{},
+			&corev1.SecretList{},
+			&corev1.EventList{},
+		)
+	})
+
+	var eventReasons = func() []string {
+		events := &corev1.EventList{}
+		Expect(c.List(context.TODO(), &client.ListOptions{}, events)).To(Succeed())
+		reasons := []string{}
+		for _, event := range events.Items {
+			reasons = append(reasons, event.Reason)
+		}
+		return reasons
+	}
+
+	It("Returns errors until the threshold is reached", func() {
+		for i := 1; i < threshold; i++ {
+			result, err := h.HandleDeployment(deployment)
+			Expect(err).To(HaveOccurred())
+			Expect(result).To(Equal(reconcile.Result{}))
+		}
+	})
+
+	Context("When the workload fails more than the threshold", func() {
+		BeforeEach(func() {
+			for i := 1; i < threshold; i++ {
+				_, err := h.HandleDeployment(deployment)
+				Expect(err).To(HaveOccurred())
+			}
+		})
+
+		It("Backs off to the configured interval", func() {
+			for i := 0; i < 3; i++ {
+				result, err := h.HandleDeployment(deployment)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(result).To(Equal(reconcile.Result{RequeueAfter: backoff}))
+			}
+		})
+
+		It("Sends a single warning event when the circuit opens", func() {
+			for i := 0; i < 3; i++ {
+				_, err := h.HandleDeployment(deployment)
+				Expect(err).NotTo(HaveOccurred())
+			}
+
+			Eventually(eventReasons, timeout).Should(ContainElement("CircuitOpen"))
+			Consistently(func() int {
+				count := 0
+				for _, reason := range eventReasons() {
+					if reason == "CircuitOpen" {
+						count++
+					}
+				}
+				return count
+			}, time.Second).Should(Equal(1))
+		})
+
+		Context("And the workload is reconciled successfully", func() {
+			BeforeEach(func() {
+				_, err := h.HandleDeployment(deployment)
+				Expect(err).NotTo(HaveOccurred())
+
+				c.reject = false
+				result, err := h.HandleDeployment(deployment)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(result).To(Equal(reconcile.Result{}))
+			})
+
+			It("Sends an event when the circuit closes", func() {
+				Eventually(eventReasons, timeout).Should(ContainElement("CircuitClosed"))
+			})
+
+			It("Resets the consecutive failures", func() {
+				m.Get(deployment, timeout).Should(Succeed())
+				c.reject = true
+				// Make sure an update is attempted
+				deployment.Spec.Template.SetAnnotations(map[string]string{})
+				result, err := h.HandleDeployment(deployment)
+				Expect(err).To(HaveOccurred())
+				Expect(result).To(Equal(reconcile.Result{}))
+			})
+		})
+	})
+})
+
+var _ = Describe("Wave circuit breaker tracking Suite", func() {
+	It("Forgets the failures of a workload", func() {
+		breaker := newCircuitBreaker()
+		deployment := utils.ExampleDeployment.DeepCopy()
+		for i := 0; i < 3; i++ {
+			breaker.recordFailure(keyForWorkload(deployment))
+		}
+
+		breaker.forget(keyForWorkload(deployment))
+		Expect(breaker.recordFailure(keyForWorkload(deployment))).To(Equal(1))
+	})
+})
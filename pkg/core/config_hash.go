@@ -0,0 +1,150 @@
+/*
+Copyright 2018 Pusher Ltd.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package core
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// CalculateConfigHash calculates the configuration hash Wave records in the
+// ConfigHashAnnotation of the workload when its children are the ConfigMaps
+// and Secrets given, as reconciled with the default Options.
+// Children the workload doesn't reference are ignored, so the children may
+// be eg. every ConfigMap and Secret in its namespace. As when reconciling,
+// missing children only referenced as optional are hashed as absent and other
+// missing children in the workload's namespace are an error. The StringData
+// of Secrets is hashed as part of their Data, as once written to the API
+// server.
+// The API server is never read, so the hash can be calculated without a
+// running manager, eg. to check that a workload is in sync before applying it
+func CalculateConfigHash(obj Object, children []Object) (string, error) {
+	return CalculateConfigHashWithOptions(obj, children, Options{})
+}
+
+// CalculateConfigHashWithOptions calculates the configuration hash as
+// CalculateConfigHash does, as reconciled with the Options given, eg. with the
+// HashSalt, HashAlgorithm, ExtraChildKinds and KindAnnotationKeys Wave runs
+// with. Children of the ExtraChildKinds are given as Unstructured objects.
+// The readers and ChildReads of the Options are ignored, children are only
+// ever read from those given
+func CalculateConfigHashWithOptions(obj Object, children []Object, opts Options) (string, error) {
+	// Children are read from those given and events are discarded
+	opts = opts.ForKind(kindOf(obj))
+	opts.ChildReads = ChildReadsLive
+	opts.LiveReader = childListReader(children)
+	opts.UncachedReader = nil
+	opts.ChildIndex = nil
+	h := NewHandler(nil, &record.FakeRecorder{}, opts)
+
+	current, err := h.getCurrentChildren(obj)
+	if err != nil {
+		return "", fmt.Errorf("error fetching current children: %v", err)
+	}
+	extraKeys, err := h.getExtraChildKeys(obj)
+	if err != nil {
+		return "", fmt.Errorf("error fetching extra children: %v", err)
+	}
+	extra, err := h.getExtraChildren(extraKeys)
+	if err != nil {
+		return "", fmt.Errorf("error fetching extra children: %v", err)
+	}
+	configMaps, secrets, err := h.getChildKeys(obj)
+	if err != nil {
+		return "", fmt.Errorf("error fetching current children: %v", err)
+	}
+	absent, err := h.getAbsentChildren(obj, configMaps, secrets, current)
+	if err != nil {
+		return "", fmt.Errorf("error fetching optional children: %v", err)
+	}
+	hashed, err := h.selectHashedChildren(obj, current, extra, absent)
+	if err != nil {
+		return "", fmt.Errorf("error selecting hashed children: %v", err)
+	}
+	return h.configHash(obj, hashed, nil)
+}
+
+// childListReader is a client.Reader serving the ConfigMaps, Secrets and
+// Unstructured children in the list, without ever reading the API server
+type childListReader []Object
+
+// Get copies the child with the key into obj
+func (r childListReader) Get(ctx context.Context, key client.ObjectKey, obj runtime.Object) error {
+	for _, child := range r {
+		if child.GetNamespace() != key.Namespace || child.GetName() != key.Name {
+			continue
+		}
+		switch o := obj.(type) {
+		case *corev1.ConfigMap:
+			if cm, ok := child.(*corev1.ConfigMap); ok {
+				cm.DeepCopyInto(o)
+				return nil
+			}
+		case *corev1.Secret:
+			if s, ok := child.(*corev1.Secret); ok {
+				s.DeepCopyInto(o)
+				mergeStringData(o)
+				return nil
+			}
+		case *unstructured.Unstructured:
+			if u, ok := child.(*unstructured.Unstructured); ok && u.GroupVersionKind() == o.GroupVersionKind() {
+				u.DeepCopyInto(o)
+				return nil
+			}
+		}
+	}
+
+	switch o := obj.(type) {
+	case *corev1.ConfigMap:
+		return errors.NewNotFound(corev1.Resource("configmaps"), key.Name)
+	case *unstructured.Unstructured:
+		gvk := o.GroupVersionKind()
+		return errors.NewNotFound(schema.GroupResource{Group: gvk.Group, Resource: strings.ToLower(gvk.Kind)}, key.Name)
+	default:
+		return errors.NewNotFound(corev1.Resource("secrets"), key.Name)
+	}
+}
+
+// mergeStringData moves the StringData of the Secret into its Data, as the
+// API server does when the Secret is written, so that Secrets read from
+// manifests hash as they will once applied
+func mergeStringData(secret *corev1.Secret) {
+	if len(secret.StringData) == 0 {
+		return
+	}
+	if secret.Data == nil {
+		secret.Data = make(map[string][]byte)
+	}
+	for key, value := range secret.StringData {
+		secret.Data[key] = []byte(value)
+	}
+	secret.StringData = nil
+}
+
+// List is not supported, children are only ever read by key
+func (r childListReader) List(ctx context.Context, opts *client.ListOptions, list runtime.Object) error {
+	return fmt.Errorf("listing children is not supported")
+}
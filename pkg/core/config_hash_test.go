@@ -0,0 +1,136 @@
+/*
+Copyright 2018 Pusher Ltd.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package core
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/pusher/wave/test/utils"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+var _ = Describe("Wave CalculateConfigHash Suite", func() {
+	var deployment *appsv1.Deployment
+	var cm1, cm2 *corev1.ConfigMap
+	var s1, s2 *corev1.Secret
+
+	// The hash of the example children alone
+	const exampleHash = "fa2bd7afa9869023533623e10bad323fb53b713ff48521233a69aede24619525"
+
+	BeforeEach(func() {
+		deployment = utils.ExampleDeployment.DeepCopy()
+		cm1 = utils.ExampleConfigMap1.DeepCopy()
+		cm2 = utils.ExampleConfigMap2.DeepCopy()
+		s1 = utils.ExampleSecret1.DeepCopy()
+		s2 = utils.ExampleSecret2.DeepCopy()
+	})
+
+	It("calculates the hash of the example children", func() {
+		Expect(CalculateConfigHash(deployment, []Object{cm1, cm2, s1, s2})).To(Equal(exampleHash))
+	})
+
+	It("calculates the same hash whatever the order of the children", func() {
+		Expect(CalculateConfigHash(deployment, []Object{s2, cm2, s1, cm1})).To(Equal(exampleHash))
+	})
+
+	It("ignores children the workload doesn't reference", func() {
+		cm3 := utils.ExampleConfigMap1.DeepCopy()
+		cm3.SetName("example3")
+		other := utils.ExampleSecret1.DeepCopy()
+		other.SetNamespace("other")
+		Expect(CalculateConfigHash(deployment, []Object{cm1, cm2, cm3, s1, s2, other})).To(Equal(exampleHash))
+	})
+
+	It("hashes the StringData of Secrets as their Data", func() {
+		for _, s := range []*corev1.Secret{s1, s2} {
+			s.Data = map[string][]byte{}
+			for key, value := range s.StringData {
+				s.Data[key] = []byte(value)
+			}
+			s.StringData = nil
+		}
+		Expect(CalculateConfigHash(deployment, []Object{cm1, cm2, s1, s2})).To(Equal(exampleHash))
+	})
+
+	It("changes the hash when a child changes", func() {
+		cm1.Data["key1"] = "modified"
+		Expect(CalculateConfigHash(deployment, []Object{cm1, cm2, s1, s2})).NotTo(Equal(exampleHash))
+	})
+
+	It("returns an error if a referenced child is missing", func() {
+		_, err := CalculateConfigHash(deployment, []Object{cm1, cm2, s1})
+		Expect(err).To(HaveOccurred())
+		Expect(err.Error()).To(ContainSubstring("example2"))
+	})
+
+	It("applies the workload's annotations", func() {
+		deployment.SetAnnotations(map[string]string{IgnoreAnnotation: "example2"})
+		ignored, err := CalculateConfigHash(deployment, []Object{cm1, cm2, s1, s2})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(ignored).NotTo(Equal(exampleHash))
+
+		withoutExample2, err := CalculateConfigHash(deployment, []Object{cm1, s1})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(ignored).To(Equal(withoutExample2))
+	})
+
+	It("doesn't modify the children given", func() {
+		deployment.SetAnnotations(map[string]string{HashKeysAnnotation: "key1"})
+		_, err := CalculateConfigHash(deployment, []Object{cm1, cm2, s1, s2})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(cm1).To(Equal(utils.ExampleConfigMap1))
+		Expect(s1).To(Equal(utils.ExampleSecret1))
+	})
+
+	Context("With Options", func() {
+		It("calculates the default hash with the default Options", func() {
+			Expect(CalculateConfigHashWithOptions(deployment, []Object{cm1, cm2, s1, s2}, Options{})).To(Equal(exampleHash))
+		})
+
+		It("salts the hash with the HashSalt", func() {
+			salted, err := CalculateConfigHashWithOptions(deployment, []Object{cm1, cm2, s1, s2}, Options{HashSalt: "salt"})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(salted).NotTo(Equal(exampleHash))
+
+			Expect(CalculateConfigHashWithOptions(deployment, []Object{cm1, cm2, s1, s2}, Options{HashSalt: "pepper"})).NotTo(Equal(salted))
+		})
+
+		It("uses the HashAlgorithm", func() {
+			Expect(CalculateConfigHashWithOptions(deployment, []Object{cm1, cm2, s1, s2}, Options{HashAlgorithm: HashFNV})).To(HaveLen(16))
+		})
+
+		It("hashes children of the ExtraChildKinds", func() {
+			widgetKind := schema.GroupVersionKind{Group: "example.com", Version: "v1", Kind: "Widget"}
+			widget := &unstructured.Unstructured{Object: map[string]interface{}{"spec": map[string]interface{}{"size": "small"}}}
+			widget.SetGroupVersionKind(widgetKind)
+			widget.SetNamespace(deployment.GetNamespace())
+			widget.SetName("small")
+			deployment.SetAnnotations(map[string]string{ExtraChildrenAnnotation: "Widget:small"})
+			opts := Options{ExtraChildKinds: []schema.GroupVersionKind{widgetKind}}
+
+			hash, err := CalculateConfigHashWithOptions(deployment, []Object{cm1, cm2, s1, s2, widget}, opts)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(hash).NotTo(Equal(exampleHash))
+
+			_, err = CalculateConfigHashWithOptions(deployment, []Object{cm1, cm2, s1, s2}, opts)
+			Expect(err).To(HaveOccurred())
+		})
+	})
+})
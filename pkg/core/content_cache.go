@@ -0,0 +1,86 @@
+/*
+Copyright 2018 Pusher Ltd.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package core
+
+import (
+	"sync"
+
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// maxContentCacheEntries bounds the size of the contentCache.
+// Entries for deleted children are never explicitly evicted, so the cache is
+// reset once it grows beyond this size
+const maxContentCacheEntries = 10000
+
+// contentCache caches the serialized content of each child by UID so that
+// children that haven't changed aren't re-serialized on every reconcile.
+// An entry is only reused while the child's resourceVersion is unchanged
+type contentCache struct {
+	lock    sync.Mutex
+	entries map[types.UID]contentCacheEntry
+}
+
+// contentCacheEntry is the serialized content of a child at a resourceVersion
+type contentCacheEntry struct {
+	resourceVersion string
+	content         string
+}
+
+// newContentCache constructs an empty contentCache
+func newContentCache() *contentCache {
+	return &contentCache{entries: make(map[types.UID]contentCacheEntry)}
+}
+
+// get returns the cached content of the child if it was cached at the child's
+// current resourceVersion
+func (c *contentCache) get(obj Object) (string, bool) {
+	if c == nil || !isCacheable(obj) {
+		return "", false
+	}
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	entry, ok := c.entries[obj.GetUID()]
+	if !ok || entry.resourceVersion != obj.GetResourceVersion() {
+		return "", false
+	}
+	return entry.content, true
+}
+
+// set caches the content of the child at its current resourceVersion
+func (c *contentCache) set(obj Object, content string) {
+	if c == nil || !isCacheable(obj) {
+		return
+	}
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	if _, ok := c.entries[obj.GetUID()]; !ok && len(c.entries) >= maxContentCacheEntries {
+		c.entries = make(map[types.UID]contentCacheEntry)
+	}
+	c.entries[obj.GetUID()] = contentCacheEntry{
+		resourceVersion: obj.GetResourceVersion(),
+		content:         content,
+	}
+}
+
+// isCacheable checks whether the object has been read from the API server, as
+// only then do its UID and resourceVersion identify its content
+func isCacheable(obj Object) bool {
+	return obj.GetUID() != "" && obj.GetResourceVersion() != ""
+}
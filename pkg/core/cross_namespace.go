@@ -0,0 +1,110 @@
+/*
+Copyright 2018 Pusher Ltd.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package core
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// skipCrossNamespace replaces the result of getting a child outside of the
+// workload's namespace with an empty result if the child can't be found or
+// Wave isn't allowed to read it, so that a mistaken reference to another
+// namespace doesn't fail the whole reconcile.
+// The empty result explains why the child was skipped, so that a Warning can
+// be sent on the workload. The child remains indexed, so the workload is
+// reconciled again once it is created
+func (h *Handler) skipCrossNamespace(obj Object, kind string, key types.NamespacedName, result getResult) getResult {
+	if result.err == nil || key.Namespace == obj.GetNamespace() {
+		return result
+	}
+	if !errors.IsNotFound(result.err) && !errors.IsForbidden(result.err) {
+		return result
+	}
+	return getResult{
+		skipped: fmt.Sprintf("%s %s/%s is outside of the namespace of %s %s and can't be tracked, skipping it: %v", kind, key.Namespace, key.Name, kindOf(obj), obj.GetName(), result.err),
+	}
+}
+
+// warnCrossNamespaceSkips sends a CrossNamespaceChild Warning on the workload
+// for each child skipped by skipCrossNamespace.
+// The Warnings are only sent once per generation of the workload, or when the
+// skipped children change, rather than on every reconcile
+func (h *Handler) warnCrossNamespaceSkips(obj Object, skipped []string) {
+	if !h.crossNamespaceSkips.changed(obj, skipped) {
+		return
+	}
+	for _, message := range skipped {
+		h.recorder.Event(obj, corev1.EventTypeWarning, "CrossNamespaceChild", message)
+	}
+}
+
+// crossNamespaceSkipTracker records, by workload UID, the children skipped by
+// skipCrossNamespace that were last reported and the generation of the
+// workload they were reported for
+type crossNamespaceSkipTracker struct {
+	lock    sync.Mutex
+	reports map[types.UID]crossNamespaceSkipReport
+}
+
+// crossNamespaceSkipReport is the report recorded for a workload in the
+// crossNamespaceSkipTracker
+type crossNamespaceSkipReport struct {
+	generation int64
+	skipped    string
+}
+
+// newCrossNamespaceSkipTracker constructs a crossNamespaceSkipTracker with no
+// recorded reports
+func newCrossNamespaceSkipTracker() *crossNamespaceSkipTracker {
+	return &crossNamespaceSkipTracker{reports: make(map[types.UID]crossNamespaceSkipReport)}
+}
+
+// changed records the children currently skipped for the workload, returning
+// true if they, or the generation of the workload, differ from those last
+// recorded.
+// Once no children are skipped the workload's report is forgotten
+func (c *crossNamespaceSkipTracker) changed(owner Object, skipped []string) bool {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if len(skipped) == 0 {
+		delete(c.reports, owner.GetUID())
+		return false
+	}
+
+	sorted := append([]string{}, skipped...)
+	sort.Strings(sorted)
+	report := crossNamespaceSkipReport{generation: owner.GetGeneration(), skipped: strings.Join(sorted, "\n")}
+	if previous, ok := c.reports[owner.GetUID()]; ok && previous == report {
+		return false
+	}
+	c.reports[owner.GetUID()] = report
+	return true
+}
+
+// forget removes the report recorded for the workload, once it is deleted
+func (c *crossNamespaceSkipTracker) forget(uid types.UID) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	delete(c.reports, uid)
+}
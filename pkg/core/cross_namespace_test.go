@@ -0,0 +1,55 @@
+/*
+Copyright 2018 Pusher Ltd.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package core
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/pusher/wave/test/utils"
+	appsv1 "k8s.io/api/apps/v1"
+)
+
+var _ = Describe("Wave cross namespace skip tracking Suite", func() {
+	var tracker *crossNamespaceSkipTracker
+	var deployment *appsv1.Deployment
+
+	BeforeEach(func() {
+		tracker = newCrossNamespaceSkipTracker()
+		deployment = utils.ExampleDeployment.DeepCopy()
+		deployment.SetUID("deployment-uid")
+		deployment.SetGeneration(1)
+		Expect(tracker.changed(deployment, []string{"Secret other/example1", "ConfigMap other/example1"})).To(BeTrue())
+	})
+
+	It("Doesn't report the same skipped children again", func() {
+		Expect(tracker.changed(deployment, []string{"ConfigMap other/example1", "Secret other/example1"})).To(BeFalse())
+	})
+
+	It("Reports the skipped children again for a new generation", func() {
+		deployment.SetGeneration(2)
+		Expect(tracker.changed(deployment, []string{"Secret other/example1", "ConfigMap other/example1"})).To(BeTrue())
+	})
+
+	It("Reports the skipped children again once they change", func() {
+		Expect(tracker.changed(deployment, []string{"Secret other/example1"})).To(BeTrue())
+	})
+
+	It("Reports the skipped children again after none were skipped", func() {
+		Expect(tracker.changed(deployment, []string{})).To(BeFalse())
+		Expect(tracker.changed(deployment, []string{"Secret other/example1", "ConfigMap other/example1"})).To(BeTrue())
+	})
+})
@@ -21,20 +21,28 @@ import (
 	"fmt"
 	"reflect"
 
-	appsv1 "k8s.io/api/apps/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"sigs.k8s.io/controller-runtime/pkg/reconcile"
 )
 
-// handleDelete removes all existing Owner References pointing to the object
-// before removing the object's Finalizer
-func (h *Handler) handleDelete(obj *appsv1.Deployment) (reconcile.Result, error) {
+// handleDelete removes the object from the ChildIndex and removes all existing
+// Owner References pointing to the object before removing the object's
+// Finalizer.
+// In dry run mode the cleanup is reported rather than performed
+func (h *Handler) handleDelete(obj Object) (reconcile.Result, error) {
+	h.forgetWorkload(obj)
+
 	// Fetch all children with an OwnerReference pointing to the object
 	existing, err := h.getExistingChildren(obj)
 	if err != nil {
 		return reconcile.Result{}, fmt.Errorf("error fetching children: %v", err)
 	}
 
+	if h.options.DryRun {
+		h.reportDryRunDelete(obj, existing)
+		return reconcile.Result{}, nil
+	}
+
 	// Remove the OwnerReferences from the children
 	err = h.removeOwnerReferences(obj, existing)
 	if err != nil {
@@ -42,17 +50,53 @@ func (h *Handler) handleDelete(obj *appsv1.Deployment) (reconcile.Result, error)
 	}
 
 	// Remove the object's Finalizer and update if necessary
-	copy := obj.DeepCopy()
-	removeFinalizer(copy)
+	copy := obj.DeepCopyObject().(Object)
+	removeFinalizer(copy, h.options.Finalizer)
 	if !reflect.DeepEqual(obj, copy) {
 		err := h.Update(context.TODO(), copy)
 		if err != nil {
-			return reconcile.Result{}, fmt.Errorf("error updating Deployment: %v", err)
+			return reconcile.Result{}, fmt.Errorf("error updating %s: %v", kindOf(obj), err)
 		}
 	}
 	return reconcile.Result{}, nil
 }
 
+// wasManaged checks whether Wave has managed the object, either because it has
+// the finalizer or because any children have an OwnerReference pointing to it.
+// If the object was disabled while it was being reconciled, the children may
+// have been updated without the finalizer being added, so both are checked to
+// make sure that the object is always cleaned up fully.
+// Children are only listed if the object bears another trace of Wave, so that
+// workloads Wave never managed don't cost a List of their namespace's children
+func (h *Handler) wasManaged(obj Object) (bool, error) {
+	if hasFinalizer(obj, h.options.Finalizer) {
+		return true, nil
+	}
+	if !h.hasManagementTrace(obj) {
+		return false, nil
+	}
+	existing, err := h.getExistingChildren(obj)
+	if err != nil {
+		return false, err
+	}
+	return len(existing) > 0, nil
+}
+
+// hasManagementTrace checks whether Wave may have added OwnerReferences for
+// the object without adding its finalizer: the object is in the ChildIndex,
+// which is updated before any child, or it carries a configuration hash or
+// the InstanceAnnotation, which skip-finalizer workloads and those adopted
+// before a restart still have
+func (h *Handler) hasManagementTrace(obj Object) bool {
+	if h.options.ChildIndex.contains(obj) {
+		return true
+	}
+	if _, ok := obj.GetAnnotations()[InstanceAnnotation]; ok {
+		return true
+	}
+	return recordedConfigHash(obj, h.options.ConfigHashAnnotation) != ""
+}
+
 // toBeDeleted checks whether the object has been marked for deletion
 func toBeDeleted(obj metav1.Object) bool {
 	// IsZero means that the object hasn't been marked for deletion
@@ -32,6 +32,7 @@ import (
 	"k8s.io/apimachinery/pkg/types"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/manager"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
 )
 
 var _ = Describe("Wave owner references Suite", func() {
@@ -50,7 +51,7 @@ var _ = Describe("Wave owner references Suite", func() {
 		mgr, err := manager.New(cfg, manager.Options{})
 		Expect(err).NotTo(HaveOccurred())
 		c = mgr.GetClient()
-		h = NewHandler(c, mgr.GetRecorder("wave"))
+		h = NewHandler(c, mgr.GetRecorder("wave"), Options{})
 		m = utils.Matcher{Client: c}
 
 		// Create some configmaps and secrets
@@ -163,3 +164,52 @@ var _ = Describe("Wave owner references Suite", func() {
 	})
 
 })
+
+var _ = Describe("Wave wasManaged Suite", func() {
+	var h *Handler
+	var index *ChildIndex
+	var deployment *appsv1.Deployment
+
+	BeforeEach(func() {
+		index = NewChildIndex()
+		// Without a client, listing children would panic
+		h = NewHandler(nil, nil, Options{ChildIndex: index})
+		deployment = utils.ExampleDeployment.DeepCopy()
+	})
+
+	It("doesn't list children for a workload without a trace of Wave", func() {
+		Expect(h.wasManaged(deployment)).To(BeFalse())
+	})
+
+	It("returns true for a workload with the finalizer", func() {
+		deployment.SetFinalizers([]string{FinalizerString})
+		Expect(h.wasManaged(deployment)).To(BeTrue())
+	})
+
+	It("detects the traces Wave leaves on a workload", func() {
+		Expect(h.hasManagementTrace(deployment)).To(BeFalse())
+
+		index.update(deployment, nil, nil)
+		Expect(h.hasManagementTrace(deployment)).To(BeTrue())
+		index.remove(deployment)
+
+		deployment.Spec.Template.SetAnnotations(map[string]string{ConfigHashAnnotation: "hash"})
+		Expect(h.hasManagementTrace(deployment)).To(BeTrue())
+		deployment.Spec.Template.SetAnnotations(nil)
+
+		deployment.SetAnnotations(map[string]string{InstanceAnnotation: "blue"})
+		Expect(h.hasManagementTrace(deployment)).To(BeTrue())
+	})
+
+	It("doesn't list children for a ReplicaSet owned by a Deployment", func() {
+		t := true
+		ref := utils.GetOwnerRef(deployment)
+		ref.Controller = &t
+		rs := utils.ExampleReplicaSet.DeepCopy()
+		rs.SetOwnerReferences([]metav1.OwnerReference{ref})
+		// ReplicaSets inherit the config hash of their Deployment
+		rs.Spec.Template.SetAnnotations(map[string]string{ConfigHashAnnotation: "hash"})
+
+		Expect(h.handlePodController(rs)).To(Equal(reconcile.Result{}))
+	})
+})
@@ -0,0 +1,103 @@
+/*
+Copyright 2018 Pusher Ltd.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package core
+
+import (
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	logf "sigs.k8s.io/controller-runtime/pkg/runtime/log"
+)
+
+// reportDryRun describes the configuration hash change Wave would make to the
+// workload, and the children that drove it, in a DryRun event and the log.
+// Nothing is reported if the hash recorded on the workload is up to date.
+// Children are only named if they changed since the workload was last
+// reconciled, or if no hash has been recorded yet
+func (h *Handler) reportDryRun(instance Object, hash string, current, changed []Object) {
+	log := logf.Log.WithName("wave")
+
+	recorded := recordedConfigHash(instance, h.options.ConfigHashAnnotation)
+	if hash == recorded {
+		return
+	}
+
+	drivers := changed
+	if recorded == "" {
+		drivers = current
+	}
+	names := waveStatusChildren(drivers)
+
+	log.V(0).Info("Dry run, not updating instance hash", "namespace", instance.GetNamespace(), "name", instance.GetName(), "oldHash", recorded, "newHash", hash, "children", names)
+	if len(names) == 0 {
+		h.recorder.Eventf(instance, corev1.EventTypeNormal, "DryRun", "Dry run: would update configuration hash from %q to %q", recorded, hash)
+		return
+	}
+	h.recorder.Eventf(instance, corev1.EventTypeNormal, "DryRun", "Dry run: would update configuration hash from %q to %q, changed children: %s", recorded, hash, strings.Join(names, ", "))
+}
+
+// reportDryRunOwnerReferences describes the OwnerReferences Wave would add to
+// the owned children and remove from the orphaned children in DryRun events
+// and the log
+func (h *Handler) reportDryRunOwnerReferences(owner Object, owned, orphans []Object) {
+	log := logf.Log.WithName("wave")
+
+	// Children that have reached the MaxOwnerReferences would be left alone
+	ownerRef := h.ownerReference(owner)
+	limit := h.options.MaxOwnerReferences
+	adding := []Object{}
+	for _, child := range owned {
+		if hasOwnerReference(child, ownerRef) || (limit > 0 && len(child.GetOwnerReferences()) >= limit) {
+			continue
+		}
+		adding = append(adding, child)
+	}
+
+	if len(adding) > 0 {
+		names := waveStatusChildren(adding)
+		log.V(0).Info("Dry run, not adding OwnerReferences", "namespace", owner.GetNamespace(), "name", owner.GetName(), "children", names)
+		h.recorder.Eventf(owner, corev1.EventTypeNormal, "DryRun", "Dry run: would add OwnerReferences to %s", strings.Join(names, ", "))
+	}
+
+	removing := []Object{}
+	for _, child := range orphans {
+		for _, ref := range child.GetOwnerReferences() {
+			if ref.UID == owner.GetUID() {
+				removing = append(removing, child)
+				break
+			}
+		}
+	}
+
+	if len(removing) > 0 {
+		names := waveStatusChildren(removing)
+		log.V(0).Info("Dry run, not removing OwnerReferences", "namespace", owner.GetNamespace(), "name", owner.GetName(), "children", names)
+		h.recorder.Eventf(owner, corev1.EventTypeNormal, "DryRun", "Dry run: would remove OwnerReferences from %s", strings.Join(names, ", "))
+	}
+}
+
+// reportDryRunDelete describes the cleanup Wave would perform on a workload
+// it no longer manages in DryRun events and the log
+func (h *Handler) reportDryRunDelete(obj Object, existing []Object) {
+	log := logf.Log.WithName("wave")
+
+	h.reportDryRunOwnerReferences(obj, []Object{}, existing)
+	if hasFinalizer(obj, h.options.Finalizer) {
+		log.V(0).Info("Dry run, not removing finalizer", "namespace", obj.GetNamespace(), "name", obj.GetName(), "finalizer", h.options.Finalizer)
+		h.recorder.Eventf(obj, corev1.EventTypeNormal, "DryRun", "Dry run: would remove finalizer %s", h.options.Finalizer)
+	}
+}
@@ -0,0 +1,94 @@
+/*
+Copyright 2018 Pusher Ltd.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package core
+
+import (
+	"sync"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+	logf "sigs.k8s.io/controller-runtime/pkg/runtime/log"
+)
+
+// secretDataCache records the data each Secret was last read with, by UID, so
+// that Secrets read without their data can be hashed consistently.
+// It is reset once it grows beyond maxContentCacheEntries
+type secretDataCache struct {
+	lock    sync.Mutex
+	entries map[types.UID]map[string][]byte
+}
+
+// newSecretDataCache constructs an empty secretDataCache
+func newSecretDataCache() *secretDataCache {
+	return &secretDataCache{entries: make(map[types.UID]map[string][]byte)}
+}
+
+// get returns the data the Secret was last read with
+func (c *secretDataCache) get(secret *corev1.Secret) (map[string][]byte, bool) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	data, ok := c.entries[secret.GetUID()]
+	return data, ok
+}
+
+// set records the data the Secret was read with
+func (c *secretDataCache) set(secret *corev1.Secret) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	if _, ok := c.entries[secret.GetUID()]; !ok && len(c.entries) >= maxContentCacheEntries {
+		c.entries = make(map[types.UID]map[string][]byte)
+	}
+	c.entries[secret.GetUID()] = secret.Data
+}
+
+// withLastSecretData returns the children with each Secret read without any
+// data replaced by a copy holding the data it was last read with, when the
+// EmptySecretPolicy is EmptySecretKeepLast.
+// The copies are only hashed, they are never written back to the API server
+func (h *Handler) withLastSecretData(children []Object) []Object {
+	if h.options.EmptySecretPolicy != EmptySecretKeepLast {
+		return children
+	}
+	log := logf.Log.WithName("wave")
+
+	hashed := make([]Object, 0, len(children))
+	for _, child := range children {
+		secret, ok := child.(*corev1.Secret)
+		if !ok || secret.GetUID() == "" {
+			hashed = append(hashed, child)
+			continue
+		}
+		if len(secret.Data) > 0 || len(secret.StringData) > 0 {
+			h.secretData.set(secret)
+			hashed = append(hashed, child)
+			continue
+		}
+
+		data, ok := h.secretData.get(secret)
+		if !ok {
+			hashed = append(hashed, child)
+			continue
+		}
+		log.V(1).Info("Secret read without data, hashing the data it was last read with", "namespace", secret.GetNamespace(), "name", secret.GetName())
+		copy := secret.DeepCopy()
+		copy.Data = data
+		hashed = append(hashed, copy)
+	}
+	return hashed
+}
@@ -0,0 +1,43 @@
+/*
+Copyright 2018 Pusher Ltd.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package core
+
+import (
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/validation"
+)
+
+// warnInvalidEnvFromPrefixes sends a Warning event on the workload for each
+// envFrom source in its containers and init containers whose prefix isn't a
+// valid environment variable name, eg. because it contains unrendered template
+// markers.
+// The children of such sources are still hashed as normal
+func (h *Handler) warnInvalidEnvFromPrefixes(obj Object) {
+	podSpec := getPodSpec(obj)
+	for _, container := range getAllContainers(podSpec) {
+		for _, env := range container.EnvFrom {
+			if env.Prefix == "" {
+				continue
+			}
+			if errs := validation.IsEnvVarName(env.Prefix); len(errs) > 0 {
+				h.recorder.Eventf(obj, corev1.EventTypeWarning, "InvalidEnvFromPrefix", "Container %s has an envFrom source with invalid prefix %q: %s", container.Name, env.Prefix, strings.Join(errs, ", "))
+			}
+		}
+	}
+}
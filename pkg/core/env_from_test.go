@@ -0,0 +1,69 @@
+/*
+Copyright 2018 Pusher Ltd.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package core
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/pusher/wave/test/utils"
+	appsv1 "k8s.io/api/apps/v1"
+	"k8s.io/client-go/tools/record"
+)
+
+var _ = Describe("Wave envFrom prefix Suite", func() {
+	var h *Handler
+	var recorder *record.FakeRecorder
+	var deployment *appsv1.Deployment
+
+	BeforeEach(func() {
+		recorder = record.NewFakeRecorder(10)
+		h = NewHandler(nil, recorder, Options{})
+		deployment = utils.ExampleDeployment.DeepCopy()
+	})
+
+	It("doesn't send an event for a valid prefix", func() {
+		deployment.Spec.Template.Spec.Containers[0].EnvFrom[0].Prefix = "EXAMPLE_"
+		h.warnInvalidEnvFromPrefixes(deployment)
+		Expect(recorder.Events).NotTo(Receive())
+	})
+
+	Context("with an invalid prefix", func() {
+		BeforeEach(func() {
+			deployment.Spec.Template.Spec.Containers[0].EnvFrom[0].Prefix = "{{ .Prefix }}_"
+		})
+
+		It("sends a Warning event naming the container and prefix", func() {
+			h.warnInvalidEnvFromPrefixes(deployment)
+
+			var event string
+			Expect(recorder.Events).To(Receive(&event))
+			Expect(event).To(HavePrefix("Warning InvalidEnvFromPrefix Container container1 has an envFrom source with invalid prefix \"{{ .Prefix }}_\""))
+			Expect(recorder.Events).NotTo(Receive())
+		})
+
+		It("still hashes the child of the source", func() {
+			configMaps, secrets := getChildNamesByType(deployment)
+			Expect(configMaps).To(HaveKey("example1"))
+
+			// The prefix is part of the PodTemplate, the same children are hashed
+			// with or without it
+			exampleConfigMaps, exampleSecrets := getChildNamesByType(utils.ExampleDeployment)
+			Expect(configMaps).To(Equal(exampleConfigMaps))
+			Expect(secrets).To(Equal(exampleSecrets))
+		})
+	})
+})
@@ -0,0 +1,146 @@
+/*
+Copyright 2018 Pusher Ltd.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package core
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// reconcileSummary collects the notable actions taken while reconciling a
+// workload, so that they can be reported in a single event
+type reconcileSummary struct {
+	notes   []string
+	added   []string
+	removed []string
+
+	// failure is the error the reconcile failed with, if any
+	failure error
+}
+
+// message describes the actions in the summary, eg.
+// "Configuration hash updated to X; added watches for ConfigMap a".
+// The message is empty if no actions were taken
+func (s *reconcileSummary) message() string {
+	parts := append([]string{}, s.notes...)
+	if len(s.added) > 0 {
+		sort.Strings(s.added)
+		parts = append(parts, "added watches for "+strings.Join(s.added, ", "))
+	}
+	if len(s.removed) > 0 {
+		sort.Strings(s.removed)
+		parts = append(parts, "removed watches for "+strings.Join(s.removed, ", "))
+	}
+	if s.failure != nil {
+		parts = append(parts, fmt.Sprintf("reconcile failed: %v", s.failure))
+	}
+	message := strings.Join(parts, "; ")
+	if message == "" {
+		return ""
+	}
+	return strings.ToUpper(message[:1]) + message[1:]
+}
+
+// reconcileSummaries records the reconcileSummary of each running reconcile
+// by workload UID
+type reconcileSummaries struct {
+	lock      sync.Mutex
+	summaries map[types.UID]*reconcileSummary
+}
+
+// newReconcileSummaries constructs an empty reconcileSummaries
+func newReconcileSummaries() *reconcileSummaries {
+	return &reconcileSummaries{summaries: make(map[types.UID]*reconcileSummary)}
+}
+
+// start begins collecting the actions of a reconcile of the workload
+func (r *reconcileSummaries) start(uid types.UID) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.summaries[uid] = &reconcileSummary{}
+}
+
+// finish stops collecting the actions of a reconcile of the workload and
+// returns its summary
+func (r *reconcileSummaries) finish(uid types.UID) *reconcileSummary {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	summary := r.summaries[uid]
+	delete(r.summaries, uid)
+	return summary
+}
+
+// forget removes the summary of the workload, once it is deleted
+func (r *reconcileSummaries) forget(uid types.UID) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	delete(r.summaries, uid)
+}
+
+// record applies fn to the summary of the workload's running reconcile,
+// returning false if no summary is being collected for it
+func (r *reconcileSummaries) record(uid types.UID, fn func(*reconcileSummary)) bool {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	summary, ok := r.summaries[uid]
+	if ok {
+		fn(summary)
+	}
+	return ok
+}
+
+// summarize records an action on the owner's reconcile summary when
+// AggregateEvents is enabled, returning true if it did so and the action's own
+// event should not be sent
+func (h *Handler) summarize(owner Object, fn func(*reconcileSummary)) bool {
+	if !h.options.AggregateEvents {
+		return false
+	}
+	return h.summaries.record(owner.GetUID(), fn)
+}
+
+// sendWorkloadEvent sends a Normal event on the workload, or records its
+// message on the workload's reconcile summary when AggregateEvents is enabled
+func (h *Handler) sendWorkloadEvent(instance Object, reason, message string) {
+	if !h.summarize(instance, func(s *reconcileSummary) { s.notes = append(s.notes, message) }) {
+		h.recorder.Event(instance, corev1.EventTypeNormal, reason, message)
+	}
+}
+
+// sendSummaryEvent sends a single event on the workload describing the
+// actions taken while reconciling it: a Reconciled event, or a ReconcileFailed
+// Warning naming the error if the reconcile failed.
+// No event is sent if the reconcile succeeded without taking any actions
+func (h *Handler) sendSummaryEvent(instance Object, reconcileErr error) {
+	summary := h.summaries.finish(instance.GetUID())
+	if summary == nil {
+		return
+	}
+	if reconcileErr != nil {
+		summary.failure = reconcileErr
+		h.recorder.Event(instance, corev1.EventTypeWarning, "ReconcileFailed", summary.message())
+		return
+	}
+	if message := summary.message(); message != "" {
+		h.recorder.Event(instance, corev1.EventTypeNormal, "Reconciled", message)
+	}
+}
@@ -0,0 +1,114 @@
+/*
+Copyright 2018 Pusher Ltd.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package core
+
+import (
+	"fmt"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// ParseChildKind parses a kind of child given as "Kind.version.group"
+// (eg. "Certificate.v1alpha1.certmanager.k8s.io")
+func ParseChildKind(arg string) (schema.GroupVersionKind, error) {
+	gvk, _ := schema.ParseKindArg(arg)
+	if gvk == nil || gvk.Kind == "" || gvk.Version == "" || gvk.Group == "" {
+		return schema.GroupVersionKind{}, fmt.Errorf("invalid kind %q, expected Kind.version.group", arg)
+	}
+	return *gvk, nil
+}
+
+// getExtraChildKeys parses the workload's ExtraChildrenAnnotation and returns
+// the keys of the children it lists, grouped by their kind.
+// Every kind listed must be one of the configured ExtraChildKinds
+func (h *Handler) getExtraChildKeys(obj Object) (map[schema.GroupVersionKind]map[types.NamespacedName]struct{}, error) {
+	keys := make(map[schema.GroupVersionKind]map[types.NamespacedName]struct{})
+
+	for _, ref := range strings.Split(obj.GetAnnotations()[ExtraChildrenAnnotation], ",") {
+		ref = strings.TrimSpace(ref)
+		if ref == "" {
+			continue
+		}
+
+		parts := strings.SplitN(ref, ":", 2)
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("invalid child %q in %s annotation, expected Kind:name", ref, ExtraChildrenAnnotation)
+		}
+		gvk, ok := h.extraChildKind(parts[0])
+		if !ok {
+			return nil, fmt.Errorf("unknown kind %q in %s annotation", parts[0], ExtraChildrenAnnotation)
+		}
+
+		if _, ok := keys[gvk]; !ok {
+			keys[gvk] = make(map[types.NamespacedName]struct{})
+		}
+		for _, key := range parseChildKeys(obj.GetNamespace(), parts[1]) {
+			keys[gvk][key] = struct{}{}
+		}
+	}
+
+	return keys, nil
+}
+
+// extraChildKind returns the configured ExtraChildKind with the given kind
+func (h *Handler) extraChildKind(kind string) (schema.GroupVersionKind, bool) {
+	for _, gvk := range h.options.ExtraChildKinds {
+		if gvk.Kind == kind {
+			return gvk, true
+		}
+	}
+	return schema.GroupVersionKind{}, false
+}
+
+// getExtraChildren gets each of the children with the given keys
+func (h *Handler) getExtraChildren(keys map[schema.GroupVersionKind]map[types.NamespacedName]struct{}) ([]Object, error) {
+	resultsChan := make(chan getResult)
+	count := 0
+	for gvk, names := range keys {
+		for key := range names {
+			count++
+			go func(gvk schema.GroupVersionKind, key types.NamespacedName) {
+				child := &unstructured.Unstructured{}
+				child.SetGroupVersionKind(gvk)
+				resultsChan <- h.getObject(key.Namespace, key.Name, child)
+			}(gvk, key)
+		}
+	}
+
+	// Range over and collect results from the gets
+	var errs []string
+	var children []Object
+	for i := 0; i < count; i++ {
+		result := <-resultsChan
+		if result.err != nil {
+			errs = append(errs, result.err.Error())
+		}
+		if result.obj != nil {
+			children = append(children, result.obj)
+		}
+	}
+
+	// If there were any errors, don't return any children
+	if len(errs) > 0 {
+		return []Object{}, fmt.Errorf("error(s) encountered when geting extra children: %s", strings.Join(errs, ", "))
+	}
+
+	return children, nil
+}
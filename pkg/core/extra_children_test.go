@@ -0,0 +1,94 @@
+/*
+Copyright 2018 Pusher Ltd.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package core
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/pusher/wave/test/utils"
+	appsv1 "k8s.io/api/apps/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+var _ = Describe("Wave extra children Suite", func() {
+	var widgetKind = schema.GroupVersionKind{Group: "test.wave.pusher.com", Version: "v1alpha1", Kind: "Widget"}
+
+	Context("ParseChildKind", func() {
+		It("parses a kind with its version and group", func() {
+			Expect(ParseChildKind("Widget.v1alpha1.test.wave.pusher.com")).To(Equal(widgetKind))
+		})
+
+		It("rejects a kind without a group", func() {
+			_, err := ParseChildKind("Widget.v1alpha1")
+			Expect(err).To(HaveOccurred())
+		})
+
+		It("rejects a bare kind", func() {
+			_, err := ParseChildKind("Widget")
+			Expect(err).To(HaveOccurred())
+		})
+	})
+
+	Context("getExtraChildKeys", func() {
+		var h *Handler
+		var deployment *appsv1.Deployment
+
+		BeforeEach(func() {
+			h = NewHandler(nil, nil, Options{ExtraChildKinds: []schema.GroupVersionKind{widgetKind}})
+			deployment = utils.ExampleDeployment.DeepCopy()
+		})
+
+		It("returns no children without the annotation", func() {
+			keys, err := h.getExtraChildKeys(deployment)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(keys).To(BeEmpty())
+		})
+
+		It("returns the children listed in the annotation by kind", func() {
+			deployment.SetAnnotations(map[string]string{
+				ExtraChildrenAnnotation: "Widget:small, Widget:other/large,Widget:small",
+			})
+
+			keys, err := h.getExtraChildKeys(deployment)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(keys).To(HaveLen(1))
+			Expect(keys[widgetKind]).To(Equal(map[types.NamespacedName]struct{}{
+				{Namespace: deployment.GetNamespace(), Name: "small"}: {},
+				{Namespace: "other", Name: "large"}:                   {},
+			}))
+		})
+
+		It("returns an error for a kind that isn't configured", func() {
+			deployment.SetAnnotations(map[string]string{
+				ExtraChildrenAnnotation: "Gadget:small",
+			})
+
+			_, err := h.getExtraChildKeys(deployment)
+			Expect(err).To(HaveOccurred())
+		})
+
+		It("returns an error for a child without a kind", func() {
+			deployment.SetAnnotations(map[string]string{
+				ExtraChildrenAnnotation: "small",
+			})
+
+			_, err := h.getExtraChildKeys(deployment)
+			Expect(err).To(HaveOccurred())
+		})
+	})
+})
@@ -17,32 +17,63 @@ limitations under the License.
 package core
 
 import (
-	appsv1 "k8s.io/api/apps/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 )
 
-// addFinalizer adds the wave finalizer to the given Deployment
-func addFinalizer(obj *appsv1.Deployment) {
+// addFinalizer adds the wave finalizer to the given object
+func addFinalizer(obj metav1.Object, finalizerString string) {
 	finalizers := obj.GetFinalizers()
 	for _, finalizer := range finalizers {
-		if finalizer == FinalizerString {
-			// Deployment already contains the finalizer
+		if finalizer == finalizerString {
+			// Object already contains the finalizer
 			return
 		}
 	}
 
-	//Deployment doens't contain the finalizer, so add it
-	finalizers = append(finalizers, FinalizerString)
+	//Object doens't contain the finalizer, so add it
+	finalizers = append(finalizers, finalizerString)
 	obj.SetFinalizers(finalizers)
 }
 
-// removeFinalizer removes the wave finalizer from the given Deployment
-func removeFinalizer(obj *appsv1.Deployment) {
+// updateFinalizer adds the wave finalizer to the given object, or removes it
+// if the object has the SkipFinalizerAnnotation
+func updateFinalizer(obj metav1.Object, finalizerString string) {
+	if skipsFinalizer(obj) {
+		removeFinalizer(obj, finalizerString)
+		return
+	}
+	addFinalizer(obj, finalizerString)
+}
+
+// manageFinalizer updates the Finalizer on the given object, removing it from
+// every object if DisableFinalizer is set
+func (h *Handler) manageFinalizer(obj metav1.Object) {
+	if h.options.DisableFinalizer {
+		removeFinalizer(obj, h.options.Finalizer)
+		return
+	}
+	updateFinalizer(obj, h.options.Finalizer)
+}
+
+// skipsFinalizer checks whether the object has the SkipFinalizerAnnotation
+// set to "true"
+func skipsFinalizer(obj metav1.Object) bool {
+	return obj.GetAnnotations()[SkipFinalizerAnnotation] == "true"
+}
+
+// removeFinalizer removes the wave finalizer from the given object.
+// Objects without the finalizer are left untouched, so that they don't appear
+// to have changed
+func removeFinalizer(obj metav1.Object, finalizerString string) {
+	if !hasFinalizer(obj, finalizerString) {
+		return
+	}
 	finalizers := obj.GetFinalizers()
 
 	// Filter existing finalizers removing any that match the finalizerString
 	newFinalizers := []string{}
 	for _, finalizer := range finalizers {
-		if finalizer != FinalizerString {
+		if finalizer != finalizerString {
 			newFinalizers = append(newFinalizers, finalizer)
 		}
 	}
@@ -52,11 +83,11 @@ func removeFinalizer(obj *appsv1.Deployment) {
 }
 
 // hasFinalizer checks for the presence of the Wave finalizer
-func hasFinalizer(obj *appsv1.Deployment) bool {
+func hasFinalizer(obj metav1.Object, finalizerString string) bool {
 	finalizers := obj.GetFinalizers()
 	for _, finalizer := range finalizers {
-		if finalizer == FinalizerString {
-			// Deployment already contains the finalizer
+		if finalizer == finalizerString {
+			// Object already contains the finalizer
 			return true
 		}
 	}
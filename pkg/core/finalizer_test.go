@@ -32,7 +32,7 @@ var _ = Describe("Wave finalizer Suite", func() {
 
 	Context("addFinalizer", func() {
 		It("adds the wave finalizer to the deployment", func() {
-			addFinalizer(deployment)
+			addFinalizer(deployment, FinalizerString)
 
 			Expect(deployment.GetFinalizers()).To(ContainElement(FinalizerString))
 		})
@@ -41,18 +41,34 @@ var _ = Describe("Wave finalizer Suite", func() {
 			f := deployment.GetFinalizers()
 			f = append(f, "kubernetes")
 			deployment.SetFinalizers(f)
-			addFinalizer(deployment)
+			addFinalizer(deployment, FinalizerString)
 
 			Expect(deployment.GetFinalizers()).To(ContainElement("kubernetes"))
 		})
 	})
 
+	Context("updateFinalizer", func() {
+		It("adds the wave finalizer to the deployment", func() {
+			updateFinalizer(deployment, FinalizerString)
+
+			Expect(deployment.GetFinalizers()).To(ContainElement(FinalizerString))
+		})
+
+		It("removes the wave finalizer if the deployment skips it", func() {
+			deployment.SetFinalizers([]string{FinalizerString, "kubernetes"})
+			deployment.SetAnnotations(map[string]string{SkipFinalizerAnnotation: "true"})
+			updateFinalizer(deployment, FinalizerString)
+
+			Expect(deployment.GetFinalizers()).To(ConsistOf("kubernetes"))
+		})
+	})
+
 	Context("removeFinalizer", func() {
 		It("removes the wave finalizer from the deployment", func() {
 			f := deployment.GetFinalizers()
 			f = append(f, FinalizerString)
 			deployment.SetFinalizers(f)
-			removeFinalizer(deployment)
+			removeFinalizer(deployment, FinalizerString)
 
 			Expect(deployment.GetFinalizers()).NotTo(ContainElement(FinalizerString))
 		})
@@ -61,7 +77,7 @@ var _ = Describe("Wave finalizer Suite", func() {
 			f := deployment.GetFinalizers()
 			f = append(f, "kubernetes")
 			deployment.SetFinalizers(f)
-			removeFinalizer(deployment)
+			removeFinalizer(deployment, FinalizerString)
 
 			Expect(deployment.GetFinalizers()).To(ContainElement("kubernetes"))
 		})
@@ -73,18 +89,18 @@ var _ = Describe("Wave finalizer Suite", func() {
 			f = append(f, FinalizerString)
 			deployment.SetFinalizers(f)
 
-			Expect(hasFinalizer(deployment)).To(BeTrue())
+			Expect(hasFinalizer(deployment, FinalizerString)).To(BeTrue())
 		})
 
 		It("returns false if the deployment doesn't have the finalizer", func() {
 			// Test without any finalizers
-			Expect(hasFinalizer(deployment)).To(BeFalse())
+			Expect(hasFinalizer(deployment, FinalizerString)).To(BeFalse())
 
 			// Test with a different finalizer
 			f := deployment.GetFinalizers()
 			f = append(f, "kubernetes")
 			deployment.SetFinalizers(f)
-			Expect(hasFinalizer(deployment)).To(BeFalse())
+			Expect(hasFinalizer(deployment, FinalizerString)).To(BeFalse())
 		})
 	})
 })
@@ -0,0 +1,48 @@
+/*
+Copyright 2018 Pusher Ltd.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package core
+
+// forceSyncPending checks whether the workload's ForceSyncAnnotation holds a
+// nonce that Wave hasn't acted on yet
+func forceSyncPending(obj Object) bool {
+	annotations := obj.GetAnnotations()
+	nonce, ok := annotations[ForceSyncAnnotation]
+	return ok && nonce != annotations[ForceSyncedAnnotation]
+}
+
+// acknowledgeForceSync records the workload's ForceSyncAnnotation nonce as
+// acted on
+func acknowledgeForceSync(obj Object) {
+	annotations := obj.GetAnnotations()
+	if annotations == nil {
+		annotations = make(map[string]string)
+	}
+	annotations[ForceSyncedAnnotation] = annotations[ForceSyncAnnotation]
+	obj.SetAnnotations(annotations)
+}
+
+// forceSyncHandler returns a copy of the handler that reads children live
+// with the LiveReader, if one is configured, so that children the cache
+// hasn't caught up with are hashed with their latest contents.
+// The copy shares all of its state with the handler
+func (h *Handler) forceSyncHandler() *Handler {
+	copy := *h
+	if copy.options.LiveReader != nil {
+		copy.options.ChildReads = ChildReadsLive
+	}
+	return &copy
+}
@@ -0,0 +1,62 @@
+/*
+Copyright 2018 Pusher Ltd.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package core
+
+import (
+	"sync"
+
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// isFrozen checks whether the workload's freeze annotation, the
+// FreezeAnnotation unless another key is configured, is set to "true"
+func isFrozen(obj Object, annotation string) bool {
+	return obj.GetAnnotations()[annotation] == "true"
+}
+
+// frozenHashTracker records, by workload UID, the configuration hash each
+// frozen workload was last reported to diverge to, so that each divergence is
+// only reported once rather than on every reconcile
+type frozenHashTracker struct {
+	lock   sync.Mutex
+	hashes map[types.UID]string
+}
+
+// newFrozenHashTracker constructs a frozenHashTracker with no recorded hashes
+func newFrozenHashTracker() *frozenHashTracker {
+	return &frozenHashTracker{hashes: make(map[types.UID]string)}
+}
+
+// diverged records the hash the frozen workload would have recorded,
+// returning true if it differs from the hash last recorded for the workload
+func (f *frozenHashTracker) diverged(owner Object, hash string) bool {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	if f.hashes[owner.GetUID()] == hash {
+		return false
+	}
+	f.hashes[owner.GetUID()] = hash
+	return true
+}
+
+// forget removes the hash recorded for the workload, once it is unfrozen, its
+// hash no longer diverges or it is deleted
+func (f *frozenHashTracker) forget(uid types.UID) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	delete(f.hashes, uid)
+}
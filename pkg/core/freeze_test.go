@@ -0,0 +1,47 @@
+/*
+Copyright 2018 Pusher Ltd.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package core
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/pusher/wave/test/utils"
+)
+
+var _ = Describe("Wave freeze tracking Suite", func() {
+	Context("isFrozen", func() {
+		It("checks the configured freeze annotation", func() {
+			frozen := utils.ExampleDeployment.DeepCopy()
+			frozen.SetAnnotations(map[string]string{"example.com/freeze": "true"})
+			Expect(isFrozen(frozen, "example.com/freeze")).To(BeTrue())
+			Expect(isFrozen(frozen, FreezeAnnotation)).To(BeFalse())
+		})
+	})
+
+	Context("frozenHashTracker", func() {
+		It("only reports each diverging hash once", func() {
+			tracker := newFrozenHashTracker()
+			frozen := utils.ExampleDeployment.DeepCopy()
+			Expect(tracker.diverged(frozen, "a")).To(BeTrue())
+			Expect(tracker.diverged(frozen, "a")).To(BeFalse())
+			Expect(tracker.diverged(frozen, "b")).To(BeTrue())
+
+			tracker.forget(frozen.GetUID())
+			Expect(tracker.diverged(frozen, "b")).To(BeTrue())
+		})
+	})
+})
@@ -0,0 +1,141 @@
+/*
+Copyright 2018 Pusher Ltd.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package core
+
+import (
+	"sync"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/pusher/wave/test/utils"
+	corev1 "k8s.io/api/core/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/manager"
+)
+
+var _ = Describe("Wave generate name Suite", func() {
+	var c client.Client
+	var m utils.Matcher
+	var mgr manager.Manager
+	var pod1 *corev1.Pod
+	var pod2 *corev1.Pod
+	var cm1 *corev1.ConfigMap
+	var mgrStopped *sync.WaitGroup
+	var stopMgr chan struct{}
+
+	const timeout = time.Second * 5
+	const consistentlyTimeout = time.Second
+
+	BeforeEach(func() {
+		var err error
+		mgr, err = manager.New(cfg, manager.Options{})
+		Expect(err).NotTo(HaveOccurred())
+		c = mgr.GetClient()
+		m = utils.Matcher{Client: c}
+
+		stopMgr, mgrStopped = StartTestManager(mgr)
+
+		cm1 = utils.ExampleConfigMap1.DeepCopy()
+		for _, obj := range []Object{
+			cm1,
+			utils.ExampleConfigMap2.DeepCopy(),
+			utils.ExampleSecret1.DeepCopy(),
+			utils.ExampleSecret2.DeepCopy(),
+		} {
+			m.Create(obj).Should(Succeed())
+			m.Get(obj, timeout).Should(Succeed())
+		}
+
+		// Create two Pods from the same GenerateName
+		pod1 = utils.ExamplePod.DeepCopy()
+		pod2 = utils.ExamplePod.DeepCopy()
+		for _, pod := range []*corev1.Pod{pod1, pod2} {
+			pod.SetAnnotations(map[string]string{RequiredAnnotation: "true"})
+			m.Create(pod).Should(Succeed())
+			m.Get(pod, timeout).Should(Succeed())
+		}
+	})
+
+	AfterEach(func() {
+		// Make sure to delete the finalizers so the Pods can be deleted
+		for _, pod := range []*corev1.Pod{pod1, pod2} {
+			m.Get(pod, timeout).Should(Succeed())
+			pod.SetFinalizers([]string{})
+			m.Update(pod).Should(Succeed())
+		}
+
+		close(stopMgr)
+		mgrStopped.Wait()
+
+		utils.DeleteAll(cfg, timeout,
+			&corev1.PodList{},
+			&corev1.ConfigMapList{},
+			&corev1.SecretList{},
+			&corev1.EventList{},
+		)
+	})
+
+	Context("With the track strategy", func() {
+		BeforeEach(func() {
+			h := NewHandler(c, mgr.GetRecorder("wave"), Options{GenerateNameStrategy: GenerateNameTrack})
+			for _, pod := range []*corev1.Pod{pod1, pod2} {
+				_, err := h.HandlePod(pod)
+				Expect(err).NotTo(HaveOccurred())
+			}
+		})
+
+		It("Adds a distinct OwnerReference for each Pod using its UID", func() {
+			Expect(pod1.GetName()).NotTo(Equal(pod2.GetName()))
+			m.Eventually(cm1, timeout).Should(utils.WithOwnerReferences(SatisfyAll(
+				ContainElement(utils.GetOwnerRef(pod1)),
+				ContainElement(utils.GetOwnerRef(pod2)),
+			)))
+		})
+
+		It("Records the config hash on each Pod's metadata", func() {
+			for _, pod := range []*corev1.Pod{pod1, pod2} {
+				m.Eventually(pod, timeout).Should(utils.WithAnnotations(HaveKey(ConfigHashAnnotation)))
+			}
+		})
+
+		It("Finds the existing children of each Pod by UID", func() {
+			h := NewHandler(c, mgr.GetRecorder("wave"), Options{})
+			for _, pod := range []*corev1.Pod{pod1, pod2} {
+				Eventually(func() ([]Object, error) {
+					return h.getExistingChildren(pod)
+				}, timeout).Should(HaveLen(4))
+			}
+		})
+	})
+
+	Context("With the ignore strategy", func() {
+		BeforeEach(func() {
+			h := NewHandler(c, mgr.GetRecorder("wave"), Options{GenerateNameStrategy: GenerateNameIgnore})
+			_, err := h.HandlePod(pod1)
+			Expect(err).NotTo(HaveOccurred())
+		})
+
+		It("Doesn't add any OwnerReferences to the children", func() {
+			m.Consistently(cm1, consistentlyTimeout).ShouldNot(utils.WithOwnerReferences(ContainElement(utils.GetOwnerRef(pod1))))
+		})
+
+		It("Doesn't record a config hash on the Pod", func() {
+			m.Consistently(pod1, consistentlyTimeout).ShouldNot(utils.WithAnnotations(HaveKey(ConfigHashAnnotation)))
+		})
+	})
+})
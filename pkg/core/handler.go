@@ -20,10 +20,16 @@ import (
 	"context"
 	"fmt"
 	"reflect"
+	"strings"
+	"time"
 
+	argov1alpha1 "github.com/pusher/wave/pkg/apis/argoproj/v1alpha1"
+	"github.com/pusher/wave/pkg/metrics"
 	appsv1 "k8s.io/api/apps/v1"
+	batchv1 "k8s.io/api/batch/v1"
 	corev1 "k8s.io/api/core/v1"
 	"k8s.io/client-go/tools/record"
+	"k8s.io/client-go/util/workqueue"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/reconcile"
 	logf "sigs.k8s.io/controller-runtime/pkg/runtime/log"
@@ -32,23 +38,226 @@ import (
 // Handler performs the main business logic of the Wave controller
 type Handler struct {
 	client.Client
-	recorder record.EventRecorder
+	recorder     record.EventRecorder
+	options      Options
+	breaker      *circuitBreaker
+	childHashes  *childHashTracker
+	contents     *contentCache
+	secretData   *secretDataCache
+	inFlight     *inFlightReconciles
+	summaries    *reconcileSummaries
+	merkleTrees  *merkleTreeCache
+	childRetries workqueue.RateLimiter
+	frozenHashes *frozenHashTracker
+
+	// crossNamespaceSkips records the children skipped in other namespaces
+	crossNamespaceSkips *crossNamespaceSkipTracker
+
+	// workloadUIDs records the UIDs of the workloads reconciled
+	workloadUIDs *workloadUIDs
+
+	// resourceVersions is only set with HashResourceVersions
+	resourceVersions *resourceVersionTracker
 }
 
 // NewHandler constructs a new instance of Handler
-func NewHandler(c client.Client, r record.EventRecorder) *Handler {
-	return &Handler{Client: c, recorder: r}
+func NewHandler(c client.Client, r record.EventRecorder, opts Options) *Handler {
+	if opts.DaemonSetOnDeletePolicy == "" {
+		opts.DaemonSetOnDeletePolicy = OnDeleteEvent
+	}
+	if opts.GenerateNameStrategy == "" {
+		opts.GenerateNameStrategy = GenerateNameTrack
+	}
+	if opts.HashAlgorithm == "" {
+		opts.HashAlgorithm = HashSHA256
+	}
+	if opts.ZeroChildrenPolicy == "" {
+		opts.ZeroChildrenPolicy = ZeroChildrenManage
+	}
+	if opts.ImagePullSecretsPolicy == "" {
+		opts.ImagePullSecretsPolicy = ImagePullSecretsIgnore
+	}
+	if opts.RequiredAnnotation == "" {
+		opts.RequiredAnnotation = RequiredAnnotation
+	}
+	if opts.ConfigHashAnnotation == "" {
+		opts.ConfigHashAnnotation = ConfigHashAnnotation
+	}
+	if opts.Finalizer == "" {
+		opts.Finalizer = FinalizerString
+	}
+	if opts.FreezeAnnotation == "" {
+		opts.FreezeAnnotation = FreezeAnnotation
+	}
+	if opts.EmptySecretPolicy == "" {
+		opts.EmptySecretPolicy = EmptySecretHash
+	}
+	if opts.UpdateOrder == "" {
+		opts.UpdateOrder = UpdateOrderOwnerReferencesFirst
+	}
+	if len(opts.RequiredAnnotationValues) == 0 {
+		opts.RequiredAnnotationValues = []string{"true"}
+	}
+	if opts.OwnerReferenceDeniedPolicy == "" {
+		opts.OwnerReferenceDeniedPolicy = OwnerReferenceDeniedFail
+	}
+	if opts.OwnerReferenceMode == "" {
+		opts.OwnerReferenceMode = OwnerReferenceBlocking
+	}
+	if opts.OwnerReferenceUpdateAttempts <= 0 {
+		opts.OwnerReferenceUpdateAttempts = 5
+	}
+	if opts.ChildReads == "" {
+		opts.ChildReads = ChildReadsCache
+	}
+	if opts.ChildRetryMaxBackoff == 0 {
+		opts.ChildRetryMaxBackoff = 5 * time.Minute
+	}
+	if opts.CircuitBreakerBackoff == 0 {
+		opts.CircuitBreakerBackoff = 10 * time.Minute
+	}
+	var resourceVersions *resourceVersionTracker
+	if opts.HashResourceVersions {
+		resourceVersions = newResourceVersionTracker()
+	}
+	return &Handler{
+		Client:       c,
+		recorder:     newSafeRecorder(r),
+		options:      opts,
+		breaker:      newCircuitBreaker(),
+		childHashes:  newChildHashTracker(),
+		contents:     newContentCache(),
+		secretData:   newSecretDataCache(),
+		inFlight:     newInFlightReconciles(),
+		summaries:    newReconcileSummaries(),
+		merkleTrees:  newMerkleTreeCache(),
+		childRetries: newChildRetryLimiter(opts),
+		frozenHashes: newFrozenHashTracker(),
+
+		crossNamespaceSkips: newCrossNamespaceSkipTracker(),
+		workloadUIDs:        newWorkloadUIDs(),
+		resourceVersions:    resourceVersions,
+	}
 }
 
 // HandleDeployment is called by the deployment controller
 func (h *Handler) HandleDeployment(instance *appsv1.Deployment) (reconcile.Result, error) {
+	return h.handle(instance)
+}
+
+// HandleDaemonSet is called by the daemonset controller
+func (h *Handler) HandleDaemonSet(instance *appsv1.DaemonSet) (reconcile.Result, error) {
+	return h.handle(instance)
+}
+
+// HandleStatefulSet is called by the statefulset controller
+func (h *Handler) HandleStatefulSet(instance *appsv1.StatefulSet) (reconcile.Result, error) {
+	return h.handle(instance)
+}
+
+// HandleReplicaSet is called by the replicaset controller
+func (h *Handler) HandleReplicaSet(instance *appsv1.ReplicaSet) (reconcile.Result, error) {
+	return h.handle(instance)
+}
+
+// HandleJob is called by the job controller
+func (h *Handler) HandleJob(instance *batchv1.Job) (reconcile.Result, error) {
+	return h.handle(instance)
+}
+
+// HandleRollout is called by the rollout controller
+func (h *Handler) HandleRollout(instance *argov1alpha1.Rollout) (reconcile.Result, error) {
+	return h.handle(instance)
+}
+
+// HandlePod is called by the pod controller
+func (h *Handler) HandlePod(instance *corev1.Pod) (reconcile.Result, error) {
+	return h.handle(instance)
+}
+
+// handle reconciles the workload within the ReconcileTimeout, recording the
+// duration and outcome of the reconcile before applying the circuit breaker
+// and the backoff of children that fail to fetch.
+// With AggregateEvents enabled, the actions taken are reported in a single
+// event once the reconcile returns.
+// Workloads in namespaces that aren't reconciled are skipped before Wave acts
+// on them in any way
+func (h *Handler) handle(instance Object) (reconcile.Result, error) {
+	if !h.namespaceAllowed(instance.GetNamespace()) {
+		// Workloads Wave managed before their namespace stopped being
+		// reconciled are still cleaned up, so that the finalizer doesn't block
+		// their deletion
+		if toBeDeleted(instance) && hasFinalizer(instance, h.options.Finalizer) {
+			logf.Log.WithName("wave").V(0).Info("Instance in a namespace that is not reconciled marked for deletion, cleaning up orphans", "namespace", instance.GetNamespace(), "name", instance.GetName())
+			return h.handleDelete(instance)
+		}
+		logf.Log.WithName("wave").V(1).Info("Namespace is not reconciled, skipping", "namespace", instance.GetNamespace(), "name", instance.GetName())
+		return reconcile.Result{}, nil
+	}
+
+	h.trackWorkload(instance)
+
+	// The summary reports whether the reconcile failed, after the actions it
+	// took before failing
+	var reconcileErr error
+	if h.options.AggregateEvents {
+		h.summaries.start(instance.GetUID())
+		defer func() { h.sendSummaryEvent(instance, reconcileErr) }()
+	}
+
+	// Workloads whose force sync is pending have their children read live
+	handler := h
+	if forceSyncPending(instance) {
+		handler = h.forceSyncHandler()
+	}
+
+	start := time.Now()
+	result, err := handler.handleWithTimeout(instance)
+	reconcileErr = err
+	metrics.RecordReconcileResult(instance.GetNamespace(), kindOf(instance), time.Since(start), err)
+	result, err = h.applyCircuitBreaker(instance, result, err)
+	return h.applyChildRetryBackoff(instance, result, err)
+}
+
+// handlePodController reconciles the state of a workload that manages Pods
+// through a PodTemplate (eg. a Deployment, a DaemonSet or a Job)
+func (h *Handler) handlePodController(instance Object) (result reconcile.Result, err error) {
 	log := logf.Log.WithName("wave")
 
-	// If the required annotation isn't present, ignore the instance
-	if !hasRequiredAnnotation(instance) {
-		// Perform deletion logic if the finalizer is present on the object
-		if hasFinalizer(instance) {
-			log.V(0).Info("Required annotation removed from instance, cleaning up orphans", "namespace", instance.GetNamespace(), "name", instance.GetName())
+	// ReplicaSets owned by a Deployment or a Rollout are managed through
+	// their owner
+	if isOwnedByDeployment(instance) || isOwnedByRollout(instance) {
+		if _, ok := instance.(*appsv1.ReplicaSet); ok {
+			return h.handleDeploymentReplicaSet(instance)
+		}
+	}
+
+	// If the instance is managed by another Wave instance, ignore it
+	if isOwnedByOtherInstance(instance, h.options.InstanceID) {
+		log.V(1).Info("Instance is managed by another Wave instance, skipping", "namespace", instance.GetNamespace(), "name", instance.GetName(), "owner", instance.GetAnnotations()[InstanceAnnotation])
+		return reconcile.Result{}, nil
+	}
+
+	enabled, err := h.isEnabled(instance)
+	if err != nil {
+		return reconcile.Result{}, fmt.Errorf("error checking required annotation: %v", err)
+	}
+
+	// If Wave isn't enabled for the instance by its required annotation or its
+	// namespace, or the instance's name is generated and the
+	// GenerateNameStrategy ignores it, ignore the instance
+	if !enabled || h.ignoresGeneratedName(instance) {
+		if referencesWorkload(instance) && hasRequiredAnnotation(instance, h.options.RequiredAnnotation, h.options.RequiredAnnotationValues) {
+			h.recorder.Eventf(instance, corev1.EventTypeWarning, "WorkloadRefUnsupported", "Rollouts referencing a workload aren't managed, enable Wave for the referenced %s instead", workloadRefKind(instance))
+		}
+
+		// Perform deletion logic if Wave managed the instance previously
+		managed, err := h.wasManaged(instance)
+		if err != nil {
+			return reconcile.Result{}, fmt.Errorf("error fetching existing children: %v", err)
+		}
+		if managed {
+			log.V(0).Info("Wave disabled for instance, cleaning up orphans", "namespace", instance.GetNamespace(), "name", instance.GetName())
 			return h.handleDelete(instance)
 		}
 		return reconcile.Result{}, nil
@@ -60,6 +269,46 @@ func (h *Handler) HandleDeployment(instance *appsv1.Deployment) (reconcile.Resul
 		return h.handleDelete(instance)
 	}
 
+	// If the instance references no children and the ZeroChildrenPolicy
+	// skips such instances, leave it unmanaged
+	if h.options.ZeroChildrenPolicy == ZeroChildrenSkip {
+		none, err := h.referencesNoChildren(instance)
+		if err != nil {
+			return reconcile.Result{}, fmt.Errorf("error fetching current children: %v", err)
+		}
+		if none {
+			return h.handleZeroChildren(instance)
+		}
+	}
+
+	// Managed instances are requeued every ResyncPeriod, independently of
+	// the informers' sync period
+	defer func() {
+		result = h.withResync(result, err)
+	}()
+
+	// Record the outcome of the reconcile in the instance's WaveStatus once
+	// its children are known and the hash has been applied
+	var hashed []Object
+	var applied string
+	if h.options.WaveStatus {
+		defer func() {
+			h.updateWaveStatus(instance, hashed, applied, err)
+		}()
+	}
+
+	// Record the children the instance references in the index before
+	// fetching them, so that a missing child triggers a reconcile once created
+	configMaps, secrets, err := h.getChildKeys(instance)
+	if err != nil {
+		return reconcile.Result{}, fmt.Errorf("error fetching current children: %v", err)
+	}
+	extraKeys, err := h.getExtraChildKeys(instance)
+	if err != nil {
+		return reconcile.Result{}, fmt.Errorf("error fetching extra children: %v", err)
+	}
+	h.options.ChildIndex.updateWithExtra(instance, h.withPauseConfigMap(configMaps), secrets, h.withServiceAccount(instance, extraKeys))
+
 	// Get all children that have an OwnerReference pointing to this instance
 	existing, err := h.getExistingChildren(instance)
 	if err != nil {
@@ -68,35 +317,335 @@ func (h *Handler) HandleDeployment(instance *appsv1.Deployment) (reconcile.Resul
 
 	// Get all children that the instance currently references
 	current, err := h.getCurrentChildren(instance)
+	if fetchErr, ok := err.(*childFetchError); ok {
+		return reconcile.Result{}, fetchErr.wrap("error fetching current children")
+	}
 	if err != nil {
 		return reconcile.Result{}, fmt.Errorf("error fetching current children: %v", err)
 	}
 
-	// Reconcile the OwnerReferences on the existing and current children
-	err = h.updateOwnerReferences(instance, existing, current)
+	// Children of other kinds are hashed but never receive OwnerReferences.
+	// Which ConfigMaps and Secrets are hashed and owned depends on their
+	// ChildPolicy, and the workload may restrict the hash to the children of
+	// some of its volumes and to some keys of its ConfigMaps.
+	// Missing optional children are hashed as absent, and Secrets read
+	// without their data may be hashed with the data they were last read with
+	extra, err := h.getExtraChildren(extraKeys)
+	if err != nil {
+		return reconcile.Result{}, fmt.Errorf("error fetching extra children: %v", err)
+	}
+	absent, err := h.getAbsentChildren(instance, configMaps, secrets, current)
+	if err != nil {
+		return reconcile.Result{}, fmt.Errorf("error fetching optional children: %v", err)
+	}
+	hashed, err = h.selectHashedChildren(instance, current, extra, absent)
+	if err != nil {
+		return reconcile.Result{}, fmt.Errorf("error selecting hashed children: %v", err)
+	}
+	owned := h.ownedChildren(current)
+	h.warnInvalidEnvFromPrefixes(instance)
+	h.warnFinalizedChildren(instance, current)
+
+	// Update the workload either before or after reconciling the
+	// OwnerReferences on the existing and current children, depending on the
+	// UpdateOrder
+	if h.options.UpdateOrder == UpdateOrderHashFirst {
+		var updateResult reconcile.Result
+		applied, updateResult, err = h.updateWorkload(instance, hashed)
+		if err != nil {
+			return updateResult, err
+		}
+		err = h.updateOwnerReferences(instance, existing, owned)
+		if err != nil {
+			return reconcile.Result{}, fmt.Errorf("error updating OwnerReferences: %v", err)
+		}
+		return updateResult, nil
+	}
+
+	err = h.updateOwnerReferences(instance, existing, owned)
 	if err != nil {
 		return reconcile.Result{}, fmt.Errorf("error updating OwnerReferences: %v", err)
 	}
+	applied, result, err = h.updateWorkload(instance, hashed)
+	return result, err
+}
 
-	hash, err := calculateConfigHash(current)
+// updateWorkload records the configuration hash of the current children and
+// the finalizer on the workload.
+// The hash recorded on the workload is returned, none is returned if the hash
+// wasn't recorded, eg. while the workload is frozen, rollouts are paused or in
+// dry run mode
+func (h *Handler) updateWorkload(instance Object, current []Object) (string, reconcile.Result, error) {
+	log := logf.Log.WithName("wave")
+
+	// If hashing is disabled, only the finalizer needs to be maintained
+	if h.options.DisableConfigHash {
+		result, err := h.handleWithoutConfigHash(instance, current)
+		return "", result, err
+	}
+
+	// Workloads being poked or force synced have their hash recalculated from
+	// scratch
+	contents := h.contentCacheFor(instance)
+	if _, ok := instance.GetAnnotations()[PokeAnnotation]; ok {
+		log.V(0).Info("Recalculating hash of poked instance", "namespace", instance.GetNamespace(), "name", instance.GetName(), "poke", instance.GetAnnotations()[PokeAnnotation])
+		contents = nil
+	}
+	forceSync := forceSyncPending(instance)
+	if forceSync {
+		log.V(0).Info("Recalculating hash of force synced instance", "namespace", instance.GetNamespace(), "name", instance.GetName(), "nonce", instance.GetAnnotations()[ForceSyncAnnotation])
+		contents = nil
+	}
+
+	hash, err := h.configHash(instance, current, contents)
 	if err != nil {
-		return reconcile.Result{}, fmt.Errorf("error calculating configuration hash: %v", err)
+		return "", reconcile.Result{}, fmt.Errorf("error calculating configuration hash: %v", err)
 	}
 
-	// Update the desired state of the Deployment in a DeepCopy
-	copy := instance.DeepCopy()
-	setConfigHash(copy, hash)
-	addFinalizer(copy)
+	// Frozen workloads keep the hash they have recorded, only their finalizer
+	// is maintained
+	if isFrozen(instance, h.options.FreezeAnnotation) {
+		if hash == recordedConfigHash(instance, h.options.ConfigHashAnnotation) {
+			h.frozenHashes.forget(instance.GetUID())
+		} else if h.frozenHashes.diverged(instance, hash) {
+			log.V(0).Info("Instance frozen, not updating hash", "namespace", instance.GetNamespace(), "name", instance.GetName(), "hash", hash)
+			h.sendWorkloadEvent(instance, "FrozenHashDiverged", fmt.Sprintf("Frozen, configuration hash %s not recorded", hash))
+		} else {
+			log.V(1).Info("Instance frozen, not updating hash", "namespace", instance.GetNamespace(), "name", instance.GetName(), "hash", hash)
+		}
+		result, err := h.handleWithoutConfigHash(instance, current)
+		return "", result, err
+	}
+	h.frozenHashes.forget(instance.GetUID())
+
+	// While rollouts are paused, new hashes are not recorded, only the
+	// finalizer and tracked children are maintained. The workload is
+	// reconciled again when the PauseConfigMap changes
+	if hash != recordedConfigHash(instance, h.options.ConfigHashAnnotation) {
+		paused, err := h.rolloutsPaused()
+		if err != nil {
+			return "", reconcile.Result{}, fmt.Errorf("error checking whether rollouts are paused: %v", err)
+		}
+		if paused {
+			log.V(0).Info("Rollouts paused, deferring hash update", "namespace", instance.GetNamespace(), "name", instance.GetName(), "hash", hash)
+			result, err := h.handleWithoutConfigHash(instance, current)
+			return "", result, err
+		}
+	}
+
+	// Track the children that changed since the last reconcile so that they
+	// can be told about any rollout they trigger, so that rotated TLS
+	// Secrets can be reported, so that dry runs can name them, and so that
+	// hash changes can be logged with the changes that caused them
+	// The children are only recorded once the workload has been updated, so
+	// that a failed update names them again when it is retried.
+	// In dry run mode the children are only recorded while the hash is up to
+	// date, so that every dry run names the children that changed since the
+	// hash was recorded
+	changedChildren := []Object{}
+	changes := []string{}
+	var childHashes childHashSet
+	trackChildren := h.options.ChildRolloutEvents || h.options.TLSRotationEvents || h.options.DryRun || h.options.LogHashDiffs
+	if trackChildren {
+		changedChildren, changes, childHashes, err = h.childHashes.diff(instance, current, h.options.ChildVersionLabel, h.resourceVersions)
+		if err != nil {
+			return "", reconcile.Result{}, fmt.Errorf("error tracking children: %v", err)
+		}
+	}
+
+	// In dry run mode, report the hash change rather than recording it
+	if h.options.DryRun {
+		if hash == recordedConfigHash(instance, h.options.ConfigHashAnnotation) {
+			h.childHashes.record(instance, childHashes)
+		}
+		h.reportDryRun(instance, hash, current, changedChildren)
+		return "", reconcile.Result{}, nil
+	}
+
+	// Update the desired state of the workload in a DeepCopy.
+	// If the hash has previously been recorded on the workload's metadata, its
+	// PodTemplate is immutable so keep recording the hash there.
+	// Objects without a PodTemplate (eg. Pods) always record it there.
+	// Workloads adopted without a rollout record it in a separate annotation
+	// until their configuration changes
+	copy := instance.DeepCopyObject().(Object)
+	adopting := false
+	if hasMetadataConfigHash(instance, h.options.ConfigHashAnnotation) || getPodTemplate(instance) == nil {
+		setMetadataConfigHash(copy, h.options.ConfigHashAnnotation, hash)
+	} else if h.adoptsWithoutRollout(instance, hash) {
+		setAdoptedConfigHash(copy, hash)
+		adopting = true
+	} else {
+		setConfigHash(copy, h.options.ConfigHashAnnotation, hash)
+		removeAdoptedConfigHash(copy)
+		h.mirrorAnnotations(copy)
+	}
+	h.recordWorkloadState(copy, hash, current, forceSync)
 
 	// If the desired state doesn't match the existing state, update it
 	if !reflect.DeepEqual(instance, copy) {
 		log.V(0).Info("Updating instance hash", "namespace", instance.GetNamespace(), "name", instance.GetName(), "hash", hash)
-		h.recorder.Eventf(copy, corev1.EventTypeNormal, "ConfigChanged", "Configuration hash updated to %s", hash)
+		previousHash := getConfigHash(instance, h.options.ConfigHashAnnotation)
+		rotated := h.rotatedTLSSecrets(changedChildren)
+		hashChanged := false
+		var reason, message string
+		if adopting {
+			reason, message = "Adopted", fmt.Sprintf("Adopted without a rollout, configuration hash %s recorded on the metadata until the configuration changes", hash)
+		} else if forceSync && previousHash == hash {
+			reason, message = "ForceSynced", fmt.Sprintf("Configuration hash recalculated for nonce %q, unchanged at %s", instance.GetAnnotations()[ForceSyncAnnotation], hash)
+		} else if previousHash != "" && previousHash != hash && len(rotated) > 0 {
+			reason, message = "TLSRotated", fmt.Sprintf("TLS Secret(s) %s rotated, configuration hash updated to %s", strings.Join(rotated, ", "), hash)
+			hashChanged = true
+		} else {
+			reason, message = "ConfigChanged", h.configChangedMessage(hash, changes)
+			hashChanged = true
+		}
+		if h.options.LogHashDiffs && previousHash != "" && previousHash != hash {
+			log.V(0).Info("Configuration hash changed", "namespace", instance.GetNamespace(), "name", instance.GetName(), "previous", previousHash, "hash", hash, "changes", changes)
+		}
 		err := h.Update(context.TODO(), copy)
+		if err != nil && isImmutablePodTemplateError(err) && h.options.RecordHashOnMetadataIfImmutable {
+			result, err := h.handleImmutablePodTemplate(instance, hash, current, forceSync, err)
+			if err != nil {
+				return "", result, err
+			}
+			if trackChildren {
+				h.childHashes.record(instance, childHashes)
+			}
+			h.sendWorkloadEvent(copy, reason, message)
+			if hashChanged {
+				metrics.RecordHashChange(instance.GetNamespace(), kindOf(instance))
+			}
+			return hash, result, nil
+		}
 		if err != nil {
-			return reconcile.Result{}, fmt.Errorf("error updating instance %s/%s: %v", instance.GetNamespace(), instance.GetName(), err)
+			return "", reconcile.Result{}, fmt.Errorf("error updating instance %s/%s: %v", instance.GetNamespace(), instance.GetName(), err)
+		}
+		// Hash changes are only reported and counted once they have been
+		// recorded
+		h.sendWorkloadEvent(copy, reason, message)
+		if hashChanged {
+			metrics.RecordHashChange(instance.GetNamespace(), kindOf(instance))
 		}
+		if h.options.ChildRolloutEvents && previousHash != "" && previousHash != hash {
+			h.sendChildRolloutEvents(instance, changedChildren)
+		}
+	}
+	if trackChildren {
+		h.childHashes.record(instance, childHashes)
 	}
 
+	// Workloads using the OnDelete strategy won't replace their Pods when the
+	// hash changes, so apply the configured OnDeletePolicy.
+	// Adopted workloads' Pods are never replaced
+	if isOnDelete(copy) && !adopting {
+		err = h.handleOnDelete(instance, copy, hash)
+		if err != nil {
+			return "", reconcile.Result{}, fmt.Errorf("error handling OnDelete update strategy: %v", err)
+		}
+	}
+
+	return hash, reconcile.Result{}, nil
+}
+
+// configHash calculates the salted configuration hash of the children with
+// the configured HashAlgorithm, reusing their content from the cache where
+// possible.
+// With MerkleHash enabled, the root of the workload's merkleTree is salted
+// instead.
+// The hash is shortened to fit the workload's hashTarget
+func (h *Handler) configHash(instance Object, children []Object, contents *contentCache) (string, error) {
+	var sum string
+	if h.options.MerkleHash {
+		root, err := h.merkleRoot(instance, children, contents)
+		if err != nil {
+			return "", err
+		}
+		sum = root
+	} else {
+		source, err := getHashSource(children, contents, h.options.ChildVersionLabel, h.resourceVersions)
+		if err != nil {
+			return "", err
+		}
+		sum = h.options.HashAlgorithm.sum(source)
+	}
+	hash := saltConfigHash(h.options.HashAlgorithm, sum, h.options.HashSalt)
+	return fitHashTarget(instance, h.options.ConfigHashAnnotation, hash), nil
+}
+
+// selectHashedChildren returns the children included in the configuration
+// hash of the workload, given its current ConfigMaps and Secrets, the children
+// of other kinds and the markers of its missing optional children
+func (h *Handler) selectHashedChildren(instance Object, current, extra, absent []Object) ([]Object, error) {
+	hashed, err := getHashVolumeChildren(instance, append(append(h.withLastSecretData(h.hashedChildren(current)), extra...), absent...))
+	if err != nil {
+		return nil, err
+	}
+	return getHashKeyChildren(instance, hashed), nil
+}
+
+// recordWorkloadState records the state Wave maintains on the workload
+// alongside its configuration hash, wherever the hash itself is recorded: the
+// hash history, the tracked children, the instance annotation, the finalizer,
+// the partition completion and the force sync acknowledgement
+func (h *Handler) recordWorkloadState(copy Object, hash string, current []Object, forceSync bool) {
+	appendHashHistory(copy, hash, h.options.HashHistoryLimit)
+	if h.options.TrackChildren {
+		setTrackedChildren(copy, current)
+	}
+	setInstanceAnnotation(copy, h.options.InstanceID)
+	h.manageFinalizer(copy)
+	completePartition(copy)
+	if forceSync {
+		acknowledgeForceSync(copy)
+	}
+}
+
+// handleImmutablePodTemplate records the configuration hash on the metadata of
+// a workload whose PodTemplate was rejected as immutable by the API server,
+// along with the rest of the state recorded with the hash.
+// The hash will be recorded on the metadata for all future reconciles
+func (h *Handler) handleImmutablePodTemplate(instance Object, hash string, current []Object, forceSync bool, updateErr error) (reconcile.Result, error) {
+	copy := instance.DeepCopyObject().(Object)
+	setMetadataConfigHash(copy, h.options.ConfigHashAnnotation, hash)
+	h.recordWorkloadState(copy, hash, current, forceSync)
+
+	h.recorder.Eventf(copy, corev1.EventTypeWarning, "ImmutablePodTemplate", "Unable to update the PodTemplate of %s, recording configuration hash %s on its metadata instead: %v", kindOf(copy), hash, updateErr)
+	err := h.Update(context.TODO(), copy)
+	if err != nil {
+		return reconcile.Result{}, fmt.Errorf("error updating instance %s/%s: %v", instance.GetNamespace(), instance.GetName(), err)
+	}
+	return reconcile.Result{}, nil
+}
+
+// handleWithoutConfigHash adds the finalizer to a workload without calculating
+// or recording its configuration hash.
+// The tracked children are still refreshed from the current children.
+// In dry run mode the workload is left untouched
+func (h *Handler) handleWithoutConfigHash(instance Object, current []Object) (reconcile.Result, error) {
+	if h.options.DryRun {
+		return reconcile.Result{}, nil
+	}
+
+	copy := instance.DeepCopyObject().(Object)
+	if h.options.TrackChildren {
+		setTrackedChildren(copy, current)
+	}
+	setInstanceAnnotation(copy, h.options.InstanceID)
+	h.manageFinalizer(copy)
+	completePartition(copy)
+
+	if !reflect.DeepEqual(instance, copy) {
+		err := h.Update(context.TODO(), copy)
+		if err != nil {
+			return reconcile.Result{}, fmt.Errorf("error updating instance %s/%s: %v", instance.GetNamespace(), instance.GetName(), err)
+		}
+	}
 	return reconcile.Result{}, nil
 }
+
+// ignoresGeneratedName returns true if the instance's name was generated by
+// the API server and the GenerateNameStrategy ignores such workloads
+func (h *Handler) ignoresGeneratedName(instance Object) bool {
+	return h.options.GenerateNameStrategy == GenerateNameIgnore && instance.GetGenerateName() != ""
+}
@@ -19,25 +19,32 @@ package core
 import (
 	"context"
 	"fmt"
+	"strings"
 	"sync"
 	"time"
 
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/gomega"
+	wavev1alpha1 "github.com/pusher/wave/pkg/apis/wave/v1alpha1"
 	"github.com/pusher/wave/test/utils"
 	appsv1 "k8s.io/api/apps/v1"
 	corev1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
 	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/manager"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
 )
 
 var _ = Describe("Wave controller Suite", func() {
+	var mgr manager.Manager
 	var c client.Client
 	var h *Handler
 	var m utils.Matcher
+	var recorder *record.FakeRecorder
 
 	var deployment *appsv1.Deployment
 	var mgrStopped *sync.WaitGroup
@@ -52,12 +59,41 @@ var _ = Describe("Wave controller Suite", func() {
 	var s1 *corev1.Secret
 	var s2 *corev1.Secret
 
+	// handle reconciles the latest version of the Deployment, which mustn't
+	// fail, and returns the hash recorded on its PodTemplate
+	var handle = func() string {
+		m.Get(deployment, timeout).Should(Succeed())
+		_, err := h.HandleDeployment(deployment)
+		Expect(err).NotTo(HaveOccurred())
+		m.Get(deployment, timeout).Should(Succeed())
+		return deployment.Spec.Template.GetAnnotations()[ConfigHashAnnotation]
+	}
+
+	// receivedEvents drains the events sent to the recorder, which Handlers
+	// are constructed with where a context checks the events they send
+	var receivedEvents = func() []string {
+		return drainEvents(recorder)
+	}
+
+	// modifyConfigMap updates the data of the ConfigMap and waits for the cache
+	// to observe the change
+	var modifyConfigMap = func(cm *corev1.ConfigMap) {
+		m.Get(cm, timeout).Should(Succeed())
+		cm.Data["key1"] = "modified"
+		m.Update(cm).Should(Succeed())
+		m.Eventually(cm, timeout).Should(WithTransform(func(obj *corev1.ConfigMap) string {
+			return obj.Data["key1"]
+		}, Equal("modified")))
+	}
+
 	BeforeEach(func() {
-		mgr, err := manager.New(cfg, manager.Options{})
+		var err error
+		mgr, err = manager.New(cfg, manager.Options{})
 		Expect(err).NotTo(HaveOccurred())
 		c = mgr.GetClient()
-		h = NewHandler(c, mgr.GetRecorder("wave"))
+		h = NewHandler(c, mgr.GetRecorder("wave"), Options{})
 		m = utils.Matcher{Client: c}
+		recorder = record.NewFakeRecorder(100)
 
 		stopMgr, mgrStopped = StartTestManager(mgr)
 
@@ -168,7 +204,7 @@ var _ = Describe("Wave controller Suite", func() {
 					return event.Message
 				}
 
-				hashMessage := "Configuration hash updated to 198df8455a4fd702fc0c7fdfa4bdb213363b96240bfd48b7b098d936499315a1"
+				hashMessage := "Configuration hash updated to " + exampleHash
 				m.Eventually(events, timeout).Should(utils.WithItems(ContainElement(WithTransform(eventMessage, Equal(hashMessage)))))
 			})
 
@@ -204,6 +240,415 @@ var _ = Describe("Wave controller Suite", func() {
 				})
 			})
 
+			Context("And a child is replaced by a child with identical content", func() {
+				var originalHash string
+				var cm3 *corev1.ConfigMap
+
+				BeforeEach(func() {
+					m.Eventually(deployment, timeout).Should(utils.WithPodTemplateAnnotations(HaveKey(ConfigHashAnnotation)))
+					originalHash = deployment.Spec.Template.GetAnnotations()[ConfigHashAnnotation]
+
+					// Create a copy of ConfigMap example1 named example3
+					cm3 = utils.ExampleConfigMap1.DeepCopy()
+					cm3.SetName("example3")
+					m.Create(cm3).Should(Succeed())
+					m.Get(cm3, timeout).Should(Succeed())
+
+					// Repoint all references to ConfigMap example1 to example3
+					podSpec := &deployment.Spec.Template.Spec
+					podSpec.Volumes[1].VolumeSource.ConfigMap.Name = cm3.GetName()
+					podSpec.Containers[0].EnvFrom[0].ConfigMapRef.Name = cm3.GetName()
+					m.Update(deployment).Should(Succeed())
+					_, err := h.HandleDeployment(deployment)
+					Expect(err).NotTo(HaveOccurred())
+
+					// Get the updated Deployment
+					m.Get(deployment, timeout).Should(Succeed())
+				})
+
+				It("Removes the OwnerReference from the original ConfigMap", func() {
+					m.Eventually(cm1, timeout).ShouldNot(utils.WithOwnerReferences(ContainElement(ownerRef)))
+				})
+
+				It("Adds an OwnerReference to the new ConfigMap", func() {
+					m.Eventually(cm3, timeout).Should(utils.WithOwnerReferences(ContainElement(ownerRef)))
+				})
+
+				It("Doesn't change the config hash in the Pod Template", func() {
+					m.Consistently(deployment, consistentlyTimeout).Should(utils.WithPodTemplateAnnotations(HaveKeyWithValue(ConfigHashAnnotation, originalHash)))
+				})
+			})
+
+			Context("And a child is referenced by the extra children annotations", func() {
+				var originalHash string
+				var s3 *corev1.Secret
+
+				BeforeEach(func() {
+					m.Eventually(deployment, timeout).Should(utils.WithPodTemplateAnnotations(HaveKey(ConfigHashAnnotation)))
+					originalHash = deployment.Spec.Template.GetAnnotations()[ConfigHashAnnotation]
+
+					// Create a Secret which isn't referenced in the PodTemplate
+					s3 = utils.ExampleSecret1.DeepCopy()
+					s3.SetName("example3")
+					s3.StringData = map[string]string{"key1": "example3:key1"}
+					m.Create(s3).Should(Succeed())
+					m.Get(s3, timeout).Should(Succeed())
+
+					annotations := deployment.GetAnnotations()
+					annotations[ExtraSecretsAnnotation] = s3.GetName()
+					deployment.SetAnnotations(annotations)
+					m.Update(deployment).Should(Succeed())
+					_, err := h.HandleDeployment(deployment)
+					Expect(err).NotTo(HaveOccurred())
+
+					// Get the updated Deployment
+					m.Get(deployment, timeout).Should(Succeed())
+				})
+
+				It("Adds an OwnerReference to the Secret referenced in the annotation", func() {
+					m.Eventually(s3, timeout).Should(utils.WithOwnerReferences(ContainElement(ownerRef)))
+				})
+
+				It("Keeps the OwnerReference on the ConfigMap referenced in the PodTemplate", func() {
+					m.Consistently(cm1, consistentlyTimeout).Should(utils.WithOwnerReferences(ContainElement(ownerRef)))
+				})
+
+				It("Updates the config hash in the Pod Template", func() {
+					m.Eventually(deployment, timeout).ShouldNot(utils.WithPodTemplateAnnotations(HaveKeyWithValue(ConfigHashAnnotation, originalHash)))
+				})
+
+				Context("And the Secret referenced in the annotation is updated", func() {
+					var annotatedHash string
+
+					BeforeEach(func() {
+						annotatedHash = deployment.Spec.Template.GetAnnotations()[ConfigHashAnnotation]
+
+						m.Get(s3, timeout).Should(Succeed())
+						s3.Data["key1"] = []byte("modified")
+						m.Update(s3).Should(Succeed())
+
+						_, err := h.HandleDeployment(deployment)
+						Expect(err).NotTo(HaveOccurred())
+
+						// Get the updated Deployment
+						m.Get(deployment, timeout).Should(Succeed())
+					})
+
+					It("Updates the config hash in the Pod Template", func() {
+						m.Eventually(deployment, timeout).ShouldNot(utils.WithPodTemplateAnnotations(HaveKeyWithValue(ConfigHashAnnotation, annotatedHash)))
+					})
+				})
+			})
+
+			Context("And children are referenced by a projected volume", func() {
+				var originalHash string
+				var cm3 *corev1.ConfigMap
+				var s3 *corev1.Secret
+
+				BeforeEach(func() {
+					m.Eventually(deployment, timeout).Should(utils.WithPodTemplateAnnotations(HaveKey(ConfigHashAnnotation)))
+					originalHash = deployment.Spec.Template.GetAnnotations()[ConfigHashAnnotation]
+
+					// Create a ConfigMap and a Secret which are only referenced by
+					// the projected volume
+					cm3 = utils.ExampleConfigMap1.DeepCopy()
+					cm3.SetName("example3")
+					cm3.Data = map[string]string{"key1": "example3:key1"}
+					s3 = utils.ExampleSecret1.DeepCopy()
+					s3.SetName("example3")
+					s3.StringData = map[string]string{"key1": "example3:key1"}
+					for _, obj := range []Object{cm3, s3} {
+						m.Create(obj).Should(Succeed())
+						m.Get(obj, timeout).Should(Succeed())
+					}
+
+					deployment.Spec.Template.Spec.Volumes = append(deployment.Spec.Template.Spec.Volumes, corev1.Volume{
+						Name: "projected",
+						VolumeSource: corev1.VolumeSource{
+							Projected: &corev1.ProjectedVolumeSource{
+								Sources: []corev1.VolumeProjection{
+									{
+										ConfigMap: &corev1.ConfigMapProjection{
+											LocalObjectReference: corev1.LocalObjectReference{Name: cm3.GetName()},
+										},
+									},
+									{
+										Secret: &corev1.SecretProjection{
+											LocalObjectReference: corev1.LocalObjectReference{Name: s3.GetName()},
+										},
+									},
+								},
+							},
+						},
+					})
+					m.Update(deployment).Should(Succeed())
+					_, err := h.HandleDeployment(deployment)
+					Expect(err).NotTo(HaveOccurred())
+
+					// Get the updated Deployment
+					m.Get(deployment, timeout).Should(Succeed())
+				})
+
+				It("Adds an OwnerReference to the projected ConfigMap", func() {
+					m.Eventually(cm3, timeout).Should(utils.WithOwnerReferences(ContainElement(ownerRef)))
+				})
+
+				It("Adds an OwnerReference to the projected Secret", func() {
+					m.Eventually(s3, timeout).Should(utils.WithOwnerReferences(ContainElement(ownerRef)))
+				})
+
+				It("Updates the config hash in the Pod Template", func() {
+					m.Eventually(deployment, timeout).ShouldNot(utils.WithPodTemplateAnnotations(HaveKeyWithValue(ConfigHashAnnotation, originalHash)))
+				})
+
+				Context("And the projected ConfigMap is updated", func() {
+					var projectedHash string
+
+					BeforeEach(func() {
+						projectedHash = deployment.Spec.Template.GetAnnotations()[ConfigHashAnnotation]
+
+						m.Get(cm3, timeout).Should(Succeed())
+						cm3.Data["key1"] = "modified"
+						m.Update(cm3).Should(Succeed())
+						m.Eventually(cm3, timeout).Should(WithTransform(func(obj *corev1.ConfigMap) string {
+							return obj.Data["key1"]
+						}, Equal("modified")))
+
+						_, err := h.HandleDeployment(deployment)
+						Expect(err).NotTo(HaveOccurred())
+
+						// Get the updated Deployment
+						m.Get(deployment, timeout).Should(Succeed())
+					})
+
+					It("Updates the config hash in the Pod Template", func() {
+						m.Eventually(deployment, timeout).ShouldNot(utils.WithPodTemplateAnnotations(HaveKeyWithValue(ConfigHashAnnotation, projectedHash)))
+					})
+				})
+			})
+
+			Context("And a Secret is referenced by an init container", func() {
+				var originalHash string
+				var s3 *corev1.Secret
+
+				BeforeEach(func() {
+					m.Eventually(deployment, timeout).Should(utils.WithPodTemplateAnnotations(HaveKey(ConfigHashAnnotation)))
+					originalHash = deployment.Spec.Template.GetAnnotations()[ConfigHashAnnotation]
+
+					// Create a Secret which is only referenced by the init container
+					s3 = utils.ExampleSecret1.DeepCopy()
+					s3.SetName("example3")
+					s3.StringData = map[string]string{"key1": "example3:key1"}
+					m.Create(s3).Should(Succeed())
+					m.Get(s3, timeout).Should(Succeed())
+
+					deployment.Spec.Template.Spec.InitContainers = []corev1.Container{
+						{
+							Name:  "migrate",
+							Image: "migrate",
+							EnvFrom: []corev1.EnvFromSource{
+								{
+									SecretRef: &corev1.SecretEnvSource{
+										LocalObjectReference: corev1.LocalObjectReference{Name: s3.GetName()},
+									},
+								},
+							},
+						},
+					}
+					m.Update(deployment).Should(Succeed())
+					_, err := h.HandleDeployment(deployment)
+					Expect(err).NotTo(HaveOccurred())
+
+					// Get the updated Deployment
+					m.Get(deployment, timeout).Should(Succeed())
+				})
+
+				It("Adds an OwnerReference to the Secret", func() {
+					m.Eventually(s3, timeout).Should(utils.WithOwnerReferences(ContainElement(ownerRef)))
+				})
+
+				It("Updates the config hash in the Pod Template", func() {
+					m.Eventually(deployment, timeout).ShouldNot(utils.WithPodTemplateAnnotations(HaveKeyWithValue(ConfigHashAnnotation, originalHash)))
+				})
+
+				Context("And the Secret is updated", func() {
+					var initHash string
+
+					BeforeEach(func() {
+						initHash = deployment.Spec.Template.GetAnnotations()[ConfigHashAnnotation]
+
+						m.Get(s3, timeout).Should(Succeed())
+						s3.StringData = map[string]string{"key1": "modified"}
+						m.Update(s3).Should(Succeed())
+						m.Eventually(s3, timeout).Should(WithTransform(func(obj *corev1.Secret) string {
+							return string(obj.Data["key1"])
+						}, Equal("modified")))
+
+						_, err := h.HandleDeployment(deployment)
+						Expect(err).NotTo(HaveOccurred())
+
+						// Get the updated Deployment
+						m.Get(deployment, timeout).Should(Succeed())
+					})
+
+					It("Updates the config hash in the Pod Template", func() {
+						m.Eventually(deployment, timeout).ShouldNot(utils.WithPodTemplateAnnotations(HaveKeyWithValue(ConfigHashAnnotation, initHash)))
+					})
+				})
+			})
+
+			Context("And a Secret is referenced only by a volume's secretName", func() {
+				var originalHash string
+				var s3 *corev1.Secret
+
+				BeforeEach(func() {
+					m.Eventually(deployment, timeout).Should(utils.WithPodTemplateAnnotations(HaveKey(ConfigHashAnnotation)))
+					originalHash = deployment.Spec.Template.GetAnnotations()[ConfigHashAnnotation]
+
+					s3 = utils.ExampleSecret1.DeepCopy()
+					s3.SetName("example3")
+					s3.StringData = map[string]string{"key1": "example3:key1"}
+					m.Create(s3).Should(Succeed())
+					m.Get(s3, timeout).Should(Succeed())
+
+					deployment.Spec.Template.Spec.Volumes = append(deployment.Spec.Template.Spec.Volumes, corev1.Volume{
+						Name: "secret3",
+						VolumeSource: corev1.VolumeSource{
+							Secret: &corev1.SecretVolumeSource{SecretName: s3.GetName()},
+						},
+					})
+					m.Update(deployment).Should(Succeed())
+					_, err := h.HandleDeployment(deployment)
+					Expect(err).NotTo(HaveOccurred())
+
+					// Get the updated Deployment
+					m.Get(deployment, timeout).Should(Succeed())
+				})
+
+				It("Adds an OwnerReference to the Secret", func() {
+					m.Eventually(s3, timeout).Should(utils.WithOwnerReferences(ContainElement(ownerRef)))
+				})
+
+				It("Updates the config hash in the Pod Template", func() {
+					m.Eventually(deployment, timeout).ShouldNot(utils.WithPodTemplateAnnotations(HaveKeyWithValue(ConfigHashAnnotation, originalHash)))
+				})
+
+				Context("And the Secret is updated", func() {
+					var volumeHash string
+
+					BeforeEach(func() {
+						volumeHash = deployment.Spec.Template.GetAnnotations()[ConfigHashAnnotation]
+
+						m.Get(s3, timeout).Should(Succeed())
+						s3.StringData["key1"] = "modified"
+						m.Update(s3).Should(Succeed())
+						m.Eventually(s3, timeout).Should(WithTransform(func(obj *corev1.Secret) string {
+							return string(obj.Data["key1"])
+						}, Equal("modified")))
+
+						_, err := h.HandleDeployment(deployment)
+						Expect(err).NotTo(HaveOccurred())
+
+						// Get the updated Deployment
+						m.Get(deployment, timeout).Should(Succeed())
+					})
+
+					It("Updates the config hash in the Pod Template", func() {
+						m.Eventually(deployment, timeout).ShouldNot(utils.WithPodTemplateAnnotations(HaveKeyWithValue(ConfigHashAnnotation, volumeHash)))
+					})
+				})
+			})
+
+			Context("And a server-side default is injected into the Pod Template", func() {
+				var originalHash string
+
+				BeforeEach(func() {
+					m.Eventually(deployment, timeout).Should(utils.WithPodTemplateAnnotations(HaveKey(ConfigHashAnnotation)))
+					originalHash = deployment.Spec.Template.GetAnnotations()[ConfigHashAnnotation]
+
+					// Explicitly set the default mode the API server injects into
+					// ConfigMap and Secret volumes
+					defaultMode := int32(420)
+					for _, vol := range deployment.Spec.Template.Spec.Volumes {
+						if vol.ConfigMap != nil {
+							vol.ConfigMap.DefaultMode = &defaultMode
+						}
+						if vol.Secret != nil {
+							vol.Secret.DefaultMode = &defaultMode
+						}
+					}
+					m.Update(deployment).Should(Succeed())
+					_, err := h.HandleDeployment(deployment)
+					Expect(err).NotTo(HaveOccurred())
+
+					// Get the updated Deployment
+					m.Get(deployment, timeout).Should(Succeed())
+				})
+
+				It("Doesn't change the config hash in the Pod Template", func() {
+					m.Consistently(deployment, consistentlyTimeout).Should(utils.WithPodTemplateAnnotations(HaveKeyWithValue(ConfigHashAnnotation, originalHash)))
+				})
+			})
+
+			// Item modes aren't hashed, as the API server may default them.
+			// Both volumes are part of the PodTemplate, so changing the mode of
+			// either rolls the Deployment without needing to change the hash
+			Context("And two volumes mount the same key with different modes", func() {
+				var originalHash string
+				var generation int64
+
+				BeforeEach(func() {
+					m.Eventually(deployment, timeout).Should(utils.WithPodTemplateAnnotations(HaveKey(ConfigHashAnnotation)))
+					originalHash = deployment.Spec.Template.GetAnnotations()[ConfigHashAnnotation]
+
+					readOnly := int32(0400)
+					readWrite := int32(0644)
+					for name, mode := range map[string]*int32{"key1-read-only": &readOnly, "key1-read-write": &readWrite} {
+						deployment.Spec.Template.Spec.Volumes = append(deployment.Spec.Template.Spec.Volumes, corev1.Volume{
+							Name: name,
+							VolumeSource: corev1.VolumeSource{
+								ConfigMap: &corev1.ConfigMapVolumeSource{
+									LocalObjectReference: corev1.LocalObjectReference{Name: cm1.GetName()},
+									Items:                []corev1.KeyToPath{{Key: "key1", Path: "key1", Mode: mode}},
+								},
+							},
+						})
+					}
+					m.Update(deployment).Should(Succeed())
+					_, err := h.HandleDeployment(deployment)
+					Expect(err).NotTo(HaveOccurred())
+
+					// Get the updated Deployment
+					m.Get(deployment, timeout).Should(Succeed())
+					generation = deployment.GetGeneration()
+				})
+
+				It("Hashes the shared child once", func() {
+					m.Consistently(deployment, consistentlyTimeout).Should(utils.WithPodTemplateAnnotations(HaveKeyWithValue(ConfigHashAnnotation, originalHash)))
+					m.Eventually(cm1, timeout).Should(utils.WithOwnerReferences(ConsistOf(ownerRef)))
+				})
+
+				It("Rolls the Deployment when either mode is changed", func() {
+					for _, name := range []string{"key1-read-only", "key1-read-write"} {
+						m.Get(deployment, timeout).Should(Succeed())
+						for _, vol := range deployment.Spec.Template.Spec.Volumes {
+							if vol.Name == name {
+								mode := int32(0440)
+								vol.ConfigMap.Items[0].Mode = &mode
+							}
+						}
+						m.Update(deployment).Should(Succeed())
+						_, err := h.HandleDeployment(deployment)
+						Expect(err).NotTo(HaveOccurred())
+
+						m.Eventually(deployment, timeout).Should(WithTransform(func(obj *appsv1.Deployment) int64 {
+							return obj.GetGeneration()
+						}, BeNumerically(">", generation)))
+						generation = deployment.GetGeneration()
+					}
+				})
+			})
+
 			Context("And a child is updated", func() {
 				var originalHash string
 
@@ -289,6 +734,59 @@ var _ = Describe("Wave controller Suite", func() {
 						m.Eventually(deployment, timeout).ShouldNot(utils.WithAnnotations(HaveKeyWithValue(ConfigHashAnnotation, originalHash)))
 					})
 				})
+
+				// This Kubernetes API doesn't support immutable ConfigMaps, so this
+				// covers the closest case: a single update that changes the data
+				// alongside metadata, followed by updates that only change metadata
+				Context("A ConfigMap's data and metadata are updated together", func() {
+					var updatedHash string
+
+					BeforeEach(func() {
+						m.Get(cm1, timeout).Should(Succeed())
+						cm1.Data["key1"] = "modified"
+						cm1.SetLabels(map[string]string{"frozen": "true"})
+						m.Update(cm1).Should(Succeed())
+						m.Eventually(cm1, timeout).Should(utils.WithLabels(HaveKey("frozen")))
+
+						_, err := h.HandleDeployment(deployment)
+						Expect(err).NotTo(HaveOccurred())
+
+						// Get the updated Deployment
+						m.Eventually(deployment, timeout).ShouldNot(utils.WithPodTemplateAnnotations(HaveKeyWithValue(ConfigHashAnnotation, originalHash)))
+						updatedHash = deployment.Spec.Template.GetAnnotations()[ConfigHashAnnotation]
+					})
+
+					It("Updates the config hash in the Pod Template", func() {
+						Expect(updatedHash).NotTo(BeEmpty())
+						Expect(updatedHash).NotTo(Equal(originalHash))
+					})
+
+					Context("And later updates only change its metadata", func() {
+						var generation int64
+
+						BeforeEach(func() {
+							generation = deployment.GetGeneration()
+
+							m.Get(cm1, timeout).Should(Succeed())
+							cm1.SetLabels(map[string]string{"frozen": "true", "touched": "true"})
+							m.Update(cm1).Should(Succeed())
+							m.Eventually(cm1, timeout).Should(utils.WithLabels(HaveKey("touched")))
+
+							_, err := h.HandleDeployment(deployment)
+							Expect(err).NotTo(HaveOccurred())
+						})
+
+						It("Doesn't change the config hash in the Pod Template", func() {
+							m.Consistently(deployment, consistentlyTimeout).Should(utils.WithPodTemplateAnnotations(HaveKeyWithValue(ConfigHashAnnotation, updatedHash)))
+						})
+
+						It("Doesn't roll the Deployment", func() {
+							m.Consistently(deployment, consistentlyTimeout).Should(WithTransform(func(obj *appsv1.Deployment) int64 {
+								return obj.GetGeneration()
+							}, Equal(generation)))
+						})
+					})
+				})
 			})
 
 			Context("And the annotation is removed", func() {
@@ -339,6 +837,2514 @@ var _ = Describe("Wave controller Suite", func() {
 			})
 		})
 
+		Context("And it uses the env rollout trigger", func() {
+			// containerHashes returns the value of the config hash env var in
+			// each container
+			var containerHashes = func(obj *appsv1.Deployment) []string {
+				hashes := []string{}
+				for _, container := range obj.Spec.Template.Spec.Containers {
+					value := ""
+					for _, env := range container.Env {
+						if env.Name == ConfigHashEnvVar {
+							value = env.Value
+						}
+					}
+					hashes = append(hashes, value)
+				}
+				return hashes
+			}
+
+			BeforeEach(func() {
+				deployment.SetAnnotations(map[string]string{
+					RequiredAnnotation:       "true",
+					RolloutTriggerAnnotation: string(RolloutTriggerEnvVar),
+				})
+
+				m.Update(deployment).Should(Succeed())
+				_, err := h.HandleDeployment(deployment)
+				Expect(err).NotTo(HaveOccurred())
+
+				// Get the updated Deployment
+				m.Get(deployment, timeout).Should(Succeed())
+			})
+
+			It("Adds the config hash env var to all containers", func() {
+				hash := exampleHash
+				m.Eventually(deployment, timeout).Should(WithTransform(containerHashes, ConsistOf(hash, hash)))
+			})
+
+			It("Doesn't add a config hash to the Pod Template annotations", func() {
+				m.Consistently(deployment, consistentlyTimeout).ShouldNot(utils.WithPodTemplateAnnotations(HaveKey(ConfigHashAnnotation)))
+			})
+
+			Context("And a child is updated", func() {
+				var originalHashes []string
+				var originalGeneration int64
+
+				BeforeEach(func() {
+					originalHashes = containerHashes(deployment)
+					originalGeneration = deployment.GetGeneration()
+
+					m.Get(cm1, timeout).Should(Succeed())
+					cm1.Data["key1"] = "modified"
+					m.Update(cm1).Should(Succeed())
+
+					_, err := h.HandleDeployment(deployment)
+					Expect(err).NotTo(HaveOccurred())
+
+					// Get the updated Deployment
+					m.Get(deployment, timeout).Should(Succeed())
+				})
+
+				It("Updates the config hash env var in all containers", func() {
+					m.Eventually(deployment, timeout).Should(WithTransform(containerHashes, SatisfyAll(
+						HaveLen(2),
+						Not(ContainElement(originalHashes[0])),
+						Not(ContainElement("")),
+					)))
+				})
+
+				It("Triggers a rollout of the Deployment", func() {
+					m.Eventually(deployment, timeout).Should(WithTransform(func(obj *appsv1.Deployment) int64 {
+						return obj.GetGeneration()
+					}, BeNumerically(">", originalGeneration)))
+				})
+			})
+		})
+
+		Context("And the required annotation has a configured value", func() {
+			BeforeEach(func() {
+				h.options.RequiredAnnotationValues = []string{"true", "enabled"}
+			})
+
+			for _, value := range []string{"true", "enabled"} {
+				value := value
+
+				It("Manages the Deployment when the value is "+value, func() {
+					deployment.SetAnnotations(map[string]string{RequiredAnnotation: value})
+					m.Update(deployment).Should(Succeed())
+					_, err := h.HandleDeployment(deployment)
+					Expect(err).NotTo(HaveOccurred())
+
+					m.Eventually(deployment, timeout).Should(utils.WithFinalizers(ContainElement(FinalizerString)))
+					m.Eventually(deployment, timeout).Should(utils.WithPodTemplateAnnotations(HaveKey(ConfigHashAnnotation)))
+				})
+			}
+
+			It("Doesn't manage the Deployment when the value is false", func() {
+				deployment.SetAnnotations(map[string]string{RequiredAnnotation: "false"})
+				m.Update(deployment).Should(Succeed())
+				_, err := h.HandleDeployment(deployment)
+				Expect(err).NotTo(HaveOccurred())
+
+				m.Consistently(deployment, consistentlyTimeout).ShouldNot(utils.WithFinalizers(ContainElement(FinalizerString)))
+			})
+		})
+
+		Context("And it has the skip finalizer annotation", func() {
+			BeforeEach(func() {
+				deployment.SetAnnotations(map[string]string{
+					RequiredAnnotation:      "true",
+					SkipFinalizerAnnotation: "true",
+				})
+
+				m.Update(deployment).Should(Succeed())
+				_, err := h.HandleDeployment(deployment)
+				Expect(err).NotTo(HaveOccurred())
+
+				// Get the updated Deployment
+				m.Get(deployment, timeout).Should(Succeed())
+			})
+
+			It("Adds OwnerReferences to all children", func() {
+				for _, obj := range []Object{cm1, cm2, s1, s2} {
+					m.Eventually(obj, timeout).Should(utils.WithOwnerReferences(ContainElement(ownerRef)))
+				}
+			})
+
+			It("Adds a config hash to the Pod Template", func() {
+				m.Eventually(deployment, timeout).Should(utils.WithPodTemplateAnnotations(HaveKey(ConfigHashAnnotation)))
+			})
+
+			It("Doesn't add a finalizer to the Deployment", func() {
+				m.Consistently(deployment, consistentlyTimeout).ShouldNot(utils.WithFinalizers(ContainElement(FinalizerString)))
+			})
+
+			Context("And is deleted", func() {
+				BeforeEach(func() {
+					m.Delete(deployment).Should(Succeed())
+				})
+
+				It("Is deleted immediately", func() {
+					m.Get(deployment, timeout).ShouldNot(Succeed())
+				})
+			})
+		})
+
+		Context("And a child version label is configured", func() {
+			var originalHash string
+
+			BeforeEach(func() {
+				h.options.ChildVersionLabel = "config-version"
+
+				m.Get(cm1, timeout).Should(Succeed())
+				cm1.SetLabels(map[string]string{"config-version": "1"})
+				m.Update(cm1).Should(Succeed())
+				m.Eventually(cm1, timeout).Should(utils.WithLabels(HaveKeyWithValue("config-version", "1")))
+
+				deployment.SetAnnotations(map[string]string{RequiredAnnotation: "true"})
+				m.Update(deployment).Should(Succeed())
+				_, err := h.HandleDeployment(deployment)
+				Expect(err).NotTo(HaveOccurred())
+
+				m.Eventually(deployment, timeout).Should(utils.WithPodTemplateAnnotations(HaveKey(ConfigHashAnnotation)))
+				originalHash = deployment.Spec.Template.GetAnnotations()[ConfigHashAnnotation]
+			})
+
+			It("Includes the label in the config hash", func() {
+				withoutLabel, err := calculateConfigHash([]Object{cm1, cm2, s1, s2})
+				Expect(err).NotTo(HaveOccurred())
+				Expect(originalHash).NotTo(Equal(withoutLabel))
+			})
+
+			Context("And the label is bumped without changing the data", func() {
+				BeforeEach(func() {
+					m.Get(cm1, timeout).Should(Succeed())
+					cm1.SetLabels(map[string]string{"config-version": "2"})
+					m.Update(cm1).Should(Succeed())
+					m.Eventually(cm1, timeout).Should(utils.WithLabels(HaveKeyWithValue("config-version", "2")))
+
+					_, err := h.HandleDeployment(deployment)
+					Expect(err).NotTo(HaveOccurred())
+				})
+
+				It("Updates the config hash in the Pod Template", func() {
+					m.Eventually(deployment, timeout).ShouldNot(utils.WithPodTemplateAnnotations(HaveKeyWithValue(ConfigHashAnnotation, originalHash)))
+				})
+			})
+
+			Context("And another label is changed", func() {
+				BeforeEach(func() {
+					m.Get(cm1, timeout).Should(Succeed())
+					cm1.SetLabels(map[string]string{"config-version": "1", "other": "changed"})
+					m.Update(cm1).Should(Succeed())
+					m.Eventually(cm1, timeout).Should(utils.WithLabels(HaveKey("other")))
+
+					_, err := h.HandleDeployment(deployment)
+					Expect(err).NotTo(HaveOccurred())
+				})
+
+				It("Doesn't change the config hash in the Pod Template", func() {
+					m.Consistently(deployment, consistentlyTimeout).Should(utils.WithPodTemplateAnnotations(HaveKeyWithValue(ConfigHashAnnotation, originalHash)))
+				})
+			})
+		})
+
+		Context("And it is adopted without a rollout", func() {
+			var generation int64
+
+			BeforeEach(func() {
+				h.options.AdoptWithoutRollout = true
+
+				deployment.SetAnnotations(map[string]string{RequiredAnnotation: "true"})
+				m.Update(deployment).Should(Succeed())
+				m.Get(deployment, timeout).Should(Succeed())
+				generation = deployment.GetGeneration()
+
+				_, err := h.HandleDeployment(deployment)
+				Expect(err).NotTo(HaveOccurred())
+
+				m.Eventually(deployment, timeout).Should(utils.WithAnnotations(HaveKey(AdoptedConfigHashAnnotation)))
+			})
+
+			It("Doesn't change the Deployment's generation", func() {
+				m.Consistently(deployment, consistentlyTimeout).Should(WithTransform(func(obj *appsv1.Deployment) int64 {
+					return obj.GetGeneration()
+				}, Equal(generation)))
+			})
+
+			It("Records the config hash on the Deployment's metadata", func() {
+				m.Consistently(deployment, consistentlyTimeout).Should(utils.WithAnnotations(HaveKeyWithValue(AdoptedConfigHashAnnotation, exampleHash)))
+				m.Consistently(deployment, consistentlyTimeout).ShouldNot(utils.WithPodTemplateAnnotations(HaveKey(ConfigHashAnnotation)))
+			})
+
+			It("Adds OwnerReferences to all children and a finalizer", func() {
+				for _, obj := range []Object{cm1, cm2, s1, s2} {
+					m.Eventually(obj, timeout).Should(utils.WithOwnerReferences(ContainElement(ownerRef)))
+				}
+				m.Eventually(deployment, timeout).Should(utils.WithFinalizers(ContainElement(FinalizerString)))
+			})
+
+			It("Sends an Adopted event", func() {
+				events := &corev1.EventList{}
+				eventReason := func(event *corev1.Event) string {
+					return event.Reason
+				}
+				m.Eventually(events, timeout).Should(utils.WithItems(ContainElement(WithTransform(eventReason, Equal("Adopted")))))
+			})
+
+			Context("And it is reconciled again without changes", func() {
+				BeforeEach(func() {
+					_, err := h.HandleDeployment(deployment)
+					Expect(err).NotTo(HaveOccurred())
+				})
+
+				It("Doesn't change the Deployment's generation", func() {
+					m.Consistently(deployment, consistentlyTimeout).Should(WithTransform(func(obj *appsv1.Deployment) int64 {
+						return obj.GetGeneration()
+					}, Equal(generation)))
+				})
+			})
+
+			Context("And a child is updated", func() {
+				BeforeEach(func() {
+					m.Get(cm1, timeout).Should(Succeed())
+					cm1.Data["key1"] = "modified"
+					m.Update(cm1).Should(Succeed())
+					m.Eventually(cm1, timeout).Should(WithTransform(func(obj *corev1.ConfigMap) string {
+						return obj.Data["key1"]
+					}, Equal("modified")))
+
+					_, err := h.HandleDeployment(deployment)
+					Expect(err).NotTo(HaveOccurred())
+				})
+
+				It("Records the config hash in the Pod Template and rolls the Deployment", func() {
+					m.Eventually(deployment, timeout).Should(utils.WithPodTemplateAnnotations(HaveKey(ConfigHashAnnotation)))
+					Expect(deployment.GetGeneration()).To(BeNumerically(">", generation))
+				})
+
+				It("Removes the adoption annotation", func() {
+					m.Eventually(deployment, timeout).ShouldNot(utils.WithAnnotations(HaveKey(AdoptedConfigHashAnnotation)))
+				})
+			})
+		})
+
+		Context("And config hashing is disabled", func() {
+			BeforeEach(func() {
+				h.options.DisableConfigHash = true
+
+				deployment.SetAnnotations(map[string]string{RequiredAnnotation: "true"})
+				m.Update(deployment).Should(Succeed())
+				_, err := h.HandleDeployment(deployment)
+				Expect(err).NotTo(HaveOccurred())
+
+				// Get the updated Deployment
+				m.Get(deployment, timeout).Should(Succeed())
+			})
+
+			It("Adds OwnerReferences to all children", func() {
+				for _, obj := range []Object{cm1, cm2, s1, s2} {
+					m.Eventually(obj, timeout).Should(utils.WithOwnerReferences(ContainElement(ownerRef)))
+				}
+			})
+
+			It("Adds a finalizer to the Deployment", func() {
+				m.Eventually(deployment, timeout).Should(utils.WithFinalizers(ContainElement(FinalizerString)))
+			})
+
+			It("Doesn't add a config hash to the Deployment", func() {
+				m.Consistently(deployment, consistentlyTimeout).ShouldNot(utils.WithPodTemplateAnnotations(HaveKey(ConfigHashAnnotation)))
+				m.Consistently(deployment, consistentlyTimeout).ShouldNot(utils.WithAnnotations(HaveKey(ConfigHashAnnotation)))
+			})
+
+			Context("And a child is updated", func() {
+				BeforeEach(func() {
+					m.Get(cm1, timeout).Should(Succeed())
+					cm1.Data["key1"] = "modified"
+					m.Update(cm1).Should(Succeed())
+
+					_, err := h.HandleDeployment(deployment)
+					Expect(err).NotTo(HaveOccurred())
+
+					// Get the updated Deployment
+					m.Get(deployment, timeout).Should(Succeed())
+				})
+
+				It("Doesn't add a config hash to the Deployment", func() {
+					m.Consistently(deployment, consistentlyTimeout).ShouldNot(utils.WithPodTemplateAnnotations(HaveKey(ConfigHashAnnotation)))
+					m.Consistently(deployment, consistentlyTimeout).ShouldNot(utils.WithAnnotations(HaveKey(ConfigHashAnnotation)))
+				})
+
+				It("Keeps the OwnerReferences on all children", func() {
+					for _, obj := range []Object{cm1, cm2, s1, s2} {
+						m.Consistently(obj, consistentlyTimeout).Should(utils.WithOwnerReferences(ContainElement(ownerRef)))
+					}
+				})
+			})
+
+			Context("And a child is removed", func() {
+				BeforeEach(func() {
+					// Remove "container2" which references Secret example2 and ConfigMap
+					// example2
+					containers := deployment.Spec.Template.Spec.Containers
+					Expect(containers[0].Name).To(Equal("container1"))
+					deployment.Spec.Template.Spec.Containers = []corev1.Container{containers[0]}
+					m.Update(deployment).Should(Succeed())
+					_, err := h.HandleDeployment(deployment)
+					Expect(err).NotTo(HaveOccurred())
+				})
+
+				It("Removes the OwnerReference from the orphaned ConfigMap", func() {
+					m.Eventually(cm2, timeout).ShouldNot(utils.WithOwnerReferences(ContainElement(ownerRef)))
+				})
+			})
+		})
+
+		Context("And rollouts are paused by the PauseConfigMap", func() {
+			var index *ChildIndex
+			var pause *corev1.ConfigMap
+
+			var setPaused = func(paused bool) {
+				m.Get(pause, timeout).Should(Succeed())
+				annotations := map[string]string{}
+				if paused {
+					annotations[PauseAnnotation] = "true"
+				}
+				pause.SetAnnotations(annotations)
+				m.Update(pause).Should(Succeed())
+
+				// Wait for the cache to observe the change
+				if paused {
+					m.Eventually(pause, timeout).Should(utils.WithAnnotations(HaveKeyWithValue(PauseAnnotation, "true")))
+				} else {
+					m.Eventually(pause, timeout).Should(utils.WithAnnotations(Not(HaveKey(PauseAnnotation))))
+				}
+			}
+
+			BeforeEach(func() {
+				pause = &corev1.ConfigMap{
+					ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "wave-pause"},
+				}
+				index = NewChildIndex()
+				h = NewHandler(c, mgr.GetRecorder("wave"), Options{
+					ChildIndex:     index,
+					PauseConfigMap: types.NamespacedName{Namespace: pause.GetNamespace(), Name: pause.GetName()},
+				})
+				m.Create(pause).Should(Succeed())
+				m.Get(pause, timeout).Should(Succeed())
+
+				deployment.SetAnnotations(map[string]string{RequiredAnnotation: "true"})
+				m.Update(deployment).Should(Succeed())
+				Expect(handle()).To(Equal(exampleHash))
+			})
+
+			It("Indexes the PauseConfigMap for the Deployment without hashing it", func() {
+				Expect(index.WorkloadsFor(pause, &appsv1.Deployment{})).To(ConsistOf(
+					types.NamespacedName{Namespace: deployment.GetNamespace(), Name: deployment.GetName()},
+				))
+				m.Get(pause, timeout).Should(Succeed())
+				Expect(pause.GetOwnerReferences()).To(BeEmpty())
+			})
+
+			Context("And a child changes while rollouts are paused", func() {
+				BeforeEach(func() {
+					setPaused(true)
+					modifyConfigMap(cm1)
+				})
+
+				It("Defers the hash update", func() {
+					Consistently(handle, consistentlyTimeout).Should(Equal(exampleHash))
+				})
+
+				It("Applies the hash update once rollouts are resumed", func() {
+					Expect(handle()).To(Equal(exampleHash))
+
+					setPaused(false)
+					Eventually(handle, timeout).ShouldNot(Equal(exampleHash))
+				})
+			})
+		})
+
+		Context("And only a child's metadata changes", func() {
+			var original string
+
+			// relabelConfigMap updates only the metadata of the ConfigMap and
+			// waits for the cache to observe the change
+			var relabelConfigMap = func() {
+				m.Get(cm1, timeout).Should(Succeed())
+				cm1.SetLabels(map[string]string{"relabelled": "true"})
+				m.Update(cm1).Should(Succeed())
+				m.Eventually(cm1, timeout).Should(utils.WithLabels(HaveKeyWithValue("relabelled", "true")))
+			}
+
+			BeforeEach(func() {
+				deployment.SetAnnotations(map[string]string{RequiredAnnotation: "true"})
+				m.Update(deployment).Should(Succeed())
+			})
+
+			It("Doesn't roll the Deployment by default", func() {
+				original = handle()
+				Expect(original).NotTo(BeEmpty())
+
+				relabelConfigMap()
+				Expect(handle()).To(Equal(original))
+			})
+
+			Context("And resourceVersions are hashed", func() {
+				BeforeEach(func() {
+					h = NewHandler(c, mgr.GetRecorder("wave"), Options{HashResourceVersions: true})
+					original = handle()
+					Expect(original).NotTo(BeEmpty())
+				})
+
+				It("Rolls the Deployment", func() {
+					relabelConfigMap()
+					Expect(handle()).NotTo(Equal(original))
+				})
+
+				It("Doesn't roll the Deployment when another Deployment starts referencing its children", func() {
+					// Reconciling the second Deployment adds its OwnerReference to
+					// the children of the first
+					second := utils.ExampleDeployment.DeepCopy()
+					second.SetName("example-second")
+					second.SetAnnotations(map[string]string{RequiredAnnotation: "true"})
+					m.Create(second).Should(Succeed())
+					m.Get(second, timeout).Should(Succeed())
+					_, err := h.HandleDeployment(second)
+					Expect(err).NotTo(HaveOccurred())
+					m.Eventually(cm1, timeout).Should(utils.WithOwnerReferences(ContainElement(utils.GetOwnerRef(second))))
+
+					Expect(handle()).To(Equal(original))
+					m.Get(second, timeout).Should(Succeed())
+					Expect(second.Spec.Template.GetAnnotations()).To(HaveKeyWithValue(ConfigHashAnnotation, original))
+
+					// Make sure to delete the finalizer so the Deployment can be
+					// deleted
+					second.SetFinalizers([]string{})
+					m.Update(second).Should(Succeed())
+				})
+			})
+		})
+
+		Context("And a required source is missing", func() {
+			var index *ChildIndex
+
+			BeforeEach(func() {
+				index = NewChildIndex()
+				h = NewHandler(c, recorder, Options{ChildIndex: index})
+
+				// A required source that is missing, followed by an optional
+				// source that is present
+				optional := true
+				deployment.SetAnnotations(map[string]string{RequiredAnnotation: "true"})
+				deployment.Spec.Template.Spec.Containers[0].EnvFrom = []corev1.EnvFromSource{
+					{
+						ConfigMapRef: &corev1.ConfigMapEnvSource{
+							LocalObjectReference: corev1.LocalObjectReference{Name: "missing"},
+						},
+					},
+					{
+						ConfigMapRef: &corev1.ConfigMapEnvSource{
+							LocalObjectReference: corev1.LocalObjectReference{Name: cm1.GetName()},
+							Optional:             &optional,
+						},
+					},
+				}
+				m.Update(deployment).Should(Succeed())
+				m.Get(deployment, timeout).Should(Succeed())
+			})
+
+			It("Fails the reconcile on the missing required source", func() {
+				_, err := h.HandleDeployment(deployment)
+				Expect(err).To(HaveOccurred())
+				Expect(err.Error()).To(ContainSubstring("\"missing\" not found"))
+
+				// The Deployment isn't managed until all of its required children
+				// exist
+				m.Get(deployment, timeout).Should(Succeed())
+				Expect(deployment.GetFinalizers()).To(BeEmpty())
+			})
+
+			It("Sends a Warning naming the missing source", func() {
+				h.HandleDeployment(deployment)
+				Expect(receivedEvents()).To(ContainElement(And(
+					HavePrefix("Warning ChildNotFound"),
+					ContainSubstring("\"missing\" not found"),
+				)))
+			})
+
+			It("Still discovers the optional source after the missing one", func() {
+				configMaps, _, err := h.getChildKeys(deployment)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(configMaps).To(HaveKey(types.NamespacedName{Namespace: deployment.GetNamespace(), Name: "missing"}))
+				Expect(configMaps).To(HaveKey(types.NamespacedName{Namespace: deployment.GetNamespace(), Name: cm1.GetName()}))
+
+				h.HandleDeployment(deployment)
+				Expect(index.WorkloadsFor(cm1, &appsv1.Deployment{})).To(ConsistOf(
+					types.NamespacedName{Namespace: deployment.GetNamespace(), Name: deployment.GetName()},
+				))
+			})
+		})
+
+		Context("And only some volumes are hashed", func() {
+			BeforeEach(func() {
+				// Mount both ConfigMaps, but only hash the first
+				deployment.SetAnnotations(map[string]string{
+					RequiredAnnotation:    "true",
+					HashVolumesAnnotation: "configmap1",
+				})
+				deployment.Spec.Template.Spec.Volumes = append(deployment.Spec.Template.Spec.Volumes, corev1.Volume{
+					Name: "configmap2",
+					VolumeSource: corev1.VolumeSource{
+						ConfigMap: &corev1.ConfigMapVolumeSource{
+							LocalObjectReference: corev1.LocalObjectReference{Name: cm2.GetName()},
+						},
+					},
+				})
+				m.Update(deployment).Should(Succeed())
+			})
+
+			It("Only hashes the children of the listed volumes", func() {
+				expected, err := calculateConfigHash([]Object{cm1})
+				Expect(err).NotTo(HaveOccurred())
+				Expect(handle()).To(Equal(expected))
+			})
+
+			It("Adds OwnerReferences to the children of unlisted volumes", func() {
+				handle()
+				m.Eventually(cm2, timeout).Should(utils.WithOwnerReferences(ContainElement(utils.GetOwnerRef(deployment))))
+			})
+
+			It("Doesn't roll the Deployment when a child of an unlisted volume changes", func() {
+				original := handle()
+				modifyConfigMap(cm2)
+				Expect(handle()).To(Equal(original))
+			})
+
+			It("Rolls the Deployment when a child of a listed volume changes", func() {
+				original := handle()
+				modifyConfigMap(cm1)
+				Expect(handle()).NotTo(Equal(original))
+			})
+
+			It("Fails to reconcile if a listed volume doesn't exist", func() {
+				m.Get(deployment, timeout).Should(Succeed())
+				deployment.GetAnnotations()[HashVolumesAnnotation] = "configmap1,missing"
+				_, err := h.HandleDeployment(deployment)
+				Expect(err).To(HaveOccurred())
+				Expect(err.Error()).To(ContainSubstring("unknown volume \"missing\""))
+			})
+		})
+
+		Context("And it references no children", func() {
+			BeforeEach(func() {
+				// An annotated Deployment without any volumes or envFrom sources
+				deployment.SetAnnotations(map[string]string{RequiredAnnotation: "true"})
+				deployment.Spec.Template.Spec.Volumes = nil
+				for i := range deployment.Spec.Template.Spec.Containers {
+					deployment.Spec.Template.Spec.Containers[i].EnvFrom = nil
+				}
+				m.Update(deployment).Should(Succeed())
+			})
+
+			Context("With ZeroChildrenManage", func() {
+				BeforeEach(func() {
+					h = NewHandler(c, recorder, Options{ZeroChildrenPolicy: ZeroChildrenManage})
+				})
+
+				It("Manages the Deployment", func() {
+					Expect(handle()).NotTo(BeEmpty())
+					Expect(deployment.GetFinalizers()).To(ContainElement(FinalizerString))
+				})
+			})
+
+			Context("With ZeroChildrenSkip", func() {
+				BeforeEach(func() {
+					h = NewHandler(c, recorder, Options{ZeroChildrenPolicy: ZeroChildrenSkip})
+				})
+
+				It("Doesn't manage the Deployment", func() {
+					Expect(handle()).To(BeEmpty())
+					Expect(deployment.GetFinalizers()).NotTo(ContainElement(FinalizerString))
+				})
+
+				It("Sends an event explaining why", func() {
+					handle()
+					Expect(receivedEvents()).To(ContainElement(
+						"Normal NoChildren Deployment references no ConfigMaps or Secrets, not managing it",
+					))
+				})
+
+				It("Removes the finalizer of a Deployment managed previously", func() {
+					skip := h
+					h = NewHandler(c, recorder, Options{ZeroChildrenPolicy: ZeroChildrenManage})
+					handle()
+					Expect(deployment.GetFinalizers()).To(ContainElement(FinalizerString))
+
+					h = skip
+					handle()
+					Expect(deployment.GetFinalizers()).NotTo(ContainElement(FinalizerString))
+				})
+			})
+		})
+
+		Context("And it mounts a TLS Secret with TLS rotation events enabled", func() {
+			var tls *corev1.Secret
+
+			BeforeEach(func() {
+				h = NewHandler(c, recorder, Options{TLSRotationEvents: true})
+
+				tls = &corev1.Secret{
+					ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "example-tls"},
+					Type:       corev1.SecretTypeTLS,
+					Data: map[string][]byte{
+						corev1.TLSCertKey:       []byte("certificate"),
+						corev1.TLSPrivateKeyKey: []byte("key"),
+					},
+				}
+				m.Create(tls).Should(Succeed())
+				m.Get(tls, timeout).Should(Succeed())
+
+				deployment.SetAnnotations(map[string]string{RequiredAnnotation: "true"})
+				deployment.Spec.Template.Spec.Volumes = append(deployment.Spec.Template.Spec.Volumes, corev1.Volume{
+					Name: "tls",
+					VolumeSource: corev1.VolumeSource{
+						Secret: &corev1.SecretVolumeSource{SecretName: tls.GetName()},
+					},
+				})
+				m.Update(deployment).Should(Succeed())
+			})
+
+			Context("And the TLS Secret is rotated", func() {
+				var originalHash string
+
+				BeforeEach(func() {
+					originalHash = handle()
+					Expect(originalHash).NotTo(BeEmpty())
+					receivedEvents()
+
+					m.Get(tls, timeout).Should(Succeed())
+					tls.Data[corev1.TLSCertKey] = []byte("renewed certificate")
+					m.Update(tls).Should(Succeed())
+					m.Eventually(tls, timeout).Should(WithTransform(func(obj *corev1.Secret) string {
+						return string(obj.Data[corev1.TLSCertKey])
+					}, Equal("renewed certificate")))
+				})
+
+				It("Rolls the Deployment", func() {
+					Expect(handle()).NotTo(Equal(originalHash))
+				})
+
+				It("Sends a TLSRotated event naming the Secret", func() {
+					hash := handle()
+					Expect(receivedEvents()).To(ConsistOf(
+						"Normal TLSRotated TLS Secret(s) example-tls rotated, configuration hash updated to " + hash,
+					))
+				})
+			})
+
+			Context("And another Secret changes", func() {
+				It("Sends a ConfigChanged event", func() {
+					handle()
+					receivedEvents()
+
+					m.Get(s1, timeout).Should(Succeed())
+					s1.StringData["key1"] = "modified"
+					m.Update(s1).Should(Succeed())
+					m.Eventually(s1, timeout).Should(WithTransform(func(obj *corev1.Secret) string {
+						return string(obj.Data["key1"])
+					}, Equal("modified")))
+
+					hash := handle()
+					Expect(receivedEvents()).To(ConsistOf(
+						"Normal ConfigChanged Configuration hash updated to " + hash,
+					))
+				})
+			})
+		})
+
+		Context("And a dry run Handler is used", func() {
+			var dryRun *Handler
+
+			// handleDryRun reconciles the latest version of the Deployment with
+			// the dry run Handler and returns the hash recorded on it
+			var handleDryRun = func() string {
+				m.Get(deployment, timeout).Should(Succeed())
+				_, err := dryRun.HandleDeployment(deployment)
+				Expect(err).NotTo(HaveOccurred())
+				m.Get(deployment, timeout).Should(Succeed())
+				return deployment.Spec.Template.GetAnnotations()[ConfigHashAnnotation]
+			}
+
+			BeforeEach(func() {
+				h = NewHandler(c, recorder, Options{})
+				dryRun = NewHandler(c, recorder, Options{DryRun: true, WaveStatus: true})
+
+				deployment.SetAnnotations(map[string]string{RequiredAnnotation: "true"})
+				m.Update(deployment).Should(Succeed())
+			})
+
+			AfterEach(func() {
+				utils.DeleteAll(cfg, timeout,
+					&wavev1alpha1.WaveStatusList{},
+				)
+			})
+
+			Context("And the Deployment has never been reconciled", func() {
+				BeforeEach(func() {
+					Expect(handleDryRun()).To(BeEmpty())
+				})
+
+				It("Reports the hash it would record and every child", func() {
+					Expect(receivedEvents()).To(ConsistOf(
+						fmt.Sprintf("Normal DryRun Dry run: would update configuration hash from \"\" to %q, changed children: "+
+							"ConfigMap default/example1, ConfigMap default/example2, Secret default/example1, Secret default/example2", exampleHash),
+						"Normal DryRun Dry run: would add OwnerReferences to "+
+							"ConfigMap default/example1, ConfigMap default/example2, Secret default/example1, Secret default/example2",
+					))
+				})
+
+				It("Doesn't add the finalizer to the Deployment", func() {
+					Expect(deployment.GetFinalizers()).NotTo(ContainElement(FinalizerString))
+				})
+
+				It("Doesn't add OwnerReferences to the children", func() {
+					m.Get(cm1, timeout).Should(Succeed())
+					Expect(cm1.GetOwnerReferences()).To(BeEmpty())
+				})
+
+				It("Doesn't create a WaveStatus", func() {
+					key := types.NamespacedName{Namespace: deployment.GetNamespace(), Name: waveStatusName(deployment)}
+					err := c.Get(context.TODO(), key, &wavev1alpha1.WaveStatus{})
+					Expect(errors.IsNotFound(err)).To(BeTrue())
+				})
+
+				Context("And it is reconciled again", func() {
+					var resourceVersion string
+					var events []string
+
+					BeforeEach(func() {
+						resourceVersion = deployment.GetResourceVersion()
+						events = receivedEvents()
+
+						Expect(handleDryRun()).To(BeEmpty())
+					})
+
+					It("Doesn't update the Deployment", func() {
+						Expect(deployment.GetResourceVersion()).To(Equal(resourceVersion))
+					})
+
+					It("Reports the same changes again", func() {
+						Expect(receivedEvents()).To(ConsistOf(events))
+					})
+				})
+			})
+
+			Context("And Wave is disabled for a managed Deployment", func() {
+				BeforeEach(func() {
+					Expect(handle()).To(Equal(exampleHash))
+					receivedEvents()
+
+					deployment.SetAnnotations(map[string]string{})
+					m.Update(deployment).Should(Succeed())
+					m.Eventually(deployment, timeout).Should(utils.WithAnnotations(Not(HaveKey(RequiredAnnotation))))
+
+					handleDryRun()
+				})
+
+				It("Reports the OwnerReferences and finalizer it would remove", func() {
+					Expect(receivedEvents()).To(ConsistOf(
+						"Normal DryRun Dry run: would remove OwnerReferences from "+
+							"ConfigMap default/example1, ConfigMap default/example2, Secret default/example1, Secret default/example2",
+						fmt.Sprintf("Normal DryRun Dry run: would remove finalizer %s", FinalizerString),
+					))
+				})
+
+				It("Keeps the finalizer on the Deployment", func() {
+					Expect(deployment.GetFinalizers()).To(ContainElement(FinalizerString))
+				})
+
+				It("Keeps the OwnerReferences on the children", func() {
+					m.Get(cm1, timeout).Should(Succeed())
+					Expect(cm1.GetOwnerReferences()).To(ContainElement(utils.GetOwnerRef(deployment)))
+				})
+			})
+
+			Context("And a child of a managed Deployment changes", func() {
+				var resourceVersion string
+
+				BeforeEach(func() {
+					Expect(handle()).To(Equal(exampleHash))
+					Expect(handleDryRun()).To(Equal(exampleHash))
+					resourceVersion = deployment.GetResourceVersion()
+					receivedEvents()
+
+					modifyConfigMap(cm1)
+
+					Expect(handleDryRun()).To(Equal(exampleHash))
+				})
+
+				It("Doesn't update the Deployment", func() {
+					Expect(deployment.GetResourceVersion()).To(Equal(resourceVersion))
+				})
+
+				It("Names the changed child again on the next dry run", func() {
+					events := receivedEvents()
+					Expect(events).To(HaveLen(1))
+
+					Expect(handleDryRun()).To(Equal(exampleHash))
+					Expect(receivedEvents()).To(ConsistOf(events))
+				})
+
+				It("Reports the changed child and the hash that would be recorded", func() {
+					events := receivedEvents()
+
+					// Reconciling without the dry run records the prospective hash
+					hash := handle()
+					Expect(hash).NotTo(Equal(exampleHash))
+					Expect(events).To(ConsistOf(
+						fmt.Sprintf("Normal DryRun Dry run: would update configuration hash from %q to %q, changed children: ConfigMap default/example1", exampleHash, hash),
+					))
+				})
+			})
+		})
+
+		Context("And it has the hash keys annotation", func() {
+			var originalHash string
+
+			// updateKey modifies a key of cm1 and waits for the cache to observe it
+			var updateKey = func(key string) {
+				m.Get(cm1, timeout).Should(Succeed())
+				cm1.Data[key] = "modified"
+				m.Update(cm1).Should(Succeed())
+				m.Eventually(cm1, timeout).Should(WithTransform(func(obj *corev1.ConfigMap) string {
+					return obj.Data[key]
+				}, Equal("modified")))
+			}
+
+			BeforeEach(func() {
+				deployment.SetAnnotations(map[string]string{
+					RequiredAnnotation: "true",
+					HashKeysAnnotation: "key1,missing",
+				})
+				m.Update(deployment).Should(Succeed())
+
+				originalHash = handle()
+				Expect(originalHash).NotTo(BeEmpty())
+			})
+
+			It("Doesn't change the hash when an unlisted key changes", func() {
+				updateKey("key2")
+				Expect(handle()).To(Equal(originalHash))
+			})
+
+			It("Changes the hash when a listed key changes", func() {
+				updateKey("key1")
+				Expect(handle()).NotTo(Equal(originalHash))
+			})
+
+			It("Changes the hash when a Secret changes", func() {
+				m.Get(s1, timeout).Should(Succeed())
+				s1.StringData["key2"] = "modified"
+				m.Update(s1).Should(Succeed())
+				m.Eventually(s1, timeout).Should(WithTransform(func(obj *corev1.Secret) string {
+					return string(obj.Data["key2"])
+				}, Equal("modified")))
+
+				Expect(handle()).NotTo(Equal(originalHash))
+			})
+		})
+
+		Context("And it has annotations that can be mirrored", func() {
+			BeforeEach(func() {
+				deployment.SetAnnotations(map[string]string{
+					RequiredAnnotation: "true",
+					"team":             "payments",
+					"other":            "example",
+				})
+				m.Update(deployment).Should(Succeed())
+			})
+
+			It("Only records the hash on the PodTemplate by default", func() {
+				handle()
+				Expect(deployment.Spec.Template.GetAnnotations()).To(Equal(map[string]string{ConfigHashAnnotation: exampleHash}))
+			})
+
+			It("Records the hash and the mirrored annotations on the PodTemplate", func() {
+				h = NewHandler(c, mgr.GetRecorder("wave"), Options{MirroredAnnotations: []string{"team"}})
+				handle()
+				Expect(deployment.Spec.Template.GetAnnotations()).To(Equal(map[string]string{
+					ConfigHashAnnotation: exampleHash,
+					"team":               "payments",
+				}))
+			})
+		})
+
+		Context("And it has the ignore annotation", func() {
+			var originalHash string
+
+			BeforeEach(func() {
+				// Ignore both children of container2
+				deployment.SetAnnotations(map[string]string{
+					RequiredAnnotation: "true",
+					IgnoreAnnotation:   "example2, default/missing",
+				})
+				m.Update(deployment).Should(Succeed())
+
+				originalHash = handle()
+				Expect(originalHash).NotTo(BeEmpty())
+			})
+
+			It("Adds OwnerReferences to the other children", func() {
+				for _, obj := range []Object{cm1, s1} {
+					m.Eventually(obj, timeout).Should(utils.WithOwnerReferences(ContainElement(ownerRef)))
+				}
+			})
+
+			It("Doesn't add OwnerReferences to the ignored children", func() {
+				for _, obj := range []Object{cm2, s2} {
+					m.Get(obj, timeout).Should(Succeed())
+					Expect(obj.GetOwnerReferences()).To(BeEmpty())
+				}
+			})
+
+			It("Only hashes the other children", func() {
+				hash, err := calculateConfigHash([]Object{cm1, s1})
+				Expect(err).NotTo(HaveOccurred())
+				Expect(originalHash).To(Equal(hash))
+			})
+
+			It("Doesn't change the hash when an ignored child changes", func() {
+				modifyConfigMap(cm2)
+				Expect(handle()).To(Equal(originalHash))
+			})
+
+			It("Changes the hash when another child changes", func() {
+				modifyConfigMap(cm1)
+				Expect(handle()).NotTo(Equal(originalHash))
+			})
+
+			Context("And a child becomes ignored", func() {
+				BeforeEach(func() {
+					m.Eventually(cm1, timeout).Should(utils.WithOwnerReferences(ContainElement(ownerRef)))
+
+					annotations := deployment.GetAnnotations()
+					annotations[IgnoreAnnotation] = "example1,example2"
+					deployment.SetAnnotations(annotations)
+					m.Update(deployment).Should(Succeed())
+					handle()
+				})
+
+				It("Removes its OwnerReference", func() {
+					m.Eventually(cm1, timeout).ShouldNot(utils.WithOwnerReferences(ContainElement(ownerRef)))
+				})
+			})
+		})
+
+		Context("And it has image pull Secrets", func() {
+			var shared *corev1.Secret
+			var serviceAccountOnly *corev1.Secret
+
+			// pullSecretKeys returns the image pull Secrets of the Deployment
+			// that are children under the policy
+			var pullSecretKeys = func(policy ImagePullSecretsPolicy) map[types.NamespacedName]struct{} {
+				h := NewHandler(c, nil, Options{ImagePullSecretsPolicy: policy})
+				keys, err := h.getImagePullSecretKeys(deployment)
+				Expect(err).NotTo(HaveOccurred())
+				return keys
+			}
+
+			var keyFor = func(obj Object) types.NamespacedName {
+				return types.NamespacedName{Namespace: obj.GetNamespace(), Name: obj.GetName()}
+			}
+
+			// rotate updates the credentials of the Secret and waits for the
+			// cache to observe them
+			var rotate = func(secret *corev1.Secret) {
+				m.Get(secret, timeout).Should(Succeed())
+				secret.Data["credentials"] = []byte("rotated")
+				m.Update(secret).Should(Succeed())
+				m.Eventually(secret, timeout).Should(WithTransform(func(obj *corev1.Secret) string {
+					return string(obj.Data["credentials"])
+				}, Equal("rotated")))
+			}
+
+			BeforeEach(func() {
+				// The shared Secret is listed in both the PodSpec and the
+				// ServiceAccount
+				shared = &corev1.Secret{
+					ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "registry"},
+					Data:       map[string][]byte{"credentials": []byte("example")},
+				}
+				serviceAccountOnly = &corev1.Secret{
+					ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "mirror-registry"},
+					Data:       map[string][]byte{"credentials": []byte("example")},
+				}
+				serviceAccount := &corev1.ServiceAccount{
+					ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "example"},
+					ImagePullSecrets: []corev1.LocalObjectReference{
+						{Name: shared.GetName()},
+						{Name: serviceAccountOnly.GetName()},
+					},
+				}
+				for _, obj := range []Object{shared, serviceAccountOnly, serviceAccount} {
+					m.Create(obj).Should(Succeed())
+					m.Get(obj, timeout).Should(Succeed())
+				}
+
+				deployment.SetAnnotations(map[string]string{RequiredAnnotation: "true"})
+				deployment.Spec.Template.Spec.ServiceAccountName = serviceAccount.GetName()
+				deployment.Spec.Template.Spec.ImagePullSecrets = []corev1.LocalObjectReference{{Name: shared.GetName()}}
+				m.Update(deployment).Should(Succeed())
+				m.Get(deployment, timeout).Should(Succeed())
+			})
+
+			AfterEach(func() {
+				utils.DeleteAll(cfg, timeout,
+					&corev1.ServiceAccountList{},
+				)
+			})
+
+			Context("getImagePullSecretKeys", func() {
+				It("returns no Secrets with the ignore policy", func() {
+					Expect(pullSecretKeys(ImagePullSecretsIgnore)).To(BeEmpty())
+				})
+
+				It("returns only the PodSpec's Secrets with the pod policy", func() {
+					Expect(pullSecretKeys(ImagePullSecretsPod)).To(Equal(map[types.NamespacedName]struct{}{
+						keyFor(shared): {},
+					}))
+				})
+
+				It("returns the PodSpec's and the ServiceAccount's Secrets once each with the service-account policy", func() {
+					Expect(pullSecretKeys(ImagePullSecretsServiceAccount)).To(Equal(map[types.NamespacedName]struct{}{
+						keyFor(shared):             {},
+						keyFor(serviceAccountOnly): {},
+					}))
+				})
+
+				It("returns only the PodSpec's Secrets if the ServiceAccount doesn't exist", func() {
+					deployment.Spec.Template.Spec.ServiceAccountName = "missing"
+					Expect(pullSecretKeys(ImagePullSecretsServiceAccount)).To(Equal(map[types.NamespacedName]struct{}{
+						keyFor(shared): {},
+					}))
+				})
+			})
+
+			Context("And it is reconciled with the service-account policy", func() {
+				var originalHash string
+
+				BeforeEach(func() {
+					h = NewHandler(c, mgr.GetRecorder("wave"), Options{ImagePullSecretsPolicy: ImagePullSecretsServiceAccount})
+					originalHash = handle()
+				})
+
+				It("Adds OwnerReferences to the image pull Secrets", func() {
+					for _, obj := range []Object{shared, serviceAccountOnly} {
+						m.Eventually(obj, timeout).Should(utils.WithOwnerReferences(ContainElement(ownerRef)))
+					}
+				})
+
+				It("Hashes the shared Secret once", func() {
+					children, err := h.getCurrentChildren(deployment)
+					Expect(err).NotTo(HaveOccurred())
+					Expect(children).To(HaveLen(6))
+
+					hash, err := calculateConfigHash(children)
+					Expect(err).NotTo(HaveOccurred())
+					Expect(originalHash).To(Equal(hash))
+				})
+
+				It("Indexes the Deployment's ServiceAccount", func() {
+					index := NewChildIndex()
+					h = NewHandler(c, mgr.GetRecorder("wave"), Options{ImagePullSecretsPolicy: ImagePullSecretsServiceAccount, ChildIndex: index})
+					handle()
+
+					serviceAccount := &corev1.ServiceAccount{ObjectMeta: metav1.ObjectMeta{
+						Namespace: deployment.GetNamespace(),
+						Name:      serviceAccountName(&deployment.Spec.Template.Spec),
+					}}
+					Expect(index.WorkloadsFor(serviceAccount, &appsv1.Deployment{})).To(ConsistOf(keyFor(deployment)))
+				})
+
+				It("Rolls the Deployment when the shared Secret is rotated", func() {
+					rotate(shared)
+					Expect(handle()).NotTo(Equal(originalHash))
+				})
+			})
+
+			Context("And it is reconciled with the pod policy", func() {
+				var originalHash string
+
+				BeforeEach(func() {
+					h = NewHandler(c, mgr.GetRecorder("wave"), Options{ImagePullSecretsPolicy: ImagePullSecretsPod})
+					originalHash = handle()
+				})
+
+				It("Adds an OwnerReference to the PodSpec's image pull Secret only", func() {
+					m.Eventually(shared, timeout).Should(utils.WithOwnerReferences(ContainElement(ownerRef)))
+					m.Get(serviceAccountOnly, timeout).Should(Succeed())
+					Expect(serviceAccountOnly.GetOwnerReferences()).To(BeEmpty())
+				})
+
+				It("Rolls the Deployment when the PodSpec's image pull Secret is rotated", func() {
+					rotate(shared)
+					Expect(handle()).NotTo(Equal(originalHash))
+				})
+
+				It("Doesn't roll the Deployment when the ServiceAccount's image pull Secret is rotated", func() {
+					rotate(serviceAccountOnly)
+					Expect(handle()).To(Equal(originalHash))
+				})
+			})
+
+			Context("And it is reconciled with the ignore policy", func() {
+				var originalHash string
+
+				BeforeEach(func() {
+					originalHash = handle()
+				})
+
+				It("Doesn't add OwnerReferences to the image pull Secrets", func() {
+					for _, obj := range []Object{shared, serviceAccountOnly} {
+						m.Get(obj, timeout).Should(Succeed())
+						Expect(obj.GetOwnerReferences()).To(BeEmpty())
+					}
+				})
+
+				It("Doesn't roll the Deployment when the image pull Secrets are rotated", func() {
+					rotate(shared)
+					rotate(serviceAccountOnly)
+					Expect(handle()).To(Equal(originalHash))
+				})
+			})
+		})
+
+		Context("And its config changes repeatedly with a hash history limit", func() {
+			var hashes []string
+
+			const limit = 3
+
+			BeforeEach(func() {
+				h = NewHandler(c, mgr.GetRecorder("wave"), Options{HashHistoryLimit: limit})
+				deployment.SetAnnotations(map[string]string{RequiredAnnotation: "true"})
+				m.Update(deployment).Should(Succeed())
+
+				hashes = []string{handle()}
+				for i := 1; i <= limit+1; i++ {
+					value := fmt.Sprintf("modified %d", i)
+					m.Get(cm1, timeout).Should(Succeed())
+					cm1.Data["key1"] = value
+					m.Update(cm1).Should(Succeed())
+					m.Eventually(cm1, timeout).Should(WithTransform(func(obj *corev1.ConfigMap) string {
+						return obj.Data["key1"]
+					}, Equal(value)))
+
+					hashes = append(hashes, handle())
+				}
+			})
+
+			It("Records the latest hashes in order", func() {
+				Expect(deployment.GetAnnotations()).To(HaveKeyWithValue(HashHistoryAnnotation, strings.Join(hashes[len(hashes)-limit:], ",")))
+			})
+
+			It("Prunes the older hashes", func() {
+				for _, hash := range hashes[:len(hashes)-limit] {
+					Expect(deployment.GetAnnotations()[HashHistoryAnnotation]).NotTo(ContainSubstring(hash))
+				}
+			})
+
+			It("Doesn't change the history when the config is unchanged", func() {
+				history := deployment.GetAnnotations()[HashHistoryAnnotation]
+				handle()
+				Expect(deployment.GetAnnotations()).To(HaveKeyWithValue(HashHistoryAnnotation, history))
+			})
+		})
+
+		Context("And it references a missing optional ConfigMap", func() {
+			var index *ChildIndex
+			var absentHash string
+
+			BeforeEach(func() {
+				index = NewChildIndex()
+				h = NewHandler(c, mgr.GetRecorder("wave"), Options{ChildIndex: index})
+
+				optional := true
+				deployment.SetAnnotations(map[string]string{RequiredAnnotation: "true"})
+				deployment.Spec.Template.Spec.Volumes = append(deployment.Spec.Template.Spec.Volumes, corev1.Volume{
+					Name: "optional",
+					VolumeSource: corev1.VolumeSource{
+						ConfigMap: &corev1.ConfigMapVolumeSource{
+							LocalObjectReference: corev1.LocalObjectReference{Name: "optional"},
+							Optional:             &optional,
+						},
+					},
+				})
+				m.Update(deployment).Should(Succeed())
+
+				absentHash = handle()
+			})
+
+			It("Records a hash marking the ConfigMap as absent", func() {
+				Expect(absentHash).NotTo(BeEmpty())
+				Expect(absentHash).NotTo(Equal(exampleHash))
+			})
+
+			It("Indexes the ConfigMap for the Deployment", func() {
+				Expect(index.WorkloadsFor(&corev1.ConfigMap{
+					ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "optional"},
+				}, &appsv1.Deployment{})).To(ContainElement(types.NamespacedName{
+					Namespace: deployment.GetNamespace(),
+					Name:      deployment.GetName(),
+				}))
+			})
+
+			It("Changes the hash once the ConfigMap is created", func() {
+				cm := &corev1.ConfigMap{
+					ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "optional"},
+				}
+				m.Create(cm).Should(Succeed())
+				m.Get(cm, timeout).Should(Succeed())
+
+				hash := handle()
+				Expect(hash).NotTo(Equal(absentHash))
+				Expect(hash).NotTo(Equal(exampleHash))
+
+				m.Get(cm, timeout).Should(Succeed())
+				Expect(cm.GetOwnerReferences()).To(ContainElement(ownerRef))
+			})
+
+			It("Fails to reconcile if the ConfigMap is also referenced as required", func() {
+				m.Get(deployment, timeout).Should(Succeed())
+				annotations := deployment.GetAnnotations()
+				annotations[ExtraConfigMapsAnnotation] = "optional"
+				deployment.SetAnnotations(annotations)
+				m.Update(deployment).Should(Succeed())
+
+				_, err := h.HandleDeployment(deployment)
+				Expect(err).To(HaveOccurred())
+				Expect(err.Error()).To(ContainSubstring("optional"))
+			})
+		})
+
+		Context("And reads intermittently hide the data of its Secrets", func() {
+			var hiding *hidingClient
+
+			BeforeEach(func() {
+				hiding = &hidingClient{Client: c}
+
+				// Poked workloads are hashed without the content cache, so every
+				// read of the Secrets is hashed afresh
+				deployment.SetAnnotations(map[string]string{
+					RequiredAnnotation: "true",
+					PokeAnnotation:     "empty-secrets",
+				})
+				m.Update(deployment).Should(Succeed())
+			})
+
+			Context("With the EmptySecretKeepLast policy", func() {
+				BeforeEach(func() {
+					h = NewHandler(hiding, recorder, Options{EmptySecretPolicy: EmptySecretKeepLast})
+					Expect(handle()).To(Equal(exampleHash))
+					hiding.hide = true
+				})
+
+				It("Doesn't change the hash when the Secrets' data is intermittently hidden", func() {
+					Consistently(handle, consistentlyTimeout).Should(Equal(exampleHash))
+				})
+
+				It("Changes the hash when a Secret's data changes", func() {
+					m.Get(s1, timeout).Should(Succeed())
+					s1.StringData = map[string]string{"key1": "modified"}
+					m.Update(s1).Should(Succeed())
+					m.Eventually(s1, timeout).Should(WithTransform(func(obj *corev1.Secret) string {
+						return string(obj.Data["key1"])
+					}, Equal("modified")))
+
+					hiding.hide = false
+					Expect(handle()).NotTo(Equal(exampleHash))
+				})
+			})
+
+			Context("With the EmptySecretHash policy", func() {
+				BeforeEach(func() {
+					h = NewHandler(hiding, recorder, Options{})
+					Expect(handle()).To(Equal(exampleHash))
+					hiding.hide = true
+				})
+
+				It("Hashes the Secrets as they are read", func() {
+					Eventually(handle, timeout).ShouldNot(Equal(exampleHash))
+				})
+			})
+		})
+
+		Context("And events are aggregated", func() {
+			BeforeEach(func() {
+				h = NewHandler(c, recorder, Options{AggregateEvents: true})
+				deployment.SetAnnotations(map[string]string{RequiredAnnotation: "true"})
+				m.Update(deployment).Should(Succeed())
+
+				Expect(handle()).To(Equal(exampleHash))
+			})
+
+			It("Sends a single event summarizing the first reconcile", func() {
+				Expect(receivedEvents()).To(Equal([]string{
+					fmt.Sprintf("Normal Reconciled Configuration hash updated to %s; "+
+						"added watches for ConfigMap example1, ConfigMap example2, Secret example1, Secret example2", exampleHash),
+				}))
+			})
+
+			It("Sends no event when the reconcile takes no actions", func() {
+				receivedEvents()
+				Expect(handle()).To(Equal(exampleHash))
+				Expect(receivedEvents()).To(BeEmpty())
+			})
+
+			It("Reports the failure rather than the hash update when recording it fails", func() {
+				receivedEvents()
+				modifyConfigMap(cm1)
+
+				// Updating the Deployment makes the reconciled copy stale, so
+				// recording the hash on it conflicts
+				m.Get(deployment, timeout).Should(Succeed())
+				stale := deployment.DeepCopy()
+				deployment.SetLabels(map[string]string{"updated": "true"})
+				m.Update(deployment).Should(Succeed())
+				_, err := h.HandleDeployment(stale)
+				Expect(err).To(HaveOccurred())
+
+				events := receivedEvents()
+				Expect(events).To(HaveLen(1))
+				Expect(events[0]).To(HavePrefix("Warning ReconcileFailed Reconcile failed: "))
+				Expect(events[0]).To(ContainSubstring("error updating instance"))
+				Expect(events[0]).NotTo(ContainSubstring("Configuration hash updated"))
+			})
+
+			Context("And the Deployment stops referencing some children", func() {
+				var hash string
+
+				BeforeEach(func() {
+					receivedEvents()
+
+					m.Get(deployment, timeout).Should(Succeed())
+					containers := deployment.Spec.Template.Spec.Containers
+					deployment.Spec.Template.Spec.Containers = containers[:1]
+					m.Update(deployment).Should(Succeed())
+					m.Eventually(deployment, timeout).Should(WithTransform(func(obj *appsv1.Deployment) int {
+						return len(obj.Spec.Template.Spec.Containers)
+					}, Equal(1)))
+
+					hash = handle()
+				})
+
+				It("Summarizes the hash update and the removed watches in a single event", func() {
+					Expect(hash).NotTo(Equal(exampleHash))
+					Expect(receivedEvents()).To(Equal([]string{
+						fmt.Sprintf("Normal Reconciled Configuration hash updated to %s; "+
+							"removed watches for ConfigMap example2, Secret example2", hash),
+					}))
+				})
+			})
+		})
+
+		Context("And an environment variable references a Secret key", func() {
+			var s3 *corev1.Secret
+
+			// newSecret3 constructs the Secret only referenced by the
+			// Deployment's environment variable
+			var newSecret3 = func(value string) *corev1.Secret {
+				s := utils.ExampleSecret1.DeepCopy()
+				s.SetName("example3")
+				s.StringData = map[string]string{"key1": value}
+				return s
+			}
+
+			// tryHandle reconciles the latest version of the Deployment and
+			// returns the hash recorded on it along with the reconcile's error
+			var tryHandle = func() (string, error) {
+				m.Get(deployment, timeout).Should(Succeed())
+				_, err := h.HandleDeployment(deployment)
+				m.Get(deployment, timeout).Should(Succeed())
+				return deployment.Spec.Template.GetAnnotations()[ConfigHashAnnotation], err
+			}
+
+			BeforeEach(func() {
+				h = NewHandler(c, recorder, Options{ChildIndex: NewChildIndex()})
+
+				s3 = newSecret3("example3:key1")
+				m.Create(s3).Should(Succeed())
+				m.Get(s3, timeout).Should(Succeed())
+
+				deployment.SetAnnotations(map[string]string{RequiredAnnotation: "true"})
+				deployment.Spec.Template.Spec.Containers[0].Env = []corev1.EnvVar{
+					{
+						Name: "PASSWORD",
+						ValueFrom: &corev1.EnvVarSource{
+							SecretKeyRef: &corev1.SecretKeySelector{
+								LocalObjectReference: corev1.LocalObjectReference{Name: s3.GetName()},
+								Key:                  "key1",
+							},
+						},
+					},
+				}
+				m.Update(deployment).Should(Succeed())
+			})
+
+			It("Hashes the Secret referenced by the environment variable", func() {
+				hash := handle()
+				Expect(hash).NotTo(BeEmpty())
+				Expect(hash).NotTo(Equal(exampleHash))
+			})
+
+			It("Adds an OwnerReference to the Secret", func() {
+				handle()
+				m.Eventually(s3, timeout).Should(utils.WithOwnerReferences(ContainElement(ownerRef)))
+			})
+
+			Context("And the required Secret is deleted", func() {
+				var originalHash string
+
+				BeforeEach(func() {
+					originalHash = handle()
+					receivedEvents()
+
+					m.Delete(s3).Should(Succeed())
+					m.Get(s3, timeout).ShouldNot(Succeed())
+				})
+
+				It("Fails the reconcile so that it is requeued", func() {
+					_, err := tryHandle()
+					Expect(err).To(HaveOccurred())
+					Expect(err.Error()).To(ContainSubstring("\"example3\" not found"))
+				})
+
+				It("Retains the config hash", func() {
+					hash, _ := tryHandle()
+					Expect(hash).To(Equal(originalHash))
+				})
+
+				It("Sends a Warning naming the deleted Secret", func() {
+					tryHandle()
+					Expect(receivedEvents()).To(ContainElement(And(
+						HavePrefix("Warning ChildNotFound"),
+						ContainSubstring("\"example3\" not found"),
+					)))
+				})
+
+				Context("And the Secret is recreated", func() {
+					BeforeEach(func() {
+						tryHandle()
+
+						s3 = newSecret3("recreated")
+						m.Create(s3).Should(Succeed())
+						m.Get(s3, timeout).Should(Succeed())
+					})
+
+					It("Updates the config hash", func() {
+						hash := handle()
+						Expect(hash).NotTo(BeEmpty())
+						Expect(hash).NotTo(Equal(originalHash))
+					})
+				})
+			})
+
+			Context("And the referenced key is missing from the Secret", func() {
+				BeforeEach(func() {
+					m.Get(deployment, timeout).Should(Succeed())
+					deployment.Spec.Template.Spec.Containers[0].Env[0].ValueFrom.SecretKeyRef.Key = "key2"
+					m.Update(deployment).Should(Succeed())
+				})
+
+				It("Hashes the Secret without failing the reconcile", func() {
+					hash := handle()
+					Expect(hash).NotTo(BeEmpty())
+					Expect(hash).NotTo(Equal(exampleHash))
+				})
+
+				It("Adds an OwnerReference to the Secret", func() {
+					handle()
+					m.Eventually(s3, timeout).Should(utils.WithOwnerReferences(ContainElement(ownerRef)))
+				})
+
+				Context("And the key is added", func() {
+					var originalHash string
+
+					BeforeEach(func() {
+						originalHash = handle()
+
+						m.Get(s3, timeout).Should(Succeed())
+						s3.Data["key2"] = []byte("added")
+						m.Update(s3).Should(Succeed())
+						m.Eventually(s3, timeout).Should(WithTransform(func(obj *corev1.Secret) map[string][]byte {
+							return obj.Data
+						}, HaveKey("key2")))
+					})
+
+					It("Updates the config hash", func() {
+						Expect(handle()).NotTo(Equal(originalHash))
+					})
+				})
+			})
+
+			Context("And the referenced key is missing from a ConfigMap", func() {
+				var cm3 *corev1.ConfigMap
+
+				BeforeEach(func() {
+					cm3 = utils.ExampleConfigMap1.DeepCopy()
+					cm3.SetName("example3")
+					m.Create(cm3).Should(Succeed())
+					m.Get(cm3, timeout).Should(Succeed())
+
+					m.Get(deployment, timeout).Should(Succeed())
+					deployment.Spec.Template.Spec.Containers[0].Env = append(deployment.Spec.Template.Spec.Containers[0].Env, corev1.EnvVar{
+						Name: "SETTING",
+						ValueFrom: &corev1.EnvVarSource{
+							ConfigMapKeyRef: &corev1.ConfigMapKeySelector{
+								LocalObjectReference: corev1.LocalObjectReference{Name: cm3.GetName()},
+								Key:                  "missing",
+							},
+						},
+					})
+					m.Update(deployment).Should(Succeed())
+				})
+
+				It("Adds an OwnerReference to the ConfigMap", func() {
+					handle()
+					m.Eventually(cm3, timeout).Should(utils.WithOwnerReferences(ContainElement(ownerRef)))
+				})
+
+				Context("And the key is added", func() {
+					var originalHash string
+
+					BeforeEach(func() {
+						originalHash = handle()
+
+						m.Get(cm3, timeout).Should(Succeed())
+						cm3.Data["missing"] = "added"
+						m.Update(cm3).Should(Succeed())
+						m.Eventually(cm3, timeout).Should(WithTransform(func(obj *corev1.ConfigMap) map[string]string {
+							return obj.Data
+						}, HaveKey("missing")))
+					})
+
+					It("Updates the config hash", func() {
+						Expect(handle()).NotTo(Equal(originalHash))
+					})
+				})
+			})
+		})
+
+		Context("And a child is referenced in another namespace", func() {
+			BeforeEach(func() {
+				h = NewHandler(c, recorder, Options{ChildIndex: NewChildIndex()})
+
+				// The Secret is mistakenly referenced in another namespace
+				deployment.SetAnnotations(map[string]string{
+					RequiredAnnotation:     "true",
+					ExtraSecretsAnnotation: "other/" + s1.GetName(),
+				})
+				m.Update(deployment).Should(Succeed())
+				handle()
+			})
+
+			It("Sends a Warning naming the child in the other namespace", func() {
+				Expect(receivedEvents()).To(ContainElement(And(
+					HavePrefix("Warning CrossNamespaceChild"),
+					ContainSubstring("Secret other/example1"),
+				)))
+			})
+
+			It("Doesn't repeat the Warning while the generation is unchanged", func() {
+				// Recording the hash updated the generation of the Deployment
+				handle()
+				receivedEvents()
+
+				handle()
+				Expect(receivedEvents()).NotTo(ContainElement(HavePrefix("Warning CrossNamespaceChild")))
+			})
+
+			It("Doesn't send a ChildNotFound Warning", func() {
+				Expect(receivedEvents()).NotTo(ContainElement(HavePrefix("Warning ChildNotFound")))
+			})
+
+			It("Adds OwnerReferences to the valid children", func() {
+				for _, obj := range []Object{cm1, cm2, s1, s2} {
+					m.Eventually(obj, timeout).Should(utils.WithOwnerReferences(ContainElement(ownerRef)))
+				}
+			})
+
+			It("Hashes the valid children alone", func() {
+				Expect(deployment.Spec.Template.GetAnnotations()).To(HaveKeyWithValue(ConfigHashAnnotation, exampleHash))
+			})
+		})
+
+		Context("And the cache serves a stale child", func() {
+			var live client.Client
+			var stale *staleClient
+
+			// handleWith reconciles the Deployment with a Handler reading
+			// through the stale client and returns the hash recorded on it
+			var handleWith = func(opts Options) string {
+				h = NewHandler(stale, recorder, opts)
+				return handle()
+			}
+
+			BeforeEach(func() {
+				var err error
+				live, err = client.New(cfg, client.Options{})
+				Expect(err).NotTo(HaveOccurred())
+
+				// Serve the original version of the ConfigMap from the cache
+				// once it has been modified
+				stale = &staleClient{
+					Client: c,
+					stale: map[types.NamespacedName]*corev1.ConfigMap{
+						{Namespace: cm1.GetNamespace(), Name: cm1.GetName()}: cm1.DeepCopy(),
+					},
+				}
+				cm1.Data["key1"] = "modified"
+				Expect(live.Update(context.TODO(), cm1)).To(Succeed())
+
+				deployment.SetAnnotations(map[string]string{RequiredAnnotation: "true"})
+				m.Update(deployment).Should(Succeed())
+			})
+
+			It("Hashes the cached children by default", func() {
+				Expect(handleWith(Options{LiveReader: live})).To(Equal(exampleHash))
+			})
+
+			It("Hashes the latest children with ChildReadsLive", func() {
+				hash := handleWith(Options{LiveReader: live, ChildReads: ChildReadsLive})
+				Expect(hash).NotTo(BeEmpty())
+				Expect(hash).NotTo(Equal(exampleHash))
+			})
+
+			It("Doesn't read children live with only an UncachedReader", func() {
+				Expect(handleWith(Options{UncachedReader: live, ChildReads: ChildReadsLive})).To(Equal(exampleHash))
+			})
+
+			It("Hashes the same children from the cache once it catches up", func() {
+				hash := handleWith(Options{LiveReader: live, ChildReads: ChildReadsLive})
+
+				stale.stale = map[types.NamespacedName]*corev1.ConfigMap{}
+				m.Eventually(cm1, timeout).Should(WithTransform(func(obj *corev1.ConfigMap) string {
+					return obj.Data["key1"]
+				}, Equal("modified")))
+				Expect(handleWith(Options{LiveReader: live})).To(Equal(hash))
+			})
+		})
+
+		Context("And adding OwnerReferences to ConfigMaps is denied", func() {
+			BeforeEach(func() {
+				deployment.SetAnnotations(map[string]string{RequiredAnnotation: "true"})
+				m.Update(deployment).Should(Succeed())
+				m.Get(deployment, timeout).Should(Succeed())
+			})
+
+			Context("With the default OwnerReferenceDeniedPolicy", func() {
+				It("Fails the reconcile", func() {
+					h = NewHandler(&denyingClient{c}, recorder, Options{})
+					_, err := h.HandleDeployment(deployment)
+					Expect(err).To(HaveOccurred())
+
+					m.Get(deployment, timeout).Should(Succeed())
+					Expect(deployment.Spec.Template.GetAnnotations()).NotTo(HaveKey(ConfigHashAnnotation))
+				})
+			})
+
+			Context("With OwnerReferenceDeniedDegrade", func() {
+				BeforeEach(func() {
+					h = NewHandler(&denyingClient{c}, recorder, Options{OwnerReferenceDeniedPolicy: OwnerReferenceDeniedDegrade})
+					handle()
+				})
+
+				It("Updates the config hash including the denied children", func() {
+					Expect(deployment.Spec.Template.GetAnnotations()).To(HaveKeyWithValue(ConfigHashAnnotation, exampleHash))
+				})
+
+				It("Sends a Warning event for each denied child", func() {
+					denied := "Warning OwnerReferenceDenied Unable to add an OwnerReference to ConfigMap %s, it won't be garbage collected with Deployment example"
+					events := receivedEvents()
+					Expect(events).To(ContainElement(HavePrefix(fmt.Sprintf(denied, "example1"))))
+					Expect(events).To(ContainElement(HavePrefix(fmt.Sprintf(denied, "example2"))))
+					Expect(events).NotTo(ContainElement(ContainSubstring("OwnerReference to Secret")))
+				})
+
+				It("Still adds OwnerReferences to the other children", func() {
+					m.Eventually(s1, timeout).Should(utils.WithOwnerReferences(ContainElement(ownerRef)))
+					m.Get(cm1, timeout).Should(Succeed())
+					Expect(cm1.GetOwnerReferences()).To(BeEmpty())
+				})
+			})
+		})
+
+		Context("And a ConfigMap is both mounted by items and exposed by envFrom", func() {
+			BeforeEach(func() {
+				// ConfigMap example1 is exposed whole to container1 by its
+				// envFrom, but only its key1 is mounted by the volume
+				deployment.SetAnnotations(map[string]string{RequiredAnnotation: "true"})
+				volume := &deployment.Spec.Template.Spec.Volumes[1]
+				Expect(volume.ConfigMap.Name).To(Equal(cm1.GetName()))
+				volume.ConfigMap.Items = []corev1.KeyToPath{{Key: "key1", Path: "key1"}}
+				Expect(deployment.Spec.Template.Spec.Containers[0].EnvFrom[0].ConfigMapRef.Name).To(Equal(cm1.GetName()))
+				m.Update(deployment).Should(Succeed())
+
+				Expect(handle()).To(Equal(exampleHash))
+			})
+
+			It("Hashes every key of the ConfigMap", func() {
+				children, err := h.getCurrentChildren(deployment)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(children).To(ContainElement(WithTransform(func(obj Object) map[string]string {
+					cm, ok := obj.(*corev1.ConfigMap)
+					if !ok || cm.GetName() != cm1.GetName() {
+						return nil
+					}
+					return cm.Data
+				}, HaveLen(3))))
+			})
+
+			Context("And a key that isn't mounted by the volume changes", func() {
+				BeforeEach(func() {
+					m.Get(cm1, timeout).Should(Succeed())
+					cm1.Data["key2"] = "modified"
+					m.Update(cm1).Should(Succeed())
+					m.Eventually(cm1, timeout).Should(WithTransform(func(obj *corev1.ConfigMap) string {
+						return obj.Data["key2"]
+					}, Equal("modified")))
+				})
+
+				It("Updates the config hash, as the envFrom exposes the key", func() {
+					Expect(handle()).NotTo(Equal(exampleHash))
+				})
+			})
+		})
+
+		Context("And the cache doesn't notice a child changing", func() {
+			var live client.Client
+			var stale *staleClient
+
+			// getDeployment reads the latest version of the Deployment from the
+			// API server, so that the result never lags behind the handler's
+			// updates
+			var getDeployment = func() {
+				key := types.NamespacedName{Namespace: deployment.GetNamespace(), Name: deployment.GetName()}
+				Expect(live.Get(context.TODO(), key, deployment)).To(Succeed())
+			}
+
+			// handleLive reconciles the live version of the Deployment and
+			// returns the hash recorded on it
+			var handleLive = func() string {
+				getDeployment()
+				_, err := h.HandleDeployment(deployment)
+				Expect(err).NotTo(HaveOccurred())
+				getDeployment()
+				return deployment.Spec.Template.GetAnnotations()[ConfigHashAnnotation]
+			}
+
+			var setNonce = func(nonce string) {
+				getDeployment()
+				annotations := deployment.GetAnnotations()
+				annotations[ForceSyncAnnotation] = nonce
+				deployment.SetAnnotations(annotations)
+				Expect(live.Update(context.TODO(), deployment)).To(Succeed())
+			}
+
+			BeforeEach(func() {
+				var err error
+				live, err = client.New(cfg, client.Options{})
+				Expect(err).NotTo(HaveOccurred())
+
+				// The cache keeps serving the original version of the ConfigMap,
+				// as if its change didn't trip the watch
+				stale = &staleClient{
+					Client: c,
+					stale: map[types.NamespacedName]*corev1.ConfigMap{
+						{Namespace: cm1.GetNamespace(), Name: cm1.GetName()}: cm1.DeepCopy(),
+					},
+				}
+				h = NewHandler(stale, recorder, Options{LiveReader: live})
+
+				getDeployment()
+				deployment.SetAnnotations(map[string]string{RequiredAnnotation: "true"})
+				Expect(live.Update(context.TODO(), deployment)).To(Succeed())
+
+				Expect(handleLive()).To(Equal(exampleHash))
+				receivedEvents()
+			})
+
+			Context("And a child changes", func() {
+				BeforeEach(func() {
+					cm1.Data["key1"] = "modified"
+					Expect(live.Update(context.TODO(), cm1)).To(Succeed())
+				})
+
+				It("Keeps the stale hash without a force sync", func() {
+					Expect(handleLive()).To(Equal(exampleHash))
+				})
+
+				Context("And the force sync nonce is set", func() {
+					var hash string
+
+					BeforeEach(func() {
+						setNonce("1")
+						hash = handleLive()
+					})
+
+					It("Recalculates the hash from the live children", func() {
+						Expect(hash).NotTo(BeEmpty())
+						Expect(hash).NotTo(Equal(exampleHash))
+					})
+
+					It("Acknowledges the nonce", func() {
+						Expect(deployment.GetAnnotations()).To(HaveKeyWithValue(ForceSyncedAnnotation, "1"))
+					})
+
+					It("Doesn't act on the same nonce again", func() {
+						// Let the cache catch up so that it agrees with the live hash
+						stale.stale = map[types.NamespacedName]*corev1.ConfigMap{}
+						m.Eventually(cm1, timeout).Should(WithTransform(func(obj *corev1.ConfigMap) string {
+							return obj.Data["key1"]
+						}, Equal("modified")))
+
+						resourceVersion := deployment.GetResourceVersion()
+						Expect(handleLive()).To(Equal(hash))
+						Expect(deployment.GetResourceVersion()).To(Equal(resourceVersion))
+					})
+				})
+			})
+
+			Context("And the force sync nonce is set without any child changing", func() {
+				var resourceVersion string
+
+				BeforeEach(func() {
+					setNonce("1")
+					getDeployment()
+					resourceVersion = deployment.GetResourceVersion()
+					Expect(handleLive()).To(Equal(exampleHash))
+				})
+
+				It("Rewrites the unchanged hash and acknowledges the nonce", func() {
+					Expect(deployment.GetResourceVersion()).NotTo(Equal(resourceVersion))
+					Expect(deployment.GetAnnotations()).To(HaveKeyWithValue(ForceSyncedAnnotation, "1"))
+				})
+
+				It("Sends a ForceSynced event", func() {
+					Expect(receivedEvents()).To(ContainElement(
+						fmt.Sprintf("Normal ForceSynced Configuration hash recalculated for nonce %q, unchanged at %s", "1", exampleHash),
+					))
+				})
+
+				It("Acts on the nonce again once it changes", func() {
+					setNonce("2")
+					getDeployment()
+					resourceVersion = deployment.GetResourceVersion()
+					Expect(handleLive()).To(Equal(exampleHash))
+					Expect(deployment.GetResourceVersion()).NotTo(Equal(resourceVersion))
+					Expect(deployment.GetAnnotations()).To(HaveKeyWithValue(ForceSyncedAnnotation, "2"))
+				})
+			})
+		})
+
+		Context("And a child fails to fetch with the ChildRetryBackoff enabled", func() {
+			var f *failingClient
+
+			const backoff = 100 * time.Millisecond
+
+			var unavailable = errors.NewServiceUnavailable("etcd is unavailable")
+			var forbidden = errors.NewForbidden(schema.GroupResource{Resource: "secrets"}, utils.ExampleSecret1.GetName(), fmt.Errorf("denied by policy"))
+
+			// requeueAfter reconciles the latest version of the Deployment,
+			// which mustn't return an error, and returns the interval it is
+			// requeued after
+			var requeueAfter = func() time.Duration {
+				m.Get(deployment, timeout).Should(Succeed())
+				result, err := h.HandleDeployment(deployment)
+				Expect(err).NotTo(HaveOccurred())
+				return result.RequeueAfter
+			}
+
+			BeforeEach(func() {
+				f = &failingClient{Client: c}
+				h = NewHandler(f, recorder, Options{
+					ChildRetryBackoff:    backoff,
+					ChildRetryMaxBackoff: time.Hour,
+				})
+
+				deployment.SetAnnotations(map[string]string{RequiredAnnotation: "true"})
+				m.Update(deployment).Should(Succeed())
+				m.Get(deployment, timeout).Should(Succeed())
+			})
+
+			Context("And the failure is transient", func() {
+				BeforeEach(func() {
+					f.err = unavailable
+				})
+
+				It("Requeues the Deployment after a growing interval", func() {
+					var intervals []time.Duration
+					for i := 0; i < 5; i++ {
+						intervals = append(intervals, requeueAfter())
+					}
+
+					Expect(intervals[0]).To(BeNumerically(">=", backoff))
+					for i := 1; i < len(intervals); i++ {
+						Expect(intervals[i]).To(BeNumerically(">", intervals[i-1]))
+					}
+				})
+
+				It("Jitters the interval by at most half of the backoff", func() {
+					Expect(requeueAfter()).To(And(
+						BeNumerically(">=", backoff),
+						BeNumerically("<", backoff*3/2),
+					))
+					Expect(requeueAfter()).To(And(
+						BeNumerically(">=", 2*backoff),
+						BeNumerically("<", 3*backoff),
+					))
+				})
+
+				It("Keeps backing off with the circuit breaker enabled", func() {
+					h = NewHandler(f, recorder, Options{
+						ChildRetryBackoff:       backoff,
+						ChildRetryMaxBackoff:    time.Hour,
+						CircuitBreakerThreshold: 2,
+						CircuitBreakerBackoff:   10 * time.Hour,
+					})
+					var intervals []time.Duration
+					for i := 0; i < 5; i++ {
+						intervals = append(intervals, requeueAfter())
+					}
+
+					for i := 1; i < len(intervals); i++ {
+						Expect(intervals[i]).To(BeNumerically(">", intervals[i-1]))
+						Expect(intervals[i]).To(BeNumerically("<", time.Hour))
+					}
+					Expect(receivedEvents()).NotTo(ContainElement(HavePrefix("Warning CircuitOpen")))
+				})
+
+				It("Never exceeds the ChildRetryMaxBackoff", func() {
+					h = NewHandler(f, recorder, Options{
+						ChildRetryBackoff:    backoff,
+						ChildRetryMaxBackoff: 300 * time.Millisecond,
+					})
+					for i := 0; i < 5; i++ {
+						Expect(requeueAfter()).To(BeNumerically("<=", 300*time.Millisecond))
+					}
+				})
+
+				It("Doesn't update the hash", func() {
+					requeueAfter()
+					m.Get(deployment, timeout).Should(Succeed())
+					Expect(deployment.Spec.Template.GetAnnotations()).NotTo(HaveKey(ConfigHashAnnotation))
+				})
+
+				Context("And the child is fetched again", func() {
+					BeforeEach(func() {
+						for i := 0; i < 3; i++ {
+							requeueAfter()
+						}
+						f.err = nil
+					})
+
+					It("Updates the hash", func() {
+						Expect(requeueAfter()).To(BeZero())
+						m.Get(deployment, timeout).Should(Succeed())
+						Expect(deployment.Spec.Template.GetAnnotations()).To(HaveKeyWithValue(ConfigHashAnnotation, exampleHash))
+					})
+
+					It("Resets the backoff", func() {
+						requeueAfter()
+						f.err = unavailable
+						Expect(requeueAfter()).To(BeNumerically("<", backoff*3/2))
+					})
+				})
+			})
+
+			Context("And the failure is permanent", func() {
+				BeforeEach(func() {
+					f.err = forbidden
+				})
+
+				It("Doesn't requeue the Deployment", func() {
+					m.Get(deployment, timeout).Should(Succeed())
+					result, err := h.HandleDeployment(deployment)
+					Expect(err).NotTo(HaveOccurred())
+					Expect(result).To(Equal(reconcile.Result{}))
+				})
+
+				It("Sends a ChildFetchFailed event", func() {
+					requeueAfter()
+					Expect(receivedEvents()).To(ContainElement(ContainSubstring("ChildFetchFailed")))
+				})
+			})
+
+			Context("And the ChildRetryBackoff is disabled", func() {
+				It("Returns the error to the controller", func() {
+					h = NewHandler(f, recorder, Options{})
+					f.err = unavailable
+
+					_, err := h.HandleDeployment(deployment)
+					Expect(err).To(HaveOccurred())
+				})
+			})
+		})
+
+		Context("And namespaces are filtered", func() {
+			// handleWith reconciles the latest version of the Deployment with a
+			// Handler with the options
+			var handleWith = func(opts Options) {
+				h = NewHandler(c, mgr.GetRecorder("wave"), opts)
+				handle()
+			}
+
+			// expectSkipped checks that Wave hasn't acted on the Deployment or
+			// its children
+			var expectSkipped = func() {
+				Expect(deployment.GetFinalizers()).To(BeEmpty())
+				Expect(deployment.Spec.Template.GetAnnotations()).NotTo(HaveKey(ConfigHashAnnotation))
+				for _, obj := range []Object{cm1, s1} {
+					m.Consistently(obj, consistentlyTimeout).Should(utils.WithOwnerReferences(BeEmpty()))
+				}
+			}
+
+			BeforeEach(func() {
+				deployment.SetAnnotations(map[string]string{RequiredAnnotation: "true"})
+				m.Update(deployment).Should(Succeed())
+				m.Get(deployment, timeout).Should(Succeed())
+			})
+
+			It("Manages the Deployment in an allowed namespace", func() {
+				handleWith(Options{AllowedNamespaces: []string{deployment.GetNamespace()}})
+				Expect(deployment.GetFinalizers()).To(ContainElement(FinalizerString))
+				Expect(deployment.Spec.Template.GetAnnotations()).To(HaveKeyWithValue(ConfigHashAnnotation, exampleHash))
+				m.Eventually(cm1, timeout).Should(utils.WithOwnerReferences(ContainElement(ownerRef)))
+			})
+
+			It("Skips the Deployment in a namespace that isn't allowed", func() {
+				handleWith(Options{AllowedNamespaces: []string{"other"}})
+				expectSkipped()
+			})
+
+			It("Skips the Deployment in a denied namespace", func() {
+				handleWith(Options{DeniedNamespaces: []string{deployment.GetNamespace()}})
+				expectSkipped()
+			})
+
+			It("Skips the Deployment in a namespace that is both allowed and denied", func() {
+				handleWith(Options{
+					AllowedNamespaces: []string{deployment.GetNamespace()},
+					DeniedNamespaces:  []string{deployment.GetNamespace()},
+				})
+				expectSkipped()
+			})
+
+			It("Cleans up a managed Deployment deleted after its namespace is denied", func() {
+				handleWith(Options{})
+				Expect(deployment.GetFinalizers()).To(ContainElement(FinalizerString))
+				m.Eventually(cm1, timeout).Should(utils.WithOwnerReferences(ContainElement(ownerRef)))
+
+				m.Delete(deployment).Should(Succeed())
+				m.Get(deployment, timeout).Should(Succeed())
+				h = NewHandler(c, mgr.GetRecorder("wave"), Options{DeniedNamespaces: []string{deployment.GetNamespace()}})
+				_, err := h.HandleDeployment(deployment)
+				Expect(err).NotTo(HaveOccurred())
+
+				// Once its finalizer is removed the Deployment is deleted
+				m.Get(deployment, timeout).ShouldNot(Succeed())
+				m.Eventually(cm1, timeout).Should(utils.WithOwnerReferences(BeEmpty()))
+			})
+
+			It("Manages the Deployment in a namespace that isn't denied", func() {
+				handleWith(Options{DeniedNamespaces: []string{"other"}})
+				Expect(deployment.Spec.Template.GetAnnotations()).To(HaveKeyWithValue(ConfigHashAnnotation, exampleHash))
+			})
+		})
+
+		Context("And its children are tracked", func() {
+			// trackedChildren reconciles the latest version of the Deployment
+			// and returns the children tracked on it
+			var trackedChildren = func() string {
+				handle()
+				return deployment.GetAnnotations()[TrackedChildrenAnnotation]
+			}
+
+			BeforeEach(func() {
+				h = NewHandler(c, mgr.GetRecorder("wave"), Options{TrackChildren: true})
+				deployment.SetAnnotations(map[string]string{RequiredAnnotation: "true"})
+				m.Update(deployment).Should(Succeed())
+			})
+
+			It("Tracks the children of the Deployment", func() {
+				Expect(trackedChildren()).To(Equal("ConfigMap/example1,ConfigMap/example2,Secret/example1,Secret/example2"))
+			})
+
+			It("Doesn't record the tracked children on the PodTemplate", func() {
+				handle()
+				Expect(deployment.Spec.Template.GetAnnotations()).NotTo(HaveKey(TrackedChildrenAnnotation))
+			})
+
+			Context("And children are removed", func() {
+				BeforeEach(func() {
+					handle()
+
+					// The second container references the example2 children
+					containers := deployment.Spec.Template.Spec.Containers
+					deployment.Spec.Template.Spec.Containers = []corev1.Container{containers[0]}
+					m.Update(deployment).Should(Succeed())
+					m.Eventually(deployment, timeout).Should(WithTransform(func(obj *appsv1.Deployment) int {
+						return len(obj.Spec.Template.Spec.Containers)
+					}, Equal(1)))
+				})
+
+				It("Stops tracking the removed children", func() {
+					Expect(trackedChildren()).To(Equal("ConfigMap/example1,Secret/example1"))
+				})
+
+				Context("And the Deployment is frozen", func() {
+					BeforeEach(func() {
+						m.Get(deployment, timeout).Should(Succeed())
+						annotations := deployment.GetAnnotations()
+						annotations[FreezeAnnotation] = "true"
+						deployment.SetAnnotations(annotations)
+						m.Update(deployment).Should(Succeed())
+						m.Eventually(deployment, timeout).Should(utils.WithAnnotations(HaveKeyWithValue(FreezeAnnotation, "true")))
+					})
+
+					It("Stops tracking the removed children without recording the hash", func() {
+						hash := deployment.Spec.Template.GetAnnotations()[ConfigHashAnnotation]
+						Expect(trackedChildren()).To(Equal("ConfigMap/example1,Secret/example1"))
+						Expect(deployment.Spec.Template.GetAnnotations()).To(HaveKeyWithValue(ConfigHashAnnotation, hash))
+					})
+				})
+			})
+
+			Context("And a child is added", func() {
+				BeforeEach(func() {
+					handle()
+
+					cm3 := &corev1.ConfigMap{
+						ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "example3"},
+						Data:       map[string]string{"key": "value"},
+					}
+					m.Create(cm3).Should(Succeed())
+					m.Get(cm3, timeout).Should(Succeed())
+
+					m.Get(deployment, timeout).Should(Succeed())
+					deployment.Spec.Template.Spec.Volumes = append(deployment.Spec.Template.Spec.Volumes, corev1.Volume{
+						Name: "configmap3",
+						VolumeSource: corev1.VolumeSource{
+							ConfigMap: &corev1.ConfigMapVolumeSource{
+								LocalObjectReference: corev1.LocalObjectReference{Name: cm3.GetName()},
+							},
+						},
+					})
+					m.Update(deployment).Should(Succeed())
+					m.Eventually(deployment, timeout).Should(WithTransform(func(obj *appsv1.Deployment) int {
+						return len(obj.Spec.Template.Spec.Volumes)
+					}, Equal(3)))
+				})
+
+				It("Tracks the added child", func() {
+					Expect(trackedChildren()).To(Equal("ConfigMap/example1,ConfigMap/example2,ConfigMap/example3,Secret/example1,Secret/example2"))
+				})
+			})
+		})
+
+		Context("And it mounts a ConfigMap with binary data", func() {
+			var certs *corev1.ConfigMap
+
+			// rotate replaces the certificate binary data of the ConfigMap and
+			// waits for the cache to observe it
+			var rotate = func(cert []byte) {
+				m.Get(certs, timeout).Should(Succeed())
+				certs.BinaryData["tls.der"] = cert
+				m.Update(certs).Should(Succeed())
+				m.Eventually(certs, timeout).Should(WithTransform(func(obj *corev1.ConfigMap) []byte {
+					return obj.BinaryData["tls.der"]
+				}, Equal(cert)))
+			}
+
+			BeforeEach(func() {
+				certs = &corev1.ConfigMap{
+					ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "certs"},
+					BinaryData: map[string][]byte{"tls.der": {0x30, 0x82, 0x01, 0x0a, 0xff, 0xfe, 0x00, 0x80}},
+				}
+				m.Create(certs).Should(Succeed())
+				m.Get(certs, timeout).Should(Succeed())
+
+				deployment.SetAnnotations(map[string]string{RequiredAnnotation: "true"})
+				deployment.Spec.Template.Spec.Volumes = append(deployment.Spec.Template.Spec.Volumes, corev1.Volume{
+					Name: "certs",
+					VolumeSource: corev1.VolumeSource{
+						ConfigMap: &corev1.ConfigMapVolumeSource{
+							LocalObjectReference: corev1.LocalObjectReference{Name: certs.GetName()},
+						},
+					},
+				})
+				m.Update(deployment).Should(Succeed())
+			})
+
+			It("Updates the hash when a byte of the binary data is rotated", func() {
+				original := handle()
+				Expect(original).NotTo(BeEmpty())
+
+				rotate([]byte{0x30, 0x82, 0x01, 0x0a, 0xff, 0xfe, 0x00, 0x81})
+				Expect(handle()).NotTo(Equal(original))
+			})
+
+			It("Keeps the hash when the binary data is rewritten unchanged", func() {
+				original := handle()
+
+				rotate([]byte{0x30, 0x82, 0x01, 0x0a, 0xff, 0xfe, 0x00, 0x80})
+				Expect(handle()).To(Equal(original))
+			})
+
+			It("Restores the hash when the binary data is rotated back", func() {
+				original := handle()
+
+				rotate([]byte{0x30, 0x82, 0x01, 0x0a, 0xff, 0xfe, 0x00, 0x81})
+				Expect(handle()).NotTo(Equal(original))
+
+				rotate([]byte{0x30, 0x82, 0x01, 0x0a, 0xff, 0xfe, 0x00, 0x80})
+				Expect(handle()).To(Equal(original))
+			})
+		})
+
+		Context("And it has the hash target annotation", func() {
+			const customAnnotation = "example.com/config-version"
+
+			// setTarget sets the hash target of the Deployment
+			var setTarget = func(target string) {
+				deployment.SetAnnotations(map[string]string{
+					RequiredAnnotation:   "true",
+					HashTargetAnnotation: target,
+				})
+				m.Update(deployment).Should(Succeed())
+			}
+
+			Context("With the label target", func() {
+				BeforeEach(func() {
+					setTarget(HashTargetLabel)
+					handle()
+				})
+
+				It("Records the truncated hash in a Pod Template label", func() {
+					Expect(deployment.Spec.Template.GetLabels()).To(HaveKeyWithValue(ConfigHashAnnotation, exampleHash[:63]))
+					Expect(deployment.Spec.Template.GetAnnotations()).NotTo(HaveKey(ConfigHashAnnotation))
+				})
+
+				It("Rolls the Deployment when a child changes", func() {
+					generation := deployment.GetGeneration()
+					modifyConfigMap(cm1)
+					handle()
+
+					Expect(deployment.Spec.Template.GetLabels()).To(HaveKey(ConfigHashAnnotation))
+					Expect(deployment.Spec.Template.GetLabels()[ConfigHashAnnotation]).NotTo(Equal(exampleHash[:63]))
+					Expect(deployment.GetGeneration()).To(BeNumerically(">", generation))
+				})
+
+				It("Doesn't update the Deployment when no child changes", func() {
+					resourceVersion := deployment.GetResourceVersion()
+					handle()
+					Expect(deployment.GetResourceVersion()).To(Equal(resourceVersion))
+				})
+			})
+
+			Context("With a custom annotation target", func() {
+				BeforeEach(func() {
+					setTarget(customAnnotation)
+					handle()
+				})
+
+				It("Records the hash in the custom Pod Template annotation", func() {
+					Expect(deployment.Spec.Template.GetAnnotations()).To(HaveKeyWithValue(customAnnotation, exampleHash))
+					Expect(deployment.Spec.Template.GetAnnotations()).NotTo(HaveKey(ConfigHashAnnotation))
+				})
+
+				It("Rolls the Deployment when a child changes", func() {
+					modifyConfigMap(cm1)
+					handle()
+
+					Expect(deployment.Spec.Template.GetAnnotations()).To(HaveKey(customAnnotation))
+					Expect(deployment.Spec.Template.GetAnnotations()[customAnnotation]).NotTo(Equal(exampleHash))
+				})
+			})
+		})
+
+		Context("And the finalizer is disabled", func() {
+			var index *ChildIndex
+
+			BeforeEach(func() {
+				index = NewChildIndex()
+				h = NewHandler(c, mgr.GetRecorder("wave"), Options{ChildIndex: index, DisableFinalizer: true})
+			})
+
+			Context("And the Deployment has the required annotation", func() {
+				BeforeEach(func() {
+					deployment.SetAnnotations(map[string]string{RequiredAnnotation: "true"})
+					m.Update(deployment).Should(Succeed())
+					handle()
+				})
+
+				It("Doesn't add the finalizer", func() {
+					Expect(deployment.GetFinalizers()).NotTo(ContainElement(FinalizerString))
+				})
+
+				It("Still records the hash", func() {
+					Expect(deployment.Spec.Template.GetAnnotations()).To(HaveKeyWithValue(ConfigHashAnnotation, exampleHash))
+				})
+
+				It("Still adds OwnerReferences to the children", func() {
+					m.Eventually(cm1, timeout).Should(utils.WithOwnerReferences(ContainElement(ownerRef)))
+				})
+
+				It("Doesn't update the Deployment again when nothing changes", func() {
+					resourceVersion := deployment.GetResourceVersion()
+					handle()
+					Expect(deployment.GetResourceVersion()).To(Equal(resourceVersion))
+				})
+
+				It("Doesn't block the deletion of the Deployment", func() {
+					m.Delete(deployment).Should(Succeed())
+					Eventually(func() error {
+						key := types.NamespacedName{Namespace: deployment.GetNamespace(), Name: deployment.GetName()}
+						return c.Get(context.TODO(), key, &appsv1.Deployment{})
+					}, timeout).Should(WithTransform(errors.IsNotFound, BeTrue()))
+				})
+
+				It("Forgets the Deployment once it is no longer found", func() {
+					Expect(index.contains(deployment)).To(BeTrue())
+					key := types.NamespacedName{Namespace: deployment.GetNamespace(), Name: deployment.GetName()}
+					m.Delete(deployment).Should(Succeed())
+					Eventually(func() error {
+						return c.Get(context.TODO(), key, &appsv1.Deployment{})
+					}, timeout).Should(WithTransform(errors.IsNotFound, BeTrue()))
+
+					h.HandleNotFound("Deployment", key)
+					Expect(index.contains(deployment)).To(BeFalse())
+					Expect(h.workloadUIDs.uids).To(BeEmpty())
+					Expect(h.childHashes.hashes).To(BeEmpty())
+					Expect(h.breaker.failures).To(BeEmpty())
+				})
+			})
+
+			Context("And the Deployment has the finalizer from before it was disabled", func() {
+				BeforeEach(func() {
+					deployment.SetAnnotations(map[string]string{RequiredAnnotation: "true"})
+					deployment.SetFinalizers([]string{FinalizerString, "keep.me.around/finalizer"})
+					m.Update(deployment).Should(Succeed())
+					handle()
+				})
+
+				It("Removes the finalizer", func() {
+					Expect(deployment.GetFinalizers()).To(ConsistOf("keep.me.around/finalizer"))
+				})
+
+				It("Still records the hash", func() {
+					Expect(deployment.Spec.Template.GetAnnotations()).To(HaveKeyWithValue(ConfigHashAnnotation, exampleHash))
+				})
+			})
+
+			Context("And Wave is disabled for a Deployment with the finalizer", func() {
+				BeforeEach(func() {
+					deployment.SetFinalizers([]string{FinalizerString})
+					m.Update(deployment).Should(Succeed())
+					handle()
+				})
+
+				It("Removes the finalizer", func() {
+					Expect(deployment.GetFinalizers()).To(BeEmpty())
+				})
+			})
+		})
+
+		Context("And hash diffs are logged when a child changes", func() {
+			var rejecting *rejectingClient
+
+			BeforeEach(func() {
+				rejecting = &rejectingClient{Client: c}
+				h = NewHandler(rejecting, recorder, Options{ChildIndex: NewChildIndex(), LogHashDiffs: true})
+
+				deployment.SetAnnotations(map[string]string{RequiredAnnotation: "true"})
+				m.Update(deployment).Should(Succeed())
+
+				Expect(handle()).To(Equal(exampleHash))
+				receivedEvents()
+
+				modifyConfigMap(cm1)
+				Expect(handle()).NotTo(Equal(exampleHash))
+			})
+
+			It("Names the changed ConfigMap and key in the ConfigChanged event", func() {
+				Expect(receivedEvents()).To(ContainElement(And(
+					HavePrefix("Normal ConfigChanged"),
+					ContainSubstring("changed: ConfigMap default/example1 keys key1"),
+					Not(ContainSubstring("example2")),
+				)))
+			})
+
+			Context("And the update recording the next change fails", func() {
+				BeforeEach(func() {
+					receivedEvents()
+
+					m.Get(cm1, timeout).Should(Succeed())
+					cm1.Data["key1"] = "modified again"
+					m.Update(cm1).Should(Succeed())
+					m.Eventually(cm1, timeout).Should(WithTransform(func(obj *corev1.ConfigMap) string {
+						return obj.Data["key1"]
+					}, Equal("modified again")))
+
+					rejecting.reject = true
+					m.Get(deployment, timeout).Should(Succeed())
+					_, err := h.HandleDeployment(deployment)
+					Expect(err).To(HaveOccurred())
+					rejecting.reject = false
+				})
+
+				It("Names the changed key again when the update is retried", func() {
+					handle()
+					Expect(receivedEvents()).To(ContainElement(And(
+						HavePrefix("Normal ConfigChanged"),
+						ContainSubstring("changed: ConfigMap default/example1 keys key1"),
+					)))
+				})
+			})
+		})
+
+		Context("And it is frozen while a child changes", func() {
+			var setFrozen = func(frozen bool) {
+				m.Get(deployment, timeout).Should(Succeed())
+				annotations := deployment.GetAnnotations()
+				if frozen {
+					annotations[FreezeAnnotation] = "true"
+				} else {
+					delete(annotations, FreezeAnnotation)
+				}
+				deployment.SetAnnotations(annotations)
+				m.Update(deployment).Should(Succeed())
+			}
+
+			BeforeEach(func() {
+				deployment.SetAnnotations(map[string]string{RequiredAnnotation: "true"})
+				m.Update(deployment).Should(Succeed())
+				Expect(handle()).To(Equal(exampleHash))
+
+				setFrozen(true)
+				modifyConfigMap(cm1)
+			})
+
+			It("Keeps the recorded hash", func() {
+				Consistently(handle, consistentlyTimeout).Should(Equal(exampleHash))
+			})
+
+			It("Keeps the OwnerReferences and the finalizer", func() {
+				Expect(handle()).To(Equal(exampleHash))
+				Expect(deployment.GetFinalizers()).To(ContainElement(FinalizerString))
+				m.Get(cm1, timeout).Should(Succeed())
+				Expect(cm1.GetOwnerReferences()).To(ContainElement(ownerRef))
+			})
+
+			It("Updates the hash once the Deployment is unfrozen", func() {
+				Expect(handle()).To(Equal(exampleHash))
+
+				setFrozen(false)
+				Eventually(handle, timeout).ShouldNot(Equal(exampleHash))
+			})
+		})
+
 		Context("And it does not have the required annotation", func() {
 			BeforeEach(func() {
 				// Get the updated Deployment
@@ -20,60 +20,231 @@ import (
 	"crypto/sha256"
 	"encoding/json"
 	"fmt"
+	"hash/fnv"
 	"reflect"
+	"sort"
 
-	appsv1 "k8s.io/api/apps/v1"
 	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 )
 
 // calculateConfigHash uses sha256 to hash the configuration within the child
-// objects and returns a hash as a string
+// objects and returns a hash as a string.
+// Only the content of the children is hashed, so replacing a child with a
+// differently named child with identical content does not change the hash.
+// Fields defaulted by the API server, such as the Secret type or the mode of a
+// volume, are never hashed so that upgrading the cluster does not change the
+// hash.
+// The content is hashed as JSON, which delimits and escapes every key and
+// value, so no two different sets of data are hashed from the same input.
+// The name of each key is hashed alongside its value, so renaming a key
+// changes the hash even if its value is unchanged. JSON objects are written
+// with their keys sorted, so the hash doesn't depend on map iteration order.
+// How the workload consumes the children, eg. the prefix of an envFrom source,
+// is part of its PodTemplate and so is not included in the hash
 func calculateConfigHash(children []Object) (string, error) {
+	return calculateConfigHashWithCache(children, nil, "", nil)
+}
+
+// calculateConfigHashWithCache calculates the same hash as calculateConfigHash,
+// reusing the serialized content of children from the cache where possible.
+// No content is cached if the cache is nil.
+// If versionLabel is set, the value of that label on each child is hashed
+// along with its content.
+// If resourceVersions is set, the resourceVersion it records for each child is
+// hashed along with its content, so that any change to a child other than to
+// its OwnerReferences changes the hash
+func calculateConfigHashWithCache(children []Object, cache *contentCache, versionLabel string, resourceVersions *resourceVersionTracker) (string, error) {
+	hashSourceBytes, err := getHashSource(children, cache, versionLabel, resourceVersions)
+	if err != nil {
+		return "", err
+	}
+	return HashSHA256.sum(hashSourceBytes), nil
+}
+
+// getHashSource returns the serialized content of the children that is
+// hashed by calculateConfigHashWithCache, whatever the HashAlgorithm
+func getHashSource(children []Object, cache *contentCache, versionLabel string, resourceVersions *resourceVersionTracker) ([]byte, error) {
 	// hashSource contains all the data to be hashed
 	hashSource := struct {
-		ConfigMaps map[string]map[string]string `json:"configMaps"`
-		Secrets    map[string]map[string][]byte `json:"secrets"`
+		ConfigMaps []string `json:"configMaps"`
+		Secrets    []string `json:"secrets"`
+		Others     []string `json:"others,omitempty"`
 	}{
-		ConfigMaps: make(map[string]map[string]string),
-		Secrets:    make(map[string]map[string][]byte),
+		ConfigMaps: []string{},
+		Secrets:    []string{},
 	}
 
 	// Add the data from each child to the hashSource
-	// All children should be in the same namespace so each one should have a
-	// unique name
 	for _, obj := range children {
-		switch child := obj.(type) {
+		content, ok := cache.get(obj)
+		if !ok {
+			var err error
+			content, err = serializeChild(obj, versionLabel, resourceVersions)
+			if err != nil {
+				return nil, err
+			}
+			cache.set(obj, content)
+		}
+
+		switch obj.(type) {
 		case *corev1.ConfigMap:
-			cm := corev1.ConfigMap(*child)
-			hashSource.ConfigMaps[child.GetName()] = cm.Data
+			hashSource.ConfigMaps = append(hashSource.ConfigMaps, content)
 		case *corev1.Secret:
-			s := corev1.Secret(*child)
-			hashSource.Secrets[child.GetName()] = s.Data
-		default:
-			return "", fmt.Errorf("passed unknown type: %v", reflect.TypeOf(child))
+			hashSource.Secrets = append(hashSource.Secrets, content)
+		case *unstructured.Unstructured:
+			hashSource.Others = append(hashSource.Others, content)
 		}
 	}
 
+	// Sort the content of the children so that the hash is independent of the
+	// order the children are passed in
+	sort.Strings(hashSource.ConfigMaps)
+	sort.Strings(hashSource.Secrets)
+	sort.Strings(hashSource.Others)
+
 	// Convert the hashSource to a byte slice so that it can be hashed
 	hashSourceBytes, err := json.Marshal(hashSource)
 	if err != nil {
-		return "", fmt.Errorf("unable to marshal JSON: %v", err)
+		return nil, fmt.Errorf("unable to marshal JSON: %v", err)
 	}
+	return hashSourceBytes, nil
+}
 
-	hashBytes := sha256.Sum256(hashSourceBytes)
-	return fmt.Sprintf("%x", hashBytes), nil
+// sum hashes the data with the HashAlgorithm, returning the hash as a hex
+// string.
+// Unknown algorithms fall back to SHA256
+func (a HashAlgorithm) sum(data []byte) string {
+	if a == HashFNV {
+		hash := fnv.New64a()
+		hash.Write(data)
+		return fmt.Sprintf("%016x", hash.Sum64())
+	}
+	return fmt.Sprintf("%x", sha256.Sum256(data))
 }
 
-// setConfigHash upates the configuration hash of the given Deployment to the
-// given string
-func setConfigHash(obj *appsv1.Deployment, hash string) {
-	// Get the existing annotations
-	annotations := obj.Spec.Template.GetAnnotations()
-	if annotations == nil {
-		annotations = make(map[string]string)
+// serializeChild returns the content of the child that is hashed.
+// The value of the child's versionLabel is included if it is set, children
+// without the label are serialized as if no versionLabel was given.
+// The resourceVersion the resourceVersions tracker records for the child is
+// included if the tracker is set
+func serializeChild(obj Object, versionLabel string, resourceVersions *resourceVersionTracker) (string, error) {
+	var version string
+	if versionLabel != "" {
+		version = obj.GetLabels()[versionLabel]
+	}
+	resourceVersion, err := resourceVersions.hashedVersion(obj)
+	if err != nil {
+		return "", fmt.Errorf("unable to track resourceVersion of %s %s: %v", kindOf(obj), obj.GetName(), err)
+	}
+
+	switch child := obj.(type) {
+	case *corev1.ConfigMap:
+		// Each field is tagged separately so that the same key appearing in
+		// both Data and BinaryData can never be confused
+		configMapData, binaryData := hashedConfigMapData(child)
+		data, err := json.Marshal(struct {
+			Data            map[string]string `json:"data"`
+			BinaryData      map[string][]byte `json:"binaryData"`
+			Version         string            `json:"version,omitempty"`
+			ResourceVersion string            `json:"resourceVersion,omitempty"`
+		}{
+			Data:            configMapData,
+			BinaryData:      binaryData,
+			Version:         version,
+			ResourceVersion: resourceVersion,
+		})
+		if err != nil {
+			return "", fmt.Errorf("unable to marshal ConfigMap data: %v", err)
+		}
+		return string(data), nil
+	case *corev1.Secret:
+		// Secret data is hashed as the decoded bytes, which json.Marshal
+		// re-encodes canonically, so the base64 encoding used by the client
+		// that wrote the Secret doesn't affect the hash
+		data, err := json.Marshal(struct {
+			Data            map[string][]byte `json:"data"`
+			Version         string            `json:"version,omitempty"`
+			ResourceVersion string            `json:"resourceVersion,omitempty"`
+		}{
+			Data:            normalizeBinaryData(child.Data),
+			Version:         version,
+			ResourceVersion: resourceVersion,
+		})
+		if err != nil {
+			return "", fmt.Errorf("unable to marshal Secret data: %v", err)
+		}
+		return string(data), nil
+	case *unstructured.Unstructured:
+		// Children of other kinds are hashed with their kind, so that objects
+		// of different kinds with the same content can never be confused.
+		// Their metadata and status are not configuration so aren't hashed
+		groupKind := child.GroupVersionKind().GroupKind()
+		content := make(map[string]interface{})
+		for key, value := range child.Object {
+			switch key {
+			case "apiVersion", "kind", "metadata", "status":
+				continue
+			}
+			content[key] = value
+		}
+		data, err := json.Marshal(struct {
+			Kind            string                 `json:"kind"`
+			Content         map[string]interface{} `json:"content"`
+			Version         string                 `json:"version,omitempty"`
+			ResourceVersion string                 `json:"resourceVersion,omitempty"`
+		}{
+			Kind:            groupKind.String(),
+			Content:         content,
+			Version:         version,
+			ResourceVersion: resourceVersion,
+		})
+		if err != nil {
+			return "", fmt.Errorf("unable to marshal %s data: %v", child.GetKind(), err)
+		}
+		return string(data), nil
+	default:
+		return "", fmt.Errorf("passed unknown type: %v", reflect.TypeOf(child))
+	}
+}
+
+// normalizeConfigMapData ensures empty data is always hashed the same way.
+// The API server may return empty data as either nil or an empty map
+func normalizeConfigMapData(data map[string]string) map[string]string {
+	if data == nil {
+		return map[string]string{}
+	}
+	return data
+}
+
+// normalizeBinaryData ensures empty binary data is always hashed the same way.
+// The API server may return empty data as either nil or an empty map
+func normalizeBinaryData(data map[string][]byte) map[string][]byte {
+	if data == nil {
+		return map[string][]byte{}
+	}
+	return data
+}
+
+// setConfigHash upates the configuration hash of the given workload to the
+// given string, using the workload's RolloutTrigger and its hashTarget, which
+// defaults to the given annotation.
+// Any hash stored using the other RolloutTrigger, in the label or annotation
+// with the default key outside of the hashTarget, or in a previous custom
+// annotation, is removed
+func setConfigHash(obj Object, annotation, hash string) {
+	podTemplate := getPodTemplate(obj)
+
+	if getRolloutTrigger(obj) == RolloutTriggerEnvVar {
+		removeAnnotation(podTemplate, annotation)
+		removeLabel(podTemplate, annotation)
+		recordHashTargetKey(obj, podTemplate, nil, annotation, hash)
+		setConfigHashEnv(&podTemplate.Spec, hash)
+		return
 	}
 
-	// Update the annotations
-	annotations[ConfigHashAnnotation] = hash
-	obj.Spec.Template.SetAnnotations(annotations)
+	removeConfigHashEnv(&podTemplate.Spec)
+	target := getHashTarget(obj, annotation)
+	recordHashTargetKey(obj, podTemplate, &target, annotation, hash)
+	setTargetConfigHash(podTemplate, target, annotation, hash)
 }
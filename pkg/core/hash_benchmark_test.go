@@ -0,0 +1,132 @@
+/*
+Copyright 2018 Pusher Ltd.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package core
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// benchmarkChildren returns ConfigMaps and Secrets as if they had been read
+// from the API server, each with many keys of sizeable values
+func benchmarkChildren() []Object {
+	value := strings.Repeat("x", 1024)
+	children := []Object{}
+	for i := 0; i < 10; i++ {
+		meta := metav1.ObjectMeta{
+			Name:            fmt.Sprintf("child%d", i),
+			Namespace:       "default",
+			UID:             types.UID(fmt.Sprintf("uid%d", i)),
+			ResourceVersion: "1",
+		}
+		cm := &corev1.ConfigMap{ObjectMeta: meta, Data: map[string]string{}}
+		s := &corev1.Secret{ObjectMeta: meta, Data: map[string][]byte{}}
+		s.UID = types.UID(fmt.Sprintf("secret-uid%d", i))
+		for j := 0; j < 50; j++ {
+			key := fmt.Sprintf("key%d", j)
+			cm.Data[key] = value
+			s.Data[key] = []byte(value)
+		}
+		children = append(children, cm, s)
+	}
+	return children
+}
+
+// BenchmarkCalculateConfigHash measures repeatedly hashing unchanged children
+// by serializing them on every reconcile
+func BenchmarkCalculateConfigHash(b *testing.B) {
+	children := benchmarkChildren()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := calculateConfigHash(children); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// BenchmarkCalculateConfigHashWithCache measures repeatedly hashing unchanged
+// children reusing their serialized content from a contentCache
+func BenchmarkCalculateConfigHashWithCache(b *testing.B) {
+	children := benchmarkChildren()
+	cache := newContentCache()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := calculateConfigHashWithCache(children, cache, "", nil); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// changeOneChild updates the data and resourceVersion of a single child, as
+// if it had been updated on the API server, cycling through the children
+func changeOneChild(children []Object, i int) {
+	cm := children[(i%(len(children)/2))*2].(*corev1.ConfigMap)
+	cm.Data["key0"] = fmt.Sprintf("value%d", i)
+	cm.ResourceVersion = fmt.Sprintf("%d", i+2)
+}
+
+// BenchmarkConfigHashOneChildChanged measures hashing the children after one
+// of them changed, reusing the serialized content of the others from a
+// contentCache but hashing the content of every child again
+func BenchmarkConfigHashOneChildChanged(b *testing.B) {
+	children := benchmarkChildren()
+	h := NewHandler(nil, nil, Options{})
+	instance := &corev1.Pod{ObjectMeta: metav1.ObjectMeta{UID: "workload-uid"}}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		changeOneChild(children, i)
+		if _, err := h.configHash(instance, children, h.contents); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// BenchmarkMerkleHashOneChildChanged measures hashing the children after one
+// of them changed with MerkleHash enabled, only hashing the changed child and
+// the nodes on the path from its leaf to the root
+func BenchmarkMerkleHashOneChildChanged(b *testing.B) {
+	children := benchmarkChildren()
+	h := NewHandler(nil, nil, Options{MerkleHash: true})
+	instance := &corev1.Pod{ObjectMeta: metav1.ObjectMeta{UID: "workload-uid"}}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		changeOneChild(children, i)
+		if _, err := h.configHash(instance, children, h.contents); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// BenchmarkMerkleHashFromScratch measures hashing the children with
+// MerkleHash enabled without reusing any previously calculated tree
+func BenchmarkMerkleHashFromScratch(b *testing.B) {
+	children := benchmarkChildren()
+	h := NewHandler(nil, nil, Options{MerkleHash: true})
+	instance := &corev1.Pod{ObjectMeta: metav1.ObjectMeta{UID: "workload-uid"}}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		changeOneChild(children, i)
+		if _, err := h.configHash(instance, children, nil); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
@@ -0,0 +1,123 @@
+/*
+Copyright 2018 Pusher Ltd.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package core
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"sort"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+// hashDataKeys returns the hash of the value of each data key of a ConfigMap
+// or Secret, so that the keys whose values changed can be identified without
+// recording the values.
+// A key in both the Data and BinaryData of a ConfigMap is hashed once, with
+// both values. Children of other kinds have no data keys
+func hashDataKeys(child Object) map[string]string {
+	values := make(map[string][][]byte)
+	switch o := child.(type) {
+	case *corev1.ConfigMap:
+		for key, value := range o.Data {
+			values[key] = append(values[key], []byte(value))
+		}
+		for key, value := range o.BinaryData {
+			values[key] = append(values[key], value)
+		}
+	case *corev1.Secret:
+		for key, value := range o.Data {
+			values[key] = append(values[key], value)
+		}
+	default:
+		return nil
+	}
+
+	hashes := make(map[string]string, len(values))
+	for key, parts := range values {
+		sum := sha256.New()
+		for _, part := range parts {
+			fmt.Fprintf(sum, "%d:", len(part))
+			sum.Write(part)
+		}
+		hashes[key] = fmt.Sprintf("%x", sum.Sum(nil))
+	}
+	return hashes
+}
+
+// describeChildChanges describes each child whose hash differs between the
+// previous and current hashes of a workload's children, sorted by child.
+// Changed ConfigMaps and Secrets are described with the keys that were added,
+// removed or changed, eg. "ConfigMap default/example1 keys key1,key2", unless
+// only their metadata changed the hash
+func describeChildChanges(previous, current map[string]childHash) []string {
+	changes := []string{}
+	for key, hash := range current {
+		old, ok := previous[key]
+		switch {
+		case !ok:
+			changes = append(changes, fmt.Sprintf("%s added", describeChildKey(key)))
+		case old.hash != hash.hash:
+			keys := changedDataKeys(old.keys, hash.keys)
+			if len(keys) == 0 {
+				changes = append(changes, fmt.Sprintf("%s changed", describeChildKey(key)))
+			} else {
+				changes = append(changes, fmt.Sprintf("%s keys %s", describeChildKey(key), strings.Join(keys, ",")))
+			}
+		}
+	}
+	for key := range previous {
+		if _, ok := current[key]; !ok {
+			changes = append(changes, fmt.Sprintf("%s removed", describeChildKey(key)))
+		}
+	}
+	sort.Strings(changes)
+	return changes
+}
+
+// describeChildKey formats a childHashKey as "Kind namespace/name"
+func describeChildKey(key string) string {
+	return strings.Replace(key, "/", " ", 1)
+}
+
+// changedDataKeys returns the sorted data keys that were added, removed or
+// whose value hash changed
+func changedDataKeys(previous, current map[string]string) []string {
+	keys := []string{}
+	for key, hash := range current {
+		if old, ok := previous[key]; !ok || old != hash {
+			keys = append(keys, key)
+		}
+	}
+	for key := range previous {
+		if _, ok := current[key]; !ok {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// configChangedMessage returns the message of the ConfigChanged event, naming
+// the changes that caused it when LogHashDiffs is set
+func (h *Handler) configChangedMessage(hash string, changes []string) string {
+	if !h.options.LogHashDiffs || len(changes) == 0 {
+		return fmt.Sprintf("Configuration hash updated to %s", hash)
+	}
+	return fmt.Sprintf("Configuration hash updated to %s, changed: %s", hash, strings.Join(changes, ", "))
+}
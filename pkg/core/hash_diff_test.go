@@ -0,0 +1,70 @@
+/*
+Copyright 2018 Pusher Ltd.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package core
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Wave hash diff Suite", func() {
+	Context("describeChildChanges", func() {
+		var previous map[string]childHash
+
+		BeforeEach(func() {
+			previous = map[string]childHash{
+				"ConfigMap/default/example1": {hash: "a", keys: map[string]string{"key1": "1", "key2": "2"}},
+				"Secret/default/example1":    {hash: "b", keys: map[string]string{"key1": "1"}},
+			}
+		})
+
+		It("describes nothing when no child changed", func() {
+			Expect(describeChildChanges(previous, previous)).To(BeEmpty())
+		})
+
+		It("names the keys that were changed, added or removed", func() {
+			current := map[string]childHash{
+				"ConfigMap/default/example1": {hash: "c", keys: map[string]string{"key2": "changed", "key3": "3"}},
+				"Secret/default/example1":    previous["Secret/default/example1"],
+			}
+			Expect(describeChildChanges(previous, current)).To(Equal([]string{
+				"ConfigMap default/example1 keys key1,key2,key3",
+			}))
+		})
+
+		It("describes a child whose data keys didn't change", func() {
+			current := map[string]childHash{
+				"ConfigMap/default/example1": {hash: "c", keys: previous["ConfigMap/default/example1"].keys},
+				"Secret/default/example1":    previous["Secret/default/example1"],
+			}
+			Expect(describeChildChanges(previous, current)).To(Equal([]string{
+				"ConfigMap default/example1 changed",
+			}))
+		})
+
+		It("describes children that were added or removed", func() {
+			current := map[string]childHash{
+				"ConfigMap/default/example1": previous["ConfigMap/default/example1"],
+				"Secret/other/example2":      {hash: "d"},
+			}
+			Expect(describeChildChanges(previous, current)).To(Equal([]string{
+				"Secret default/example1 removed",
+				"Secret other/example2 added",
+			}))
+		})
+	})
+})
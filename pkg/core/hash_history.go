@@ -0,0 +1,48 @@
+/*
+Copyright 2018 Pusher Ltd.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package core
+
+import (
+	"strings"
+)
+
+// appendHashHistory appends the hash to the workload's HashHistoryAnnotation,
+// unless it is already the latest entry, keeping only the latest limit
+// entries.
+// The annotation is left untouched if limit is not positive
+func appendHashHistory(obj Object, hash string, limit int) {
+	if limit <= 0 {
+		return
+	}
+
+	annotations := obj.GetAnnotations()
+	if annotations == nil {
+		annotations = make(map[string]string)
+	}
+	history := []string{}
+	if value := annotations[HashHistoryAnnotation]; value != "" {
+		history = strings.Split(value, ",")
+	}
+	if len(history) == 0 || history[len(history)-1] != hash {
+		history = append(history, hash)
+	}
+	if len(history) > limit {
+		history = history[len(history)-limit:]
+	}
+	annotations[HashHistoryAnnotation] = strings.Join(history, ",")
+	obj.SetAnnotations(annotations)
+}
@@ -0,0 +1,57 @@
+/*
+Copyright 2018 Pusher Ltd.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package core
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/pusher/wave/test/utils"
+	appsv1 "k8s.io/api/apps/v1"
+)
+
+var _ = Describe("Wave hash history Suite", func() {
+	Context("appendHashHistory", func() {
+		var deployment *appsv1.Deployment
+
+		BeforeEach(func() {
+			deployment = utils.ExampleDeployment.DeepCopy()
+		})
+
+		It("starts the history with the hash", func() {
+			appendHashHistory(deployment, "a", 3)
+			Expect(deployment.GetAnnotations()).To(HaveKeyWithValue(HashHistoryAnnotation, "a"))
+		})
+
+		It("doesn't repeat the latest hash", func() {
+			appendHashHistory(deployment, "a", 3)
+			appendHashHistory(deployment, "a", 3)
+			Expect(deployment.GetAnnotations()).To(HaveKeyWithValue(HashHistoryAnnotation, "a"))
+		})
+
+		It("prunes the oldest hashes beyond the limit", func() {
+			for _, hash := range []string{"a", "b", "c", "d"} {
+				appendHashHistory(deployment, hash, 3)
+			}
+			Expect(deployment.GetAnnotations()).To(HaveKeyWithValue(HashHistoryAnnotation, "b,c,d"))
+		})
+
+		It("doesn't record a history without a limit", func() {
+			appendHashHistory(deployment, "a", 0)
+			Expect(deployment.GetAnnotations()).NotTo(HaveKey(HashHistoryAnnotation))
+		})
+	})
+})
@@ -0,0 +1,90 @@
+/*
+Copyright 2018 Pusher Ltd.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package core
+
+import (
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+// getHashKeyChildren returns the children with the workload's
+// HashKeysAnnotation copied onto each of its ConfigMaps, so that only the
+// listed keys of each are hashed.
+// The children are returned unchanged if the workload doesn't have the
+// annotation
+func getHashKeyChildren(obj Object, children []Object) []Object {
+	value, ok := obj.GetAnnotations()[HashKeysAnnotation]
+	if !ok {
+		return children
+	}
+
+	hashed := make([]Object, 0, len(children))
+	for _, child := range children {
+		cm, ok := child.(*corev1.ConfigMap)
+		if !ok {
+			hashed = append(hashed, child)
+			continue
+		}
+		copy := cm.DeepCopy()
+		annotations := copy.GetAnnotations()
+		if annotations == nil {
+			annotations = make(map[string]string)
+		}
+		annotations[HashKeysAnnotation] = value
+		copy.SetAnnotations(annotations)
+		hashed = append(hashed, copy)
+	}
+	return hashed
+}
+
+// contentCacheFor returns the cache used to hash the workload's children.
+// Workloads with the HashKeysAnnotation hash different content from other
+// workloads sharing the same children, so never use the cache
+func (h *Handler) contentCacheFor(obj Object) *contentCache {
+	if _, ok := obj.GetAnnotations()[HashKeysAnnotation]; ok {
+		return nil
+	}
+	return h.contents
+}
+
+// hashedConfigMapData returns the data and binary data of the ConfigMap that
+// are hashed.
+// If the ConfigMap has the HashKeysAnnotation, only the listed keys are
+// returned and listed keys missing from the ConfigMap are returned as empty
+// data
+func hashedConfigMapData(cm *corev1.ConfigMap) (map[string]string, map[string][]byte) {
+	value, ok := cm.GetAnnotations()[HashKeysAnnotation]
+	if !ok {
+		return normalizeConfigMapData(cm.Data), normalizeBinaryData(cm.BinaryData)
+	}
+
+	data := make(map[string]string)
+	binaryData := make(map[string][]byte)
+	for _, key := range strings.Split(value, ",") {
+		key = strings.TrimSpace(key)
+		if key == "" {
+			continue
+		}
+		if bytes, ok := cm.BinaryData[key]; ok {
+			binaryData[key] = bytes
+			continue
+		}
+		data[key] = cm.Data[key]
+	}
+	return data, binaryData
+}
@@ -0,0 +1,100 @@
+/*
+Copyright 2018 Pusher Ltd.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package core
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/pusher/wave/test/utils"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+)
+
+var _ = Describe("Wave hash keys Suite", func() {
+	Context("calculateConfigHash", func() {
+		var cm *corev1.ConfigMap
+		var originalHash string
+
+		// hash returns the hash of the ConfigMap alone
+		var hash = func() string {
+			h, err := calculateConfigHash([]Object{cm})
+			Expect(err).NotTo(HaveOccurred())
+			return h
+		}
+
+		BeforeEach(func() {
+			cm = utils.ExampleConfigMap1.DeepCopy()
+			cm.SetAnnotations(map[string]string{HashKeysAnnotation: "key1, missing"})
+			originalHash = hash()
+		})
+
+		It("ignores changes to unlisted keys", func() {
+			cm.Data["key2"] = "modified"
+			delete(cm.Data, "key3")
+			Expect(hash()).To(Equal(originalHash))
+		})
+
+		It("hashes changes to listed keys", func() {
+			cm.Data["key1"] = "modified"
+			Expect(hash()).NotTo(Equal(originalHash))
+		})
+
+		It("hashes listed binary data", func() {
+			cm.SetAnnotations(map[string]string{HashKeysAnnotation: "binary"})
+			cm.BinaryData = map[string][]byte{"binary": []byte("example")}
+			originalHash = hash()
+
+			cm.BinaryData["binary"] = []byte("modified")
+			Expect(hash()).NotTo(Equal(originalHash))
+		})
+
+		It("hashes missing keys as empty", func() {
+			cm.Data["missing"] = ""
+			Expect(hash()).To(Equal(originalHash))
+
+			cm.Data["missing"] = "added"
+			Expect(hash()).NotTo(Equal(originalHash))
+		})
+	})
+
+	Context("getHashKeyChildren", func() {
+		var deployment *appsv1.Deployment
+		var children []Object
+
+		BeforeEach(func() {
+			deployment = utils.ExampleDeployment.DeepCopy()
+			children = []Object{
+				utils.ExampleConfigMap1.DeepCopy(),
+				utils.ExampleSecret1.DeepCopy(),
+			}
+		})
+
+		It("returns the children unchanged without the annotation", func() {
+			Expect(getHashKeyChildren(deployment, children)).To(Equal(children))
+		})
+
+		It("copies the annotation onto ConfigMaps only", func() {
+			deployment.SetAnnotations(map[string]string{HashKeysAnnotation: "key1"})
+
+			hashed := getHashKeyChildren(deployment, children)
+			Expect(hashed).To(HaveLen(2))
+			Expect(hashed[0].GetAnnotations()).To(HaveKeyWithValue(HashKeysAnnotation, "key1"))
+			Expect(hashed[1]).To(Equal(children[1]))
+			Expect(children[0].GetAnnotations()).NotTo(HaveKey(HashKeysAnnotation))
+		})
+	})
+})
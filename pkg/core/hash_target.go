@@ -0,0 +1,165 @@
+/*
+Copyright 2018 Pusher Ltd.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package core
+
+import (
+	"fmt"
+	"strings"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/validation"
+)
+
+// HashTargetLabel is the value of the HashTargetAnnotation that records the
+// configuration hash in a label on the PodTemplate
+const HashTargetLabel = "label"
+
+// hashTarget is where on a workload's PodTemplate metadata its configuration
+// hash is recorded
+type hashTarget struct {
+	// label records the hash in a label rather than an annotation
+	label bool
+
+	// key is the key of the label or annotation
+	key string
+}
+
+// getHashTarget returns the hashTarget chosen by the workload's
+// HashTargetAnnotation, given the key of the annotation the hash is recorded
+// in by default.
+// A value of HashTargetLabel records the hash in a label with the default
+// key, any other value records it in the annotation with that key
+func getHashTarget(obj metav1.Object, annotation string) hashTarget {
+	switch value := obj.GetAnnotations()[HashTargetAnnotation]; value {
+	case "":
+		return hashTarget{key: annotation}
+	case HashTargetLabel:
+		return hashTarget{label: true, key: annotation}
+	default:
+		// Keys the API server would reject are ignored rather than failing
+		// every update of the workload, ValidateAnnotations reports them
+		if validateHashTargetKey(value) != nil {
+			return hashTarget{key: annotation}
+		}
+		return hashTarget{key: value}
+	}
+}
+
+// validateHashTargetKey checks that the custom annotation named by the
+// HashTargetAnnotation is a valid annotation key
+func validateHashTargetKey(key string) error {
+	if errs := validation.IsQualifiedName(key); len(errs) > 0 {
+		return fmt.Errorf("invalid %s annotation %q, expected %s or an annotation key: %s", HashTargetAnnotation, key, HashTargetLabel, strings.Join(errs, ", "))
+	}
+	return nil
+}
+
+// recordHashTargetKey removes the hash from the custom annotation recorded in
+// the workload's HashTargetKeyAnnotation if it is no longer the target, and
+// records the custom annotation of the target instead when the hash stamped
+// in it changes.
+// A nil target, as with the env var trigger, stamps no annotation
+func recordHashTargetKey(obj Object, podTemplate metav1.Object, target *hashTarget, annotation, hash string) {
+	custom := target != nil && !target.label && target.key != annotation
+	previous := obj.GetAnnotations()[HashTargetKeyAnnotation]
+	if previous != "" && previous != annotation && (!custom || previous != target.key) {
+		removeAnnotation(podTemplate, previous)
+	}
+
+	if !custom {
+		removeAnnotation(obj, HashTargetKeyAnnotation)
+		return
+	}
+	if previous == target.key || getTargetConfigHash(podTemplate, *target) == hash {
+		return
+	}
+	annotations := obj.GetAnnotations()
+	if annotations == nil {
+		annotations = make(map[string]string)
+	}
+	annotations[HashTargetKeyAnnotation] = target.key
+	obj.SetAnnotations(annotations)
+}
+
+// fitHashTarget shortens the hash to fit the workload's hashTarget.
+// Label values are limited to 63 characters, shorter than a SHA256 hash, so
+// hashes recorded in a label are truncated
+func fitHashTarget(obj Object, annotation, hash string) string {
+	if getPodTemplate(obj) == nil || getRolloutTrigger(obj) == RolloutTriggerEnvVar || !getHashTarget(obj, annotation).label {
+		return hash
+	}
+	if len(hash) > validation.LabelValueMaxLength {
+		return hash[:validation.LabelValueMaxLength]
+	}
+	return hash
+}
+
+// getTargetConfigHash returns the configuration hash recorded in the target of
+// the PodTemplate metadata
+func getTargetConfigHash(meta metav1.Object, target hashTarget) string {
+	if target.label {
+		return meta.GetLabels()[target.key]
+	}
+	return meta.GetAnnotations()[target.key]
+}
+
+// setTargetConfigHash records the configuration hash in the target of the
+// PodTemplate metadata, removing the hash from the label or annotation with
+// the default key if the target is elsewhere
+func setTargetConfigHash(meta metav1.Object, target hashTarget, annotation, hash string) {
+	if target.label {
+		removeAnnotation(meta, annotation)
+		labels := meta.GetLabels()
+		if labels == nil {
+			labels = make(map[string]string)
+		}
+		labels[target.key] = hash
+		meta.SetLabels(labels)
+		return
+	}
+
+	removeLabel(meta, annotation)
+	if target.key != annotation {
+		removeAnnotation(meta, annotation)
+	}
+	annotations := meta.GetAnnotations()
+	if annotations == nil {
+		annotations = make(map[string]string)
+	}
+	annotations[target.key] = hash
+	meta.SetAnnotations(annotations)
+}
+
+// removeAnnotation removes the annotation from the metadata, leaving the
+// metadata untouched if it doesn't have it
+func removeAnnotation(meta metav1.Object, key string) {
+	annotations := meta.GetAnnotations()
+	if _, ok := annotations[key]; ok {
+		delete(annotations, key)
+		meta.SetAnnotations(annotations)
+	}
+}
+
+// removeLabel removes the label from the metadata, leaving the metadata
+// untouched if it doesn't have it
+func removeLabel(meta metav1.Object, key string) {
+	labels := meta.GetLabels()
+	if _, ok := labels[key]; ok {
+		delete(labels, key)
+		meta.SetLabels(labels)
+	}
+}
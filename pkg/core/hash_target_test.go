@@ -0,0 +1,152 @@
+/*
+Copyright 2018 Pusher Ltd.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package core
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/pusher/wave/test/utils"
+	appsv1 "k8s.io/api/apps/v1"
+)
+
+var _ = Describe("Wave hash target Suite", func() {
+	const customAnnotation = "example.com/config-version"
+
+	Context("getHashTarget", func() {
+		var deployment *appsv1.Deployment
+
+		BeforeEach(func() {
+			deployment = utils.ExampleDeployment.DeepCopy()
+		})
+
+		It("defaults to the given annotation", func() {
+			Expect(getHashTarget(deployment, ConfigHashAnnotation)).To(Equal(hashTarget{key: ConfigHashAnnotation}))
+		})
+
+		It("returns a label with the given key when selected by the annotation", func() {
+			deployment.SetAnnotations(map[string]string{HashTargetAnnotation: HashTargetLabel})
+			Expect(getHashTarget(deployment, ConfigHashAnnotation)).To(Equal(hashTarget{label: true, key: ConfigHashAnnotation}))
+		})
+
+		It("returns the custom annotation named by the annotation", func() {
+			deployment.SetAnnotations(map[string]string{HashTargetAnnotation: customAnnotation})
+			Expect(getHashTarget(deployment, ConfigHashAnnotation)).To(Equal(hashTarget{key: customAnnotation}))
+		})
+
+		It("ignores a custom annotation that isn't a valid key", func() {
+			deployment.SetAnnotations(map[string]string{HashTargetAnnotation: "not a key"})
+			Expect(getHashTarget(deployment, ConfigHashAnnotation)).To(Equal(hashTarget{key: ConfigHashAnnotation}))
+		})
+	})
+
+	Context("fitHashTarget", func() {
+		It("truncates the hash to the maximum length of a label value", func() {
+			deployment := utils.ExampleDeployment.DeepCopy()
+			deployment.SetAnnotations(map[string]string{HashTargetAnnotation: HashTargetLabel})
+			Expect(fitHashTarget(deployment, ConfigHashAnnotation, exampleHash)).To(Equal(exampleHash[:63]))
+		})
+
+		It("doesn't truncate the hash for an annotation", func() {
+			deployment := utils.ExampleDeployment.DeepCopy()
+			deployment.SetAnnotations(map[string]string{HashTargetAnnotation: customAnnotation})
+			Expect(fitHashTarget(deployment, ConfigHashAnnotation, exampleHash)).To(Equal(exampleHash))
+		})
+
+		It("doesn't truncate the hash with the env var trigger", func() {
+			deployment := utils.ExampleDeployment.DeepCopy()
+			deployment.SetAnnotations(map[string]string{
+				HashTargetAnnotation:     HashTargetLabel,
+				RolloutTriggerAnnotation: string(RolloutTriggerEnvVar),
+			})
+			Expect(fitHashTarget(deployment, ConfigHashAnnotation, exampleHash)).To(Equal(exampleHash))
+		})
+	})
+
+	Context("setConfigHash", func() {
+		var deployment *appsv1.Deployment
+
+		BeforeEach(func() {
+			deployment = utils.ExampleDeployment.DeepCopy()
+			deployment.Spec.Template.SetAnnotations(map[string]string{ConfigHashAnnotation: "old", "other": "annotation"})
+		})
+
+		It("moves the hash to a label with the label target", func() {
+			deployment.SetAnnotations(map[string]string{HashTargetAnnotation: HashTargetLabel})
+			setConfigHash(deployment, ConfigHashAnnotation, "hash")
+
+			Expect(deployment.Spec.Template.GetLabels()).To(HaveKeyWithValue(ConfigHashAnnotation, "hash"))
+			Expect(deployment.Spec.Template.GetAnnotations()).To(Equal(map[string]string{"other": "annotation"}))
+		})
+
+		It("moves the hash to the custom annotation with an annotation target", func() {
+			deployment.SetAnnotations(map[string]string{HashTargetAnnotation: customAnnotation})
+			setConfigHash(deployment, ConfigHashAnnotation, "hash")
+
+			Expect(deployment.Spec.Template.GetAnnotations()).To(Equal(map[string]string{customAnnotation: "hash", "other": "annotation"}))
+		})
+
+		It("records the custom annotation the hash is moved to", func() {
+			deployment.SetAnnotations(map[string]string{HashTargetAnnotation: customAnnotation})
+			setConfigHash(deployment, ConfigHashAnnotation, "hash")
+
+			Expect(deployment.GetAnnotations()).To(HaveKeyWithValue(HashTargetKeyAnnotation, customAnnotation))
+		})
+
+		It("removes the hash from the previous custom annotation", func() {
+			deployment.SetAnnotations(map[string]string{
+				HashTargetAnnotation:    "example.com/other-version",
+				HashTargetKeyAnnotation: customAnnotation,
+			})
+			deployment.Spec.Template.SetAnnotations(map[string]string{customAnnotation: "old", "other": "annotation"})
+			setConfigHash(deployment, ConfigHashAnnotation, "hash")
+
+			Expect(deployment.Spec.Template.GetAnnotations()).To(Equal(map[string]string{"example.com/other-version": "hash", "other": "annotation"}))
+			Expect(deployment.GetAnnotations()).To(HaveKeyWithValue(HashTargetKeyAnnotation, "example.com/other-version"))
+		})
+
+		It("removes the hash from the previous custom annotation without a target", func() {
+			deployment.SetAnnotations(map[string]string{HashTargetKeyAnnotation: customAnnotation})
+			deployment.Spec.Template.SetAnnotations(map[string]string{customAnnotation: "old", "other": "annotation"})
+			setConfigHash(deployment, ConfigHashAnnotation, "hash")
+
+			Expect(deployment.Spec.Template.GetAnnotations()).To(Equal(map[string]string{ConfigHashAnnotation: "hash", "other": "annotation"}))
+			Expect(deployment.GetAnnotations()).NotTo(HaveKey(HashTargetKeyAnnotation))
+		})
+
+		It("moves the hash back to the default annotation without a target", func() {
+			labels := deployment.Spec.Template.GetLabels()
+			labels[ConfigHashAnnotation] = "old"
+			deployment.Spec.Template.SetLabels(labels)
+			setConfigHash(deployment, ConfigHashAnnotation, "hash")
+
+			Expect(deployment.Spec.Template.GetLabels()).NotTo(HaveKey(ConfigHashAnnotation))
+			Expect(deployment.Spec.Template.GetAnnotations()).To(HaveKeyWithValue(ConfigHashAnnotation, "hash"))
+		})
+
+		It("leaves the other labels of the Pod Template untouched", func() {
+			deployment.SetAnnotations(map[string]string{HashTargetAnnotation: HashTargetLabel})
+			labels := map[string]string{}
+			for k, v := range deployment.Spec.Template.GetLabels() {
+				labels[k] = v
+			}
+			setConfigHash(deployment, ConfigHashAnnotation, "hash")
+
+			labels[ConfigHashAnnotation] = "hash"
+			Expect(deployment.Spec.Template.GetLabels()).To(Equal(labels))
+		})
+	})
+})
@@ -17,6 +17,7 @@ limitations under the License.
 package core
 
 import (
+	"encoding/json"
 	"sync"
 	"time"
 
@@ -25,6 +26,9 @@ import (
 	"github.com/pusher/wave/test/utils"
 	appsv1 "k8s.io/api/apps/v1"
 	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/manager"
 )
@@ -107,6 +111,339 @@ var _ = Describe("Wave hash Suite", func() {
 			Expect(h2).To(Equal(h1))
 		})
 
+		It("returns the same hash when a child is replaced by one with identical content", func() {
+			cm3 := cm1.DeepCopy()
+			cm3.SetName("example3")
+
+			h1, err := calculateConfigHash([]Object{cm1, cm2, s1, s2})
+			Expect(err).NotTo(HaveOccurred())
+			h2, err := calculateConfigHash([]Object{cm3, cm2, s1, s2})
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(h2).To(Equal(h1))
+		})
+
+		It("returns the same hash when only server-side defaults are added", func() {
+			emptyCM := &corev1.ConfigMap{}
+			emptyCM.SetName("empty")
+			emptySecret := &corev1.Secret{}
+			emptySecret.SetName("empty")
+
+			h1, err := calculateConfigHash([]Object{cm1, s1, emptyCM, emptySecret})
+			Expect(err).NotTo(HaveOccurred())
+
+			// Simulate the API server defaulting fields on the children
+			defaultedS1 := s1.DeepCopy()
+			defaultedS1.Type = corev1.SecretTypeOpaque
+			defaultedCM := emptyCM.DeepCopy()
+			defaultedCM.Data = map[string]string{}
+			defaultedSecret := emptySecret.DeepCopy()
+			defaultedSecret.Type = corev1.SecretTypeOpaque
+			defaultedSecret.Data = map[string][]byte{}
+
+			h2, err := calculateConfigHash([]Object{cm1, defaultedS1, defaultedCM, defaultedSecret})
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(h2).To(Equal(h1))
+		})
+
+		It("returns a different hash when a ConfigMap's binary data is updated", func() {
+			c := []Object{cm1, cm2, s1, s2}
+
+			h1, err := calculateConfigHash(c)
+			Expect(err).NotTo(HaveOccurred())
+
+			cm1.BinaryData = map[string][]byte{"binary": []byte("modified")}
+			m.Update(cm1).Should(Succeed())
+			h2, err := calculateConfigHash(c)
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(h2).NotTo(Equal(h1))
+		})
+
+		It("returns the same hash for identical binary content", func() {
+			// Binary content that isn't valid UTF-8, such as DER encoded
+			// certificates, must be hashed byte for byte
+			der := []byte{0x30, 0x82, 0x01, 0x0a, 0xff, 0xfe, 0x00, 0x80}
+			cm := &corev1.ConfigMap{BinaryData: map[string][]byte{"tls.der": der}}
+			secret := &corev1.Secret{Data: map[string][]byte{"tls.der": der}}
+
+			h1, err := calculateConfigHash([]Object{cm, secret})
+			Expect(err).NotTo(HaveOccurred())
+
+			der2 := append([]byte{}, der...)
+			h2, err := calculateConfigHash([]Object{
+				&corev1.ConfigMap{BinaryData: map[string][]byte{"tls.der": der2}},
+				&corev1.Secret{Data: map[string][]byte{"tls.der": der2}},
+			})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(h2).To(Equal(h1))
+		})
+
+		It("returns a different hash when any byte of binary content changes", func() {
+			der := []byte{0x30, 0x82, 0x01, 0x0a, 0xff, 0xfe, 0x00, 0x80}
+			hashes := map[string]struct{}{}
+			for _, newChild := range []func(data []byte) Object{
+				func(data []byte) Object {
+					return &corev1.ConfigMap{BinaryData: map[string][]byte{"tls.der": data}}
+				},
+				func(data []byte) Object {
+					return &corev1.Secret{Data: map[string][]byte{"tls.der": data}}
+				},
+			} {
+				original, err := calculateConfigHash([]Object{newChild(der)})
+				Expect(err).NotTo(HaveOccurred())
+
+				for i := range der {
+					modified := append([]byte{}, der...)
+					modified[i] ^= 0x01
+					h, err := calculateConfigHash([]Object{newChild(modified)})
+					Expect(err).NotTo(HaveOccurred())
+					Expect(h).NotTo(Equal(original))
+					hashes[h] = struct{}{}
+				}
+			}
+			Expect(hashes).To(HaveLen(2 * len(der)))
+		})
+
+		It("doesn't confuse the same key in a ConfigMap's data and binary data", func() {
+			data := &corev1.ConfigMap{
+				Data: map[string]string{"key": "value"},
+			}
+			binaryData := &corev1.ConfigMap{
+				BinaryData: map[string][]byte{"key": []byte("value")},
+			}
+			overlapping := &corev1.ConfigMap{
+				Data:       map[string]string{"key": "value"},
+				BinaryData: map[string][]byte{"key": []byte("value")},
+			}
+
+			hData, err := calculateConfigHash([]Object{data})
+			Expect(err).NotTo(HaveOccurred())
+			hBinaryData, err := calculateConfigHash([]Object{binaryData})
+			Expect(err).NotTo(HaveOccurred())
+			hOverlapping, err := calculateConfigHash([]Object{overlapping})
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(hData).NotTo(Equal(hBinaryData))
+			Expect(hOverlapping).NotTo(Equal(hData))
+			Expect(hOverlapping).NotTo(Equal(hBinaryData))
+
+			// The hash of the overlapping ConfigMap must be deterministic
+			for i := 0; i < 10; i++ {
+				h, err := calculateConfigHash([]Object{overlapping.DeepCopy()})
+				Expect(err).NotTo(HaveOccurred())
+				Expect(h).To(Equal(hOverlapping))
+			}
+		})
+
+		It("doesn't confuse keys and values that concatenate identically", func() {
+			// Naively concatenating each key and value would hash these the same
+			split := &corev1.ConfigMap{Data: map[string]string{"A": "BC"}}
+			shifted := &corev1.ConfigMap{Data: map[string]string{"AB": "C"}}
+			joined := &corev1.ConfigMap{Data: map[string]string{"A": "B", "C": ""}}
+			escaped := &corev1.ConfigMap{Data: map[string]string{"A": `B","C":"`}}
+
+			hashes := map[string]string{}
+			for name, cm := range map[string]*corev1.ConfigMap{"split": split, "shifted": shifted, "joined": joined, "escaped": escaped} {
+				h, err := calculateConfigHash([]Object{cm})
+				Expect(err).NotTo(HaveOccurred())
+				Expect(hashes).NotTo(ContainElement(h), "hash of %s ConfigMap collides", name)
+				hashes[name] = h
+			}
+		})
+
+		It("doesn't confuse the boundaries between children", func() {
+			combined := &corev1.ConfigMap{Data: map[string]string{"A": "B", "C": "D"}}
+			first := &corev1.ConfigMap{Data: map[string]string{"A": "B"}}
+			second := &corev1.ConfigMap{Data: map[string]string{"C": "D"}}
+
+			h1, err := calculateConfigHash([]Object{combined})
+			Expect(err).NotTo(HaveOccurred())
+			h2, err := calculateConfigHash([]Object{first, second})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(h2).NotTo(Equal(h1))
+
+			// The same data in a ConfigMap and a Secret must not collide either
+			secret := &corev1.Secret{Data: map[string][]byte{"A": []byte("B")}}
+			h3, err := calculateConfigHash([]Object{first})
+			Expect(err).NotTo(HaveOccurred())
+			h4, err := calculateConfigHash([]Object{secret})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(h4).NotTo(Equal(h3))
+		})
+
+		It("returns a different hash when a key is renamed without changing its value", func() {
+			renamed := func(data map[string]string, from, to string) map[string]string {
+				copy := map[string]string{}
+				for key, value := range data {
+					copy[key] = value
+				}
+				copy[to] = copy[from]
+				delete(copy, from)
+				return copy
+			}
+
+			h1, err := calculateConfigHash([]Object{cm1, s1})
+			Expect(err).NotTo(HaveOccurred())
+
+			cm := cm1.DeepCopy()
+			cm.Data = renamed(cm.Data, "key1", "renamed")
+			h2, err := calculateConfigHash([]Object{cm, s1})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(h2).NotTo(Equal(h1))
+
+			binary := &corev1.ConfigMap{BinaryData: map[string][]byte{"db.conf": []byte("config")}}
+			renamedBinary := &corev1.ConfigMap{BinaryData: map[string][]byte{"database.conf": []byte("config")}}
+			h3, err := calculateConfigHash([]Object{binary})
+			Expect(err).NotTo(HaveOccurred())
+			h4, err := calculateConfigHash([]Object{renamedBinary})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(h4).NotTo(Equal(h3))
+
+			secret := &corev1.Secret{Data: map[string][]byte{"db.conf": []byte("config")}}
+			renamedSecret := &corev1.Secret{Data: map[string][]byte{"database.conf": []byte("config")}}
+			h5, err := calculateConfigHash([]Object{secret})
+			Expect(err).NotTo(HaveOccurred())
+			h6, err := calculateConfigHash([]Object{renamedSecret})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(h6).NotTo(Equal(h5))
+		})
+
+		It("returns the same hash independent of the order keys were added in", func() {
+			keys := []string{"a", "b", "c", "d", "e", "f", "g", "h"}
+			forwards := &corev1.ConfigMap{Data: map[string]string{}}
+			for _, key := range keys {
+				forwards.Data[key] = "value:" + key
+			}
+			backwards := &corev1.ConfigMap{Data: map[string]string{}}
+			for i := len(keys) - 1; i >= 0; i-- {
+				backwards.Data[keys[i]] = "value:" + keys[i]
+			}
+
+			h1, err := calculateConfigHash([]Object{forwards})
+			Expect(err).NotTo(HaveOccurred())
+			for i := 0; i < 10; i++ {
+				h2, err := calculateConfigHash([]Object{backwards})
+				Expect(err).NotTo(HaveOccurred())
+				Expect(h2).To(Equal(h1))
+			}
+		})
+
+		It("returns the same hash for different encodings of identical Secret data", func() {
+			// "dmFsdWU=" is the canonical base64 encoding of "value", "dmFsdWV="
+			// sets the unused trailing bits and decodes to the same bytes
+			canonical := &corev1.Secret{}
+			Expect(json.Unmarshal([]byte(`{"metadata":{"name":"canonical","namespace":"default"},"data":{"key":"dmFsdWU="}}`), canonical)).To(Succeed())
+			nonCanonical := &corev1.Secret{}
+			Expect(json.Unmarshal([]byte(`{"metadata":{"name":"non-canonical","namespace":"default"},"data":{"key":"dmFsdWV="}}`), nonCanonical)).To(Succeed())
+
+			h1, err := calculateConfigHash([]Object{canonical})
+			Expect(err).NotTo(HaveOccurred())
+			h2, err := calculateConfigHash([]Object{nonCanonical})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(h2).To(Equal(h1))
+
+			// The hash must also be the same once stored by the API server
+			m.Create(canonical).Should(Succeed())
+			m.Create(nonCanonical).Should(Succeed())
+			m.Get(canonical, timeout).Should(Succeed())
+			m.Get(nonCanonical, timeout).Should(Succeed())
+
+			h3, err := calculateConfigHash([]Object{canonical})
+			Expect(err).NotTo(HaveOccurred())
+			h4, err := calculateConfigHash([]Object{nonCanonical})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(h3).To(Equal(h1))
+			Expect(h4).To(Equal(h1))
+		})
+
+		It("includes the value of the version label only when it is configured", func() {
+			labelled := cm1.DeepCopy()
+			labelled.SetLabels(map[string]string{"config-version": "1"})
+			bumped := cm1.DeepCopy()
+			bumped.SetLabels(map[string]string{"config-version": "2"})
+
+			unlabelledHash, err := calculateConfigHashWithCache([]Object{cm1}, nil, "config-version", nil)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(calculateConfigHash([]Object{cm1})).To(Equal(unlabelledHash))
+			Expect(calculateConfigHash([]Object{labelled})).To(Equal(unlabelledHash))
+
+			labelledHash, err := calculateConfigHashWithCache([]Object{labelled}, nil, "config-version", nil)
+			Expect(err).NotTo(HaveOccurred())
+			bumpedHash, err := calculateConfigHashWithCache([]Object{bumped}, nil, "config-version", nil)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(labelledHash).NotTo(Equal(unlabelledHash))
+			Expect(bumpedHash).NotTo(Equal(labelledHash))
+		})
+
+		It("includes the resourceVersion only when configured", func() {
+			cm1.SetResourceVersion("1")
+			updated := cm1.DeepCopy()
+			updated.SetResourceVersion("2")
+			updated.SetLabels(map[string]string{"relabelled": "true"})
+			tracker := newResourceVersionTracker()
+
+			h1, err := calculateConfigHashWithCache([]Object{cm1}, nil, "", nil)
+			Expect(err).NotTo(HaveOccurred())
+			h2, err := calculateConfigHashWithCache([]Object{updated}, nil, "", nil)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(h2).To(Equal(h1))
+			Expect(calculateConfigHash([]Object{cm1})).To(Equal(h1))
+
+			h3, err := calculateConfigHashWithCache([]Object{cm1}, nil, "", tracker)
+			Expect(err).NotTo(HaveOccurred())
+			h4, err := calculateConfigHashWithCache([]Object{updated}, nil, "", tracker)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(h3).NotTo(Equal(h1))
+			Expect(h4).NotTo(Equal(h3))
+		})
+
+		It("doesn't include resourceVersions that only change the OwnerReferences", func() {
+			cm1.SetUID("cm1-uid")
+			cm1.SetResourceVersion("1")
+			owned := cm1.DeepCopy()
+			owned.SetResourceVersion("2")
+			owned.SetOwnerReferences([]metav1.OwnerReference{utils.GetOwnerRef(utils.ExampleDeployment)})
+			tracker := newResourceVersionTracker()
+
+			h1, err := calculateConfigHashWithCache([]Object{cm1}, nil, "", tracker)
+			Expect(err).NotTo(HaveOccurred())
+			h2, err := calculateConfigHashWithCache([]Object{owned}, nil, "", tracker)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(h2).To(Equal(h1))
+
+			relabelled := owned.DeepCopy()
+			relabelled.SetResourceVersion("3")
+			relabelled.SetLabels(map[string]string{"relabelled": "true"})
+			h3, err := calculateConfigHashWithCache([]Object{relabelled}, nil, "", tracker)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(h3).NotTo(Equal(h2))
+		})
+
+		It("hashes the spec but not the metadata or status of other kinds of children", func() {
+			widget := &unstructured.Unstructured{}
+			widget.SetGroupVersionKind(schema.GroupVersionKind{Group: "test.wave.pusher.com", Version: "v1alpha1", Kind: "Widget"})
+			widget.SetNamespace("default")
+			widget.SetName("widget")
+			widget.Object["spec"] = map[string]interface{}{"size": "small"}
+
+			base, err := calculateConfigHash([]Object{cm1, widget})
+			Expect(err).NotTo(HaveOccurred())
+			withoutWidget, err := calculateConfigHash([]Object{cm1})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(base).NotTo(Equal(withoutWidget))
+
+			relabelled := widget.DeepCopy()
+			relabelled.SetLabels(map[string]string{"foo": "bar"})
+			relabelled.Object["status"] = map[string]interface{}{"ready": true}
+			Expect(calculateConfigHash([]Object{cm1, relabelled})).To(Equal(base))
+
+			resized := widget.DeepCopy()
+			resized.Object["spec"] = map[string]interface{}{"size": "large"}
+			Expect(calculateConfigHash([]Object{cm1, resized})).NotTo(Equal(base))
+		})
+
 		It("returns the same hash independent of child ordering", func() {
 			c1 := []Object{cm1, cm2, s1, s2}
 			c2 := []Object{cm1, s2, cm2, s1}
@@ -118,6 +455,111 @@ var _ = Describe("Wave hash Suite", func() {
 
 			Expect(h2).To(Equal(h1))
 		})
+
+		Context("with a content cache", func() {
+			var cache *contentCache
+
+			BeforeEach(func() {
+				cache = newContentCache()
+			})
+
+			It("returns the same hash as without the cache", func() {
+				c := []Object{cm1, cm2, s1, s2}
+				fresh, err := calculateConfigHash(c)
+				Expect(err).NotTo(HaveOccurred())
+
+				// The first call populates the cache, the second reads from it
+				for i := 0; i < 2; i++ {
+					cached, err := calculateConfigHashWithCache(c, cache, "", nil)
+					Expect(err).NotTo(HaveOccurred())
+					Expect(cached).To(Equal(fresh))
+				}
+			})
+
+			It("caches the content of each child", func() {
+				_, err := calculateConfigHashWithCache([]Object{cm1, s1}, cache, "", nil)
+				Expect(err).NotTo(HaveOccurred())
+
+				for _, obj := range []Object{cm1, s1} {
+					content, ok := cache.get(obj)
+					Expect(ok).To(BeTrue())
+					expected, err := serializeChild(obj, "", nil)
+					Expect(err).NotTo(HaveOccurred())
+					Expect(content).To(Equal(expected))
+				}
+			})
+
+			It("recalculates the content when a child's resourceVersion changes", func() {
+				h1, err := calculateConfigHashWithCache([]Object{cm1, cm2, s1, s2}, cache, "", nil)
+				Expect(err).NotTo(HaveOccurred())
+
+				cm1.Data["key1"] = "modified"
+				m.Update(cm1).Should(Succeed())
+				m.Eventually(cm1, timeout).Should(WithTransform(func(obj *corev1.ConfigMap) string {
+					return obj.Data["key1"]
+				}, Equal("modified")))
+
+				h2, err := calculateConfigHashWithCache([]Object{cm1, cm2, s1, s2}, cache, "", nil)
+				Expect(err).NotTo(HaveOccurred())
+				fresh, err := calculateConfigHash([]Object{cm1, cm2, s1, s2})
+				Expect(err).NotTo(HaveOccurred())
+				Expect(h2).NotTo(Equal(h1))
+				Expect(h2).To(Equal(fresh))
+			})
+
+			It("doesn't cache children that haven't been read from the API server", func() {
+				cm := utils.ExampleConfigMap1.DeepCopy()
+				_, err := calculateConfigHashWithCache([]Object{cm}, cache, "", nil)
+				Expect(err).NotTo(HaveOccurred())
+
+				_, ok := cache.get(cm)
+				Expect(ok).To(BeFalse())
+			})
+		})
+	})
+
+	Context("HashAlgorithm", func() {
+		var children []Object
+
+		BeforeEach(func() {
+			children = []Object{
+				utils.ExampleConfigMap1.DeepCopy(),
+				&corev1.Secret{Data: map[string][]byte{"key1": []byte("value1")}},
+			}
+		})
+
+		It("hashes with the expected algorithm", func() {
+			Expect(HashSHA256.sum([]byte{})).To(Equal("e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"))
+			Expect(HashFNV.sum([]byte{})).To(Equal("cbf29ce484222325"))
+		})
+
+		It("calculates the same SHA256 hash as calculateConfigHash by default", func() {
+			expected, err := calculateConfigHash(children)
+			Expect(err).NotTo(HaveOccurred())
+			hash, err := NewHandler(nil, nil, Options{}).configHash(utils.ExampleDeployment, children, nil)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(hash).To(Equal(expected))
+		})
+
+		It("calculates a stable FNV hash", func() {
+			hash, err := NewHandler(nil, nil, Options{HashAlgorithm: HashFNV}).configHash(utils.ExampleDeployment, children, nil)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(hash).To(MatchRegexp("^[0-9a-f]{16}$"))
+
+			// A new Handler, eg. after a restart, calculates the same hash
+			again, err := NewHandler(nil, nil, Options{HashAlgorithm: HashFNV}).configHash(utils.ExampleDeployment, children, nil)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(again).To(Equal(hash))
+		})
+
+		It("salts the FNV hash with FNV", func() {
+			unsalted, err := NewHandler(nil, nil, Options{HashAlgorithm: HashFNV}).configHash(utils.ExampleDeployment, children, nil)
+			Expect(err).NotTo(HaveOccurred())
+			salted, err := NewHandler(nil, nil, Options{HashAlgorithm: HashFNV, HashSalt: "a"}).configHash(utils.ExampleDeployment, children, nil)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(salted).To(MatchRegexp("^[0-9a-f]{16}$"))
+			Expect(salted).NotTo(Equal(unsalted))
+		})
 	})
 
 	Context("setConfigHash", func() {
@@ -128,7 +570,7 @@ var _ = Describe("Wave hash Suite", func() {
 		})
 
 		It("sets the hash annotation to the provided value", func() {
-			setConfigHash(deployment, "1234")
+			setConfigHash(deployment, ConfigHashAnnotation, "1234")
 
 			podAnnotations := deployment.Spec.Template.GetAnnotations()
 			Expect(podAnnotations).NotTo(BeNil())
@@ -148,7 +590,7 @@ var _ = Describe("Wave hash Suite", func() {
 			deployment.Spec.Template.SetAnnotations(podAnnotations)
 
 			// Set the config hash
-			setConfigHash(deployment, "1234")
+			setConfigHash(deployment, ConfigHashAnnotation, "1234")
 
 			// Check the existing annotation is still in place
 			podAnnotations = deployment.Spec.Template.GetAnnotations()
@@ -0,0 +1,82 @@
+/*
+Copyright 2018 Pusher Ltd.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package core
+
+import (
+	"fmt"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+// getHashVolumeChildren returns the children referenced by the volumes listed
+// in the workload's HashVolumesAnnotation.
+// All children are returned if the workload doesn't have the annotation
+func getHashVolumeChildren(obj Object, children []Object) ([]Object, error) {
+	value, ok := obj.GetAnnotations()[HashVolumesAnnotation]
+	if !ok {
+		return children, nil
+	}
+
+	// Collect the names of the children referenced by each listed volume
+	volumes := make(map[string]corev1.Volume)
+	for _, vol := range getPodSpec(obj).Volumes {
+		volumes[vol.Name] = vol
+	}
+	configMaps := make(map[string]struct{})
+	secrets := make(map[string]struct{})
+	for _, name := range strings.Split(value, ",") {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+
+		vol, ok := volumes[name]
+		if !ok {
+			return nil, fmt.Errorf("unknown volume %q in %s annotation", name, HashVolumesAnnotation)
+		}
+		if cm := vol.VolumeSource.ConfigMap; cm != nil {
+			configMaps[cm.Name] = struct{}{}
+		}
+		if s := vol.VolumeSource.Secret; s != nil {
+			secrets[s.SecretName] = struct{}{}
+		}
+		if projected := vol.VolumeSource.Projected; projected != nil {
+			getProjectedChildNames(projected, configMaps, secrets)
+		}
+	}
+
+	// Volumes can only reference children in the workload's namespace
+	hashed := []Object{}
+	for _, child := range children {
+		if child.GetNamespace() != obj.GetNamespace() {
+			continue
+		}
+		// Missing optional children are hashed as absent markers of their kind
+		switch kindOf(child) {
+		case "ConfigMap":
+			if _, ok := configMaps[child.GetName()]; ok {
+				hashed = append(hashed, child)
+			}
+		case "Secret":
+			if _, ok := secrets[child.GetName()]; ok {
+				hashed = append(hashed, child)
+			}
+		}
+	}
+	return hashed, nil
+}
@@ -0,0 +1,97 @@
+/*
+Copyright 2018 Pusher Ltd.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package core
+
+import (
+	"context"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// serviceAccountGVK is the GroupVersionKind a workload's ServiceAccount is
+// indexed under
+var serviceAccountGVK = corev1.SchemeGroupVersion.WithKind("ServiceAccount")
+
+// getImagePullSecretKeys returns the keys of the image pull Secrets of the
+// workload that the ImagePullSecretsPolicy treats as children.
+// Secrets listed in both the PodSpec and the ServiceAccount are only returned
+// once. A missing ServiceAccount lists no Secrets, as the workload's Pods
+// can't be created until it exists
+func (h *Handler) getImagePullSecretKeys(obj Object) (map[types.NamespacedName]struct{}, error) {
+	keys := make(map[types.NamespacedName]struct{})
+	if h.options.ImagePullSecretsPolicy != ImagePullSecretsPod && h.options.ImagePullSecretsPolicy != ImagePullSecretsServiceAccount {
+		return keys, nil
+	}
+
+	podSpec := getPodSpec(obj)
+	for _, ref := range podSpec.ImagePullSecrets {
+		keys[types.NamespacedName{Namespace: obj.GetNamespace(), Name: ref.Name}] = struct{}{}
+	}
+	if h.options.ImagePullSecretsPolicy != ImagePullSecretsServiceAccount {
+		return keys, nil
+	}
+
+	serviceAccount := &corev1.ServiceAccount{}
+	err := h.Get(context.TODO(), types.NamespacedName{Namespace: obj.GetNamespace(), Name: serviceAccountName(podSpec)}, serviceAccount)
+	if err != nil && errors.IsNotFound(err) {
+		return keys, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	for _, ref := range serviceAccount.ImagePullSecrets {
+		keys[types.NamespacedName{Namespace: obj.GetNamespace(), Name: ref.Name}] = struct{}{}
+	}
+	return keys, nil
+}
+
+// serviceAccountName returns the name of the ServiceAccount the Pods of the
+// PodSpec run as, defaulting to the namespace's default ServiceAccount
+func serviceAccountName(podSpec *corev1.PodSpec) string {
+	if podSpec.ServiceAccountName != "" {
+		return podSpec.ServiceAccountName
+	}
+	if podSpec.DeprecatedServiceAccount != "" {
+		return podSpec.DeprecatedServiceAccount
+	}
+	return "default"
+}
+
+// withServiceAccount returns the children of other kinds indexed for a
+// workload. With ImagePullSecretsServiceAccount the workload's ServiceAccount
+// is indexed too, without hashing it, so that the workload is reconciled when
+// the image pull Secrets of its ServiceAccount change
+func (h *Handler) withServiceAccount(obj Object, extra map[schema.GroupVersionKind]map[types.NamespacedName]struct{}) map[schema.GroupVersionKind]map[types.NamespacedName]struct{} {
+	if h.options.ImagePullSecretsPolicy != ImagePullSecretsServiceAccount {
+		return extra
+	}
+
+	indexed := make(map[schema.GroupVersionKind]map[types.NamespacedName]struct{}, len(extra)+1)
+	for gvk, keys := range extra {
+		indexed[gvk] = keys
+	}
+	serviceAccounts := make(map[types.NamespacedName]struct{}, len(extra[serviceAccountGVK])+1)
+	for key := range extra[serviceAccountGVK] {
+		serviceAccounts[key] = struct{}{}
+	}
+	serviceAccounts[types.NamespacedName{Namespace: obj.GetNamespace(), Name: serviceAccountName(getPodSpec(obj))}] = struct{}{}
+	indexed[serviceAccountGVK] = serviceAccounts
+	return indexed
+}
@@ -0,0 +1,62 @@
+/*
+Copyright 2018 Pusher Ltd.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package core
+
+import (
+	"strings"
+
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// isImmutablePodTemplateError returns true if the error was returned by the
+// API server because the workload's PodTemplate cannot be modified after
+// creation (eg. for Jobs)
+func isImmutablePodTemplateError(err error) bool {
+	if !errors.IsInvalid(err) {
+		return false
+	}
+	status, ok := err.(errors.APIStatus)
+	if !ok || status.Status().Details == nil {
+		return false
+	}
+
+	for _, cause := range status.Status().Details.Causes {
+		if strings.HasPrefix(cause.Field, "spec.template") && strings.Contains(cause.Message, "field is immutable") {
+			return true
+		}
+	}
+	return false
+}
+
+// hasMetadataConfigHash returns true if the configuration hash of the workload
+// is recorded on its metadata because its PodTemplate is immutable
+func hasMetadataConfigHash(obj metav1.Object, annotation string) bool {
+	_, ok := obj.GetAnnotations()[annotation]
+	return ok
+}
+
+// setMetadataConfigHash updates the configuration hash annotation on the
+// workload's metadata rather than on its PodTemplate
+func setMetadataConfigHash(obj metav1.Object, annotation, hash string) {
+	annotations := obj.GetAnnotations()
+	if annotations == nil {
+		annotations = make(map[string]string)
+	}
+	annotations[annotation] = hash
+	obj.SetAnnotations(annotations)
+}
@@ -0,0 +1,118 @@
+/*
+Copyright 2018 Pusher Ltd.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package core
+
+import (
+	"context"
+	"fmt"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/pusher/wave/test/utils"
+	batchv1 "k8s.io/api/batch/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// recordingClient records the objects it is asked to update instead of
+// updating them
+type recordingClient struct {
+	client.Client
+	updated []runtime.Object
+}
+
+func (r *recordingClient) Update(ctx context.Context, obj runtime.Object) error {
+	r.updated = append(r.updated, obj)
+	return nil
+}
+
+var _ = Describe("Wave immutable Suite", func() {
+	var jobKind = schema.GroupKind{Group: "batch", Kind: "Job"}
+
+	Context("isImmutablePodTemplateError", func() {
+		It("returns true for an immutable PodTemplate error", func() {
+			err := errors.NewInvalid(jobKind, "example", field.ErrorList{
+				field.Invalid(field.NewPath("spec", "template"), "", "field is immutable"),
+			})
+			Expect(isImmutablePodTemplateError(err)).To(BeTrue())
+		})
+
+		It("returns false for an invalid error on another field", func() {
+			err := errors.NewInvalid(jobKind, "example", field.ErrorList{
+				field.Invalid(field.NewPath("spec", "selector"), "", "field is immutable"),
+			})
+			Expect(isImmutablePodTemplateError(err)).To(BeFalse())
+		})
+
+		It("returns false for other errors", func() {
+			Expect(isImmutablePodTemplateError(fmt.Errorf("error"))).To(BeFalse())
+			Expect(isImmutablePodTemplateError(errors.NewConflict(schema.GroupResource{Group: "batch", Resource: "jobs"}, "example", fmt.Errorf("conflict")))).To(BeFalse())
+		})
+	})
+
+	Context("setMetadataConfigHash", func() {
+		var job *batchv1.Job
+
+		BeforeEach(func() {
+			job = utils.ExampleJob.DeepCopy()
+		})
+
+		It("sets the hash annotation on the workload's metadata", func() {
+			Expect(hasMetadataConfigHash(job, ConfigHashAnnotation)).To(BeFalse())
+			setMetadataConfigHash(job, ConfigHashAnnotation, "1234")
+
+			Expect(hasMetadataConfigHash(job, ConfigHashAnnotation)).To(BeTrue())
+			Expect(job.GetAnnotations()).To(HaveKeyWithValue(ConfigHashAnnotation, "1234"))
+			Expect(job.Spec.Template.GetAnnotations()).NotTo(HaveKey(ConfigHashAnnotation))
+		})
+	})
+
+	Context("handleImmutablePodTemplate", func() {
+		var c *recordingClient
+		var job *batchv1.Job
+
+		BeforeEach(func() {
+			c = &recordingClient{}
+			h := NewHandler(c, record.NewFakeRecorder(10), Options{HashHistoryLimit: 3, TrackChildren: true})
+			job = utils.ExampleJob.DeepCopy()
+			job.SetAnnotations(map[string]string{ForceSyncAnnotation: "nonce"})
+
+			updateErr := errors.NewInvalid(jobKind, job.GetName(), field.ErrorList{
+				field.Invalid(field.NewPath("spec", "template"), "", "field is immutable"),
+			})
+			_, err := h.handleImmutablePodTemplate(job, "1234", []Object{utils.ExampleConfigMap1.DeepCopy()}, true, updateErr)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(c.updated).To(HaveLen(1))
+			job = c.updated[0].(*batchv1.Job)
+		})
+
+		It("records the hash on the metadata", func() {
+			Expect(job.GetAnnotations()).To(HaveKeyWithValue(ConfigHashAnnotation, "1234"))
+		})
+
+		It("records the state recorded with the hash on the PodTemplate", func() {
+			Expect(job.GetAnnotations()).To(HaveKeyWithValue(HashHistoryAnnotation, "1234"))
+			Expect(job.GetAnnotations()).To(HaveKeyWithValue(TrackedChildrenAnnotation, "ConfigMap/example1"))
+			Expect(job.GetAnnotations()).To(HaveKeyWithValue(ForceSyncedAnnotation, "nonce"))
+			Expect(job.GetFinalizers()).To(ContainElement(FinalizerString))
+		})
+	})
+})
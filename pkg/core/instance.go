@@ -0,0 +1,65 @@
+/*
+Copyright 2018 Pusher Ltd.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package core
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// isOwnedByOtherInstance returns true if the workload has been claimed by a
+// Wave instance other than the instance with the given ID, or is being handed
+// off to another instance
+func isOwnedByOtherInstance(obj metav1.Object, instanceID string) bool {
+	if target, ok := obj.GetAnnotations()[HandoffAnnotation]; ok {
+		return target != instanceID
+	}
+	owner, ok := obj.GetAnnotations()[InstanceAnnotation]
+	return ok && owner != instanceID
+}
+
+// setInstanceAnnotation claims the workload for the Wave instance with the
+// given ID, completing any handoff to the instance.
+// Workloads are not claimed by instances without an ID, so a workload handed
+// off to such an instance is left unclaimed
+func setInstanceAnnotation(obj metav1.Object, instanceID string) {
+	annotations := obj.GetAnnotations()
+	if _, ok := annotations[HandoffAnnotation]; ok {
+		delete(annotations, HandoffAnnotation)
+		delete(annotations, InstanceAnnotation)
+		obj.SetAnnotations(annotations)
+	}
+
+	if instanceID == "" {
+		return
+	}
+
+	if annotations == nil {
+		annotations = make(map[string]string)
+	}
+	annotations[InstanceAnnotation] = instanceID
+	obj.SetAnnotations(annotations)
+}
+
+// saltConfigHash combines the configuration hash with the given salt, using
+// the HashAlgorithm that calculated the hash.
+// The hash is returned unchanged if the salt is empty
+func saltConfigHash(algorithm HashAlgorithm, hash, salt string) string {
+	if salt == "" {
+		return hash
+	}
+	return algorithm.sum([]byte(salt + hash))
+}
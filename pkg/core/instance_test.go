@@ -0,0 +1,231 @@
+/*
+Copyright 2018 Pusher Ltd.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package core
+
+import (
+	"sync"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/pusher/wave/test/utils"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"sigs.k8s.io/controller-runtime/pkg/manager"
+)
+
+var _ = Describe("Wave instance Suite", func() {
+	Context("With two Wave instances", func() {
+		var m utils.Matcher
+		var instanceA *Handler
+		var instanceB *Handler
+		var deployment *appsv1.Deployment
+		var mgrStopped *sync.WaitGroup
+		var stopMgr chan struct{}
+		var hashA string
+
+		const timeout = time.Second * 5
+		const consistentlyTimeout = time.Second
+
+		// handle reconciles the Deployment with the given instance and fetches
+		// the result
+		var handle = func(h *Handler) {
+			m.Get(deployment, timeout).Should(Succeed())
+			_, err := h.HandleDeployment(deployment)
+			Expect(err).NotTo(HaveOccurred())
+			m.Get(deployment, timeout).Should(Succeed())
+		}
+
+		BeforeEach(func() {
+			mgr, err := manager.New(cfg, manager.Options{})
+			Expect(err).NotTo(HaveOccurred())
+			c := mgr.GetClient()
+			m = utils.Matcher{Client: c}
+
+			instanceA = NewHandler(c, mgr.GetRecorder("wave"), Options{InstanceID: "a", HashSalt: "a"})
+			instanceB = NewHandler(c, mgr.GetRecorder("wave"), Options{InstanceID: "b", HashSalt: "b"})
+
+			stopMgr, mgrStopped = StartTestManager(mgr)
+
+			for _, obj := range []Object{
+				utils.ExampleConfigMap1.DeepCopy(),
+				utils.ExampleConfigMap2.DeepCopy(),
+				utils.ExampleSecret1.DeepCopy(),
+				utils.ExampleSecret2.DeepCopy(),
+			} {
+				m.Create(obj).Should(Succeed())
+				m.Get(obj, timeout).Should(Succeed())
+			}
+
+			deployment = utils.ExampleDeployment.DeepCopy()
+			deployment.SetAnnotations(map[string]string{RequiredAnnotation: "true"})
+			m.Create(deployment).Should(Succeed())
+
+			// Instance A is the first to process the Deployment
+			handle(instanceA)
+			m.Eventually(deployment, timeout).Should(utils.WithPodTemplateAnnotations(HaveKey(ConfigHashAnnotation)))
+			hashA = deployment.Spec.Template.GetAnnotations()[ConfigHashAnnotation]
+		})
+
+		AfterEach(func() {
+			// Make sure to delete the finalizer so the Deployment can be deleted
+			m.Get(deployment, timeout).Should(Succeed())
+			deployment.SetFinalizers([]string{})
+			m.Update(deployment).Should(Succeed())
+
+			close(stopMgr)
+			mgrStopped.Wait()
+
+			utils.DeleteAll(cfg, timeout,
+				&appsv1.DeploymentList{},
+				&corev1.ConfigMapList{},
+				&corev1.SecretList{},
+				&corev1.EventList{},
+			)
+		})
+
+		It("Claims the Deployment for the first instance", func() {
+			m.Eventually(deployment, timeout).Should(utils.WithAnnotations(HaveKeyWithValue(InstanceAnnotation, "a")))
+		})
+
+		It("Doesn't update the hash from the other instance", func() {
+			for i := 0; i < 3; i++ {
+				handle(instanceB)
+				handle(instanceA)
+			}
+			m.Consistently(deployment, consistentlyTimeout).Should(utils.WithPodTemplateAnnotations(HaveKeyWithValue(ConfigHashAnnotation, hashA)))
+			m.Consistently(deployment, consistentlyTimeout).Should(utils.WithAnnotations(HaveKeyWithValue(InstanceAnnotation, "a")))
+		})
+
+		Context("And the Deployment is reassigned to the other instance", func() {
+			BeforeEach(func() {
+				deployment.GetAnnotations()[InstanceAnnotation] = "b"
+				m.Update(deployment).Should(Succeed())
+				handle(instanceB)
+			})
+
+			It("Updates the hash from the new instance", func() {
+				m.Eventually(deployment, timeout).ShouldNot(utils.WithPodTemplateAnnotations(HaveKeyWithValue(ConfigHashAnnotation, hashA)))
+			})
+
+			It("Doesn't update the hash from the original instance", func() {
+				hashB := deployment.Spec.Template.GetAnnotations()[ConfigHashAnnotation]
+				handle(instanceA)
+				m.Consistently(deployment, consistentlyTimeout).Should(utils.WithPodTemplateAnnotations(HaveKeyWithValue(ConfigHashAnnotation, hashB)))
+			})
+		})
+
+		Context("And the Deployment is handed off to the other instance", func() {
+			BeforeEach(func() {
+				deployment.GetAnnotations()[HandoffAnnotation] = "b"
+				m.Update(deployment).Should(Succeed())
+			})
+
+			It("Isn't updated by the original instance", func() {
+				handle(instanceA)
+				Expect(deployment.GetAnnotations()).To(HaveKeyWithValue(HandoffAnnotation, "b"))
+				Expect(deployment.GetAnnotations()).To(HaveKeyWithValue(InstanceAnnotation, "a"))
+				Expect(deployment.Spec.Template.GetAnnotations()).To(HaveKeyWithValue(ConfigHashAnnotation, hashA))
+			})
+
+			It("Transfers ownership to the new instance", func() {
+				handle(instanceB)
+				Expect(deployment.GetAnnotations()).To(HaveKeyWithValue(InstanceAnnotation, "b"))
+				Expect(deployment.GetAnnotations()).NotTo(HaveKey(HandoffAnnotation))
+			})
+
+			It("Applies the new instance's hash once", func() {
+				handle(instanceB)
+				hashB := deployment.Spec.Template.GetAnnotations()[ConfigHashAnnotation]
+				Expect(hashB).NotTo(Equal(hashA))
+				generation := deployment.GetGeneration()
+
+				for i := 0; i < 3; i++ {
+					handle(instanceB)
+					handle(instanceA)
+				}
+				Expect(deployment.Spec.Template.GetAnnotations()).To(HaveKeyWithValue(ConfigHashAnnotation, hashB))
+				Expect(deployment.GetGeneration()).To(Equal(generation))
+			})
+		})
+	})
+
+	Context("isOwnedByOtherInstance", func() {
+		var deployment *appsv1.Deployment
+
+		BeforeEach(func() {
+			deployment = utils.ExampleDeployment.DeepCopy()
+		})
+
+		It("returns false when the workload hasn't been claimed", func() {
+			Expect(isOwnedByOtherInstance(deployment, "a")).To(BeFalse())
+			Expect(isOwnedByOtherInstance(deployment, "")).To(BeFalse())
+		})
+
+		It("returns false when the workload is claimed by the instance", func() {
+			setInstanceAnnotation(deployment, "a")
+			Expect(isOwnedByOtherInstance(deployment, "a")).To(BeFalse())
+		})
+
+		It("returns true when the workload is claimed by another instance", func() {
+			setInstanceAnnotation(deployment, "a")
+			Expect(isOwnedByOtherInstance(deployment, "b")).To(BeTrue())
+			Expect(isOwnedByOtherInstance(deployment, "")).To(BeTrue())
+		})
+
+		It("doesn't claim the workload for an instance without an ID", func() {
+			setInstanceAnnotation(deployment, "")
+			Expect(deployment.GetAnnotations()).NotTo(HaveKey(InstanceAnnotation))
+		})
+
+		It("returns true when the workload is handed off to another instance", func() {
+			setInstanceAnnotation(deployment, "a")
+			deployment.GetAnnotations()[HandoffAnnotation] = "b"
+			Expect(isOwnedByOtherInstance(deployment, "a")).To(BeTrue())
+			Expect(isOwnedByOtherInstance(deployment, "")).To(BeTrue())
+			Expect(isOwnedByOtherInstance(deployment, "b")).To(BeFalse())
+		})
+
+		It("completes a handoff when claiming the workload", func() {
+			setInstanceAnnotation(deployment, "a")
+			deployment.GetAnnotations()[HandoffAnnotation] = "b"
+			setInstanceAnnotation(deployment, "b")
+			Expect(deployment.GetAnnotations()).To(HaveKeyWithValue(InstanceAnnotation, "b"))
+			Expect(deployment.GetAnnotations()).NotTo(HaveKey(HandoffAnnotation))
+		})
+
+		It("leaves a workload handed off to an instance without an ID unclaimed", func() {
+			setInstanceAnnotation(deployment, "a")
+			deployment.GetAnnotations()[HandoffAnnotation] = ""
+			setInstanceAnnotation(deployment, "")
+			Expect(deployment.GetAnnotations()).NotTo(HaveKey(InstanceAnnotation))
+			Expect(deployment.GetAnnotations()).NotTo(HaveKey(HandoffAnnotation))
+			Expect(isOwnedByOtherInstance(deployment, "")).To(BeFalse())
+		})
+	})
+
+	Context("saltConfigHash", func() {
+		It("returns the hash unchanged without a salt", func() {
+			Expect(saltConfigHash(HashSHA256, "1234", "")).To(Equal("1234"))
+		})
+
+		It("returns a different hash for different salts", func() {
+			Expect(saltConfigHash(HashSHA256, "1234", "a")).NotTo(Equal("1234"))
+			Expect(saltConfigHash(HashSHA256, "1234", "a")).NotTo(Equal(saltConfigHash(HashSHA256, "1234", "b")))
+		})
+	})
+})
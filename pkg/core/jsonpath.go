@@ -0,0 +1,72 @@
+/*
+Copyright 2018 Pusher Ltd.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package core
+
+import (
+	"fmt"
+
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/util/jsonpath"
+)
+
+// ValidateJSONPath returns an error if the expression is not a valid JSONPath
+// template, eg. "{.metadata.annotations.example\.com/config}"
+func ValidateJSONPath(path string) error {
+	return jsonpath.New(path).Parse(path)
+}
+
+// getChildKeysByJSONPath evaluates each JSONPath expression against the
+// workload.
+// Each string the expressions yield is parsed as a comma separated list of
+// child names, as in the extra children annotations
+func getChildKeysByJSONPath(obj Object, paths []string) ([]types.NamespacedName, error) {
+	keys := []types.NamespacedName{}
+	if len(paths) == 0 {
+		return keys, nil
+	}
+
+	// Evaluate the expressions against the JSON representation of the workload
+	// so that fields are named as in its manifest
+	data, err := runtime.DefaultUnstructuredConverter.ToUnstructured(obj)
+	if err != nil {
+		return nil, fmt.Errorf("error converting %s to unstructured: %v", kindOf(obj), err)
+	}
+
+	for _, path := range paths {
+		j := jsonpath.New(path).AllowMissingKeys(true)
+		err := j.Parse(path)
+		if err != nil {
+			return nil, fmt.Errorf("error parsing JSONPath %q: %v", path, err)
+		}
+
+		results, err := j.FindResults(data)
+		if err != nil {
+			return nil, fmt.Errorf("error evaluating JSONPath %q: %v", path, err)
+		}
+		for _, values := range results {
+			for _, value := range values {
+				name, ok := value.Interface().(string)
+				if !ok {
+					return nil, fmt.Errorf("JSONPath %q yielded %T, expected a string", path, value.Interface())
+				}
+				keys = append(keys, parseChildKeys(obj.GetNamespace(), name)...)
+			}
+		}
+	}
+	return keys, nil
+}
@@ -0,0 +1,175 @@
+/*
+Copyright 2018 Pusher Ltd.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package core
+
+import (
+	"sync"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/pusher/wave/test/utils"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/manager"
+)
+
+var _ = Describe("Wave JSONPath Suite", func() {
+	const annotationPath = `{.metadata.annotations.example\.com/config}`
+
+	var deployment *appsv1.Deployment
+
+	BeforeEach(func() {
+		deployment = utils.ExampleDeployment.DeepCopy()
+		deployment.SetAnnotations(map[string]string{
+			"example.com/config": "example3, other/example4",
+		})
+	})
+
+	Context("ValidateJSONPath", func() {
+		It("accepts a valid JSONPath", func() {
+			Expect(ValidateJSONPath(annotationPath)).To(Succeed())
+		})
+
+		It("rejects an invalid JSONPath", func() {
+			Expect(ValidateJSONPath("{.metadata.annotations")).NotTo(Succeed())
+		})
+	})
+
+	Context("getChildKeysByJSONPath", func() {
+		It("returns the children named by the JSONPath", func() {
+			keys, err := getChildKeysByJSONPath(deployment, []string{annotationPath})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(keys).To(ConsistOf(
+				types.NamespacedName{Namespace: deployment.GetNamespace(), Name: "example3"},
+				types.NamespacedName{Namespace: "other", Name: "example4"},
+			))
+		})
+
+		It("returns no children if the JSONPath doesn't match", func() {
+			keys, err := getChildKeysByJSONPath(deployment, []string{`{.metadata.annotations.missing}`})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(keys).To(BeEmpty())
+		})
+
+		It("returns each string yielded by the JSONPath", func() {
+			keys, err := getChildKeysByJSONPath(deployment, []string{`{.spec.template.spec.containers[*].name}`})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(keys).To(ConsistOf(
+				types.NamespacedName{Namespace: deployment.GetNamespace(), Name: "container1"},
+				types.NamespacedName{Namespace: deployment.GetNamespace(), Name: "container2"},
+			))
+		})
+
+		It("returns an error if the JSONPath yields something other than a string", func() {
+			_, err := getChildKeysByJSONPath(deployment, []string{`{.spec.template.spec.containers[0]}`})
+			Expect(err).To(HaveOccurred())
+		})
+	})
+
+	Context("When the Handler is configured with a JSONPath", func() {
+		var c client.Client
+		var h *Handler
+		var m utils.Matcher
+		var cm3 *corev1.ConfigMap
+		var mgrStopped *sync.WaitGroup
+		var stopMgr chan struct{}
+
+		const timeout = time.Second * 5
+
+		BeforeEach(func() {
+			mgr, err := manager.New(cfg, manager.Options{})
+			Expect(err).NotTo(HaveOccurred())
+			c = mgr.GetClient()
+			h = NewHandler(c, mgr.GetRecorder("wave"), Options{ExtraConfigMapPaths: []string{annotationPath}})
+			m = utils.Matcher{Client: c}
+
+			stopMgr, mgrStopped = StartTestManager(mgr)
+
+			cm3 = utils.ExampleConfigMap1.DeepCopy()
+			cm3.SetName("example3")
+			for _, obj := range []Object{
+				utils.ExampleConfigMap1.DeepCopy(),
+				utils.ExampleConfigMap2.DeepCopy(),
+				utils.ExampleSecret1.DeepCopy(),
+				utils.ExampleSecret2.DeepCopy(),
+				cm3,
+			} {
+				m.Create(obj).Should(Succeed())
+				m.Get(obj, timeout).Should(Succeed())
+			}
+
+			deployment.SetAnnotations(map[string]string{
+				RequiredAnnotation:   "true",
+				"example.com/config": cm3.GetName(),
+			})
+			m.Create(deployment).Should(Succeed())
+			m.Get(deployment, timeout).Should(Succeed())
+
+			_, err = h.HandleDeployment(deployment)
+			Expect(err).NotTo(HaveOccurred())
+			m.Get(deployment, timeout).Should(Succeed())
+		})
+
+		AfterEach(func() {
+			// Make sure to delete the finalizer so the Deployment can be deleted
+			m.Get(deployment, timeout).Should(Succeed())
+			deployment.SetFinalizers([]string{})
+			m.Update(deployment).Should(Succeed())
+
+			close(stopMgr)
+			mgrStopped.Wait()
+
+			utils.DeleteAll(cfg, timeout,
+				&appsv1.DeploymentList{},
+				&corev1.ConfigMapList{},
+				&corev1.SecretList{},
+				&corev1.EventList{},
+			)
+		})
+
+		It("Adds an OwnerReference to the ConfigMap named by the JSONPath", func() {
+			m.Eventually(cm3, timeout).Should(utils.WithOwnerReferences(ContainElement(utils.GetOwnerRef(deployment))))
+		})
+
+		It("Includes the ConfigMap named by the JSONPath in the hash", func() {
+			// Differs from the hash of the example children alone
+			m.Eventually(deployment, timeout).Should(utils.WithPodTemplateAnnotations(SatisfyAll(
+				HaveKey(ConfigHashAnnotation),
+				Not(HaveKeyWithValue(ConfigHashAnnotation, exampleHash)),
+			)))
+		})
+
+		It("Updates the hash when the ConfigMap named by the JSONPath is updated", func() {
+			originalHash := deployment.Spec.Template.GetAnnotations()[ConfigHashAnnotation]
+			Expect(originalHash).NotTo(BeEmpty())
+
+			m.Get(cm3, timeout).Should(Succeed())
+			cm3.Data["key1"] = "modified"
+			m.Update(cm3).Should(Succeed())
+			m.Eventually(cm3, timeout).Should(WithTransform(func(obj *corev1.ConfigMap) string {
+				return obj.Data["key1"]
+			}, Equal("modified")))
+
+			_, err := h.HandleDeployment(deployment)
+			Expect(err).NotTo(HaveOccurred())
+			m.Eventually(deployment, timeout).ShouldNot(utils.WithPodTemplateAnnotations(HaveKeyWithValue(ConfigHashAnnotation, originalHash)))
+		})
+	})
+})
@@ -0,0 +1,88 @@
+/*
+Copyright 2018 Pusher Ltd.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package core
+
+import (
+	"fmt"
+	"strings"
+)
+
+// AnnotationKeys are the keys of the annotations and the finalizer Wave uses
+// on workloads of a single kind.
+// Empty keys fall back to those in the Options
+type AnnotationKeys struct {
+	// RequiredAnnotation overrides Options.RequiredAnnotation
+	RequiredAnnotation string
+
+	// ConfigHashAnnotation overrides Options.ConfigHashAnnotation
+	ConfigHashAnnotation string
+
+	// Finalizer overrides Options.Finalizer
+	Finalizer string
+
+	// FreezeAnnotation overrides Options.FreezeAnnotation
+	FreezeAnnotation string
+}
+
+// ForKind returns the Options used to manage workloads of the given kind, ie.
+// with the KindAnnotationKeys configured for the kind in place of the
+// RequiredAnnotation, ConfigHashAnnotation, Finalizer and FreezeAnnotation
+func (o Options) ForKind(kind string) Options {
+	keys, ok := o.KindAnnotationKeys[kind]
+	if !ok {
+		return o
+	}
+
+	if keys.RequiredAnnotation != "" {
+		o.RequiredAnnotation = keys.RequiredAnnotation
+	}
+	if keys.ConfigHashAnnotation != "" {
+		o.ConfigHashAnnotation = keys.ConfigHashAnnotation
+	}
+	if keys.Finalizer != "" {
+		o.Finalizer = keys.Finalizer
+	}
+	if keys.FreezeAnnotation != "" {
+		o.FreezeAnnotation = keys.FreezeAnnotation
+	}
+	return o
+}
+
+// workloadKinds are the kinds of workload KindAnnotationKeys may be
+// configured for
+var workloadKinds = map[string]struct{}{
+	"Deployment":  {},
+	"DaemonSet":   {},
+	"StatefulSet": {},
+	"ReplicaSet":  {},
+	"Job":         {},
+	"Pod":         {},
+	"Rollout":     {},
+}
+
+// ParseKindKey parses a key configured for a kind of workload, as
+// Kind=key, eg. "StatefulSet=example.com/update-on-config-change"
+func ParseKindKey(arg string) (string, string, error) {
+	parts := strings.SplitN(arg, "=", 2)
+	if len(parts) != 2 || parts[1] == "" {
+		return "", "", fmt.Errorf("invalid key %q, expected Kind=key", arg)
+	}
+	if _, ok := workloadKinds[parts[0]]; !ok {
+		return "", "", fmt.Errorf("invalid key %q, unknown workload kind %q", arg, parts[0])
+	}
+	return parts[0], parts[1], nil
+}
@@ -0,0 +1,225 @@
+/*
+Copyright 2018 Pusher Ltd.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package core
+
+import (
+	"sync"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/pusher/wave/test/utils"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"sigs.k8s.io/controller-runtime/pkg/manager"
+)
+
+var _ = Describe("Wave kind options Suite", func() {
+	const deploymentAnnotation = "deployments.example.com/update-on-config-change"
+	const statefulSetAnnotation = "statefulsets.example.com/update-on-config-change"
+	const statefulSetHashAnnotation = "statefulsets.example.com/config-hash"
+	const statefulSetFinalizer = "statefulsets.example.com/finalizer"
+	const statefulSetFreezeAnnotation = "statefulsets.example.com/freeze"
+
+	var opts = Options{
+		RequiredAnnotation: "example.com/update-on-config-change",
+		KindAnnotationKeys: map[string]AnnotationKeys{
+			"Deployment": {RequiredAnnotation: deploymentAnnotation},
+			"StatefulSet": {
+				RequiredAnnotation:   statefulSetAnnotation,
+				ConfigHashAnnotation: statefulSetHashAnnotation,
+				Finalizer:            statefulSetFinalizer,
+				FreezeAnnotation:     statefulSetFreezeAnnotation,
+			},
+		},
+	}
+
+	Context("ForKind", func() {
+		It("overrides the keys configured for the kind", func() {
+			kindOpts := opts.ForKind("StatefulSet")
+			Expect(kindOpts.RequiredAnnotation).To(Equal(statefulSetAnnotation))
+			Expect(kindOpts.ConfigHashAnnotation).To(Equal(statefulSetHashAnnotation))
+			Expect(kindOpts.Finalizer).To(Equal(statefulSetFinalizer))
+			Expect(kindOpts.FreezeAnnotation).To(Equal(statefulSetFreezeAnnotation))
+		})
+
+		It("keeps the keys that aren't configured for the kind", func() {
+			kindOpts := opts.ForKind("Deployment")
+			Expect(kindOpts.RequiredAnnotation).To(Equal(deploymentAnnotation))
+			Expect(kindOpts.ConfigHashAnnotation).To(BeEmpty())
+			Expect(kindOpts.Finalizer).To(BeEmpty())
+		})
+
+		It("keeps every key for kinds without any configured", func() {
+			Expect(opts.ForKind("DaemonSet").RequiredAnnotation).To(Equal(opts.RequiredAnnotation))
+		})
+	})
+
+	Context("ParseKindKey", func() {
+		It("parses a key for a kind of workload", func() {
+			kind, key, err := ParseKindKey("StatefulSet=" + statefulSetAnnotation)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(kind).To(Equal("StatefulSet"))
+			Expect(key).To(Equal(statefulSetAnnotation))
+		})
+
+		It("rejects a key without a kind", func() {
+			_, _, err := ParseKindKey(statefulSetAnnotation)
+			Expect(err).To(HaveOccurred())
+		})
+
+		It("rejects an empty key", func() {
+			_, _, err := ParseKindKey("StatefulSet=")
+			Expect(err).To(HaveOccurred())
+		})
+
+		It("rejects an unknown kind", func() {
+			_, _, err := ParseKindKey("ReplicaSet=" + statefulSetAnnotation)
+			Expect(err).To(HaveOccurred())
+		})
+	})
+
+	Context("When each kind is handled with its own keys", func() {
+		var m utils.Matcher
+		var deploymentHandler *Handler
+		var statefulSetHandler *Handler
+		var deployment *appsv1.Deployment
+		var statefulSet *appsv1.StatefulSet
+		var mgrStopped *sync.WaitGroup
+		var stopMgr chan struct{}
+
+		const timeout = time.Second * 5
+
+		// handleBoth annotates the Deployment and the StatefulSet with the
+		// given annotation, reconciles both and gets their latest versions
+		var handleBoth = func(annotation string) {
+			deployment.SetAnnotations(map[string]string{annotation: "true"})
+			m.Update(deployment).Should(Succeed())
+			statefulSet.SetAnnotations(map[string]string{annotation: "true"})
+			m.Update(statefulSet).Should(Succeed())
+
+			m.Get(deployment, timeout).Should(Succeed())
+			_, err := deploymentHandler.HandleDeployment(deployment)
+			Expect(err).NotTo(HaveOccurred())
+			m.Get(statefulSet, timeout).Should(Succeed())
+			_, err = statefulSetHandler.HandleStatefulSet(statefulSet)
+			Expect(err).NotTo(HaveOccurred())
+
+			m.Get(deployment, timeout).Should(Succeed())
+			m.Get(statefulSet, timeout).Should(Succeed())
+		}
+
+		BeforeEach(func() {
+			mgr, err := manager.New(cfg, manager.Options{})
+			Expect(err).NotTo(HaveOccurred())
+			c := mgr.GetClient()
+			m = utils.Matcher{Client: c}
+
+			index := NewChildIndex()
+			deploymentOpts := opts.ForKind("Deployment")
+			deploymentOpts.ChildIndex = index
+			deploymentHandler = NewHandler(c, mgr.GetRecorder("wave"), deploymentOpts)
+			statefulSetOpts := opts.ForKind("StatefulSet")
+			statefulSetOpts.ChildIndex = index
+			statefulSetHandler = NewHandler(c, mgr.GetRecorder("wave"), statefulSetOpts)
+
+			stopMgr, mgrStopped = StartTestManager(mgr)
+
+			for _, obj := range []Object{
+				utils.ExampleConfigMap1.DeepCopy(),
+				utils.ExampleConfigMap2.DeepCopy(),
+				utils.ExampleSecret1.DeepCopy(),
+				utils.ExampleSecret2.DeepCopy(),
+			} {
+				m.Create(obj).Should(Succeed())
+				m.Get(obj, timeout).Should(Succeed())
+			}
+
+			deployment = utils.ExampleDeployment.DeepCopy()
+			m.Create(deployment).Should(Succeed())
+			m.Get(deployment, timeout).Should(Succeed())
+			statefulSet = utils.ExampleStatefulSet.DeepCopy()
+			m.Create(statefulSet).Should(Succeed())
+			m.Get(statefulSet, timeout).Should(Succeed())
+		})
+
+		AfterEach(func() {
+			// Make sure to delete the finalizers so the workloads can be deleted
+			m.Get(deployment, timeout).Should(Succeed())
+			deployment.SetFinalizers([]string{})
+			m.Update(deployment).Should(Succeed())
+			m.Get(statefulSet, timeout).Should(Succeed())
+			statefulSet.SetFinalizers([]string{})
+			m.Update(statefulSet).Should(Succeed())
+
+			close(stopMgr)
+			mgrStopped.Wait()
+
+			utils.DeleteAll(cfg, timeout,
+				&appsv1.DeploymentList{},
+				&appsv1.StatefulSetList{},
+				&corev1.ConfigMapList{},
+				&corev1.SecretList{},
+				&corev1.EventList{},
+			)
+		})
+
+		Context("And both are annotated with the Deployment's key", func() {
+			BeforeEach(func() {
+				handleBoth(deploymentAnnotation)
+			})
+
+			It("Manages the Deployment", func() {
+				Expect(deployment.Spec.Template.GetAnnotations()).To(HaveKey(ConfigHashAnnotation))
+				Expect(deployment.GetFinalizers()).To(ContainElement(FinalizerString))
+			})
+
+			It("Doesn't manage the StatefulSet", func() {
+				Expect(statefulSet.Spec.Template.GetAnnotations()).NotTo(HaveKey(statefulSetHashAnnotation))
+				Expect(statefulSet.GetFinalizers()).To(BeEmpty())
+			})
+		})
+
+		Context("And both are annotated with the StatefulSet's key", func() {
+			BeforeEach(func() {
+				handleBoth(statefulSetAnnotation)
+			})
+
+			It("Manages the StatefulSet with its own keys", func() {
+				Expect(statefulSet.Spec.Template.GetAnnotations()).To(HaveKey(statefulSetHashAnnotation))
+				Expect(statefulSet.Spec.Template.GetAnnotations()).NotTo(HaveKey(ConfigHashAnnotation))
+				Expect(statefulSet.GetFinalizers()).To(ConsistOf(statefulSetFinalizer))
+			})
+
+			It("Doesn't manage the Deployment", func() {
+				Expect(deployment.Spec.Template.GetAnnotations()).NotTo(HaveKey(ConfigHashAnnotation))
+				Expect(deployment.GetFinalizers()).To(BeEmpty())
+			})
+		})
+
+		Context("And both are annotated with the global key", func() {
+			BeforeEach(func() {
+				handleBoth(opts.RequiredAnnotation)
+			})
+
+			It("Manages neither", func() {
+				Expect(deployment.GetFinalizers()).To(BeEmpty())
+				Expect(statefulSet.GetFinalizers()).To(BeEmpty())
+			})
+		})
+	})
+})
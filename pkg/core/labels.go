@@ -0,0 +1,47 @@
+/*
+Copyright 2018 Pusher Ltd.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package core
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// propagateLabels copies the values of the PropagatedLabels from the workload
+// onto a companion object created by Wave.
+// Propagated labels that the workload doesn't have are removed from the
+// companion, other labels on the companion are left in place
+func (h *Handler) propagateLabels(workload, companion metav1.Object) {
+	if len(h.options.PropagatedLabels) == 0 {
+		return
+	}
+
+	labels := companion.GetLabels()
+	if labels == nil {
+		labels = make(map[string]string)
+	}
+	for _, key := range h.options.PropagatedLabels {
+		if value, ok := workload.GetLabels()[key]; ok {
+			labels[key] = value
+		} else {
+			delete(labels, key)
+		}
+	}
+	if len(labels) == 0 {
+		labels = nil
+	}
+	companion.SetLabels(labels)
+}
@@ -0,0 +1,285 @@
+/*
+Copyright 2018 Pusher Ltd.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package core
+
+import (
+	"sort"
+	"sync"
+
+	"k8s.io/apimachinery/pkg/types"
+	logf "sigs.k8s.io/controller-runtime/pkg/runtime/log"
+)
+
+// maxMerkleTreeEntries bounds the size of the merkleTreeCache.
+// Entries for deleted workloads are never explicitly evicted, so the cache is
+// reset once it grows beyond this size
+const maxMerkleTreeEntries = 10000
+
+// merkleLeaf is a leaf of a merkleTree, holding the hash of a single child
+type merkleLeaf struct {
+	// key identifies the child by kind, namespace and name
+	key string
+
+	// version identifies the content of the child by UID and
+	// resourceVersion, it is empty if the child wasn't read from the API
+	// server
+	version string
+
+	// hash is the hash of the child's content
+	hash string
+}
+
+// merkleTree is a Merkle tree with a leaf for each child of a workload.
+// Leaves are ordered by their hash, as the flat hash orders the content of the
+// children, so that the root doesn't depend on the names of the children.
+// While the leaves keep their order, a child changing only changes the nodes
+// on the path from its leaf to the root
+type merkleTree struct {
+	leaves []merkleLeaf
+
+	// levels holds the hashes of the nodes of each level of the tree, from the
+	// leaves up to the root
+	levels [][]string
+}
+
+// newMerkleTree constructs a merkleTree from scratch, the leaves must be
+// sorted with sortMerkleLeaves
+func newMerkleTree(algorithm HashAlgorithm, leaves []merkleLeaf) *merkleTree {
+	hashes := make([]string, len(leaves))
+	for i, leaf := range leaves {
+		hashes[i] = leaf.hash
+	}
+
+	levels := [][]string{hashes}
+	for len(hashes) > 1 {
+		parents := make([]string, (len(hashes)+1)/2)
+		for i := range parents {
+			parents[i] = merkleNodeHash(algorithm, hashes, i)
+		}
+		levels = append(levels, parents)
+		hashes = parents
+	}
+	return &merkleTree{leaves: leaves, levels: levels}
+}
+
+// update returns a merkleTree with the given leaves, which must be sorted
+// with sortMerkleLeaves, along with the keys of the leaves that were added,
+// removed or changed.
+// If the tree has the same keys in the same order, only the nodes above
+// changed leaves are recomputed, otherwise the tree is constructed from
+// scratch
+func (t *merkleTree) update(algorithm HashAlgorithm, leaves []merkleLeaf) (*merkleTree, []string) {
+	if t == nil || !sameKeys(t.leaves, leaves) {
+		return newMerkleTree(algorithm, leaves), changedKeys(t, leaves)
+	}
+
+	levels := make([][]string, len(t.levels))
+	for i, level := range t.levels {
+		levels[i] = append([]string{}, level...)
+	}
+
+	changed := []string{}
+	for i, leaf := range leaves {
+		if leaf.hash == levels[0][i] {
+			continue
+		}
+		changed = append(changed, leaf.key)
+		levels[0][i] = leaf.hash
+		for level, index := 1, i/2; level < len(levels); level, index = level+1, index/2 {
+			levels[level][index] = merkleNodeHash(algorithm, levels[level-1], index)
+		}
+	}
+	return &merkleTree{leaves: leaves, levels: levels}, changed
+}
+
+// root returns the hash of the root of the tree.
+// A tree without any leaves hashes as if it had a single empty node
+func (t *merkleTree) root(algorithm HashAlgorithm) string {
+	top := t.levels[len(t.levels)-1]
+	if len(top) == 0 {
+		return algorithm.sum([]byte{merkleNodePrefix})
+	}
+	return top[0]
+}
+
+// Leaves and nodes are hashed with distinct prefixes, so that the content of a
+// child can never be mistaken for a pair of nodes
+const (
+	merkleLeafPrefix byte = 0
+	merkleNodePrefix byte = 1
+)
+
+// merkleLeafHash hashes the content of the child along with its kind
+func merkleLeafHash(algorithm HashAlgorithm, obj Object, content string) string {
+	data := append([]byte{merkleLeafPrefix}, kindOf(obj)...)
+	data = append(append(data, merkleLeafPrefix), content...)
+	return algorithm.sum(data)
+}
+
+// merkleNodeHash hashes the pair of nodes of the level below the parent at the
+// index.
+// A node without a sibling is hashed alone
+func merkleNodeHash(algorithm HashAlgorithm, below []string, index int) string {
+	data := append([]byte{merkleNodePrefix}, below[2*index]...)
+	if 2*index+1 < len(below) {
+		data = append(data, below[2*index+1]...)
+	}
+	return algorithm.sum(data)
+}
+
+// sortMerkleLeaves sorts the leaves by their hash, and leaves with the same
+// hash by their key so that the order is deterministic
+func sortMerkleLeaves(leaves []merkleLeaf) {
+	sort.Slice(leaves, func(i, j int) bool {
+		if leaves[i].hash != leaves[j].hash {
+			return leaves[i].hash < leaves[j].hash
+		}
+		return leaves[i].key < leaves[j].key
+	})
+}
+
+// sameKeys checks whether the leaves have the same keys in the same order
+func sameKeys(a, b []merkleLeaf) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i].key != b[i].key {
+			return false
+		}
+	}
+	return true
+}
+
+// changedKeys returns the keys of the leaves that are new to the tree or whose
+// hash changed, followed by the keys of the leaves of the tree that were
+// removed
+func changedKeys(t *merkleTree, leaves []merkleLeaf) []string {
+	previous := make(map[string]string)
+	if t != nil {
+		for _, leaf := range t.leaves {
+			previous[leaf.key] = leaf.hash
+		}
+	}
+
+	changed := []string{}
+	for _, leaf := range leaves {
+		if hash, ok := previous[leaf.key]; !ok || hash != leaf.hash {
+			changed = append(changed, leaf.key)
+		}
+		delete(previous, leaf.key)
+	}
+	removed := []string{}
+	for key := range previous {
+		removed = append(removed, key)
+	}
+	sort.Strings(removed)
+	return append(changed, removed...)
+}
+
+// merkleTreeCache holds the merkleTree last calculated for each workload by
+// UID, so that only the children that changed are hashed again
+type merkleTreeCache struct {
+	lock  sync.Mutex
+	trees map[types.UID]*merkleTree
+}
+
+// newMerkleTreeCache constructs an empty merkleTreeCache
+func newMerkleTreeCache() *merkleTreeCache {
+	return &merkleTreeCache{trees: make(map[types.UID]*merkleTree)}
+}
+
+// get returns the merkleTree last calculated for the workload, if any
+func (c *merkleTreeCache) get(uid types.UID) *merkleTree {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	return c.trees[uid]
+}
+
+// set records the merkleTree calculated for the workload
+func (c *merkleTreeCache) set(uid types.UID, tree *merkleTree) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	if _, ok := c.trees[uid]; !ok && len(c.trees) >= maxMerkleTreeEntries {
+		c.trees = make(map[types.UID]*merkleTree)
+	}
+	c.trees[uid] = tree
+}
+
+// forget removes the merkleTree recorded for the workload, once it is deleted
+func (c *merkleTreeCache) forget(uid types.UID) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	delete(c.trees, uid)
+}
+
+// merkleRoot returns the root of the merkleTree of the workload's children.
+// Leaves of children with the same UID and resourceVersion as when the tree
+// was last calculated are reused without hashing the children again. The tree
+// is calculated from scratch if contents is nil, eg. when the workload is
+// poked
+func (h *Handler) merkleRoot(instance Object, children []Object, contents *contentCache) (string, error) {
+	log := logf.Log.WithName("wave")
+
+	var previous *merkleTree
+	if contents != nil {
+		previous = h.merkleTrees.get(instance.GetUID())
+	}
+	reusable := make(map[string]merkleLeaf)
+	if previous != nil {
+		for _, leaf := range previous.leaves {
+			if leaf.version != "" {
+				reusable[leaf.key] = leaf
+			}
+		}
+	}
+
+	leaves := []merkleLeaf{}
+	for _, child := range children {
+		leaf := merkleLeaf{key: childHashKey(child)}
+		if isCacheable(child) {
+			leaf.version = string(child.GetUID()) + "/" + child.GetResourceVersion()
+		}
+		if last, ok := reusable[leaf.key]; ok && last.version == leaf.version {
+			leaves = append(leaves, last)
+			continue
+		}
+
+		content, ok := contents.get(child)
+		if !ok {
+			var err error
+			content, err = serializeChild(child, h.options.ChildVersionLabel, h.resourceVersions)
+			if err != nil {
+				return "", err
+			}
+			contents.set(child, content)
+		}
+		leaf.hash = merkleLeafHash(h.options.HashAlgorithm, child, content)
+		leaves = append(leaves, leaf)
+	}
+	sortMerkleLeaves(leaves)
+
+	tree, changed := previous.update(h.options.HashAlgorithm, leaves)
+	if previous != nil && len(changed) > 0 {
+		log.V(1).Info("Children changed", "namespace", instance.GetNamespace(), "name", instance.GetName(), "children", changed)
+	}
+	if instance.GetUID() != "" {
+		h.merkleTrees.set(instance.GetUID(), tree)
+	}
+	return tree.root(h.options.HashAlgorithm), nil
+}
@@ -0,0 +1,216 @@
+/*
+Copyright 2018 Pusher Ltd.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package core
+
+import (
+	"fmt"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/pusher/wave/test/utils"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+var _ = Describe("Wave Merkle hash Suite", func() {
+	var h *Handler
+	var deployment *appsv1.Deployment
+	var children []Object
+
+	// fromScratch calculates the root of the children with a new Handler, so
+	// that no previously calculated tree is reused
+	var fromScratch = func(children []Object) string {
+		root, err := NewHandler(nil, nil, Options{MerkleHash: true}).merkleRoot(deployment, children, nil)
+		Expect(err).NotTo(HaveOccurred())
+		return root
+	}
+
+	// modify changes the data of the child as if it had been updated on the
+	// API server
+	var modify = func(child *corev1.ConfigMap, value string) {
+		child.Data = map[string]string{"key1": value}
+		child.SetResourceVersion(child.GetResourceVersion() + "1")
+	}
+
+	BeforeEach(func() {
+		h = NewHandler(nil, nil, Options{MerkleHash: true})
+		deployment = utils.ExampleDeployment.DeepCopy()
+		deployment.SetUID("deployment-uid")
+
+		children = []Object{}
+		for i := 0; i < 5; i++ {
+			cm := utils.ExampleConfigMap1.DeepCopy()
+			cm.SetName(fmt.Sprintf("example%d", i))
+			cm.SetUID(types.UID(fmt.Sprintf("uid%d", i)))
+			cm.SetResourceVersion("1")
+			children = append(children, cm)
+		}
+		s1 := utils.ExampleSecret1.DeepCopy()
+		s1.SetUID("secret-uid")
+		s1.SetResourceVersion("1")
+		children = append(children, s1)
+	})
+
+	It("calculates a root independent of the order of the children", func() {
+		reversed := []Object{}
+		for i := len(children) - 1; i >= 0; i-- {
+			reversed = append(reversed, children[i])
+		}
+		Expect(fromScratch(reversed)).To(Equal(fromScratch(children)))
+	})
+
+	It("calculates a root independent of the names of the children", func() {
+		modify(children[2].(*corev1.ConfigMap), "distinct")
+		renamed := []Object{}
+		for _, child := range children {
+			renamed = append(renamed, child.DeepCopyObject().(Object))
+		}
+		renamed[2].SetName("renamed-example")
+		Expect(fromScratch(renamed)).To(Equal(fromScratch(children)))
+	})
+
+	It("calculates a different root than the flat hash", func() {
+		flat, err := calculateConfigHash(children)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(fromScratch(children)).NotTo(Equal(flat))
+	})
+
+	It("calculates a root for workloads without children", func() {
+		Expect(fromScratch([]Object{})).To(Equal(HashSHA256.sum([]byte{merkleNodePrefix})))
+	})
+
+	It("records the root as the configuration hash", func() {
+		hash, err := h.configHash(deployment, children, h.contents)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(hash).To(Equal(fromScratch(children)))
+	})
+
+	Context("When a child changes", func() {
+		var original string
+
+		BeforeEach(func() {
+			var err error
+			original, err = h.merkleRoot(deployment, children, h.contents)
+			Expect(err).NotTo(HaveOccurred())
+
+			modify(children[2].(*corev1.ConfigMap), "modified")
+		})
+
+		It("incrementally calculates the same root as from scratch", func() {
+			root, err := h.merkleRoot(deployment, children, h.contents)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(root).NotTo(Equal(original))
+			Expect(root).To(Equal(fromScratch(children)))
+		})
+
+		It("only hashes the changed child again", func() {
+			previous := h.merkleTrees.get(deployment.GetUID())
+			_, err := h.merkleRoot(deployment, children, h.contents)
+			Expect(err).NotTo(HaveOccurred())
+			tree := h.merkleTrees.get(deployment.GetUID())
+
+			Expect(tree.leaves).To(HaveLen(len(previous.leaves)))
+			for _, leaf := range previous.leaves {
+				if leaf.key != childHashKey(children[2]) {
+					Expect(tree.leaves).To(ContainElement(leaf))
+				}
+			}
+		})
+
+		It("only recomputes the path from the leaf to the root while the leaves keep their order", func() {
+			previous := h.merkleTrees.get(deployment.GetUID())
+			leaves := append([]merkleLeaf{}, previous.leaves...)
+			leaves[2].hash = HashSHA256.sum([]byte("modified"))
+			tree, _ := previous.update(HashSHA256, leaves)
+
+			Expect(tree.levels).To(HaveLen(len(previous.levels)))
+			for i := range tree.levels {
+				changed := 0
+				for j := range tree.levels[i] {
+					if tree.levels[i][j] != previous.levels[i][j] {
+						changed++
+					}
+				}
+				Expect(changed).To(Equal(1), "level %d", i)
+			}
+		})
+
+		It("attributes the change to the child", func() {
+			previous := h.merkleTrees.get(deployment.GetUID())
+			leaves := append([]merkleLeaf{}, previous.leaves...)
+			content, err := serializeChild(children[2], "", nil)
+			Expect(err).NotTo(HaveOccurred())
+			for i := range leaves {
+				if leaves[i].key == childHashKey(children[2]) {
+					leaves[i].hash = merkleLeafHash(HashSHA256, children[2], content)
+				}
+			}
+
+			_, changed := previous.update(HashSHA256, leaves)
+			Expect(changed).To(ConsistOf("ConfigMap/default/example2"))
+		})
+
+		It("reverts to the original root once the change is reverted", func() {
+			_, err := h.merkleRoot(deployment, children, h.contents)
+			Expect(err).NotTo(HaveOccurred())
+
+			cm := children[2].(*corev1.ConfigMap)
+			cm.Data = utils.ExampleConfigMap1.DeepCopy().Data
+			cm.SetResourceVersion(cm.GetResourceVersion() + "1")
+			root, err := h.merkleRoot(deployment, children, h.contents)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(root).To(Equal(original))
+		})
+	})
+
+	Context("When children are added and removed", func() {
+		BeforeEach(func() {
+			_, err := h.merkleRoot(deployment, children, h.contents)
+			Expect(err).NotTo(HaveOccurred())
+		})
+
+		It("calculates the same root as from scratch", func() {
+			added := utils.ExampleConfigMap2.DeepCopy()
+			added.SetUID("added-uid")
+			added.SetResourceVersion("1")
+			children = append(children[1:], added)
+
+			root, err := h.merkleRoot(deployment, children, h.contents)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(root).To(Equal(fromScratch(children)))
+		})
+	})
+
+	Context("When the workload is poked", func() {
+		It("recalculates the root from scratch", func() {
+			_, err := h.merkleRoot(deployment, children, h.contents)
+			Expect(err).NotTo(HaveOccurred())
+
+			// The child's content changes without its resourceVersion changing,
+			// so only a calculation from scratch observes the change
+			children[0].(*corev1.ConfigMap).Data = map[string]string{"key1": "modified"}
+			cached, err := h.merkleRoot(deployment, children, h.contents)
+			Expect(err).NotTo(HaveOccurred())
+			poked, err := h.merkleRoot(deployment, children, nil)
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(poked).NotTo(Equal(cached))
+			Expect(poked).To(Equal(fromScratch(children)))
+		})
+	})
+})
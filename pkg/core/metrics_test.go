@@ -0,0 +1,147 @@
+/*
+Copyright 2018 Pusher Ltd.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package core
+
+import (
+	"fmt"
+	"net/http/httptest"
+	"regexp"
+	"strconv"
+	"sync"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/pusher/wave/pkg/metrics"
+	"github.com/pusher/wave/test/utils"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/manager"
+)
+
+var _ = Describe("Wave metrics Suite", func() {
+	var c client.Client
+	var h *Handler
+	var m utils.Matcher
+	var deployment *appsv1.Deployment
+	var mgrStopped *sync.WaitGroup
+	var stopMgr chan struct{}
+
+	const timeout = time.Second * 5
+
+	// scrape returns the value of the sample of the Deployments in the default
+	// namespace served by the metrics Handler, or zero if there is none
+	var scrape = func(name string) float64 {
+		recorder := httptest.NewRecorder()
+		metrics.Handler().ServeHTTP(recorder, httptest.NewRequest("GET", "/metrics", nil))
+
+		pattern := fmt.Sprintf(`(?m)^%s\{namespace="default",kind="Deployment"\} (\S+)$`, regexp.QuoteMeta(name))
+		match := regexp.MustCompile(pattern).FindStringSubmatch(recorder.Body.String())
+		if match == nil {
+			return 0
+		}
+		value, err := strconv.ParseFloat(match[1], 64)
+		Expect(err).NotTo(HaveOccurred())
+		return value
+	}
+
+	BeforeEach(func() {
+		mgr, err := manager.New(cfg, manager.Options{})
+		Expect(err).NotTo(HaveOccurred())
+		c = mgr.GetClient()
+		m = utils.Matcher{Client: c}
+		h = NewHandler(c, mgr.GetRecorder("wave"), Options{})
+
+		stopMgr, mgrStopped = StartTestManager(mgr)
+
+		for _, obj := range []Object{
+			utils.ExampleConfigMap1.DeepCopy(),
+			utils.ExampleConfigMap2.DeepCopy(),
+			utils.ExampleSecret1.DeepCopy(),
+			utils.ExampleSecret2.DeepCopy(),
+		} {
+			m.Create(obj).Should(Succeed())
+			m.Get(obj, timeout).Should(Succeed())
+		}
+
+		deployment = utils.ExampleDeployment.DeepCopy()
+		deployment.SetAnnotations(map[string]string{RequiredAnnotation: "true"})
+		m.Create(deployment).Should(Succeed())
+		m.Get(deployment, timeout).Should(Succeed())
+	})
+
+	AfterEach(func() {
+		// Make sure to delete the finalizer so the Deployment can be deleted
+		m.Get(deployment, timeout).Should(Succeed())
+		deployment.SetFinalizers([]string{})
+		m.Update(deployment).Should(Succeed())
+
+		close(stopMgr)
+		mgrStopped.Wait()
+
+		utils.DeleteAll(cfg, timeout,
+			&appsv1.DeploymentList{},
+			&corev1.ConfigMapList{},
+			&corev1.SecretList{},
+			&corev1.EventList{},
+		)
+	})
+
+	It("Counts the reconcile and the hash change", func() {
+		reconciles := scrape("wave_reconcile_duration_seconds_count")
+		hashChanges := scrape("wave_hash_changes_total")
+		errors := scrape("wave_reconcile_errors_total")
+
+		_, err := h.HandleDeployment(deployment)
+		Expect(err).NotTo(HaveOccurred())
+
+		Expect(scrape("wave_reconcile_duration_seconds_count")).To(Equal(reconciles + 1))
+		Expect(scrape("wave_hash_changes_total")).To(Equal(hashChanges + 1))
+		Expect(scrape("wave_reconcile_errors_total")).To(Equal(errors))
+	})
+
+	It("Doesn't count a hash change that fails to be recorded", func() {
+		hashChanges := scrape("wave_hash_changes_total")
+
+		// Updating the Deployment makes the reconciled copy stale, so
+		// recording the hash on it conflicts
+		stale := deployment.DeepCopy()
+		deployment.SetLabels(map[string]string{"updated": "true"})
+		m.Update(deployment).Should(Succeed())
+		_, err := h.HandleDeployment(stale)
+		Expect(err).To(HaveOccurred())
+
+		Expect(scrape("wave_hash_changes_total")).To(Equal(hashChanges))
+	})
+
+	It("Counts a failed reconcile as an error", func() {
+		errors := scrape("wave_reconcile_errors_total")
+		hashChanges := scrape("wave_hash_changes_total")
+
+		deployment.SetAnnotations(map[string]string{
+			RequiredAnnotation:        "true",
+			ExtraConfigMapsAnnotation: "missing",
+		})
+		m.Update(deployment).Should(Succeed())
+		_, err := h.HandleDeployment(deployment)
+		Expect(err).To(HaveOccurred())
+
+		Expect(scrape("wave_reconcile_errors_total")).To(Equal(errors + 1))
+		Expect(scrape("wave_hash_changes_total")).To(Equal(hashChanges))
+	})
+})
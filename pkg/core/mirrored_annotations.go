@@ -0,0 +1,48 @@
+/*
+Copyright 2018 Pusher Ltd.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package core
+
+// mirrorAnnotations copies the values of the MirroredAnnotations from the
+// workload onto its PodTemplate.
+// Mirrored annotations that the workload doesn't have are removed from the
+// PodTemplate, other annotations on the PodTemplate are left in place.
+// The ConfigHashAnnotation is never mirrored, as Wave manages it on both
+func (h *Handler) mirrorAnnotations(obj Object) {
+	podTemplate := getPodTemplate(obj)
+	if len(h.options.MirroredAnnotations) == 0 || podTemplate == nil {
+		return
+	}
+
+	annotations := podTemplate.GetAnnotations()
+	if annotations == nil {
+		annotations = make(map[string]string)
+	}
+	for _, key := range h.options.MirroredAnnotations {
+		if key == h.options.ConfigHashAnnotation {
+			continue
+		}
+		if value, ok := obj.GetAnnotations()[key]; ok {
+			annotations[key] = value
+		} else {
+			delete(annotations, key)
+		}
+	}
+	if len(annotations) == 0 {
+		annotations = nil
+	}
+	podTemplate.SetAnnotations(annotations)
+}
@@ -0,0 +1,66 @@
+/*
+Copyright 2018 Pusher Ltd.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package core
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/pusher/wave/test/utils"
+	appsv1 "k8s.io/api/apps/v1"
+)
+
+var _ = Describe("Wave mirrored annotations Suite", func() {
+	Context("mirrorAnnotations", func() {
+		var h *Handler
+		var deployment *appsv1.Deployment
+
+		BeforeEach(func() {
+			h = NewHandler(nil, nil, Options{MirroredAnnotations: []string{"team", "missing", ConfigHashAnnotation}})
+			deployment = utils.ExampleDeployment.DeepCopy()
+			deployment.SetAnnotations(map[string]string{
+				"team":               "payments",
+				"other":              "example",
+				ConfigHashAnnotation: "metadata",
+			})
+		})
+
+		It("copies only the mirrored annotations onto the PodTemplate", func() {
+			h.mirrorAnnotations(deployment)
+			Expect(deployment.Spec.Template.GetAnnotations()).To(Equal(map[string]string{"team": "payments"}))
+		})
+
+		It("removes mirrored annotations the workload doesn't have", func() {
+			deployment.Spec.Template.SetAnnotations(map[string]string{
+				"missing":            "stale",
+				"own":                "example",
+				ConfigHashAnnotation: "hash",
+			})
+			h.mirrorAnnotations(deployment)
+			Expect(deployment.Spec.Template.GetAnnotations()).To(Equal(map[string]string{
+				"team":               "payments",
+				"own":                "example",
+				ConfigHashAnnotation: "hash",
+			}))
+		})
+
+		It("doesn't modify the PodTemplate without MirroredAnnotations", func() {
+			h = NewHandler(nil, nil, Options{})
+			h.mirrorAnnotations(deployment)
+			Expect(deployment.Spec.Template.GetAnnotations()).To(BeNil())
+		})
+	})
+})
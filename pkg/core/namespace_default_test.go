@@ -0,0 +1,205 @@
+/*
+Copyright 2018 Pusher Ltd.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package core
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/pusher/wave/test/utils"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/manager"
+)
+
+var _ = Describe("Wave namespace default Suite", func() {
+	var c client.Client
+	var h *Handler
+	var m utils.Matcher
+	var ns *corev1.Namespace
+	var deployment *appsv1.Deployment
+	var mgrStopped *sync.WaitGroup
+	var stopMgr chan struct{}
+
+	const namespace = "wave-defaults"
+	const timeout = time.Second * 5
+	const consistentlyTimeout = time.Second
+
+	// setNamespaceDefault sets the RequiredAnnotation on the namespace, or
+	// removes it when value is empty
+	setNamespaceDefault := func(value string) {
+		m.Get(ns, timeout).Should(Succeed())
+		annotations := map[string]string{}
+		if value != "" {
+			annotations[RequiredAnnotation] = value
+		}
+		ns.SetAnnotations(annotations)
+		m.Update(ns).Should(Succeed())
+		if value != "" {
+			m.Eventually(ns, timeout).Should(utils.WithAnnotations(HaveKeyWithValue(RequiredAnnotation, value)))
+		} else {
+			m.Eventually(ns, timeout).ShouldNot(utils.WithAnnotations(HaveKey(RequiredAnnotation)))
+		}
+	}
+
+	BeforeEach(func() {
+		mgr, err := manager.New(cfg, manager.Options{})
+		Expect(err).NotTo(HaveOccurred())
+		c = mgr.GetClient()
+		h = NewHandler(c, mgr.GetRecorder("wave"), Options{NamespaceDefaults: true})
+		m = utils.Matcher{Client: c}
+
+		stopMgr, mgrStopped = StartTestManager(mgr)
+
+		// Namespaces can't be deleted in the test environment, so the namespace
+		// may remain from a previous test
+		ns = &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: namespace}}
+		err = c.Create(context.TODO(), ns)
+		if !errors.IsAlreadyExists(err) {
+			Expect(err).NotTo(HaveOccurred())
+		}
+
+		for _, obj := range []Object{
+			utils.ExampleConfigMap1.DeepCopy(),
+			utils.ExampleConfigMap2.DeepCopy(),
+			utils.ExampleSecret1.DeepCopy(),
+			utils.ExampleSecret2.DeepCopy(),
+		} {
+			obj.SetNamespace(namespace)
+			m.Create(obj).Should(Succeed())
+			m.Get(obj, timeout).Should(Succeed())
+		}
+
+		deployment = utils.ExampleDeployment.DeepCopy()
+		deployment.SetNamespace(namespace)
+	})
+
+	AfterEach(func() {
+		// Make sure to delete the finalizer so the Deployment can be deleted
+		m.Get(deployment, timeout).Should(Succeed())
+		deployment.SetFinalizers([]string{})
+		m.Update(deployment).Should(Succeed())
+
+		setNamespaceDefault("")
+
+		close(stopMgr)
+		mgrStopped.Wait()
+
+		utils.DeleteAll(cfg, timeout,
+			&appsv1.DeploymentList{},
+			&corev1.ConfigMapList{},
+			&corev1.SecretList{},
+			&corev1.EventList{},
+		)
+	})
+
+	Context("When the namespace defaults to off", func() {
+		BeforeEach(func() {
+			setNamespaceDefault("false")
+		})
+
+		It("Manages a workload that overrides the default", func() {
+			deployment.SetAnnotations(map[string]string{RequiredAnnotation: "true"})
+			m.Create(deployment).Should(Succeed())
+			m.Get(deployment, timeout).Should(Succeed())
+
+			_, err := h.HandleDeployment(deployment)
+			Expect(err).NotTo(HaveOccurred())
+
+			m.Eventually(deployment, timeout).Should(utils.WithFinalizers(ContainElement(FinalizerString)))
+			m.Eventually(deployment, timeout).Should(utils.WithPodTemplateAnnotations(HaveKey(ConfigHashAnnotation)))
+		})
+
+		It("Ignores a workload without the annotation", func() {
+			m.Create(deployment).Should(Succeed())
+			m.Get(deployment, timeout).Should(Succeed())
+
+			_, err := h.HandleDeployment(deployment)
+			Expect(err).NotTo(HaveOccurred())
+
+			m.Consistently(deployment, consistentlyTimeout).ShouldNot(utils.WithFinalizers(ContainElement(FinalizerString)))
+		})
+	})
+
+	Context("When the namespace defaults to on", func() {
+		BeforeEach(func() {
+			setNamespaceDefault("true")
+		})
+
+		It("Manages a workload without the annotation", func() {
+			m.Create(deployment).Should(Succeed())
+			m.Get(deployment, timeout).Should(Succeed())
+
+			_, err := h.HandleDeployment(deployment)
+			Expect(err).NotTo(HaveOccurred())
+
+			m.Eventually(deployment, timeout).Should(utils.WithFinalizers(ContainElement(FinalizerString)))
+			m.Eventually(deployment, timeout).Should(utils.WithPodTemplateAnnotations(HaveKey(ConfigHashAnnotation)))
+		})
+
+		It("Ignores the default without NamespaceDefaults", func() {
+			h = NewHandler(c, h.recorder, Options{})
+			m.Create(deployment).Should(Succeed())
+			m.Get(deployment, timeout).Should(Succeed())
+
+			_, err := h.HandleDeployment(deployment)
+			Expect(err).NotTo(HaveOccurred())
+
+			m.Consistently(deployment, consistentlyTimeout).ShouldNot(utils.WithFinalizers(ContainElement(FinalizerString)))
+		})
+
+		It("Ignores a workload that overrides the default", func() {
+			deployment.SetAnnotations(map[string]string{RequiredAnnotation: "false"})
+			m.Create(deployment).Should(Succeed())
+			m.Get(deployment, timeout).Should(Succeed())
+
+			_, err := h.HandleDeployment(deployment)
+			Expect(err).NotTo(HaveOccurred())
+
+			m.Consistently(deployment, consistentlyTimeout).ShouldNot(utils.WithFinalizers(ContainElement(FinalizerString)))
+		})
+	})
+
+	Context("When the namespace sets no default", func() {
+		It("Ignores a workload without the annotation", func() {
+			m.Create(deployment).Should(Succeed())
+			m.Get(deployment, timeout).Should(Succeed())
+
+			_, err := h.HandleDeployment(deployment)
+			Expect(err).NotTo(HaveOccurred())
+
+			m.Consistently(deployment, consistentlyTimeout).ShouldNot(utils.WithFinalizers(ContainElement(FinalizerString)))
+		})
+
+		It("Manages a workload without the annotation when EnabledByDefault is set", func() {
+			h = NewHandler(c, h.recorder, Options{NamespaceDefaults: true, EnabledByDefault: true})
+			m.Create(deployment).Should(Succeed())
+			m.Get(deployment, timeout).Should(Succeed())
+
+			_, err := h.HandleDeployment(deployment)
+			Expect(err).NotTo(HaveOccurred())
+
+			m.Eventually(deployment, timeout).Should(utils.WithFinalizers(ContainElement(FinalizerString)))
+		})
+	})
+})
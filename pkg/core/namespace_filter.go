@@ -0,0 +1,38 @@
+/*
+Copyright 2018 Pusher Ltd.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package core
+
+// namespaceAllowed returns true if workloads in the namespace are reconciled.
+// A namespace in DeniedNamespaces is never reconciled, even if it is also in
+// AllowedNamespaces. Every other namespace is reconciled unless
+// AllowedNamespaces is set and doesn't contain it
+func (h *Handler) namespaceAllowed(namespace string) bool {
+	for _, denied := range h.options.DeniedNamespaces {
+		if namespace == denied {
+			return false
+		}
+	}
+	if len(h.options.AllowedNamespaces) == 0 {
+		return true
+	}
+	for _, allowed := range h.options.AllowedNamespaces {
+		if namespace == allowed {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,53 @@
+/*
+Copyright 2018 Pusher Ltd.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package core
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Wave namespace filter Suite", func() {
+	Context("namespaceAllowed", func() {
+		It("allows every namespace without any lists", func() {
+			h := NewHandler(nil, nil, Options{})
+			Expect(h.namespaceAllowed("default")).To(BeTrue())
+		})
+
+		It("allows only the AllowedNamespaces", func() {
+			h := NewHandler(nil, nil, Options{AllowedNamespaces: []string{"team-a", "team-b"}})
+			Expect(h.namespaceAllowed("team-a")).To(BeTrue())
+			Expect(h.namespaceAllowed("team-b")).To(BeTrue())
+			Expect(h.namespaceAllowed("default")).To(BeFalse())
+		})
+
+		It("allows every namespace but the DeniedNamespaces", func() {
+			h := NewHandler(nil, nil, Options{DeniedNamespaces: []string{"kube-system"}})
+			Expect(h.namespaceAllowed("kube-system")).To(BeFalse())
+			Expect(h.namespaceAllowed("default")).To(BeTrue())
+		})
+
+		It("denies a namespace in both lists", func() {
+			h := NewHandler(nil, nil, Options{
+				AllowedNamespaces: []string{"team-a", "team-b"},
+				DeniedNamespaces:  []string{"team-b"},
+			})
+			Expect(h.namespaceAllowed("team-a")).To(BeTrue())
+			Expect(h.namespaceAllowed("team-b")).To(BeFalse())
+		})
+	})
+})
@@ -0,0 +1,101 @@
+/*
+Copyright 2018 Pusher Ltd.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package core
+
+import (
+	"sync"
+
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// workloadUIDs records the UID each workload was last reconciled with, by
+// kind and name, so that the state Wave holds in memory for the workload can
+// be forgotten once the workload is no longer found, eg. when it was deleted
+// without Wave's finalizer
+type workloadUIDs struct {
+	lock sync.Mutex
+	uids map[workloadKey]types.UID
+}
+
+// newWorkloadUIDs constructs a workloadUIDs with no recorded UIDs
+func newWorkloadUIDs() *workloadUIDs {
+	return &workloadUIDs{uids: make(map[workloadKey]types.UID)}
+}
+
+// set records the UID of the workload, returning the UID previously recorded
+// for a workload of the same kind and name, if any
+func (w *workloadUIDs) set(workload Object) types.UID {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	key := keyForWorkload(workload)
+	previous := w.uids[key]
+	w.uids[key] = workload.GetUID()
+	return previous
+}
+
+// remove removes the UID recorded for the workload with the given key and
+// returns it, if any
+func (w *workloadUIDs) remove(key workloadKey) types.UID {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	uid := w.uids[key]
+	delete(w.uids, key)
+	return uid
+}
+
+// trackWorkload records the UID of the workload being reconciled.
+// If the workload was recreated with the same name, the state held for the
+// previous workload is forgotten
+func (h *Handler) trackWorkload(instance Object) {
+	previous := h.workloadUIDs.set(instance)
+	if previous != "" && previous != instance.GetUID() {
+		h.forgetUID(previous)
+	}
+}
+
+// HandleNotFound forgets all state held for the workload of the kind (eg.
+// "Deployment") with the given name, called by the controllers when the
+// workload they were asked to reconcile no longer exists
+func (h *Handler) HandleNotFound(kind string, name types.NamespacedName) {
+	key := workloadKey{kind: kind, NamespacedName: name}
+	h.options.ChildIndex.removeKey(key)
+	h.breaker.forget(key)
+	if uid := h.workloadUIDs.remove(key); uid != "" {
+		h.forgetUID(uid)
+	}
+}
+
+// forgetWorkload forgets all state held for the workload, once it has been
+// cleaned up
+func (h *Handler) forgetWorkload(obj Object) {
+	key := keyForWorkload(obj)
+	h.options.ChildIndex.removeKey(key)
+	h.breaker.forget(key)
+	h.workloadUIDs.remove(key)
+	h.forgetUID(obj.GetUID())
+}
+
+// forgetUID forgets the state held for the workload with the given UID.
+// Caches keyed by child, such as the contentCache and secretDataCache, are
+// shared between workloads and bounded in size instead
+func (h *Handler) forgetUID(uid types.UID) {
+	h.childHashes.forget(uid)
+	h.frozenHashes.forget(uid)
+	h.crossNamespaceSkips.forget(uid)
+	h.merkleTrees.forget(uid)
+	h.summaries.forget(uid)
+}
@@ -0,0 +1,92 @@
+/*
+Copyright 2018 Pusher Ltd.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package core
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/pusher/wave/test/utils"
+	appsv1 "k8s.io/api/apps/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
+)
+
+var _ = Describe("Wave not found Suite", func() {
+	var h *Handler
+	var index *ChildIndex
+	var deployment *appsv1.Deployment
+
+	// track records state for the Deployment in every per-workload tracker,
+	// as reconciling it would
+	var track = func() {
+		h.trackWorkload(deployment)
+		cm1 := utils.ExampleConfigMap1
+		index.update(deployment, map[types.NamespacedName]struct{}{
+			{Namespace: cm1.GetNamespace(), Name: cm1.GetName()}: {},
+		}, nil)
+		h.childHashes.record(deployment, childHashSet{})
+		h.frozenHashes.diverged(deployment, "hash")
+		h.crossNamespaceSkips.changed(deployment, []string{"Secret other/example1"})
+		h.merkleTrees.set(deployment.GetUID(), &merkleTree{})
+		h.summaries.start(deployment.GetUID())
+		h.breaker.recordFailure(keyForWorkload(deployment))
+	}
+
+	// tracked returns whether any state is held for a workload with the UID
+	var tracked = func(uid types.UID) bool {
+		_, hashes := h.childHashes.hashes[uid]
+		_, frozen := h.frozenHashes.hashes[uid]
+		_, skips := h.crossNamespaceSkips.reports[uid]
+		_, trees := h.merkleTrees.trees[uid]
+		_, summaries := h.summaries.summaries[uid]
+		return hashes || frozen || skips || trees || summaries
+	}
+
+	BeforeEach(func() {
+		index = NewChildIndex()
+		h = NewHandler(nil, record.NewFakeRecorder(10), Options{ChildIndex: index})
+		deployment = utils.ExampleDeployment.DeepCopy()
+		deployment.SetUID("deployment-uid")
+		track()
+	})
+
+	It("Forgets all state held for a workload that is not found", func() {
+		h.HandleNotFound("Deployment", types.NamespacedName{Namespace: deployment.GetNamespace(), Name: deployment.GetName()})
+
+		Expect(tracked(deployment.GetUID())).To(BeFalse())
+		Expect(h.workloadUIDs.uids).To(BeEmpty())
+		Expect(h.breaker.failures).To(BeEmpty())
+		Expect(index.contains(deployment)).To(BeFalse())
+		Expect(index.WorkloadsFor(utils.ExampleConfigMap1, &appsv1.Deployment{})).To(BeEmpty())
+	})
+
+	It("Keeps the state of a workload of another kind with the same name", func() {
+		h.HandleNotFound("StatefulSet", types.NamespacedName{Namespace: deployment.GetNamespace(), Name: deployment.GetName()})
+
+		Expect(tracked(deployment.GetUID())).To(BeTrue())
+		Expect(index.contains(deployment)).To(BeTrue())
+	})
+
+	It("Forgets the state of a workload recreated with the same name", func() {
+		previous := deployment.GetUID()
+		deployment = deployment.DeepCopy()
+		deployment.SetUID("recreated-uid")
+		h.trackWorkload(deployment)
+
+		Expect(tracked(previous)).To(BeFalse())
+	})
+})
@@ -0,0 +1,107 @@
+/*
+Copyright 2018 Pusher Ltd.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package core
+
+import (
+	"context"
+	"fmt"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// isOnDelete returns true if the given workload uses the OnDelete update
+// strategy, meaning its Pods are not replaced when the PodTemplate changes
+func isOnDelete(obj Object) bool {
+	switch o := obj.(type) {
+	case *appsv1.DaemonSet:
+		return o.Spec.UpdateStrategy.Type == appsv1.OnDeleteDaemonSetStrategyType
+	default:
+		return false
+	}
+}
+
+// handleOnDelete applies the configured OnDeletePolicy to a workload using the
+// OnDelete update strategy.
+// The original object is the state of the workload before the hash was
+// updated, the updated object contains the given hash
+func (h *Handler) handleOnDelete(original, updated Object, hash string) error {
+	switch h.options.DaemonSetOnDeletePolicy {
+	case OnDeleteDeletePods:
+		return h.deleteOutdatedPods(updated, hash)
+	default:
+		// Only notify the user when the hash has actually changed
+		if getConfigHash(original, h.options.ConfigHashAnnotation) != hash {
+			h.recorder.Eventf(updated, corev1.EventTypeNormal, "OnDeleteStrategy", "%s uses the OnDelete update strategy, Pods must be deleted manually to apply configuration hash %s", kindOf(updated), hash)
+		}
+		return nil
+	}
+}
+
+// deleteOutdatedPods deletes all Pods controlled by the workload that were not
+// created with the given configuration hash
+func (h *Handler) deleteOutdatedPods(obj Object, hash string) error {
+	pods, err := h.getControlledPods(obj)
+	if err != nil {
+		return fmt.Errorf("error fetching Pods: %v", err)
+	}
+
+	for _, pod := range pods {
+		// Pods that are already terminating will be replaced anyway
+		if getPodConfigHash(obj, pod, h.options.ConfigHashAnnotation) == hash || toBeDeleted(pod) {
+			continue
+		}
+
+		h.recorder.Eventf(obj, corev1.EventTypeNormal, "DeletePod", "Deleting Pod %s to apply configuration hash %s", pod.GetName(), hash)
+		err := h.Delete(context.TODO(), pod)
+		if err != nil {
+			return fmt.Errorf("error deleting Pod %s/%s: %v", pod.GetNamespace(), pod.GetName(), err)
+		}
+	}
+	return nil
+}
+
+// getControlledPods returns all Pods which have a controller reference
+// pointing to the given workload
+func (h *Handler) getControlledPods(obj Object) ([]*corev1.Pod, error) {
+	ds, ok := obj.(*appsv1.DaemonSet)
+	if !ok {
+		return []*corev1.Pod{}, fmt.Errorf("unsupported type: %s", kindOf(obj))
+	}
+
+	selector, err := metav1.LabelSelectorAsSelector(ds.Spec.Selector)
+	if err != nil {
+		return []*corev1.Pod{}, fmt.Errorf("error parsing selector: %v", err)
+	}
+
+	podList := &corev1.PodList{}
+	opts := &client.ListOptions{Namespace: obj.GetNamespace(), LabelSelector: selector}
+	err = h.List(context.TODO(), opts, podList)
+	if err != nil {
+		return []*corev1.Pod{}, fmt.Errorf("error listing Pods: %v", err)
+	}
+
+	pods := []*corev1.Pod{}
+	for _, pod := range podList.Items {
+		if metav1.IsControlledBy(&pod, obj) {
+			pods = append(pods, pod.DeepCopy())
+		}
+	}
+	return pods, nil
+}
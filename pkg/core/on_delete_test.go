@@ -0,0 +1,182 @@
+/*
+Copyright 2018 Pusher Ltd.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package core
+
+import (
+	"sync"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/pusher/wave/test/utils"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/manager"
+)
+
+var _ = Describe("Wave on delete Suite", func() {
+	var c client.Client
+	var m utils.Matcher
+	var mgr manager.Manager
+
+	var daemonset *appsv1.DaemonSet
+	var outdatedPod *corev1.Pod
+	var currentPod *corev1.Pod
+	var unownedPod *corev1.Pod
+	var mgrStopped *sync.WaitGroup
+	var stopMgr chan struct{}
+
+	const timeout = time.Second * 5
+	const consistentlyTimeout = time.Second
+
+	var examplePod = func(name, hash string, owner *metav1.OwnerReference) *corev1.Pod {
+		pod := &corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:        name,
+				Namespace:   daemonset.GetNamespace(),
+				Labels:      daemonset.Spec.Template.GetLabels(),
+				Annotations: map[string]string{ConfigHashAnnotation: hash},
+			},
+			Spec: corev1.PodSpec{
+				Containers: []corev1.Container{
+					{
+						Name:  "container1",
+						Image: "container1",
+					},
+				},
+			},
+		}
+		if owner != nil {
+			pod.SetOwnerReferences([]metav1.OwnerReference{*owner})
+		}
+		return pod
+	}
+
+	BeforeEach(func() {
+		var err error
+		mgr, err = manager.New(cfg, manager.Options{})
+		Expect(err).NotTo(HaveOccurred())
+		c = mgr.GetClient()
+		m = utils.Matcher{Client: c}
+
+		stopMgr, mgrStopped = StartTestManager(mgr)
+
+		for _, obj := range []Object{
+			utils.ExampleConfigMap1.DeepCopy(),
+			utils.ExampleConfigMap2.DeepCopy(),
+			utils.ExampleSecret1.DeepCopy(),
+			utils.ExampleSecret2.DeepCopy(),
+		} {
+			m.Create(obj).Should(Succeed())
+			m.Get(obj, timeout).Should(Succeed())
+		}
+
+		daemonset = utils.ExampleDaemonSet.DeepCopy()
+		daemonset.SetAnnotations(map[string]string{RequiredAnnotation: "true"})
+		daemonset.Spec.UpdateStrategy = appsv1.DaemonSetUpdateStrategy{
+			Type: appsv1.OnDeleteDaemonSetStrategyType,
+		}
+		m.Create(daemonset).Should(Succeed())
+		m.Get(daemonset, timeout).Should(Succeed())
+
+		isController := true
+		controllerRef := utils.GetOwnerRef(daemonset)
+		controllerRef.Controller = &isController
+
+		outdatedPod = examplePod("outdated", "outdated", &controllerRef)
+		currentPod = examplePod("current", exampleHash, &controllerRef)
+		unownedPod = examplePod("unowned", "outdated", nil)
+		for _, pod := range []*corev1.Pod{outdatedPod, currentPod, unownedPod} {
+			m.Create(pod).Should(Succeed())
+			m.Get(pod, timeout).Should(Succeed())
+		}
+	})
+
+	AfterEach(func() {
+		// Make sure to delete the finalizer so the DaemonSet can be deleted
+		m.Get(daemonset, timeout).Should(Succeed())
+		daemonset.SetFinalizers([]string{})
+		m.Update(daemonset).Should(Succeed())
+
+		close(stopMgr)
+		mgrStopped.Wait()
+
+		utils.DeleteAll(cfg, timeout,
+			&appsv1.DaemonSetList{},
+			&corev1.PodList{},
+			&corev1.ConfigMapList{},
+			&corev1.SecretList{},
+			&corev1.EventList{},
+		)
+	})
+
+	Context("With the delete-pods policy", func() {
+		BeforeEach(func() {
+			h := NewHandler(c, mgr.GetRecorder("wave"), Options{DaemonSetOnDeletePolicy: OnDeleteDeletePods})
+			_, err := h.HandleDaemonSet(daemonset)
+			Expect(err).NotTo(HaveOccurred())
+		})
+
+		It("Deletes Pods with an outdated configuration hash", func() {
+			m.Get(outdatedPod, timeout).ShouldNot(Succeed())
+		})
+
+		It("Doesn't delete Pods with the current configuration hash", func() {
+			m.Consistently(currentPod, consistentlyTimeout).Should(utils.WithAnnotations(HaveKeyWithValue(ConfigHashAnnotation, exampleHash)))
+		})
+
+		It("Doesn't delete Pods not controlled by the DaemonSet", func() {
+			m.Consistently(unownedPod, consistentlyTimeout).Should(utils.WithAnnotations(HaveKey(ConfigHashAnnotation)))
+		})
+
+		It("Sends an event for each deleted Pod", func() {
+			events := &corev1.EventList{}
+			eventMessage := func(event *corev1.Event) string {
+				return event.Message
+			}
+
+			deleteMessage := "Deleting Pod outdated to apply configuration hash " + exampleHash
+			m.Eventually(events, timeout).Should(utils.WithItems(ContainElement(WithTransform(eventMessage, Equal(deleteMessage)))))
+		})
+	})
+
+	Context("With the event policy", func() {
+		BeforeEach(func() {
+			h := NewHandler(c, mgr.GetRecorder("wave"), Options{DaemonSetOnDeletePolicy: OnDeleteEvent})
+			_, err := h.HandleDaemonSet(daemonset)
+			Expect(err).NotTo(HaveOccurred())
+		})
+
+		It("Doesn't delete any Pods", func() {
+			for _, pod := range []*corev1.Pod{outdatedPod, currentPod, unownedPod} {
+				m.Consistently(pod, consistentlyTimeout).Should(utils.WithAnnotations(HaveKey(ConfigHashAnnotation)))
+			}
+		})
+
+		It("Sends an event explaining the Pods must be deleted", func() {
+			events := &corev1.EventList{}
+			eventMessage := func(event *corev1.Event) string {
+				return event.Message
+			}
+
+			onDeleteMessage := "DaemonSet uses the OnDelete update strategy, Pods must be deleted manually to apply configuration hash " + exampleHash
+			m.Eventually(events, timeout).Should(utils.WithItems(ContainElement(WithTransform(eventMessage, Equal(onDeleteMessage)))))
+		})
+	})
+})
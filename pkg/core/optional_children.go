@@ -0,0 +1,234 @@
+/*
+Copyright 2018 Pusher Ltd.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package core
+
+import (
+	"fmt"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// getOptionalChildNames parses the workload's PodTemplate and returns the
+// names of the ConfigMaps and the Secrets that are only ever referenced as
+// optional
+func getOptionalChildNames(obj Object) (map[string]struct{}, map[string]struct{}) {
+	configMaps := newOptionalNames()
+	secrets := newOptionalNames()
+
+	podSpec := getPodSpec(obj)
+	for _, vol := range podSpec.Volumes {
+		if cm := vol.VolumeSource.ConfigMap; cm != nil {
+			configMaps.add(cm.Name, cm.Optional)
+		}
+		if s := vol.VolumeSource.Secret; s != nil {
+			secrets.add(s.SecretName, s.Optional)
+		}
+		if projected := vol.VolumeSource.Projected; projected != nil {
+			for _, source := range projected.Sources {
+				if cm := source.ConfigMap; cm != nil {
+					configMaps.add(cm.Name, cm.Optional)
+				}
+				if s := source.Secret; s != nil {
+					secrets.add(s.Name, s.Optional)
+				}
+			}
+		}
+	}
+	for _, container := range getAllContainers(podSpec) {
+		for _, env := range container.EnvFrom {
+			if cm := env.ConfigMapRef; cm != nil {
+				configMaps.add(cm.Name, cm.Optional)
+			}
+			if s := env.SecretRef; s != nil {
+				secrets.add(s.Name, s.Optional)
+			}
+		}
+		for _, env := range container.Env {
+			if env.ValueFrom == nil {
+				continue
+			}
+			if cm := env.ValueFrom.ConfigMapKeyRef; cm != nil {
+				configMaps.add(cm.Name, cm.Optional)
+			}
+			if s := env.ValueFrom.SecretKeyRef; s != nil {
+				secrets.add(s.Name, s.Optional)
+			}
+		}
+	}
+
+	return configMaps.names(), secrets.names()
+}
+
+// optionalNames tracks whether every reference to each name is optional
+type optionalNames map[string]bool
+
+// newOptionalNames constructs an empty optionalNames
+func newOptionalNames() optionalNames {
+	return make(optionalNames)
+}
+
+// add records a reference to the name
+func (o optionalNames) add(name string, optional *bool) {
+	isOptional := optional != nil && *optional
+	if previous, ok := o[name]; ok {
+		isOptional = isOptional && previous
+	}
+	o[name] = isOptional
+}
+
+// names returns the names that were only referenced as optional
+func (o optionalNames) names() map[string]struct{} {
+	names := make(map[string]struct{})
+	for name, optional := range o {
+		if optional {
+			names[name] = struct{}{}
+		}
+	}
+	return names
+}
+
+// getOptionalChildKeys returns the keys of the ConfigMaps and Secrets that
+// the workload only references as optional.
+// Children also referenced by the extra children annotations, the JSONPath
+// expressions or as image pull Secrets are never optional
+func (h *Handler) getOptionalChildKeys(obj Object) (map[types.NamespacedName]struct{}, map[types.NamespacedName]struct{}, error) {
+	configMapNames, secretNames := getOptionalChildNames(obj)
+	configMaps := make(map[types.NamespacedName]struct{})
+	secrets := make(map[types.NamespacedName]struct{})
+	for name := range configMapNames {
+		configMaps[types.NamespacedName{Namespace: obj.GetNamespace(), Name: name}] = struct{}{}
+	}
+	for name := range secretNames {
+		secrets[types.NamespacedName{Namespace: obj.GetNamespace(), Name: name}] = struct{}{}
+	}
+	if len(configMaps) == 0 && len(secrets) == 0 {
+		return configMaps, secrets, nil
+	}
+
+	annotations := obj.GetAnnotations()
+	for _, key := range parseChildKeys(obj.GetNamespace(), annotations[ExtraConfigMapsAnnotation]) {
+		delete(configMaps, key)
+	}
+	for _, key := range parseChildKeys(obj.GetNamespace(), annotations[ExtraSecretsAnnotation]) {
+		delete(secrets, key)
+	}
+
+	configMapKeys, err := getChildKeysByJSONPath(obj, h.options.ExtraConfigMapPaths)
+	if err != nil {
+		return nil, nil, fmt.Errorf("error evaluating ConfigMap JSONPaths: %v", err)
+	}
+	for _, key := range configMapKeys {
+		delete(configMaps, key)
+	}
+	secretKeys, err := getChildKeysByJSONPath(obj, h.options.ExtraSecretPaths)
+	if err != nil {
+		return nil, nil, fmt.Errorf("error evaluating Secret JSONPaths: %v", err)
+	}
+	for _, key := range secretKeys {
+		delete(secrets, key)
+	}
+
+	pullSecretKeys, err := h.getImagePullSecretKeys(obj)
+	if err != nil {
+		return nil, nil, fmt.Errorf("error fetching image pull Secrets: %v", err)
+	}
+	for key := range pullSecretKeys {
+		delete(secrets, key)
+	}
+
+	return configMaps, secrets, nil
+}
+
+// getAbsentChildren returns a marker for each optional child in the keys that
+// is missing from the current children, so that the hash changes once the
+// child is created.
+// Markers are only returned for kinds whose ChildPolicy includes them in the
+// hash
+func (h *Handler) getAbsentChildren(obj Object, configMaps, secrets map[types.NamespacedName]struct{}, current []Object) ([]Object, error) {
+	optionalConfigMaps, optionalSecrets, err := h.getOptionalChildKeys(obj)
+	if err != nil {
+		return nil, err
+	}
+
+	present := make(map[string]struct{})
+	for _, child := range current {
+		present[childHashKey(child)] = struct{}{}
+	}
+
+	absent := []Object{}
+	for _, kind := range []struct {
+		name     string
+		keys     map[types.NamespacedName]struct{}
+		optional map[types.NamespacedName]struct{}
+		policy   ChildPolicy
+	}{
+		{name: "ConfigMap", keys: configMaps, optional: optionalConfigMaps, policy: h.options.ConfigMapPolicy},
+		{name: "Secret", keys: secrets, optional: optionalSecrets, policy: h.options.SecretPolicy},
+	} {
+		if kind.policy.ExcludeFromHash {
+			continue
+		}
+		for key := range kind.optional {
+			if _, ok := kind.keys[key]; !ok {
+				continue
+			}
+			marker := newAbsentChild(kind.name, key)
+			if _, ok := present[childHashKey(marker)]; !ok {
+				absent = append(absent, marker)
+			}
+		}
+	}
+	return absent, nil
+}
+
+// newAbsentChild constructs the marker hashed in place of a missing optional
+// child of the kind.
+// Markers are hashed with the children of other kinds, so can never be
+// confused with an existing child
+func newAbsentChild(kind string, key types.NamespacedName) Object {
+	marker := &unstructured.Unstructured{Object: map[string]interface{}{"absent": true}}
+	marker.SetGroupVersionKind(corev1.SchemeGroupVersion.WithKind(kind))
+	marker.SetNamespace(key.Namespace)
+	marker.SetName(key.Name)
+	return marker
+}
+
+// isAbsentChild returns true if the child is the marker a missing optional
+// child is hashed as
+func isAbsentChild(child Object) bool {
+	u, ok := child.(*unstructured.Unstructured)
+	if !ok {
+		return false
+	}
+	_, absent := u.Object["absent"]
+	return absent
+}
+
+// withoutAbsentChildren returns the children other than the markers missing
+// optional children are hashed as, so that the markers are never reported as
+// children that exist
+func withoutAbsentChildren(children []Object) []Object {
+	present := []Object{}
+	for _, child := range children {
+		if !isAbsentChild(child) {
+			present = append(present, child)
+		}
+	}
+	return present
+}
@@ -0,0 +1,127 @@
+/*
+Copyright 2018 Pusher Ltd.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package core
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/pusher/wave/test/utils"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+var _ = Describe("Wave optional children Suite", func() {
+	var optional = true
+	var required = false
+
+	// optionalVolume returns a volume optionally mounting the ConfigMap
+	var optionalVolume = func(name string) corev1.Volume {
+		return corev1.Volume{
+			Name: name,
+			VolumeSource: corev1.VolumeSource{
+				ConfigMap: &corev1.ConfigMapVolumeSource{
+					LocalObjectReference: corev1.LocalObjectReference{Name: name},
+					Optional:             &optional,
+				},
+			},
+		}
+	}
+
+	Context("getOptionalChildNames", func() {
+		var deployment *appsv1.Deployment
+
+		BeforeEach(func() {
+			deployment = utils.ExampleDeployment.DeepCopy()
+			podSpec := &deployment.Spec.Template.Spec
+			podSpec.Volumes = append(podSpec.Volumes,
+				optionalVolume("optional"),
+				optionalVolume("also-required"),
+				corev1.Volume{
+					Name: "optional-secret",
+					VolumeSource: corev1.VolumeSource{
+						Secret: &corev1.SecretVolumeSource{SecretName: "optional", Optional: &optional},
+					},
+				},
+			)
+			podSpec.Containers[0].EnvFrom = append(podSpec.Containers[0].EnvFrom, corev1.EnvFromSource{
+				ConfigMapRef: &corev1.ConfigMapEnvSource{
+					LocalObjectReference: corev1.LocalObjectReference{Name: "also-required"},
+					Optional:             &required,
+				},
+			})
+		})
+
+		It("returns children only referenced as optional", func() {
+			configMaps, secrets := getOptionalChildNames(deployment)
+			Expect(configMaps).To(Equal(map[string]struct{}{"optional": {}}))
+			Expect(secrets).To(Equal(map[string]struct{}{"optional": {}}))
+		})
+
+		It("returns children only referenced as optional by environment variables", func() {
+			deployment.Spec.Template.Spec.Containers[0].Env = []corev1.EnvVar{
+				{
+					Name: "OPTIONAL",
+					ValueFrom: &corev1.EnvVarSource{
+						SecretKeyRef: &corev1.SecretKeySelector{
+							LocalObjectReference: corev1.LocalObjectReference{Name: "optional-env"},
+							Key:                  "key1",
+							Optional:             &optional,
+						},
+					},
+				},
+				{
+					Name: "REQUIRED",
+					ValueFrom: &corev1.EnvVarSource{
+						ConfigMapKeyRef: &corev1.ConfigMapKeySelector{
+							LocalObjectReference: corev1.LocalObjectReference{Name: "optional"},
+							Key:                  "key1",
+						},
+					},
+				},
+			}
+
+			configMaps, secrets := getOptionalChildNames(deployment)
+			Expect(configMaps).To(BeEmpty())
+			Expect(secrets).To(Equal(map[string]struct{}{"optional": {}, "optional-env": {}}))
+		})
+
+		It("doesn't return children also listed in the extra children annotations", func() {
+			deployment.SetAnnotations(map[string]string{ExtraConfigMapsAnnotation: "optional"})
+			h := NewHandler(nil, nil, Options{})
+			configMaps, _, err := h.getOptionalChildKeys(deployment)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(configMaps).To(BeEmpty())
+		})
+	})
+
+	Context("withoutAbsentChildren", func() {
+		It("drops the markers of missing optional children", func() {
+			cm1 := utils.ExampleConfigMap1.DeepCopy()
+			absent := newAbsentChild("ConfigMap", types.NamespacedName{Namespace: "default", Name: "optional"})
+			Expect(isAbsentChild(absent)).To(BeTrue())
+			Expect(isAbsentChild(cm1)).To(BeFalse())
+			Expect(withoutAbsentChildren([]Object{cm1, absent})).To(Equal([]Object{cm1}))
+		})
+
+		It("doesn't report the markers as children in the WaveStatus or dry runs", func() {
+			absent := newAbsentChild("Secret", types.NamespacedName{Namespace: "default", Name: "optional"})
+			Expect(waveStatusChildren([]Object{utils.ExampleConfigMap1.DeepCopy(), absent})).To(Equal([]string{"ConfigMap default/example1"}))
+			Expect(waveStatusChildren([]Object{absent})).To(BeNil())
+		})
+	})
+})
@@ -0,0 +1,538 @@
+/*
+Copyright 2018 Pusher Ltd.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package core
+
+import (
+	"time"
+
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// OnDeletePolicy determines what Wave does when the configuration of a
+// workload using the OnDelete update strategy changes
+type OnDeletePolicy string
+
+const (
+	// OnDeleteEvent emits an event explaining that the workload's Pods must be
+	// deleted manually for the new configuration to be applied
+	OnDeleteEvent OnDeletePolicy = "event"
+
+	// OnDeleteDeletePods deletes any Pods that are running out of date
+	// configuration so that they are recreated with the new configuration
+	OnDeleteDeletePods OnDeletePolicy = "delete-pods"
+)
+
+// GenerateNameStrategy determines how Wave handles workloads whose name was
+// generated by the API server from their GenerateName
+type GenerateNameStrategy string
+
+const (
+	// GenerateNameTrack processes workloads with generated names like any
+	// other workload, tracking them by their UID
+	GenerateNameTrack GenerateNameStrategy = "track"
+
+	// GenerateNameIgnore ignores workloads with generated names, for example
+	// when they are short lived and would churn OwnerReferences on children
+	GenerateNameIgnore GenerateNameStrategy = "ignore"
+)
+
+// UpdateOrder determines whether Wave updates the OwnerReferences on a
+// workload's children before or after recording the configuration hash on the
+// workload
+type UpdateOrder string
+
+const (
+	// UpdateOrderOwnerReferencesFirst updates the OwnerReferences on the
+	// children before recording the configuration hash on the workload
+	UpdateOrderOwnerReferencesFirst UpdateOrder = "owner-references-first"
+
+	// UpdateOrderHashFirst records the configuration hash on the workload
+	// before updating the OwnerReferences on the children
+	UpdateOrderHashFirst UpdateOrder = "hash-first"
+)
+
+// HashAlgorithm determines the algorithm used to calculate configuration
+// hashes
+type HashAlgorithm string
+
+const (
+	// HashSHA256 hashes configuration with SHA256
+	HashSHA256 HashAlgorithm = "sha256"
+
+	// HashFNV hashes configuration with the 64 bit FNV-1a hash, which is
+	// cheaper to calculate than SHA256 but is only suitable for detecting
+	// changes, not for verifying the configuration
+	HashFNV HashAlgorithm = "fnv"
+)
+
+// ZeroChildrenPolicy determines what Wave does with workloads that reference
+// no children
+type ZeroChildrenPolicy string
+
+const (
+	// ZeroChildrenManage manages workloads without children like any other
+	// workload, recording the hash of the empty set of children
+	ZeroChildrenManage ZeroChildrenPolicy = "manage"
+
+	// ZeroChildrenSkip leaves workloads without children unmanaged, emitting
+	// an event explaining why. Workloads managed previously are cleaned up
+	ZeroChildrenSkip ZeroChildrenPolicy = "skip"
+)
+
+// ImagePullSecretsPolicy determines which of the Secrets a workload pulls its
+// images with are treated as its children
+type ImagePullSecretsPolicy string
+
+const (
+	// ImagePullSecretsIgnore treats no image pull Secrets as children
+	ImagePullSecretsIgnore ImagePullSecretsPolicy = "ignore"
+
+	// ImagePullSecretsPod treats the image pull Secrets listed in the
+	// workload's PodSpec as children
+	ImagePullSecretsPod ImagePullSecretsPolicy = "pod"
+
+	// ImagePullSecretsServiceAccount treats the image pull Secrets listed in
+	// the workload's PodSpec and those listed in its ServiceAccount as
+	// children
+	ImagePullSecretsServiceAccount ImagePullSecretsPolicy = "service-account"
+)
+
+// EmptySecretPolicy determines how Secrets read without any data are hashed
+type EmptySecretPolicy string
+
+const (
+	// EmptySecretHash hashes Secrets exactly as they are read, so a Secret
+	// read without its data changes the configuration hash
+	EmptySecretHash EmptySecretPolicy = "hash"
+
+	// EmptySecretKeepLast hashes a Secret read without any data with the data
+	// it was last read with, so that reads that intermittently hide a
+	// Secret's data, eg. due to encryption at rest, don't roll its workloads.
+	// Secrets that have never been read with data are hashed as empty
+	EmptySecretKeepLast EmptySecretPolicy = "keep-last"
+)
+
+// OwnerReferenceDeniedPolicy determines what Wave does when adding an
+// OwnerReference to a child is forbidden, eg. by an admission policy
+type OwnerReferenceDeniedPolicy string
+
+const (
+	// OwnerReferenceDeniedFail fails the reconcile of the workload
+	OwnerReferenceDeniedFail OwnerReferenceDeniedPolicy = "fail"
+
+	// OwnerReferenceDeniedDegrade hashes the child without an OwnerReference,
+	// emitting a Warning event on the workload. The child isn't garbage
+	// collected with the workload
+	OwnerReferenceDeniedDegrade OwnerReferenceDeniedPolicy = "degrade"
+)
+
+// OwnerReferenceMode determines the flags of the OwnerReferences Wave adds to
+// children
+type OwnerReferenceMode string
+
+const (
+	// OwnerReferenceBlocking adds OwnerReferences that aren't the controller
+	// of the child but block the foreground deletion of the workload until
+	// the child is deleted
+	OwnerReferenceBlocking OwnerReferenceMode = "blocking"
+
+	// OwnerReferenceNonBlocking adds OwnerReferences that neither are the
+	// controller of the child nor block the deletion of the workload. The
+	// child is still garbage collected once the workload is deleted
+	OwnerReferenceNonBlocking OwnerReferenceMode = "non-blocking"
+
+	// OwnerReferenceController adds OwnerReferences that are the controller
+	// of the child and block the deletion of the workload. Adding the
+	// OwnerReference fails if the child already has a controller
+	OwnerReferenceController OwnerReferenceMode = "controller"
+)
+
+// ChildReads determines where Wave reads the children it hashes from
+type ChildReads string
+
+const (
+	// ChildReadsCache reads children from the informer cache, which may lag
+	// behind the API server
+	ChildReadsCache ChildReads = "cache"
+
+	// ChildReadsLive reads children from the API server with the
+	// LiveReader, trading the cost of a request per child for hashing
+	// their latest contents
+	ChildReadsLive ChildReads = "live"
+)
+
+// Options contains the configuration of the Handler
+type Options struct {
+	// DaemonSetOnDeletePolicy is the OnDeletePolicy applied to DaemonSets
+	// using the OnDelete update strategy.
+	// Defaults to OnDeleteEvent.
+	DaemonSetOnDeletePolicy OnDeletePolicy
+
+	// RecordHashOnMetadataIfImmutable records the configuration hash on the
+	// metadata of workloads whose PodTemplate cannot be updated (eg. Jobs),
+	// rather than failing each reconcile
+	RecordHashOnMetadataIfImmutable bool
+
+	// CircuitBreakerThreshold is the number of consecutive reconcile failures
+	// after which a workload is only retried every CircuitBreakerBackoff.
+	// The circuit breaker is disabled if this is zero.
+	CircuitBreakerThreshold int
+
+	// CircuitBreakerBackoff is the interval at which workloads are retried while
+	// their circuit breaker is open.
+	// Defaults to 10 minutes.
+	CircuitBreakerBackoff time.Duration
+
+	// InstanceID identifies this Wave instance when multiple instances with
+	// different Options run in the same cluster.
+	// Workloads are claimed by the first instance to process them and are
+	// ignored by all other instances until the InstanceAnnotation is changed.
+	InstanceID string
+
+	// HashSalt is combined with the configuration hash of each workload, so
+	// that instances with different salts compute different hashes
+	HashSalt string
+
+	// GenerateNameStrategy is the GenerateNameStrategy applied to workloads
+	// created with a GenerateName.
+	// Defaults to GenerateNameTrack.
+	GenerateNameStrategy GenerateNameStrategy
+
+	// ManagePods enables the pod controller so that bare Pods with the
+	// RequiredAnnotation are managed by Wave
+	ManagePods bool
+
+	// MaxOwnerReferences is a soft cap on the number of OwnerReferences on a
+	// child. Once a child reaches the cap, no more OwnerReferences are added to
+	// it, though it is still included in the hash of the workloads referencing
+	// it.
+	// There is no cap if this is zero.
+	MaxOwnerReferences int
+
+	// ChildIndex records the children referenced by each workload as it is
+	// reconciled, so that changes to a child can be mapped to the workloads
+	// referencing it.
+	// The index is not maintained if this is nil.
+	ChildIndex *ChildIndex
+
+	// DisableConfigHash stops Wave from calculating and recording configuration
+	// hashes, so workloads are never rolled out by Wave.
+	// OwnerReferences and the finalizer are still managed as normal.
+	DisableConfigHash bool
+
+	// ExtraConfigMapPaths and ExtraSecretPaths are JSONPath expressions
+	// evaluated against each workload, yielding the names of additional
+	// ConfigMaps and Secrets it references.
+	// Each result is parsed as a comma separated list of names, each optionally
+	// prefixed by a namespace, as in the extra children annotations.
+	ExtraConfigMapPaths []string
+	ExtraSecretPaths    []string
+
+	// ChildRolloutEvents enables sending an event on each ConfigMap and Secret
+	// whose change triggered the rollout of a workload, naming the workload
+	ChildRolloutEvents bool
+
+	// RequiredAnnotationValues are the values of the RequiredAnnotation that
+	// enable Wave for a workload.
+	// Defaults to "true".
+	RequiredAnnotationValues []string
+
+	// UncachedReader reads children directly from the API server when they
+	// aren't found in the cache, eg. children referenced in another namespace
+	// when the cache is restricted to a single namespace.
+	// Children that aren't found are not read again if this is nil.
+	UncachedReader client.Reader
+
+	// FilterWorkloadUpdates stops Wave from reconciling workloads when they are
+	// updated without changing any of the fields that determine their children,
+	// eg. when only their image or replicas are changed.
+	// Changes to children still trigger a reconcile.
+	FilterWorkloadUpdates bool
+
+	// EnabledByDefault enables Wave for workloads that don't have the
+	// RequiredAnnotation, in namespaces that don't have it either
+	EnabledByDefault bool
+
+	// ChildVersionLabel is the key of a label on children whose value is
+	// included in the configuration hash, so that changing the label triggers
+	// a rollout even if the data of the child is unchanged
+	ChildVersionLabel string
+
+	// UpdateOrder determines whether the OwnerReferences on children or the
+	// configuration hash on the workload are updated first.
+	// Defaults to UpdateOrderOwnerReferencesFirst.
+	UpdateOrder UpdateOrder
+
+	// AdoptWithoutRollout records the configuration hash of workloads that
+	// Wave hasn't recorded a hash on before in the AdoptedConfigHashAnnotation
+	// on their metadata, so that adopting them doesn't change their generation
+	// or trigger a rollout.
+	// The hash is recorded in the PodTemplate once the configuration changes
+	AdoptWithoutRollout bool
+
+	// ExtraChildKinds are additional kinds of children that workloads may
+	// list in their ExtraChildrenAnnotation.
+	// Children of these kinds are watched and hashed like ConfigMaps and
+	// Secrets, but never receive OwnerReferences.
+	ExtraChildKinds []schema.GroupVersionKind
+
+	// WaveStatus enables writing the outcome of each reconcile to a WaveStatus
+	// in the workload's namespace.
+	// The WaveStatus CRD must be installed.
+	WaveStatus bool
+
+	// PauseConfigMap is a ConfigMap whose PauseAnnotation pauses rollouts.
+	// While paused, workloads whose configuration changes keep their existing
+	// hash until the annotation is removed.
+	// Rollouts are never paused if the Name is empty.
+	PauseConfigMap types.NamespacedName
+
+	// ReconcileTimeout is the maximum duration of a reconcile. Reconciles that
+	// take longer are abandoned with a Warning event and requeued with
+	// backoff.
+	// There is no timeout if this is zero.
+	ReconcileTimeout time.Duration
+
+	// PropagatedLabels are the keys of labels copied from each workload onto
+	// the companion objects Wave creates for it, such as its WaveStatus
+	PropagatedLabels []string
+
+	// HashResourceVersions includes the resourceVersion of each child in the
+	// configuration hash, so that any change to a child triggers a rollout,
+	// even if it only changes the child's metadata
+	HashResourceVersions bool
+
+	// ConfigMapPolicy and SecretPolicy determine how Wave manages the
+	// ConfigMaps and Secrets referenced by workloads.
+	// Both default to full management, where children are hashed and receive
+	// OwnerReferences.
+	ConfigMapPolicy ChildPolicy
+	SecretPolicy    ChildPolicy
+
+	// CheckChildFinalizers enables sending a Warning event on workloads
+	// referencing a child that carries the Wave finalizer, which suggests the
+	// child was mistakenly treated as a workload
+	CheckChildFinalizers bool
+
+	// ZeroChildrenPolicy is the ZeroChildrenPolicy applied to workloads that
+	// reference no children.
+	// Defaults to ZeroChildrenManage.
+	ZeroChildrenPolicy ZeroChildrenPolicy
+
+	// TLSRotationEvents enables sending a TLSRotated event, rather than a
+	// ConfigChanged event, on workloads rolled out because the data of a
+	// kubernetes.io/tls Secret changed, eg. when cert-manager renewed it
+	TLSRotationEvents bool
+
+	// ChildNamePrefix restricts the ConfigMaps and Secrets Wave manages to
+	// those whose names start with the prefix. Other children are neither
+	// hashed nor owned, eg. shared infrastructure ConfigMaps referenced
+	// incidentally.
+	// All children are managed if this is empty.
+	ChildNamePrefix string
+
+	// HashAlgorithm is the HashAlgorithm used to calculate the configuration
+	// hash of each workload.
+	// Changing it changes the hash of every workload, triggering a rollout.
+	// Defaults to HashSHA256.
+	HashAlgorithm HashAlgorithm
+
+	// PrioritizeSecrets services reconciles triggered by changes to Secrets
+	// ahead of those triggered by changes to ConfigMaps, so that rotated
+	// Secrets are rolled out first
+	PrioritizeSecrets bool
+
+	// DryRun calculates the configuration hash of each workload without
+	// recording it, sending a DryRun event describing the change Wave would
+	// make instead. OwnerReferences are not added to children either
+	DryRun bool
+
+	// MirroredAnnotations are the keys of annotations copied from each
+	// workload onto its PodTemplate whenever the configuration hash is
+	// recorded there, for applications that read them from their Pods.
+	// No other annotations of the workload are copied
+	MirroredAnnotations []string
+
+	// ImagePullSecretsPolicy is the ImagePullSecretsPolicy determining which
+	// image pull Secrets of each workload are hashed and owned, so that
+	// rotating them rolls the workload.
+	// Defaults to ImagePullSecretsIgnore.
+	ImagePullSecretsPolicy ImagePullSecretsPolicy
+
+	// HashHistoryLimit is the number of configuration hashes recorded in the
+	// HashHistoryAnnotation of each workload, for reference when rolling back.
+	// No history is recorded if this is zero
+	HashHistoryLimit int
+
+	// EmptySecretPolicy is the EmptySecretPolicy determining how Secrets read
+	// without any data are hashed.
+	// Defaults to EmptySecretHash.
+	EmptySecretPolicy EmptySecretPolicy
+
+	// AggregateEvents reports the notable actions of each reconcile, ie.
+	// configuration hash updates and added or removed OwnerReferences, in a
+	// single Reconciled event on the workload rather than an event each.
+	// Warnings are still sent as separate events
+	AggregateEvents bool
+
+	// RequiredAnnotation is the key of the annotation on workloads and
+	// namespaces that enables Wave, eg. to avoid collisions with other tools
+	// using the wave.pusher.com prefix.
+	// Defaults to the RequiredAnnotation constant.
+	RequiredAnnotation string
+
+	// ConfigHashAnnotation is the key of the annotation Wave records the
+	// configuration hash in.
+	// Defaults to the ConfigHashAnnotation constant.
+	ConfigHashAnnotation string
+
+	// Finalizer is the finalizer Wave adds to the workloads it manages.
+	// Defaults to the FinalizerString constant.
+	Finalizer string
+
+	// KindAnnotationKeys overrides the RequiredAnnotation,
+	// ConfigHashAnnotation, Finalizer and FreezeAnnotation for workloads of
+	// the kinds it contains, keyed by kind (eg. "StatefulSet"), for teams with
+	// divergent conventions.
+	// Each controller manages its kind with Options.ForKind
+	KindAnnotationKeys map[string]AnnotationKeys
+
+	// MerkleHash calculates configuration hashes as the root of a Merkle tree
+	// with a leaf for each child, so that only the children that changed are
+	// hashed again on each reconcile. Changing it rolls every workload
+	MerkleHash bool
+
+	// ChildReads determines whether children are read from the informer cache
+	// or from the API server with the LiveReader, which must be set to read
+	// them live.
+	// Defaults to ChildReadsCache.
+	ChildReads ChildReads
+
+	// OwnerReferenceDeniedPolicy is the OwnerReferenceDeniedPolicy applied
+	// when adding an OwnerReference to a child is forbidden. Removing an
+	// OwnerReference always fails the reconcile when forbidden, so that
+	// children are never garbage collected with a workload they no longer
+	// belong to.
+	// Defaults to OwnerReferenceDeniedFail.
+	OwnerReferenceDeniedPolicy OwnerReferenceDeniedPolicy
+
+	// ChildRetryBackoff is the initial interval after which a workload whose
+	// children transiently failed to fetch (eg. the API server was
+	// unavailable) is retried. The interval doubles, with jitter, on each
+	// consecutive failure up to the ChildRetryMaxBackoff.
+	// Children that failed permanently (eg. Wave is forbidden from reading
+	// them) are not retried until the workload or its children change.
+	// Disabled when zero, in which case the error is returned to the
+	// controller.
+	ChildRetryBackoff time.Duration
+
+	// ChildRetryMaxBackoff is the longest interval between retries of a
+	// workload whose children fail to fetch.
+	// Defaults to 5 minutes.
+	ChildRetryMaxBackoff time.Duration
+
+	// AllowedNamespaces restricts Wave to workloads in these namespaces, even
+	// though it watches every namespace. Workloads in all namespaces are
+	// reconciled when empty
+	AllowedNamespaces []string
+
+	// DeniedNamespaces are namespaces whose workloads are never reconciled,
+	// even if they are in AllowedNamespaces. Their workloads are skipped
+	// entirely, without a finalizer, a hash or OwnerReferences on their
+	// children
+	DeniedNamespaces []string
+
+	// TrackChildren records the children hashed for each workload in its
+	// TrackedChildrenAnnotation on every reconcile, so that operators can see
+	// which children Wave considers part of its configuration
+	TrackChildren bool
+
+	// ResyncPeriod is the interval after which each managed workload that
+	// reconciled successfully is requeued, so that its hash is recalculated
+	// as a safety net against missed watch events, without shortening the
+	// sync period of every informer.
+	// Workloads aren't requeued if this is zero
+	ResyncPeriod time.Duration
+
+	// DisableFinalizer stops Wave from adding the Finalizer to workloads, so
+	// that their deletion is never blocked by Wave. Hashes and OwnerReferences
+	// are still managed, and the Finalizer is removed from workloads Wave
+	// added it to previously as they are reconciled.
+	// Without the Finalizer, children owned by a deleted workload are garbage
+	// collected unless they have other owners
+	DisableFinalizer bool
+
+	// LogHashDiffs logs which children, and which of their keys, changed
+	// whenever the configuration hash of a workload changes, and names them
+	// in the ConfigChanged event. Changes are only known for workloads that
+	// were reconciled before since Wave started
+	LogHashDiffs bool
+
+	// OwnerReferenceMode is the OwnerReferenceMode of the OwnerReferences
+	// added to children. OwnerReferences added in another mode are updated
+	// when the workload is next reconciled.
+	// Defaults to OwnerReferenceBlocking.
+	OwnerReferenceMode OwnerReferenceMode
+
+	// MaxConcurrentReconciles is the number of workloads of each kind that are
+	// reconciled concurrently. A workload is never reconciled concurrently
+	// with itself.
+	// Defaults to 1.
+	MaxConcurrentReconciles int
+
+	// ManageRollouts enables the rollout controller so that Argo Rollouts with
+	// the RequiredAnnotation are managed by Wave.
+	// The controller is only started if the Rollout CRD is installed
+	ManageRollouts bool
+
+	// OwnerReferenceUpdateAttempts is the number of times Wave attempts to add
+	// an OwnerReference to a child when the update conflicts with another
+	// writer, eg. the reconcile of another workload sharing the child.
+	// Once the attempts are exhausted the workload is requeued.
+	// Defaults to 5.
+	OwnerReferenceUpdateAttempts int
+
+	// OwnerReferenceWarningThreshold is the number of OwnerReferences above
+	// which a warning event is recorded on a child when Wave adds an
+	// OwnerReference to it.
+	// No warning is recorded if this is zero.
+	OwnerReferenceWarningThreshold int
+
+	// ManageReplicaSets enables the replicaset controller so that ReplicaSets
+	// created directly, rather than by a Deployment or a Rollout, with the
+	// RequiredAnnotation are managed by Wave
+	ManageReplicaSets bool
+
+	// NamespaceDefaults lets the RequiredAnnotation on a workload's namespace
+	// choose whether Wave manages workloads without the annotation.
+	// Namespaces are watched, so Wave needs permission to get, list and watch
+	// them cluster wide
+	NamespaceDefaults bool
+
+	// LiveReader reads children directly from the API server when they are
+	// read live, with ChildReadsLive or while a force sync of the workload is
+	// pending, and when an update to a child conflicts.
+	// Children are always read from the cache if this is nil
+	LiveReader client.Reader
+
+	// FreezeAnnotation is the key of the annotation that freezes the
+	// configuration hash recorded on a workload while set to "true".
+	// Defaults to the FreezeAnnotation constant.
+	FreezeAnnotation string
+}
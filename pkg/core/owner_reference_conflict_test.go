@@ -0,0 +1,143 @@
+/*
+Copyright 2018 Pusher Ltd.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package core
+
+import (
+	"context"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/pusher/wave/test/utils"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// conflictingClient simulates another writer updating a ConfigMap between
+// Wave reading and updating it. The first conflicts updates of the ConfigMap
+// fail, each after the other writer adds its own OwnerReference
+type conflictingClient struct {
+	client.Client
+	latest    *corev1.ConfigMap
+	conflicts int
+	updates   int
+}
+
+func (c *conflictingClient) Get(ctx context.Context, key types.NamespacedName, obj runtime.Object) error {
+	c.latest.DeepCopyInto(obj.(*corev1.ConfigMap))
+	return nil
+}
+
+func (c *conflictingClient) Update(ctx context.Context, obj runtime.Object) error {
+	c.updates++
+	cm := obj.(*corev1.ConfigMap)
+	if cm.GetResourceVersion() != c.latest.GetResourceVersion() {
+		return errors.NewConflict(schema.GroupResource{Resource: "configmaps"}, cm.GetName(), nil)
+	}
+	if c.conflicts > 0 {
+		c.conflicts--
+		c.latest.SetOwnerReferences(append(c.latest.GetOwnerReferences(), metav1.OwnerReference{
+			APIVersion: "apps/v1",
+			Kind:       "Deployment",
+			Name:       "other",
+			UID:        types.UID("other"),
+		}))
+		c.latest.SetResourceVersion(c.latest.GetResourceVersion() + "0")
+		return errors.NewConflict(schema.GroupResource{Resource: "configmaps"}, cm.GetName(), nil)
+	}
+	cm.DeepCopyInto(c.latest)
+	return nil
+}
+
+var _ = Describe("Wave owner reference conflict Suite", func() {
+	var c *conflictingClient
+	var h *Handler
+	var recorder *record.FakeRecorder
+	var deployment *appsv1.Deployment
+	var cm *corev1.ConfigMap
+
+	BeforeEach(func() {
+		deployment = utils.ExampleDeployment.DeepCopy()
+		deployment.SetUID(types.UID("deployment"))
+
+		cm = utils.ExampleConfigMap1.DeepCopy()
+		cm.SetResourceVersion("1")
+		c = &conflictingClient{latest: cm.DeepCopy()}
+		recorder = record.NewFakeRecorder(100)
+	})
+
+	Context("When updating the child conflicts", func() {
+		BeforeEach(func() {
+			c.conflicts = 2
+			h = NewHandler(c, recorder, Options{})
+		})
+
+		It("Retries against the latest version of the child", func() {
+			Expect(h.updateOwnerReference(deployment, cm)).To(Succeed())
+			Expect(c.updates).To(Equal(3))
+
+			refs := c.latest.GetOwnerReferences()
+			Expect(refs).To(HaveLen(3))
+			Expect(refs).To(ContainElement(utils.GetOwnerRef(deployment)))
+		})
+
+		It("Sends a single event for adding the OwnerReference", func() {
+			Expect(h.updateOwnerReference(deployment, cm)).To(Succeed())
+			Expect(drainEvents(recorder)).To(ConsistOf("Normal AddWatch Adding watch for ConfigMap example1"))
+		})
+	})
+
+	Context("When updating the child keeps conflicting", func() {
+		BeforeEach(func() {
+			c.conflicts = 10
+			h = NewHandler(c, recorder, Options{OwnerReferenceUpdateAttempts: 3})
+		})
+
+		It("Returns the conflict once the attempts are exhausted", func() {
+			err := h.updateOwnerReference(deployment, cm)
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(ContainSubstring("error updating child"))
+			Expect(c.updates).To(Equal(3))
+			Expect(c.latest.GetOwnerReferences()).NotTo(ContainElement(utils.GetOwnerRef(deployment)))
+		})
+	})
+
+	Context("With an OwnerReference warning threshold", func() {
+		BeforeEach(func() {
+			h = NewHandler(c, recorder, Options{OwnerReferenceWarningThreshold: 1})
+		})
+
+		It("Doesn't warn while the child is within the threshold", func() {
+			Expect(h.updateOwnerReference(deployment, cm)).To(Succeed())
+			Expect(drainEvents(recorder)).NotTo(ContainElement(ContainSubstring("OwnerReferenceThreshold")))
+		})
+
+		It("Warns once the child exceeds the threshold", func() {
+			c.conflicts = 1
+			Expect(h.updateOwnerReference(deployment, cm)).To(Succeed())
+			Expect(drainEvents(recorder)).To(ContainElement(
+				"Warning OwnerReferenceThreshold ConfigMap example1 has 2 OwnerReferences, more than the threshold of 1",
+			))
+		})
+	})
+})
@@ -0,0 +1,126 @@
+/*
+Copyright 2018 Pusher Ltd.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package core
+
+import (
+	"sync"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/pusher/wave/test/utils"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/manager"
+)
+
+var _ = Describe("Wave OwnerReference mode Suite", func() {
+	var c client.Client
+	var m utils.Matcher
+	var recorder record.EventRecorder
+	var deployment *appsv1.Deployment
+	var cm1 *corev1.ConfigMap
+	var mgrStopped *sync.WaitGroup
+	var stopMgr chan struct{}
+
+	const timeout = time.Second * 5
+
+	// addOwnerReference adds the Deployment's OwnerReference to the ConfigMap
+	// in the mode given and returns the OwnerReferences of the ConfigMap
+	var addOwnerReference = func(mode OwnerReferenceMode) []metav1.OwnerReference {
+		h := NewHandler(c, recorder, Options{OwnerReferenceMode: mode})
+		m.Get(cm1, timeout).Should(Succeed())
+		Expect(h.updateOwnerReference(deployment, cm1)).To(Succeed())
+		m.Eventually(cm1, timeout).Should(utils.WithOwnerReferences(ContainElement(h.ownerReference(deployment))))
+		return cm1.GetOwnerReferences()
+	}
+
+	BeforeEach(func() {
+		mgr, err := manager.New(cfg, manager.Options{})
+		Expect(err).NotTo(HaveOccurred())
+		c = mgr.GetClient()
+		m = utils.Matcher{Client: c}
+		recorder = mgr.GetRecorder("wave")
+
+		stopMgr, mgrStopped = StartTestManager(mgr)
+
+		cm1 = utils.ExampleConfigMap1.DeepCopy()
+		m.Create(cm1).Should(Succeed())
+		m.Get(cm1, timeout).Should(Succeed())
+
+		deployment = utils.ExampleDeployment.DeepCopy()
+		m.Create(deployment).Should(Succeed())
+		m.Get(deployment, timeout).Should(Succeed())
+	})
+
+	AfterEach(func() {
+		close(stopMgr)
+		mgrStopped.Wait()
+
+		utils.DeleteAll(cfg, timeout,
+			&appsv1.DeploymentList{},
+			&corev1.ConfigMapList{},
+			&corev1.EventList{},
+		)
+	})
+
+	It("Adds a blocking, non-controller OwnerReference by default", func() {
+		refs := addOwnerReference("")
+		Expect(refs).To(HaveLen(1))
+		Expect(*refs[0].Controller).To(BeFalse())
+		Expect(*refs[0].BlockOwnerDeletion).To(BeTrue())
+	})
+
+	It("Adds a non-blocking, non-controller OwnerReference in the non-blocking mode", func() {
+		refs := addOwnerReference(OwnerReferenceNonBlocking)
+		Expect(refs).To(HaveLen(1))
+		Expect(*refs[0].Controller).To(BeFalse())
+		Expect(*refs[0].BlockOwnerDeletion).To(BeFalse())
+	})
+
+	It("Adds a blocking, controller OwnerReference in the controller mode", func() {
+		refs := addOwnerReference(OwnerReferenceController)
+		Expect(refs).To(HaveLen(1))
+		Expect(*refs[0].Controller).To(BeTrue())
+		Expect(*refs[0].BlockOwnerDeletion).To(BeTrue())
+	})
+
+	It("Replaces an OwnerReference added in another mode", func() {
+		addOwnerReference(OwnerReferenceBlocking)
+		refs := addOwnerReference(OwnerReferenceNonBlocking)
+		Expect(refs).To(HaveLen(1))
+		Expect(refs[0].UID).To(Equal(deployment.GetUID()))
+		Expect(*refs[0].BlockOwnerDeletion).To(BeFalse())
+	})
+
+	It("Doesn't replace the OwnerReferences of other owners", func() {
+		other := utils.GetOwnerRef(deployment)
+		other.Name = "other"
+		other.UID = "other-uid"
+		m.Get(cm1, timeout).Should(Succeed())
+		cm1.SetOwnerReferences([]metav1.OwnerReference{other})
+		m.Update(cm1).Should(Succeed())
+		m.Eventually(cm1, timeout).Should(utils.WithOwnerReferences(ConsistOf(other)))
+
+		refs := addOwnerReference(OwnerReferenceNonBlocking)
+		Expect(refs).To(HaveLen(2))
+		Expect(refs).To(ContainElement(other))
+	})
+})
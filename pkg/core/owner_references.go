@@ -22,26 +22,37 @@ import (
 	"reflect"
 	"strings"
 
+	argov1alpha1 "github.com/pusher/wave/pkg/apis/argoproj/v1alpha1"
 	appsv1 "k8s.io/api/apps/v1"
+	batchv1 "k8s.io/api/batch/v1"
 	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/util/retry"
+	logf "sigs.k8s.io/controller-runtime/pkg/runtime/log"
 )
 
 // removeOwnerReferences iterates over a list of children and removes the owner
 // reference from the child before updating it
-func (h *Handler) removeOwnerReferences(obj *appsv1.Deployment, children []Object) error {
+func (h *Handler) removeOwnerReferences(obj Object, children []Object) error {
 	for _, child := range children {
 		// Filter the existing ownerReferences
 		ownerRefs := []metav1.OwnerReference{}
 		for _, ref := range child.GetOwnerReferences() {
-			if ref.UID != obj.UID {
+			if ref.UID != obj.GetUID() {
 				ownerRefs = append(ownerRefs, ref)
 			}
 		}
 
 		// Compare the ownerRefs and update if they have changed
 		if !reflect.DeepEqual(ownerRefs, child.GetOwnerReferences()) {
-			h.recorder.Eventf(child, corev1.EventTypeNormal, "RemoveWatch", "Removing watch for %s %s", kindOf(child), child.GetName())
+			name := kindOf(child) + " " + child.GetName()
+			if !h.summarize(obj, func(s *reconcileSummary) { s.removed = append(s.removed, name) }) {
+				h.recorder.Eventf(child, corev1.EventTypeNormal, "RemoveWatch", "Removing watch for %s", name)
+			}
 			child.SetOwnerReferences(ownerRefs)
 			err := h.Update(context.TODO(), child)
 			if err != nil {
@@ -54,11 +65,27 @@ func (h *Handler) removeOwnerReferences(obj *appsv1.Deployment, children []Objec
 
 // updateOwnerReferences determines which children need to have their
 // OwnerReferences added/updated and which need to have their OwnerReferences
-// removed and then performs all updates
-func (h *Handler) updateOwnerReferences(owner *appsv1.Deployment, existing, current []Object) error {
+// removed and then performs all updates.
+// In dry run mode children are left untouched and the updates are reported
+// instead
+func (h *Handler) updateOwnerReferences(owner Object, existing, current []Object) error {
+	// OwnerReferences cannot point across namespaces, so only children in the
+	// owner's namespace can be owned
+	owned := []Object{}
+	for _, child := range current {
+		if child.GetNamespace() == owner.GetNamespace() {
+			owned = append(owned, child)
+		}
+	}
+
+	if h.options.DryRun {
+		h.reportDryRunOwnerReferences(owner, owned, getOrphans(existing, current))
+		return nil
+	}
+
 	// Add an owner reference to each child object
 	errChan := make(chan error)
-	for _, obj := range current {
+	for _, obj := range owned {
 		go func(child Object) {
 			errChan <- h.updateOwnerReference(owner, child)
 		}(obj)
@@ -66,7 +93,7 @@ func (h *Handler) updateOwnerReferences(owner *appsv1.Deployment, existing, curr
 
 	// Return any errors encountered updating the child objects
 	errs := []string{}
-	for range current {
+	for range owned {
 		err := <-errChan
 		if err != nil {
 			errs = append(errs, err.Error())
@@ -87,27 +114,105 @@ func (h *Handler) updateOwnerReferences(owner *appsv1.Deployment, existing, curr
 }
 
 // updateOwnerReference ensures that the child object has an OwnerReference
-// pointing to the owner
-func (h *Handler) updateOwnerReference(owner *appsv1.Deployment, child Object) error {
-	ownerRef := getOwnerReference(owner)
-	for _, ref := range child.GetOwnerReferences() {
-		// Owner Reference already exists, do nothing
-		if reflect.DeepEqual(ref, ownerRef) {
-			return nil
+// pointing to the owner.
+// Shared children are updated concurrently by the reconciles of each of their
+// owners, so updates that conflict are retried against the latest version of
+// the child, up to OwnerReferenceUpdateAttempts times before the conflict is
+// returned and the owner requeued
+func (h *Handler) updateOwnerReference(owner Object, child Object) error {
+	attempt := 0
+	err := retry.RetryOnConflict(h.ownerReferenceBackoff(), func() error {
+		attempt++
+		if attempt > 1 {
+			logf.Log.WithName("wave").V(1).Info("Conflict updating child, retrying", "namespace", child.GetNamespace(), "name", child.GetName(), "attempt", attempt)
+			err := h.getLatestChild(child)
+			if err != nil {
+				return err
+			}
+		}
+		return h.addOwnerReference(owner, child)
+	})
+	if err != nil {
+		return fmt.Errorf("error updating child: %v", err)
+	}
+	return nil
+}
+
+// addOwnerReference adds or replaces the OwnerReference pointing to the owner
+// on the child and updates the child if needed.
+// Errors updating the child are returned as they are, so that conflicts can
+// be retried
+func (h *Handler) addOwnerReference(owner Object, child Object) error {
+	// Owner Reference already exists, do nothing
+	ownerRef := h.ownerReference(owner)
+	if hasOwnerReference(child, ownerRef) {
+		return nil
+	}
+
+	// An OwnerReference added in another OwnerReferenceMode is replaced
+	for i, ref := range child.GetOwnerReferences() {
+		if ref.UID == ownerRef.UID {
+			ownerRefs := append([]metav1.OwnerReference{}, child.GetOwnerReferences()...)
+			ownerRefs[i] = ownerRef
+			child.SetOwnerReferences(ownerRefs)
+			return h.Update(context.TODO(), child)
 		}
 	}
 
+	// Don't let widely shared children accumulate an unbounded number of
+	// OwnerReferences, the child is still included in the owner's hash
+	if limit := h.options.MaxOwnerReferences; limit > 0 && len(child.GetOwnerReferences()) >= limit {
+		h.recorder.Eventf(owner, corev1.EventTypeWarning, "OwnerReferenceLimit", "%s %s already has %d OwnerReferences, not adding a watch for %s %s", kindOf(child), child.GetName(), len(child.GetOwnerReferences()), kindOf(owner), owner.GetName())
+		return nil
+	}
+
 	// Append the new OwnerReference and update the child
-	h.recorder.Eventf(child, corev1.EventTypeNormal, "AddWatch", "Adding watch for %s %s", kindOf(child), child.GetName())
-	ownerRefs := append(child.GetOwnerReferences(), ownerRef)
+	ownerRefs := append(append([]metav1.OwnerReference{}, child.GetOwnerReferences()...), ownerRef)
 	child.SetOwnerReferences(ownerRefs)
 	err := h.Update(context.TODO(), child)
+
+	// If the OwnerReference is forbidden and the OwnerReferenceDeniedPolicy
+	// degrades, the child is still hashed but not garbage collected
+	if err != nil && errors.IsForbidden(err) && h.options.OwnerReferenceDeniedPolicy == OwnerReferenceDeniedDegrade {
+		h.recorder.Eventf(owner, corev1.EventTypeWarning, "OwnerReferenceDenied", "Unable to add an OwnerReference to %s %s, it won't be garbage collected with %s %s: %v", kindOf(child), child.GetName(), kindOf(owner), owner.GetName(), err)
+		return nil
+	}
 	if err != nil {
-		return fmt.Errorf("error updating child: %v", err)
+		return err
+	}
+
+	name := kindOf(child) + " " + child.GetName()
+	if !h.summarize(owner, func(s *reconcileSummary) { s.added = append(s.added, name) }) {
+		h.recorder.Eventf(child, corev1.EventTypeNormal, "AddWatch", "Adding watch for %s", name)
+	}
+
+	// Warn before the OwnerReferences of a widely shared child become a
+	// source of update conflicts and bloat
+	if threshold := h.options.OwnerReferenceWarningThreshold; threshold > 0 && len(ownerRefs) > threshold {
+		h.recorder.Eventf(child, corev1.EventTypeWarning, "OwnerReferenceThreshold", "%s has %d OwnerReferences, more than the threshold of %d", name, len(ownerRefs), threshold)
 	}
 	return nil
 }
 
+// ownerReferenceBackoff returns the backoff between attempts to update the
+// OwnerReferences of a child
+func (h *Handler) ownerReferenceBackoff() wait.Backoff {
+	backoff := retry.DefaultRetry
+	backoff.Steps = h.options.OwnerReferenceUpdateAttempts
+	return backoff
+}
+
+// getLatestChild reads the latest version of the child into it, from the
+// LiveReader if one is configured as the cache may not have caught up with the
+// update that conflicted
+func (h *Handler) getLatestChild(child Object) error {
+	key := types.NamespacedName{Namespace: child.GetNamespace(), Name: child.GetName()}
+	if h.options.LiveReader != nil {
+		return h.options.LiveReader.Get(context.TODO(), key, child)
+	}
+	return h.Get(context.TODO(), key, child)
+}
+
 // getOrphans creates a slice of orphaned child objects that need their
 // OwnerReferences removing
 func getOrphans(existing, current []Object) []Object {
@@ -121,12 +226,12 @@ func getOrphans(existing, current []Object) []Object {
 }
 
 // getOwnerReference constructs an OwnerReference pointing to the object given
-func getOwnerReference(obj *appsv1.Deployment) metav1.OwnerReference {
+func getOwnerReference(obj Object) metav1.OwnerReference {
 	t := true
 	f := false
 	return metav1.OwnerReference{
-		APIVersion:         "apps/v1",
-		Kind:               "Deployment",
+		APIVersion:         apiVersionOf(obj),
+		Kind:               kindOf(obj),
 		Name:               obj.GetName(),
 		UID:                obj.GetUID(),
 		BlockOwnerDeletion: &t,
@@ -134,6 +239,31 @@ func getOwnerReference(obj *appsv1.Deployment) metav1.OwnerReference {
 	}
 }
 
+// ownerReference constructs the OwnerReference added to the children of the
+// object given, with the flags of the configured OwnerReferenceMode
+func (h *Handler) ownerReference(obj Object) metav1.OwnerReference {
+	ref := getOwnerReference(obj)
+	switch h.options.OwnerReferenceMode {
+	case OwnerReferenceNonBlocking:
+		f := false
+		ref.BlockOwnerDeletion = &f
+	case OwnerReferenceController:
+		t := true
+		ref.Controller = &t
+	}
+	return ref
+}
+
+// hasOwnerReference checks whether the child already has the OwnerReference
+func hasOwnerReference(child Object, ownerRef metav1.OwnerReference) bool {
+	for _, ref := range child.GetOwnerReferences() {
+		if reflect.DeepEqual(ref, ownerRef) {
+			return true
+		}
+	}
+	return false
+}
+
 // isIn checks whether a child object exists within a slice of objects
 func isIn(list []Object, child Object) bool {
 	for _, obj := range list {
@@ -146,12 +276,44 @@ func isIn(list []Object, child Object) bool {
 
 // kindOf returns the Kind of the given object as a string
 func kindOf(obj Object) string {
-	switch obj.(type) {
+	switch o := obj.(type) {
 	case *corev1.ConfigMap:
 		return "ConfigMap"
 	case *corev1.Secret:
 		return "Secret"
+	case *corev1.ServiceAccount:
+		return "ServiceAccount"
+	case *appsv1.Deployment:
+		return "Deployment"
+	case *appsv1.DaemonSet:
+		return "DaemonSet"
+	case *appsv1.StatefulSet:
+		return "StatefulSet"
+	case *appsv1.ReplicaSet:
+		return "ReplicaSet"
+	case *batchv1.Job:
+		return "Job"
+	case *corev1.Pod:
+		return "Pod"
+	case *argov1alpha1.Rollout:
+		return "Rollout"
+	case *unstructured.Unstructured:
+		return o.GetKind()
 	default:
 		return "Unknown"
 	}
 }
+
+// apiVersionOf returns the APIVersion of the given workload as a string
+func apiVersionOf(obj Object) string {
+	switch obj.(type) {
+	case *batchv1.Job:
+		return "batch/v1"
+	case *corev1.Pod:
+		return "v1"
+	case *argov1alpha1.Rollout:
+		return "argoproj.io/v1alpha1"
+	default:
+		return "apps/v1"
+	}
+}
@@ -17,6 +17,7 @@ limitations under the License.
 package core
 
 import (
+	"fmt"
 	"sync"
 	"time"
 
@@ -51,7 +52,7 @@ var _ = Describe("Wave owner references Suite", func() {
 		mgr, err := manager.New(cfg, manager.Options{})
 		Expect(err).NotTo(HaveOccurred())
 		c = mgr.GetClient()
-		h = NewHandler(c, mgr.GetRecorder("wave"))
+		h = NewHandler(c, mgr.GetRecorder("wave"), Options{})
 		m = utils.Matcher{Client: c}
 
 		// Create some configmaps and secrets
@@ -215,6 +216,69 @@ var _ = Describe("Wave owner references Suite", func() {
 		})
 	})
 
+	Context("updateOwnerReference with an OwnerReference limit", func() {
+		const limit = 3
+		var deployments []*appsv1.Deployment
+
+		BeforeEach(func() {
+			h = NewHandler(c, h.recorder, Options{MaxOwnerReferences: limit})
+
+			// Create more Deployments referencing the children than the limit
+			deployments = []*appsv1.Deployment{}
+			for i := 0; i < limit+1; i++ {
+				d := utils.ExampleDeployment.DeepCopy()
+				d.SetName(fmt.Sprintf("limited-%d", i))
+				d.SetAnnotations(map[string]string{RequiredAnnotation: "true"})
+				m.Create(d).Should(Succeed())
+				m.Get(d, timeout).Should(Succeed())
+				deployments = append(deployments, d)
+			}
+
+			for _, d := range deployments {
+				// Wait for the cache to see the previous OwnerReferences
+				Eventually(func() error {
+					m.Get(d, timeout).Should(Succeed())
+					_, err := h.HandleDeployment(d)
+					return err
+				}, timeout).Should(Succeed())
+			}
+		})
+
+		AfterEach(func() {
+			// Make sure to delete the finalizers so the Deployments can be deleted
+			for _, d := range deployments {
+				m.Get(d, timeout).Should(Succeed())
+				d.SetFinalizers([]string{})
+				m.Update(d).Should(Succeed())
+			}
+		})
+
+		It("doesn't add more OwnerReferences than the limit", func() {
+			m.Eventually(cm1, timeout).Should(utils.WithOwnerReferences(HaveLen(limit)))
+			m.Consistently(cm1, consistentlyTimeout).Should(utils.WithOwnerReferences(HaveLen(limit)))
+		})
+
+		It("doesn't add an OwnerReference for the workload over the limit", func() {
+			m.Consistently(cm1, consistentlyTimeout).ShouldNot(utils.WithOwnerReferences(ContainElement(utils.GetOwnerRef(deployments[limit]))))
+		})
+
+		It("still hashes the children of the workload over the limit", func() {
+			m.Eventually(deployments[0], timeout).Should(utils.WithPodTemplateAnnotations(HaveKey(ConfigHashAnnotation)))
+			hash := deployments[0].Spec.Template.GetAnnotations()[ConfigHashAnnotation]
+			m.Eventually(deployments[limit], timeout).Should(utils.WithPodTemplateAnnotations(HaveKeyWithValue(ConfigHashAnnotation, hash)))
+		})
+
+		It("sends a warning event for the workload over the limit", func() {
+			events := &corev1.EventList{}
+			eventMessage := func(event *corev1.Event) string {
+				return event.Message
+			}
+
+			limitMessage := fmt.Sprintf("ConfigMap example1 already has %d OwnerReferences, not adding a watch for Deployment limited-%d", limit, limit)
+			m.Eventually(events, timeout).Should(utils.WithItems(ContainElement(WithTransform(eventMessage, Equal(limitMessage)))))
+		})
+	})
+
 	Context("getOrphans", func() {
 		It("returns an empty list when current and existing match", func() {
 			current := []Object{cm1, cm2, s1, s2}
@@ -0,0 +1,44 @@
+/*
+Copyright 2018 Pusher Ltd.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package core
+
+import (
+	appsv1 "k8s.io/api/apps/v1"
+)
+
+// completePartition sets the partition of a StatefulSet requesting completion
+// through the CompletePartitionAnnotation to 0 and removes the annotation.
+// Other objects are left untouched
+func completePartition(obj Object) {
+	ss, ok := obj.(*appsv1.StatefulSet)
+	if !ok {
+		return
+	}
+	annotations := ss.GetAnnotations()
+	if annotations[CompletePartitionAnnotation] != "true" {
+		return
+	}
+
+	rollingUpdate := ss.Spec.UpdateStrategy.RollingUpdate
+	if rollingUpdate != nil && rollingUpdate.Partition != nil {
+		partition := int32(0)
+		rollingUpdate.Partition = &partition
+	}
+
+	delete(annotations, CompletePartitionAnnotation)
+	ss.SetAnnotations(annotations)
+}
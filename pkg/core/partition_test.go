@@ -0,0 +1,83 @@
+/*
+Copyright 2018 Pusher Ltd.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package core
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/pusher/wave/test/utils"
+	appsv1 "k8s.io/api/apps/v1"
+)
+
+var _ = Describe("Wave partition Suite", func() {
+	var statefulset *appsv1.StatefulSet
+
+	BeforeEach(func() {
+		partition := int32(2)
+		statefulset = utils.ExampleStatefulSet.DeepCopy()
+		statefulset.Spec.UpdateStrategy = appsv1.StatefulSetUpdateStrategy{
+			Type: appsv1.RollingUpdateStatefulSetStrategyType,
+			RollingUpdate: &appsv1.RollingUpdateStatefulSetStrategy{
+				Partition: &partition,
+			},
+		}
+	})
+
+	Context("completePartition", func() {
+		It("sets the partition to 0 and removes the annotation when completion is requested", func() {
+			statefulset.SetAnnotations(map[string]string{
+				RequiredAnnotation:          "true",
+				CompletePartitionAnnotation: "true",
+			})
+			completePartition(statefulset)
+
+			Expect(*statefulset.Spec.UpdateStrategy.RollingUpdate.Partition).To(Equal(int32(0)))
+			Expect(statefulset.GetAnnotations()).NotTo(HaveKey(CompletePartitionAnnotation))
+			Expect(statefulset.GetAnnotations()).To(HaveKey(RequiredAnnotation))
+		})
+
+		It("leaves the partition when completion is not requested", func() {
+			completePartition(statefulset)
+			Expect(*statefulset.Spec.UpdateStrategy.RollingUpdate.Partition).To(Equal(int32(2)))
+		})
+
+		It("leaves the partition and the annotation when the annotation is not true", func() {
+			statefulset.SetAnnotations(map[string]string{CompletePartitionAnnotation: "false"})
+			completePartition(statefulset)
+
+			Expect(*statefulset.Spec.UpdateStrategy.RollingUpdate.Partition).To(Equal(int32(2)))
+			Expect(statefulset.GetAnnotations()).To(HaveKeyWithValue(CompletePartitionAnnotation, "false"))
+		})
+
+		It("removes the annotation from a StatefulSet without a partition", func() {
+			statefulset.Spec.UpdateStrategy = appsv1.StatefulSetUpdateStrategy{}
+			statefulset.SetAnnotations(map[string]string{CompletePartitionAnnotation: "true"})
+			completePartition(statefulset)
+
+			Expect(statefulset.Spec.UpdateStrategy.RollingUpdate).To(BeNil())
+			Expect(statefulset.GetAnnotations()).NotTo(HaveKey(CompletePartitionAnnotation))
+		})
+
+		It("ignores other workloads", func() {
+			deployment := utils.ExampleDeployment.DeepCopy()
+			deployment.SetAnnotations(map[string]string{CompletePartitionAnnotation: "true"})
+			completePartition(deployment)
+
+			Expect(deployment.GetAnnotations()).To(HaveKey(CompletePartitionAnnotation))
+		})
+	})
+})
@@ -0,0 +1,57 @@
+/*
+Copyright 2018 Pusher Ltd.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package core
+
+import (
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// rolloutsPaused returns true if the PauseConfigMap exists and its
+// PauseAnnotation is set to "true".
+// Rollouts are never paused if no PauseConfigMap is configured
+func (h *Handler) rolloutsPaused() (bool, error) {
+	if h.options.PauseConfigMap.Name == "" {
+		return false, nil
+	}
+
+	result := h.getConfigMap(h.options.PauseConfigMap.Namespace, h.options.PauseConfigMap.Name)
+	if result.err != nil && errors.IsNotFound(result.err) {
+		return false, nil
+	}
+	if result.err != nil {
+		return false, result.err
+	}
+	return result.obj.GetAnnotations()[PauseAnnotation] == "true", nil
+}
+
+// withPauseConfigMap returns the set of ConfigMaps indexed for a workload.
+// Every workload indexes the PauseConfigMap, without hashing it, so that
+// workloads whose hash update was deferred are reconciled once rollouts are
+// resumed
+func (h *Handler) withPauseConfigMap(configMaps map[types.NamespacedName]struct{}) map[types.NamespacedName]struct{} {
+	if h.options.PauseConfigMap.Name == "" {
+		return configMaps
+	}
+
+	indexed := make(map[types.NamespacedName]struct{}, len(configMaps)+1)
+	for key := range configMaps {
+		indexed[key] = struct{}{}
+	}
+	indexed[h.options.PauseConfigMap] = struct{}{}
+	return indexed
+}
@@ -0,0 +1,103 @@
+/*
+Copyright 2018 Pusher Ltd.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package core
+
+import (
+	"encoding/json"
+
+	argov1alpha1 "github.com/pusher/wave/pkg/apis/argoproj/v1alpha1"
+	appsv1 "k8s.io/api/apps/v1"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+)
+
+// getPodTemplate returns a pointer to the PodTemplate of the given object so
+// that it can be read or modified in place.
+// Returns nil if the object is not a known workload type or has no PodTemplate
+// of its own
+func getPodTemplate(obj Object) *corev1.PodTemplateSpec {
+	switch o := obj.(type) {
+	case *appsv1.Deployment:
+		return &o.Spec.Template
+	case *appsv1.DaemonSet:
+		return &o.Spec.Template
+	case *appsv1.StatefulSet:
+		return &o.Spec.Template
+	case *appsv1.ReplicaSet:
+		return &o.Spec.Template
+	case *batchv1.Job:
+		return &o.Spec.Template
+	case *argov1alpha1.Rollout:
+		// Rollouts referencing a workload have no PodTemplate of their own
+		if referencesWorkload(o) {
+			return nil
+		}
+		return &o.Spec.Template
+	default:
+		return nil
+	}
+}
+
+// referencesWorkload returns true if the object is a Rollout referencing a
+// workload (spec.workloadRef) for its PodTemplate rather than having its own
+func referencesWorkload(obj Object) bool {
+	rollout, ok := obj.(*argov1alpha1.Rollout)
+	if !ok {
+		return false
+	}
+	_, ok = rollout.Spec.Fields["workloadRef"]
+	return ok
+}
+
+// workloadRefKind returns the kind of the workload a Rollout references, or
+// "workload" if it can't be determined
+func workloadRefKind(obj Object) string {
+	ref := struct {
+		Kind string `json:"kind"`
+	}{}
+	if rollout, ok := obj.(*argov1alpha1.Rollout); ok {
+		if err := json.Unmarshal(rollout.Spec.Fields["workloadRef"], &ref); err == nil && ref.Kind != "" {
+			return ref.Kind
+		}
+	}
+	return "workload"
+}
+
+// getPodSpec returns a pointer to the PodSpec of the given object.
+// For workloads this is the spec of their PodTemplate, for bare Pods it is the
+// Pod's own spec.
+// Rollouts referencing a workload have an empty PodSpec, as they reference no
+// children of their own.
+// Returns nil if the object is not a known workload type
+func getPodSpec(obj Object) *corev1.PodSpec {
+	if pod, ok := obj.(*corev1.Pod); ok {
+		return &pod.Spec
+	}
+	if podTemplate := getPodTemplate(obj); podTemplate != nil {
+		return &podTemplate.Spec
+	}
+	if _, ok := obj.(*argov1alpha1.Rollout); ok {
+		return &corev1.PodSpec{}
+	}
+	return nil
+}
+
+// getAllContainers returns the init containers of the PodSpec followed by its
+// regular containers, for discovering the children either may reference
+func getAllContainers(podSpec *corev1.PodSpec) []corev1.Container {
+	return append(append([]corev1.Container{}, podSpec.InitContainers...), podSpec.Containers...)
+}
@@ -0,0 +1,174 @@
+/*
+Copyright 2018 Pusher Ltd.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package core
+
+import (
+	"reflect"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+)
+
+// WorkloadUpdatePredicate returns the Predicate applied to the watch on
+// workloads.
+// If FilterWorkloadUpdates is set, updates that don't change any of the fields
+// that determine the workload's children or how Wave handles it are filtered
+// out, so that eg. changing the image or replicas of a workload doesn't cause
+// a reconcile.
+// Periodic resyncs, which don't change the resourceVersion, and updates to the
+// PokeAnnotation, which is one of the annotations compared, are never filtered
+func WorkloadUpdatePredicate(opts Options) predicate.Predicate {
+	if !opts.FilterWorkloadUpdates {
+		return predicate.Funcs{}
+	}
+	return predicate.Funcs{
+		UpdateFunc: func(e event.UpdateEvent) bool {
+			oldObj, oldOk := e.ObjectOld.(Object)
+			newObj, newOk := e.ObjectNew.(Object)
+			if !oldOk || !newOk {
+				return true
+			}
+			if oldObj.GetResourceVersion() == newObj.GetResourceVersion() {
+				return true
+			}
+			// Updates are never filtered if the extra child paths can't be
+			// evaluated, so that the reconcile reports the error
+			oldFields, err := referenceFields(oldObj, opts)
+			if err != nil {
+				return true
+			}
+			newFields, err := referenceFields(newObj, opts)
+			if err != nil {
+				return true
+			}
+			return !reflect.DeepEqual(oldFields, newFields)
+		},
+	}
+}
+
+// workloadReferenceFields holds the fields of a workload that determine its
+// children or how Wave handles it
+type workloadReferenceFields struct {
+	Annotations         map[string]string
+	Finalizers          []string
+	DeletionTimestamp   *metav1.Time
+	TemplateAnnotations map[string]string
+	TemplateLabels      map[string]string
+	Volumes             []corev1.Volume
+	Containers          []containerReferenceFields
+	ImagePullSecrets    []corev1.LocalObjectReference
+	ServiceAccountName  string
+	ExtraConfigMaps     []types.NamespacedName
+	ExtraSecrets        []types.NamespacedName
+}
+
+// containerReferenceFields holds the fields of a container that may reference
+// children or hold the configuration hash
+type containerReferenceFields struct {
+	Name    string
+	Env     []corev1.EnvVar
+	EnvFrom []corev1.EnvFromSource
+}
+
+// referenceFields returns the workloadReferenceFields of the workload,
+// including the children named by the ExtraConfigMapPaths and
+// ExtraSecretPaths of the Options.
+// Kinds without a PodSpec only compare their metadata
+func referenceFields(obj Object, opts Options) (workloadReferenceFields, error) {
+	fields := workloadReferenceFields{
+		Annotations:       obj.GetAnnotations(),
+		Finalizers:        obj.GetFinalizers(),
+		DeletionTimestamp: obj.GetDeletionTimestamp(),
+	}
+	if podTemplate := getPodTemplate(obj); podTemplate != nil {
+		fields.TemplateAnnotations = podTemplate.GetAnnotations()
+		fields.TemplateLabels = podTemplate.GetLabels()
+	}
+
+	if podSpec := getPodSpec(obj); podSpec != nil {
+		fields.Volumes = podSpec.Volumes
+		fields.ImagePullSecrets = podSpec.ImagePullSecrets
+		fields.ServiceAccountName = serviceAccountName(podSpec)
+		for _, container := range getAllContainers(podSpec) {
+			fields.Containers = append(fields.Containers, containerReferenceFields{
+				Name:    container.Name,
+				Env:     container.Env,
+				EnvFrom: container.EnvFrom,
+			})
+		}
+	}
+
+	var err error
+	fields.ExtraConfigMaps, err = getChildKeysByJSONPath(obj, opts.ExtraConfigMapPaths)
+	if err != nil {
+		return workloadReferenceFields{}, err
+	}
+	fields.ExtraSecrets, err = getChildKeysByJSONPath(obj, opts.ExtraSecretPaths)
+	if err != nil {
+		return workloadReferenceFields{}, err
+	}
+	return fields, nil
+}
+
+// NamespaceUpdatePredicate returns the Predicate applied to the watch on
+// Namespaces. Only Namespaces created or deleted with the RequiredAnnotation,
+// or updated to change it, change whether Wave manages their workloads
+func NamespaceUpdatePredicate(opts Options) predicate.Predicate {
+	annotation := opts.RequiredAnnotation
+	if annotation == "" {
+		annotation = RequiredAnnotation
+	}
+	hasAnnotation := func(obj metav1.Object) bool {
+		_, ok := obj.GetAnnotations()[annotation]
+		return ok
+	}
+	return predicate.Funcs{
+		CreateFunc: func(e event.CreateEvent) bool {
+			return hasAnnotation(e.Meta)
+		},
+		DeleteFunc: func(e event.DeleteEvent) bool {
+			return hasAnnotation(e.Meta)
+		},
+		UpdateFunc: func(e event.UpdateEvent) bool {
+			oldValue, oldOk := e.MetaOld.GetAnnotations()[annotation]
+			newValue, newOk := e.MetaNew.GetAnnotations()[annotation]
+			return oldOk != newOk || oldValue != newValue
+		},
+		GenericFunc: func(e event.GenericEvent) bool {
+			return false
+		},
+	}
+}
+
+// ServiceAccountUpdatePredicate returns the Predicate applied to the watch on
+// ServiceAccounts. Only changes to the image pull Secrets of a ServiceAccount
+// change the children of the workloads running as it
+func ServiceAccountUpdatePredicate() predicate.Predicate {
+	return predicate.Funcs{
+		UpdateFunc: func(e event.UpdateEvent) bool {
+			oldServiceAccount, oldOk := e.ObjectOld.(*corev1.ServiceAccount)
+			newServiceAccount, newOk := e.ObjectNew.(*corev1.ServiceAccount)
+			if !oldOk || !newOk {
+				return true
+			}
+			return !reflect.DeepEqual(oldServiceAccount.ImagePullSecrets, newServiceAccount.ImagePullSecrets)
+		},
+	}
+}
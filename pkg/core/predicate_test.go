@@ -0,0 +1,217 @@
+/*
+Copyright 2018 Pusher Ltd.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package core
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/pusher/wave/test/utils"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+)
+
+var _ = Describe("Wave predicate Suite", func() {
+	var oldDeployment *appsv1.Deployment
+	var newDeployment *appsv1.Deployment
+
+	var updateEvent = func() event.UpdateEvent {
+		return event.UpdateEvent{
+			MetaOld:   oldDeployment,
+			ObjectOld: oldDeployment,
+			MetaNew:   newDeployment,
+			ObjectNew: newDeployment,
+		}
+	}
+
+	BeforeEach(func() {
+		oldDeployment = utils.ExampleDeployment.DeepCopy()
+		oldDeployment.SetResourceVersion("1")
+		newDeployment = oldDeployment.DeepCopy()
+		newDeployment.SetResourceVersion("2")
+	})
+
+	Context("WorkloadUpdatePredicate with FilterWorkloadUpdates", func() {
+		var p predicate.Predicate
+
+		BeforeEach(func() {
+			p = WorkloadUpdatePredicate(Options{FilterWorkloadUpdates: true})
+		})
+
+		It("filters out updates that only change the replicas", func() {
+			replicas := int32(5)
+			newDeployment.Spec.Replicas = &replicas
+			Expect(p.Update(updateEvent())).To(BeFalse())
+		})
+
+		It("filters out updates that only change an image", func() {
+			newDeployment.Spec.Template.Spec.Containers[0].Image = "container1:v2"
+			Expect(p.Update(updateEvent())).To(BeFalse())
+		})
+
+		It("allows updates that change a volume reference", func() {
+			newDeployment.Spec.Template.Spec.Volumes[1].VolumeSource.ConfigMap.Name = "example3"
+			Expect(p.Update(updateEvent())).To(BeTrue())
+		})
+
+		It("allows updates that change an EnvFrom reference", func() {
+			newDeployment.Spec.Template.Spec.Containers[1].EnvFrom = []corev1.EnvFromSource{}
+			Expect(p.Update(updateEvent())).To(BeTrue())
+		})
+
+		It("allows updates that change the workload's annotations", func() {
+			newDeployment.SetAnnotations(map[string]string{RequiredAnnotation: "true"})
+			Expect(p.Update(updateEvent())).To(BeTrue())
+		})
+
+		It("allows updates that bump the poke annotation", func() {
+			oldDeployment.SetAnnotations(map[string]string{RequiredAnnotation: "true", PokeAnnotation: "1"})
+			newDeployment.SetAnnotations(map[string]string{RequiredAnnotation: "true", PokeAnnotation: "2"})
+			Expect(p.Update(updateEvent())).To(BeTrue())
+		})
+
+		It("allows updates that remove the config hash from the Pod Template", func() {
+			oldDeployment.Spec.Template.SetAnnotations(map[string]string{ConfigHashAnnotation: "hash"})
+			Expect(p.Update(updateEvent())).To(BeTrue())
+		})
+
+		It("allows updates that remove the config hash label from the Pod Template", func() {
+			oldDeployment.Spec.Template.SetLabels(map[string]string{"app": "example", ConfigHashAnnotation: "hash"})
+			Expect(p.Update(updateEvent())).To(BeTrue())
+		})
+
+		It("allows updates that mark the workload for deletion", func() {
+			now := metav1.Now()
+			newDeployment.SetDeletionTimestamp(&now)
+			Expect(p.Update(updateEvent())).To(BeTrue())
+		})
+
+		It("allows updates that change the image pull Secrets", func() {
+			newDeployment.Spec.Template.Spec.ImagePullSecrets = []corev1.LocalObjectReference{{Name: "registry"}}
+			Expect(p.Update(updateEvent())).To(BeTrue())
+		})
+
+		It("allows updates that change the ServiceAccount", func() {
+			newDeployment.Spec.Template.Spec.ServiceAccountName = "deployer"
+			Expect(p.Update(updateEvent())).To(BeTrue())
+		})
+
+		It("allows updates that change a child named by an extra child path", func() {
+			p = WorkloadUpdatePredicate(Options{FilterWorkloadUpdates: true, ExtraConfigMapPaths: []string{"{.spec.template.spec.hostname}"}})
+			newDeployment.Spec.Template.Spec.Hostname = "example3"
+			Expect(p.Update(updateEvent())).To(BeTrue())
+		})
+
+		It("filters out updates to kinds without a PodSpec that only change their spec", func() {
+			oldObj := &unstructured.Unstructured{Object: map[string]interface{}{"spec": map[string]interface{}{"size": "small"}}}
+			oldObj.SetResourceVersion("1")
+			newObj := oldObj.DeepCopy()
+			newObj.SetResourceVersion("2")
+			newObj.Object["spec"] = map[string]interface{}{"size": "large"}
+			Expect(p.Update(event.UpdateEvent{MetaOld: oldObj, ObjectOld: oldObj, MetaNew: newObj, ObjectNew: newObj})).To(BeFalse())
+
+			newObj.SetAnnotations(map[string]string{RequiredAnnotation: "true"})
+			Expect(p.Update(event.UpdateEvent{MetaOld: oldObj, ObjectOld: oldObj, MetaNew: newObj, ObjectNew: newObj})).To(BeTrue())
+		})
+
+		It("allows periodic resyncs", func() {
+			newDeployment.SetResourceVersion(oldDeployment.GetResourceVersion())
+			Expect(p.Update(updateEvent())).To(BeTrue())
+		})
+	})
+
+	Context("WorkloadUpdatePredicate without FilterWorkloadUpdates", func() {
+		It("allows updates that only change the replicas", func() {
+			replicas := int32(5)
+			newDeployment.Spec.Replicas = &replicas
+			Expect(WorkloadUpdatePredicate(Options{}).Update(updateEvent())).To(BeTrue())
+		})
+	})
+
+	Context("ServiceAccountUpdatePredicate", func() {
+		It("only allows updates that change the image pull Secrets", func() {
+			oldServiceAccount := &corev1.ServiceAccount{ObjectMeta: metav1.ObjectMeta{Name: "default"}}
+			newServiceAccount := oldServiceAccount.DeepCopy()
+			newServiceAccount.SetLabels(map[string]string{"team": "a"})
+			e := event.UpdateEvent{
+				MetaOld:   oldServiceAccount,
+				ObjectOld: oldServiceAccount,
+				MetaNew:   newServiceAccount,
+				ObjectNew: newServiceAccount,
+			}
+			Expect(ServiceAccountUpdatePredicate().Update(e)).To(BeFalse())
+
+			newServiceAccount.ImagePullSecrets = []corev1.LocalObjectReference{{Name: "registry"}}
+			Expect(ServiceAccountUpdatePredicate().Update(e)).To(BeTrue())
+		})
+	})
+
+	Context("NamespaceUpdatePredicate", func() {
+		var p predicate.Predicate
+		var oldNamespace *corev1.Namespace
+		var newNamespace *corev1.Namespace
+
+		var namespaceUpdateEvent = func() event.UpdateEvent {
+			return event.UpdateEvent{
+				MetaOld:   oldNamespace,
+				ObjectOld: oldNamespace,
+				MetaNew:   newNamespace,
+				ObjectNew: newNamespace,
+			}
+		}
+
+		BeforeEach(func() {
+			p = NamespaceUpdatePredicate(Options{})
+			oldNamespace = &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "default"}}
+			newNamespace = oldNamespace.DeepCopy()
+		})
+
+		It("filters out updates that don't change the required annotation", func() {
+			newNamespace.SetLabels(map[string]string{"team": "a"})
+			Expect(p.Update(namespaceUpdateEvent())).To(BeFalse())
+		})
+
+		It("allows updates that add, change or remove the required annotation", func() {
+			newNamespace.SetAnnotations(map[string]string{RequiredAnnotation: "true"})
+			Expect(p.Update(namespaceUpdateEvent())).To(BeTrue())
+
+			oldNamespace.SetAnnotations(map[string]string{RequiredAnnotation: "false"})
+			Expect(p.Update(namespaceUpdateEvent())).To(BeTrue())
+
+			oldNamespace, newNamespace = newNamespace, &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "default"}}
+			Expect(p.Update(namespaceUpdateEvent())).To(BeTrue())
+		})
+
+		It("uses the configured required annotation", func() {
+			p = NamespaceUpdatePredicate(Options{RequiredAnnotation: "example.com/enabled"})
+			newNamespace.SetAnnotations(map[string]string{RequiredAnnotation: "true"})
+			Expect(p.Update(namespaceUpdateEvent())).To(BeFalse())
+
+			newNamespace.SetAnnotations(map[string]string{"example.com/enabled": "true"})
+			Expect(p.Update(namespaceUpdateEvent())).To(BeTrue())
+		})
+
+		It("only allows Namespaces created with the required annotation", func() {
+			Expect(p.Create(event.CreateEvent{Meta: newNamespace, Object: newNamespace})).To(BeFalse())
+			newNamespace.SetAnnotations(map[string]string{RequiredAnnotation: "true"})
+			Expect(p.Create(event.CreateEvent{Meta: newNamespace, Object: newNamespace})).To(BeTrue())
+		})
+	})
+})
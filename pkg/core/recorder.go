@@ -0,0 +1,83 @@
+/*
+Copyright 2018 Pusher Ltd.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package core
+
+import (
+	"fmt"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/tools/record"
+	logf "sigs.k8s.io/controller-runtime/pkg/runtime/log"
+)
+
+// safeRecorder wraps an EventRecorder so that failing to emit an event never
+// fails a reconcile.
+// Events are dropped if the wrapped recorder is nil, and panics raised while
+// emitting an event are recovered and logged
+type safeRecorder struct {
+	recorder record.EventRecorder
+}
+
+// newSafeRecorder wraps the EventRecorder in a safeRecorder
+func newSafeRecorder(r record.EventRecorder) record.EventRecorder {
+	if _, ok := r.(*safeRecorder); ok {
+		return r
+	}
+	return &safeRecorder{recorder: r}
+}
+
+// Event implements record.EventRecorder
+func (s *safeRecorder) Event(object runtime.Object, eventtype, reason, message string) {
+	s.emit(reason, func(r record.EventRecorder) {
+		r.Event(object, eventtype, reason, message)
+	})
+}
+
+// Eventf implements record.EventRecorder
+func (s *safeRecorder) Eventf(object runtime.Object, eventtype, reason, messageFmt string, args ...interface{}) {
+	s.emit(reason, func(r record.EventRecorder) {
+		r.Eventf(object, eventtype, reason, messageFmt, args...)
+	})
+}
+
+// PastEventf implements record.EventRecorder
+func (s *safeRecorder) PastEventf(object runtime.Object, timestamp metav1.Time, eventtype, reason, messageFmt string, args ...interface{}) {
+	s.emit(reason, func(r record.EventRecorder) {
+		r.PastEventf(object, timestamp, eventtype, reason, messageFmt, args...)
+	})
+}
+
+// AnnotatedEventf implements record.EventRecorder
+func (s *safeRecorder) AnnotatedEventf(object runtime.Object, annotations map[string]string, eventtype, reason, messageFmt string, args ...interface{}) {
+	s.emit(reason, func(r record.EventRecorder) {
+		r.AnnotatedEventf(object, annotations, eventtype, reason, messageFmt, args...)
+	})
+}
+
+// emit calls the wrapped recorder, recovering from any panic it raises
+func (s *safeRecorder) emit(reason string, fn func(record.EventRecorder)) {
+	if s.recorder == nil {
+		return
+	}
+	defer func() {
+		if r := recover(); r != nil {
+			logf.Log.WithName("wave").Error(fmt.Errorf("%v", r), "unable to emit event", "reason", reason)
+		}
+	}()
+	fn(s.recorder)
+}
@@ -0,0 +1,157 @@
+/*
+Copyright 2018 Pusher Ltd.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package core
+
+import (
+	"sync"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/pusher/wave/test/utils"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/manager"
+)
+
+// panickingRecorder is an EventRecorder that fails to emit every event
+type panickingRecorder struct{}
+
+func (panickingRecorder) Event(runtime.Object, string, string, string) {
+	panic("unable to emit event")
+}
+
+func (panickingRecorder) Eventf(runtime.Object, string, string, string, ...interface{}) {
+	panic("unable to emit event")
+}
+
+func (panickingRecorder) PastEventf(runtime.Object, metav1.Time, string, string, string, ...interface{}) {
+	panic("unable to emit event")
+}
+
+func (panickingRecorder) AnnotatedEventf(runtime.Object, map[string]string, string, string, string, ...interface{}) {
+	panic("unable to emit event")
+}
+
+var _ = Describe("Wave recorder Suite", func() {
+	Context("safeRecorder", func() {
+		It("drops events when the recorder is nil", func() {
+			r := newSafeRecorder(nil)
+			Expect(func() {
+				r.Eventf(utils.ExampleDeployment, corev1.EventTypeNormal, "Reason", "message %s", "arg")
+			}).NotTo(Panic())
+		})
+
+		It("recovers from a recorder that panics", func() {
+			r := newSafeRecorder(panickingRecorder{})
+			Expect(func() {
+				r.Event(utils.ExampleDeployment, corev1.EventTypeNormal, "Reason", "message")
+				r.Eventf(utils.ExampleDeployment, corev1.EventTypeNormal, "Reason", "message %s", "arg")
+				r.PastEventf(utils.ExampleDeployment, metav1.Now(), corev1.EventTypeNormal, "Reason", "message")
+				r.AnnotatedEventf(utils.ExampleDeployment, map[string]string{}, corev1.EventTypeNormal, "Reason", "message")
+			}).NotTo(Panic())
+		})
+
+		It("passes events to the wrapped recorder", func() {
+			fake := record.NewFakeRecorder(1)
+			newSafeRecorder(fake).Eventf(utils.ExampleDeployment, corev1.EventTypeNormal, "Reason", "message %s", "arg")
+			Expect(fake.Events).To(Receive(Equal("Normal Reason message arg")))
+		})
+	})
+
+	Context("When a Deployment is reconciled", func() {
+		var c client.Client
+		var m utils.Matcher
+		var deployment *appsv1.Deployment
+		var children []Object
+		var mgrStopped *sync.WaitGroup
+		var stopMgr chan struct{}
+
+		const timeout = time.Second * 5
+
+		BeforeEach(func() {
+			mgr, err := manager.New(cfg, manager.Options{})
+			Expect(err).NotTo(HaveOccurred())
+			c = mgr.GetClient()
+			m = utils.Matcher{Client: c}
+
+			stopMgr, mgrStopped = StartTestManager(mgr)
+
+			children = []Object{
+				utils.ExampleConfigMap1.DeepCopy(),
+				utils.ExampleConfigMap2.DeepCopy(),
+				utils.ExampleSecret1.DeepCopy(),
+				utils.ExampleSecret2.DeepCopy(),
+			}
+			for _, obj := range children {
+				m.Create(obj).Should(Succeed())
+				m.Get(obj, timeout).Should(Succeed())
+			}
+
+			deployment = utils.ExampleDeployment.DeepCopy()
+			deployment.SetAnnotations(map[string]string{RequiredAnnotation: "true"})
+			m.Create(deployment).Should(Succeed())
+			m.Get(deployment, timeout).Should(Succeed())
+		})
+
+		AfterEach(func() {
+			// Make sure to delete the finalizer so the Deployment can be deleted
+			m.Get(deployment, timeout).Should(Succeed())
+			deployment.SetFinalizers([]string{})
+			m.Update(deployment).Should(Succeed())
+
+			close(stopMgr)
+			mgrStopped.Wait()
+
+			utils.DeleteAll(cfg, timeout,
+				&appsv1.DeploymentList{},
+				&corev1.ConfigMapList{},
+				&corev1.SecretList{},
+				&corev1.EventList{},
+			)
+		})
+
+		for name, recorder := range map[string]record.EventRecorder{
+			"without a recorder":      nil,
+			"with a failing recorder": panickingRecorder{},
+		} {
+			recorder := recorder
+			Context(name, func() {
+				BeforeEach(func() {
+					h := NewHandler(c, recorder, Options{})
+					_, err := h.HandleDeployment(deployment)
+					Expect(err).NotTo(HaveOccurred())
+				})
+
+				It("Adds OwnerReferences to all children", func() {
+					ownerRef := utils.GetOwnerRef(deployment)
+					for _, obj := range children {
+						m.Eventually(obj, timeout).Should(utils.WithOwnerReferences(ContainElement(ownerRef)))
+					}
+				})
+
+				It("Adds a config hash to the Pod Template", func() {
+					m.Eventually(deployment, timeout).Should(utils.WithPodTemplateAnnotations(HaveKeyWithValue(ConfigHashAnnotation, exampleHash)))
+				})
+			})
+		}
+	})
+})
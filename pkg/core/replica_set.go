@@ -0,0 +1,57 @@
+/*
+Copyright 2018 Pusher Ltd.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package core
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+	logf "sigs.k8s.io/controller-runtime/pkg/runtime/log"
+)
+
+// isOwnedByDeployment checks whether the object is controlled by a Deployment,
+// as the ReplicaSets of a Deployment are
+func isOwnedByDeployment(obj Object) bool {
+	ref := metav1.GetControllerOf(obj)
+	return ref != nil && ref.Kind == "Deployment" && ref.APIVersion == "apps/v1"
+}
+
+// isOwnedByRollout checks whether the object is controlled by an Argo Rollout,
+// as the ReplicaSets of a Rollout are
+func isOwnedByRollout(obj Object) bool {
+	ref := metav1.GetControllerOf(obj)
+	return ref != nil && ref.Kind == "Rollout" && ref.APIVersion == "argoproj.io/v1alpha1"
+}
+
+// handleDeploymentReplicaSet leaves a ReplicaSet owned by a Deployment, or by
+// a Rollout, unmanaged. The ReplicaSet inherits the Wave annotations of its
+// owner, which Wave hashes instead, and its PodTemplate is managed by the
+// owner.
+// ReplicaSets Wave managed before they were adopted by a Deployment or a
+// Rollout are cleaned up. As they inherit the config hash of their owner,
+// they are only considered managed if they have Wave's finalizer or are
+// recorded in the ChildIndex, so that the children of every owned ReplicaSet
+// aren't listed
+func (h *Handler) handleDeploymentReplicaSet(obj Object) (reconcile.Result, error) {
+	log := logf.Log.WithName("wave")
+
+	if hasFinalizer(obj, h.options.Finalizer) || h.options.ChildIndex.contains(obj) {
+		log.V(0).Info("ReplicaSet adopted by a "+metav1.GetControllerOf(obj).Kind+", cleaning up", "namespace", obj.GetNamespace(), "name", obj.GetName())
+		return h.handleDelete(obj)
+	}
+	log.V(1).Info("ReplicaSet owned by a "+metav1.GetControllerOf(obj).Kind+", skipping", "namespace", obj.GetNamespace(), "name", obj.GetName())
+	return reconcile.Result{}, nil
+}
@@ -17,16 +17,55 @@ limitations under the License.
 package core
 
 import (
-	appsv1 "k8s.io/api/apps/v1"
+	"context"
+	"fmt"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
 )
 
-// hasRequiredAnnotation returns true if the given Deployment has the wave
-// annotation present
-func hasRequiredAnnotation(obj *appsv1.Deployment) bool {
+// isEnabled determines whether Wave manages the workload.
+// The RequiredAnnotation on the workload takes precedence over the
+// RequiredAnnotation on its namespace, if NamespaceDefaults is set, which takes
+// precedence over the EnabledByDefault option.
+// Rollouts referencing a workload are never managed, as they have no
+// PodTemplate to roll; the referenced workload is managed instead
+func (h *Handler) isEnabled(obj Object) (bool, error) {
+	if referencesWorkload(obj) {
+		return false, nil
+	}
+	if _, ok := obj.GetAnnotations()[h.options.RequiredAnnotation]; ok {
+		return hasRequiredAnnotation(obj, h.options.RequiredAnnotation, h.options.RequiredAnnotationValues), nil
+	}
+	if !h.options.NamespaceDefaults {
+		return h.options.EnabledByDefault, nil
+	}
+
+	ns := &corev1.Namespace{}
+	err := h.Get(context.TODO(), types.NamespacedName{Name: obj.GetNamespace()}, ns)
+	if err != nil && !errors.IsNotFound(err) {
+		return false, fmt.Errorf("error getting namespace %s: %v", obj.GetNamespace(), err)
+	}
+	if err == nil {
+		if _, ok := ns.GetAnnotations()[h.options.RequiredAnnotation]; ok {
+			return hasRequiredAnnotation(ns, h.options.RequiredAnnotation, h.options.RequiredAnnotationValues), nil
+		}
+	}
+
+	return h.options.EnabledByDefault, nil
+}
+
+// hasRequiredAnnotation returns true if the given object has the given
+// annotation present with one of the given values
+func hasRequiredAnnotation(obj metav1.Object, annotation string, values []string) bool {
 	annotations := obj.GetAnnotations()
-	if value, ok := annotations[RequiredAnnotation]; ok {
-		if value == "true" {
-			return true
+	if value, ok := annotations[annotation]; ok {
+		for _, truthy := range values {
+			if value == truthy {
+				return true
+			}
 		}
 	}
 	return false
@@ -39,7 +39,7 @@ var _ = Describe("Wave required annotation Suite", func() {
 			annotations[RequiredAnnotation] = "true"
 			deployment.SetAnnotations(annotations)
 
-			Expect(hasRequiredAnnotation(deployment)).To(BeTrue())
+			Expect(hasRequiredAnnotation(deployment, RequiredAnnotation, []string{"true"})).To(BeTrue())
 		})
 
 		It("returns false when the annotation has value other than true", func() {
@@ -50,12 +50,31 @@ var _ = Describe("Wave required annotation Suite", func() {
 			annotations[RequiredAnnotation] = "false"
 			deployment.SetAnnotations(annotations)
 
-			Expect(hasRequiredAnnotation(deployment)).To(BeFalse())
+			Expect(hasRequiredAnnotation(deployment, RequiredAnnotation, []string{"true"})).To(BeFalse())
 		})
 
 		It("returns false when the annotation is not set", func() {
-			Expect(hasRequiredAnnotation(deployment)).To(BeFalse())
+			Expect(hasRequiredAnnotation(deployment, RequiredAnnotation, []string{"true"})).To(BeFalse())
 		})
 
+		Context("with a configured set of values", func() {
+			values := []string{"true", "enabled"}
+
+			It("returns true for each of the values", func() {
+				for _, value := range values {
+					deployment.SetAnnotations(map[string]string{RequiredAnnotation: value})
+					Expect(hasRequiredAnnotation(deployment, RequiredAnnotation, values)).To(BeTrue())
+				}
+			})
+
+			It("returns false when the annotation has value false", func() {
+				deployment.SetAnnotations(map[string]string{RequiredAnnotation: "false"})
+				Expect(hasRequiredAnnotation(deployment, RequiredAnnotation, values)).To(BeFalse())
+			})
+
+			It("returns false when the annotation is not set", func() {
+				Expect(hasRequiredAnnotation(deployment, RequiredAnnotation, values)).To(BeFalse())
+			})
+		})
 	})
 })
@@ -0,0 +1,98 @@
+/*
+Copyright 2018 Pusher Ltd.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package core
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"sync"
+
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// resourceVersionTracker records, for each child, the resourceVersion at which
+// anything other than its OwnerReferences last changed. That resourceVersion
+// is the one hashed with HashResourceVersions, so that the OwnerReferences
+// Wave adds to a child, eg. when another workload starts referencing it, don't
+// roll the workloads already referencing it.
+// Entries are only held in memory, so after a restart the first
+// resourceVersion observed for each child is recorded
+type resourceVersionTracker struct {
+	lock    sync.Mutex
+	entries map[types.UID]resourceVersionEntry
+}
+
+// resourceVersionEntry is the resourceVersion at which the child, ignoring its
+// OwnerReferences, last changed along with the fingerprint of its content at
+// that version
+type resourceVersionEntry struct {
+	fingerprint     string
+	resourceVersion string
+}
+
+// newResourceVersionTracker constructs an empty resourceVersionTracker
+func newResourceVersionTracker() *resourceVersionTracker {
+	return &resourceVersionTracker{entries: make(map[types.UID]resourceVersionEntry)}
+}
+
+// hashedVersion returns the resourceVersion of the child that is hashed: the
+// recorded resourceVersion if only the child's OwnerReferences have changed
+// since it was recorded, otherwise the child's current resourceVersion, which
+// is then recorded.
+// No resourceVersion is hashed if the tracker is nil
+func (t *resourceVersionTracker) hashedVersion(obj Object) (string, error) {
+	if t == nil {
+		return "", nil
+	}
+	if !isCacheable(obj) {
+		return obj.GetResourceVersion(), nil
+	}
+	fingerprint, err := fingerprintChild(obj)
+	if err != nil {
+		return "", err
+	}
+
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	entry, ok := t.entries[obj.GetUID()]
+	if ok && entry.fingerprint == fingerprint {
+		return entry.resourceVersion, nil
+	}
+	t.entries[obj.GetUID()] = resourceVersionEntry{
+		fingerprint:     fingerprint,
+		resourceVersion: obj.GetResourceVersion(),
+	}
+	return obj.GetResourceVersion(), nil
+}
+
+// fingerprintChild hashes the whole child, including its metadata, except for
+// its OwnerReferences and resourceVersion
+func fingerprintChild(obj Object) (string, error) {
+	copy, ok := obj.DeepCopyObject().(Object)
+	if !ok {
+		return "", fmt.Errorf("unable to copy %s %s", kindOf(obj), obj.GetName())
+	}
+	copy.SetOwnerReferences(nil)
+	copy.SetResourceVersion("")
+	data, err := json.Marshal(copy)
+	if err != nil {
+		return "", fmt.Errorf("unable to marshal %s %s: %v", kindOf(obj), obj.GetName(), err)
+	}
+	return fmt.Sprintf("%x", sha256.Sum256(data)), nil
+}
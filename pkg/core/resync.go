@@ -0,0 +1,37 @@
+/*
+Copyright 2018 Pusher Ltd.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package core
+
+import (
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+// withResync requeues a managed workload that reconciled successfully after
+// the ResyncPeriod, so that its hash is recalculated even if no watch event
+// triggers a reconcile.
+// Workloads that already requeue sooner, or failed and are requeued with
+// backoff by the controller, are left as they are
+func (h *Handler) withResync(result reconcile.Result, err error) reconcile.Result {
+	if h.options.ResyncPeriod <= 0 || err != nil || result.Requeue {
+		return result
+	}
+	if result.RequeueAfter > 0 && result.RequeueAfter <= h.options.ResyncPeriod {
+		return result
+	}
+	result.RequeueAfter = h.options.ResyncPeriod
+	return result
+}
@@ -0,0 +1,60 @@
+/*
+Copyright 2018 Pusher Ltd.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package core
+
+import (
+	"fmt"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+var _ = Describe("Wave resync Suite", func() {
+	Context("withResync", func() {
+		const resyncPeriod = time.Minute
+
+		var h *Handler
+
+		BeforeEach(func() {
+			h = NewHandler(nil, nil, Options{ResyncPeriod: resyncPeriod})
+		})
+
+		It("requeues after the ResyncPeriod", func() {
+			Expect(h.withResync(reconcile.Result{}, nil)).To(Equal(reconcile.Result{RequeueAfter: resyncPeriod}))
+		})
+
+		It("shortens a later requeue to the ResyncPeriod", func() {
+			Expect(h.withResync(reconcile.Result{RequeueAfter: time.Hour}, nil)).To(Equal(reconcile.Result{RequeueAfter: resyncPeriod}))
+		})
+
+		It("keeps a sooner requeue", func() {
+			Expect(h.withResync(reconcile.Result{RequeueAfter: time.Second}, nil)).To(Equal(reconcile.Result{RequeueAfter: time.Second}))
+			Expect(h.withResync(reconcile.Result{Requeue: true}, nil)).To(Equal(reconcile.Result{Requeue: true}))
+		})
+
+		It("doesn't requeue a failed reconcile", func() {
+			Expect(h.withResync(reconcile.Result{}, fmt.Errorf("error"))).To(Equal(reconcile.Result{}))
+		})
+
+		It("doesn't requeue without a ResyncPeriod", func() {
+			h = NewHandler(nil, nil, Options{})
+			Expect(h.withResync(reconcile.Result{}, nil)).To(Equal(reconcile.Result{}))
+		})
+	})
+})
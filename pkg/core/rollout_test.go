@@ -0,0 +1,92 @@
+/*
+Copyright 2018 Pusher Ltd.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package core
+
+import (
+	"encoding/json"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	argov1alpha1 "github.com/pusher/wave/pkg/apis/argoproj/v1alpha1"
+	"github.com/pusher/wave/test/utils"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/record"
+)
+
+var _ = Describe("Wave Argo Rollout Suite", func() {
+	var rollout *argov1alpha1.Rollout
+
+	BeforeEach(func() {
+		rollout = utils.ExampleRollout.DeepCopy()
+	})
+
+	It("identifies the Rollout's kind and API version", func() {
+		Expect(kindOf(rollout)).To(Equal("Rollout"))
+		Expect(apiVersionOf(rollout)).To(Equal("argoproj.io/v1alpha1"))
+		Expect(getOwnerReference(rollout)).To(Equal(utils.GetOwnerRef(rollout)))
+	})
+
+	It("returns the Rollout's PodTemplate", func() {
+		Expect(getPodTemplate(rollout)).To(Equal(&rollout.Spec.Template))
+
+		configMaps, secrets := getChildNamesByType(rollout)
+		Expect(configMaps).To(HaveLen(2))
+		Expect(secrets).To(HaveLen(2))
+	})
+
+	Context("When the Rollout references a workload", func() {
+		BeforeEach(func() {
+			rollout.Spec.Template = corev1.PodTemplateSpec{}
+			rollout.Spec.Fields["workloadRef"] = json.RawMessage(`{"apiVersion":"apps/v1","kind":"Deployment","name":"example"}`)
+		})
+
+		It("returns no PodTemplate", func() {
+			Expect(getPodTemplate(rollout)).To(BeNil())
+		})
+
+		It("references no children", func() {
+			configMaps, secrets := getChildNamesByType(rollout)
+			Expect(configMaps).To(BeEmpty())
+			Expect(secrets).To(BeEmpty())
+		})
+
+		It("isn't managed, with a Warning naming the referenced workload", func() {
+			rollout.SetAnnotations(map[string]string{RequiredAnnotation: "true"})
+			recorder := record.NewFakeRecorder(10)
+			h := NewHandler(nil, recorder, Options{})
+
+			Expect(h.isEnabled(rollout)).To(BeFalse())
+			_, err := h.HandleRollout(rollout)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(recorder.Events).To(Receive(Equal("Warning WorkloadRefUnsupported Rollouts referencing a workload aren't managed, enable Wave for the referenced Deployment instead")))
+			Expect(rollout.GetFinalizers()).To(BeEmpty())
+		})
+	})
+
+	It("identifies ReplicaSets controlled by a Rollout", func() {
+		rs := utils.ExampleReplicaSet.DeepCopy()
+		Expect(isOwnedByRollout(rs)).To(BeFalse())
+
+		t := true
+		ref := utils.GetOwnerRef(rollout)
+		ref.Controller = &t
+		rs.SetOwnerReferences([]metav1.OwnerReference{ref})
+		Expect(isOwnedByRollout(rs)).To(BeTrue())
+		Expect(isOwnedByDeployment(rs)).To(BeFalse())
+	})
+})
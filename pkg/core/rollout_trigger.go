@@ -0,0 +1,139 @@
+/*
+Copyright 2018 Pusher Ltd.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package core
+
+import (
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// RolloutTrigger determines how Wave modifies the PodTemplate of a workload to
+// trigger a rollout when its configuration changes
+type RolloutTrigger string
+
+const (
+	// RolloutTriggerPodAnnotation stores the configuration hash in the
+	// ConfigHashAnnotation on the PodTemplate
+	RolloutTriggerPodAnnotation RolloutTrigger = "annotation"
+
+	// RolloutTriggerEnvVar stores the configuration hash in the ConfigHashEnvVar
+	// environment variable of every container in the PodTemplate
+	RolloutTriggerEnvVar RolloutTrigger = "env"
+)
+
+// getRolloutTrigger returns the RolloutTrigger chosen by the workload's
+// RolloutTriggerAnnotation annotation.
+// Defaults to RolloutTriggerPodAnnotation
+func getRolloutTrigger(obj metav1.Object) RolloutTrigger {
+	if RolloutTrigger(obj.GetAnnotations()[RolloutTriggerAnnotation]) == RolloutTriggerEnvVar {
+		return RolloutTriggerEnvVar
+	}
+	return RolloutTriggerPodAnnotation
+}
+
+// getConfigHash returns the configuration hash currently stored in the
+// workload's PodTemplate, in its hashTarget which defaults to the given
+// annotation, or on the metadata of objects without a PodTemplate
+func getConfigHash(obj Object, annotation string) string {
+	podTemplate := getPodTemplate(obj)
+	if podTemplate == nil {
+		return obj.GetAnnotations()[annotation]
+	}
+	if getRolloutTrigger(obj) == RolloutTriggerEnvVar {
+		return getConfigHashEnv(&podTemplate.Spec)
+	}
+	return getTargetConfigHash(podTemplate, getHashTarget(obj, annotation))
+}
+
+// getPodConfigHash returns the configuration hash the Pod of the workload was
+// created with, using either the workload's hashTarget or the environment
+// variable
+func getPodConfigHash(obj Object, pod *corev1.Pod, annotation string) string {
+	target := getHashTarget(obj, annotation)
+	if target.label {
+		if hash, ok := pod.GetLabels()[target.key]; ok {
+			return hash
+		}
+	} else if hash, ok := pod.GetAnnotations()[target.key]; ok {
+		return hash
+	}
+	return getConfigHashEnv(&pod.Spec)
+}
+
+// getConfigHashEnv returns the value of the ConfigHashEnvVar of the first
+// container that has it set
+func getConfigHashEnv(podSpec *corev1.PodSpec) string {
+	for _, container := range podSpec.Containers {
+		for _, env := range container.Env {
+			if env.Name == ConfigHashEnvVar {
+				return env.Value
+			}
+		}
+	}
+	return ""
+}
+
+// setConfigHashEnv adds the ConfigHashEnvVar to every container in the
+// PodSpec, or updates its value if it is already present
+func setConfigHashEnv(podSpec *corev1.PodSpec, hash string) {
+	for i := range podSpec.Containers {
+		container := &podSpec.Containers[i]
+
+		found := false
+		for j := range container.Env {
+			if container.Env[j].Name == ConfigHashEnvVar {
+				container.Env[j].Value = hash
+				container.Env[j].ValueFrom = nil
+				found = true
+			}
+		}
+		if !found {
+			container.Env = append(container.Env, corev1.EnvVar{Name: ConfigHashEnvVar, Value: hash})
+		}
+	}
+}
+
+// removeConfigHashEnv removes the ConfigHashEnvVar from every container in the
+// PodSpec.
+// Containers without the variable are left untouched
+func removeConfigHashEnv(podSpec *corev1.PodSpec) {
+	for i := range podSpec.Containers {
+		container := &podSpec.Containers[i]
+		if !hasEnvVar(container, ConfigHashEnvVar) {
+			continue
+		}
+
+		env := []corev1.EnvVar{}
+		for _, e := range container.Env {
+			if e.Name != ConfigHashEnvVar {
+				env = append(env, e)
+			}
+		}
+		container.Env = env
+	}
+}
+
+// hasEnvVar returns true if the container has an environment variable with
+// the given name
+func hasEnvVar(container *corev1.Container, name string) bool {
+	for _, env := range container.Env {
+		if env.Name == name {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,110 @@
+/*
+Copyright 2018 Pusher Ltd.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package core
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/pusher/wave/test/utils"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+)
+
+var _ = Describe("Wave rollout trigger Suite", func() {
+	var deployment *appsv1.Deployment
+
+	BeforeEach(func() {
+		deployment = utils.ExampleDeployment.DeepCopy()
+	})
+
+	Context("getRolloutTrigger", func() {
+		It("defaults to the pod annotation trigger", func() {
+			Expect(getRolloutTrigger(deployment)).To(Equal(RolloutTriggerPodAnnotation))
+		})
+
+		It("returns the env var trigger when selected by the annotation", func() {
+			deployment.SetAnnotations(map[string]string{RolloutTriggerAnnotation: "env"})
+			Expect(getRolloutTrigger(deployment)).To(Equal(RolloutTriggerEnvVar))
+		})
+
+		It("defaults to the pod annotation trigger for unknown values", func() {
+			deployment.SetAnnotations(map[string]string{RolloutTriggerAnnotation: "unknown"})
+			Expect(getRolloutTrigger(deployment)).To(Equal(RolloutTriggerPodAnnotation))
+		})
+	})
+
+	Context("setConfigHash with the env var trigger", func() {
+		BeforeEach(func() {
+			deployment.SetAnnotations(map[string]string{RolloutTriggerAnnotation: "env"})
+		})
+
+		It("adds the env var to every container", func() {
+			setConfigHash(deployment, ConfigHashAnnotation, "1234")
+
+			for _, container := range deployment.Spec.Template.Spec.Containers {
+				Expect(container.Env).To(ContainElement(corev1.EnvVar{Name: ConfigHashEnvVar, Value: "1234"}))
+			}
+			Expect(getConfigHash(deployment, ConfigHashAnnotation)).To(Equal("1234"))
+		})
+
+		It("updates an existing env var without duplicating it", func() {
+			setConfigHash(deployment, ConfigHashAnnotation, "1234")
+			setConfigHash(deployment, ConfigHashAnnotation, "5678")
+
+			for _, container := range deployment.Spec.Template.Spec.Containers {
+				count := 0
+				for _, env := range container.Env {
+					if env.Name == ConfigHashEnvVar {
+						count++
+						Expect(env.Value).To(Equal("5678"))
+					}
+				}
+				Expect(count).To(Equal(1))
+			}
+		})
+
+		It("removes the hash from the Pod Template annotations", func() {
+			deployment.Spec.Template.SetAnnotations(map[string]string{ConfigHashAnnotation: "1234", "existing": "annotation"})
+			setConfigHash(deployment, ConfigHashAnnotation, "5678")
+
+			Expect(deployment.Spec.Template.GetAnnotations()).NotTo(HaveKey(ConfigHashAnnotation))
+			Expect(deployment.Spec.Template.GetAnnotations()).To(HaveKey("existing"))
+		})
+	})
+
+	Context("setConfigHash with the pod annotation trigger", func() {
+		It("removes the env var from every container", func() {
+			deployment.SetAnnotations(map[string]string{RolloutTriggerAnnotation: "env"})
+			setConfigHash(deployment, ConfigHashAnnotation, "1234")
+
+			deployment.SetAnnotations(map[string]string{})
+			setConfigHash(deployment, ConfigHashAnnotation, "5678")
+
+			for _, container := range deployment.Spec.Template.Spec.Containers {
+				Expect(hasEnvVar(&container, ConfigHashEnvVar)).To(BeFalse())
+			}
+			Expect(getConfigHash(deployment, ConfigHashAnnotation)).To(Equal("5678"))
+		})
+
+		It("doesn't modify containers without the env var", func() {
+			original := deployment.DeepCopy()
+			setConfigHash(deployment, ConfigHashAnnotation, "1234")
+
+			Expect(deployment.Spec.Template.Spec.Containers).To(Equal(original.Spec.Template.Spec.Containers))
+		})
+	})
+})
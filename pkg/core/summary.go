@@ -0,0 +1,155 @@
+/*
+Copyright 2018 Pusher Ltd.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package core
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+
+	argov1alpha1 "github.com/pusher/wave/pkg/apis/argoproj/v1alpha1"
+	appsv1 "k8s.io/api/apps/v1"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// ConfigHashGroup is the set of workloads managed by Wave that share a
+// configuration hash
+type ConfigHashGroup struct {
+	// Hash is the configuration hash shared by the workloads
+	Hash string `json:"hash"`
+
+	// Count is the number of workloads in the group
+	Count int `json:"count"`
+
+	// Workloads identifies each workload as "<Kind> <namespace>/<name>"
+	Workloads []string `json:"workloads"`
+}
+
+// SummarizeConfigHashes lists the workloads that Wave has recorded a
+// configuration hash on and groups them by that hash.
+// Groups are sorted by size, largest first, then by hash.
+// ReplicaSets are only included when ManageReplicaSets is enabled, Pods when
+// ManagePods is enabled, and Rollouts when ManageRollouts is enabled and their
+// CRD is installed.
+// Workloads managed by another Wave instance, or ReplicaSets owned by a
+// Deployment or a Rollout, are skipped
+func SummarizeConfigHashes(c client.Reader, opts Options) ([]ConfigHashGroup, error) {
+	lists := []runtime.Object{
+		&appsv1.DeploymentList{},
+		&appsv1.DaemonSetList{},
+		&appsv1.StatefulSetList{},
+		&batchv1.JobList{},
+	}
+	if opts.ManageReplicaSets {
+		lists = append(lists, &appsv1.ReplicaSetList{})
+	}
+	if opts.ManagePods {
+		lists = append(lists, &corev1.PodList{})
+	}
+	if opts.ManageRollouts {
+		lists = append(lists, &argov1alpha1.RolloutList{})
+	}
+	groups := make(map[string]*ConfigHashGroup)
+	for _, list := range lists {
+		err := c.List(context.TODO(), &client.ListOptions{}, list)
+		if _, ok := list.(*argov1alpha1.RolloutList); ok && meta.IsNoMatchError(err) {
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("error listing workloads: %v", err)
+		}
+		items, err := meta.ExtractList(list)
+		if err != nil {
+			return nil, fmt.Errorf("error extracting workloads: %v", err)
+		}
+
+		for _, item := range items {
+			obj, ok := item.(Object)
+			if !ok || isOwnedByOtherInstance(obj, opts.InstanceID) {
+				continue
+			}
+			// ReplicaSets of a Deployment or a Rollout copy its hash but aren't
+			// managed
+			if _, ok := obj.(*appsv1.ReplicaSet); ok && (isOwnedByDeployment(obj) || isOwnedByRollout(obj)) {
+				continue
+			}
+			annotation := opts.ForKind(kindOf(obj)).ConfigHashAnnotation
+			if annotation == "" {
+				annotation = ConfigHashAnnotation
+			}
+			hash := recordedConfigHash(obj, annotation)
+			if hash == "" {
+				continue
+			}
+
+			group, ok := groups[hash]
+			if !ok {
+				group = &ConfigHashGroup{Hash: hash, Workloads: []string{}}
+				groups[hash] = group
+			}
+			group.Count++
+			group.Workloads = append(group.Workloads, fmt.Sprintf("%s %s/%s", kindOf(obj), obj.GetNamespace(), obj.GetName()))
+		}
+	}
+
+	summary := []ConfigHashGroup{}
+	for _, group := range groups {
+		sort.Strings(group.Workloads)
+		summary = append(summary, *group)
+	}
+	sort.Slice(summary, func(i, j int) bool {
+		if summary[i].Count != summary[j].Count {
+			return summary[i].Count > summary[j].Count
+		}
+		return summary[i].Hash < summary[j].Hash
+	})
+	return summary, nil
+}
+
+// recordedConfigHash returns the configuration hash Wave has recorded in the
+// given annotation of the workload, wherever it was recorded
+func recordedConfigHash(obj Object, annotation string) string {
+	if hasMetadataConfigHash(obj, annotation) {
+		return obj.GetAnnotations()[annotation]
+	}
+	if hash := getConfigHash(obj, annotation); hash != "" {
+		return hash
+	}
+	return obj.GetAnnotations()[AdoptedConfigHashAnnotation]
+}
+
+// NewConfigHashSummaryHandler returns an http.Handler serving the result of
+// SummarizeConfigHashes as JSON
+func NewConfigHashSummaryHandler(c client.Reader, opts Options) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		summary, err := SummarizeConfigHashes(c, opts)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(summary); err != nil {
+			return
+		}
+	})
+}
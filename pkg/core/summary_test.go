@@ -0,0 +1,161 @@
+/*
+Copyright 2018 Pusher Ltd.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package core
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/pusher/wave/test/utils"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/manager"
+)
+
+var _ = Describe("Wave config hash summary Suite", func() {
+	var c client.Client
+	var m utils.Matcher
+	var deployments []*appsv1.Deployment
+	var mgrStopped *sync.WaitGroup
+	var stopMgr chan struct{}
+
+	const timeout = time.Second * 5
+
+	// newDeployment returns a copy of the ExampleDeployment with the given
+	// name and annotations
+	newDeployment := func(name string, annotations map[string]string) *appsv1.Deployment {
+		deployment := utils.ExampleDeployment.DeepCopy()
+		deployment.SetName(name)
+		deployment.SetAnnotations(annotations)
+		return deployment
+	}
+
+	BeforeEach(func() {
+		mgr, err := manager.New(cfg, manager.Options{})
+		Expect(err).NotTo(HaveOccurred())
+		c = mgr.GetClient()
+		h := NewHandler(c, mgr.GetRecorder("wave"), Options{})
+		m = utils.Matcher{Client: c}
+
+		stopMgr, mgrStopped = StartTestManager(mgr)
+
+		extra := utils.ExampleConfigMap2.DeepCopy()
+		extra.SetName("extra")
+		for _, obj := range []Object{
+			utils.ExampleConfigMap1.DeepCopy(),
+			utils.ExampleConfigMap2.DeepCopy(),
+			utils.ExampleSecret1.DeepCopy(),
+			utils.ExampleSecret2.DeepCopy(),
+			extra,
+		} {
+			m.Create(obj).Should(Succeed())
+			m.Get(obj, timeout).Should(Succeed())
+		}
+
+		// Three workloads share the example children, one has an extra child
+		// and one is not managed by Wave
+		deployments = []*appsv1.Deployment{
+			newDeployment("shared-a", map[string]string{RequiredAnnotation: "true"}),
+			newDeployment("shared-b", map[string]string{RequiredAnnotation: "true"}),
+			newDeployment("shared-c", map[string]string{RequiredAnnotation: "true"}),
+			newDeployment("extra", map[string]string{RequiredAnnotation: "true", ExtraConfigMapsAnnotation: "extra"}),
+			newDeployment("unmanaged", nil),
+		}
+		for _, deployment := range deployments {
+			m.Create(deployment).Should(Succeed())
+			m.Get(deployment, timeout).Should(Succeed())
+
+			_, err := h.HandleDeployment(deployment)
+			Expect(err).NotTo(HaveOccurred())
+		}
+		for _, deployment := range deployments[:4] {
+			m.Eventually(deployment, timeout).Should(utils.WithPodTemplateAnnotations(HaveKey(ConfigHashAnnotation)))
+		}
+	})
+
+	AfterEach(func() {
+		// Make sure to delete the finalizers so the Deployments can be deleted
+		for _, deployment := range deployments {
+			m.Get(deployment, timeout).Should(Succeed())
+			deployment.SetFinalizers([]string{})
+			m.Update(deployment).Should(Succeed())
+		}
+
+		close(stopMgr)
+		mgrStopped.Wait()
+
+		utils.DeleteAll(cfg, timeout,
+			&appsv1.DeploymentList{},
+			&corev1.ConfigMapList{},
+			&corev1.SecretList{},
+			&corev1.EventList{},
+		)
+	})
+
+	It("Groups the managed workloads by their configuration hash", func() {
+		summary, err := SummarizeConfigHashes(c, Options{})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(summary).To(HaveLen(2))
+
+		Expect(summary[0].Hash).To(Equal(deployments[0].Spec.Template.GetAnnotations()[ConfigHashAnnotation]))
+		Expect(summary[0].Count).To(Equal(3))
+		Expect(summary[0].Workloads).To(Equal([]string{
+			"Deployment default/shared-a",
+			"Deployment default/shared-b",
+			"Deployment default/shared-c",
+		}))
+
+		Expect(summary[1].Hash).To(Equal(deployments[3].Spec.Template.GetAnnotations()[ConfigHashAnnotation]))
+		Expect(summary[1].Hash).NotTo(Equal(summary[0].Hash))
+		Expect(summary[1].Count).To(Equal(1))
+		Expect(summary[1].Workloads).To(Equal([]string{"Deployment default/extra"}))
+	})
+
+	It("Skips workloads managed by another Wave instance", func() {
+		m.Get(deployments[1], timeout).Should(Succeed())
+		annotations := deployments[1].GetAnnotations()
+		annotations[InstanceAnnotation] = "other"
+		deployments[1].SetAnnotations(annotations)
+		m.Update(deployments[1]).Should(Succeed())
+		m.Eventually(deployments[1], timeout).Should(utils.WithAnnotations(HaveKey(InstanceAnnotation)))
+
+		summary, err := SummarizeConfigHashes(c, Options{})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(summary).To(HaveLen(2))
+		Expect(summary[0].Count).To(Equal(2))
+		Expect(summary[0].Workloads).NotTo(ContainElement("Deployment default/shared-b"))
+	})
+
+	It("Serves the summary as JSON", func() {
+		recorder := httptest.NewRecorder()
+		NewConfigHashSummaryHandler(c, Options{}).ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/config-hashes", nil))
+		Expect(recorder.Code).To(Equal(http.StatusOK))
+		Expect(recorder.Header().Get("Content-Type")).To(Equal("application/json"))
+
+		summary := []ConfigHashGroup{}
+		Expect(json.Unmarshal(recorder.Body.Bytes(), &summary)).To(Succeed())
+		Expect(summary).To(HaveLen(2))
+		Expect(summary[0].Count).To(Equal(3))
+		Expect(summary[1].Count).To(Equal(1))
+	})
+})
@@ -0,0 +1,97 @@
+/*
+Copyright 2018 Pusher Ltd.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package core
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+	logf "sigs.k8s.io/controller-runtime/pkg/runtime/log"
+)
+
+// inFlightReconciles records the workloads whose reconcile is still running
+// after timing out, so that they aren't reconciled concurrently
+type inFlightReconciles struct {
+	lock    sync.Mutex
+	running map[types.UID]struct{}
+}
+
+// newInFlightReconciles constructs an empty inFlightReconciles
+func newInFlightReconciles() *inFlightReconciles {
+	return &inFlightReconciles{running: make(map[types.UID]struct{})}
+}
+
+// start records the workload as running, returning false if it already is
+func (r *inFlightReconciles) start(uid types.UID) bool {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	if _, ok := r.running[uid]; ok {
+		return false
+	}
+	r.running[uid] = struct{}{}
+	return true
+}
+
+// finish records that the workload is no longer running
+func (r *inFlightReconciles) finish(uid types.UID) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	delete(r.running, uid)
+}
+
+// reconcileResult is the outcome of a reconcile run by handleWithTimeout
+type reconcileResult struct {
+	result reconcile.Result
+	err    error
+}
+
+// handleWithTimeout reconciles the workload, giving up after the
+// ReconcileTimeout.
+// A reconcile that times out keeps running in the background, as reads from
+// the API server can't be cancelled, but the worker is freed and the workload
+// is requeued with backoff by returning an error. The workload isn't
+// reconciled again until the background reconcile has finished
+func (h *Handler) handleWithTimeout(instance Object) (reconcile.Result, error) {
+	if h.options.ReconcileTimeout <= 0 {
+		return h.handlePodController(instance)
+	}
+	log := logf.Log.WithName("wave")
+
+	if !h.inFlight.start(instance.GetUID()) {
+		return reconcile.Result{}, fmt.Errorf("previous reconcile of %s/%s is still running", instance.GetNamespace(), instance.GetName())
+	}
+
+	done := make(chan reconcileResult, 1)
+	go func() {
+		defer h.inFlight.finish(instance.GetUID())
+		result, err := h.handlePodController(instance)
+		done <- reconcileResult{result: result, err: err}
+	}()
+
+	select {
+	case r := <-done:
+		return r.result, r.err
+	case <-time.After(h.options.ReconcileTimeout):
+		log.V(0).Info("Reconcile timed out, requeueing", "namespace", instance.GetNamespace(), "name", instance.GetName(), "timeout", h.options.ReconcileTimeout.String())
+		h.recorder.Eventf(instance, corev1.EventTypeWarning, "ReconcileTimeout", "Reconciling %s did not complete within %s, requeueing", kindOf(instance), h.options.ReconcileTimeout)
+		return reconcile.Result{}, fmt.Errorf("reconcile of %s/%s timed out after %s", instance.GetNamespace(), instance.GetName(), h.options.ReconcileTimeout)
+	}
+}
@@ -0,0 +1,141 @@
+/*
+Copyright 2018 Pusher Ltd.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package core
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/pusher/wave/test/utils"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/manager"
+)
+
+// slowClient delays every Get of a ConfigMap
+type slowClient struct {
+	client.Client
+	delay time.Duration
+}
+
+func (c *slowClient) Get(ctx context.Context, key client.ObjectKey, obj runtime.Object) error {
+	if _, ok := obj.(*corev1.ConfigMap); ok {
+		time.Sleep(c.delay)
+	}
+	return c.Client.Get(ctx, key, obj)
+}
+
+var _ = Describe("Wave reconcile timeout Suite", func() {
+	var c client.Client
+	var m utils.Matcher
+	var h *Handler
+	var recorder *record.FakeRecorder
+	var deployment *appsv1.Deployment
+	var mgrStopped *sync.WaitGroup
+	var stopMgr chan struct{}
+
+	const timeout = time.Second * 5
+	const reconcileTimeout = time.Millisecond * 100
+	const delay = time.Second
+
+	BeforeEach(func() {
+		mgr, err := manager.New(cfg, manager.Options{})
+		Expect(err).NotTo(HaveOccurred())
+		c = mgr.GetClient()
+		m = utils.Matcher{Client: c}
+
+		recorder = record.NewFakeRecorder(10)
+		h = NewHandler(&slowClient{Client: c, delay: delay}, recorder, Options{ReconcileTimeout: reconcileTimeout})
+
+		stopMgr, mgrStopped = StartTestManager(mgr)
+
+		for _, obj := range []Object{
+			utils.ExampleConfigMap1.DeepCopy(),
+			utils.ExampleConfigMap2.DeepCopy(),
+			utils.ExampleSecret1.DeepCopy(),
+			utils.ExampleSecret2.DeepCopy(),
+		} {
+			m.Create(obj).Should(Succeed())
+			m.Get(obj, timeout).Should(Succeed())
+		}
+
+		deployment = utils.ExampleDeployment.DeepCopy()
+		deployment.SetAnnotations(map[string]string{RequiredAnnotation: "true"})
+		m.Create(deployment).Should(Succeed())
+		m.Get(deployment, timeout).Should(Succeed())
+	})
+
+	AfterEach(func() {
+		// Wait for any abandoned reconcile to finish before cleaning up
+		Eventually(func() bool {
+			if !h.inFlight.start(deployment.GetUID()) {
+				return false
+			}
+			h.inFlight.finish(deployment.GetUID())
+			return true
+		}, timeout).Should(BeTrue())
+
+		// Make sure to delete the finalizer so the Deployment can be deleted
+		m.Get(deployment, timeout).Should(Succeed())
+		deployment.SetFinalizers([]string{})
+		m.Update(deployment).Should(Succeed())
+
+		close(stopMgr)
+		mgrStopped.Wait()
+
+		utils.DeleteAll(cfg, timeout,
+			&appsv1.DeploymentList{},
+			&corev1.ConfigMapList{},
+			&corev1.SecretList{},
+			&corev1.EventList{},
+		)
+	})
+
+	It("Gives up on a slow reconcile with a Warning and an error to requeue", func() {
+		start := time.Now()
+		_, err := h.HandleDeployment(deployment.DeepCopy())
+		Expect(err).To(HaveOccurred())
+		Expect(err.Error()).To(ContainSubstring("timed out"))
+		Expect(time.Since(start)).To(BeNumerically("<", delay))
+
+		var event string
+		Expect(recorder.Events).To(Receive(&event))
+		Expect(event).To(HavePrefix("Warning ReconcileTimeout"))
+	})
+
+	It("Doesn't reconcile the workload again until the slow reconcile finishes", func() {
+		_, err := h.HandleDeployment(deployment.DeepCopy())
+		Expect(err).To(HaveOccurred())
+
+		_, err = h.HandleDeployment(deployment.DeepCopy())
+		Expect(err).To(HaveOccurred())
+		Expect(err.Error()).To(ContainSubstring("still running"))
+	})
+
+	It("Completes reconciles that finish within the timeout", func() {
+		h.Client = c
+		_, err := h.HandleDeployment(deployment.DeepCopy())
+		Expect(err).NotTo(HaveOccurred())
+		m.Eventually(deployment, timeout).Should(utils.WithPodTemplateAnnotations(HaveKey(ConfigHashAnnotation)))
+	})
+})
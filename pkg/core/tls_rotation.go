@@ -0,0 +1,40 @@
+/*
+Copyright 2018 Pusher Ltd.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package core
+
+import (
+	"sort"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+// rotatedTLSSecrets returns the names of the kubernetes.io/tls Secrets among
+// the changed children, sorted so that events are deterministic.
+// No names are returned unless TLSRotationEvents is enabled
+func (h *Handler) rotatedTLSSecrets(changed []Object) []string {
+	if !h.options.TLSRotationEvents {
+		return nil
+	}
+	names := []string{}
+	for _, child := range changed {
+		if secret, ok := child.(*corev1.Secret); ok && secret.Type == corev1.SecretTypeTLS {
+			names = append(names, secret.GetName())
+		}
+	}
+	sort.Strings(names)
+	return names
+}
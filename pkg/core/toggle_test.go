@@ -0,0 +1,167 @@
+/*
+Copyright 2018 Pusher Ltd.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package core
+
+import (
+	"sync"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/pusher/wave/test/utils"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/manager"
+)
+
+var _ = Describe("Wave annotation toggle Suite", func() {
+	var c client.Client
+	var h *Handler
+	var m utils.Matcher
+	var deployment *appsv1.Deployment
+	var children []Object
+	var ownerRef metav1.OwnerReference
+	var mgrStopped *sync.WaitGroup
+	var stopMgr chan struct{}
+
+	const timeout = time.Second * 5
+
+	// setEnabled updates the required annotation on the latest version of the
+	// Deployment
+	var setEnabled = func(enabled bool) {
+		m.Get(deployment, timeout).Should(Succeed())
+		annotations := deployment.GetAnnotations()
+		if annotations == nil {
+			annotations = make(map[string]string)
+		}
+		delete(annotations, RequiredAnnotation)
+		if enabled {
+			annotations[RequiredAnnotation] = "true"
+		}
+		deployment.SetAnnotations(annotations)
+		m.Update(deployment).Should(Succeed())
+	}
+
+	// handleLatest reconciles the Deployment once the cache has caught up with
+	// its latest version
+	var handleLatest = func() {
+		latest := deployment.DeepCopy()
+		m.Eventually(latest, timeout).Should(WithTransform(func(obj *appsv1.Deployment) string {
+			return obj.GetResourceVersion()
+		}, Equal(deployment.GetResourceVersion())))
+		_, err := h.HandleDeployment(latest)
+		Expect(err).NotTo(HaveOccurred())
+		m.Get(deployment, timeout).Should(Succeed())
+	}
+
+	var expectManaged = func() {
+		m.Eventually(deployment, timeout).Should(utils.WithFinalizers(ContainElement(FinalizerString)))
+		for _, obj := range children {
+			m.Eventually(obj, timeout).Should(utils.WithOwnerReferences(ContainElement(ownerRef)))
+		}
+	}
+
+	var expectUnmanaged = func() {
+		m.Eventually(deployment, timeout).Should(utils.WithFinalizers(Not(ContainElement(FinalizerString))))
+		for _, obj := range children {
+			m.Eventually(obj, timeout).Should(utils.WithOwnerReferences(Not(ContainElement(ownerRef))))
+		}
+	}
+
+	BeforeEach(func() {
+		mgr, err := manager.New(cfg, manager.Options{})
+		Expect(err).NotTo(HaveOccurred())
+		c = mgr.GetClient()
+		m = utils.Matcher{Client: c}
+		h = NewHandler(c, mgr.GetRecorder("wave"), Options{})
+
+		stopMgr, mgrStopped = StartTestManager(mgr)
+
+		children = []Object{
+			utils.ExampleConfigMap1.DeepCopy(),
+			utils.ExampleConfigMap2.DeepCopy(),
+			utils.ExampleSecret1.DeepCopy(),
+			utils.ExampleSecret2.DeepCopy(),
+		}
+		for _, obj := range children {
+			m.Create(obj).Should(Succeed())
+			m.Get(obj, timeout).Should(Succeed())
+		}
+
+		deployment = utils.ExampleDeployment.DeepCopy()
+		m.Create(deployment).Should(Succeed())
+		m.Get(deployment, timeout).Should(Succeed())
+		ownerRef = utils.GetOwnerRef(deployment)
+	})
+
+	AfterEach(func() {
+		// Make sure to delete the finalizer so the Deployment can be deleted
+		m.Get(deployment, timeout).Should(Succeed())
+		deployment.SetFinalizers([]string{})
+		m.Update(deployment).Should(Succeed())
+
+		close(stopMgr)
+		mgrStopped.Wait()
+
+		utils.DeleteAll(cfg, timeout,
+			&appsv1.DeploymentList{},
+			&corev1.ConfigMapList{},
+			&corev1.SecretList{},
+			&corev1.EventList{},
+		)
+	})
+
+	for _, finallyEnabled := range []bool{true, false} {
+		enabled := finallyEnabled
+		It("Converges to the final annotation value after rapid toggles", func() {
+			// Toggle the annotation several times, only reconciling some of the
+			// versions, as happens when updates are batched by the informer
+			for i := 0; i < 5; i++ {
+				setEnabled(i%2 == 0)
+				if i%2 == 0 {
+					handleLatest()
+				}
+			}
+
+			setEnabled(!enabled)
+			setEnabled(enabled)
+			handleLatest()
+
+			if enabled {
+				expectManaged()
+			} else {
+				expectUnmanaged()
+			}
+		})
+	}
+
+	It("Cleans up children of a partially reconciled workload once it is disabled", func() {
+		// Simulate a reconcile that added the OwnerReferences but was disabled
+		// before the finalizer was added
+		for _, obj := range children {
+			m.Get(obj, timeout).Should(Succeed())
+			obj.SetOwnerReferences([]metav1.OwnerReference{getOwnerReference(deployment)})
+			m.Update(obj).Should(Succeed())
+			m.Eventually(obj, timeout).Should(utils.WithOwnerReferences(ContainElement(ownerRef)))
+		}
+
+		handleLatest()
+		expectUnmanaged()
+	})
+})
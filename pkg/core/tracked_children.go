@@ -0,0 +1,51 @@
+/*
+Copyright 2018 Pusher Ltd.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package core
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// setTrackedChildren records the children hashed for the workload in its
+// TrackedChildrenAnnotation, sorted, as Kind/name.
+// Children in other namespaces are listed as Kind/namespace/name. Missing
+// optional children, which are hashed as absent, aren't listed.
+// The annotation is removed if no children are listed
+func setTrackedChildren(obj Object, children []Object) {
+	names := []string{}
+	for _, child := range withoutAbsentChildren(children) {
+		if child.GetNamespace() != obj.GetNamespace() {
+			names = append(names, fmt.Sprintf("%s/%s/%s", kindOf(child), child.GetNamespace(), child.GetName()))
+			continue
+		}
+		names = append(names, fmt.Sprintf("%s/%s", kindOf(child), child.GetName()))
+	}
+	sort.Strings(names)
+
+	annotations := obj.GetAnnotations()
+	if annotations == nil {
+		annotations = make(map[string]string)
+	}
+	if len(names) == 0 {
+		delete(annotations, TrackedChildrenAnnotation)
+	} else {
+		annotations[TrackedChildrenAnnotation] = strings.Join(names, ",")
+	}
+	obj.SetAnnotations(annotations)
+}
@@ -0,0 +1,66 @@
+/*
+Copyright 2018 Pusher Ltd.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package core
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/pusher/wave/test/utils"
+	appsv1 "k8s.io/api/apps/v1"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+var _ = Describe("Wave tracked children Suite", func() {
+	Context("setTrackedChildren", func() {
+		var deployment *appsv1.Deployment
+
+		BeforeEach(func() {
+			deployment = utils.ExampleDeployment.DeepCopy()
+		})
+
+		It("lists the children sorted by kind and name", func() {
+			setTrackedChildren(deployment, []Object{
+				utils.ExampleSecret2.DeepCopy(),
+				utils.ExampleConfigMap2.DeepCopy(),
+				utils.ExampleSecret1.DeepCopy(),
+				utils.ExampleConfigMap1.DeepCopy(),
+			})
+			Expect(deployment.GetAnnotations()).To(HaveKeyWithValue(TrackedChildrenAnnotation,
+				"ConfigMap/example1,ConfigMap/example2,Secret/example1,Secret/example2"))
+		})
+
+		It("lists children in other namespaces with their namespace", func() {
+			other := utils.ExampleConfigMap1.DeepCopy()
+			other.SetNamespace("other")
+			setTrackedChildren(deployment, []Object{utils.ExampleConfigMap1.DeepCopy(), other})
+			Expect(deployment.GetAnnotations()).To(HaveKeyWithValue(TrackedChildrenAnnotation,
+				"ConfigMap/example1,ConfigMap/other/example1"))
+		})
+
+		It("doesn't list missing optional children", func() {
+			absent := newAbsentChild("ConfigMap", types.NamespacedName{Namespace: "default", Name: "optional"})
+			setTrackedChildren(deployment, []Object{utils.ExampleConfigMap1.DeepCopy(), absent})
+			Expect(deployment.GetAnnotations()).To(HaveKeyWithValue(TrackedChildrenAnnotation, "ConfigMap/example1"))
+		})
+
+		It("removes the annotation without children", func() {
+			deployment.SetAnnotations(map[string]string{TrackedChildrenAnnotation: "ConfigMap/example1"})
+			setTrackedChildren(deployment, []Object{})
+			Expect(deployment.GetAnnotations()).NotTo(HaveKey(TrackedChildrenAnnotation))
+		})
+	})
+})
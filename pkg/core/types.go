@@ -33,6 +33,135 @@ const (
 	// RequiredAnnotation is the key of the annotation on the Deployment that Wave
 	// checks for before processing the deployment
 	RequiredAnnotation = "wave.pusher.com/update-on-config-change"
+
+	// RolloutTriggerAnnotation is the key of the annotation on the workload
+	// that chooses the RolloutTrigger used to store the configuration hash
+	RolloutTriggerAnnotation = "wave.pusher.com/rollout-trigger"
+
+	// HashTargetAnnotation is the key of the annotation on the workload that
+	// chooses where on its PodTemplate's metadata the configuration hash is
+	// recorded: in a label for HashTargetLabel, or in the annotation keyed by
+	// any other value
+	HashTargetAnnotation = "wave.pusher.com/hash-target"
+
+	// HashTargetKeyAnnotation is the key of the annotation on the workload
+	// recording the custom PodTemplate annotation its configuration hash was
+	// last stamped in, so that the hash can be removed from it when the
+	// HashTargetAnnotation changes
+	HashTargetKeyAnnotation = "wave.pusher.com/hash-target-key"
+
+	// ConfigHashEnvVar is the name of the environment variable that holds the
+	// configuration hash when using the RolloutTriggerEnvVar
+	ConfigHashEnvVar = "WAVE_CONFIG_HASH"
+
+	// InstanceAnnotation is the key of the annotation on the workload that
+	// holds the ID of the Wave instance managing it.
+	// Workloads claimed by another instance are ignored
+	InstanceAnnotation = "wave.pusher.com/instance"
+
+	// HandoffAnnotation is the key of the annotation on the workload naming
+	// the ID of the Wave instance it is being handed off to.
+	// The workload is ignored by every other instance, including the one that
+	// claimed it, and the named instance claims it on its next reconcile
+	HandoffAnnotation = "wave.pusher.com/handoff-to"
+
+	// ExtraConfigMapsAnnotation is the key of the annotation on the workload
+	// listing ConfigMaps to include in the configuration hash in addition to
+	// those referenced in the PodTemplate.
+	// The value is a comma separated list of names, optionally prefixed by a
+	// namespace (eg. "config,other-namespace/config")
+	ExtraConfigMapsAnnotation = "wave.pusher.com/extra-configmaps"
+
+	// ExtraSecretsAnnotation is the key of the annotation on the workload
+	// listing Secrets to include in the configuration hash in addition to those
+	// referenced in the PodTemplate.
+	// The value has the same format as the ExtraConfigMapsAnnotation
+	ExtraSecretsAnnotation = "wave.pusher.com/extra-secrets"
+
+	// ExtraChildrenAnnotation is the key of the annotation on the workload
+	// listing children of the additional kinds configured in the Options to
+	// include in the configuration hash.
+	// The value is a comma separated list of names, each prefixed by the kind
+	// of the child and optionally a namespace
+	// (eg. "Certificate:tls,Certificate:shared/ca")
+	ExtraChildrenAnnotation = "wave.pusher.com/extra-children"
+
+	// PauseAnnotation is the key of the annotation on the PauseConfigMap that
+	// pauses rollouts while set to "true", eg. by automation during cluster
+	// scaling events
+	PauseAnnotation = "wave.pusher.com/pause-rollouts"
+
+	// SkipFinalizerAnnotation is the key of the annotation on the workload
+	// that, when set to "true", stops Wave from adding its finalizer so that
+	// deletion of the workload is never blocked
+	SkipFinalizerAnnotation = "wave.pusher.com/skip-finalizer"
+
+	// CompletePartitionAnnotation is the key of the annotation on a
+	// StatefulSet that, when set to "true", asks Wave to set the partition of
+	// its RollingUpdate strategy to 0 so that a paused rollout completes.
+	// Wave removes the annotation once the partition has been updated
+	CompletePartitionAnnotation = "wave.pusher.com/complete-partition"
+
+	// PokeAnnotation is the key of an annotation on the workload whose value
+	// can be changed to force a reconcile, eg. when debugging.
+	// While it is present the configuration hash is recalculated from the
+	// children without using cached content. The annotation is never hashed
+	PokeAnnotation = "wave.pusher.com/poke"
+
+	// AdoptedConfigHashAnnotation is the key of the annotation on the
+	// workload's metadata that holds the configuration hash it was adopted
+	// with when AdoptWithoutRollout is enabled
+	AdoptedConfigHashAnnotation = "wave.pusher.com/adopted-config-hash"
+
+	// HashVolumesAnnotation is the key of the annotation on the workload
+	// listing the names of the volumes in its PodTemplate whose ConfigMaps and
+	// Secrets are the only children included in the configuration hash.
+	// Other children still receive OwnerReferences.
+	// The value is a comma separated list of volume names (eg. "config,tls")
+	HashVolumesAnnotation = "wave.pusher.com/hash-volumes"
+
+	// HashKeysAnnotation is the key of the annotation, on either a ConfigMap
+	// or the workload, listing the only keys of the ConfigMap's data included
+	// in the configuration hash. On the workload it applies to all of its
+	// ConfigMaps, taking precedence over their own annotations.
+	// Listed keys missing from a ConfigMap are hashed as empty.
+	// The value is a comma separated list of keys (eg. "app.yaml,db.conf")
+	HashKeysAnnotation = "wave.pusher.com/config-hash-keys"
+
+	// IgnoreAnnotation is the key of the annotation on the workload listing
+	// the names of ConfigMaps and Secrets that Wave ignores, eg. those the
+	// application reloads without a restart. Ignored children are neither
+	// hashed nor given OwnerReferences.
+	// The value is a comma separated list of names, each optionally prefixed
+	// by a namespace (eg. "flags,other/tls")
+	IgnoreAnnotation = "wave.pusher.com/ignore"
+
+	// HashHistoryAnnotation is the key of the annotation on the workload's
+	// metadata that holds the last configuration hashes Wave recorded on it,
+	// oldest first, when HashHistoryLimit is set
+	HashHistoryAnnotation = "wave.pusher.com/config-hash-history"
+
+	// ForceSyncAnnotation is the key of an annotation on the workload holding
+	// a nonce. Whenever the nonce changes, Wave recalculates the configuration
+	// hash from children read live, without any cached content, and rewrites
+	// it even if it is unchanged
+	ForceSyncAnnotation = "wave.pusher.com/force-sync"
+
+	// ForceSyncedAnnotation is the key of the annotation on the workload's
+	// metadata that holds the last ForceSyncAnnotation nonce Wave acted on, so
+	// that each nonce is only acted on once
+	ForceSyncedAnnotation = "wave.pusher.com/force-synced"
+
+	// TrackedChildrenAnnotation is the key of the annotation on the workload's
+	// metadata that lists the children Wave hashed for it, when TrackChildren
+	// is set
+	TrackedChildrenAnnotation = "wave.pusher.com/tracked-children"
+
+	// FreezeAnnotation is the key of the annotation on the workload that, when
+	// set to "true", freezes the configuration hash recorded on it, eg. during
+	// an incident. Wave still maintains the OwnerReferences on its children
+	// and its finalizer, and records the latest hash once it is unfrozen
+	FreezeAnnotation = "wave.pusher.com/freeze"
 )
 
 // Object is used as a helper interface when passing Kubernetes resources
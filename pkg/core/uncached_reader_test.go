@@ -0,0 +1,147 @@
+/*
+Copyright 2018 Pusher Ltd.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package core
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/pusher/wave/test/utils"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/manager"
+)
+
+var _ = Describe("Wave uncached reader Suite", func() {
+	var c client.Client
+	var live client.Client
+	var m utils.Matcher
+	var mgr manager.Manager
+	var deployment *appsv1.Deployment
+	var shared *corev1.Secret
+	var mgrStopped *sync.WaitGroup
+	var stopMgr chan struct{}
+
+	const timeout = time.Second * 5
+
+	BeforeEach(func() {
+		var err error
+		// Restrict the cache to the namespace of the example objects
+		mgr, err = manager.New(cfg, manager.Options{Namespace: utils.ExampleDeployment.GetNamespace()})
+		Expect(err).NotTo(HaveOccurred())
+		c = mgr.GetClient()
+		m = utils.Matcher{Client: c}
+
+		live, err = client.New(cfg, client.Options{})
+		Expect(err).NotTo(HaveOccurred())
+
+		stopMgr, mgrStopped = StartTestManager(mgr)
+
+		for _, obj := range []Object{
+			utils.ExampleConfigMap1.DeepCopy(),
+			utils.ExampleConfigMap2.DeepCopy(),
+			utils.ExampleSecret1.DeepCopy(),
+			utils.ExampleSecret2.DeepCopy(),
+		} {
+			m.Create(obj).Should(Succeed())
+			m.Get(obj, timeout).Should(Succeed())
+		}
+
+		// Namespaces can't be deleted in the test environment, so the namespace
+		// may remain from a previous test
+		ns := &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "other"}}
+		err = live.Create(context.TODO(), ns)
+		if !errors.IsAlreadyExists(err) {
+			Expect(err).NotTo(HaveOccurred())
+		}
+
+		// Create a Secret outside of the cache
+		shared = utils.ExampleSecret1.DeepCopy()
+		shared.SetNamespace("other")
+		shared.SetName("shared")
+		Expect(live.Create(context.TODO(), shared)).To(Succeed())
+		Eventually(func() error {
+			key := types.NamespacedName{Namespace: shared.GetNamespace(), Name: shared.GetName()}
+			return live.Get(context.TODO(), key, &corev1.Secret{})
+		}, timeout).Should(Succeed())
+
+		deployment = utils.ExampleDeployment.DeepCopy()
+		deployment.SetAnnotations(map[string]string{
+			RequiredAnnotation:     "true",
+			ExtraSecretsAnnotation: "other/shared",
+		})
+		m.Create(deployment).Should(Succeed())
+		m.Get(deployment, timeout).Should(Succeed())
+	})
+
+	AfterEach(func() {
+		// Make sure to delete the finalizer so the Deployment can be deleted
+		m.Get(deployment, timeout).Should(Succeed())
+		deployment.SetFinalizers([]string{})
+		m.Update(deployment).Should(Succeed())
+
+		close(stopMgr)
+		mgrStopped.Wait()
+
+		utils.DeleteAll(cfg, timeout,
+			&appsv1.DeploymentList{},
+			&corev1.ConfigMapList{},
+			&corev1.SecretList{},
+			&corev1.EventList{},
+		)
+	})
+
+	It("Fails to fetch a child outside of the cache without an UncachedReader", func() {
+		h := NewHandler(c, mgr.GetRecorder("wave"), Options{})
+		_, err := h.getCurrentChildren(deployment)
+		Expect(err).To(HaveOccurred())
+	})
+
+	Context("With an UncachedReader", func() {
+		var h *Handler
+
+		BeforeEach(func() {
+			h = NewHandler(c, mgr.GetRecorder("wave"), Options{UncachedReader: live})
+		})
+
+		It("Fetches the child outside of the cache", func() {
+			children, err := h.getCurrentChildren(deployment)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(children).To(HaveLen(5))
+			Expect(children).To(ContainElement(WithTransform(func(obj Object) string {
+				return obj.GetNamespace() + "/" + obj.GetName()
+			}, Equal("other/shared"))))
+		})
+
+		It("Includes the child outside of the cache in the hash", func() {
+			_, err := h.HandleDeployment(deployment)
+			Expect(err).NotTo(HaveOccurred())
+
+			m.Eventually(deployment, timeout).Should(utils.WithPodTemplateAnnotations(SatisfyAll(
+				HaveKey(ConfigHashAnnotation),
+				Not(HaveKeyWithValue(ConfigHashAnnotation, exampleHash)),
+			)))
+		})
+	})
+})
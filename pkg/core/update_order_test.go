@@ -0,0 +1,125 @@
+/*
+Copyright 2018 Pusher Ltd.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package core
+
+import (
+	"sync"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/pusher/wave/test/utils"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/manager"
+)
+
+var _ = Describe("Wave update order Suite", func() {
+	var c client.Client
+	var m utils.Matcher
+	var recorder record.EventRecorder
+	var children []Object
+	var deployments map[UpdateOrder]*appsv1.Deployment
+	var mgrStopped *sync.WaitGroup
+	var stopMgr chan struct{}
+
+	const timeout = time.Second * 5
+
+	orders := []UpdateOrder{UpdateOrderOwnerReferencesFirst, UpdateOrderHashFirst}
+
+	BeforeEach(func() {
+		mgr, err := manager.New(cfg, manager.Options{})
+		Expect(err).NotTo(HaveOccurred())
+		c = mgr.GetClient()
+		m = utils.Matcher{Client: c}
+		recorder = mgr.GetRecorder("wave")
+
+		stopMgr, mgrStopped = StartTestManager(mgr)
+
+		children = []Object{
+			utils.ExampleConfigMap1.DeepCopy(),
+			utils.ExampleConfigMap2.DeepCopy(),
+			utils.ExampleSecret1.DeepCopy(),
+			utils.ExampleSecret2.DeepCopy(),
+		}
+		for _, obj := range children {
+			m.Create(obj).Should(Succeed())
+			m.Get(obj, timeout).Should(Succeed())
+		}
+
+		// Create a Deployment reconciled with each order
+		deployments = make(map[UpdateOrder]*appsv1.Deployment)
+		for _, order := range orders {
+			deployment := utils.ExampleDeployment.DeepCopy()
+			deployment.SetName(string(order))
+			deployment.SetAnnotations(map[string]string{RequiredAnnotation: "true"})
+			m.Create(deployment).Should(Succeed())
+			m.Get(deployment, timeout).Should(Succeed())
+			deployments[order] = deployment
+		}
+	})
+
+	AfterEach(func() {
+		// Make sure to delete the finalizers so the Deployments can be deleted
+		for _, deployment := range deployments {
+			m.Get(deployment, timeout).Should(Succeed())
+			deployment.SetFinalizers([]string{})
+			m.Update(deployment).Should(Succeed())
+		}
+
+		close(stopMgr)
+		mgrStopped.Wait()
+
+		utils.DeleteAll(cfg, timeout,
+			&appsv1.DeploymentList{},
+			&corev1.ConfigMapList{},
+			&corev1.SecretList{},
+			&corev1.EventList{},
+		)
+	})
+
+	It("Defaults to updating OwnerReferences first", func() {
+		h := NewHandler(c, recorder, Options{})
+		Expect(h.options.UpdateOrder).To(Equal(UpdateOrderOwnerReferencesFirst))
+	})
+
+	It("Converges to the same state with either order", func() {
+		for _, order := range orders {
+			h := NewHandler(c, recorder, Options{UpdateOrder: order})
+			_, err := h.HandleDeployment(deployments[order])
+			Expect(err).NotTo(HaveOccurred())
+		}
+
+		for _, order := range orders {
+			deployment := deployments[order]
+			m.Eventually(deployment, timeout).Should(utils.WithFinalizers(ContainElement(FinalizerString)))
+			m.Eventually(deployment, timeout).Should(utils.WithPodTemplateAnnotations(HaveKeyWithValue(ConfigHashAnnotation, exampleHash)))
+
+			ownerRef := utils.GetOwnerRef(deployment)
+			for _, obj := range children {
+				m.Eventually(obj, timeout).Should(utils.WithOwnerReferences(ContainElement(ownerRef)))
+			}
+		}
+
+		first := deployments[UpdateOrderOwnerReferencesFirst]
+		second := deployments[UpdateOrderHashFirst]
+		Expect(second.GetFinalizers()).To(Equal(first.GetFinalizers()))
+		Expect(second.Spec.Template.GetAnnotations()).To(Equal(first.Spec.Template.GetAnnotations()))
+	})
+})
@@ -0,0 +1,88 @@
+/*
+Copyright 2018 Pusher Ltd.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package core
+
+import (
+	"fmt"
+	"strings"
+)
+
+// ValidateAnnotations checks that the workload's Wave annotations are well
+// formed and consistent with each other, returning an error describing every
+// problem found.
+// Only the workload itself is inspected, its children are never fetched
+func (h *Handler) ValidateAnnotations(obj Object) error {
+	problems := []string{}
+	annotations := obj.GetAnnotations()
+
+	for _, annotation := range []string{ExtraConfigMapsAnnotation, ExtraSecretsAnnotation, IgnoreAnnotation} {
+		if err := validateChildKeys(annotation, annotations[annotation]); err != nil {
+			problems = append(problems, err.Error())
+		}
+	}
+
+	if _, err := h.getExtraChildKeys(obj); err != nil {
+		problems = append(problems, err.Error())
+	}
+	if _, err := getHashVolumeChildren(obj, nil); err != nil {
+		problems = append(problems, err.Error())
+	}
+
+	if trigger, ok := annotations[RolloutTriggerAnnotation]; ok {
+		switch RolloutTrigger(trigger) {
+		case RolloutTriggerPodAnnotation, RolloutTriggerEnvVar:
+		default:
+			problems = append(problems, fmt.Sprintf("invalid %s annotation %q, expected %s or %s", RolloutTriggerAnnotation, trigger, RolloutTriggerPodAnnotation, RolloutTriggerEnvVar))
+		}
+	}
+
+	if target, ok := annotations[HashTargetAnnotation]; ok && target != "" && target != HashTargetLabel {
+		if err := validateHashTargetKey(target); err != nil {
+			problems = append(problems, err.Error())
+		}
+	}
+
+	// Requiring updates is pointless if every child is ignored
+	if _, ok := annotations[IgnoreAnnotation]; ok && hasRequiredAnnotation(obj, h.options.RequiredAnnotation, h.options.RequiredAnnotationValues) {
+		configMaps, secrets := getChildKeysByType(obj)
+		if len(configMaps)+len(secrets) > 0 && len(withoutAnnotatedChildKeys(obj, configMaps))+len(withoutAnnotatedChildKeys(obj, secrets)) == 0 {
+			problems = append(problems, fmt.Sprintf("%s annotation requires updates but %s annotation ignores every child", h.options.RequiredAnnotation, IgnoreAnnotation))
+		}
+	}
+
+	if len(problems) > 0 {
+		return fmt.Errorf("invalid Wave annotations: %s", strings.Join(problems, "; "))
+	}
+	return nil
+}
+
+// validateChildKeys checks that every entry of a comma separated list of
+// child names, as parsed by parseChildKeys, is a name optionally prefixed by
+// a namespace
+func validateChildKeys(annotation, value string) error {
+	for _, ref := range strings.Split(value, ",") {
+		ref = strings.TrimSpace(ref)
+		if ref == "" {
+			continue
+		}
+		parts := strings.Split(ref, "/")
+		if len(parts) > 2 || parts[0] == "" || parts[len(parts)-1] == "" {
+			return fmt.Errorf("invalid child %q in %s annotation, expected name or namespace/name", ref, annotation)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,108 @@
+/*
+Copyright 2018 Pusher Ltd.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package core
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/pusher/wave/test/utils"
+	appsv1 "k8s.io/api/apps/v1"
+)
+
+var _ = Describe("Wave validate annotations Suite", func() {
+	var h *Handler
+	var deployment *appsv1.Deployment
+
+	BeforeEach(func() {
+		h = NewHandler(nil, nil, Options{})
+		deployment = utils.ExampleDeployment.DeepCopy()
+	})
+
+	It("accepts a workload without annotations", func() {
+		Expect(h.ValidateAnnotations(deployment)).To(Succeed())
+	})
+
+	It("accepts well formed annotations", func() {
+		deployment.SetAnnotations(map[string]string{
+			RequiredAnnotation:        "true",
+			ExtraConfigMapsAnnotation: "extra, other/extra",
+			IgnoreAnnotation:          "example1",
+			HashVolumesAnnotation:     "secret1",
+			RolloutTriggerAnnotation:  "env",
+		})
+		Expect(h.ValidateAnnotations(deployment)).To(Succeed())
+	})
+
+	It("rejects malformed child lists", func() {
+		deployment.SetAnnotations(map[string]string{
+			ExtraSecretsAnnotation: "a/b/c",
+			IgnoreAnnotation:       "other/",
+		})
+		err := h.ValidateAnnotations(deployment)
+		Expect(err).To(HaveOccurred())
+		Expect(err.Error()).To(ContainSubstring(`invalid child "a/b/c" in wave.pusher.com/extra-secrets annotation`))
+		Expect(err.Error()).To(ContainSubstring(`invalid child "other/" in wave.pusher.com/ignore annotation`))
+	})
+
+	It("rejects unknown volumes and rollout triggers", func() {
+		deployment.SetAnnotations(map[string]string{
+			HashVolumesAnnotation:    "missing",
+			RolloutTriggerAnnotation: "restart",
+		})
+		err := h.ValidateAnnotations(deployment)
+		Expect(err).To(HaveOccurred())
+		Expect(err.Error()).To(ContainSubstring(`unknown volume "missing"`))
+		Expect(err.Error()).To(ContainSubstring(`invalid wave.pusher.com/rollout-trigger annotation "restart"`))
+	})
+
+	It("rejects custom hash targets that aren't annotation keys", func() {
+		deployment.SetAnnotations(map[string]string{HashTargetAnnotation: "not a key"})
+		err := h.ValidateAnnotations(deployment)
+		Expect(err).To(HaveOccurred())
+		Expect(err.Error()).To(ContainSubstring(`invalid wave.pusher.com/hash-target annotation "not a key"`))
+
+		deployment.SetAnnotations(map[string]string{HashTargetAnnotation: "example.com/config-version"})
+		Expect(h.ValidateAnnotations(deployment)).To(Succeed())
+	})
+
+	It("rejects kinds of extra children that aren't configured", func() {
+		deployment.SetAnnotations(map[string]string{ExtraChildrenAnnotation: "Widget:small"})
+		Expect(h.ValidateAnnotations(deployment)).NotTo(Succeed())
+	})
+
+	Context("When every child is ignored", func() {
+		BeforeEach(func() {
+			deployment.SetAnnotations(map[string]string{
+				IgnoreAnnotation: "example1,example2",
+			})
+		})
+
+		It("accepts the workload if Wave doesn't require updates", func() {
+			Expect(h.ValidateAnnotations(deployment)).To(Succeed())
+		})
+
+		It("rejects the workload if Wave requires updates", func() {
+			annotations := deployment.GetAnnotations()
+			annotations[RequiredAnnotation] = "true"
+			deployment.SetAnnotations(annotations)
+
+			err := h.ValidateAnnotations(deployment)
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(ContainSubstring("ignores every child"))
+		})
+	})
+})
@@ -0,0 +1,115 @@
+/*
+Copyright 2018 Pusher Ltd.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package core
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+
+	wavev1alpha1 "github.com/pusher/wave/pkg/apis/wave/v1alpha1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	logf "sigs.k8s.io/controller-runtime/pkg/runtime/log"
+)
+
+// waveStatusName returns the name of the WaveStatus reporting on the workload.
+// The kind is included so that workloads of different kinds with the same name
+// don't share a WaveStatus
+func waveStatusName(obj Object) string {
+	return fmt.Sprintf("%s-%s", strings.ToLower(kindOf(obj)), obj.GetName())
+}
+
+// updateWaveStatus records the outcome of reconciling the workload in its
+// WaveStatus, creating the WaveStatus if it doesn't exist.
+// If reconciling failed only the error is recorded, otherwise the applied hash
+// recorded on the workload and its children are. Nothing is recorded if no
+// hash was applied, eg. while the workload is frozen or rollouts are paused,
+// unless hashing is disabled.
+// Failing to write the WaveStatus is logged but never fails the reconcile.
+// In dry run mode the WaveStatus is never written
+func (h *Handler) updateWaveStatus(instance Object, children []Object, applied string, reconcileErr error) {
+	log := logf.Log.WithName("wave")
+
+	if h.options.DryRun {
+		log.V(1).Info("Dry run, not writing WaveStatus", "namespace", instance.GetNamespace(), "name", instance.GetName())
+		return
+	}
+	if reconcileErr == nil && applied == "" && !h.options.DisableConfigHash {
+		log.V(1).Info("No hash applied, not writing WaveStatus", "namespace", instance.GetNamespace(), "name", instance.GetName())
+		return
+	}
+
+	status := &wavev1alpha1.WaveStatus{}
+	key := types.NamespacedName{Namespace: instance.GetNamespace(), Name: waveStatusName(instance)}
+	err := h.Get(context.TODO(), key, status)
+	if err != nil && !errors.IsNotFound(err) {
+		log.Error(err, "error getting WaveStatus", "namespace", key.Namespace, "name", key.Name)
+		return
+	}
+	exists := err == nil
+
+	copy := status.DeepCopy()
+	if !exists {
+		// The WaveStatus is garbage collected along with the workload
+		copy.SetNamespace(key.Namespace)
+		copy.SetName(key.Name)
+		copy.SetOwnerReferences([]metav1.OwnerReference{getOwnerReference(instance)})
+		copy.Spec = wavev1alpha1.WaveStatusSpec{Kind: kindOf(instance), Name: instance.GetName()}
+	}
+
+	h.propagateLabels(instance, copy)
+
+	if reconcileErr != nil {
+		copy.Status.Error = reconcileErr.Error()
+	} else {
+		copy.Status.Error = ""
+		if !h.options.DisableConfigHash {
+			if applied != copy.Status.ConfigHash {
+				now := metav1.Now()
+				copy.Status.LastUpdateTime = &now
+			}
+			copy.Status.ConfigHash = applied
+		}
+		copy.Status.Children = waveStatusChildren(children)
+	}
+
+	if !exists {
+		err = h.Create(context.TODO(), copy)
+	} else if !reflect.DeepEqual(status, copy) {
+		err = h.Update(context.TODO(), copy)
+	}
+	if err != nil {
+		log.Error(err, "error writing WaveStatus", "namespace", key.Namespace, "name", key.Name)
+	}
+}
+
+// waveStatusChildren lists the children as "Kind namespace/name", sorted so
+// that the WaveStatus is only updated when the children change.
+// Missing optional children, which are hashed as absent, aren't listed.
+// No children are listed as nil, as they are read back from the API server
+func waveStatusChildren(children []Object) []string {
+	var names []string
+	for _, child := range withoutAbsentChildren(children) {
+		names = append(names, fmt.Sprintf("%s %s/%s", kindOf(child), child.GetNamespace(), child.GetName()))
+	}
+	sort.Strings(names)
+	return names
+}
@@ -17,6 +17,8 @@ limitations under the License.
 package core
 
 import (
+	"context"
+	"fmt"
 	"log"
 	"path/filepath"
 	"sync"
@@ -26,8 +28,16 @@ import (
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/gomega"
 	"github.com/pusher/wave/pkg/apis"
+	"github.com/pusher/wave/test/utils"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
 	"k8s.io/client-go/kubernetes/scheme"
 	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/envtest"
 	"sigs.k8s.io/controller-runtime/pkg/manager"
 	"sigs.k8s.io/controller-runtime/pkg/reconcile"
@@ -36,6 +46,80 @@ import (
 
 var cfg *rest.Config
 
+// exampleHash is the configuration hash of the example children alone
+var exampleHash = func() string {
+	children := []Object{}
+	for _, child := range utils.ExampleChildren() {
+		children = append(children, child)
+	}
+	hash, err := calculateConfigHash(children)
+	if err != nil {
+		panic(err)
+	}
+	return hash
+}()
+
+// hidingClient returns Secrets without their data on every other read while
+// hide is true, simulating an access quirk that intermittently hides the data
+type hidingClient struct {
+	client.Client
+	hide  bool
+	reads int
+}
+
+func (c *hidingClient) Get(ctx context.Context, key types.NamespacedName, obj runtime.Object) error {
+	err := c.Client.Get(ctx, key, obj)
+	if secret, ok := obj.(*corev1.Secret); ok && err == nil && c.hide {
+		c.reads++
+		if c.reads%2 == 0 {
+			secret.Data = nil
+		}
+	}
+	return err
+}
+
+// staleClient simulates a lagging cache by serving the copies of the
+// ConfigMaps it was given rather than reading them
+type staleClient struct {
+	client.Client
+	stale map[types.NamespacedName]*corev1.ConfigMap
+}
+
+func (s *staleClient) Get(ctx context.Context, key client.ObjectKey, obj runtime.Object) error {
+	if cm, ok := obj.(*corev1.ConfigMap); ok && s.stale[key] != nil {
+		s.stale[key].DeepCopyInto(cm)
+		return nil
+	}
+	return s.Client.Get(ctx, key, obj)
+}
+
+// denyingClient simulates an admission policy forbidding updates to
+// ConfigMaps
+type denyingClient struct {
+	client.Client
+}
+
+func (d *denyingClient) Update(ctx context.Context, obj runtime.Object) error {
+	if cm, ok := obj.(*corev1.ConfigMap); ok {
+		return errors.NewForbidden(schema.GroupResource{Resource: "configmaps"}, cm.GetName(), fmt.Errorf("denied by policy"))
+	}
+	return d.Client.Update(ctx, obj)
+}
+
+// failingClient simulates failures fetching the example1 Secret while err is
+// set
+type failingClient struct {
+	client.Client
+	err error
+}
+
+func (f *failingClient) Get(ctx context.Context, key client.ObjectKey, obj runtime.Object) error {
+	if _, ok := obj.(*corev1.Secret); ok && key.Name == utils.ExampleSecret1.GetName() && f.err != nil {
+		return f.err
+	}
+	return f.Client.Get(ctx, key, obj)
+}
+
 func TestMain(t *testing.T) {
 	RegisterFailHandler(Fail)
 	RunSpecs(t, "Wave Controller Suite")
@@ -73,6 +157,20 @@ func SetupTestReconcile(inner reconcile.Reconciler) (reconcile.Reconciler, chan
 	return fn, requests
 }
 
+// drainEvents returns the events sent to the recorder since it was last
+// drained
+func drainEvents(recorder *record.FakeRecorder) []string {
+	events := []string{}
+	for {
+		select {
+		case event := <-recorder.Events:
+			events = append(events, event)
+		default:
+			return events
+		}
+	}
+}
+
 // StartTestManager adds recFn
 func StartTestManager(mgr manager.Manager) (chan struct{}, *sync.WaitGroup) {
 	stop := make(chan struct{})
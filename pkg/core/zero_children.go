@@ -0,0 +1,58 @@
+/*
+Copyright 2018 Pusher Ltd.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package core
+
+import (
+	"fmt"
+
+	corev1 "k8s.io/api/core/v1"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+	logf "sigs.k8s.io/controller-runtime/pkg/runtime/log"
+)
+
+// referencesNoChildren checks whether the workload references no ConfigMaps,
+// Secrets or children of other kinds, in its PodTemplate, its annotations or
+// the configured JSONPath expressions
+func (h *Handler) referencesNoChildren(obj Object) (bool, error) {
+	configMaps, secrets, err := h.getChildKeys(obj)
+	if err != nil {
+		return false, err
+	}
+	extraKeys, err := h.getExtraChildKeys(obj)
+	if err != nil {
+		return false, err
+	}
+	return len(configMaps) == 0 && len(secrets) == 0 && len(extraKeys) == 0, nil
+}
+
+// handleZeroChildren leaves a workload that references no children
+// unmanaged, cleaning it up if Wave managed it previously, eg. before its last
+// child reference was removed
+func (h *Handler) handleZeroChildren(obj Object) (reconcile.Result, error) {
+	log := logf.Log.WithName("wave")
+
+	managed, err := h.wasManaged(obj)
+	if err != nil {
+		return reconcile.Result{}, fmt.Errorf("error fetching existing children: %v", err)
+	}
+	h.recorder.Eventf(obj, corev1.EventTypeNormal, "NoChildren", "%s references no ConfigMaps or Secrets, not managing it", kindOf(obj))
+	if managed {
+		log.V(0).Info("Instance references no children, cleaning up", "namespace", obj.GetNamespace(), "name", obj.GetName())
+		return h.handleDelete(obj)
+	}
+	return reconcile.Result{}, nil
+}
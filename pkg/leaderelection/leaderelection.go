@@ -0,0 +1,196 @@
+/*
+Copyright 2018 Pusher Ltd.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package leaderelection runs a manager only while it holds a leader election
+// lease, so that of several Wave replicas only the leader reconciles
+package leaderelection
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+	"time"
+
+	"k8s.io/apimachinery/pkg/util/uuid"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+	clientleaderelection "k8s.io/client-go/tools/leaderelection"
+	"k8s.io/client-go/tools/leaderelection/resourcelock"
+	"sigs.k8s.io/controller-runtime/pkg/manager"
+	logf "sigs.k8s.io/controller-runtime/pkg/runtime/log"
+)
+
+const (
+	// DefaultName is the default name of the ConfigMap holding the lease
+	DefaultName = "controller-leader-election-helper"
+
+	// DefaultLeaseDuration is the default duration standby replicas wait
+	// before taking over a lease that hasn't been renewed
+	DefaultLeaseDuration = 15 * time.Second
+
+	// DefaultRenewDeadline is the default duration the leader retries
+	// renewing its lease for before giving up leadership
+	DefaultRenewDeadline = 10 * time.Second
+
+	// DefaultRetryPeriod is the default interval between attempts to acquire
+	// or renew the lease
+	DefaultRetryPeriod = 2 * time.Second
+
+	// inClusterNamespacePath is the file the namespace of the Pod is mounted
+	// at when running in-cluster
+	inClusterNamespacePath = "/var/run/secrets/kubernetes.io/serviceaccount/namespace"
+)
+
+// Options configure the leader election lease
+type Options struct {
+	// Name is the name of the ConfigMap holding the lease.
+	// Defaults to DefaultName.
+	Name string
+
+	// Namespace is the namespace of the ConfigMap holding the lease.
+	// Defaults to the namespace Wave runs in, when running in-cluster
+	Namespace string
+
+	// Identity identifies the replica holding the lease.
+	// Defaults to the hostname followed by a random suffix.
+	Identity string
+
+	// LeaseDuration is the duration standby replicas wait before taking over
+	// a lease that hasn't been renewed.
+	// Defaults to DefaultLeaseDuration.
+	LeaseDuration time.Duration
+
+	// RenewDeadline is the duration the leader retries renewing its lease for
+	// before giving up leadership.
+	// Defaults to DefaultRenewDeadline.
+	RenewDeadline time.Duration
+
+	// RetryPeriod is the interval between attempts to acquire or renew the
+	// lease.
+	// Defaults to DefaultRetryPeriod.
+	RetryPeriod time.Duration
+}
+
+// Start blocks until the lease is acquired and then runs the manager until
+// the stop channel is closed.
+// An error is returned if the manager fails or leadership is lost, in which
+// case the caller is expected to exit so that a standby replica takes over
+func Start(cfg *rest.Config, mgr manager.Manager, opts Options, stop <-chan struct{}) error {
+	log := logf.Log.WithName("leader-election")
+
+	opts, err := setDefaults(opts)
+	if err != nil {
+		return err
+	}
+
+	client, err := kubernetes.NewForConfig(cfg)
+	if err != nil {
+		return fmt.Errorf("error creating leader election client: %v", err)
+	}
+	lock, err := resourcelock.New(resourcelock.ConfigMapsResourceLock,
+		opts.Namespace,
+		opts.Name,
+		client.CoreV1(),
+		resourcelock.ResourceLockConfig{
+			Identity:      opts.Identity,
+			EventRecorder: mgr.GetRecorder(opts.Identity),
+		})
+	if err != nil {
+		return fmt.Errorf("error creating leader election lock: %v", err)
+	}
+
+	// The elector can't be stopped so once stop is closed the lock fails and
+	// neither acquires nor renews the lease
+	errChan := make(chan error, 2)
+	elector, err := clientleaderelection.NewLeaderElector(clientleaderelection.LeaderElectionConfig{
+		Lock:          &stoppableLock{Interface: lock, stop: stop},
+		LeaseDuration: opts.LeaseDuration,
+		RenewDeadline: opts.RenewDeadline,
+		RetryPeriod:   opts.RetryPeriod,
+		Callbacks: clientleaderelection.LeaderCallbacks{
+			OnStartedLeading: func(leading <-chan struct{}) {
+				log.Info("acquired lease, starting manager", "namespace", opts.Namespace, "name", opts.Name, "identity", opts.Identity)
+				if err := mgr.Start(either(stop, leading)); err != nil {
+					errChan <- err
+				}
+			},
+			OnStoppedLeading: func() {
+				errChan <- fmt.Errorf("leader election lost")
+			},
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("error creating leader elector: %v", err)
+	}
+
+	log.Info("waiting to acquire lease", "namespace", opts.Namespace, "name", opts.Name, "identity", opts.Identity)
+	go elector.Run()
+
+	select {
+	case <-stop:
+		return nil
+	case err := <-errChan:
+		return err
+	}
+}
+
+// setDefaults defaults the fields that aren't set in the Options
+func setDefaults(opts Options) (Options, error) {
+	if opts.Name == "" {
+		opts.Name = DefaultName
+	}
+	if opts.Namespace == "" {
+		namespace, err := ioutil.ReadFile(inClusterNamespacePath)
+		if err != nil {
+			return opts, fmt.Errorf("error finding leader election namespace, it must be set when not running in-cluster: %v", err)
+		}
+		opts.Namespace = strings.TrimSpace(string(namespace))
+	}
+	if opts.Identity == "" {
+		hostname, err := os.Hostname()
+		if err != nil {
+			return opts, fmt.Errorf("error getting hostname: %v", err)
+		}
+		opts.Identity = hostname + "_" + string(uuid.NewUUID())
+	}
+	if opts.LeaseDuration == 0 {
+		opts.LeaseDuration = DefaultLeaseDuration
+	}
+	if opts.RenewDeadline == 0 {
+		opts.RenewDeadline = DefaultRenewDeadline
+	}
+	if opts.RetryPeriod == 0 {
+		opts.RetryPeriod = DefaultRetryPeriod
+	}
+	if opts.RenewDeadline >= opts.LeaseDuration {
+		return opts, fmt.Errorf("invalid leader election timings, renew deadline %v must be shorter than lease duration %v", opts.RenewDeadline, opts.LeaseDuration)
+	}
+	return opts, nil
+}
+
+// either returns a channel which is closed once either a or b is closed
+func either(a, b <-chan struct{}) <-chan struct{} {
+	c := make(chan struct{})
+	go func() {
+		defer close(c)
+		select {
+		case <-a:
+		case <-b:
+		}
+	}()
+	return c
+}
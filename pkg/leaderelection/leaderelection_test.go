@@ -0,0 +1,174 @@
+/*
+Copyright 2018 Pusher Ltd.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package leaderelection
+
+import (
+	"encoding/json"
+	"sync"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/pusher/wave/pkg/controller"
+	"github.com/pusher/wave/pkg/core"
+	"github.com/pusher/wave/test/utils"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/leaderelection/resourcelock"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/manager"
+)
+
+var _ = Describe("Wave leader election Suite", func() {
+	var m utils.Matcher
+	var deployment *appsv1.Deployment
+	var lease *corev1.ConfigMap
+	var stops map[string]chan struct{}
+	var stopped *sync.WaitGroup
+
+	const timeout = time.Second * 10
+	const consistentlyTimeout = time.Second * 3
+
+	// Each replica records the configuration hash in its own annotation so
+	// that the replica that reconciled the Deployment can be told apart
+	var hashAnnotations = map[string]string{
+		"replica-a": "replica-a.example.com/config-hash",
+		"replica-b": "replica-b.example.com/config-hash",
+	}
+
+	// startReplica starts a manager running the Wave controllers under the
+	// shared lease
+	var startReplica = func(identity string) {
+		mgr, err := manager.New(cfg, manager.Options{})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(controller.AddToManager(mgr, core.Options{ConfigHashAnnotation: hashAnnotations[identity]})).To(Succeed())
+
+		stop := make(chan struct{})
+		stops[identity] = stop
+		stopped.Add(1)
+		go func() {
+			defer GinkgoRecover()
+			defer stopped.Done()
+			Expect(Start(cfg, mgr, Options{
+				Name:          lease.GetName(),
+				Namespace:     lease.GetNamespace(),
+				Identity:      identity,
+				LeaseDuration: 2 * time.Second,
+				RenewDeadline: time.Second,
+				RetryPeriod:   200 * time.Millisecond,
+			}, stop)).To(Succeed())
+		}()
+	}
+
+	// hashWriters returns the replicas whose annotation holds a hash on the
+	// Deployment's PodTemplate
+	var hashWriters = func(obj *appsv1.Deployment) []string {
+		writers := []string{}
+		for identity, annotation := range hashAnnotations {
+			if _, ok := obj.Spec.Template.GetAnnotations()[annotation]; ok {
+				writers = append(writers, identity)
+			}
+		}
+		return writers
+	}
+
+	// leaseHolder returns the identity recorded as holding the lease
+	var leaseHolder = func(obj *corev1.ConfigMap) string {
+		record := resourcelock.LeaderElectionRecord{}
+		if err := json.Unmarshal([]byte(obj.GetAnnotations()[resourcelock.LeaderElectionRecordAnnotationKey]), &record); err != nil {
+			return ""
+		}
+		return record.HolderIdentity
+	}
+
+	BeforeEach(func() {
+		// Read directly from the API server, as no manager's cache runs
+		// until a replica acquires the lease
+		c, err := client.New(cfg, client.Options{})
+		Expect(err).NotTo(HaveOccurred())
+		m = utils.Matcher{Client: c}
+
+		for _, obj := range []core.Object{
+			utils.ExampleConfigMap1.DeepCopy(),
+			utils.ExampleConfigMap2.DeepCopy(),
+			utils.ExampleSecret1.DeepCopy(),
+			utils.ExampleSecret2.DeepCopy(),
+		} {
+			m.Create(obj).Should(Succeed())
+		}
+
+		lease = &corev1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "wave-leader-election"},
+		}
+		stops = make(map[string]chan struct{})
+		stopped = &sync.WaitGroup{}
+		startReplica("replica-a")
+		startReplica("replica-b")
+
+		deployment = utils.ExampleDeployment.DeepCopy()
+		deployment.SetAnnotations(map[string]string{core.RequiredAnnotation: "true"})
+		m.Create(deployment).Should(Succeed())
+	})
+
+	AfterEach(func() {
+		for _, stop := range stops {
+			close(stop)
+		}
+		stopped.Wait()
+
+		// Make sure to delete the finalizer so the Deployment can be deleted
+		m.Get(deployment, timeout).Should(Succeed())
+		deployment.SetFinalizers([]string{})
+		m.Update(deployment).Should(Succeed())
+
+		utils.DeleteAll(cfg, timeout,
+			&appsv1.DeploymentList{},
+			&corev1.ConfigMapList{},
+			&corev1.SecretList{},
+			&corev1.EventList{},
+		)
+	})
+
+	It("Only the leader writes the config hash", func() {
+		m.Eventually(deployment, timeout).Should(WithTransform(hashWriters, HaveLen(1)))
+		m.Consistently(deployment, consistentlyTimeout).Should(WithTransform(hashWriters, HaveLen(1)))
+
+		m.Get(lease, timeout).Should(Succeed())
+		Expect(hashWriters(deployment)).To(ConsistOf(leaseHolder(lease)))
+	})
+
+	Context("When the leader stops", func() {
+		var leader string
+
+		BeforeEach(func() {
+			m.Eventually(deployment, timeout).Should(WithTransform(hashWriters, HaveLen(1)))
+			leader = hashWriters(deployment)[0]
+
+			close(stops[leader])
+			delete(stops, leader)
+		})
+
+		It("The standby takes over the lease", func() {
+			m.Eventually(lease, timeout).Should(WithTransform(leaseHolder, Not(Equal(leader))))
+		})
+
+		It("The standby writes the config hash", func() {
+			m.Eventually(deployment, timeout).Should(WithTransform(hashWriters, HaveLen(2)))
+		})
+	})
+})
@@ -0,0 +1,68 @@
+/*
+Copyright 2018 Pusher Ltd.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package leaderelection
+
+import (
+	"fmt"
+
+	"k8s.io/client-go/tools/leaderelection/resourcelock"
+)
+
+// stoppableLock wraps a resourcelock.Interface so that it fails once stop is
+// closed, preventing an elector that can't be stopped from acquiring or
+// renewing the lease
+type stoppableLock struct {
+	resourcelock.Interface
+	stop <-chan struct{}
+}
+
+// errStopped is returned by a stoppableLock once stopped
+var errStopped = fmt.Errorf("leader election stopped")
+
+// stopped returns true once stop is closed
+func (l *stoppableLock) stopped() bool {
+	select {
+	case <-l.stop:
+		return true
+	default:
+		return false
+	}
+}
+
+// Get returns the LeaderElectionRecord, unless the lock is stopped
+func (l *stoppableLock) Get() (*resourcelock.LeaderElectionRecord, error) {
+	if l.stopped() {
+		return nil, errStopped
+	}
+	return l.Interface.Get()
+}
+
+// Create creates the LeaderElectionRecord, unless the lock is stopped
+func (l *stoppableLock) Create(ler resourcelock.LeaderElectionRecord) error {
+	if l.stopped() {
+		return errStopped
+	}
+	return l.Interface.Create(ler)
+}
+
+// Update updates the LeaderElectionRecord, unless the lock is stopped
+func (l *stoppableLock) Update(ler resourcelock.LeaderElectionRecord) error {
+	if l.stopped() {
+		return errStopped
+	}
+	return l.Interface.Update(ler)
+}
@@ -0,0 +1,118 @@
+/*
+Copyright 2018 Pusher Ltd.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package metrics
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// CounterVec is a set of counters partitioned by the values of its labels
+type CounterVec struct {
+	// Name is the name of the metric
+	Name string
+
+	// Help describes the metric
+	Help string
+
+	// Labels are the names of the labels partitioning the counters
+	Labels []string
+
+	lock   sync.Mutex
+	values map[string]*counter
+}
+
+// counter is the value of a CounterVec for a set of label values
+type counter struct {
+	labelValues []string
+	value       float64
+}
+
+// NewCounterVec constructs a CounterVec with the given name, description and
+// label names
+func NewCounterVec(name, help string, labels ...string) *CounterVec {
+	return &CounterVec{
+		Name:   name,
+		Help:   help,
+		Labels: labels,
+		values: make(map[string]*counter),
+	}
+}
+
+// Inc increments the counter with the given label values.
+// The values must be given in the same order as the CounterVec's Labels
+func (c *CounterVec) Inc(labelValues ...string) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	key := counterKey(labelValues)
+	if _, ok := c.values[key]; !ok {
+		c.values[key] = &counter{labelValues: append([]string{}, labelValues...)}
+	}
+	c.values[key].value++
+}
+
+// Value returns the value of the counter with the given label values
+func (c *CounterVec) Value(labelValues ...string) float64 {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	if counter, ok := c.values[counterKey(labelValues)]; ok {
+		return counter.value
+	}
+	return 0
+}
+
+// write writes all counters in the Prometheus text exposition format
+func (c *CounterVec) write(w io.Writer) error {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	if _, err := fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s counter\n", c.Name, c.Help, c.Name); err != nil {
+		return err
+	}
+
+	// Sort the counters so that the output is deterministic
+	keys := []string{}
+	for key := range c.values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		counter := c.values[key]
+		labels := []string{}
+		for i, name := range c.Labels {
+			if i < len(counter.labelValues) {
+				labels = append(labels, fmt.Sprintf("%s=%q", name, counter.labelValues[i]))
+			}
+		}
+		if _, err := fmt.Fprintf(w, "%s{%s} %v\n", c.Name, strings.Join(labels, ","), counter.value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// counterKey joins the label values with a separator that can't appear in a
+// label value
+func counterKey(labelValues []string) string {
+	return strings.Join(labelValues, "\xff")
+}
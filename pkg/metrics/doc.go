@@ -0,0 +1,23 @@
+/*
+Copyright 2018 Pusher Ltd.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package metrics contains the metrics recorded by the Wave controllers and
+// the event handlers that record why each reconcile was triggered.
+// The metrics are kept in their own registry and served by Handler in the
+// Prometheus text exposition format, as the version of controller-runtime
+// Wave is built against has no metrics registry of its own and Wave doesn't
+// depend on the Prometheus client library
+package metrics
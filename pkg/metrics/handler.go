@@ -0,0 +1,40 @@
+/*
+Copyright 2018 Pusher Ltd.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package metrics
+
+import (
+	"io"
+	"net/http"
+)
+
+// collector is a metric that can be served by the Handler
+type collector interface {
+	write(w io.Writer) error
+}
+
+// Handler returns an http.Handler serving all of Wave's metrics in the
+// Prometheus text exposition format
+func Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+		for _, c := range []collector{ReconcilesTotal, ReconcileErrorsTotal, HashChangesTotal, ReconcileDuration} {
+			if err := c.write(w); err != nil {
+				return
+			}
+		}
+	})
+}
@@ -0,0 +1,36 @@
+/*
+Copyright 2018 Pusher Ltd.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package metrics
+
+import (
+	"net/http/httptest"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Wave metrics handler Suite", func() {
+	It("Serves the reconcile counter in the Prometheus text format", func() {
+		ReconcilesTotal.Inc("Deployment", string(ReasonChildChange))
+
+		recorder := httptest.NewRecorder()
+		Handler().ServeHTTP(recorder, httptest.NewRequest("GET", "/metrics", nil))
+
+		Expect(recorder.Body.String()).To(ContainSubstring("# TYPE wave_reconciles_total counter\n"))
+		Expect(recorder.Body.String()).To(MatchRegexp(`wave_reconciles_total\{kind="Deployment",reason="child-change"\} [1-9]`))
+	})
+})
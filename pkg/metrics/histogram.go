@@ -0,0 +1,145 @@
+/*
+Copyright 2018 Pusher Ltd.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package metrics
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// DefaultBuckets are the upper bounds, in seconds, of the buckets used for
+// histograms of reconcile durations
+var DefaultBuckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+// HistogramVec is a set of histograms partitioned by the values of its labels
+type HistogramVec struct {
+	// Name is the name of the metric
+	Name string
+
+	// Help describes the metric
+	Help string
+
+	// Buckets are the upper bounds of the histogram's buckets, in increasing
+	// order
+	Buckets []float64
+
+	// Labels are the names of the labels partitioning the histograms
+	Labels []string
+
+	lock   sync.Mutex
+	values map[string]*histogram
+}
+
+// histogram is the value of a HistogramVec for a set of label values
+type histogram struct {
+	labelValues []string
+	counts      []uint64
+	count       uint64
+	sum         float64
+}
+
+// NewHistogramVec constructs a HistogramVec with the given name, description,
+// buckets and label names
+func NewHistogramVec(name, help string, buckets []float64, labels ...string) *HistogramVec {
+	return &HistogramVec{
+		Name:    name,
+		Help:    help,
+		Buckets: buckets,
+		Labels:  labels,
+		values:  make(map[string]*histogram),
+	}
+}
+
+// Observe adds the value to the histogram with the given label values.
+// The values must be given in the same order as the HistogramVec's Labels
+func (h *HistogramVec) Observe(value float64, labelValues ...string) {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+
+	key := counterKey(labelValues)
+	if _, ok := h.values[key]; !ok {
+		h.values[key] = &histogram{
+			labelValues: append([]string{}, labelValues...),
+			counts:      make([]uint64, len(h.Buckets)),
+		}
+	}
+	hist := h.values[key]
+	for i, bound := range h.Buckets {
+		if value <= bound {
+			hist.counts[i]++
+		}
+	}
+	hist.count++
+	hist.sum += value
+}
+
+// Count returns the number of values observed by the histogram with the given
+// label values
+func (h *HistogramVec) Count(labelValues ...string) uint64 {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+
+	if hist, ok := h.values[counterKey(labelValues)]; ok {
+		return hist.count
+	}
+	return 0
+}
+
+// write writes all histograms in the Prometheus text exposition format
+func (h *HistogramVec) write(w io.Writer) error {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+
+	if _, err := fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s histogram\n", h.Name, h.Help, h.Name); err != nil {
+		return err
+	}
+
+	// Sort the histograms so that the output is deterministic
+	keys := []string{}
+	for key := range h.values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		hist := h.values[key]
+		labels := []string{}
+		for i, name := range h.Labels {
+			if i < len(hist.labelValues) {
+				labels = append(labels, fmt.Sprintf("%s=%q", name, hist.labelValues[i]))
+			}
+		}
+
+		for i, bound := range h.Buckets {
+			le := fmt.Sprintf("le=%q", strconv.FormatFloat(bound, 'g', -1, 64))
+			if _, err := fmt.Fprintf(w, "%s_bucket{%s} %d\n", h.Name, strings.Join(append(labels, le), ","), hist.counts[i]); err != nil {
+				return err
+			}
+		}
+		if _, err := fmt.Fprintf(w, "%s_bucket{%s} %d\n", h.Name, strings.Join(append(labels, `le="+Inf"`), ","), hist.count); err != nil {
+			return err
+		}
+		if _, err := fmt.Fprintf(w, "%s_sum{%s} %v\n%s_count{%s} %d\n", h.Name, strings.Join(labels, ","), hist.sum, h.Name, strings.Join(labels, ","), hist.count); err != nil {
+			return err
+		}
+	}
+	return nil
+}
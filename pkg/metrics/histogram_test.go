@@ -0,0 +1,53 @@
+/*
+Copyright 2018 Pusher Ltd.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package metrics
+
+import (
+	"bytes"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Wave histogram Suite", func() {
+	var h *HistogramVec
+
+	BeforeEach(func() {
+		h = NewHistogramVec("example_seconds", "An example histogram", []float64{0.1, 1}, "namespace", "kind")
+		h.Observe(0.05, "default", "Deployment")
+		h.Observe(0.5, "default", "Deployment")
+		h.Observe(5, "default", "Deployment")
+	})
+
+	It("Counts the observed values by label values", func() {
+		Expect(h.Count("default", "Deployment")).To(Equal(uint64(3)))
+		Expect(h.Count("default", "DaemonSet")).To(BeZero())
+	})
+
+	It("Writes cumulative buckets, the sum and the count", func() {
+		buf := &bytes.Buffer{}
+		Expect(h.write(buf)).To(Succeed())
+		Expect(buf.String()).To(Equal(`# HELP example_seconds An example histogram
+# TYPE example_seconds histogram
+example_seconds_bucket{namespace="default",kind="Deployment",le="0.1"} 1
+example_seconds_bucket{namespace="default",kind="Deployment",le="1"} 2
+example_seconds_bucket{namespace="default",kind="Deployment",le="+Inf"} 3
+example_seconds_sum{namespace="default",kind="Deployment"} 5.55
+example_seconds_count{namespace="default",kind="Deployment"} 3
+`))
+	})
+})
@@ -0,0 +1,158 @@
+/*
+Copyright 2018 Pusher Ltd.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package metrics
+
+import (
+	"sync"
+
+	"k8s.io/client-go/util/workqueue"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+// Reason describes what triggered a reconcile
+type Reason string
+
+const (
+	// ReasonWorkloadChange is a reconcile triggered by the workload being
+	// created, updated or deleted
+	ReasonWorkloadChange Reason = "workload-change"
+
+	// ReasonChildChange is a reconcile triggered by a change to one of the
+	// workload's children
+	ReasonChildChange Reason = "child-change"
+
+	// ReasonNamespaceChange is a reconcile triggered by a change to the
+	// RequiredAnnotation on the workload's namespace
+	ReasonNamespaceChange Reason = "namespace-change"
+
+	// ReasonResync is a reconcile triggered by the periodic resync of the
+	// workload informer
+	ReasonResync Reason = "resync"
+
+	// ReasonManual is a reconcile that wasn't triggered by a watch, eg. one
+	// requeued after an error or a backoff
+	ReasonManual Reason = "manual"
+)
+
+// ReconcilesTotal counts the reconciles of each kind of workload by the Reason
+// they were triggered
+var ReconcilesTotal = NewCounterVec("wave_reconciles_total", "Total number of reconciles by workload kind and trigger", "kind", "reason")
+
+var (
+	// reasons holds the Reason each pending request was enqueued for, by the
+	// kind of workload
+	reasons     = make(map[string]map[reconcile.Request]Reason)
+	reasonsLock sync.Mutex
+)
+
+// RecordReconcile increments the ReconcilesTotal counter for the request,
+// labelled by the Reason it was enqueued for.
+// Called by each controller at the start of a reconcile
+func RecordReconcile(kind string, req reconcile.Request) {
+	ReconcilesTotal.Inc(kind, string(popReason(kind, req)))
+}
+
+// recordReason records the Reason the request was enqueued for.
+// Events that occur before the request is reconciled are collapsed into a
+// single reconcile, which is attributed to the first of them
+func recordReason(kind string, req reconcile.Request, reason Reason) {
+	reasonsLock.Lock()
+	defer reasonsLock.Unlock()
+
+	if _, ok := reasons[kind]; !ok {
+		reasons[kind] = make(map[reconcile.Request]Reason)
+	}
+	if _, ok := reasons[kind][req]; !ok {
+		reasons[kind][req] = reason
+	}
+}
+
+// popReason returns and forgets the Reason the request was enqueued for.
+// Requests enqueued outside of a watch return ReasonManual
+func popReason(kind string, req reconcile.Request) Reason {
+	reasonsLock.Lock()
+	defer reasonsLock.Unlock()
+
+	reason, ok := reasons[kind][req]
+	if !ok {
+		return ReasonManual
+	}
+	delete(reasons[kind], req)
+	return reason
+}
+
+// EnqueueWithReason wraps an EventHandler so that every request it enqueues
+// for the kind of workload is recorded with the given Reason.
+// Updates that don't change the resourceVersion are periodic resyncs and are
+// recorded with ReasonResync instead
+func EnqueueWithReason(kind string, reason Reason, h handler.EventHandler) handler.EventHandler {
+	return &reasonHandler{EventHandler: h, kind: kind, reason: reason}
+}
+
+// reasonHandler records the Reason for all requests enqueued by the wrapped
+// EventHandler
+type reasonHandler struct {
+	handler.EventHandler
+	kind   string
+	reason Reason
+}
+
+// Create implements handler.EventHandler
+func (r *reasonHandler) Create(evt event.CreateEvent, q workqueue.RateLimitingInterface) {
+	r.EventHandler.Create(evt, r.queue(q, r.reason))
+}
+
+// Update implements handler.EventHandler
+func (r *reasonHandler) Update(evt event.UpdateEvent, q workqueue.RateLimitingInterface) {
+	reason := r.reason
+	if evt.MetaOld != nil && evt.MetaNew != nil && evt.MetaOld.GetResourceVersion() == evt.MetaNew.GetResourceVersion() {
+		reason = ReasonResync
+	}
+	r.EventHandler.Update(evt, r.queue(q, reason))
+}
+
+// Delete implements handler.EventHandler
+func (r *reasonHandler) Delete(evt event.DeleteEvent, q workqueue.RateLimitingInterface) {
+	r.EventHandler.Delete(evt, r.queue(q, r.reason))
+}
+
+// Generic implements handler.EventHandler
+func (r *reasonHandler) Generic(evt event.GenericEvent, q workqueue.RateLimitingInterface) {
+	r.EventHandler.Generic(evt, r.queue(q, r.reason))
+}
+
+// queue wraps the workqueue to record the Reason for each request added to it
+func (r *reasonHandler) queue(q workqueue.RateLimitingInterface, reason Reason) workqueue.RateLimitingInterface {
+	return &reasonQueue{RateLimitingInterface: q, kind: r.kind, reason: reason}
+}
+
+// reasonQueue records the Reason for each request added to the workqueue
+type reasonQueue struct {
+	workqueue.RateLimitingInterface
+	kind   string
+	reason Reason
+}
+
+// Add implements workqueue.Interface
+func (q *reasonQueue) Add(item interface{}) {
+	if req, ok := item.(reconcile.Request); ok {
+		recordReason(q.kind, req, q.reason)
+	}
+	q.RateLimitingInterface.Add(item)
+}
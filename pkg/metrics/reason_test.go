@@ -0,0 +1,136 @@
+/*
+Copyright 2018 Pusher Ltd.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package metrics
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/pusher/wave/test/utils"
+	appsv1 "k8s.io/api/apps/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/util/workqueue"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+var _ = Describe("Wave reconcile reason Suite", func() {
+	const kind = "Deployment"
+
+	var queue workqueue.RateLimitingInterface
+	var deployment *appsv1.Deployment
+	var request reconcile.Request
+
+	// reconcileNext pops the next request from the queue and records its
+	// reconcile as the controllers do
+	var reconcileNext = func() {
+		item, _ := queue.Get()
+		queue.Done(item)
+		RecordReconcile(kind, item.(reconcile.Request))
+	}
+
+	BeforeEach(func() {
+		queue = workqueue.NewRateLimitingQueue(workqueue.DefaultControllerRateLimiter())
+		deployment = utils.ExampleDeployment.DeepCopy()
+		deployment.SetResourceVersion("1")
+		request = reconcile.Request{
+			NamespacedName: types.NamespacedName{Namespace: deployment.GetNamespace(), Name: deployment.GetName()},
+		}
+	})
+
+	AfterEach(func() {
+		queue.ShutDown()
+	})
+
+	Context("With a workload EventHandler", func() {
+		var h handler.EventHandler
+
+		BeforeEach(func() {
+			h = EnqueueWithReason(kind, ReasonWorkloadChange, &handler.EnqueueRequestForObject{})
+		})
+
+		It("Counts reconciles triggered by an update as workload changes", func() {
+			before := ReconcilesTotal.Value(kind, string(ReasonWorkloadChange))
+
+			updated := deployment.DeepCopy()
+			updated.SetResourceVersion("2")
+			h.Update(event.UpdateEvent{MetaOld: deployment, ObjectOld: deployment, MetaNew: updated, ObjectNew: updated}, queue)
+			reconcileNext()
+
+			Expect(ReconcilesTotal.Value(kind, string(ReasonWorkloadChange))).To(Equal(before + 1))
+		})
+
+		It("Counts reconciles triggered by a resync as resyncs", func() {
+			before := ReconcilesTotal.Value(kind, string(ReasonResync))
+			workloadChanges := ReconcilesTotal.Value(kind, string(ReasonWorkloadChange))
+
+			h.Update(event.UpdateEvent{MetaOld: deployment, ObjectOld: deployment, MetaNew: deployment, ObjectNew: deployment}, queue)
+			reconcileNext()
+
+			Expect(ReconcilesTotal.Value(kind, string(ReasonResync))).To(Equal(before + 1))
+			Expect(ReconcilesTotal.Value(kind, string(ReasonWorkloadChange))).To(Equal(workloadChanges))
+		})
+	})
+
+	Context("With a child EventHandler", func() {
+		It("Counts reconciles triggered by a child as child changes", func() {
+			before := ReconcilesTotal.Value(kind, string(ReasonChildChange))
+
+			cm := utils.ExampleConfigMap1.DeepCopy()
+			h := EnqueueWithReason(kind, ReasonChildChange, &handler.EnqueueRequestsFromMapFunc{
+				ToRequests: handler.ToRequestsFunc(func(handler.MapObject) []reconcile.Request {
+					return []reconcile.Request{request}
+				}),
+			})
+			h.Generic(event.GenericEvent{Meta: cm, Object: cm}, queue)
+			reconcileNext()
+
+			Expect(ReconcilesTotal.Value(kind, string(ReasonChildChange))).To(Equal(before + 1))
+		})
+	})
+
+	It("Counts reconciles that weren't triggered by a watch as manual", func() {
+		before := ReconcilesTotal.Value(kind, string(ReasonManual))
+
+		queue.AddRateLimited(request)
+		reconcileNext()
+
+		Expect(ReconcilesTotal.Value(kind, string(ReasonManual))).To(Equal(before + 1))
+	})
+
+	It("Attributes events collapsed into a single reconcile to the first event", func() {
+		workloadChanges := ReconcilesTotal.Value(kind, string(ReasonWorkloadChange))
+		childChanges := ReconcilesTotal.Value(kind, string(ReasonChildChange))
+
+		EnqueueWithReason(kind, ReasonWorkloadChange, &handler.EnqueueRequestForObject{}).Create(event.CreateEvent{Meta: deployment, Object: deployment}, queue)
+		EnqueueWithReason(kind, ReasonChildChange, &handler.EnqueueRequestForObject{}).Generic(event.GenericEvent{Meta: deployment, Object: deployment}, queue)
+		Expect(queue.Len()).To(Equal(1))
+		reconcileNext()
+
+		Expect(ReconcilesTotal.Value(kind, string(ReasonWorkloadChange))).To(Equal(workloadChanges + 1))
+		Expect(ReconcilesTotal.Value(kind, string(ReasonChildChange))).To(Equal(childChanges))
+	})
+
+	It("Keeps separate counts for each kind of workload", func() {
+		before := ReconcilesTotal.Value("DaemonSet", string(ReasonWorkloadChange))
+
+		EnqueueWithReason(kind, ReasonWorkloadChange, &handler.EnqueueRequestForObject{}).Create(event.CreateEvent{Meta: deployment, Object: deployment}, queue)
+		reconcileNext()
+
+		Expect(ReconcilesTotal.Value("DaemonSet", string(ReasonWorkloadChange))).To(Equal(before))
+	})
+})
@@ -0,0 +1,49 @@
+/*
+Copyright 2018 Pusher Ltd.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package metrics
+
+import (
+	"time"
+)
+
+// ReconcileErrorsTotal counts the reconciles of workloads that failed, by the
+// workload's namespace and kind
+var ReconcileErrorsTotal = NewCounterVec("wave_reconcile_errors_total", "Total number of failed reconciles by workload namespace and kind", "namespace", "kind")
+
+// HashChangesTotal counts the updates of workloads' configuration hashes, by
+// the workload's namespace and kind
+var HashChangesTotal = NewCounterVec("wave_hash_changes_total", "Total number of configuration hash updates by workload namespace and kind", "namespace", "kind")
+
+// ReconcileDuration observes the duration of the reconciles of workloads, by
+// the workload's namespace and kind.
+// Its count is the total number of reconciles of each workload namespace and
+// kind
+var ReconcileDuration = NewHistogramVec("wave_reconcile_duration_seconds", "Duration of reconciles by workload namespace and kind", DefaultBuckets, "namespace", "kind")
+
+// RecordReconcileResult records the duration of a reconcile of a workload,
+// and whether it failed
+func RecordReconcileResult(namespace, kind string, duration time.Duration, err error) {
+	ReconcileDuration.Observe(duration.Seconds(), namespace, kind)
+	if err != nil {
+		ReconcileErrorsTotal.Inc(namespace, kind)
+	}
+}
+
+// RecordHashChange records an update of a workload's configuration hash
+func RecordHashChange(namespace, kind string) {
+	HashChangesTotal.Inc(namespace, kind)
+}
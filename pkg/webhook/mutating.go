@@ -0,0 +1,168 @@
+/*
+Copyright 2018 Pusher Ltd.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package webhook
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+
+	"github.com/pusher/wave/pkg/core"
+	admissionregistrationv1beta1 "k8s.io/api/admissionregistration/v1beta1"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/manager"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+	atypes "sigs.k8s.io/controller-runtime/pkg/webhook/admission/types"
+	webhooktypes "sigs.k8s.io/controller-runtime/pkg/webhook/types"
+)
+
+// MutatingPath is the path the mutating webhook is served on
+const MutatingPath = "/mutate-wave-annotations"
+
+// DefaultNamespaceLabel is the label on namespaces whose Deployments the
+// mutating webhook enables Wave for, unless another label is configured
+const DefaultNamespaceLabel = "wave.pusher.com/enabled"
+
+// NewMutatingWebhook constructs the webhook adding the RequiredAnnotation,
+// set to the first of the RequiredAnnotationValues, to Deployments created or
+// updated in namespaces with the namespaceLabel set to "true".
+// Namespaces are read with the reader given
+func NewMutatingWebhook(reader client.Reader, namespaceLabel string, opts core.Options) (*admission.Webhook, error) {
+	decoder, err := admission.NewDecoder(scheme.Scheme)
+	if err != nil {
+		return nil, fmt.Errorf("error creating decoder: %v", err)
+	}
+
+	annotation := opts.ForKind("Deployment").RequiredAnnotation
+	if annotation == "" {
+		annotation = core.RequiredAnnotation
+	}
+	// The first value enabling Wave is injected so that the Deployment is
+	// reconciled whichever values are configured
+	value := "true"
+	if len(opts.RequiredAnnotationValues) > 0 {
+		value = opts.RequiredAnnotationValues[0]
+	}
+
+	return &admission.Webhook{
+		Name: "namespaces.wave.pusher.com",
+		Type: webhooktypes.WebhookTypeMutating,
+		Path: MutatingPath,
+		Rules: []admissionregistrationv1beta1.RuleWithOperations{
+			{
+				Operations: []admissionregistrationv1beta1.OperationType{
+					admissionregistrationv1beta1.Create,
+					admissionregistrationv1beta1.Update,
+				},
+				Rule: admissionregistrationv1beta1.Rule{
+					APIGroups:   []string{appsv1.GroupName},
+					APIVersions: []string{"v1"},
+					Resources:   []string{"deployments"},
+				},
+			},
+		},
+		Handlers: []admission.Handler{
+			&annotationInjector{
+				reader:         reader,
+				namespaceLabel: namespaceLabel,
+				annotation:     annotation,
+				value:          value,
+				decoder:        decoder,
+			},
+		},
+	}, nil
+}
+
+// annotationInjector adds the RequiredAnnotation to Deployments in namespaces
+// that opted in to Wave through a label.
+// Deployments that already have the annotation, with any value, are left
+// untouched so that they can opt out explicitly
+type annotationInjector struct {
+	reader         client.Reader
+	namespaceLabel string
+	annotation     string
+	value          string
+	decoder        atypes.Decoder
+}
+
+// Handle adds the RequiredAnnotation to the Deployment in the request if its
+// namespace is labelled.
+// Requests for other kinds are allowed unmodified
+func (i *annotationInjector) Handle(ctx context.Context, req atypes.Request) atypes.Response {
+	if req.AdmissionRequest.Kind.Kind != "Deployment" {
+		return admission.ValidationResponse(true, "")
+	}
+
+	deployment := &appsv1.Deployment{}
+	if err := i.decoder.Decode(req, deployment); err != nil {
+		return admission.ErrorResponse(http.StatusBadRequest, fmt.Errorf("error decoding Deployment: %v", err))
+	}
+	if _, ok := deployment.GetAnnotations()[i.annotation]; ok {
+		return admission.ValidationResponse(true, "")
+	}
+
+	// Deployments may be created without a namespace, so the namespace of the
+	// request is used
+	ns := &corev1.Namespace{}
+	err := i.reader.Get(ctx, types.NamespacedName{Name: req.AdmissionRequest.Namespace}, ns)
+	if err != nil && errors.IsNotFound(err) {
+		return admission.ValidationResponse(true, "")
+	}
+	if err != nil {
+		return admission.ErrorResponse(http.StatusInternalServerError, fmt.Errorf("error getting namespace %s: %v", req.AdmissionRequest.Namespace, err))
+	}
+	if ns.GetLabels()[i.namespaceLabel] != "true" {
+		return admission.ValidationResponse(true, "")
+	}
+
+	mutated := deployment.DeepCopy()
+	annotations := mutated.GetAnnotations()
+	if annotations == nil {
+		annotations = make(map[string]string)
+	}
+	annotations[i.annotation] = i.value
+	mutated.SetAnnotations(annotations)
+	return admission.PatchResponse(deployment, mutated)
+}
+
+// addMutating serves the mutating webhook on the MutatingAddress while the
+// manager runs.
+// The MutatingWebhookConfiguration pointing the API server at it is
+// installed separately
+func addMutating(mgr manager.Manager, opts Options) error {
+	if opts.MutatingAddress == "" {
+		return nil
+	}
+
+	namespaceLabel := opts.NamespaceLabel
+	if namespaceLabel == "" {
+		namespaceLabel = DefaultNamespaceLabel
+	}
+	wh, err := NewMutatingWebhook(mgr.GetClient(), namespaceLabel, opts.Core)
+	if err != nil {
+		return err
+	}
+	if err := wh.Validate(); err != nil {
+		return fmt.Errorf("invalid mutating webhook: %v", err)
+	}
+	return serve(mgr, "mutating", opts.MutatingAddress, opts.CertDir, wh)
+}
@@ -0,0 +1,200 @@
+/*
+Copyright 2018 Pusher Ltd.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/pusher/wave/pkg/core"
+	"github.com/pusher/wave/test/utils"
+	admissionv1beta1 "k8s.io/api/admission/v1beta1"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+)
+
+// namespaceReader is a client.Reader serving the namespaces given
+type namespaceReader map[string]*corev1.Namespace
+
+func (r namespaceReader) Get(ctx context.Context, key client.ObjectKey, obj runtime.Object) error {
+	ns, ok := r[key.Name]
+	if !ok {
+		return errors.NewNotFound(corev1.Resource("namespaces"), key.Name)
+	}
+	ns.DeepCopyInto(obj.(*corev1.Namespace))
+	return nil
+}
+
+func (r namespaceReader) List(ctx context.Context, opts *client.ListOptions, list runtime.Object) error {
+	return nil
+}
+
+// jsonPatchOperation is an operation of the JSON patch returned by the webhook
+type jsonPatchOperation struct {
+	Op    string      `json:"op"`
+	Path  string      `json:"path"`
+	Value interface{} `json:"value"`
+}
+
+var _ = Describe("Wave mutating webhook Suite", func() {
+	var wh *admission.Webhook
+	var deployment *appsv1.Deployment
+	var namespaces namespaceReader
+
+	// review sends an AdmissionReview for the Deployment to the webhook and
+	// returns its response
+	var review = func(obj *appsv1.Deployment) *admissionv1beta1.AdmissionResponse {
+		raw, err := json.Marshal(obj)
+		Expect(err).NotTo(HaveOccurred())
+		body, err := json.Marshal(admissionv1beta1.AdmissionReview{
+			Request: &admissionv1beta1.AdmissionRequest{
+				UID:       "example",
+				Kind:      metav1.GroupVersionKind{Group: "apps", Version: "v1", Kind: "Deployment"},
+				Namespace: obj.GetNamespace(),
+				Operation: admissionv1beta1.Create,
+				Object:    runtime.RawExtension{Raw: raw},
+			},
+		})
+		Expect(err).NotTo(HaveOccurred())
+
+		req := httptest.NewRequest(http.MethodPost, MutatingPath, bytes.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		rec := httptest.NewRecorder()
+		wh.Handler().ServeHTTP(rec, req)
+
+		result := admissionv1beta1.AdmissionReview{}
+		Expect(json.Unmarshal(rec.Body.Bytes(), &result)).To(Succeed())
+		Expect(result.Response).NotTo(BeNil())
+		Expect(result.Response.UID).To(BeEquivalentTo("example"))
+		return result.Response
+	}
+
+	// patch returns the operations of the JSON patch in the response
+	var patch = func(response *admissionv1beta1.AdmissionResponse) []jsonPatchOperation {
+		ops := []jsonPatchOperation{}
+		if len(response.Patch) > 0 {
+			Expect(json.Unmarshal(response.Patch, &ops)).To(Succeed())
+		}
+		return ops
+	}
+
+	BeforeEach(func() {
+		namespaces = namespaceReader{
+			"default": &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{
+				Name:   "default",
+				Labels: map[string]string{DefaultNamespaceLabel: "true"},
+			}},
+			"unlabelled": &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "unlabelled"}},
+		}
+
+		var err error
+		wh, err = NewMutatingWebhook(namespaces, DefaultNamespaceLabel, core.Options{})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(wh.Validate()).To(Succeed())
+
+		deployment = utils.ExampleDeployment.DeepCopy()
+		deployment.APIVersion = "apps/v1"
+		deployment.Kind = "Deployment"
+	})
+
+	It("adds the required annotation to a Deployment in a labelled namespace", func() {
+		response := review(deployment)
+		Expect(response.Allowed).To(BeTrue())
+		Expect(patch(response)).To(ConsistOf(jsonPatchOperation{
+			Op:    "add",
+			Path:  "/metadata/annotations",
+			Value: map[string]interface{}{core.RequiredAnnotation: "true"},
+		}))
+	})
+
+	It("keeps the other annotations of the Deployment", func() {
+		deployment.SetAnnotations(map[string]string{"team": "payments"})
+		response := review(deployment)
+		Expect(response.Allowed).To(BeTrue())
+		Expect(patch(response)).To(ConsistOf(jsonPatchOperation{
+			Op:    "add",
+			Path:  "/metadata/annotations/wave.pusher.com~1update-on-config-change",
+			Value: "true",
+		}))
+	})
+
+	It("doesn't override a Deployment opting out explicitly", func() {
+		deployment.SetAnnotations(map[string]string{core.RequiredAnnotation: "false"})
+		response := review(deployment)
+		Expect(response.Allowed).To(BeTrue())
+		Expect(patch(response)).To(BeEmpty())
+	})
+
+	It("doesn't modify a Deployment in an unlabelled namespace", func() {
+		deployment.SetNamespace("unlabelled")
+		response := review(deployment)
+		Expect(response.Allowed).To(BeTrue())
+		Expect(patch(response)).To(BeEmpty())
+	})
+
+	It("doesn't modify a Deployment in a namespace with the label set to false", func() {
+		namespaces["default"].SetLabels(map[string]string{DefaultNamespaceLabel: "false"})
+		response := review(deployment)
+		Expect(response.Allowed).To(BeTrue())
+		Expect(patch(response)).To(BeEmpty())
+	})
+
+	It("doesn't modify a Deployment in a namespace that doesn't exist", func() {
+		deployment.SetNamespace("missing")
+		response := review(deployment)
+		Expect(response.Allowed).To(BeTrue())
+		Expect(patch(response)).To(BeEmpty())
+	})
+
+	It("uses the required annotation configured for Deployments", func() {
+		var err error
+		wh, err = NewMutatingWebhook(namespaces, DefaultNamespaceLabel, core.Options{
+			KindAnnotationKeys: map[string]core.AnnotationKeys{"Deployment": {RequiredAnnotation: "example.com/wave"}},
+		})
+		Expect(err).NotTo(HaveOccurred())
+
+		Expect(patch(review(deployment))).To(ConsistOf(jsonPatchOperation{
+			Op:    "add",
+			Path:  "/metadata/annotations",
+			Value: map[string]interface{}{"example.com/wave": "true"},
+		}))
+	})
+
+	It("sets the required annotation to the first value enabling Wave", func() {
+		var err error
+		wh, err = NewMutatingWebhook(namespaces, DefaultNamespaceLabel, core.Options{
+			RequiredAnnotationValues: []string{"enabled", "yes"},
+		})
+		Expect(err).NotTo(HaveOccurred())
+
+		Expect(patch(review(deployment))).To(ConsistOf(jsonPatchOperation{
+			Op:    "add",
+			Path:  "/metadata/annotations",
+			Value: map[string]interface{}{core.RequiredAnnotation: "enabled"},
+		}))
+	})
+})
@@ -0,0 +1,166 @@
+/*
+Copyright 2018 Pusher Ltd.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package webhook
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+
+	"github.com/pusher/wave/pkg/apis"
+	argov1alpha1 "github.com/pusher/wave/pkg/apis/argoproj/v1alpha1"
+	"github.com/pusher/wave/pkg/core"
+	admissionregistrationv1beta1 "k8s.io/api/admissionregistration/v1beta1"
+	appsv1 "k8s.io/api/apps/v1"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/manager"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+	atypes "sigs.k8s.io/controller-runtime/pkg/webhook/admission/types"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/types"
+)
+
+// ValidatingPath is the path the validating webhook is served on
+const ValidatingPath = "/validate-wave-annotations"
+
+// validatedKind is a kind of workload the validating webhook validates
+type validatedKind struct {
+	kind     string
+	resource string
+	group    string
+	version  string
+	newObj   func() core.Object
+}
+
+// validatedKinds returns the kinds of workload Wave reconciles with the
+// Options given, so that the webhook never rejects kinds Wave ignores.
+// ReplicaSets are only validated when Wave manages them, as the Deployment
+// controller copies the annotations of invalid Deployments created before the
+// webhook was installed to their ReplicaSets
+func validatedKinds(opts core.Options) []validatedKind {
+	kinds := []validatedKind{
+		{kind: "Deployment", resource: "deployments", group: appsv1.GroupName, version: "v1", newObj: func() core.Object { return &appsv1.Deployment{} }},
+		{kind: "StatefulSet", resource: "statefulsets", group: appsv1.GroupName, version: "v1", newObj: func() core.Object { return &appsv1.StatefulSet{} }},
+		{kind: "DaemonSet", resource: "daemonsets", group: appsv1.GroupName, version: "v1", newObj: func() core.Object { return &appsv1.DaemonSet{} }},
+		{kind: "Job", resource: "jobs", group: batchv1.GroupName, version: "v1", newObj: func() core.Object { return &batchv1.Job{} }},
+	}
+	if opts.ManageReplicaSets {
+		kinds = append(kinds, validatedKind{kind: "ReplicaSet", resource: "replicasets", group: appsv1.GroupName, version: "v1", newObj: func() core.Object { return &appsv1.ReplicaSet{} }})
+	}
+	if opts.ManagePods {
+		kinds = append(kinds, validatedKind{kind: "Pod", resource: "pods", group: corev1.GroupName, version: "v1", newObj: func() core.Object { return &corev1.Pod{} }})
+	}
+	if opts.ManageRollouts {
+		kinds = append(kinds, validatedKind{kind: "Rollout", resource: "rollouts", group: argov1alpha1.SchemeGroupVersion.Group, version: argov1alpha1.SchemeGroupVersion.Version, newObj: func() core.Object { return &argov1alpha1.Rollout{} }})
+	}
+	return kinds
+}
+
+// NewValidatingWebhook constructs the webhook rejecting workloads whose Wave
+// annotations are inconsistent: Deployments, StatefulSets, DaemonSets and
+// Jobs, as well as ReplicaSets, Pods and Argo Rollouts when Wave manages them
+func NewValidatingWebhook(opts core.Options) (*admission.Webhook, error) {
+	// Rollouts aren't registered with the client-go Scheme
+	s := runtime.NewScheme()
+	scheme.AddToScheme(s)
+	if err := apis.AddToScheme(s); err != nil {
+		return nil, fmt.Errorf("error building scheme: %v", err)
+	}
+	decoder, err := admission.NewDecoder(s)
+	if err != nil {
+		return nil, fmt.Errorf("error creating decoder: %v", err)
+	}
+
+	rules := []admissionregistrationv1beta1.RuleWithOperations{}
+	validator := &annotationValidator{
+		handlers: make(map[string]*core.Handler),
+		objects:  make(map[string]func() core.Object),
+		decoder:  decoder,
+	}
+	for _, k := range validatedKinds(opts) {
+		rules = append(rules, admissionregistrationv1beta1.RuleWithOperations{
+			Operations: []admissionregistrationv1beta1.OperationType{
+				admissionregistrationv1beta1.Create,
+				admissionregistrationv1beta1.Update,
+			},
+			Rule: admissionregistrationv1beta1.Rule{
+				APIGroups:   []string{k.group},
+				APIVersions: []string{k.version},
+				Resources:   []string{k.resource},
+			},
+		})
+		validator.handlers[k.kind] = core.NewHandler(nil, nil, opts.ForKind(k.kind))
+		validator.objects[k.kind] = k.newObj
+	}
+
+	return &admission.Webhook{
+		Name:     "annotations.wave.pusher.com",
+		Type:     types.WebhookTypeValidating,
+		Path:     ValidatingPath,
+		Rules:    rules,
+		Handlers: []admission.Handler{validator},
+	}, nil
+}
+
+// annotationValidator denies admission requests for workloads whose Wave
+// annotations are inconsistent.
+// Each kind is validated with the annotation keys configured for it
+type annotationValidator struct {
+	handlers map[string]*core.Handler
+	objects  map[string]func() core.Object
+	decoder  atypes.Decoder
+}
+
+// Handle validates the workload in the request.
+// Requests for kinds Wave doesn't validate are allowed
+func (v *annotationValidator) Handle(ctx context.Context, req atypes.Request) atypes.Response {
+	newObj, ok := v.objects[req.AdmissionRequest.Kind.Kind]
+	if !ok {
+		return admission.ValidationResponse(true, "")
+	}
+
+	obj := newObj()
+	if err := v.decoder.Decode(req, obj); err != nil {
+		return admission.ErrorResponse(http.StatusBadRequest, fmt.Errorf("error decoding %s: %v", req.AdmissionRequest.Kind.Kind, err))
+	}
+	if err := v.handlers[req.AdmissionRequest.Kind.Kind].ValidateAnnotations(obj); err != nil {
+		return admission.ErrorResponse(http.StatusForbidden, err)
+	}
+	return admission.ValidationResponse(true, "")
+}
+
+// addValidating serves the validating webhook on the ValidatingAddress while
+// the manager runs.
+// The ValidatingWebhookConfiguration pointing the API server at it is
+// installed separately
+func addValidating(mgr manager.Manager, opts Options) error {
+	if opts.ValidatingAddress == "" {
+		return nil
+	}
+
+	wh, err := NewValidatingWebhook(opts.Core)
+	if err != nil {
+		return err
+	}
+	if err := wh.Validate(); err != nil {
+		return fmt.Errorf("invalid validating webhook: %v", err)
+	}
+
+	return serve(mgr, "validating", opts.ValidatingAddress, opts.CertDir, wh)
+}
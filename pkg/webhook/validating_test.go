@@ -0,0 +1,160 @@
+/*
+Copyright 2018 Pusher Ltd.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package webhook
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/pusher/wave/pkg/core"
+	"github.com/pusher/wave/test/utils"
+	admissionv1beta1 "k8s.io/api/admission/v1beta1"
+	appsv1 "k8s.io/api/apps/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+)
+
+var _ = Describe("Wave validating webhook Suite", func() {
+	var wh *admission.Webhook
+	var deployment *appsv1.Deployment
+
+	// review sends an AdmissionReview for the object to the webhook and
+	// returns its response
+	var review = func(kind string, obj runtime.Object) *admissionv1beta1.AdmissionResponse {
+		raw, err := json.Marshal(obj)
+		Expect(err).NotTo(HaveOccurred())
+		body, err := json.Marshal(admissionv1beta1.AdmissionReview{
+			Request: &admissionv1beta1.AdmissionRequest{
+				UID:       "example",
+				Kind:      metav1.GroupVersionKind{Group: "apps", Version: "v1", Kind: kind},
+				Operation: admissionv1beta1.Create,
+				Object:    runtime.RawExtension{Raw: raw},
+			},
+		})
+		Expect(err).NotTo(HaveOccurred())
+
+		req := httptest.NewRequest(http.MethodPost, ValidatingPath, bytes.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		rec := httptest.NewRecorder()
+		wh.Handler().ServeHTTP(rec, req)
+
+		result := admissionv1beta1.AdmissionReview{}
+		Expect(json.Unmarshal(rec.Body.Bytes(), &result)).To(Succeed())
+		Expect(result.Response).NotTo(BeNil())
+		Expect(result.Response.UID).To(BeEquivalentTo("example"))
+		return result.Response
+	}
+
+	BeforeEach(func() {
+		var err error
+		wh, err = NewValidatingWebhook(core.Options{})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(wh.Validate()).To(Succeed())
+
+		deployment = utils.ExampleDeployment.DeepCopy()
+		deployment.APIVersion = "apps/v1"
+		deployment.Kind = "Deployment"
+	})
+
+	It("allows a Deployment with consistent annotations", func() {
+		deployment.SetAnnotations(map[string]string{
+			core.RequiredAnnotation: "true",
+			core.IgnoreAnnotation:   "example1",
+		})
+		Expect(review("Deployment", deployment).Allowed).To(BeTrue())
+	})
+
+	It("denies a Deployment requiring updates while ignoring every child", func() {
+		deployment.SetAnnotations(map[string]string{
+			core.RequiredAnnotation: "true",
+			core.IgnoreAnnotation:   "example1,example2",
+		})
+		response := review("Deployment", deployment)
+		Expect(response.Allowed).To(BeFalse())
+		Expect(response.Result).NotTo(BeNil())
+		Expect(response.Result.Code).To(BeEquivalentTo(http.StatusForbidden))
+		Expect(response.Result.Message).To(ContainSubstring("ignores every child"))
+	})
+
+	It("denies a Deployment with a malformed child list", func() {
+		deployment.SetAnnotations(map[string]string{
+			core.ExtraConfigMapsAnnotation: "/config",
+		})
+		response := review("Deployment", deployment)
+		Expect(response.Allowed).To(BeFalse())
+		Expect(response.Result.Message).To(ContainSubstring(`invalid child "/config"`))
+	})
+
+	It("allows kinds it doesn't validate", func() {
+		deployment.SetAnnotations(map[string]string{
+			core.ExtraConfigMapsAnnotation: "/config",
+		})
+		Expect(review("ReplicaSet", deployment).Allowed).To(BeTrue())
+	})
+
+	It("denies a Job with a malformed child list", func() {
+		job := utils.ExampleJob.DeepCopy()
+		job.SetAnnotations(map[string]string{
+			core.ExtraConfigMapsAnnotation: "/config",
+		})
+		response := review("Job", job)
+		Expect(response.Allowed).To(BeFalse())
+		Expect(response.Result.Message).To(ContainSubstring(`invalid child "/config"`))
+	})
+
+	It("denies a Rollout with a malformed child list when Rollouts are managed", func() {
+		var err error
+		wh, err = NewValidatingWebhook(core.Options{ManageRollouts: true})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(wh.Validate()).To(Succeed())
+
+		rollout := utils.ExampleRollout.DeepCopy()
+		rollout.APIVersion = "argoproj.io/v1alpha1"
+		rollout.Kind = "Rollout"
+		rollout.SetAnnotations(map[string]string{
+			core.ExtraConfigMapsAnnotation: "/config",
+		})
+		response := review("Rollout", rollout)
+		Expect(response.Allowed).To(BeFalse())
+		Expect(response.Result.Message).To(ContainSubstring(`invalid child "/config"`))
+	})
+
+	It("only validates Pods and ReplicaSets when they are managed", func() {
+		pod := utils.ExamplePod.DeepCopy()
+		pod.SetAnnotations(map[string]string{
+			core.ExtraConfigMapsAnnotation: "/config",
+		})
+		Expect(review("Pod", pod).Allowed).To(BeTrue())
+
+		var err error
+		wh, err = NewValidatingWebhook(core.Options{ManagePods: true, ManageReplicaSets: true})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(wh.Validate()).To(Succeed())
+		Expect(review("Pod", pod).Allowed).To(BeFalse())
+
+		replicaSet := utils.ExampleReplicaSet.DeepCopy()
+		replicaSet.SetAnnotations(map[string]string{
+			core.ExtraConfigMapsAnnotation: "/config",
+		})
+		Expect(review("ReplicaSet", replicaSet).Allowed).To(BeFalse())
+	})
+})
@@ -17,21 +17,75 @@ limitations under the License.
 package webhook
 
 import (
+	"fmt"
+	"net/http"
+	"path/filepath"
+
+	"github.com/pusher/wave/pkg/core"
 	"sigs.k8s.io/controller-runtime/pkg/manager"
+	logf "sigs.k8s.io/controller-runtime/pkg/runtime/log"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
 )
 
-// AddToManagerFuncs is a list of functions to add all Controllers to the Manager
-var AddToManagerFuncs []func(manager.Manager) error
+// Options configures the webhooks Wave serves
+type Options struct {
+	// ValidatingAddress is the address the validating webhook is served on
+	// over TLS. The webhook isn't served if empty
+	ValidatingAddress string
+
+	// MutatingAddress is the address the mutating webhook is served on over
+	// TLS. The webhook isn't served if empty
+	MutatingAddress string
+
+	// NamespaceLabel is the label on namespaces whose Deployments the mutating
+	// webhook adds the RequiredAnnotation to when it is set to "true".
+	// Defaults to DefaultNamespaceLabel.
+	NamespaceLabel string
+
+	// CertDir is the directory containing the tls.crt and tls.key the webhooks
+	// are served with
+	CertDir string
+
+	// Core are the Options the controllers run with, so that workloads are
+	// validated consistently with how they are reconciled
+	Core core.Options
+}
+
+// AddToManagerFuncs is a list of functions to add all Webhooks to the Manager
+var AddToManagerFuncs []func(manager.Manager, Options) error
 
-// AddToManager adds all Controllers to the Manager
+// AddToManager adds all Webhooks to the Manager
 // +kubebuilder:rbac:groups=admissionregistration.k8s.io,resources=mutatingwebhookconfigurations;validatingwebhookconfigurations,verbs=get;list;watch;create;update;patch;delete
 // +kubebuilder:rbac:groups="",resources=secrets,verbs=get;list;watch;create;update;patch;delete
 // +kubebuilder:rbac:groups="",resources=services,verbs=get;list;watch;create;update;patch;delete
-func AddToManager(m manager.Manager) error {
+func AddToManager(m manager.Manager, opts Options) error {
 	for _, f := range AddToManagerFuncs {
-		if err := f(m); err != nil {
+		if err := f(m, opts); err != nil {
 			return err
 		}
 	}
 	return nil
 }
+
+// serve serves the webhook on the address over TLS while the manager runs
+func serve(mgr manager.Manager, name, address, certDir string, wh *admission.Webhook) error {
+	mux := http.NewServeMux()
+	mux.Handle(wh.GetPath(), wh.Handler())
+	server := &http.Server{Addr: address, Handler: mux}
+
+	return mgr.Add(manager.RunnableFunc(func(stop <-chan struct{}) error {
+		logf.Log.WithName("webhook").Info(fmt.Sprintf("serving %s webhook", name), "address", address, "path", wh.GetPath())
+
+		errs := make(chan error, 1)
+		go func() {
+			errs <- server.ListenAndServeTLS(filepath.Join(certDir, "tls.crt"), filepath.Join(certDir, "tls.key"))
+		}()
+
+		select {
+		case err := <-errs:
+			return fmt.Errorf("error serving %s webhook: %v", name, err)
+		case <-stop:
+			return server.Close()
+		}
+	}))
+}
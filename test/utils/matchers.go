@@ -21,7 +21,9 @@ import (
 
 	"github.com/onsi/gomega"
 	gtypes "github.com/onsi/gomega/types"
+	argov1alpha1 "github.com/pusher/wave/pkg/apis/argoproj/v1alpha1"
 	appsv1 "k8s.io/api/apps/v1"
+	batchv1 "k8s.io/api/batch/v1"
 	"k8s.io/apimachinery/pkg/api/meta"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
@@ -142,6 +144,13 @@ func WithAnnotations(matcher gtypes.GomegaMatcher) gtypes.GomegaMatcher {
 	}, matcher)
 }
 
+// WithLabels returns the object's Labels
+func WithLabels(matcher gtypes.GomegaMatcher) gtypes.GomegaMatcher {
+	return gomega.WithTransform(func(obj Object) map[string]string {
+		return obj.GetLabels()
+	}, matcher)
+}
+
 // WithFinalizers returns the object's Finalizers
 func WithFinalizers(matcher gtypes.GomegaMatcher) gtypes.GomegaMatcher {
 	return gomega.WithTransform(func(obj Object) []string {
@@ -167,14 +176,25 @@ func WithOwnerReferences(matcher gtypes.GomegaMatcher) gtypes.GomegaMatcher {
 	}, matcher)
 }
 
-// WithPodTemplateAnnotations returns the deployments PodTemplate's annotations
+// WithPodTemplateAnnotations returns the workload's PodTemplate's annotations
 func WithPodTemplateAnnotations(matcher gtypes.GomegaMatcher) gtypes.GomegaMatcher {
 	return gomega.WithTransform(func(obj Object) map[string]string {
-		dep, ok := obj.(*appsv1.Deployment)
-		if !ok {
+		switch o := obj.(type) {
+		case *appsv1.Deployment:
+			return o.Spec.Template.GetAnnotations()
+		case *appsv1.DaemonSet:
+			return o.Spec.Template.GetAnnotations()
+		case *appsv1.StatefulSet:
+			return o.Spec.Template.GetAnnotations()
+		case *appsv1.ReplicaSet:
+			return o.Spec.Template.GetAnnotations()
+		case *batchv1.Job:
+			return o.Spec.Template.GetAnnotations()
+		case *argov1alpha1.Rollout:
+			return o.Spec.Template.GetAnnotations()
+		default:
 			panic("Unknown Object.")
 		}
-		return dep.Spec.Template.GetAnnotations()
 	}, matcher)
 }
 
@@ -17,19 +17,46 @@ limitations under the License.
 package utils
 
 import (
+	argov1alpha1 "github.com/pusher/wave/pkg/apis/argoproj/v1alpha1"
 	appsv1 "k8s.io/api/apps/v1"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 )
 
-// GetOwnerRef constructs an owner reference for the Deployment given
-func GetOwnerRef(deployment *appsv1.Deployment) metav1.OwnerReference {
+// GetOwnerRef constructs an owner reference for the workload given
+func GetOwnerRef(obj Object) metav1.OwnerReference {
+	var kind string
+	apiVersion := "apps/v1"
+	switch obj.(type) {
+	case *appsv1.Deployment:
+		kind = "Deployment"
+	case *appsv1.DaemonSet:
+		kind = "DaemonSet"
+	case *appsv1.StatefulSet:
+		kind = "StatefulSet"
+	case *appsv1.ReplicaSet:
+		kind = "ReplicaSet"
+	case *batchv1.Job:
+		kind = "Job"
+		apiVersion = "batch/v1"
+	case *corev1.Pod:
+		kind = "Pod"
+		apiVersion = "v1"
+	case *argov1alpha1.Rollout:
+		kind = "Rollout"
+		apiVersion = "argoproj.io/v1alpha1"
+	default:
+		panic("Unknown Object.")
+	}
+
 	f := false
 	t := true
 	return metav1.OwnerReference{
-		APIVersion:         "apps/v1",
-		Kind:               "Deployment",
-		Name:               deployment.Name,
-		UID:                deployment.UID,
+		APIVersion:         apiVersion,
+		Kind:               kind,
+		Name:               obj.GetName(),
+		UID:                obj.GetUID(),
 		Controller:         &f,
 		BlockOwnerDeletion: &t,
 	}
@@ -17,7 +17,11 @@ limitations under the License.
 package utils
 
 import (
+	"encoding/json"
+
+	argov1alpha1 "github.com/pusher/wave/pkg/apis/argoproj/v1alpha1"
 	appsv1 "k8s.io/api/apps/v1"
+	batchv1 "k8s.io/api/batch/v1"
 	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 )
@@ -109,6 +113,103 @@ var ExampleDeployment = &appsv1.Deployment{
 	},
 }
 
+// ExampleDaemonSet is an example DaemonSet object for use within test suites
+var ExampleDaemonSet = &appsv1.DaemonSet{
+	ObjectMeta: metav1.ObjectMeta{
+		Name:      "example",
+		Namespace: "default",
+		Labels:    labels,
+	},
+	Spec: appsv1.DaemonSetSpec{
+		Selector: &metav1.LabelSelector{
+			MatchLabels: labels,
+		},
+		Template: *ExampleDeployment.Spec.Template.DeepCopy(),
+	},
+}
+
+// ExampleStatefulSet is an example StatefulSet object for use within test
+// suites
+var ExampleStatefulSet = &appsv1.StatefulSet{
+	ObjectMeta: metav1.ObjectMeta{
+		Name:      "example",
+		Namespace: "default",
+		Labels:    labels,
+	},
+	Spec: appsv1.StatefulSetSpec{
+		Selector: &metav1.LabelSelector{
+			MatchLabels: labels,
+		},
+		ServiceName: "example",
+		Template:    *ExampleDeployment.Spec.Template.DeepCopy(),
+	},
+}
+
+// ExampleReplicaSet is an example ReplicaSet object for use within test
+// suites
+var ExampleReplicaSet = &appsv1.ReplicaSet{
+	ObjectMeta: metav1.ObjectMeta{
+		Name:      "example",
+		Namespace: "default",
+		Labels:    labels,
+	},
+	Spec: appsv1.ReplicaSetSpec{
+		Selector: &metav1.LabelSelector{
+			MatchLabels: labels,
+		},
+		Template: *ExampleDeployment.Spec.Template.DeepCopy(),
+	},
+}
+
+// ExampleJob is an example Job object for use within test suites
+var ExampleJob = &batchv1.Job{
+	ObjectMeta: metav1.ObjectMeta{
+		Name:      "example",
+		Namespace: "default",
+		Labels:    labels,
+	},
+	Spec: batchv1.JobSpec{
+		Template: exampleJobTemplate(),
+	},
+}
+
+// exampleJobTemplate returns a copy of the ExampleDeployment's PodTemplate
+// with a RestartPolicy valid for Jobs
+func exampleJobTemplate() corev1.PodTemplateSpec {
+	template := ExampleDeployment.Spec.Template.DeepCopy()
+	template.Spec.RestartPolicy = corev1.RestartPolicyNever
+	return *template
+}
+
+// ExampleRollout is an example Argo Rollout object for use within test suites.
+// Its strategy isn't decoded by Wave and must be preserved when Wave updates
+// it
+var ExampleRollout = &argov1alpha1.Rollout{
+	ObjectMeta: metav1.ObjectMeta{
+		Name:      "example",
+		Namespace: "default",
+		Labels:    labels,
+	},
+	Spec: argov1alpha1.RolloutSpec{
+		Template: *ExampleDeployment.Spec.Template.DeepCopy(),
+		Fields: map[string]json.RawMessage{
+			"selector": json.RawMessage(`{"matchLabels":{"app":"example"}}`),
+			"strategy": json.RawMessage(`{"canary":{"steps":[{"setWeight":20},{"pause":{}}]}}`),
+		},
+	},
+}
+
+// ExamplePod is an example Pod object with a generated name for use within
+// test suites
+var ExamplePod = &corev1.Pod{
+	ObjectMeta: metav1.ObjectMeta{
+		GenerateName: "example-",
+		Namespace:    "default",
+		Labels:       labels,
+	},
+	Spec: *ExampleDeployment.Spec.Template.Spec.DeepCopy(),
+}
+
 // ExampleConfigMap1 is an example ConfigMap object for use within test suites
 var ExampleConfigMap1 = &corev1.ConfigMap{
 	ObjectMeta: metav1.ObjectMeta{
@@ -164,3 +265,25 @@ var ExampleSecret2 = &corev1.Secret{
 		"key3": "example2:key3",
 	},
 }
+
+// ExampleChildren returns copies of the example ConfigMaps and Secrets as the
+// API server stores them, with the StringData of the Secrets written to their
+// Data
+func ExampleChildren() []Object {
+	children := []Object{
+		ExampleConfigMap1.DeepCopy(),
+		ExampleConfigMap2.DeepCopy(),
+		ExampleSecret1.DeepCopy(),
+		ExampleSecret2.DeepCopy(),
+	}
+	for _, child := range children {
+		if secret, ok := child.(*corev1.Secret); ok {
+			secret.Data = make(map[string][]byte)
+			for key, value := range secret.StringData {
+				secret.Data[key] = []byte(value)
+			}
+			secret.StringData = nil
+		}
+	}
+	return children
+}